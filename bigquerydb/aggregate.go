@@ -0,0 +1,192 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// aggregateCheckInterval is how often the aggregator looks for completed buckets.
+const aggregateCheckInterval = 15 * time.Second
+
+// aggregateRow holds the aggregates of the samples of a series within a bucket.
+type aggregateRow struct {
+	metricname string
+	tags       string
+	// start is the start of the bucket in seconds.
+	start int64
+	min   float64
+	max   float64
+	sum   float64
+	count int64
+}
+
+// Save implements the ValueSaver interface.
+func (r *aggregateRow) Save() (map[string]bigquery.Value, string, error) {
+	return map[string]bigquery.Value{
+		"metricname": r.metricname,
+		"tags":       r.tags,
+		"timestamp":  r.start,
+		"min":        r.min,
+		"max":        r.max,
+		"avg":        r.sum / float64(r.count),
+		"count":      r.count,
+	}, "", nil
+}
+
+// estimatedSize approximates the serialized size of the row in an insertAll request.
+func (r *aggregateRow) estimatedSize() int {
+	return len(r.metricname) + len(r.tags) + itemOverhead + 64
+}
+
+// aggregateKey identifies the bucket of a series.
+type aggregateKey struct {
+	series string
+	start  int64
+}
+
+// aggregator accumulates the samples of every series into buckets of a fixed interval and
+// hands the buckets to flush once no more samples are expected for them, which is lateness
+// after the end of the bucket. Later samples are dropped, as their bucket was already written.
+type aggregator struct {
+	mu          sync.Mutex
+	buckets     map[aggregateKey]*aggregateRow
+	interval    int64
+	lateness    time.Duration
+	now         func() time.Time
+	flush       func([]*aggregateRow)
+	lateSamples prometheus.Counter
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+func newAggregator(interval, lateness time.Duration, flush func([]*aggregateRow), lateSamples prometheus.Counter) *aggregator {
+	a := &aggregator{
+		buckets:     map[aggregateKey]*aggregateRow{},
+		interval:    max(int64(interval/time.Second), 1),
+		lateness:    lateness,
+		now:         time.Now,
+		flush:       flush,
+		lateSamples: lateSamples,
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go a.run(min(time.Duration(a.interval)*time.Second, aggregateCheckInterval))
+	return a
+}
+
+// add accumulates the rows into the buckets of their series.
+func (a *aggregator) add(rows []*Item) {
+	if a == nil {
+		return
+	}
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, item := range rows {
+		// Staleness markers and special values have no value to aggregate.
+		if item.stale || item.special != "" {
+			continue
+		}
+		start := item.timestamp - mod(item.timestamp, a.interval)
+		if a.completed(start, now) {
+			a.lateSamples.Inc()
+			continue
+		}
+		key := aggregateKey{series: item.metricname + "\xff" + item.tags, start: start}
+		bucket, ok := a.buckets[key]
+		if !ok {
+			a.buckets[key] = &aggregateRow{
+				metricname: item.metricname,
+				tags:       item.tags,
+				start:      start,
+				min:        item.value,
+				max:        item.value,
+				sum:        item.value,
+				count:      1,
+			}
+			continue
+		}
+		bucket.min = min(bucket.min, item.value)
+		bucket.max = max(bucket.max, item.value)
+		bucket.sum += item.value
+		bucket.count++
+	}
+}
+
+// completed returns whether no more samples are accepted for the bucket starting at start.
+func (a *aggregator) completed(start int64, now time.Time) bool {
+	end := time.Unix(start+a.interval, 0)
+	return !now.Before(end.Add(a.lateness))
+}
+
+// take removes the completed buckets, or all of them, and returns them sorted by start.
+func (a *aggregator) take(now time.Time, all bool) []*aggregateRow {
+	a.mu.Lock()
+	var rows []*aggregateRow
+	for key, bucket := range a.buckets {
+		if all || a.completed(key.start, now) {
+			rows = append(rows, bucket)
+			delete(a.buckets, key)
+		}
+	}
+	a.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool { return rows[i].start < rows[j].start })
+	return rows
+}
+
+// len returns the number of open buckets.
+func (a *aggregator) len() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.buckets)
+}
+
+func (a *aggregator) run(checkInterval time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if rows := a.take(a.now(), false); len(rows) > 0 {
+				a.flush(rows)
+			}
+		case <-a.done:
+			if rows := a.take(a.now(), true); len(rows) > 0 {
+				a.flush(rows)
+			}
+			close(a.stopped)
+			return
+		}
+	}
+}
+
+// close flushes all buckets, including the incomplete ones, and stops the background flusher.
+func (a *aggregator) close() {
+	close(a.done)
+	<-a.stopped
+}
+
+// mod returns the non-negative remainder of the division of a by b.
+func mod(a, b int64) int64 {
+	return ((a % b) + b) % b
+}
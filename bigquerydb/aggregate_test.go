@@ -0,0 +1,154 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// aggregateRecorder records the aggregated rows written to the aggregate table.
+type aggregateRecorder struct {
+	mu   sync.Mutex
+	err  error
+	rows []*aggregateRow
+}
+
+func (r *aggregateRecorder) Put(ctx context.Context, src interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.rows = append(r.rows, src.([]*aggregateRow)...)
+	return nil
+}
+
+// aggregateTestSeries returns a series with a sample every 60s from 240s to 600s, which
+// spans the 5 minute buckets starting at 0s, 300s and 600s.
+func aggregateTestSeries() []*prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "temperature"}, {Name: "room", Value: "lab"}}}
+	for t := int64(240); t <= 600; t += 60 {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t * 1000, Value: float64(t / 60)})
+	}
+	return []*prompb.TimeSeries{ts}
+}
+
+func TestAggregatorBuckets(t *testing.T) {
+	var flushed [][]*aggregateRow
+	a := newAggregator(5*time.Minute, time.Minute, func(rows []*aggregateRow) { flushed = append(flushed, rows) }, prometheus.NewCounter(prometheus.CounterOpts{Name: "late"}))
+	a.now = func() time.Time { return time.Unix(300, 0) }
+
+	c := newTestClient(&fakeInserter{})
+	batch, err := c.buildBatch(context.Background(), aggregateTestSeries(), "", unlimitedWindow)
+	assert.NoError(t, err)
+	a.add(batch)
+	assert.Equal(t, 3, a.len())
+
+	// The bucket from 0s to 300s is complete a minute after its end.
+	assert.Empty(t, a.take(time.Unix(359, 0), false))
+	rows := a.take(time.Unix(360, 0), false)
+	tags := `{"room":"lab"}`
+	assert.Equal(t, []*aggregateRow{{metricname: "temperature", tags: tags, start: 0, min: 4, max: 4, sum: 4, count: 1}}, rows)
+
+	a.close()
+	assert.Equal(t, [][]*aggregateRow{{
+		{metricname: "temperature", tags: tags, start: 300, min: 5, max: 9, sum: 35, count: 5},
+		{metricname: "temperature", tags: tags, start: 600, min: 10, max: 10, sum: 10, count: 1},
+	}}, flushed, "closing flushes the incomplete buckets")
+	assert.Zero(t, a.len())
+}
+
+func TestAggregatorLateSamples(t *testing.T) {
+	late := prometheus.NewCounter(prometheus.CounterOpts{Name: "late"})
+	a := newAggregator(5*time.Minute, time.Minute, func([]*aggregateRow) {}, late)
+	defer a.close()
+	a.now = func() time.Time { return time.Unix(400, 0) }
+
+	c := newTestClient(&fakeInserter{})
+	batch, err := c.buildBatch(context.Background(), aggregateTestSeries(), "", unlimitedWindow)
+	assert.NoError(t, err)
+	a.add(batch)
+	// The samples at 240s are too late for their bucket, all others are within the lateness.
+	assert.Equal(t, 1.0, metricValue(late))
+	assert.Equal(t, 2, a.len())
+}
+
+func TestAggregatorNegativeTimestamps(t *testing.T) {
+	assert.Equal(t, int64(240), mod(-60, 300))
+	assert.Equal(t, int64(0), mod(600, 300))
+}
+
+func TestWriteAggregates(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAggregation("metrics_5m", 5*time.Minute, time.Minute))
+	recorder := &aggregateRecorder{}
+	c.aggregateInserter = recorder
+	c.aggregator.now = func() time.Time { return time.Unix(300, 0) }
+
+	assert.NoError(t, c.Write(context.Background(), aggregateTestSeries()))
+	assert.Len(t, ins.rows(), 7, "the raw samples are still written")
+	assert.Equal(t, 3.0, metricValue(c.aggregateBuckets))
+
+	// Failed writes are not aggregated.
+	ins.err = errors.New("insert failed")
+	assert.Error(t, c.Write(context.Background(), aggregateTestSeries()))
+	assert.Equal(t, 3.0, metricValue(c.aggregateBuckets))
+
+	assert.NoError(t, c.Close())
+	assert.Len(t, recorder.rows, 3)
+	assert.Equal(t, 3.0, metricValue(c.aggregateFlushed))
+	assert.Equal(t, 0.0, metricValue(c.aggregateBuckets))
+
+	values, _, err := recorder.rows[1].Save()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bigquery.Value{
+		"metricname": "temperature",
+		"tags":       `{"room":"lab"}`,
+		"timestamp":  int64(300),
+		"min":        5.0,
+		"max":        9.0,
+		"avg":        7.0,
+		"count":      int64(5),
+	}, values)
+}
+
+func TestWriteAggregatesFailure(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithAggregation("metrics_5m", 5*time.Minute, time.Minute))
+	c.aggregateInserter = &aggregateRecorder{err: errors.New("table not found")}
+	c.aggregator.now = func() time.Time { return time.Unix(300, 0) }
+
+	assert.NoError(t, c.Write(context.Background(), aggregateTestSeries()))
+	assert.NoError(t, c.Close())
+	assert.Equal(t, 3.0, metricValue(c.aggregateFailed))
+	assert.Equal(t, 0.0, metricValue(c.aggregateFlushed))
+}
+
+func TestAggregationDisabled(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.Nil(t, c.aggregator)
+	assert.NoError(t, c.Write(context.Background(), aggregateTestSeries()))
+	assert.Equal(t, 0.0, metricValue(c.aggregateBuckets))
+	assert.NoError(t, c.Close())
+}
@@ -0,0 +1,83 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syntheticBatch returns n rows, each with an estimated size of rowSize bytes.
+func syntheticBatch(n, rowSize int) []*Item {
+	batch := make([]*Item, 0, n)
+	for i := 0; i < n; i++ {
+		batch = append(batch, &Item{
+			metricname: "m",
+			tags:       strings.Repeat("x", rowSize-itemOverhead-1),
+		})
+	}
+	return batch
+}
+
+func chunkSizes(chunks [][]*Item) []int {
+	sizes := make([]int, 0, len(chunks))
+	for _, c := range chunks {
+		sizes = append(sizes, len(c))
+	}
+	return sizes
+}
+
+func TestSplitBatch(t *testing.T) {
+	testCases := map[string]struct {
+		rows     int
+		rowSize  int
+		maxRows  int
+		maxBytes int
+		expected []int
+	}{
+		"empty":                   {rows: 0, rowSize: 100, maxRows: 10, maxBytes: 1000, expected: []int{}},
+		"no_limits":               {rows: 25, rowSize: 100, expected: []int{25}},
+		"rows_under_limit":        {rows: 9, rowSize: 100, maxRows: 10, expected: []int{9}},
+		"rows_at_limit":           {rows: 10, rowSize: 100, maxRows: 10, expected: []int{10}},
+		"rows_over_limit":         {rows: 11, rowSize: 100, maxRows: 10, expected: []int{10, 1}},
+		"rows_multiple_chunks":    {rows: 25, rowSize: 100, maxRows: 10, expected: []int{10, 10, 5}},
+		"bytes_under_limit":       {rows: 9, rowSize: 100, maxBytes: 1000, expected: []int{9}},
+		"bytes_at_limit":          {rows: 10, rowSize: 100, maxBytes: 1000, expected: []int{10}},
+		"bytes_over_limit":        {rows: 11, rowSize: 100, maxBytes: 1000, expected: []int{10, 1}},
+		"bytes_tighter_than_rows": {rows: 20, rowSize: 100, maxRows: 15, maxBytes: 500, expected: []int{5, 5, 5, 5}},
+		"rows_tighter_than_bytes": {rows: 20, rowSize: 100, maxRows: 3, maxBytes: 1000, expected: []int{3, 3, 3, 3, 3, 3, 2}},
+		"row_larger_than_limit":   {rows: 3, rowSize: 2000, maxBytes: 1000, expected: []int{1, 1, 1}},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			batch := syntheticBatch(testCase.rows, testCase.rowSize)
+			chunks := splitBatch(batch, testCase.maxRows, testCase.maxBytes)
+			assert.Equal(t, testCase.expected, chunkSizes(chunks))
+
+			total := 0
+			for _, c := range chunks {
+				for _, item := range c {
+					assert.Same(t, batch[total], item, "rows must keep their order")
+					total++
+				}
+			}
+			assert.Equal(t, testCase.rows, total)
+		})
+	}
+}
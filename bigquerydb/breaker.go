@@ -0,0 +1,237 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned by Write and Read while the circuit breaker rejects operations.
+// It matches ErrUnavailable.
+var ErrCircuitOpen = unavailable(errors.New("bigquery circuit breaker is open"))
+
+// CircuitOpenError is returned by Write and Read while the circuit breaker is open.
+// It matches ErrCircuitOpen.
+type CircuitOpenError struct {
+	// RetryAfter is the time until the breaker lets operations through again.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrCircuitOpen, e.RetryAfter)
+}
+
+// Is makes circuit open errors match ErrCircuitOpen and ErrUnavailable.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen || target == ErrUnavailable
+}
+
+// States of the circuit breaker, as exposed by the state gauge.
+const (
+	breakerClosed = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+var breakerStateNames = map[int]string{
+	breakerClosed:   "closed",
+	breakerHalfOpen: "half_open",
+	breakerOpen:     "open",
+}
+
+// circuitBreaker stops operations from waiting for their timeout while BigQuery is
+// unavailable. It opens after too many consecutive failures, or too large a ratio of
+// failures among the last window operations. Once open, it rejects all operations for
+// openDuration, then lets probes operations through. If all probes succeed it closes
+// again, if one fails it opens again.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	failures     int
+	failureRatio float64
+	window       int
+	openDuration time.Duration
+	probes       int
+	now          func() time.Time
+	logger       *slog.Logger
+
+	state       int
+	consecutive int
+	outcomes    []bool
+	next        int
+	recorded    int
+	failed      int
+	openedAt    time.Time
+	generation  int
+	probing     int
+	succeeded   int
+	stateGauge  prometheus.Gauge
+	transitions *prometheus.CounterVec
+}
+
+func newCircuitBreaker(failures int, failureRatio float64, window int, openDuration time.Duration, probes int, logger *slog.Logger, stateGauge prometheus.Gauge, transitions *prometheus.CounterVec) *circuitBreaker {
+	if failureRatio <= 0 {
+		window = 0
+	}
+	return &circuitBreaker{
+		failures:     failures,
+		failureRatio: failureRatio,
+		window:       window,
+		openDuration: openDuration,
+		probes:       max(probes, 1),
+		now:          time.Now,
+		logger:       logger,
+		outcomes:     make([]bool, max(window, 0)),
+		stateGauge:   stateGauge,
+		transitions:  transitions,
+	}
+}
+
+// allow returns an error if the operation must be rejected. Otherwise the operation
+// may proceed and has to report its error to the returned function once it's done.
+func (b *circuitBreaker) allow() (func(error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		remaining := b.openDuration - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return nil, &CircuitOpenError{RetryAfter: remaining}
+		}
+		b.transition(breakerHalfOpen)
+	}
+	generation := b.generation
+	if b.state == breakerHalfOpen {
+		if b.probing+b.succeeded >= b.probes {
+			return nil, &CircuitOpenError{}
+		}
+		b.probing++
+	}
+	return func(err error) { b.record(generation, err) }, nil
+}
+
+// record updates the state with the outcome of an operation allowed in the given generation.
+// Outcomes of operations allowed before the last state change are ignored.
+func (b *circuitBreaker) record(generation int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	failed := isUnavailable(err)
+	cancelled := !failed && errors.Is(err, context.Canceled)
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing--
+		switch {
+		case failed:
+			b.transition(breakerOpen)
+		case !cancelled:
+			b.succeeded++
+			if b.succeeded >= b.probes {
+				b.transition(breakerClosed)
+			}
+		}
+	case breakerClosed:
+		if cancelled {
+			return
+		}
+		if failed {
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.window > 0 {
+			if b.recorded == b.window && b.outcomes[b.next] {
+				b.failed--
+			}
+			b.outcomes[b.next] = failed
+			b.next = (b.next + 1) % b.window
+			b.recorded = min(b.recorded+1, b.window)
+			if failed {
+				b.failed++
+			}
+		}
+		if (b.failures > 0 && b.consecutive >= b.failures) ||
+			(b.window > 0 && b.recorded == b.window && float64(b.failed)/float64(b.window) >= b.failureRatio) {
+			b.transition(breakerOpen)
+		}
+	}
+}
+
+// transition changes the state and resets all counters.
+func (b *circuitBreaker) transition(state int) {
+	b.logger.Warn("bigquery circuit breaker state changed", slog.String("from", breakerStateNames[b.state]), slog.String("to", breakerStateNames[state]))
+	b.state = state
+	b.generation++
+	b.consecutive = 0
+	b.next, b.recorded, b.failed = 0, 0, 0
+	b.probing, b.succeeded = 0, 0
+	if state == breakerOpen {
+		b.openedAt = b.now()
+	}
+	b.stateGauge.Set(float64(state))
+	b.transitions.WithLabelValues(breakerStateNames[state]).Inc()
+}
+
+// isUnavailable reports whether the error means that BigQuery couldn't be reached or
+// failed on its side, as opposed to e.g. rejected rows, limits or invalid queries.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var writeErr *WriteError
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.Errors {
+			if isUnavailable(e) {
+				return true
+			}
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+	var bqErr *bigquery.Error
+	if errors.As(err, &bqErr) {
+		return bqErr.Reason == "backendError" || bqErr.Reason == "internalError"
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.Internal, codes.DeadlineExceeded:
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,222 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = &googleapi.Error{Code: 503, Message: "backend unavailable"}
+
+// switchableInserter fails every Put with err while it is set.
+type switchableInserter struct {
+	err error
+}
+
+func (f *switchableInserter) Put(ctx context.Context, src interface{}) error {
+	return f.err
+}
+
+// fakeClock is a controllable clock for the circuit breaker.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newBreakerTestClient(ins Inserter, opts ...Option) (*BigqueryClient, *fakeClock) {
+	c := newTestClient(ins, opts...)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c.breaker.now = clock.Now
+	return c, clock
+}
+
+func writeUp(c *BigqueryClient) error {
+	return c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}})
+}
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	ins := &switchableInserter{err: errUnavailable}
+	c, clock := newBreakerTestClient(ins, WithCircuitBreaker(3, 0, 0, 30*time.Second, 2))
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, writeUp(c), errUnavailable)
+	}
+	assert.Equal(t, 2.0, metricValue(c.breakerState))
+	assert.Equal(t, 1.0, metricValue(c.breakerTransitions.WithLabelValues("open")))
+
+	// While open, operations fail without reaching BigQuery.
+	ins.err = errors.New("must not be called")
+	clock.now = clock.now.Add(10 * time.Second)
+	err := writeUp(c)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var openErr *CircuitOpenError
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 20*time.Second, openErr.RetryAfter)
+	var writeErr *WriteError
+	assert.True(t, errors.As(err, &writeErr))
+	assert.Equal(t, 1, writeErr.FailedSamples)
+	_, err = c.Read(context.Background(), &prompb.ReadRequest{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// A failed probe opens the breaker again.
+	clock.now = clock.now.Add(20 * time.Second)
+	ins.err = errUnavailable
+	assert.ErrorIs(t, writeUp(c), errUnavailable)
+	assert.Equal(t, 2.0, metricValue(c.breakerState))
+	assert.Equal(t, 1.0, metricValue(c.breakerTransitions.WithLabelValues("half_open")))
+	assert.Equal(t, 2.0, metricValue(c.breakerTransitions.WithLabelValues("open")))
+
+	// No more probes than configured run at the same time.
+	clock.now = clock.now.Add(30 * time.Second)
+	first, err := c.breaker.allow()
+	assert.NoError(t, err)
+	second, err := c.breaker.allow()
+	assert.NoError(t, err)
+	_, err = c.breaker.allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 1.0, metricValue(c.breakerState))
+
+	// The breaker closes once all probes succeeded.
+	first(nil)
+	assert.Equal(t, 1.0, metricValue(c.breakerState))
+	second(nil)
+	assert.Equal(t, 0.0, metricValue(c.breakerState))
+	assert.Equal(t, 1.0, metricValue(c.breakerTransitions.WithLabelValues("closed")))
+
+	ins.err = nil
+	assert.NoError(t, writeUp(c))
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	ins := &switchableInserter{}
+	c, _ := newBreakerTestClient(ins, WithCircuitBreaker(3, 0, 0, 30*time.Second, 1))
+
+	for i := 0; i < 5; i++ {
+		ins.err = errUnavailable
+		assert.Error(t, writeUp(c))
+		assert.Error(t, writeUp(c))
+		ins.err = nil
+		assert.NoError(t, writeUp(c))
+	}
+	assert.Equal(t, 0.0, metricValue(c.breakerState))
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	ins := &switchableInserter{}
+	c, _ := newBreakerTestClient(ins, WithCircuitBreaker(0, 0.5, 10, 30*time.Second, 1))
+
+	// 4 failures among the last 10 writes keep the breaker closed.
+	for i := 0; i < 10; i++ {
+		ins.err = nil
+		if i%5 >= 3 {
+			ins.err = errUnavailable
+		}
+		_ = writeUp(c)
+	}
+	assert.Equal(t, 0.0, metricValue(c.breakerState))
+
+	// The oldest outcome was a success, so another failure makes it 5 of 10.
+	ins.err = errUnavailable
+	_ = writeUp(c)
+	assert.Equal(t, 2.0, metricValue(c.breakerState))
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	c, _ := newBreakerTestClient(&fakeInserter{}, WithCircuitBreaker(1, 0, 0, 30*time.Second, 1),
+		WithQuerier(&fakeQuerier{err: errors.New("invalid query")}))
+	for i := 0; i < 3; i++ {
+		_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{}}})
+		assert.ErrorContains(t, err, "invalid query")
+	}
+	assert.Equal(t, 0.0, metricValue(c.breakerState))
+}
+
+func TestCircuitBreakerIgnoresStaleOutcomes(t *testing.T) {
+	c, clock := newBreakerTestClient(&fakeInserter{}, WithCircuitBreaker(1, 0, 0, 30*time.Second, 1))
+	stale, err := c.breaker.allow()
+	assert.NoError(t, err)
+	done, err := c.breaker.allow()
+	assert.NoError(t, err)
+	done(errUnavailable)
+
+	clock.now = clock.now.Add(time.Minute)
+	probe, err := c.breaker.allow()
+	assert.NoError(t, err)
+	// The outcome of an operation started before the breaker opened isn't a probe.
+	stale(nil)
+	assert.Equal(t, 1.0, metricValue(c.breakerState))
+	probe(nil)
+	assert.Equal(t, 0.0, metricValue(c.breakerState))
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	c := newTestClient(&switchableInserter{err: errUnavailable})
+	assert.Nil(t, c.breaker)
+	for i := 0; i < 10; i++ {
+		assert.ErrorIs(t, writeUp(c), errUnavailable)
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"nil":               {err: nil, expected: false},
+		"timeout":           {err: errors.Wrap(context.DeadlineExceeded, "read timeout of 1s exceeded"), expected: true},
+		"cancelled":         {err: context.Canceled, expected: false},
+		"server_error":      {err: &googleapi.Error{Code: 500}, expected: true},
+		"unavailable":       {err: errUnavailable, expected: true},
+		"bad_request":       {err: &googleapi.Error{Code: 400}, expected: false},
+		"not_found":         {err: &googleapi.Error{Code: 404}, expected: false},
+		"backend_error":     {err: &bigquery.Error{Reason: "backendError"}, expected: true},
+		"invalid_query":     {err: &bigquery.Error{Reason: "invalidQuery"}, expected: false},
+		"grpc_unavailable":  {err: status.Error(codes.Unavailable, "unavailable"), expected: true},
+		"grpc_denied":       {err: status.Error(codes.PermissionDenied, "denied"), expected: false},
+		"network":           {err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: true},
+		"row_errors":        {err: bigquery.PutMultiError{{RowIndex: 0}}, expected: false},
+		"limit":             {err: newLimitError("samples", "too many samples"), expected: false},
+		"queue_full":        {err: ErrQueueFull, expected: false},
+		"write_error":       {err: &WriteError{Errors: []error{bigquery.PutMultiError{}, errUnavailable}}, expected: true},
+		"write_error_rows":  {err: &WriteError{Errors: []error{bigquery.PutMultiError{}}}, expected: false},
+		"plain":             {err: errors.New("unexpected value"), expected: false},
+		"circuit_open":      {err: &CircuitOpenError{}, expected: false},
+		"wrapped_api_error": {err: errors.Wrap(&googleapi.Error{Code: 502}, "insert"), expected: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, isUnavailable(testCase.err))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBufferFull is returned by Write in asynchronous mode when the buffer has no room for the batch.
+// It matches ErrUnavailable.
+var ErrBufferFull = unavailable(errors.New("bigquery write buffer is full"))
+
+// ErrBatchTooLarge is returned by Write in asynchronous mode when the batch has more rows
+// than the buffer holds, and would never fit. It matches ErrTooLarge.
+var ErrBatchTooLarge = tooLarge(errors.New("batch exceeds the capacity of the bigquery write buffer"))
+
+// Reasons a buffer flush was started for.
+const (
+	bufferReasonSize     = "size"
+	bufferReasonTime     = "time"
+	bufferReasonShutdown = "shutdown"
+)
+
+// writeBuffer collects rows in memory and hands them to flush in the background,
+// either when flushRows rows are buffered or when the flush interval elapses.
+type writeBuffer struct {
+	mu        sync.Mutex
+	rows      []*Item
+	size      int
+	oldest    time.Time
+	capacity  int
+	flushRows int
+	interval  time.Duration
+	flush     func([]*Item, string)
+	flushC    chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func newWriteBuffer(capacity, flushRows int, interval time.Duration, flush func([]*Item, string)) *writeBuffer {
+	if flushRows <= 0 || flushRows > capacity {
+		flushRows = capacity
+	}
+	b := &writeBuffer{
+		capacity:  capacity,
+		flushRows: flushRows,
+		interval:  interval,
+		flush:     flush,
+		flushC:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add appends all rows to the buffer, or none of them if they don't fit.
+func (b *writeBuffer) add(rows []*Item) error {
+	if len(rows) > b.capacity {
+		return ErrBatchTooLarge
+	}
+	size := 0
+	for _, item := range rows {
+		size += item.estimatedSize()
+	}
+	b.mu.Lock()
+	if len(b.rows)+len(rows) > b.capacity {
+		b.mu.Unlock()
+		return ErrBufferFull
+	}
+	if len(b.rows) == 0 {
+		b.oldest = time.Now()
+	}
+	b.rows = append(b.rows, rows...)
+	b.size += size
+	full := len(b.rows) >= b.flushRows
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// take empties the buffer and returns its rows.
+func (b *writeBuffer) take() []*Item {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rows := b.rows
+	b.rows = nil
+	b.size = 0
+	return rows
+}
+
+// len returns the number of buffered rows.
+func (b *writeBuffer) len() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.rows)
+}
+
+// bytes returns the estimated size of the buffered rows.
+func (b *writeBuffer) bytes() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// oldestAge returns how long the oldest buffered row has been waiting.
+func (b *writeBuffer) oldestAge() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.rows) == 0 {
+		return 0
+	}
+	return time.Since(b.oldest)
+}
+
+func (b *writeBuffer) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		var reason string
+		select {
+		case <-ticker.C:
+			reason = bufferReasonTime
+		case <-b.flushC:
+			reason = bufferReasonSize
+		case <-b.done:
+			if rows := b.take(); len(rows) > 0 {
+				b.flush(rows, bufferReasonShutdown)
+			}
+			close(b.stopped)
+			return
+		}
+		if rows := b.take(); len(rows) > 0 {
+			b.flush(rows, reason)
+		}
+	}
+}
+
+// close flushes the remaining rows and stops the background flusher.
+func (b *writeBuffer) close() {
+	close(b.done)
+	<-b.stopped
+}
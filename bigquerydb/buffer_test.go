@@ -0,0 +1,99 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWriteFlushBySize(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowsPerInsert(10), WithAsyncWrites(100, time.Hour))
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, ins.rows(), "no flush before the size threshold")
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	assert.Eventually(t, func() bool { return len(ins.rows()) == 10 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0.0, metricValue(c.bufferedSamples))
+}
+
+func TestAsyncWriteFlushByInterval(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAsyncWrites(100, 50*time.Millisecond))
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	assert.Equal(t, 3.0, metricValue(c.bufferedSamples))
+	assert.Eventually(t, func() bool { return len(ins.rows()) == 3 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0.0, metricValue(c.bufferOldestAge))
+}
+
+func TestAsyncWriteBackpressure(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAsyncWrites(8, time.Hour))
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	err := c.Write(context.Background(), seriesWithSamples("up", 5))
+	assert.True(t, errors.Is(err, ErrBufferFull))
+
+	var writeErr *WriteError
+	assert.True(t, errors.As(err, &writeErr))
+	assert.Equal(t, 5, writeErr.FailedSamples)
+	assert.Equal(t, 5.0, metricValue(c.bufferedSamples), "a rejected batch must not be partially buffered")
+	assert.Greater(t, metricValue(c.bufferOldestAge), 0.0)
+}
+
+func TestAsyncWriteBatchTooLarge(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAsyncWrites(4, time.Hour))
+	defer c.Close()
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 5))
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+	assert.ErrorIs(t, err, ErrTooLarge)
+	assert.False(t, IsUnavailable(err), "a batch which never fits isn't retried")
+	assert.Equal(t, 0.0, metricValue(c.bufferedSamples))
+	assert.Equal(t, 0.0, metricValue(c.backpressureSamples.WithLabelValues("buffer")))
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 4)), "a batch of the capacity fits")
+}
+
+func TestAsyncWriteShutdownFlush(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAsyncWrites(100, time.Hour))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 7)))
+	assert.Empty(t, ins.rows())
+	assert.NoError(t, c.Close())
+	assert.Len(t, ins.rows(), 7)
+}
+
+func TestAsyncWriteFailedFlush(t *testing.T) {
+	ins := &fakeInserter{err: errors.New("insert failed")}
+	c := newTestClient(ins, WithAsyncWrites(100, time.Hour))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 4)))
+	assert.NoError(t, c.Close())
+	assert.Equal(t, 4.0, metricValue(c.bufferFailedSamples))
+}
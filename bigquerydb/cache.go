@@ -0,0 +1,169 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// queryCache is an LRU cache for the series returned by read queries. It is safe for
+// concurrent use. The time range of the cached queries is widened to full buckets, so
+// that queries repeated by dashboards with a slightly moved time range still hit.
+type queryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	bucket     int64
+	freshness  time.Duration
+	entries    map[string]*list.Element
+	lru        *list.List
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	series  []*prompb.TimeSeries
+	expires time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int, bucket, freshness time.Duration) *queryCache {
+	if bucket < time.Millisecond {
+		bucket = time.Millisecond
+	}
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		bucket:     bucket.Milliseconds(),
+		freshness:  freshness,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// key returns the query widened to full buckets and its cache key. Queries ending
+// within the freshness window are not cacheable, as their data is still changing.
+func (qc *queryCache) key(q *prompb.Query) (*prompb.Query, string, bool) {
+	if qc == nil {
+		return nil, "", false
+	}
+	if q.EndTimestampMs > qc.now().Add(-qc.freshness).UnixMilli() {
+		return nil, "", false
+	}
+
+	start := q.StartTimestampMs - q.StartTimestampMs%qc.bucket
+	end := q.EndTimestampMs - q.EndTimestampMs%qc.bucket
+	if end < q.EndTimestampMs {
+		end += qc.bucket
+	}
+
+	matchers := make([]string, 0, len(q.Matchers))
+	for _, m := range q.Matchers {
+		matchers = append(matchers, fmt.Sprintf("%s\xff%d\xff%s", m.Name, m.Type, m.Value))
+	}
+	sort.Strings(matchers)
+
+	rounded := &prompb.Query{
+		StartTimestampMs: start,
+		EndTimestampMs:   end,
+		Matchers:         q.Matchers,
+		Hints:            q.Hints,
+	}
+	return rounded, fmt.Sprintf("%d\xfe%d\xfe%s", start, end, strings.Join(matchers, "\xfe")), true
+}
+
+// get returns the cached series of the key, unless they expired.
+func (qc *queryCache) get(key string) ([]*prompb.TimeSeries, bool) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	elem, ok := qc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if qc.now().After(entry.expires) {
+		qc.lru.Remove(elem)
+		delete(qc.entries, key)
+		return nil, false
+	}
+	qc.lru.MoveToFront(elem)
+	return entry.series, true
+}
+
+// put caches the series of the key, evicting the least recently used entry if the cache is full.
+func (qc *queryCache) put(key string, series []*prompb.TimeSeries) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	expires := qc.now().Add(qc.ttl)
+	if elem, ok := qc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.series = series
+		entry.expires = expires
+		qc.lru.MoveToFront(elem)
+		return
+	}
+	qc.entries[key] = qc.lru.PushFront(&cacheEntry{key: key, series: series, expires: expires})
+	for qc.maxEntries > 0 && qc.lru.Len() > qc.maxEntries {
+		oldest := qc.lru.Back()
+		qc.lru.Remove(oldest)
+		delete(qc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// len returns the number of cached entries.
+func (qc *queryCache) len() int {
+	if qc == nil {
+		return 0
+	}
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	return qc.lru.Len()
+}
+
+// cachedQuery serves the query from the cache. On a miss, the query is run for the
+// widened time range and its series are cached. Uncacheable queries run directly.
+func (c *BigqueryClient) cachedQuery(ctx context.Context, limits *ReadLimits, rs *resultSet, q *prompb.Query) error {
+	rounded, key, ok := c.cache.key(q)
+	if !ok {
+		return c.query(ctx, limits, rs, q)
+	}
+	if r := resolutionFrom(ctx); r != nil {
+		// The samples of downsampled tables are cached apart from the raw ones.
+		key = c.resolutionTable(r) + "\xfd" + key
+	}
+
+	series, hit := c.cache.get(key)
+	if hit {
+		c.readCacheHits.Inc()
+	} else {
+		c.readCacheMisses.Inc()
+		qrs := limits.newResultSet()
+		qrs.matchers = rs.matchers
+		if err := c.query(ctx, limits, qrs, rounded); err != nil {
+			return err
+		}
+		qrs.sortSamples()
+		series = qrs.response().Results[0].Timeseries
+		c.cache.put(key, series)
+	}
+	return rs.addSeries(series, q.StartTimestampMs, q.EndTimestampMs)
+}
@@ -0,0 +1,161 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+var cacheNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestCache(ttl time.Duration, maxEntries int) *queryCache {
+	qc := newQueryCache(ttl, maxEntries, time.Minute, 10*time.Minute)
+	qc.now = func() time.Time { return cacheNow }
+	return qc
+}
+
+func cacheQuery(start, end time.Time, matchers ...*prompb.LabelMatcher) *prompb.Query {
+	return &prompb.Query{StartTimestampMs: start.UnixMilli(), EndTimestampMs: end.UnixMilli(), Matchers: matchers}
+}
+
+func cachedSeries(job string, timestamps ...int64) []*prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: job}}}
+	for _, t := range timestamps {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t, Value: 1})
+	}
+	return []*prompb.TimeSeries{ts}
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	qc := newTestCache(time.Minute, 10)
+	up := &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}
+	job := &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api"}
+	start := cacheNow.Add(-2 * time.Hour)
+	end := cacheNow.Add(-time.Hour)
+
+	rounded, key, ok := qc.key(cacheQuery(start.Add(10*time.Second), end.Add(-10*time.Second), up, job))
+	assert.True(t, ok)
+	assert.Equal(t, start.UnixMilli(), rounded.StartTimestampMs)
+	assert.Equal(t, end.UnixMilli(), rounded.EndTimestampMs)
+
+	_, other, _ := qc.key(cacheQuery(start.Add(20*time.Second), end.Add(-20*time.Second), job, up))
+	assert.Equal(t, key, other, "queries within the same buckets and reordered matchers share a key")
+
+	_, other, _ = qc.key(cacheQuery(start.Add(10*time.Second), end.Add(-10*time.Second), up))
+	assert.NotEqual(t, key, other)
+
+	_, other, _ = qc.key(cacheQuery(start.Add(time.Minute+10*time.Second), end, up, job))
+	assert.NotEqual(t, key, other)
+}
+
+func TestQueryCacheFreshnessWindow(t *testing.T) {
+	qc := newTestCache(time.Minute, 10)
+	_, _, ok := qc.key(cacheQuery(cacheNow.Add(-time.Hour), cacheNow.Add(-11*time.Minute)))
+	assert.True(t, ok)
+	_, _, ok = qc.key(cacheQuery(cacheNow.Add(-time.Hour), cacheNow.Add(-9*time.Minute)))
+	assert.False(t, ok)
+	_, _, ok = qc.key(cacheQuery(cacheNow.Add(-time.Hour), cacheNow))
+	assert.False(t, ok)
+
+	var disabled *queryCache
+	_, _, ok = disabled.key(cacheQuery(cacheNow.Add(-2*time.Hour), cacheNow.Add(-time.Hour)))
+	assert.False(t, ok)
+}
+
+func TestQueryCacheHitMissAndExpiry(t *testing.T) {
+	qc := newTestCache(time.Minute, 10)
+
+	_, ok := qc.get("key")
+	assert.False(t, ok)
+
+	series := cachedSeries("api", 1000)
+	qc.put("key", series)
+	got, ok := qc.get("key")
+	assert.True(t, ok)
+	assert.Equal(t, series, got)
+
+	cacheNow = cacheNow.Add(2 * time.Minute)
+	defer func() { cacheNow = cacheNow.Add(-2 * time.Minute) }()
+	_, ok = qc.get("key")
+	assert.False(t, ok)
+	assert.Equal(t, 0, qc.len())
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	qc := newTestCache(time.Minute, 2)
+	qc.put("a", nil)
+	qc.put("b", nil)
+	_, ok := qc.get("a")
+	assert.True(t, ok)
+	qc.put("c", nil)
+
+	assert.Equal(t, 2, qc.len())
+	_, ok = qc.get("b")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	_, ok = qc.get("a")
+	assert.True(t, ok)
+}
+
+func TestQueryCacheConcurrency(t *testing.T) {
+	qc := newTestCache(time.Minute, 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := fmt.Sprintf("%d", (i*j)%100)
+				if _, ok := qc.get(key); !ok {
+					qc.put(key, nil)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, qc.len(), 50)
+}
+
+func TestCachedQueryHit(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithReadCache(time.Minute, 10, time.Minute, 10*time.Minute))
+	c.cache.now = func() time.Time { return cacheNow }
+	q := cacheQuery(cacheNow.Add(-2*time.Hour), cacheNow.Add(-time.Hour))
+	_, key, ok := c.cache.key(q)
+	assert.True(t, ok)
+	c.cache.put(key, cachedSeries("api", q.StartTimestampMs-1000, q.StartTimestampMs, q.EndTimestampMs, q.EndTimestampMs+1000))
+
+	rs := newResultSet(0)
+	assert.NoError(t, c.cachedQuery(context.Background(), c.readLimits.Load(), rs, q))
+	assert.Equal(t, 1.0, metricValue(c.readCacheHits))
+	assert.Equal(t, 0.0, metricValue(c.readCacheMisses))
+
+	resp := rs.response()
+	assert.Equal(t, []prompb.Sample{{Timestamp: q.StartTimestampMs, Value: 1}, {Timestamp: q.EndTimestampMs, Value: 1}},
+		resp.Results[0].Timeseries[0].Samples, "samples outside of the requested range are trimmed")
+	assert.Len(t, c.cache.entries[key].Value.(*cacheEntry).series[0].Samples, 4, "the cached series are not modified")
+}
+
+func TestAddSeriesMaxSamples(t *testing.T) {
+	rs := newResultSet(2)
+	err := rs.addSeries(cachedSeries("api", 1, 2, 3), 0, 10)
+	assert.ErrorContains(t, err, "limit of 2 samples")
+}
@@ -14,372 +14,2876 @@ limitations under the License.
 package bigquerydb
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"log/slog"
 	"math"
-	"os"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 // BigqueryClient allows sending batches of Prometheus samples to Bigquery.
 type BigqueryClient struct {
-	logger             *slog.Logger
-	client             bigquery.Client
-	datasetID          string
-	tableID            string
-	timeout            time.Duration
-	ignoredSamples     prometheus.Counter
-	recordsFetched     prometheus.Counter
-	batchWriteDuration prometheus.Histogram
-	sqlQueryCount      prometheus.Counter
-	sqlQueryDuration   prometheus.Histogram
-}
-
-// NewClient creates a new Client.
-func NewClient(logger *slog.Logger, googleAPIjsonkeypath, googleProjectID, googleAPIdatasetID, googleAPItableID string, remoteTimeout time.Duration) *BigqueryClient {
+	logger               *slog.Logger
+	name                 string
+	connMu               sync.RWMutex
+	conn                 *connection
+	datasetID            string
+	tableID              string
+	writeTimeout         time.Duration
+	readTimeout          time.Duration
+	readSplitInterval    time.Duration
+	readResolutions      []ReadResolution
+	readForceRaw         bool
+	maxRowsPerInsert     int
+	maxBytesPerInsert    int
+	insertConcurrency    int
+	insertQueueSize      int
+	inserter             Inserter
+	querier              Querier
+	loader               Loader
+	pool                 *insertPool
+	bufferSize           int
+	flushInterval        time.Duration
+	buffer               *writeBuffer
+	coalesceMaxRows      int
+	coalesceMaxBytes     int
+	coalesceMaxDelay     time.Duration
+	coalescer            *coalescer
+	spillDir             string
+	spillMaxBytes        int64
+	spillReplayInterval  time.Duration
+	spill                *spill
+	stageLocation        string
+	stageMaxBytes        int64
+	stageInterval        time.Duration
+	stageOptions         []option.ClientOption
+	stageStore           stageStore
+	objectLoader         objectLoader
+	stager               *stager
+	deadLetterSink       DeadLetterSink
+	deadLetterDataset    string
+	deadLetterTable      string
+	deadLetterMaxBytes   int64
+	deadLetter           *deadLetter
+	deduplicate          bool
+	writeDryRun          bool
+	skipInvalidRows      bool
+	ignoreUnknownValues  bool
+	maxSampleAge         time.Duration
+	rejectOldSamples     bool
+	maxFutureSkew        time.Duration
+	futureBehavior       string
+	storeStaleMarkers    bool
+	specialValues        bool
+	seriesHash           bool
+	insertTime           bool
+	readDeduplicate      bool
+	timestampType        string
+	readDatasetID        string
+	readTableID          string
+	readTemplate         *template.Template
+	maxRowSize           int
+	oversizeBehavior     string
+	truncatedLabelLength int
+	maxLoggedRowErrors   int
+	rowRetries           int
+	rowRetryBackoff      time.Duration
+	readLimits           atomic.Pointer[ReadLimits]
+	skipBadRows          bool
+	cache                *queryCache
+	useStorageAPI        bool
+	serverSideSort       bool
+	location             string
+	dataProjectID        string
+	priority             bigquery.QueryPriority
+	maxBytesBilled       int64
+	jobLabels            map[string]string
+	credentialsJSON      []byte
+	keyPath              string
+	keyCheckInterval     time.Duration
+	keyHash              [sha256.Size]byte
+	projectID            string
+	clientOptions        []option.ClientOption
+	newBigQueryClient    func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error)
+	keyStop              context.CancelFunc
+	keyStopped           chan struct{}
+	credentialReloads    *prometheus.CounterVec
+	endpoint             string
+	impersonate          string
+	delegates            []string
+	scopes               []string
+	breakerFailures      int
+	breakerFailureRatio  float64
+	breakerWindow        int
+	breakerOpenDuration  time.Duration
+	breakerProbes        int
+	breaker              *circuitBreaker
+	aggregateTable       string
+	aggregateInterval    time.Duration
+	aggregateLateness    time.Duration
+	aggregateInserter    Inserter
+	aggregator           *aggregator
+	retention            time.Duration
+	retentionInterval    time.Duration
+	retentionEnforce     bool
+	retentionHolder      string
+	leader               Leader
+	queryLimiter         *QueryLimiter
+	retentionStop        context.CancelFunc
+	retentionStopped     chan struct{}
+	tableAdmin           TableAdmin
+	tagsType             string
+	createTable          bool
+	tenancy              bool
+	staticLabels         []prompb.Label
+	staticLabelOverride  bool
+	dropLabelNames       map[string]bool
+	dropLabelRegex       *regexp.Regexp
+	routeSpecs           []Route
+	routes               []route
+	destinations         []*destination
+	defaultDestination   *destination
+	templateSuffix       *TemplateSuffix
+	dateSharding         bool
+	partitioning         string
+	partitionGranularity string
+	// tableAdminFor returns the admin of a table, e.g. of a shard.
+	tableAdminFor func(datasetID, tableID string) TableAdmin
+	// suffixedDests are the destinations of the template tables by suffixedKey.
+	suffixedDests        sync.Map
+	dryRun               func(ctx context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error)
+	runStatement         func(ctx context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error)
+	ignoredSamples       prometheus.Counter
+	droppedSamples       *prometheus.CounterVec
+	droppedLabels        prometheus.Counter
+	recordsFetched       prometheus.Counter
+	batchWriteDuration   prometheus.Histogram
+	writeLag             prometheus.Histogram
+	writtenBytes         prometheus.Counter
+	writtenRows          prometheus.Counter
+	insertBatchRows      prometheus.Histogram
+	sqlQueryCount        prometheus.Counter
+	sqlQueryDuration     prometheus.Histogram
+	readSamples          prometheus.Histogram
+	activeInserts        prometheus.Gauge
+	insertQueueDepth     prometheus.GaugeFunc
+	bufferedSamples      prometheus.GaugeFunc
+	bufferOldestAge      prometheus.GaugeFunc
+	bufferedBytes        prometheus.GaugeFunc
+	bufferFlushes        *prometheus.CounterVec
+	bufferFlushRows      prometheus.Histogram
+	backpressureSamples  *prometheus.CounterVec
+	bufferFailedSamples  prometheus.Counter
+	retriedRows          prometheus.Counter
+	coalesceFlushes      *prometheus.CounterVec
+	coalesceFlushWrites  prometheus.Histogram
+	coalesceFlushRows    prometheus.Histogram
+	coalescePendingRows  prometheus.GaugeFunc
+	coalescePendingBytes prometheus.GaugeFunc
+	coalesceOldestAge    prometheus.GaugeFunc
+	spilledSamples       prometheus.Counter
+	spillReplayedSamples prometheus.Counter
+	spillDroppedSamples  prometheus.Counter
+	spillCorruptSegments prometheus.Counter
+	spillBytes           prometheus.GaugeFunc
+	spillSegments        prometheus.GaugeFunc
+	loadStagedBytes      prometheus.Counter
+	loadJobs             *prometheus.CounterVec
+	loadDelay            prometheus.Histogram
+	loadQuarantined      prometheus.Counter
+	loadPendingObjects   prometheus.GaugeFunc
+	deadLetteredSamples  prometheus.Counter
+	deadLetterDropped    *prometheus.CounterVec
+	insertRowErrors      *prometheus.CounterVec
+	insertErrors         *prometheus.CounterVec
+	readLimitExceeded    *prometheus.CounterVec
+	readRangeTruncated   prometheus.Counter
+	slowQueries          prometheus.Counter
+	duplicateSamples     prometheus.Counter
+	skippedRows          prometheus.Counter
+	readPages            prometheus.Counter
+	readPageWait         prometheus.Counter
+	readCacheHits        prometheus.Counter
+	readCacheMisses      prometheus.Counter
+	readCacheEntries     prometheus.GaugeFunc
+	readQueries          *prometheus.CounterVec
+	readSplits           prometheus.Histogram
+	readSplitQueries     *prometheus.CounterVec
+	resolutionQueries    *prometheus.CounterVec
+	cancelledOperations  *prometheus.CounterVec
+	cancelledQueries     prometheus.Counter
+	maxBytesBilledGauge  prometheus.GaugeFunc
+	breakerState         prometheus.Gauge
+	breakerTransitions   *prometheus.CounterVec
+	aggregateBuckets     prometheus.GaugeFunc
+	aggregateFlushed     prometheus.Counter
+	aggregateFailed      prometheus.Counter
+	aggregateLate        prometheus.Counter
+	retentionLastRun     prometheus.Gauge
+	writeHealth          *operationHealth
+	readHealth           *operationHealth
+	retentionDeletedRows prometheus.Counter
+	readBytesProcessed   prometheus.Histogram
+	readEstimatedBytes   prometheus.Histogram
+	queryBytesProcessed  prometheus.Counter
+	querySlotSeconds     prometheus.Counter
+	queryCacheHits       prometheus.Counter
+	tableSentSamples     *prometheus.CounterVec
+	metricSamples        *metricSamplesCounter
+	metricSamplesLimit   int
+	metricFactory        metricfactory.Factory
+	tableFailedSamples   *prometheus.CounterVec
+}
+
+// Inserter writes rows to the table. It is implemented by *bigquery.Inserter.
+type Inserter interface {
+	Put(ctx context.Context, src interface{}) error
+}
+
+// Querier runs read queries.
+type Querier interface {
+	Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error)
+}
+
+// QueryIterator iterates over the rows of a query result. It is implemented by *bigquery.RowIterator.
+type QueryIterator interface {
+	Next(dst interface{}) error
+	IsAccelerated() bool
+}
+
+// bigqueryQuerier runs the queries in BigQuery.
+type bigqueryQuerier struct{}
+
+// Read starts a query job and waits for its results. Unlike query.Read, which waits for
+// the job before returning it, this allows to cancel a job which is still running when
+// the context is done.
+func (bigqueryQuerier) Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error) {
+	job, err := query.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := job.Read(ctx)
+	if err != nil {
+		return nil, &jobError{job: job, err: err}
+	}
+	return &bigqueryRowIterator{RowIterator: iter, job: job}, nil
+}
+
+// statisticsReader is implemented by iterators over the results of a query job, whose
+// statistics can be fetched once the job completed.
+type statisticsReader interface {
+	jobStatistics(ctx context.Context) (*bigquery.JobStatistics, error)
+}
+
+// jobCanceler is implemented by iterators over the results of a query job, and by the
+// errors of query jobs which failed while waiting for their results, which can be cancelled.
+type jobCanceler interface {
+	jobID() string
+	cancelJob(ctx context.Context) error
+}
+
+// jobError is the error of a query job which failed or was abandoned while waiting for its results.
+type jobError struct {
+	job *bigquery.Job
+	err error
+}
+
+func (e *jobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *jobError) Unwrap() error {
+	return e.err
+}
+
+func (e *jobError) jobID() string {
+	return e.job.ID()
+}
+
+func (e *jobError) cancelJob(ctx context.Context) error {
+	return e.job.Cancel(ctx)
+}
+
+// bigqueryRowIterator iterates over the results of a query run in BigQuery.
+type bigqueryRowIterator struct {
+	*bigquery.RowIterator
+	job *bigquery.Job
+}
+
+// jobStatistics fetches the statistics of the job of the query from BigQuery. The job
+// the results are read from doesn't carry them, they are only known once it completed.
+func (it *bigqueryRowIterator) jobStatistics(ctx context.Context) (*bigquery.JobStatistics, error) {
+	status, err := it.job.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status.Statistics, nil
+}
+
+func (it *bigqueryRowIterator) jobID() string {
+	if job := it.SourceJob(); job != nil {
+		return job.ID()
+	}
+	return ""
+}
+
+// cancelJob cancels the job of the query. Queries answered without creating a job can't be cancelled.
+func (it *bigqueryRowIterator) cancelJob(ctx context.Context) error {
+	job := it.SourceJob()
+	if job == nil {
+		return nil
+	}
+	return job.Cancel(ctx)
+}
+
+// Option configures optional behavior of a BigqueryClient.
+type Option func(*BigqueryClient)
+
+// WithInserter writes rows with the given inserter instead of inserting them into the table.
+func WithInserter(inserter Inserter) Option {
+	return func(c *BigqueryClient) {
+		c.inserter = inserter
+	}
+}
+
+// WithQuerier runs read queries with the given querier instead of running them in BigQuery.
+func WithQuerier(querier Querier) Option {
+	return func(c *BigqueryClient) {
+		c.querier = querier
+	}
+}
+
+// WithLoader runs load jobs with the given loader instead of running them in BigQuery.
+func WithLoader(loader Loader) Option {
+	return func(c *BigqueryClient) {
+		c.loader = loader
+	}
+}
+
+// WithReadTimeout sets the timeout of read queries, which is the timeout given to
+// NewClient by default. Values less than or equal to zero keep the default.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *BigqueryClient) {
+		if timeout > 0 {
+			c.readTimeout = timeout
+		}
+	}
+}
+
+// WithName sets the name identifying the client, which is "bigquerydb" by default.
+func WithName(name string) Option {
+	return func(c *BigqueryClient) {
+		c.name = name
+	}
+}
+
+// WithMaxRowsPerInsert limits the number of rows sent in a single insertAll call.
+// Values less than or equal to zero disable the limit.
+func WithMaxRowsPerInsert(rows int) Option {
+	return func(c *BigqueryClient) {
+		c.maxRowsPerInsert = rows
+	}
+}
+
+// WithMaxBytesPerInsert limits the estimated size of a single insertAll call.
+// Values less than or equal to zero disable the limit.
+func WithMaxBytesPerInsert(bytes int) Option {
+	return func(c *BigqueryClient) {
+		c.maxBytesPerInsert = bytes
+	}
+}
+
+// WithInsertConcurrency runs inserts on a shared pool of workers, queueing at most
+// queueSize inserts while all workers are busy. When the queue is full, Write fails
+// with ErrQueueFull. Values of workers less than or equal to zero run every insert
+// directly in the calling goroutine.
+func WithInsertConcurrency(workers, queueSize int) Option {
+	return func(c *BigqueryClient) {
+		c.insertConcurrency = workers
+		c.insertQueueSize = queueSize
+	}
+}
+
+// WithAsyncWrites makes Write buffer up to bufferSize samples in memory and return
+// immediately. The buffer is written to BigQuery in the background every flushInterval,
+// or as soon as it holds enough samples for a full insert. When the buffer has no room
+// for a batch, Write fails with ErrBufferFull, and with ErrBatchTooLarge for a batch of
+// more samples than the buffer holds. Call Close to flush the buffer on shutdown.
+func WithAsyncWrites(bufferSize int, flushInterval time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.bufferSize = bufferSize
+		c.flushInterval = flushInterval
+	}
+}
+
+// WithCoalescing makes concurrent synchronous writes share their inserts. The batch of
+// a Write waits until maxRows rows or maxBytes bytes are pending, or until it waited
+// for maxDelay, and is then written together with the other pending batches. Write
+// returns once the rows of its batch were written, with the failures of its own rows
+// only. Values of maxRows and maxBytes less than or equal to zero default to the limits
+// of a single insert; a maxDelay less than or equal to zero disables the coalescing.
+// Call Close to flush the pending batches on shutdown.
+func WithCoalescing(maxRows, maxBytes int, maxDelay time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.coalesceMaxRows = maxRows
+		c.coalesceMaxBytes = maxBytes
+		c.coalesceMaxDelay = maxDelay
+	}
+}
+
+// WithSpill makes writes failing with a retryable error, like a timeout, a server error,
+// an exceeded quota or an open circuit breaker, append their rows to segment files in a
+// subdirectory of dir named after the client instead of failing. The segments are replayed
+// in order every replayInterval, keeping their insert IDs, and survive restarts. When the
+// segments would exceed maxBytes, the oldest ones are dropped. An empty dir disables
+// the spill.
+func WithSpill(dir string, maxBytes int64, replayInterval time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.spillDir = dir
+		c.spillMaxBytes = maxBytes
+		c.spillReplayInterval = replayInterval
+	}
+}
+
+// WithAggregation additionally writes the minimum, maximum, average and count of the
+// samples of every series per interval to the given table of the same dataset. The
+// aggregates of an interval are written lateness after its end, samples arriving later
+// are dropped from the aggregates. Call Close to write the open intervals on shutdown.
+// An empty table disables the aggregation.
+func WithAggregation(table string, interval, lateness time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.aggregateTable = table
+		c.aggregateInterval = interval
+		c.aggregateLateness = lateness
+	}
+}
+
+// WithRetention keeps samples for the given duration. The retention is enforced when
+// NewClient returns and then every interval: partitioned tables get a partition expiration
+// equal to the retention, from other tables the expired rows are deleted. Of several
+// clients enforcing the retention of the same table, only the one holding a lease stored
+// in the labels of the table does so. Unless enforce is set, the changes are only logged.
+// Values of retention less than or equal to zero keep samples forever, values of interval
+// less than or equal to zero enforce the retention daily.
+func WithRetention(retention, interval time.Duration, enforce bool) Option {
+	return func(c *BigqueryClient) {
+		if interval <= 0 {
+			interval = 24 * time.Hour
+		}
+		c.retention = retention
+		c.retentionInterval = interval
+		c.retentionEnforce = enforce
+	}
+}
+
+// WithTableAdmin reads and updates the metadata of the table with the given admin instead
+// of doing so in BigQuery.
+func WithTableAdmin(admin TableAdmin) Option {
+	return func(c *BigqueryClient) {
+		c.tableAdmin = admin
+	}
+}
+
+// WithTagsType sets how the labels are stored, in a tags column of TagsTypeString or
+// TagsTypeJSON, or in a labels column with TagsTypeLabels. With TagsTypeAuto NewClient
+// detects it from the schema of the table.
+func WithTagsType(typ string) Option {
+	return func(c *BigqueryClient) {
+		c.tagsType = typ
+	}
+}
+
+// WithCreateTable makes NewClient create the table if it doesn't exist, partitioned by
+// day on the timestamp column and clustered on metricname.
+func WithCreateTable(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.createTable = enabled
+	}
+}
+
+// WithWriteDryRun makes Write build and split the rows like usual and update the metrics as
+// if they were written, but never send them to BigQuery. Every insert that would be sent is
+// summarized in a debug log line instead. Reads are unaffected.
+func WithWriteDryRun(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.writeDryRun = enabled
+	}
+}
+
+// WithSkipInvalidRows makes BigQuery insert the valid rows of an insert when some of its
+// rows are invalid, which is the default. When disabled, an insert with an invalid row
+// fails as a whole.
+func WithSkipInvalidRows(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.skipInvalidRows = enabled
+	}
+}
+
+// WithIgnoreUnknownValues makes BigQuery ignore values of rows which don't match a column
+// of the table instead of rejecting the rows.
+func WithIgnoreUnknownValues(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.ignoreUnknownValues = enabled
+	}
+}
+
+// WithDeduplication attaches a deterministic insert ID to every row, which lets BigQuery
+// drop duplicate rows on a best-effort basis when a write request is retried.
+// This slightly reduces the streaming insert throughput.
+func WithDeduplication(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.deduplicate = enabled
+	}
+}
+
+// WithMaxSampleAge drops samples older than maxAge when they are written, or with reject
+// fails the whole write with ErrSampleTooOld. Values less than or equal to zero disable the
+// limit.
+func WithMaxSampleAge(maxAge time.Duration, reject bool) Option {
+	return func(c *BigqueryClient) {
+		c.maxSampleAge = maxAge
+		c.rejectOldSamples = reject
+	}
+}
+
+// WithStaleMarkers writes the staleness markers of Prometheus as rows with a NULL value
+// instead of dropping them with the other NaN values, so that the end of a series is
+// stored. Reads always return rows with a NULL value as staleness markers.
+func WithStaleMarkers(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.storeStaleMarkers = enabled
+	}
+}
+
+// WithMaxFutureSkew handles samples more than skew ahead of the current time when they are
+// written: FutureSampleDrop drops them, FutureSampleClamp moves them to the current time
+// and FutureSampleReject fails the whole write with ErrSampleTooNew. Values less than or
+// equal to zero disable the limit.
+func WithMaxFutureSkew(skew time.Duration, behavior string) Option {
+	return func(c *BigqueryClient) {
+		c.maxFutureSkew = skew
+		c.futureBehavior = behavior
+	}
+}
+
+// WithRowRetries inserts the rows BigQuery rejected for a reason other than invalid
+// again, up to retries times, waiting backoff before the first retry and twice as long
+// before every further one. Rows rejected as invalid are always dropped.
+func WithRowRetries(retries int, backoff time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.rowRetries = retries
+		c.rowRetryBackoff = backoff
+	}
+}
+
+// WithMaxLoggedRowErrors limits how many failed rows of a single insert are logged individually.
+func WithMaxLoggedRowErrors(rows int) Option {
+	return func(c *BigqueryClient) {
+		c.maxLoggedRowErrors = rows
+	}
+}
+
+// WithReadLimits sets all limits of reads at once.
+func WithReadLimits(limits ReadLimits) Option {
+	return func(c *BigqueryClient) {
+		c.SetReadLimits(limits)
+	}
+}
+
+// WithMaxSamples limits the number of samples a single read may return.
+// Values less than or equal to zero disable the limit.
+func WithMaxSamples(samples int) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.MaxSamples = samples })
+	}
+}
+
+// WithMaxResponseBytes limits the approximate size of the marshaled response of a single
+// read. Reads are aborted while their rows are merged once they exceed it, before the
+// response is built. Values less than or equal to zero disable the limit.
+func WithMaxResponseBytes(bytes int) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.MaxResponseBytes = bytes })
+	}
+}
+
+// WithMaxRows limits the number of rows a single query of a read may return.
+// Values less than or equal to zero disable the limit.
+func WithMaxRows(rows int) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.MaxRows = rows })
+	}
+}
+
+// WithSkipBadRows leaves rows which can't be converted into samples, e.g. written by
+// another pipeline with an unexpected type, out of read responses instead of failing the
+// whole read. The rows are counted and the first error of every query is logged.
+func WithSkipBadRows(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.skipBadRows = enabled
+	}
+}
+
+// WithRequireMetricName rejects queries without an equality or regex matcher on the
+// metric name, which would scan the rows of all metrics.
+func WithRequireMetricName(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.RequireMetricName = enabled })
+	}
+}
+
+// WithMaxRange limits the time range of a single query. Queries over a longer range are
+// rejected with the behavior RangeLimitReject, and with RangeLimitTruncate their start
+// is moved forward so that they only read the most recent max of their range. Values
+// less than or equal to zero disable the limit.
+func WithMaxRange(max time.Duration, behavior string) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) {
+			l.MaxRange = max
+			l.MaxRangeBehavior = behavior
+		})
+	}
+}
+
+// WithSlowQueryThreshold logs the queries which take longer than the threshold at warn
+// level. Values less than or equal to zero disable the log.
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.SlowQueryThreshold = threshold })
+	}
+}
+
+// WithMaxBytesScanned rejects queries which BigQuery estimates to scan more than the
+// given number of bytes. The estimate is obtained with a dry run before every query.
+// Values less than or equal to zero disable the limit.
+func WithMaxBytesScanned(bytes int64) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.MaxBytesScanned = bytes })
+	}
+}
+
+// WithDryRunMinRange skips the dry run of WithMaxBytesScanned for queries over a time
+// range shorter than min.
+func WithDryRunMinRange(min time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.updateReadLimits(func(l *ReadLimits) { l.DryRunMinRange = min })
+	}
+}
+
+// WithReadCache caches the series returned by read queries for ttl in an LRU cache of
+// at most maxEntries queries. The time range of cached queries is widened to multiples of
+// bucket. Queries ending less than freshness ago are never cached, as their data may
+// still change.
+func WithReadCache(ttl time.Duration, maxEntries int, bucket, freshness time.Duration) Option {
+	return func(c *BigqueryClient) {
+		if ttl > 0 {
+			c.cache = newQueryCache(ttl, maxEntries, bucket, freshness)
+		}
+	}
+}
+
+// WithLocation runs the query jobs in the given location, e.g. europe-west3. When empty,
+// BigQuery derives the location from the tables the query refers to.
+func WithLocation(location string) Option {
+	return func(c *BigqueryClient) {
+		c.location = location
+	}
+}
+
+// WithDataProject reads and writes the tables in the given project instead of the
+// project of the client, which is still billed for the jobs. This allows to keep the
+// table in a shared project the credentials of the adapter aren't homed in.
+func WithDataProject(projectID string) Option {
+	return func(c *BigqueryClient) {
+		c.dataProjectID = projectID
+	}
+}
+
+// WithQueryPriority runs read queries with the given priority, either "interactive" or
+// "batch". Batch queries may wait in a queue until slots are available, which counts
+// against the timeout of the client.
+func WithQueryPriority(priority string) Option {
+	return func(c *BigqueryClient) {
+		c.priority = bigquery.QueryPriority(strings.ToUpper(priority))
+	}
+}
+
+// WithMaxBytesBilled makes BigQuery fail read queries which would bill more than the
+// given number of bytes. Values less than or equal to zero use the project default.
+func WithMaxBytesBilled(bytes int64) Option {
+	return func(c *BigqueryClient) {
+		c.maxBytesBilled = bytes
+	}
+}
+
+// WithJobLabels attaches the labels to the query jobs of the client. Streaming inserts
+// don't run as jobs, so they can't be labeled.
+func WithJobLabels(labels map[string]string) Option {
+	return func(c *BigqueryClient) {
+		c.jobLabels = labels
+	}
+}
+
+// WithCredentialsJSON authenticates the client with the given service account json key
+// instead of a key file. Its project_id is used when no project is given.
+func WithCredentialsJSON(key []byte) Option {
+	return func(c *BigqueryClient) {
+		c.credentialsJSON = key
+	}
+}
+
+// WithMetricFactory creates the metrics of the client with the factory, which sets their
+// namespace and constant labels.
+func WithMetricFactory(f metricfactory.Factory) Option {
+	return func(c *BigqueryClient) {
+		c.metricFactory = f
+	}
+}
+
+// WithKeyRotation checks the service account key file every interval and replaces the
+// BigQuery client with one using the new key once the content of the file changed, e.g.
+// after a secrets operator rotated the key. Zero disables the checks.
+func WithKeyRotation(interval time.Duration) Option {
+	return func(c *BigqueryClient) {
+		c.keyCheckInterval = interval
+	}
+}
+
+// WithEndpoint sends all requests to the given endpoint without authentication,
+// e.g. to run against a BigQuery emulator.
+func WithEndpoint(endpoint string) Option {
+	return func(c *BigqueryClient) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithImpersonation makes the client act as the target service account, using the
+// credentials of the adapter to request short-lived tokens for it. The delegates are the
+// chain of service accounts the tokens are requested through. Scopes override the
+// default OAuth2 scopes of the impersonated credentials.
+func WithImpersonation(target string, delegates, scopes []string) Option {
+	return func(c *BigqueryClient) {
+		c.impersonate = target
+		c.delegates = delegates
+		c.scopes = scopes
+	}
+}
+
+// WithCircuitBreaker makes Write and Read fail immediately with a CircuitOpenError while
+// BigQuery is unavailable, instead of waiting for their timeouts. The breaker opens after
+// failures consecutive failed operations, or when at least failureRatio of the last window
+// operations failed. It stays open for openDuration, then lets probes operations through
+// and closes once all of them succeeded. Only timeouts, network errors and errors on the
+// side of BigQuery count as failures. Values of failures and failureRatio less than or
+// equal to zero disable the respective condition, and the breaker if both are disabled.
+// Writes in asynchronous mode aren't affected.
+func WithCircuitBreaker(failures int, failureRatio float64, window int, openDuration time.Duration, probes int) Option {
+	return func(c *BigqueryClient) {
+		c.breakerFailures = failures
+		c.breakerFailureRatio = failureRatio
+		c.breakerWindow = window
+		c.breakerOpenDuration = openDuration
+		c.breakerProbes = probes
+	}
+}
+
+// WithStorageReadAPI fetches the results of read queries with the BigQuery Storage Read API,
+// which streams large results much faster than paging through them. Small results and
+// queries the API can't serve still use the regular API. The service account needs the
+// bigquery.readsessions.create permission, which is checked by NewClient.
+func WithStorageReadAPI(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.useStorageAPI = enabled
+	}
+}
+
+// WithServerSideSort makes read queries return the rows sorted by timestamp. Without it
+// BigQuery doesn't have to sort all rows of a query, and the samples of every series
+// are sorted after merging the rows, which they are in both cases anyway.
+func WithServerSideSort(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.serverSideSort = enabled
+	}
+}
+
+// NewClient creates a new Client. It fails if the service account key can't be read, no
+// project id is known, or the BigQuery client can't be created.
+func NewClient(logger *slog.Logger, googleAPIjsonkeypath, googleProjectID, googleAPIdatasetID, googleAPItableID string, remoteTimeout time.Duration, opts ...Option) (*BigqueryClient, error) {
 	ctx := context.Background()
 	if logger == nil {
 		logger = promslog.NewNopLogger()
 	}
-	bigQueryClientOptions := []option.ClientOption{}
-	if googleAPIjsonkeypath != "" {
-		jsonFile, err := os.Open(googleAPIjsonkeypath)
-		if err != nil {
-			logger.Error("failed to open google api json key", slog.Any("error", err))
-			os.Exit(1)
+	client := newClient(logger, googleAPIdatasetID, googleAPItableID, remoteTimeout, opts...)
+	bigQueryClientOptions := []option.ClientOption{}
+	var key []byte
+	if googleAPIjsonkeypath != "" {
+		var projectID string
+		var err error
+		key, projectID, err = readKeyFile(googleAPIjsonkeypath)
+		if err != nil {
+			return nil, err
+		}
+
+		if googleProjectID == "" {
+			googleProjectID = projectID
+		}
+	}
+	if len(client.credentialsJSON) > 0 {
+		projectID, err := projectIDFromKey(client.credentialsJSON)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal inline google api json key")
+		}
+
+		if googleProjectID == "" {
+			googleProjectID = projectID
+		}
+		bigQueryClientOptions = append(bigQueryClientOptions, option.WithCredentialsJSON(client.credentialsJSON))
+	}
+	if googleProjectID == "" {
+		return nil, errors.New("no google project id given and the service account key doesn't contain one")
+	}
+	if client.endpoint != "" {
+		bigQueryClientOptions = append(bigQueryClientOptions, option.WithEndpoint(client.endpoint), option.WithoutAuthentication())
+	}
+	if client.impersonate != "" {
+		//nolint:staticcheck // the impersonate package replacing it isn't a dependency yet.
+		bigQueryClientOptions = append(bigQueryClientOptions, option.ImpersonateCredentials(client.impersonate, client.delegates...))
+		if len(client.scopes) > 0 {
+			bigQueryClientOptions = append(bigQueryClientOptions, option.WithScopes(client.scopes...))
+		}
+	}
+
+	// The options without the key file are kept to connect with a rotated key.
+	client.projectID = googleProjectID
+	client.clientOptions = bigQueryClientOptions
+	if key != nil {
+		bigQueryClientOptions = append(slices.Clip(bigQueryClientOptions), option.WithCredentialsJSON(key))
+	}
+	c, err := client.newBigQueryClient(ctx, googleProjectID, bigQueryClientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new bigquery client")
+	}
+
+	client.conn = newConnection(c)
+	if client.inserter == nil {
+		client.inserter = client.newInserter(client.table(googleAPIdatasetID, googleAPItableID))
+	}
+	for _, d := range client.destinations[1:] {
+		d.inserter = client.newInserter(client.table(d.datasetID, d.tableID))
+	}
+	if client.aggregator != nil && client.aggregateInserter == nil {
+		client.aggregateInserter = client.newInserter(client.table(googleAPIdatasetID, client.aggregateTable))
+	}
+	if client.loader == nil {
+		client.loader = &bigqueryLoader{
+			table:    client.table(googleAPIdatasetID, googleAPItableID),
+			location: client.location,
+			labels:   client.jobLabels,
+		}
+	}
+
+	if client.tableAdmin == nil {
+		tableID := googleAPItableID
+		if client.dateSharding {
+			tableID += shardSuffix(time.Now())
+		}
+		client.tableAdmin = client.table(googleAPIdatasetID, tableID)
+	}
+	if client.createTable {
+		if err := client.createTableIfMissing(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if client.tagsType == TagsTypeAuto {
+		if err := client.detectTagsType(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to detect the type of the tags column")
+		}
+		logger.Info("detected type of the tags column", slog.String("type", client.tagsType))
+	}
+	if client.timestampType == TimestampTypeAuto {
+		if err := client.detectTimestampType(ctx); err != nil {
+			return nil, errors.Wrap(err, "failed to detect the type of the timestamp column")
+		}
+		logger.Info("detected type of the timestamp column", slog.String("type", client.timestampType))
+	}
+
+	if client.impersonate != "" {
+		if err := client.checkTableAccess(ctx); err != nil {
+			return nil, errors.Wrapf(err, "failed to access the table as the impersonated service account %s, make sure the credentials of the adapter have the Service Account Token Creator role on it and on every delegate", client.impersonate)
+		}
+		logger.Info("impersonating service account", slog.String("service_account", client.impersonate), slog.Any("delegates", client.delegates))
+	}
+
+	if client.useStorageAPI {
+		if err := c.EnableStorageReadClient(ctx, bigQueryClientOptions...); err != nil {
+			return nil, errors.Wrap(err, "failed to create bigquery storage read client")
+		}
+		if err := client.checkStorageReadAPI(ctx); err != nil {
+			return nil, errors.Wrap(err, "the storage read api can't be used, make sure the service account has the bigquery.readsessions.create permission, e.g. with the BigQuery Read Session User role")
+		}
+	}
+
+	if client.retention > 0 {
+		client.startRetention()
+	}
+	if client.deadLetterTable != "" && client.deadLetter == nil {
+		datasetID := client.deadLetterDataset
+		if datasetID == "" {
+			datasetID = googleAPIdatasetID
+		}
+		admin := client.table(datasetID, client.deadLetterTable)
+		if client.createTable {
+			if err := client.createDeadLetterTable(ctx, admin, datasetID); err != nil {
+				_ = client.Close()
+				return nil, err
+			}
+		}
+		client.deadLetter = client.newDeadLetter(&tableDeadLetters{inserter: &tableInserter{table: admin}})
+	}
+	// The stager replaces the inserter before the spilled samples of a previous run are
+	// replayed, so they are loaded by load jobs as well.
+	if err := client.startStager(ctx); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	client.startDeadLetter()
+	if err := client.startSpill(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if key != nil && client.keyCheckInterval > 0 {
+		client.keyPath = googleAPIjsonkeypath
+		client.keyHash = sha256.Sum256(key)
+		client.startKeyRotation()
+	}
+	return client, nil
+}
+
+// checkTableAccess fetches the metadata of the table, which fails early if the
+// credentials of the client can't be obtained or lack access to the table.
+func (c *BigqueryClient) checkTableAccess(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	_, err := c.table(c.datasetID, c.tableID).Metadata(ctx)
+	return err
+}
+
+// checkStorageReadAPI reads from the table with the storage read api, which fails if the
+// service account lacks the permission to create read sessions.
+func (c *BigqueryClient) checkStorageReadAPI(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	conn := c.acquire()
+	defer conn.release()
+	it := c.table(c.datasetID, c.tableID).in(conn).Read(ctx)
+	if !it.IsAccelerated() {
+		return errors.New("creating a read session failed")
+	}
+	var row map[string]bigquery.Value
+	if err := it.Next(&row); err != nil && err != iterator.Done {
+		return err
+	}
+	return nil
+}
+
+// newClient creates a BigqueryClient without a connection to BigQuery.
+func newClient(logger *slog.Logger, datasetID, tableID string, timeout time.Duration, opts ...Option) *BigqueryClient {
+	client := &BigqueryClient{
+		logger:               logger,
+		name:                 "bigquerydb",
+		datasetID:            datasetID,
+		tableID:              tableID,
+		writeTimeout:         timeout,
+		readTimeout:          timeout,
+		maxLoggedRowErrors:   10,
+		skipInvalidRows:      true,
+		serverSideSort:       true,
+		tagsType:             TagsTypeString,
+		timestampType:        TimestampTypeTimestamp,
+		readTemplate:         defaultReadTemplate,
+		retentionHolder:      retentionHolderID(),
+		metricFactory:        metricfactory.Default(),
+		partitioning:         PartitioningColumn,
+		partitionGranularity: PartitionDay,
+	}
+	client.dryRun = client.dryRunQuery
+	client.runStatement = client.runStatementQuery
+	client.querier = bigqueryQuerier{}
+	client.newBigQueryClient = bigquery.NewClient
+	client.tableAdminFor = func(datasetID, tableID string) TableAdmin {
+		return client.table(datasetID, tableID)
+	}
+	// Clients without a connection to BigQuery still build their queries with one.
+	client.conn = newConnection(&bigquery.Client{})
+	client.readLimits.Store(&ReadLimits{})
+	for _, opt := range opts {
+		opt(client)
+	}
+	f := client.metricFactory
+	client.metricSamples = newMetricSamplesCounter(f, client.metricSamplesLimit)
+	client.ignoredSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ignored_samples_total",
+			Help: "Deprecated: use storage_bigquery_dropped_samples_total. The total number of samples not sent to BigQuery for any reason.",
+		},
+	)
+	client.droppedSamples = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dropped_samples_total",
+			Help: "Total number of samples not sent to BigQuery, by reason.",
+		},
+		[]string{"reason"},
+	)
+	client.droppedLabels = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dropped_labels_total",
+			Help: "Total number of labels removed from written series by the configured label drops.",
+		},
+	)
+	client.recordsFetched = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "records_fetched",
+			Help: "Total number of records fetched",
+		},
+	)
+	client.batchWriteDuration = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "batch_write_duration_seconds",
+			Help:    "The duration it takes to write a batch of samples to BigQuery.",
+			Buckets: f.WriteBuckets(),
+		},
+	)
+	client.writeLag = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "write_lag_seconds",
+			Help:    "Time between the timestamp of the newest sample of a write and its arrival at the adapter.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 14),
+		},
+	)
+	client.writtenBytes = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "written_bytes_total",
+			Help: "Total estimated size of the rows written to BigQuery.",
+		},
+	)
+	client.writtenRows = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "written_rows_total",
+			Help: "Total number of rows written to BigQuery.",
+		},
+	)
+	client.insertBatchRows = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "insert_batch_rows",
+			Help:    "Number of rows sent to BigQuery in a single insert call.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		},
+	)
+	client.sqlQueryCount = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "sql_query_count_total",
+			Help: "Total number of sql_queries executed.",
+		},
+	)
+	client.sqlQueryDuration = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "sql_query_duration_seconds",
+			Help:    "Duration of the sql reads from BigQuery.",
+			Buckets: f.ReadBuckets(),
+		},
+	)
+	client.readSamples = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "read_samples",
+			Help:    "Number of samples returned by a single read.",
+			Buckets: prometheus.ExponentialBuckets(100, 4, 10),
+		},
+	)
+	client.readBytesProcessed = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "read_bytes_processed",
+			Help:    "Number of bytes processed by a single read query, as reported by BigQuery.",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+		},
+	)
+	client.readEstimatedBytes = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "read_estimated_bytes_scanned",
+			Help:    "Number of bytes a single read query would scan, as estimated by the dry run checking it against the limit.",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+		},
+	)
+	client.queryBytesProcessed = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "query_bytes_processed_total",
+			Help: "Total number of bytes processed by read queries, as reported by BigQuery.",
+		},
+	)
+	client.querySlotSeconds = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "query_slot_seconds_total",
+			Help: "Total number of slot seconds used by read queries, as reported by BigQuery.",
+		},
+	)
+	client.queryCacheHits = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "query_cache_hits_total",
+			Help: "Total number of read queries answered from the BigQuery query cache.",
+		},
+	)
+	client.insertRowErrors = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "insert_row_errors_total",
+			Help: "Total number of rows rejected by BigQuery, by error reason.",
+		},
+		[]string{"reason"},
+	)
+	client.insertErrors = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "insert_errors_total",
+			Help: "Total number of errors of inserts into BigQuery, by reason. Inserts which failed as a whole count once, rows rejected by an insert count once each.",
+		},
+		[]string{"reason"},
+	)
+	client.readLimitExceeded = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "read_limit_exceeded_total",
+			Help: "Total number of reads rejected by a read limit, by limit.",
+		},
+		[]string{"limit"},
+	)
+	client.readRangeTruncated = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_range_truncated_total",
+			Help: "Total number of read queries whose time range was truncated to the maximum range.",
+		},
+	)
+	client.slowQueries = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "slow_queries_total",
+			Help: "Total number of read queries which took longer than the slow query threshold.",
+		},
+	)
+	client.duplicateSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_duplicate_samples_total",
+			Help: "Total number of samples dropped from read responses because they were returned more than once.",
+		},
+	)
+	client.skippedRows = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_skipped_rows_total",
+			Help: "Total number of rows left out of read responses because they couldn't be converted into samples.",
+		},
+	)
+	client.readPages = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_pages_total",
+			Help: "Total number of pages of query results fetched ahead of their conversion into samples.",
+		},
+	)
+	client.readPageWait = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_page_wait_seconds_total",
+			Help: "Total time read queries spent waiting for the next page of their results.",
+		},
+	)
+	client.readCacheHits = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_cache_hits_total",
+			Help: "Total number of read queries served from the cache.",
+		},
+	)
+	client.readCacheMisses = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_cache_misses_total",
+			Help: "Total number of cacheable read queries which were not found in the cache.",
+		},
+	)
+	client.readQueries = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "read_queries_total",
+			Help: "Total number of read queries, by the API their results were fetched with.",
+		},
+		[]string{"api"},
+	)
+	client.readSplits = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "read_splits",
+			Help:    "Number of sub-range queries a read query was split into by the split interval.",
+			Buckets: prometheus.ExponentialBuckets(2, 2, 8),
+		},
+	)
+	client.readSplitQueries = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "read_split_queries_total",
+			Help: "Total number of sub-range queries of split read queries, by result.",
+		},
+		[]string{"result"},
+	)
+	client.resolutionQueries = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "read_resolution_queries_total",
+			Help: "Total number of read queries, by the table serving them, raw for the table of raw samples.",
+		},
+		[]string{"table"},
+	)
+	client.cancelledOperations = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cancelled_operations_total",
+			Help: "Total number of writes and reads abandoned because the request was cancelled.",
+		},
+		[]string{"operation"},
+	)
+	client.tableSentSamples = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_sent_samples_total",
+			Help: "Total number of samples written to a table, by table.",
+		},
+		[]string{"table"},
+	)
+	client.tableFailedSamples = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "table_failed_samples_total",
+			Help: "Total number of samples which failed to be written to a table, by table.",
+		},
+		[]string{"table"},
+	)
+	client.cancelledQueries = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cancelled_queries_total",
+			Help: "Total number of query jobs cancelled in BigQuery because their results were no longer needed.",
+		},
+	)
+	client.activeInserts = f.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "insert_workers_active",
+			Help: "Number of insert workers currently writing to BigQuery.",
+		},
+	)
+	client.writeHealth = newOperationHealth(f, "write")
+	client.readHealth = newOperationHealth(f, "read")
+	client.retentionLastRun = f.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retention_last_enforcement_timestamp_seconds",
+			Help: "Unix time the retention of the table was last enforced by this replica.",
+		},
+	)
+	client.retentionDeletedRows = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "retention_deleted_rows_total",
+			Help: "Total number of rows deleted because they were older than the retention.",
+		},
+	)
+	client.setupRoutes()
+	if client.insertConcurrency > 0 {
+		client.pool = newInsertPool(client.insertConcurrency, client.insertQueueSize, client.activeInserts)
+	}
+	client.insertQueueDepth = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "insert_queue_depth",
+			Help: "Number of inserts waiting for a free worker.",
+		},
+		func() float64 { return float64(client.pool.queueDepth()) },
+	)
+	client.readCacheEntries = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "read_cache_entries",
+			Help: "Number of queries in the read cache.",
+		},
+		func() float64 { return float64(client.cache.len()) },
+	)
+	client.maxBytesBilledGauge = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "read_max_bytes_billed",
+			Help: "Maximum number of bytes a read query may bill, 0 if not limited.",
+		},
+		func() float64 { return float64(client.maxBytesBilled) },
+	)
+	client.retriedRows = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "insert_retried_rows_total",
+			Help: "Total number of rows rejected by BigQuery which were inserted again.",
+		},
+	)
+	client.bufferFailedSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "buffer_failed_samples_total",
+			Help: "Total number of buffered samples which failed to be written to BigQuery.",
+		},
+	)
+	client.breakerState = f.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of the circuit breaker: 0 closed, 1 half-open, 2 open.",
+		},
+	)
+	client.credentialReloads = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "credential_reloads_total",
+			Help: "Total number of attempts to replace the BigQuery client after the service account key file changed, by result.",
+		},
+		[]string{"result"},
+	)
+	client.breakerTransitions = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of state changes of the circuit breaker, by the state changed to.",
+		},
+		[]string{"state"},
+	)
+	if client.breakerFailures > 0 || (client.breakerFailureRatio > 0 && client.breakerWindow > 0) {
+		client.breaker = newCircuitBreaker(client.breakerFailures, client.breakerFailureRatio, client.breakerWindow,
+			client.breakerOpenDuration, client.breakerProbes, client.logger, client.breakerState, client.breakerTransitions)
+	}
+	if client.bufferSize > 0 {
+		client.buffer = newWriteBuffer(client.bufferSize, client.maxRowsPerInsert, client.flushInterval, client.flush)
+	}
+	client.bufferFlushes = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "buffer_flushes_total",
+			Help: "Total number of flushes of the write buffer, by the reason of the flush.",
+		},
+		[]string{"reason"},
+	)
+	client.bufferFlushRows = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "buffer_flush_rows",
+			Help:    "Number of rows written by a single flush of the write buffer.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		},
+	)
+	client.backpressureSamples = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backpressure_rejected_samples_total",
+			Help: "Total number of samples rejected because the write pipeline was full, by the full stage.",
+		},
+		[]string{"stage"},
+	)
+	client.coalesceFlushes = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coalesce_flushes_total",
+			Help: "Total number of flushes of coalesced writes, by the reason of the flush.",
+		},
+		[]string{"reason"},
+	)
+	client.coalesceFlushWrites = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "coalesce_flush_writes",
+			Help:    "Number of write requests coalesced into a single flush.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		},
+	)
+	client.coalesceFlushRows = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "coalesce_flush_rows",
+			Help:    "Number of rows written by a single flush of coalesced writes.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		},
+	)
+	client.spilledSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "spilled_samples_total",
+			Help: "Total number of samples of failed writes appended to the spill directory.",
+		},
+	)
+	client.spillReplayedSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "spill_replayed_samples_total",
+			Help: "Total number of spilled samples written to BigQuery.",
+		},
+	)
+	client.spillDroppedSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "spill_dropped_samples_total",
+			Help: "Total number of spilled samples dropped because the spill directory was full.",
+		},
+	)
+	client.spillCorruptSegments = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "spill_corrupt_segments_total",
+			Help: "Total number of spill segments skipped because they couldn't be decoded.",
+		},
+	)
+	client.spillBytes = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "spill_bytes",
+			Help: "Size of the segments in the spill directory.",
+		},
+		func() float64 { return float64(client.spill.bytes()) },
+	)
+	client.spillSegments = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "spill_segments",
+			Help: "Number of segments in the spill directory waiting to be replayed.",
+		},
+		func() float64 { return float64(client.spill.len()) },
+	)
+	client.loadStagedBytes = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "load_staged_bytes_total",
+			Help: "Total number of compressed bytes of objects uploaded to Cloud Storage for load jobs.",
+		},
+	)
+	client.loadJobs = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "load_jobs_total",
+			Help: "Total number of load jobs of staged objects by state: succeeded or failed.",
+		},
+		[]string{"state"},
+	)
+	client.loadDelay = f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "load_delay_seconds",
+			Help:    "Time from staging the first row of an object until its load job completed.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		},
+	)
+	client.loadQuarantined = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "load_quarantined_objects_total",
+			Help: "Total number of staged objects which couldn't be loaded and were moved to the quarantine prefix.",
+		},
+	)
+	client.loadPendingObjects = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "load_pending_objects",
+			Help: "Number of staged objects waiting to be uploaded to Cloud Storage or loaded.",
+		},
+		func() float64 { return float64(client.stager.len()) },
+	)
+	client.deadLetteredSamples = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dead_lettered_samples_total",
+			Help: "Total number of samples which couldn't be written stored in the dead-letter sink.",
+		},
+	)
+	client.deadLetterDropped = f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letter_dropped_samples_total",
+			Help: "Total number of samples which couldn't be written and weren't stored in the dead-letter sink either, by reason.",
+		},
+		[]string{"reason"},
+	)
+	if client.deadLetterSink != nil {
+		client.deadLetter = client.newDeadLetter(client.deadLetterSink)
+	}
+	if client.coalesceMaxDelay > 0 && client.bufferSize <= 0 {
+		maxRows, maxBytes := client.coalesceMaxRows, client.coalesceMaxBytes
+		if maxRows <= 0 {
+			maxRows = client.maxRowsPerInsert
+		}
+		if maxBytes <= 0 {
+			maxBytes = client.maxBytesPerInsert
+		}
+		client.coalescer = newCoalescer(maxRows, maxBytes, client.coalesceMaxDelay, client.flushCoalesced)
+	}
+	client.aggregateFlushed = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aggregate_flushed_rows_total",
+			Help: "Total number of aggregated rows written to the aggregate table.",
+		},
+	)
+	client.aggregateFailed = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aggregate_failed_rows_total",
+			Help: "Total number of aggregated rows which could not be written to the aggregate table.",
+		},
+	)
+	client.aggregateLate = f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aggregate_late_samples_total",
+			Help: "Total number of samples left out of the aggregates, as their interval was already written.",
+		},
+	)
+	if client.aggregateTable != "" {
+		client.aggregator = newAggregator(client.aggregateInterval, client.aggregateLateness, client.flushAggregates, client.aggregateLate)
+	}
+	client.aggregateBuckets = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "aggregate_open_buckets",
+			Help: "Number of series intervals being aggregated which weren't written yet.",
+		},
+		func() float64 { return float64(client.aggregator.len()) },
+	)
+	client.bufferedSamples = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "buffered_samples",
+			Help: "Number of samples waiting in the write buffer.",
+		},
+		func() float64 { return float64(client.buffer.len()) },
+	)
+	client.bufferOldestAge = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "buffer_oldest_sample_age_seconds",
+			Help: "Time the oldest sample in the write buffer has been waiting.",
+		},
+		func() float64 { return client.buffer.oldestAge().Seconds() },
+	)
+	client.bufferedBytes = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "buffered_bytes",
+			Help: "Estimated size of the samples waiting in the write buffer.",
+		},
+		func() float64 { return float64(client.buffer.bytes()) },
+	)
+	client.coalescePendingRows = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "coalesce_pending_samples",
+			Help: "Number of samples of coalesced writes waiting to be flushed.",
+		},
+		func() float64 { return float64(client.coalescer.pendingRows()) },
+	)
+	client.coalescePendingBytes = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "coalesce_pending_bytes",
+			Help: "Estimated size of the samples of coalesced writes waiting to be flushed.",
+		},
+		func() float64 { return float64(client.coalescer.pendingBytes()) },
+	)
+	client.coalesceOldestAge = f.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "coalesce_oldest_sample_age_seconds",
+			Help: "Time the oldest coalesced write has been waiting to be flushed.",
+		},
+		func() float64 { return client.coalescer.oldestAge().Seconds() },
+	)
+	return client
+}
+
+// Item represents a row item.
+type Item struct {
+	value      float64 `bigquery:"value"`
+	metricname string  `bigquery:"metricname"`
+	timestamp  int64   `bigquery:"timestamp"`
+	tags       string  `bigquery:"tags"`
+	// labels are only set when the labels are written to the labels column, they are
+	// shared by all rows of a series.
+	labels   []itemLabel
+	insertID string
+	// stale marks a staleness marker, which is written with a NULL value.
+	stale bool
+	// special is the special value column of NaN and infinite values, which are written
+	// with a NULL value.
+	special string
+	// seriesHash is the fingerprint of the labels, it is zero unless the series hash
+	// column is written.
+	seriesHash model.Fingerprint
+	// insertTime marks rows written with the time of their insert in the insert time column.
+	insertTime bool
+	// timestampMs is the timestamp in milliseconds, it is only set when the timestamp
+	// column holds milliseconds.
+	timestampMs int64
+	// suffix is the suffix of the template table of the row, if any.
+	suffix string
+	// failedAt is when writing the row failed for the first time in Unix milliseconds, it
+	// is only set for spilled rows.
+	failedAt int64
+}
+
+// Save implements the ValueSaver interface.
+func (i *Item) Save() (map[string]bigquery.Value, string, error) {
+	row := map[string]bigquery.Value{
+		"value":      i.value,
+		"metricname": i.metricname,
+		"timestamp":  i.timestamp,
+	}
+	if i.stale {
+		row["value"] = nil
+	}
+	if i.special != "" {
+		row["value"] = nil
+		row[specialValueColumn] = i.special
+	}
+	if i.seriesHash != 0 {
+		row[seriesHashColumn] = int64(i.seriesHash)
+	}
+	if i.insertTime {
+		// Rows are saved when they are sent, so retries get the time of their own insert.
+		row[insertTimeColumn] = time.Now()
+	}
+	if i.timestampMs != 0 {
+		row["timestamp"] = i.timestampMs
+	}
+	if i.labels != nil {
+		row["labels"] = i.labels
+	} else {
+		row["tags"] = i.tags
+	}
+	return row, i.insertID, nil
+}
+
+// insertID derives a deterministic insert ID for a sample, so that BigQuery can drop
+// rows which are sent again when Prometheus retries a write request. The ID is a
+// 128 bit prefix of a SHA-256 over the metric name, the tags, the timestamp in
+// milliseconds and the value; different samples colliding is practically impossible,
+// while the very same sample sent twice is intentionally deduplicated.
+func insertID(metricname, tags string, timestampMs int64, value float64) string {
+	h := sha256.New()
+	h.Write([]byte(metricname))
+	h.Write([]byte{0xff})
+	h.Write([]byte(tags))
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(timestampMs))
+	binary.BigEndian.PutUint64(buf[8:], math.Float64bits(value))
+	h.Write(buf[:])
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// itemOverhead approximates the size of the JSON keys, the value and the timestamp of a row.
+const itemOverhead = 96
+
+// estimatedSize approximates the serialized size of the row in an insertAll request.
+func (i *Item) estimatedSize() int {
+	return len(i.metricname) + len(i.tags) + itemOverhead
+}
+
+// splitBatch splits the batch into chunks of at most maxRows rows and maxBytes estimated bytes.
+// A single row exceeding maxBytes is placed in a chunk of its own.
+func splitBatch[T interface{ estimatedSize() int }](batch []T, maxRows, maxBytes int) [][]T {
+	var chunks [][]T
+	start, size := 0, 0
+	for i, item := range batch {
+		rowSize := item.estimatedSize()
+		rows := i - start
+		if rows > 0 && ((maxRows > 0 && rows >= maxRows) || (maxBytes > 0 && size+rowSize > maxBytes)) {
+			chunks = append(chunks, batch[start:i])
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	if start < len(batch) {
+		chunks = append(chunks, batch[start:])
+	}
+	return chunks
+}
+
+// WriteError is returned by Write when some of the samples of a batch could not be written.
+type WriteError struct {
+	// FailedSamples is the number of samples which were not written.
+	FailedSamples int
+	// Errors holds the error of every failed insert.
+	Errors []error
+}
+
+func (e *WriteError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("failed to write %d samples: %s", e.FailedSamples, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the failed inserts.
+func (e *WriteError) Unwrap() []error {
+	return e.Errors
+}
+
+// QueryError is returned by Read when one of the queries of a read request failed. Its
+// message is the one of the error the query failed with.
+type QueryError struct {
+	// Matchers are the matchers of the failed query, like {__name__="up", job="api"}.
+	Matchers string
+	// SQL is the generated SQL of the query, empty if it couldn't be generated.
+	SQL string
+	// Err is the error the query failed with.
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error the query failed with.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// ErrSampleTooOld is returned by Write, wrapped in a WriteError, when a sample is older
+// than the maximum sample age and old samples are rejected. It matches ErrBadRequest.
+var ErrSampleTooOld = badRequest(errors.New("sample is older than the maximum sample age"))
+
+// ErrSampleTooNew is returned by Write, wrapped in a WriteError, when a sample is further
+// in the future than the maximum future skew and such samples are rejected. It matches
+// ErrBadRequest.
+var ErrSampleTooNew = badRequest(errors.New("sample is further in the future than the maximum skew"))
+
+// Behaviors for samples further in the future than the maximum skew.
+const (
+	// FutureSampleDrop drops the samples.
+	FutureSampleDrop = "drop"
+	// FutureSampleClamp writes the samples with the current time.
+	FutureSampleClamp = "clamp"
+	// FutureSampleReject rejects the whole write request.
+	FutureSampleReject = "reject"
+)
+
+// tagsFromMetric extracts tags from a Prometheus MetricNameLabel.
+func tagsFromMetric(m model.Metric) string {
+	labels := make([]prompb.Label, 0, len(m))
+	for l, v := range m {
+		labels = append(labels, prompb.Label{Name: string(l), Value: string(v)})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return tagsFromLabels(labels)
+}
+
+// Write sends a batch of samples to BigQuery via the client.
+// In asynchronous mode the samples are buffered and written in the background. With
+// coalescing, the samples are written together with the samples of concurrent writes.
+func (c *BigqueryClient) Write(ctx context.Context, timeseries []*prompb.TimeSeries) error {
+	if lag, ok := writeLag(timeseries, time.Now()); ok {
+		c.writeLag.Observe(lag.Seconds())
+	}
+	tenant, err := c.tenant(ctx)
+	var suffix string
+	if err == nil {
+		suffix, err = c.templateSuffixFor(tenant)
+	}
+	var batch []*Item
+	if err == nil {
+		batch, err = c.buildBatch(ctx, timeseries, tenant, c.sampleWindow(time.Now()))
+	}
+	if suffix != "" {
+		for _, item := range batch {
+			item.suffix = suffix
 		}
-
-		byteValue, _ := io.ReadAll(jsonFile)
-
-		var result map[string]interface{}
-		err = json.Unmarshal([]byte(byteValue), &result)
-		if err != nil {
-			logger.Error("failed to unmarshal google api json key", slog.Any("error", err))
-			os.Exit(1)
+	}
+	if c.dateSharding {
+		setShardSuffixes(batch)
+	}
+	if err != nil {
+		samples := 0
+		for _, ts := range timeseries {
+			samples += len(ts.Samples)
 		}
-
-		jsonFile.Close()
-
-		if googleProjectID == "" {
-			googleProjectID = fmt.Sprintf("%v", result["project_id"])
+		return &WriteError{FailedSamples: samples, Errors: []error{err}}
+	}
+	if c.buffer != nil {
+		if err := c.buffer.add(batch); err != nil {
+			if errors.Is(err, ErrBufferFull) {
+				c.backpressureSamples.WithLabelValues("buffer").Add(float64(len(batch)))
+			}
+			return &WriteError{FailedSamples: len(batch), Errors: []error{err}}
 		}
-		bigQueryClientOptions = append(bigQueryClientOptions, option.WithCredentialsFile(googleAPIjsonkeypath))
+		c.aggregator.add(batch)
+		return nil
+	}
+	if c.coalescer != nil {
+		err := c.coalescer.add(batch).wait(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+			c.cancelledOperations.WithLabelValues("write").Inc()
+		}
+		return err
 	}
 
-	c, err := bigquery.NewClient(ctx, googleProjectID, bigQueryClientOptions...)
-
+	done, err := c.breaker.allow()
 	if err != nil {
-		logger.Error("failed to create new bigquery client", slog.Any("error", err))
-		os.Exit(1)
-	}
-
-	return &BigqueryClient{
-		logger:    logger,
-		client:    *c,
-		datasetID: googleAPIdatasetID,
-		tableID:   googleAPItableID,
-		timeout:   remoteTimeout,
-		ignoredSamples: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "storage_bigquery_ignored_samples_total",
-				Help: "The total number of samples not sent to BigQuery due to unsupported float values (Inf, -Inf, NaN).",
-			},
-		),
-		recordsFetched: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "storage_bigquery_records_fetched",
-				Help: "Total number of records fetched",
-			},
-		),
-		batchWriteDuration: prometheus.NewHistogram(
-			prometheus.HistogramOpts{
-				Name:    "storage_bigquery_batch_write_duration_seconds",
-				Help:    "The duration it takes to write a batch of samples to BigQuery.",
-				Buckets: prometheus.DefBuckets,
-			},
-		),
-		sqlQueryCount: prometheus.NewCounter(
-			prometheus.CounterOpts{
-				Name: "storage_bigquery_sql_query_count_total",
-				Help: "Total number of sql_queries executed.",
-			},
-		),
-		sqlQueryDuration: prometheus.NewHistogram(
-			prometheus.HistogramOpts{
-				Name: "storage_bigquery_sql_query_duration_seconds",
-				Help: "Duration of the sql reads from BigQuery.",
-			},
-		),
+		if c.spillRows(batch, err) {
+			c.aggregator.add(batch)
+			return nil
+		}
+		return &WriteError{FailedSamples: len(batch), Errors: []error{err}}
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.writeTimeout)
+	defer cancel()
+	results := c.insertChunks(ctx, batch)
+	err = writeError(results)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		c.cancelledOperations.WithLabelValues("write").Inc()
+	}
+	done(err)
+	if err != nil && c.spill != nil {
+		c.spillResults(results)
+		err = writeError(results)
 	}
+	if err == nil {
+		// Failed writes are retried by Prometheus, their samples are aggregated then.
+		c.aggregator.add(batch)
+	}
+	return err
 }
 
-// Item represents a row item.
-type Item struct {
-	value      float64 `bigquery:"value"`
-	metricname string  `bigquery:"metricname"`
-	timestamp  int64   `bigquery:"timestamp"`
-	tags       string  `bigquery:"tags"`
+// staleNaN is the bit pattern of the NaN value Prometheus writes as staleness marker when
+// a series disappears.
+const staleNaN uint64 = 0x7ff0000000000002
+
+// isStaleMarker returns whether the value is a staleness marker.
+func isStaleMarker(v float64) bool {
+	return math.Float64bits(v) == staleNaN
 }
 
-// Save implements the ValueSaver interface.
-func (i *Item) Save() (map[string]bigquery.Value, string, error) {
-	return map[string]bigquery.Value{
-		"value":      i.value,
-		"metricname": i.metricname,
-		"timestamp":  i.timestamp,
-		"tags":       i.tags,
-	}, "", nil
+// sampleWindow is the range of timestamps, in milliseconds, of the samples which may be
+// written.
+type sampleWindow struct {
+	min, max int64
+	// now is the timestamp clamped samples are written with.
+	now int64
 }
 
-// tagsFromMetric extracts tags from a Prometheus MetricNameLabel.
-func tagsFromMetric(m model.Metric) string {
-	tags := make(map[string]interface{}, len(m)-1)
-	for l, v := range m {
-		if l != model.MetricNameLabel {
-			tags[string(l)] = string(v)
-		}
+// unlimitedWindow accepts samples of any timestamp.
+var unlimitedWindow = sampleWindow{min: math.MinInt64, max: math.MaxInt64}
+
+// sampleWindow returns the window of the samples which may be written at the given time.
+func (c *BigqueryClient) sampleWindow(now time.Time) sampleWindow {
+	w := unlimitedWindow
+	w.now = now.UnixMilli()
+	if c.maxSampleAge > 0 {
+		w.min = now.Add(-c.maxSampleAge).UnixMilli()
 	}
-	tagsmarshaled, _ := json.Marshal(tags)
-	return string(tagsmarshaled)
+	if c.maxFutureSkew > 0 {
+		w.max = now.Add(c.maxFutureSkew).UnixMilli()
+	}
+	return w
 }
 
-// Write sends a batch of samples to BigQuery via the client.
-func (c *BigqueryClient) Write(timeseries []*prompb.TimeSeries) error {
-	inserter := c.client.Dataset(c.datasetID).Table(c.tableID).Inserter()
-	inserter.SkipInvalidRows = true
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
-	batch := make([]*Item, 0, len(timeseries))
+// dropSample counts a sample which isn't written for the reason. The deprecated ignored
+// samples counter is kept as the sum of all reasons.
+func (c *BigqueryClient) dropSample(reason string) {
+	c.droppedSamples.WithLabelValues(reason).Inc()
+	c.ignoredSamples.Inc()
+}
 
+// buildBatch converts the timeseries into rows, skipping unsupported values. A non-empty
+// tenant replaces the tenant label of every series. Samples outside of the window are
+// dropped, clamped or fail the batch, depending on the configured behaviors. The window
+// is compared with the millisecond timestamps of the samples.
+func (c *BigqueryClient) buildBatch(ctx context.Context, timeseries []*prompb.TimeSeries, tenant string, window sampleWindow) ([]*Item, error) {
+	samples := 0
+	for _, ts := range timeseries {
+		samples += len(ts.Samples)
+	}
+	// All rows are allocated at once instead of one by one.
+	items := make([]Item, samples)
+	batch := make([]*Item, 0, samples)
+	// Only a single warning is logged per batch for oversized rows.
+	var oversized string
+	oversizedSeries := 0
+	defer func() {
+		if oversizedSeries > 0 {
+			c.logger.WarnContext(ctx, "rows exceed the maximum row size", slog.String("metric", oversized),
+				slog.Int("series", oversizedSeries), slog.Int("max_row_size", c.maxRowSize), slog.String("behavior", c.oversizeBehavior))
+		}
+	}()
+
+	converter := c.newSeriesConverter(tenant, len(timeseries))
+	// Series which only differ in dropped labels are written as the same series, of their
+	// samples with the same timestamp only the first one of the request is kept.
+	var written map[seriesSample]bool
+	if c.dropsLabels() {
+		written = make(map[seriesSample]bool, samples)
+	}
 	for i := range timeseries {
 		ts := timeseries[i]
 		samples := ts.Samples
 		c.recordsFetched.Add(float64(len(samples)))
-		metric := make(model.Metric, len(ts.Labels))
-		for _, l := range ts.Labels {
-			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		series := converter.convert(ts)
+		c.droppedLabels.Add(float64(series.droppedLabels))
+		if series.oversized {
+			if oversizedSeries == 0 {
+				oversized = series.name
+			}
+			oversizedSeries++
+		}
+		if series.dropped {
+			for range samples {
+				c.dropSample("row_too_large")
+			}
+			continue
 		}
-
-		t := tagsFromMetric(metric)
 
 		for _, s := range samples {
 			v := float64(s.Value)
-			if math.IsNaN(v) || math.IsInf(v, 0) {
-				c.logger.Debug("cannot send to bigquery, skipping sample", slog.Any("value", v), slog.Any("sample", s))
-				c.ignoredSamples.Inc()
+			stale := isStaleMarker(v)
+			if stale && !c.storeStaleMarkers {
+				c.dropSample("stale_marker")
+				continue
+			}
+			special := ""
+			if !stale && c.specialValues {
+				special = specialValue(v)
+			}
+			if !stale && special == "" && (math.IsNaN(v) || math.IsInf(v, 0)) {
+				c.logger.DebugContext(ctx, "cannot send to bigquery, skipping sample", slog.Any("value", v), slog.Any("sample", s))
+				if math.IsNaN(v) {
+					c.dropSample("nan")
+				} else {
+					c.dropSample("inf")
+				}
+				continue
+			}
+			timestamp := s.Timestamp
+			if timestamp < window.min {
+				if c.rejectOldSamples {
+					return nil, errors.Wrapf(ErrSampleTooOld, "sample of %s at %s is older than %s",
+						series.name, model.Time(s.Timestamp).Time().UTC().Format(time.RFC3339), c.maxSampleAge)
+				}
+				c.dropSample("too_old")
 				continue
 			}
+			if timestamp > window.max {
+				switch c.futureBehavior {
+				case FutureSampleReject:
+					return nil, errors.Wrapf(ErrSampleTooNew, "sample of %s at %s is more than %s in the future",
+						series.name, model.Time(s.Timestamp).Time().UTC().Format(time.RFC3339), c.maxFutureSkew)
+				case FutureSampleClamp:
+					timestamp = window.now
+				default:
+					c.dropSample("future")
+					continue
+				}
+			}
+
+			if written != nil {
+				key := seriesSample{name: series.name, tags: series.tags, timestamp: timestamp}
+				if written[key] {
+					c.dropSample("duplicate_series")
+					continue
+				}
+				written[key] = true
+			}
 
-			batch = append(batch, &Item{
+			item := &items[len(batch)]
+			*item = Item{
 				value:      v,
-				metricname: string(metric[model.MetricNameLabel]),
-				timestamp:  model.Time(s.Timestamp).Unix(),
-				tags:       t,
-			})
+				metricname: series.name,
+				timestamp:  model.Time(timestamp).Unix(),
+				tags:       series.tags,
+				labels:     series.labels,
+				stale:      stale,
+				special:    special,
+				seriesHash: series.hash,
+				insertTime: c.insertTime,
+			}
+			if c.timestampMillis() {
+				item.timestampMs = timestamp
+			}
+			if special != "" {
+				item.value = 0
+			}
+			if c.deduplicate {
+				item.insertID = insertID(item.metricname, item.tags, timestamp, v)
+			}
+			batch = append(batch, item)
 		}
 	}
+	return batch, nil
+}
 
-	begin := time.Now()
-	if err := inserter.Put(ctx, batch); err != nil {
-		if multiError, ok := err.(bigquery.PutMultiError); ok {
-			for _, err1 := range multiError {
-				for _, err2 := range err1.Errors {
-					fmt.Println(err2)
-				}
+// insertResult is the outcome of the insert of one chunk of a batch. sent is the number
+// of written rows, rows are the rows which weren't written because of err.
+type insertResult struct {
+	dest *destination
+	sent int
+	rows []*Item
+	err  error
+}
+
+// insert writes the batch to BigQuery, split by destination table and into chunks
+// according to the configured limits.
+func (c *BigqueryClient) insert(ctx context.Context, batch []*Item) error {
+	return writeError(c.insertChunks(ctx, batch))
+}
+
+// writeError returns a WriteError with the failed chunks of the results, or nil if all
+// chunks were written.
+func writeError(results []insertResult) error {
+	var writeErr *WriteError
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		if writeErr == nil {
+			writeErr = &WriteError{}
+		}
+		writeErr.FailedSamples += len(r.rows)
+		writeErr.Errors = append(writeErr.Errors, r.err)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	return nil
+}
+
+// insertChunks writes the chunks of the batch and returns the result of every chunk.
+func (c *BigqueryClient) insertChunks(ctx context.Context, batch []*Item) []insertResult {
+	dests, groups := c.routeBatch(batch)
+	chunks := 0
+	results := make(chan insertResult, len(batch))
+	for i, dest := range dests {
+		for _, chunk := range splitBatch(groups[i], c.maxRowsPerInsert, c.maxBytesPerInsert) {
+			chunks++
+			put := func() {
+				sent, failed, err := c.put(ctx, dest, chunk)
+				results <- insertResult{dest: dest, sent: sent, rows: failed, err: err}
+			}
+			if c.pool == nil {
+				put()
+				continue
+			}
+			if err := c.pool.submit(put); err != nil {
+				c.backpressureSamples.WithLabelValues("queue").Add(float64(len(chunk)))
+				results <- insertResult{dest: dest, rows: chunk, err: err}
 			}
 		}
-		return err
 	}
-	duration := time.Since(begin).Seconds()
-	c.batchWriteDuration.Observe(duration)
 
+	collected := make([]insertResult, 0, chunks)
+	for i := 0; i < chunks; i++ {
+		r := <-results
+		c.tableSentSamples.WithLabelValues(r.dest.name()).Add(float64(r.sent))
+		if r.err != nil {
+			c.tableFailedSamples.WithLabelValues(r.dest.name()).Add(float64(len(r.rows)))
+		}
+		collected = append(collected, r)
+	}
+	c.writeHealth.record(writeError(collected))
+	return collected
+}
+
+// flush writes rows taken from the asynchronous write buffer.
+func (c *BigqueryClient) flush(rows []*Item, reason string) {
+	c.bufferFlushes.WithLabelValues(reason).Inc()
+	c.bufferFlushRows.Observe(float64(len(rows)))
+	ctx, cancel := context.WithTimeout(context.Background(), c.writeTimeout)
+	defer cancel()
+	results := c.insertChunks(ctx, rows)
+	c.spillResults(results)
+	c.deadLetterResults(results)
+	if err := writeError(results); err != nil {
+		failed := len(rows)
+		var writeErr *WriteError
+		if errors.As(err, &writeErr) {
+			failed = writeErr.FailedSamples
+		}
+		c.logger.Warn("error flushing buffered samples to bigquery", slog.Any("error", err), slog.Any("num_samples", len(rows)), slog.Any("failed_samples", failed))
+		c.bufferFailedSamples.Add(float64(failed))
+	}
+}
+
+// newInserter returns an inserter into the table configured with the insert options of the client.
+func (c *BigqueryClient) newInserter(table tableRef) Inserter {
+	return &tableInserter{table: table, skipInvalidRows: c.skipInvalidRows, ignoreUnknownValues: c.ignoreUnknownValues}
+}
+
+// logRowErrors logs the first rejected rows of an insert and counts all of them by reason.
+func (c *BigqueryClient) logRowErrors(ctx context.Context, chunk []*Item, multiError bigquery.PutMultiError) {
+	logged := 0
+	for _, rowErr := range multiError {
+		reason, location, message := rowErrorReason(rowErr), "", ""
+		errorReason := insertErrorOther
+		if len(rowErr.Errors) > 0 {
+			message = rowErr.Errors[0].Error()
+			if bqErr, ok := rowErr.Errors[0].(*bigquery.Error); ok {
+				location, message = bqErr.Location, bqErr.Message
+			}
+			errorReason = insertErrorReason(rowErr.Errors[0])
+		}
+		c.insertRowErrors.WithLabelValues(reason).Inc()
+		c.insertErrors.WithLabelValues(errorReason).Inc()
+
+		if logged >= c.maxLoggedRowErrors {
+			continue
+		}
+		logged++
+		metricname := ""
+		if rowErr.RowIndex >= 0 && rowErr.RowIndex < len(chunk) {
+			metricname = chunk[rowErr.RowIndex].metricname
+		}
+		c.logger.WarnContext(ctx, "bigquery rejected row",
+			slog.Any("row_index", rowErr.RowIndex),
+			slog.Any("metricname", metricname),
+			slog.Any("reason", reason),
+			slog.Any("location", location),
+			slog.Any("message", message))
+	}
+	if suppressed := len(multiError) - logged; suppressed > 0 {
+		c.logger.WarnContext(ctx, "bigquery rejected more rows", slog.Any("count", suppressed), slog.Any("logged", logged))
+	}
+}
+
+// rowErrorReason returns the reason of the first error of the row, or unknown.
+func rowErrorReason(rowErr bigquery.RowInsertionError) string {
+	if len(rowErr.Errors) > 0 {
+		if bqErr, ok := rowErr.Errors[0].(*bigquery.Error); ok && bqErr.Reason != "" {
+			return bqErr.Reason
+		}
+	}
+	return "unknown"
+}
+
+// Close flushes any buffered or coalesced samples and stops the background flusher,
+// the replay of spilled samples and the enforcement of the retention. With load job
+// writes it loads the staged rows.
+func (c *BigqueryClient) Close() error {
+	if c.buffer != nil {
+		c.buffer.close()
+	}
+	if c.coalescer != nil {
+		c.coalescer.close()
+	}
+	if c.spill != nil {
+		c.spill.close()
+	}
+	if c.stager != nil {
+		c.stager.close()
+	}
+	if c.deadLetter != nil {
+		c.deadLetter.close()
+	}
+	if c.aggregator != nil {
+		c.aggregator.close()
+	}
+	c.stopRetention()
+	c.stopKeyRotation()
 	return nil
 }
 
+// flushAggregates writes the aggregated rows to the aggregate table.
+func (c *BigqueryClient) flushAggregates(rows []*aggregateRow) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.writeTimeout)
+	defer cancel()
+	for _, chunk := range splitBatch(rows, c.maxRowsPerInsert, c.maxBytesPerInsert) {
+		if c.writeDryRun {
+			c.logger.Debug("dry run, not writing aggregated rows to bigquery", slog.Any("table", c.aggregateTable), slog.Int("rows", len(chunk)))
+			c.aggregateFlushed.Add(float64(len(chunk)))
+			continue
+		}
+		err := c.aggregateInserter.Put(ctx, chunk)
+		if err == nil {
+			c.aggregateFlushed.Add(float64(len(chunk)))
+			continue
+		}
+		failed := len(chunk)
+		var multiError bigquery.PutMultiError
+		if errors.As(err, &multiError) {
+			failed = len(multiError)
+		}
+		c.logger.Warn("error writing aggregated samples to bigquery", slog.Any("error", err), slog.Any("table", c.aggregateTable), slog.Any("rows", len(chunk)), slog.Any("failed_rows", failed))
+		c.aggregateFlushed.Add(float64(len(chunk) - failed))
+		c.aggregateFailed.Add(float64(failed))
+	}
+}
+
+// put inserts a single chunk of rows. When BigQuery rejects some of the rows, the rows
+// rejected for a permanent reason are dropped and only the others are inserted again,
+// up to the configured number of row retries. It returns the number of written rows and
+// the rows which weren't written.
+func (c *BigqueryClient) put(ctx context.Context, dest *destination, chunk []*Item) (int, []*Item, error) {
+	size := 0
+	for _, item := range chunk {
+		size += item.estimatedSize()
+	}
+	ctx, span := tracing.GetTracer().Start(ctx, "bigquery.insert", trace.WithAttributes(
+		attribute.Int("bigquery.rows", len(chunk)),
+		attribute.Int("bigquery.estimated_bytes", size),
+		attribute.String("bigquery.dataset", dest.datasetID),
+		attribute.String("bigquery.table", dest.tableID),
+	))
+	defer span.End()
+
+	inserter := dest.inserter
+	if inserter == nil {
+		inserter = c.inserter
+	}
+	if c.writeDryRun {
+		c.logDryRun(ctx, chunk, size)
+		c.recordWritten(chunk, 0)
+		return len(chunk), nil, nil
+	}
+	if dest.shard && c.createTable {
+		if err := c.createShard(ctx, dest); err != nil {
+			span.RecordError(err)
+			return 0, chunk, err
+		}
+	}
+	rows := chunk
+	sent := 0
+	for attempt := 0; ; attempt++ {
+		begin := time.Now()
+		err := inserter.Put(ctx, rows)
+		duration := time.Since(begin)
+		if err == nil {
+			c.recordWritten(rows, duration)
+			return sent + len(rows), nil, nil
+		}
+		var multiError bigquery.PutMultiError
+		if !errors.As(err, &multiError) {
+			c.insertErrors.WithLabelValues(insertErrorReason(err)).Inc()
+			err = timeoutError(ctx, err, "write", c.writeTimeout)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return sent, rows, err
+		}
+		c.logRowErrors(ctx, rows, multiError)
+		written, retry := c.partitionRows(dest, rows, multiError)
+		c.recordWritten(written, duration)
+		sent += len(written)
+		if len(retry) == 0 {
+			return sent, nil, nil
+		}
+		if attempt >= c.rowRetries {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return sent, retry, err
+		}
+		select {
+		case <-time.After(c.rowRetryBackoff << attempt):
+		case <-ctx.Done():
+			err = timeoutError(ctx, ctx.Err(), "write", c.writeTimeout)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return sent, retry, err
+		}
+		c.retriedRows.Add(float64(len(retry)))
+		rows = retry
+	}
+}
+
+// permanentRowErrors are the reasons of rows BigQuery will reject again when they are
+// inserted again, so they are dropped instead. Rows reported as stopped are valid rows
+// of an insert BigQuery refused because of invalid rows, they succeed once retried alone.
+var permanentRowErrors = map[string]bool{"invalid": true}
+
+// partitionRows splits the rows of a partially failed insert into the written rows and
+// the rows to insert again. Rows rejected for a permanent reason are dropped, and stored
+// in the dead-letter sink if there is one.
+func (c *BigqueryClient) partitionRows(dest *destination, rows []*Item, multiError bigquery.PutMultiError) (written, retry []*Item) {
+	reasons := make(map[int]string, len(multiError))
+	rowErrors := make(map[int]error, len(multiError))
+	for _, rowErr := range multiError {
+		if _, ok := reasons[rowErr.RowIndex]; !ok {
+			reasons[rowErr.RowIndex] = rowErrorReason(rowErr)
+			rowErrors[rowErr.RowIndex] = rowErr.Errors
+		}
+	}
+	for i, item := range rows {
+		reason, failed := reasons[i]
+		switch {
+		case !failed:
+			written = append(written, item)
+		case permanentRowErrors[reason]:
+			c.droppedSamples.WithLabelValues("rejected_" + reason).Inc()
+			c.ignoredSamples.Inc()
+			c.deadLetterRows(dest.name(), []*Item{item}, "rejected_"+reason, rowErrors[i])
+		default:
+			retry = append(retry, item)
+		}
+	}
+	return written, retry
+}
+
+// recordWritten updates the metrics of the written rows.
+func (c *BigqueryClient) recordWritten(rows []*Item, duration time.Duration) {
+	if len(rows) == 0 {
+		return
+	}
+	size := 0
+	for _, item := range rows {
+		size += item.estimatedSize()
+	}
+	c.batchWriteDuration.Observe(duration.Seconds())
+	c.writtenBytes.Add(float64(size))
+	c.writtenRows.Add(float64(len(rows)))
+	c.insertBatchRows.Observe(float64(len(rows)))
+	c.metricSamples.add(rows)
+}
+
 // Name identifies the client as a BigQuery client.
-func (c BigqueryClient) Name() string {
-	return "bigquerydb"
+func (c *BigqueryClient) Name() string {
+	return c.name
 }
 
 // Describe implements prometheus.Collector.
 func (c *BigqueryClient) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.ignoredSamples.Desc()
+	c.droppedSamples.Describe(ch)
+	ch <- c.droppedLabels.Desc()
 	ch <- c.recordsFetched.Desc()
 	ch <- c.sqlQueryCount.Desc()
 	ch <- c.sqlQueryDuration.Desc()
+	ch <- c.readSamples.Desc()
+	ch <- c.readBytesProcessed.Desc()
+	ch <- c.readEstimatedBytes.Desc()
+	ch <- c.queryBytesProcessed.Desc()
+	ch <- c.querySlotSeconds.Desc()
+	ch <- c.queryCacheHits.Desc()
+	ch <- c.readRangeTruncated.Desc()
+	ch <- c.slowQueries.Desc()
+	ch <- c.duplicateSamples.Desc()
+	ch <- c.skippedRows.Desc()
+	ch <- c.readPages.Desc()
+	ch <- c.readPageWait.Desc()
+	ch <- c.readCacheHits.Desc()
+	ch <- c.readCacheMisses.Desc()
+	ch <- c.readCacheEntries.Desc()
+	c.readQueries.Describe(ch)
+	ch <- c.readSplits.Desc()
+	c.readSplitQueries.Describe(ch)
+	c.resolutionQueries.Describe(ch)
+	c.cancelledOperations.Describe(ch)
+	ch <- c.cancelledQueries.Desc()
+	c.tableSentSamples.Describe(ch)
+	c.metricSamples.vec.Describe(ch)
+	c.tableFailedSamples.Describe(ch)
+	c.breakerState.Describe(ch)
+	c.breakerTransitions.Describe(ch)
+	c.credentialReloads.Describe(ch)
+	ch <- c.maxBytesBilledGauge.Desc()
 	ch <- c.batchWriteDuration.Desc()
+	ch <- c.writeLag.Desc()
+	ch <- c.writtenBytes.Desc()
+	ch <- c.writtenRows.Desc()
+	ch <- c.insertBatchRows.Desc()
+	ch <- c.activeInserts.Desc()
+	ch <- c.insertQueueDepth.Desc()
+	ch <- c.bufferedSamples.Desc()
+	ch <- c.bufferOldestAge.Desc()
+	ch <- c.bufferedBytes.Desc()
+	c.bufferFlushes.Describe(ch)
+	ch <- c.bufferFlushRows.Desc()
+	c.backpressureSamples.Describe(ch)
+	ch <- c.bufferFailedSamples.Desc()
+	c.coalesceFlushes.Describe(ch)
+	ch <- c.coalesceFlushWrites.Desc()
+	ch <- c.coalesceFlushRows.Desc()
+	ch <- c.coalescePendingRows.Desc()
+	ch <- c.coalescePendingBytes.Desc()
+	ch <- c.coalesceOldestAge.Desc()
+	ch <- c.spilledSamples.Desc()
+	ch <- c.spillReplayedSamples.Desc()
+	ch <- c.spillDroppedSamples.Desc()
+	ch <- c.spillCorruptSegments.Desc()
+	ch <- c.spillBytes.Desc()
+	ch <- c.spillSegments.Desc()
+	ch <- c.loadStagedBytes.Desc()
+	c.loadJobs.Describe(ch)
+	ch <- c.loadDelay.Desc()
+	ch <- c.loadQuarantined.Desc()
+	ch <- c.loadPendingObjects.Desc()
+	ch <- c.deadLetteredSamples.Desc()
+	c.deadLetterDropped.Describe(ch)
+	c.insertRowErrors.Describe(ch)
+	c.insertErrors.Describe(ch)
+	ch <- c.retriedRows.Desc()
+	c.readLimitExceeded.Describe(ch)
+	ch <- c.aggregateBuckets.Desc()
+	ch <- c.aggregateFlushed.Desc()
+	ch <- c.aggregateFailed.Desc()
+	ch <- c.aggregateLate.Desc()
+	ch <- c.retentionLastRun.Desc()
+	ch <- c.retentionDeletedRows.Desc()
+	c.writeHealth.Describe(ch)
+	c.readHealth.Describe(ch)
 }
 
 // Collect implements prometheus.Collector.
 func (c *BigqueryClient) Collect(ch chan<- prometheus.Metric) {
 	ch <- c.ignoredSamples
+	c.droppedSamples.Collect(ch)
+	ch <- c.droppedLabels
 	ch <- c.recordsFetched
 	ch <- c.sqlQueryCount
 	ch <- c.sqlQueryDuration
+	ch <- c.readSamples
+	ch <- c.readBytesProcessed
+	ch <- c.readEstimatedBytes
+	ch <- c.queryBytesProcessed
+	ch <- c.querySlotSeconds
+	ch <- c.queryCacheHits
+	ch <- c.readRangeTruncated
+	ch <- c.slowQueries
+	ch <- c.duplicateSamples
+	ch <- c.skippedRows
+	ch <- c.readPages
+	ch <- c.readPageWait
+	ch <- c.readCacheHits
+	ch <- c.readCacheMisses
+	ch <- c.readCacheEntries
+	c.readQueries.Collect(ch)
+	ch <- c.readSplits
+	c.readSplitQueries.Collect(ch)
+	c.resolutionQueries.Collect(ch)
+	c.cancelledOperations.Collect(ch)
+	ch <- c.cancelledQueries
+	c.tableSentSamples.Collect(ch)
+	c.metricSamples.vec.Collect(ch)
+	c.tableFailedSamples.Collect(ch)
+	c.breakerState.Collect(ch)
+	c.breakerTransitions.Collect(ch)
+	c.credentialReloads.Collect(ch)
+	ch <- c.maxBytesBilledGauge
 	ch <- c.batchWriteDuration
+	ch <- c.writeLag
+	ch <- c.writtenBytes
+	ch <- c.writtenRows
+	ch <- c.insertBatchRows
+	ch <- c.activeInserts
+	ch <- c.insertQueueDepth
+	ch <- c.bufferedSamples
+	ch <- c.bufferOldestAge
+	ch <- c.bufferedBytes
+	c.bufferFlushes.Collect(ch)
+	ch <- c.bufferFlushRows
+	c.backpressureSamples.Collect(ch)
+	ch <- c.bufferFailedSamples
+	c.coalesceFlushes.Collect(ch)
+	ch <- c.coalesceFlushWrites
+	ch <- c.coalesceFlushRows
+	ch <- c.coalescePendingRows
+	ch <- c.coalescePendingBytes
+	ch <- c.coalesceOldestAge
+	ch <- c.spilledSamples
+	ch <- c.spillReplayedSamples
+	ch <- c.spillDroppedSamples
+	ch <- c.spillCorruptSegments
+	ch <- c.spillBytes
+	ch <- c.spillSegments
+	ch <- c.loadStagedBytes
+	c.loadJobs.Collect(ch)
+	ch <- c.loadDelay
+	ch <- c.loadQuarantined
+	ch <- c.loadPendingObjects
+	ch <- c.deadLetteredSamples
+	c.deadLetterDropped.Collect(ch)
+	c.insertRowErrors.Collect(ch)
+	c.insertErrors.Collect(ch)
+	ch <- c.retriedRows
+	c.readLimitExceeded.Collect(ch)
+	ch <- c.aggregateBuckets
+	ch <- c.aggregateFlushed
+	ch <- c.aggregateFailed
+	ch <- c.aggregateLate
+	ch <- c.retentionLastRun
+	ch <- c.retentionDeletedRows
+	c.writeHealth.Collect(ch)
+	c.readHealth.Collect(ch)
 }
 
 // Read queries the database and returns the results to Prometheus
-func (c *BigqueryClient) Read(req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
-	tsMap := map[model.Fingerprint]*prompb.TimeSeries{}
+func (c *BigqueryClient) Read(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	done, err := c.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.read(ctx, req)
+	done(err)
+	c.readHealth.record(err)
+	return resp, err
+}
+
+// read runs all queries of the request and merges their results.
+func (c *BigqueryClient) read(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	tenant, err := c.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The limits are read once, so that a read isn't affected by changes while it runs.
+	limits := c.readLimits.Load()
+	rs := limits.newResultSet()
 	for _, q := range req.Queries {
-		command, err := c.buildCommand(q)
+		if c.tenancy {
+			q = tenantQuery(q, tenant)
+		}
+		rs.matchers = formatMatchers(q.Matchers)
+		limited, err := c.limitRange(ctx, limits, q)
+		queryCtx := ctx
+		if err == nil {
+			queryCtx = c.withResolution(ctx, limited)
+			err = c.splitQuery(queryCtx, limits, rs, limited)
+		}
 		if err != nil {
-			return nil, err
+			if limit, ok := ExceededLimit(err); ok {
+				c.readLimitExceeded.WithLabelValues(limit).Inc()
+			}
+			return nil, c.queryError(queryCtx, q, err)
+		}
+	}
+	c.duplicateSamples.Add(float64(rs.sortSamples()))
+	c.readSamples.Observe(float64(rs.samples))
+	resp := rs.response()
+	if c.tenancy {
+		for _, ts := range resp.Results[0].Timeseries {
+			ts.Labels = withoutTenant(ts.Labels)
 		}
+	}
+	return resp, nil
+}
 
-		query := c.client.Query(command)
-		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-		c.sqlQueryCount.Inc()
-		begin := time.Now()
-		iter, err := query.Read(ctx)
-		defer cancel()
+// queryError returns the error of the failed query with its matchers and generated SQL.
+func (c *BigqueryClient) queryError(ctx context.Context, q *prompb.Query, err error) error {
+	command, _, buildErr := c.buildReadCommand(ctx, q)
+	if buildErr != nil {
+		command = ""
+	}
+	return &QueryError{Matchers: formatMatchers(q.Matchers), SQL: command, Err: err}
+}
+
+// query runs a single query and merges its rows into the result set.
+func (c *BigqueryClient) query(ctx context.Context, limits *ReadLimits, rs *resultSet, q *prompb.Query) (err error) {
+	if err := limits.checkMetricName(q); err != nil {
+		return err
+	}
+	command, params, err := c.buildReadCommand(ctx, q)
+	if err != nil {
+		return err
+	}
 
+	datasetID, tableID := c.datasetID, c.tableID
+	if r := resolutionFrom(ctx); r != nil {
+		datasetID, tableID = cmp.Or(r.DatasetID, datasetID), r.TableID
+	}
+	ctx, span := tracing.GetTracer().Start(ctx, "bigquery.query", trace.WithAttributes(
+		attribute.String("bigquery.dataset", datasetID),
+		attribute.String("bigquery.table", tableID),
+		attribute.String("bigquery.sql_hash", sqlHash(command)),
+	))
+	stats := recordQuery(ctx, command, params)
+	defer func() {
 		if err != nil {
-			return nil, err
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if errors.Is(ctx.Err(), context.Canceled) {
+				c.cancelledOperations.WithLabelValues("read").Inc()
+			}
 		}
+		span.End()
+	}()
 
-		if err = mergeResult(tsMap, iter); err != nil {
-			return nil, err
+	queryCtx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	if err := c.checkBytesScanned(queryCtx, limits, q, command, params); err != nil {
+		return timeoutError(queryCtx, err, "read", c.readTimeout)
+	}
+	// The slot is taken after the dry run, which doesn't count as a running query, and
+	// the wait for it isn't part of the read timeout.
+	releaseSlot, err := c.queryLimiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer releaseSlot()
+
+	// The connection is held until the rows of the query are merged.
+	conn := c.acquire()
+	defer conn.release()
+	query := c.newQuery(conn, command, params)
+	c.sqlQueryCount.Inc()
+	begin := time.Now()
+	iter, err := c.querier.Read(queryCtx, query)
+	if err != nil {
+		if queryCtx.Err() != nil {
+			c.cancelJob(err)
 		}
-		duration := time.Since(begin).Seconds()
-		c.sqlQueryDuration.Observe(duration)
-		c.logger.Debug("bigquery sql query", slog.Any("rows", iter.TotalRows), slog.Any("duration", duration))
+		return timeoutError(queryCtx, c.translateQueryError(q, err), "read", c.readTimeout)
+	}
+	if iter.IsAccelerated() {
+		c.readQueries.WithLabelValues("storage").Inc()
+	} else {
+		c.readQueries.WithLabelValues("rest").Inc()
 	}
 
-	resp := prompb.ReadResponse{
-		Results: []*prompb.QueryResult{
-			{Timeseries: make([]*prompb.TimeSeries, 0, len(tsMap))},
-		},
+	samples, badRows := rs.samples, rs.badRows
+	rs.skipBadRows, rs.badRowErr = c.skipBadRows, nil
+	// The rows are fetched ahead of their conversion, the fetcher has to be stopped before
+	// the iterator is used for the statistics of the job.
+	rows := newPrefetchIterator(iter, c.readPages, c.readPageWait)
+	err = mergeResult(rs, limits.limitRows(rows, q))
+	rows.stop()
+	if err != nil {
+		if queryCtx.Err() != nil {
+			c.cancelJob(iter)
+		}
+		return timeoutError(queryCtx, err, "read", c.readTimeout)
 	}
-	for _, ts := range tsMap {
-		resp.Results[0].Timeseries = append(resp.Results[0].Timeseries, ts)
+	if skipped := rs.badRows - badRows; skipped > 0 {
+		c.skippedRows.Add(float64(skipped))
+		c.logger.WarnContext(ctx, "skipped rows which can't be converted into samples", slog.Any("rows", skipped), slog.Any("error", rs.badRowErr))
 	}
-	return &resp, nil
+	span.SetAttributes(attribute.Int("bigquery.rows", rs.samples-samples))
+	span.SetAttributes(jobAttributes(iter)...)
+	c.recordJobStatistics(queryCtx, span, iter)
+	stats.finish(iter, rs.samples-samples, time.Since(begin))
+	duration := time.Since(begin).Seconds()
+	c.sqlQueryDuration.Observe(duration)
+	c.logger.DebugContext(ctx, "bigquery sql query", slog.Any("rows", rs.samples-samples), slog.Any("duration", duration))
+	c.logSlowQuery(ctx, limits.SlowQueryThreshold, q, command, iter, rs.samples-samples, time.Since(begin))
+	return nil
 }
 
-// BuildCommand generates the proper SQL for the query
-func (c *BigqueryClient) buildCommand(q *prompb.Query) (string, error) {
-	matchers := make([]string, 0, len(q.Matchers))
-	for _, m := range q.Matchers {
-		// Metric Names
-		if m.Name == model.MetricNameLabel {
-			switch m.Type {
-			case prompb.LabelMatcher_EQ:
-				matchers = append(matchers, fmt.Sprintf("metricname = '%s'", escapeSingleQuotes(m.Value)))
-			case prompb.LabelMatcher_NEQ:
-				matchers = append(matchers, fmt.Sprintf("metricname != '%s'", escapeSingleQuotes(m.Value)))
-			case prompb.LabelMatcher_RE:
-				matchers = append(matchers, fmt.Sprintf("REGEXP_CONTAINS(metricname, r'%s')", escapeSlashes(m.Value)))
-			case prompb.LabelMatcher_NRE:
-				matchers = append(matchers, fmt.Sprintf("not REGEXP_CONTAINS(metricname, r'%s')", escapeSlashes(m.Value)))
-			default:
-				return "", errors.Errorf("unknown match type %v", m.Type)
-			}
-			continue
-		}
+// logSlowQuery logs a query which took longer than the slow query threshold, with its
+// matchers, time range and job to reproduce it. The SQL is only logged with debug
+// logging enabled, like the SQL of every query.
+func (c *BigqueryClient) logSlowQuery(ctx context.Context, threshold time.Duration, q *prompb.Query, command string, iter QueryIterator, rows int, duration time.Duration) {
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+	c.slowQueries.Inc()
+	attrs := []slog.Attr{
+		slog.String("matchers", formatMatchers(q.Matchers)),
+		slog.Time("start", time.UnixMilli(q.StartTimestampMs).UTC()),
+		slog.Time("end", time.UnixMilli(q.EndTimestampMs).UTC()),
+		slog.Duration("duration", duration),
+		slog.Int("rows", rows),
+	}
+	job := queryJob(iter)
+	if job != nil {
+		attrs = append(attrs, slog.String("job_id", job.ID()))
+	}
+	if bytes, ok := bytesProcessed(job); ok {
+		attrs = append(attrs, slog.Int64("bytes_processed", bytes))
+	}
+	if c.logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, slog.String("sql", command))
+	}
+	c.logger.LogAttrs(ctx, slog.LevelWarn, "slow bigquery query", attrs...)
+}
 
-		// Labels
-		switch m.Type {
-		case prompb.LabelMatcher_EQ:
-			matchers = append(matchers, fmt.Sprintf(`IFNULL(JSON_EXTRACT(tags, '$.%s'), '""') = '"%s"'`, m.Name, m.Value))
-		case prompb.LabelMatcher_NEQ:
-			matchers = append(matchers, fmt.Sprintf(`IFNULL(JSON_EXTRACT(tags, '$.%s'), '""') != '"%s"'`, m.Name, m.Value))
-		case prompb.LabelMatcher_RE:
-			matchers = append(matchers, fmt.Sprintf(`REGEXP_CONTAINS(IFNULL(JSON_EXTRACT(tags, '$.%s'), '""'), r'"%s"')`, m.Name, m.Value))
-		case prompb.LabelMatcher_NRE:
-			matchers = append(matchers, fmt.Sprintf(`not REGEXP_CONTAINS(IFNULL(JSON_EXTRACT(tags, '$.%s'), '""'), r'"%s"')`, m.Name, m.Value))
-		default:
-			return "", errors.Errorf("unknown match type %v", m.Type)
-		}
+// cancelJob cancels the job of a query whose results are no longer needed, so that it
+// doesn't keep using slots. The job is that of the iterator reading its results, or of
+// the error the query failed with while its job was still running.
+func (c *BigqueryClient) cancelJob(v interface{}) {
+	canceler, ok := v.(jobCanceler)
+	if err, isErr := v.(error); isErr && !ok {
+		ok = errors.As(err, &canceler)
+	}
+	if !ok {
+		return
+	}
+	// The context of the query is done, the job is cancelled independently of it.
+	ctx, cancel := context.WithTimeout(context.Background(), c.readTimeout)
+	defer cancel()
+	if err := canceler.cancelJob(ctx); err != nil {
+		c.logger.Warn("failed to cancel bigquery query job", slog.String("job_id", canceler.jobID()), slog.Any("error", err))
+		return
 	}
-	matchers = append(matchers, fmt.Sprintf("timestamp >= TIMESTAMP_MILLIS(%v)", q.StartTimestampMs))
-	matchers = append(matchers, fmt.Sprintf("timestamp <= TIMESTAMP_MILLIS(%v)", q.EndTimestampMs))
+	c.cancelledQueries.Inc()
+	c.logger.Info("cancelled bigquery query job", slog.String("job_id", canceler.jobID()))
+}
+
+// sqlHash returns a short hash identifying the generated SQL of a query.
+func sqlHash(command string) string {
+	sum := sha256.Sum256([]byte(command))
+	return hex.EncodeToString(sum[:8])
+}
+
+// jobAttributes returns the id of the job which ran the query. Queries answered without
+// creating a job have none.
+func jobAttributes(iter QueryIterator) []attribute.KeyValue {
+	job := queryJob(iter)
+	if job == nil {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.String("bigquery.job_id", job.ID())}
+}
 
-	query := fmt.Sprintf("SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM %s.%s WHERE %v ORDER BY timestamp", c.datasetID, c.tableID, strings.Join(matchers, " AND "))
-	c.logger.Debug("bigquery read", slog.Any("sql query", query))
+// recordJobStatistics fetches the statistics of the job which ran the query and records the
+// bytes it processed, the slots it used and whether it was answered from the query cache.
+// Statistics which can't be fetched are not recorded, the query succeeded nonetheless.
+func (c *BigqueryClient) recordJobStatistics(ctx context.Context, span trace.Span, iter QueryIterator) {
+	reader, ok := iter.(statisticsReader)
+	if !ok {
+		return
+	}
+	stats, err := reader.jobStatistics(ctx)
+	if err != nil {
+		c.logger.DebugContext(ctx, "failed to fetch the statistics of the bigquery query job", slog.Any("error", err))
+		return
+	}
+	if stats == nil {
+		return
+	}
+	c.readBytesProcessed.Observe(float64(stats.TotalBytesProcessed))
+	c.queryBytesProcessed.Add(float64(stats.TotalBytesProcessed))
+	span.SetAttributes(attribute.Int64("bigquery.total_bytes_processed", stats.TotalBytesProcessed))
+	details, ok := stats.Details.(*bigquery.QueryStatistics)
+	if !ok {
+		return
+	}
+	c.querySlotSeconds.Add(float64(details.SlotMillis) / 1000)
+	if details.CacheHit {
+		c.queryCacheHits.Inc()
+	}
+	span.SetAttributes(
+		attribute.Int64("bigquery.slot_ms", details.SlotMillis),
+		attribute.Bool("bigquery.cache_hit", details.CacheHit),
+	)
+}
 
-	return query, nil
+// bytesProcessed returns the bytes processed by the job, if there is one and BigQuery reported them.
+func bytesProcessed(job *bigquery.Job) (int64, bool) {
+	if job == nil {
+		return 0, false
+	}
+	status := job.LastStatus()
+	if status == nil || status.Statistics == nil {
+		return 0, false
+	}
+	return status.Statistics.TotalBytesProcessed, true
 }
 
-// rowsToTimeseries iterates over the BigQuery data and creates time series for Prometheus
-func mergeResult(tsMap map[model.Fingerprint]*prompb.TimeSeries, iter *bigquery.RowIterator) error {
-	if iter == nil {
+// queryJob returns the job of the query the iterator reads the results of, or nil
+// if the query didn't create a job.
+func queryJob(iter QueryIterator) *bigquery.Job {
+	rowIter, ok := iter.(*bigqueryRowIterator)
+	if !ok {
 		return nil
 	}
-	for {
-		row := make(map[string]bigquery.Value)
-		err := iter.Next(&row)
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return err
-		}
+	if rowIter.job != nil {
+		return rowIter.job
+	}
+	return rowIter.SourceJob()
+}
+
+// logDryRun logs a summary of an insert skipped in dry-run mode.
+func (c *BigqueryClient) logDryRun(ctx context.Context, chunk []*Item, size int) {
+	if !c.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	names := make(map[string]struct{})
+	for _, item := range chunk {
+		names[item.metricname] = struct{}{}
+	}
+	c.logger.DebugContext(ctx, "dry run, not writing rows to bigquery", slog.Int("rows", len(chunk)), slog.Int("estimated_bytes", size), slog.Int("metric_names", len(names)))
+}
+
+// timeoutError adds the timeout that fired to the error if the context exceeded its deadline.
+func timeoutError(ctx context.Context, err error, kind string, timeout time.Duration) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return errors.Wrapf(err, "%s timeout of %s exceeded", kind, timeout)
+}
+
+// newQuery creates the query for the command on the connection with all query settings of
+// the client applied.
+func (c *BigqueryClient) newQuery(conn *connection, command string, params []bigquery.QueryParameter) *bigquery.Query {
+	query := conn.client.Query(command)
+	query.Parameters = params
+	query.Location = c.location
+	query.Priority = c.priority
+	query.MaxBytesBilled = c.maxBytesBilled
+	query.Labels = c.jobLabels
+	return query
+}
 
-		sample, metric, labels, err := rowToSample(row)
+// matcherSQL returns the condition for a single matcher, which compares against the
+// named query parameter, and the value of that parameter. Matchers which match every
+// row have the condition matchAllSQL, matchers which match no row matchNothingSQL,
+// neither has a parameter.
+func matcherSQL(m *prompb.LabelMatcher, param string) (string, interface{}, error) {
+	column := "metricname"
+	if m.Name != model.MetricNameLabel {
+		var err error
+		column, err = labelValueSQL(m.Name)
 		if err != nil {
-			return err
+			return "", nil, err
 		}
+	}
+	return compareSQL(column, m, param)
+}
 
-		fp := metric.Fingerprint()
-		ts, ok := tsMap[fp]
-		if !ok {
-			ts = &prompb.TimeSeries{Labels: labels}
-			tsMap[fp] = ts
+// compareSQL returns the condition comparing the column with the value of the matcher,
+// which is passed as the named query parameter, and the value of that parameter. Regex
+// matchers equivalent to comparisons, see analyzeRegex, are compared without a regex.
+func compareSQL(column string, m *prompb.LabelMatcher, param string) (string, interface{}, error) {
+	switch m.Type {
+	case prompb.LabelMatcher_EQ:
+		return fmt.Sprintf("%s = @%s", column, param), m.Value, nil
+	case prompb.LabelMatcher_NEQ:
+		return fmt.Sprintf("%s != @%s", column, param), m.Value, nil
+	case prompb.LabelMatcher_RE, prompb.LabelMatcher_NRE:
+		// BigQuery uses RE2 like Go, so patterns it can't handle are rejected up front
+		// with a clear error instead of failing the query.
+		pattern := anchorRegex(m.Value)
+		if _, err := regexp.Compile(pattern); err != nil {
+			return "", nil, errors.Wrapf(err, "invalid regex %q for label %s", m.Value, m.Name)
+		}
+		negated := m.Type == prompb.LabelMatcher_NRE
+		kind, values := analyzeRegex(m.Value)
+		switch {
+		case kind == regexAny && negated:
+			return matchNothingSQL, nil, nil
+		case kind == regexAny:
+			return matchAllSQL, nil, nil
+		case kind == regexNonEmpty && negated:
+			return fmt.Sprintf("%s = @%s", column, param), "", nil
+		case kind == regexNonEmpty:
+			return fmt.Sprintf("%s != @%s", column, param), "", nil
+		case kind == regexLiterals && len(values) == 1 && negated:
+			return fmt.Sprintf("%s != @%s", column, param), values[0], nil
+		case kind == regexLiterals && len(values) == 1:
+			return fmt.Sprintf("%s = @%s", column, param), values[0], nil
+		case kind == regexLiterals && negated:
+			return fmt.Sprintf("%s NOT IN UNNEST(@%s)", column, param), values, nil
+		case kind == regexLiterals:
+			return fmt.Sprintf("%s IN UNNEST(@%s)", column, param), values, nil
+		case negated:
+			return fmt.Sprintf("not REGEXP_CONTAINS(%s, @%s)", column, param), pattern, nil
 		}
-		ts.Samples = append(ts.Samples, sample)
+		return fmt.Sprintf("REGEXP_CONTAINS(%s, @%s)", column, param), pattern, nil
+	default:
+		return "", nil, errors.Errorf("unknown match type %v", m.Type)
 	}
-
-	return nil
 }
 
-// rowToSample converts a BigQuery row to a sample and also processes the labels for later consumption
-func rowToSample(row map[string]bigquery.Value) (prompb.Sample, model.Metric, []*prompb.Label, error) {
-	var v interface{}
-	labelsJSON := row["tags"].(string)
-	err := json.Unmarshal([]byte(labelsJSON), &v)
+// labelValueSQL returns the value of a label from the tags of a row. Like in Prometheus,
+// a missing label is the same as a label with an empty value, so both evaluate to an empty string.
+// Otherwise a missing label would be NULL, which never matches any condition.
+func labelValueSQL(name string) (string, error) {
+	path, err := jsonPath(name)
 	if err != nil {
-		return prompb.Sample{}, nil, nil, err
-	}
-	labels := v.(map[string]interface{})
-	labelPairs := make([]*prompb.Label, 0, len(labels))
-	metric := model.Metric{}
-	for name, value := range labels {
-		labelPairs = append(labelPairs, &prompb.Label{
-			Name:  name,
-			Value: value.(string),
-		})
-		metric[model.LabelName(name)] = model.LabelValue(value.(string))
+		return "", err
 	}
-	labelPairs = append(labelPairs, &prompb.Label{
-		Name:  model.MetricNameLabel,
-		Value: row["metricname"].(string),
-	})
-	// Make sure we sort the labels, so the test cases won't blow up
-	sort.Slice(labelPairs, func(i, j int) bool { return labelPairs[i].Name < labelPairs[j].Name })
-	metric[model.LabelName(model.MetricNameLabel)] = model.LabelValue(row["metricname"].(string))
-	return prompb.Sample{Timestamp: row["timestamp"].(int64), Value: row["value"].(float64)}, metric, labelPairs, nil
+	return fmt.Sprintf("IFNULL(JSON_VALUE(tags, '%s'), '')", path), nil
 }
 
-func escapeSingleQuotes(str string) string {
-	return strings.Replace(str, `'`, `\'`, -1)
+// jsonPath returns the JSONPath of the label in the tags. The name is quoted, so label
+// names which are not identifiers like host.name, label-with-dash or UTF-8 names work.
+// The path is part of the SQL, which is why names with quotes, backslashes or control
+// characters, which can't be represented safely, are rejected.
+func jsonPath(name string) (string, error) {
+	if name == "" || !utf8.ValidString(name) {
+		return "", errors.Errorf("invalid label name %q", name)
+	}
+	for _, r := range name {
+		if r == '"' || r == '\'' || r == '\\' || unicode.IsControl(r) {
+			return "", errors.Errorf("unsupported character %q in label name %q", r, name)
+		}
+	}
+	return `$."` + name + `"`, nil
 }
 
-func escapeSlashes(str string) string {
-	return strings.Replace(str, `/`, `\/`, -1)
+// anchorRegex anchors the pattern at both ends, as Prometheus does for regex matchers,
+// while REGEXP_CONTAINS looks for a match anywhere in the value. Like in Prometheus 3,
+// . matches line breaks too.
+func anchorRegex(pattern string) string {
+	return "^(?s:" + pattern + ")$"
 }
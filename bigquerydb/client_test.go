@@ -16,12 +16,15 @@ limitations under the License.
 package bigquerydb
 
 import (
+	"context"
 	"log/slog"
 	"math"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 )
@@ -95,10 +98,17 @@ func TestLabelMatchers(t *testing.T) {
 		"emptyResult": {},
 	}
 
-	bqclient := NewClient(logger, "", googleProjectID, googleAPIdatasetID, googleAPItableID, bigQueryClientTimeout)
+	bqclient, err := NewClient(logger, "", googleProjectID, googleAPIdatasetID, googleAPItableID, bigQueryClientTimeout)
+	if err != nil {
+		t.Fatal("error creating client", err)
+	}
+	storageClient, err := NewClient(logger, "", googleProjectID, googleAPIdatasetID, googleAPItableID, bigQueryClientTimeout, WithStorageReadAPI(true))
+	if err != nil {
+		t.Fatal("error creating storage read client", err)
+	}
 
 	for _, timeseries := range timeseriesData {
-		err := bqclient.Write(timeseries)
+		err := bqclient.Write(context.Background(), timeseries)
 		if err != nil {
 			t.Fatal("error sending samples", err)
 		}
@@ -138,11 +148,43 @@ func TestLabelMatchers(t *testing.T) {
 					},
 				},
 			}
-			result, err := bqclient.Read(&request)
+			result, err := bqclient.Read(context.Background(), &request)
 
 			assert.Nil(t, err, "failed to process query")
 			assert.Len(t, result.Results, 1)
 			assert.Equal(t, timeseriesData[testCase.expectedResult], result.Results[0].Timeseries)
+
+			storageResult, err := storageClient.Read(context.Background(), &request)
+			assert.Nil(t, err, "failed to process query with the storage read api")
+			assert.Equal(t, result, storageResult)
 		})
 	}
 }
+
+func TestQueryJobStatistics(t *testing.T) {
+	bqclient, err := NewClient(logger, "", googleProjectID, googleAPIdatasetID, googleAPItableID, bigQueryClientTimeout)
+	if err != nil {
+		t.Fatal("error creating client", err)
+	}
+
+	// The time range makes the query unique, so that it isn't answered from the query cache.
+	nowUnix := time.Now().UnixMilli()
+	_, err = bqclient.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: nowUnix - 60000,
+		EndTimestampMs:   nowUnix,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "first_metric"}},
+	}}})
+	assert.Nil(t, err, "failed to process query")
+
+	assert.Greater(t, counterValue(t, bqclient.queryBytesProcessed), 0.0)
+	assert.Greater(t, counterValue(t, bqclient.querySlotSeconds), 0.0)
+	assert.Zero(t, counterValue(t, bqclient.queryCacheHits))
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	var out dto.Metric
+	if err := c.Write(&out); err != nil {
+		t.Fatal("error reading counter", err)
+	}
+	return out.GetCounter().GetValue()
+}
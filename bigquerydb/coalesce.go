@@ -0,0 +1,235 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons a coalesced flush was started for.
+const (
+	coalesceReasonRows     = "rows"
+	coalesceReasonBytes    = "bytes"
+	coalesceReasonDelay    = "delay"
+	coalesceReasonShutdown = "shutdown"
+)
+
+// coalescedWrite is the batch of a single Write waiting to be flushed together with
+// the batches of other writes. err is set and done closed once the flush completed.
+type coalescedWrite struct {
+	batch []*Item
+	err   error
+	done  chan struct{}
+}
+
+// coalescer collects the batches of concurrent writes and hands them to flush together,
+// either when maxRows rows or maxBytes bytes are pending or when the oldest pending
+// write has waited for maxDelay.
+type coalescer struct {
+	mu         sync.Mutex
+	pending    []*coalescedWrite
+	rows       int
+	bytes      int
+	oldest     time.Time
+	generation int
+	timer      *time.Timer
+	closed     bool
+	maxRows    int
+	maxBytes   int
+	maxDelay   time.Duration
+	flush      func([]*coalescedWrite, string)
+	flushing   sync.WaitGroup
+}
+
+func newCoalescer(maxRows, maxBytes int, maxDelay time.Duration, flush func([]*coalescedWrite, string)) *coalescer {
+	return &coalescer{
+		maxRows:  maxRows,
+		maxBytes: maxBytes,
+		maxDelay: maxDelay,
+		flush:    flush,
+	}
+}
+
+// add queues the batch for the next flush. After close, the batch is flushed on its own.
+func (co *coalescer) add(batch []*Item) *coalescedWrite {
+	w := &coalescedWrite{batch: batch, done: make(chan struct{})}
+	size := 0
+	for _, item := range batch {
+		size += item.estimatedSize()
+	}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	co.pending = append(co.pending, w)
+	co.rows += len(batch)
+	co.bytes += size
+	switch {
+	case co.closed:
+		co.flushPending(coalesceReasonShutdown)
+	case co.maxRows > 0 && co.rows >= co.maxRows:
+		co.flushPending(coalesceReasonRows)
+	case co.maxBytes > 0 && co.bytes >= co.maxBytes:
+		co.flushPending(coalesceReasonBytes)
+	case len(co.pending) == 1:
+		co.oldest = time.Now()
+		generation := co.generation
+		co.timer = time.AfterFunc(co.maxDelay, func() { co.expire(generation) })
+	}
+	return w
+}
+
+// expire flushes the pending writes if the timer of the given generation is still current.
+func (co *coalescer) expire(generation int) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	if generation == co.generation && len(co.pending) > 0 {
+		co.flushPending(coalesceReasonDelay)
+	}
+}
+
+// flushPending hands the pending writes to flush in the background. It is called with
+// the lock held.
+func (co *coalescer) flushPending(reason string) {
+	writes := co.pending
+	co.pending = nil
+	co.rows = 0
+	co.bytes = 0
+	co.generation++
+	if co.timer != nil {
+		co.timer.Stop()
+		co.timer = nil
+	}
+	co.flushing.Add(1)
+	go func() {
+		defer co.flushing.Done()
+		co.flush(writes, reason)
+	}()
+}
+
+// pendingRows returns the number of rows of the pending writes.
+func (co *coalescer) pendingRows() int {
+	if co == nil {
+		return 0
+	}
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return co.rows
+}
+
+// pendingBytes returns the estimated size of the rows of the pending writes.
+func (co *coalescer) pendingBytes() int {
+	if co == nil {
+		return 0
+	}
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return co.bytes
+}
+
+// oldestAge returns how long the oldest pending write has been waiting.
+func (co *coalescer) oldestAge() time.Duration {
+	if co == nil {
+		return 0
+	}
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	if len(co.pending) == 0 {
+		return 0
+	}
+	return time.Since(co.oldest)
+}
+
+// close flushes the pending writes and waits for all flushes to complete.
+func (co *coalescer) close() {
+	co.mu.Lock()
+	co.closed = true
+	if len(co.pending) > 0 {
+		co.flushPending(coalesceReasonShutdown)
+	}
+	co.mu.Unlock()
+	co.flushing.Wait()
+}
+
+// wait waits for the flush of the write and returns its error. The rows of a write
+// cancelled while waiting are still written.
+func (w *coalescedWrite) wait(ctx context.Context) error {
+	select {
+	case <-w.done:
+		return w.err
+	case <-ctx.Done():
+		return &WriteError{FailedSamples: len(w.batch), Errors: []error{errors.Wrap(ctx.Err(), "waiting for coalesced write")}}
+	}
+}
+
+// flushCoalesced writes the batches of the writes in shared inserts and answers every
+// write with the failures of its own rows.
+func (c *BigqueryClient) flushCoalesced(writes []*coalescedWrite, reason string) {
+	var batch []*Item
+	owner := make(map[*Item]int)
+	for i, w := range writes {
+		for _, item := range w.batch {
+			owner[item] = i
+		}
+		batch = append(batch, w.batch...)
+	}
+	c.coalesceFlushes.WithLabelValues(reason).Inc()
+	c.coalesceFlushWrites.Observe(float64(len(writes)))
+	c.coalesceFlushRows.Observe(float64(len(batch)))
+
+	writeErrs := make([]*WriteError, len(writes))
+	done, err := c.breaker.allow()
+	switch {
+	case err != nil && c.spillRows(batch, err):
+	case err != nil:
+		for i, w := range writes {
+			writeErrs[i] = &WriteError{FailedSamples: len(w.batch), Errors: []error{err}}
+		}
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), c.writeTimeout)
+		results := c.insertChunks(ctx, batch)
+		cancel()
+		done(writeError(results))
+		c.spillResults(results)
+		for _, r := range results {
+			if r.err == nil {
+				continue
+			}
+			failed := make(map[int]int)
+			for _, item := range r.rows {
+				failed[owner[item]]++
+			}
+			for i, n := range failed {
+				if writeErrs[i] == nil {
+					writeErrs[i] = &WriteError{}
+				}
+				writeErrs[i].FailedSamples += n
+				writeErrs[i].Errors = append(writeErrs[i].Errors, r.err)
+			}
+		}
+	}
+
+	for i, w := range writes {
+		if writeErrs[i] != nil {
+			w.err = writeErrs[i]
+		} else {
+			// Failed writes are retried by Prometheus, their samples are aggregated then.
+			c.aggregator.add(w.batch)
+		}
+		close(w.done)
+	}
+}
@@ -0,0 +1,135 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// metricFailingInserter fails every Put containing a row of the metric and records all others.
+type metricFailingInserter struct {
+	*fakeInserter
+	metric string
+}
+
+func (f *metricFailingInserter) Put(ctx context.Context, src interface{}) error {
+	for _, item := range src.([]*Item) {
+		if item.metricname == f.metric {
+			return errors.New("insert failed")
+		}
+	}
+	return f.fakeInserter.Put(ctx, src)
+}
+
+func TestCoalescingConcurrentWriters(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithCoalescing(100, 0, time.Minute))
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, c.Write(context.Background(), seriesWithSamples(fmt.Sprintf("metric_%d", i), 10)))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, ins.rows(), 100, "every row is written")
+	assert.Len(t, ins.puts, 1, "the writes share a single insert")
+	assert.Equal(t, 1.0, metricValue(c.coalesceFlushes.WithLabelValues(coalesceReasonRows)))
+}
+
+func TestCoalescingErrorAttribution(t *testing.T) {
+	ins := &metricFailingInserter{fakeInserter: &fakeInserter{}, metric: "bad"}
+	c := newTestClient(ins, WithMaxRowsPerInsert(1), WithCoalescing(5, 0, time.Minute))
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	var goodErr, badErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		goodErr = c.Write(context.Background(), seriesWithSamples("good", 3))
+	}()
+	go func() {
+		defer wg.Done()
+		badErr = c.Write(context.Background(), seriesWithSamples("bad", 2))
+	}()
+	wg.Wait()
+
+	assert.NoError(t, goodErr)
+	var writeErr *WriteError
+	if assert.ErrorAs(t, badErr, &writeErr) {
+		assert.Equal(t, 2, writeErr.FailedSamples, "only the rows of the write are counted")
+	}
+	assert.Len(t, ins.rows(), 3)
+}
+
+func TestCoalescingMaxDelay(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithCoalescing(1000, 0, 50*time.Millisecond))
+	defer c.Close()
+
+	begin := time.Now()
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)))
+	elapsed := time.Since(begin)
+
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond, "the write waits for concurrent writes")
+	assert.Less(t, elapsed, time.Second, "the write is flushed once the delay elapsed")
+	assert.Len(t, ins.rows(), 1)
+	assert.Equal(t, 1.0, metricValue(c.coalesceFlushes.WithLabelValues(coalesceReasonDelay)))
+}
+
+func TestCoalescingMaxBytes(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithCoalescing(0, 1, time.Minute))
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)))
+	assert.Equal(t, 1.0, metricValue(c.coalesceFlushes.WithLabelValues(coalesceReasonBytes)))
+}
+
+func TestCoalescingCancelledWrite(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithCoalescing(1000, 0, time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, c.Write(ctx, seriesWithSamples("up", 2)), context.Canceled)
+	assert.Empty(t, ins.rows())
+
+	assert.NoError(t, c.Close())
+	assert.Len(t, ins.rows(), 2, "pending rows are written on shutdown")
+	assert.Equal(t, 1.0, metricValue(c.coalesceFlushes.WithLabelValues(coalesceReasonShutdown)))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)), "writes after Close are flushed on their own")
+	assert.Len(t, ins.rows(), 3)
+}
+
+func TestCoalescingDisabledWithAsyncWrites(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithAsyncWrites(100, time.Minute), WithCoalescing(0, 0, time.Second))
+	defer c.Close()
+	assert.Nil(t, c.coalescer)
+}
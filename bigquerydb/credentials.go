@@ -0,0 +1,237 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// readKeyFile reads a service account json key file and returns it with its project_id.
+func readKeyFile(path string) ([]byte, string, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to read google api json key")
+	}
+	projectID, err := projectIDFromKey(key)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to unmarshal google api json key")
+	}
+	return key, projectID, nil
+}
+
+// projectIDFromKey returns the project_id of a service account json key, or an
+// empty string if the key doesn't contain one.
+func projectIDFromKey(key []byte) (string, error) {
+	var result struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(key, &result); err != nil {
+		return "", err
+	}
+	return result.ProjectID, nil
+}
+
+// connection is a BigQuery client with the credentials of one version of the service
+// account key. Operations acquire the connection for as long as they use it, so that a
+// connection replaced after a rotation of the key is only closed once they are done.
+type connection struct {
+	client   *bigquery.Client
+	inFlight sync.WaitGroup
+	// closed is closed once the client of a replaced connection was closed.
+	closed chan struct{}
+}
+
+func newConnection(client *bigquery.Client) *connection {
+	return &connection{client: client, closed: make(chan struct{})}
+}
+
+// release ends an operation using the connection.
+func (conn *connection) release() {
+	conn.inFlight.Done()
+}
+
+// acquire returns the current connection, which has to be released once the operation
+// doesn't use it anymore.
+func (c *BigqueryClient) acquire() *connection {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	c.conn.inFlight.Add(1)
+	return c.conn
+}
+
+// replaceConnection makes conn the connection of new operations, and closes the replaced
+// one once the operations which acquired it released it.
+func (c *BigqueryClient) replaceConnection(conn *connection) {
+	c.connMu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.connMu.Unlock()
+	go func() {
+		old.inFlight.Wait()
+		if err := old.client.Close(); err != nil {
+			c.logger.Warn("failed to close the replaced bigquery client", slog.Any("error", err))
+		}
+		close(old.closed)
+	}()
+}
+
+// tableRef is a table of the current connection of the client. The handles of tables
+// and inserters are bound to the BigQuery client they were created with, so they are
+// created from the connection on every use instead, and use a rotated key right away.
+type tableRef struct {
+	c         *BigqueryClient
+	datasetID string
+	tableID   string
+}
+
+// table returns the table of the current connection, which is in the data project if one
+// is set.
+func (c *BigqueryClient) table(datasetID, tableID string) tableRef {
+	return tableRef{c: c, datasetID: datasetID, tableID: tableID}
+}
+
+// in returns the handle of the table in the connection.
+func (t tableRef) in(conn *connection) *bigquery.Table {
+	if t.c.dataProjectID != "" {
+		return conn.client.DatasetInProject(t.c.dataProjectID, t.datasetID).Table(t.tableID)
+	}
+	return conn.client.Dataset(t.datasetID).Table(t.tableID)
+}
+
+// Create implements TableAdmin.
+func (t tableRef) Create(ctx context.Context, tm *bigquery.TableMetadata) error {
+	conn := t.c.acquire()
+	defer conn.release()
+	return t.in(conn).Create(ctx, tm)
+}
+
+// Metadata implements TableAdmin.
+func (t tableRef) Metadata(ctx context.Context, opts ...bigquery.TableMetadataOption) (*bigquery.TableMetadata, error) {
+	conn := t.c.acquire()
+	defer conn.release()
+	return t.in(conn).Metadata(ctx, opts...)
+}
+
+// Update implements TableAdmin.
+func (t tableRef) Update(ctx context.Context, tm bigquery.TableMetadataToUpdate, etag string, opts ...bigquery.TableUpdateOption) (*bigquery.TableMetadata, error) {
+	conn := t.c.acquire()
+	defer conn.release()
+	return t.in(conn).Update(ctx, tm, etag, opts...)
+}
+
+// tableInserter streams rows into a table of the current connection.
+type tableInserter struct {
+	table               tableRef
+	skipInvalidRows     bool
+	ignoreUnknownValues bool
+	// templateSuffix makes BigQuery insert into the table of the suffix, which it creates
+	// from the table if it doesn't exist.
+	templateSuffix string
+}
+
+// Put implements Inserter.
+func (i *tableInserter) Put(ctx context.Context, src interface{}) error {
+	conn := i.table.c.acquire()
+	defer conn.release()
+	inserter := i.table.in(conn).Inserter()
+	inserter.SkipInvalidRows = i.skipInvalidRows
+	inserter.IgnoreUnknownValues = i.ignoreUnknownValues
+	inserter.TableTemplateSuffix = i.templateSuffix
+	return inserter.Put(ctx, src)
+}
+
+// startKeyRotation checks the key file every key check interval until Close is called.
+func (c *BigqueryClient) startKeyRotation() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.keyStop = cancel
+	c.keyStopped = make(chan struct{})
+	go func() {
+		defer close(c.keyStopped)
+		ticker := time.NewTicker(c.keyCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.checkKeyFile(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopKeyRotation stops the checks of the key file and waits for a running one to end.
+func (c *BigqueryClient) stopKeyRotation() {
+	if c.keyStop == nil {
+		return
+	}
+	c.keyStop()
+	<-c.keyStopped
+}
+
+// checkKeyFile replaces the connection with one using the key of the key file if its
+// content changed since the last check. If the new client can't be created, the current
+// connection is kept and the key is tried again at the next check.
+func (c *BigqueryClient) checkKeyFile(ctx context.Context) {
+	key, err := os.ReadFile(c.keyPath)
+	if err != nil {
+		c.credentialReloads.WithLabelValues("failure").Inc()
+		c.logger.Error("failed to read the rotated google api json key, keeping the current credentials", slog.Any("error", err), slog.String("path", c.keyPath))
+		return
+	}
+	hash := sha256.Sum256(key)
+	if hash == c.keyHash {
+		return
+	}
+	conn, err := c.connect(ctx, key)
+	if err != nil {
+		c.credentialReloads.WithLabelValues("failure").Inc()
+		c.logger.Error("failed to create a bigquery client with the rotated google api json key, keeping the current credentials", slog.Any("error", err), slog.String("path", c.keyPath))
+		return
+	}
+	c.keyHash = hash
+	c.replaceConnection(conn)
+	c.credentialReloads.WithLabelValues("success").Inc()
+	c.logger.Info("replaced the bigquery client with the rotated google api json key", slog.String("path", c.keyPath))
+}
+
+// connect creates a connection with the key and the other options the client was created with.
+func (c *BigqueryClient) connect(ctx context.Context, key []byte) (*connection, error) {
+	if _, err := projectIDFromKey(key); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal google api json key")
+	}
+	opts := append(slices.Clip(c.clientOptions), option.WithCredentialsJSON(key))
+	client, err := c.newBigQueryClient(ctx, c.projectID, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create new bigquery client")
+	}
+	if c.useStorageAPI {
+		if err := client.EnableStorageReadClient(ctx, opts...); err != nil {
+			client.Close()
+			return nil, errors.Wrap(err, "failed to create bigquery storage read client")
+		}
+	}
+	return newConnection(client), nil
+}
@@ -0,0 +1,203 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+func TestProjectIDFromKey(t *testing.T) {
+	testCases := map[string]struct {
+		key      string
+		expected string
+	}{
+		"project_id":    {key: `{"type": "service_account", "project_id": "my-project", "client_email": "adapter@my-project.iam.gserviceaccount.com"}`, expected: "my-project"},
+		"no_project_id": {key: `{"type": "service_account"}`, expected: ""},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			projectID, err := projectIDFromKey([]byte(testCase.key))
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, projectID)
+		})
+	}
+}
+
+func TestProjectIDFromKeyInvalid(t *testing.T) {
+	_, err := projectIDFromKey([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestNewClientErrors(t *testing.T) {
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "malformed.json")
+	assert.NoError(t, os.WriteFile(malformed, []byte("not json"), 0o600))
+	noProjectID := filepath.Join(dir, "no_project_id.json")
+	assert.NoError(t, os.WriteFile(noProjectID, []byte(`{"type": "service_account"}`), 0o600))
+
+	testCases := map[string]struct {
+		keyPath   string
+		projectID string
+		opts      []Option
+		expected  string
+	}{
+		"missing_file":           {keyPath: filepath.Join(dir, "missing.json"), expected: "failed to read google api json key"},
+		"directory":              {keyPath: dir, expected: "failed to read google api json key"},
+		"malformed_json":         {keyPath: malformed, expected: "failed to unmarshal google api json key"},
+		"malformed_inline_json":  {opts: []Option{WithCredentialsJSON([]byte("not json"))}, expected: "failed to unmarshal inline google api json key"},
+		"empty_project_id":       {expected: "no google project id given"},
+		"key_without_project_id": {keyPath: noProjectID, expected: "no google project id given"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewClient(nil, testCase.keyPath, testCase.projectID, "dataset", "table", time.Minute, testCase.opts...)
+			assert.ErrorContains(t, err, testCase.expected)
+			assert.Nil(t, c)
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := NewClient(nil, "", "project", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"))
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestNewClientDataProject(t *testing.T) {
+	c, err := NewClient(nil, "", "billing", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"), WithDataProject("analytics"))
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", c.conn.client.Project(), "jobs are billed to the project of the client")
+	assert.Equal(t, "analytics", c.table("dataset", "table").in(c.conn).ProjectID)
+	assert.Equal(t, "analytics", c.tableAdmin.(tableRef).in(c.conn).ProjectID)
+	assert.Equal(t, "analytics", c.Status().Project)
+
+	c, err = NewClient(nil, "", "billing", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"))
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", c.table("dataset", "table").in(c.conn).ProjectID)
+}
+
+// fakeClientFactory creates BigQuery clients without credentials, or fails with err.
+type fakeClientFactory struct {
+	mu      sync.Mutex
+	err     error
+	created int
+}
+
+func (f *fakeClientFactory) newClient(ctx context.Context, projectID string, _ ...option.ClientOption) (*bigquery.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.created++
+	return bigquery.NewClient(ctx, projectID, option.WithEndpoint("http://localhost:9050"), option.WithoutAuthentication())
+}
+
+func (f *fakeClientFactory) setErr(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func testKey(id string) []byte {
+	return []byte(`{"type": "service_account", "project_id": "project", "private_key_id": "` + id + `"}`)
+}
+
+func TestCheckKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(path, testKey("1"), 0o600))
+	factory := &fakeClientFactory{}
+	c := newTestClient(&fakeInserter{})
+	c.newBigQueryClient = factory.newClient
+	c.keyPath = path
+	c.keyHash = sha256.Sum256(testKey("1"))
+	ctx := context.Background()
+
+	initial := c.conn
+	c.checkKeyFile(ctx)
+	assert.Same(t, initial, c.conn, "an unchanged key keeps the client")
+	assert.Zero(t, factory.created)
+
+	// A read still uses the initial client while the key is rotated.
+	inFlight := c.acquire()
+	assert.NoError(t, os.WriteFile(path, testKey("2"), 0o600))
+	c.checkKeyFile(ctx)
+	assert.NotSame(t, initial, c.conn)
+	assert.Equal(t, 1, factory.created)
+	assert.Equal(t, 1.0, metricValue(c.credentialReloads.WithLabelValues("success")))
+	select {
+	case <-initial.closed:
+		t.Fatal("the replaced client was closed during the read")
+	case <-time.After(10 * time.Millisecond):
+	}
+	inFlight.release()
+	select {
+	case <-initial.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replaced client wasn't closed after the read")
+	}
+
+	// Keys which can't be used keep the current client.
+	rotated := c.conn
+	assert.NoError(t, os.WriteFile(path, []byte(`{"type": "serv`), 0o600))
+	c.checkKeyFile(ctx)
+	factory.setErr(errors.New("invalid private key"))
+	assert.NoError(t, os.WriteFile(path, testKey("3"), 0o600))
+	c.checkKeyFile(ctx)
+	assert.NoError(t, os.Remove(path))
+	c.checkKeyFile(ctx)
+	assert.Same(t, rotated, c.conn)
+	assert.Equal(t, 3.0, metricValue(c.credentialReloads.WithLabelValues("failure")))
+
+	// The key is tried again once the client can be created.
+	factory.setErr(nil)
+	assert.NoError(t, os.WriteFile(path, testKey("3"), 0o600))
+	c.checkKeyFile(ctx)
+	assert.NotSame(t, rotated, c.conn)
+	assert.Equal(t, 2.0, metricValue(c.credentialReloads.WithLabelValues("success")))
+}
+
+func TestKeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(path, testKey("1"), 0o600))
+	factory := &fakeClientFactory{}
+	c, err := NewClient(nil, path, "", "dataset", "table", time.Minute, WithKeyRotation(10*time.Millisecond),
+		func(c *BigqueryClient) { c.newBigQueryClient = factory.newClient })
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.Equal(t, "project", c.Status().Project)
+
+	assert.NoError(t, os.WriteFile(path, testKey("2"), 0o600))
+	assert.Eventually(t, func() bool {
+		return metricValue(c.credentialReloads.WithLabelValues("success")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, factory.created)
+}
@@ -0,0 +1,423 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	// deadLetterFlushInterval is the interval at which dead-lettered samples are stored.
+	deadLetterFlushInterval = 10 * time.Second
+	// deadLetterStaleValue is the value of staleness markers in dead-letter records.
+	deadLetterStaleValue = "stale"
+	// deadLetterMaxLine is the maximum size of a line of a dead-letter file.
+	deadLetterMaxLine = 16 << 20
+)
+
+// DeadLetterRecord is a sample the client gave up writing, as stored in the dead-letter
+// sink. Files of the sink hold one record per line as JSON object.
+type DeadLetterRecord struct {
+	// Remote is the name of the client which failed to write the sample.
+	Remote string `json:"remote"`
+	// Table is the table the sample was written to.
+	Table string `json:"table"`
+	// Metric is the metric name of the sample.
+	Metric string `json:"metric"`
+	// Labels are the other labels of the sample, as they were written.
+	Labels map[string]string `json:"labels"`
+	// Timestamp is the timestamp of the sample in milliseconds.
+	Timestamp int64 `json:"timestamp"`
+	// Value is the value of the sample as string, which holds NaN and infinite values as
+	// well, or "stale" for a staleness marker.
+	Value string `json:"value"`
+	// Reason is why writing the sample failed, like the reason of an insert error.
+	Reason string `json:"reason"`
+	// Error is the message of the error the write failed with.
+	Error string `json:"error"`
+	// FirstFailure is when writing the sample failed for the first time.
+	FirstFailure time.Time `json:"first_failure"`
+}
+
+// Sample returns the sample of the record.
+func (r DeadLetterRecord) Sample() (prompb.Sample, error) {
+	if r.Value == deadLetterStaleValue {
+		return prompb.Sample{Timestamp: r.Timestamp, Value: math.Float64frombits(staleNaN)}, nil
+	}
+	v, err := strconv.ParseFloat(r.Value, 64)
+	if err != nil {
+		return prompb.Sample{}, errors.Wrapf(err, "invalid value %q of a sample of %s", r.Value, r.Metric)
+	}
+	return prompb.Sample{Timestamp: r.Timestamp, Value: v}, nil
+}
+
+// WriteDeadLetters writes the records as newline-delimited JSON.
+func WriteDeadLetters(w io.Writer, records []DeadLetterRecord) error {
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDeadLetters reads the records of a file written by WriteDeadLetters. Empty lines
+// are skipped.
+func ReadDeadLetters(r io.Reader) ([]DeadLetterRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, deadLetterMaxLine)
+	var records []DeadLetterRecord
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record DeadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, errors.Wrapf(err, "invalid record in line %d", line)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// DeadLetterTimeSeries returns the timeseries of the records, one per distinct set of
+// labels, in the order of their first record.
+func DeadLetterTimeSeries(records []DeadLetterRecord) ([]*prompb.TimeSeries, error) {
+	var series []*prompb.TimeSeries
+	index := map[string]int{}
+	for _, record := range records {
+		sample, err := record.Sample()
+		if err != nil {
+			return nil, err
+		}
+		key := record.Metric + "\xff" + tagsFromMetric(deadLetterMetric(record.Labels))
+		i, ok := index[key]
+		if !ok {
+			labels := []*prompb.Label{{Name: model.MetricNameLabel, Value: record.Metric}}
+			for name, value := range record.Labels {
+				labels = append(labels, &prompb.Label{Name: name, Value: value})
+			}
+			sort.Slice(labels, func(a, b int) bool { return labels[a].Name < labels[b].Name })
+			i = len(series)
+			index[key] = i
+			series = append(series, &prompb.TimeSeries{Labels: labels})
+		}
+		series[i].Samples = append(series[i].Samples, sample)
+	}
+	return series, nil
+}
+
+// deadLetterMetric returns the labels of a record as metric.
+func deadLetterMetric(labels map[string]string) model.Metric {
+	m := make(model.Metric, len(labels))
+	for name, value := range labels {
+		m[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return m
+}
+
+// DeadLetterSink stores the samples a client gave up writing.
+type DeadLetterSink interface {
+	Put(ctx context.Context, records []DeadLetterRecord) error
+}
+
+// WithDeadLetter makes the client store the samples it gives up writing in the sink,
+// instead of only counting them: rows BigQuery rejects as invalid, rows of asynchronous
+// writes which failed, and spilled rows whose replay failed with a permanent error. The
+// samples are collected and stored every 10 seconds and on Close. At most maxBytesPerHour
+// bytes of records are stored per hour, the samples beyond are dropped, so that a long
+// outage doesn't fill the sink. A nil sink disables the dead-letter sink.
+func WithDeadLetter(sink DeadLetterSink, maxBytesPerHour int64) Option {
+	return func(c *BigqueryClient) {
+		c.deadLetterSink = sink
+		c.deadLetterMaxBytes = maxBytesPerHour
+	}
+}
+
+// WithDeadLetterTable is WithDeadLetter with a table in the project of the client as sink,
+// in the dataset of the client if datasetID is empty. The table is created with
+// WithCreateTable if it doesn't exist, its schema is in bq-deadletter-schema.json. An
+// empty table disables the dead-letter sink.
+func WithDeadLetterTable(datasetID, tableID string, maxBytesPerHour int64) Option {
+	return func(c *BigqueryClient) {
+		c.deadLetterDataset = datasetID
+		c.deadLetterTable = tableID
+		c.deadLetterMaxBytes = maxBytesPerHour
+	}
+}
+
+// deadLetter collects the samples a client gave up and stores them in its sink, bounded
+// by a number of bytes per hour.
+type deadLetter struct {
+	mu          sync.Mutex
+	sink        DeadLetterSink
+	maxBytes    int64
+	windowStart time.Time
+	windowBytes int64
+	pending     []DeadLetterRecord
+	now         func() time.Time
+	timeout     time.Duration
+	logger      *slog.Logger
+	stored      prometheus.Counter
+	dropped     *prometheus.CounterVec
+	done        chan struct{}
+	stopped     chan struct{}
+}
+
+func (c *BigqueryClient) newDeadLetter(sink DeadLetterSink) *deadLetter {
+	return &deadLetter{
+		sink:     sink,
+		maxBytes: c.deadLetterMaxBytes,
+		now:      time.Now,
+		timeout:  c.writeTimeout,
+		logger:   c.logger,
+		stored:   c.deadLetteredSamples,
+		dropped:  c.deadLetterDropped,
+	}
+}
+
+// add collects the records, unless they exceed the bytes of the current hour.
+func (d *deadLetter) add(records []DeadLetterRecord) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if now.Sub(d.windowStart) >= time.Hour {
+		d.windowStart = now
+		d.windowBytes = 0
+	}
+	for i, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			d.dropped.WithLabelValues("error").Inc()
+			continue
+		}
+		if d.maxBytes > 0 && d.windowBytes+int64(len(encoded))+1 > d.maxBytes {
+			dropped := len(records) - i
+			d.dropped.WithLabelValues("limit").Add(float64(dropped))
+			d.logger.Warn("dead-letter limit reached, dropped samples", slog.Int("samples", dropped), slog.Int64("max_bytes_per_hour", d.maxBytes))
+			return
+		}
+		d.windowBytes += int64(len(encoded)) + 1
+		d.pending = append(d.pending, record)
+	}
+}
+
+// start stores the collected records every flush interval until close is called.
+func (d *deadLetter) start() {
+	d.done = make(chan struct{})
+	d.stopped = make(chan struct{})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(deadLetterFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.flush()
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the background flushes and stores the remaining records.
+func (d *deadLetter) close() {
+	if d.done != nil {
+		close(d.done)
+		<-d.stopped
+	}
+	d.flush()
+}
+
+// flush stores the collected records. Records the sink fails to store are dropped.
+func (d *deadLetter) flush() {
+	d.mu.Lock()
+	records := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+	if len(records) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	if err := d.sink.Put(ctx, records); err != nil {
+		d.dropped.WithLabelValues("error").Add(float64(len(records)))
+		d.logger.Error("failed to store dead-lettered samples", slog.Int("samples", len(records)), slog.Any("error", err))
+		return
+	}
+	d.stored.Add(float64(len(records)))
+}
+
+// deadLetterRows collects the rows of the table the client gave up writing because of err.
+func (c *BigqueryClient) deadLetterRows(table string, rows []*Item, reason string, err error) {
+	if c.deadLetter == nil || len(rows) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	records := make([]DeadLetterRecord, 0, len(rows))
+	for _, item := range rows {
+		records = append(records, c.deadLetterRecord(table, item, reason, err, now))
+	}
+	c.deadLetter.add(records)
+}
+
+// deadLetterResults collects the rows of the failed chunks of the results.
+func (c *BigqueryClient) deadLetterResults(results []insertResult) {
+	for _, r := range results {
+		if r.err != nil {
+			c.deadLetterRows(r.dest.name(), r.rows, insertErrorReason(r.err), r.err)
+		}
+	}
+}
+
+// deadLetterRecord returns the record of a row.
+func (c *BigqueryClient) deadLetterRecord(table string, item *Item, reason string, err error, now time.Time) DeadLetterRecord {
+	record := DeadLetterRecord{
+		Remote:       c.name,
+		Table:        table,
+		Metric:       item.metricname,
+		Labels:       map[string]string{},
+		Timestamp:    item.timestamp * 1000,
+		Value:        strconv.FormatFloat(item.value, 'g', -1, 64),
+		Reason:       reason,
+		FirstFailure: now,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if item.timestampMs != 0 {
+		record.Timestamp = item.timestampMs
+	}
+	if item.failedAt != 0 {
+		record.FirstFailure = time.UnixMilli(item.failedAt).UTC()
+	}
+	switch {
+	case item.stale:
+		record.Value = deadLetterStaleValue
+	case item.special != "":
+		record.Value = item.special
+	}
+	if item.labels != nil {
+		for _, l := range item.labels {
+			if l.Name != model.MetricNameLabel {
+				record.Labels[l.Name] = l.Value
+			}
+		}
+	} else if jsonErr := json.Unmarshal([]byte(item.tags), &record.Labels); jsonErr != nil {
+		c.logger.Warn("failed to decode the tags of a dead-lettered sample", slog.String("metric", item.metricname), slog.Any("error", jsonErr))
+	}
+	return record
+}
+
+// startDeadLetter starts storing the dead-lettered samples in the background.
+func (c *BigqueryClient) startDeadLetter() {
+	if c.deadLetter != nil {
+		c.deadLetter.start()
+	}
+}
+
+// tableDeadLetters stores dead-lettered samples in a table.
+type tableDeadLetters struct {
+	inserter Inserter
+}
+
+// deadLetterRow is a record inserted into the dead-letter table.
+type deadLetterRow DeadLetterRecord
+
+// Save implements the ValueSaver interface. The labels are inserted as JSON string,
+// the timestamp as TIMESTAMP.
+func (r *deadLetterRow) Save() (map[string]bigquery.Value, string, error) {
+	labels, err := json.Marshal(r.Labels)
+	if err != nil {
+		return nil, "", err
+	}
+	return map[string]bigquery.Value{
+		"remote":        r.Remote,
+		"table":         r.Table,
+		"metric":        r.Metric,
+		"labels":        string(labels),
+		"timestamp":     time.UnixMilli(r.Timestamp).UTC(),
+		"value":         r.Value,
+		"reason":        r.Reason,
+		"error":         r.Error,
+		"first_failure": r.FirstFailure,
+	}, "", nil
+}
+
+// Put implements DeadLetterSink.
+func (t *tableDeadLetters) Put(ctx context.Context, records []DeadLetterRecord) error {
+	rows := make([]*deadLetterRow, len(records))
+	for i := range records {
+		rows[i] = (*deadLetterRow)(&records[i])
+	}
+	return t.inserter.Put(ctx, rows)
+}
+
+// deadLetterSchema returns the schema of the dead-letter table.
+func deadLetterSchema() bigquery.Schema {
+	return bigquery.Schema{
+		{Name: "remote", Type: bigquery.StringFieldType},
+		{Name: "table", Type: bigquery.StringFieldType},
+		{Name: "metric", Type: bigquery.StringFieldType},
+		{Name: "labels", Type: bigquery.JSONFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "value", Type: bigquery.StringFieldType},
+		{Name: "reason", Type: bigquery.StringFieldType},
+		{Name: "error", Type: bigquery.StringFieldType},
+		{Name: "first_failure", Type: bigquery.TimestampFieldType},
+	}
+}
+
+// createDeadLetterTable creates the dead-letter table, partitioned by the day of the
+// first failure, if it doesn't exist.
+func (c *BigqueryClient) createDeadLetterTable(ctx context.Context, admin TableAdmin, datasetID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	table := c.tableName(datasetID, c.deadLetterTable)
+	_, err := admin.Metadata(ctx)
+	if err == nil {
+		return nil
+	}
+	if !isHTTPError(err, http.StatusNotFound) {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", table)
+	}
+	err = admin.Create(ctx, &bigquery.TableMetadata{
+		Schema:           deadLetterSchema(),
+		TimePartitioning: &bigquery.TimePartitioning{Field: "first_failure"},
+	})
+	if err != nil && !isHTTPError(err, http.StatusConflict) {
+		return errors.Wrapf(err, "failed to create the dead-letter table %s", table)
+	}
+	c.logger.Info("created dead-letter table", slog.String("table", table))
+	return nil
+}
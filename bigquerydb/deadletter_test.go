@@ -0,0 +1,197 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeDeadLetterSink records the records of every Put call.
+type fakeDeadLetterSink struct {
+	mu      sync.Mutex
+	err     error
+	records []DeadLetterRecord
+}
+
+func (f *fakeDeadLetterSink) Put(_ context.Context, records []DeadLetterRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.records = append(f.records, records...)
+	return nil
+}
+
+var firstFailure = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+func TestDeadLetterFormat(t *testing.T) {
+	records := []DeadLetterRecord{
+		{Remote: "bigquerydb", Table: "dataset.table", Metric: "up", Labels: map[string]string{"job": "api"}, Timestamp: 1700000000000, Value: "1", Reason: "rejected_invalid", Error: "no such field", FirstFailure: firstFailure},
+		{Remote: "bigquerydb", Table: "dataset.table", Metric: "up", Labels: map[string]string{"job": "api"}, Timestamp: 1700000015000, Value: "stale", Reason: "other", FirstFailure: firstFailure},
+		{Remote: "archive", Table: "archive.table", Metric: "temperature", Labels: map[string]string{}, Timestamp: 1700000000000, Value: "+Inf", Reason: "other", FirstFailure: firstFailure},
+	}
+	var b bytes.Buffer
+	assert.NoError(t, WriteDeadLetters(&b, records))
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	assert.Len(t, lines, 3, "one record per line")
+	assert.Equal(t, `{"remote":"bigquerydb","table":"dataset.table","metric":"up","labels":{"job":"api"},"timestamp":1700000000000,"value":"1","reason":"rejected_invalid","error":"no such field","first_failure":"2026-10-15T12:00:00Z"}`, lines[0])
+
+	read, err := ReadDeadLetters(strings.NewReader(b.String() + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, records, read)
+
+	series, err := DeadLetterTimeSeries(read)
+	assert.NoError(t, err)
+	if assert.Len(t, series, 2) {
+		assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, series[0].Labels)
+		assert.Len(t, series[0].Samples, 2)
+		assert.Equal(t, staleNaN, math.Float64bits(series[0].Samples[1].Value), "staleness markers are written as such again")
+		assert.Equal(t, []prompb.Sample{{Timestamp: 1700000000000, Value: math.Inf(1)}}, series[1].Samples)
+	}
+
+	_, err = ReadDeadLetters(strings.NewReader("{}\nnot json\n"))
+	assert.ErrorContains(t, err, "invalid record in line 2")
+	_, err = DeadLetterTimeSeries([]DeadLetterRecord{{Metric: "up", Value: "one"}})
+	assert.ErrorContains(t, err, `invalid value "one" of a sample of up`)
+}
+
+func TestDeadLetterRejectedRows(t *testing.T) {
+	sink := &fakeDeadLetterSink{}
+	ins := &fakeInserter{err: syntheticPutMultiError(2, "invalid")}
+	c := newTestClient(ins, WithDeadLetter(sink, 0))
+
+	ts := seriesWithSamples("up", 2)
+	ts[0].Labels = append(ts[0].Labels, &prompb.Label{Name: "job", Value: "api"})
+	assert.NoError(t, c.Write(context.Background(), ts), "invalid rows are dropped")
+	assert.Empty(t, sink.records, "records are stored in the background")
+	c.deadLetter.flush()
+
+	if assert.Len(t, sink.records, 2) {
+		record := sink.records[1]
+		assert.Equal(t, "bigquerydb", record.Remote)
+		assert.Equal(t, "dataset.table", record.Table)
+		assert.Equal(t, "up", record.Metric)
+		assert.Equal(t, map[string]string{"job": "api"}, record.Labels)
+		assert.Equal(t, int64(1000), record.Timestamp)
+		assert.Equal(t, "1", record.Value)
+		assert.Equal(t, "rejected_invalid", record.Reason)
+		assert.Contains(t, record.Error, "no such field")
+		assert.WithinDuration(t, time.Now(), record.FirstFailure, time.Minute)
+	}
+	assert.Equal(t, 2.0, metricValue(c.deadLetteredSamples))
+	assert.Equal(t, 2.0, metricValue(c.droppedSamples.WithLabelValues("rejected_invalid")), "dead-lettered samples still count as dropped")
+}
+
+func TestDeadLetterFailedFlushAndReplay(t *testing.T) {
+	sink := &fakeDeadLetterSink{}
+	ins := &fakeInserter{err: &googleapi.Error{Code: 400, Message: "invalid"}}
+	c := newSpillClient(t, ins, t.TempDir(), 1<<20, WithDeadLetter(sink, 0))
+
+	rows := []*Item{{metricname: "up", tags: `{"job":"api"}`, timestamp: 1700000000, value: 2}}
+	c.flush(rows, "size")
+	c.deadLetter.flush()
+	if assert.Len(t, sink.records, 1, "failed asynchronous writes are given up") {
+		assert.Equal(t, "invalid", sink.records[0].Reason)
+		assert.Equal(t, int64(1700000000000), sink.records[0].Timestamp)
+	}
+
+	// Spilled rows keep the time of their first failure.
+	ins.setErr(errUnavailable)
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)))
+	assert.Equal(t, 1, c.spill.len())
+	ins.setErr(&googleapi.Error{Code: 400, Message: "invalid"})
+	c.spill.replayAll()
+	assert.Equal(t, 0, c.spill.len(), "segments failing with a permanent error are removed")
+	c.deadLetter.close()
+	if assert.Len(t, sink.records, 2, "closing stores the pending records") {
+		spilled := sink.records[1]
+		assert.Equal(t, "invalid", spilled.Reason)
+		assert.True(t, spilled.FirstFailure.Before(time.Now()))
+		assert.Equal(t, 0, spilled.FirstFailure.Nanosecond()%int(time.Millisecond))
+	}
+	assert.Equal(t, 2.0, metricValue(c.deadLetteredSamples))
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	sink := &fakeDeadLetterSink{}
+	c := newTestClient(&fakeInserter{}, WithDeadLetter(sink, 500))
+	now := firstFailure
+	c.deadLetter.now = func() time.Time { return now }
+	item := &Item{metricname: "up", tags: `{"job":"api"}`, timestamp: 1700000000, value: 1}
+	rows := []*Item{item, item, item, item, item}
+
+	c.deadLetterRows("dataset.table", rows, "invalid", errors.New("no such field"))
+	c.deadLetter.flush()
+	stored := len(sink.records)
+	assert.Greater(t, stored, 0)
+	assert.Less(t, stored, len(rows), "the records beyond the limit of the hour are dropped")
+	assert.Equal(t, float64(len(rows)-stored), metricValue(c.deadLetterDropped.WithLabelValues("limit")))
+
+	c.deadLetterRows("dataset.table", rows[:1], "invalid", nil)
+	c.deadLetter.flush()
+	assert.Len(t, sink.records, stored)
+
+	now = now.Add(time.Hour)
+	c.deadLetterRows("dataset.table", rows[:1], "invalid", nil)
+	c.deadLetter.flush()
+	assert.Len(t, sink.records, stored+1, "the limit applies per hour")
+}
+
+func TestDeadLetterSinkError(t *testing.T) {
+	sink := &fakeDeadLetterSink{err: errors.New("bucket not found")}
+	c := newTestClient(&fakeInserter{}, WithDeadLetter(sink, 0))
+	c.deadLetterRows("dataset.table", []*Item{{metricname: "up", tags: "{}"}}, "invalid", nil)
+	c.deadLetter.flush()
+	assert.Equal(t, 1.0, metricValue(c.deadLetterDropped.WithLabelValues("error")))
+	assert.Equal(t, 0.0, metricValue(c.deadLetteredSamples))
+
+	c = newTestClient(&fakeInserter{err: syntheticPutMultiError(1, "invalid")})
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)), "nothing is stored without a sink")
+	assert.Nil(t, c.deadLetter)
+}
+
+func TestDeadLetterRecordValues(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	record := c.deadLetterRecord("dataset.table", &Item{metricname: "up", special: specialNaN, labels: []itemLabel{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, timestampMs: 1700000000123}, "invalid", nil, firstFailure)
+	assert.Equal(t, "NaN", record.Value)
+	assert.Equal(t, int64(1700000000123), record.Timestamp)
+	assert.Equal(t, map[string]string{"job": "api"}, record.Labels)
+	assert.Empty(t, record.Error)
+
+	row, _, err := (*deadLetterRow)(&record).Save()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"job":"api"}`, row["labels"])
+	assert.Equal(t, time.UnixMilli(1700000000123).UTC(), row["timestamp"])
+	schema := deadLetterSchema()
+	assert.Len(t, row, len(schema), "every column of the dead-letter table is written")
+	for _, field := range schema {
+		assert.Contains(t, row, field.Name)
+	}
+	assert.Equal(t, bigquery.JSONFieldType, schema[3].Type)
+}
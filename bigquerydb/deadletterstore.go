@@ -0,0 +1,333 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const (
+	deadLetterExt = ".ndjson"
+	// storageScope is the OAuth scope of reading and writing objects in Cloud Storage.
+	storageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+	// storageEndpoint is the endpoint of the JSON API of Cloud Storage.
+	storageEndpoint = "https://storage.googleapis.com"
+)
+
+// deadLetterStore stores the files of dead-lettered samples.
+type deadLetterStore interface {
+	put(ctx context.Context, name string, data []byte) error
+	list(ctx context.Context) ([]string, error)
+	open(ctx context.Context, name string) (io.ReadCloser, error)
+	remove(ctx context.Context, name string) error
+}
+
+// DeadLetters is a location of files of dead-lettered samples: a local directory, or a
+// bucket and prefix of Cloud Storage given as gs://bucket/prefix or gcs://bucket/prefix.
+// Every Put writes a new file of newline-delimited JSON records.
+type DeadLetters struct {
+	location string
+	store    deadLetterStore
+}
+
+// OpenDeadLetters opens the location, creating a local directory if it doesn't exist.
+// A local file is a location holding just that file. Cloud Storage is accessed with the
+// credentials of the options, or the application default credentials.
+func OpenDeadLetters(ctx context.Context, location string, opts ...option.ClientOption) (*DeadLetters, error) {
+	d := &DeadLetters{location: location}
+	if scheme, rest, ok := strings.Cut(location, "://"); ok {
+		if scheme != "gs" && scheme != "gcs" {
+			return nil, errors.Errorf("unsupported dead-letter location %s, use gs://bucket/prefix or a directory", location)
+		}
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, errors.Errorf("dead-letter location %s has no bucket", location)
+		}
+		store, err := newGCSObjects(ctx, bucket, prefix, deadLetterExt, "application/x-ndjson", opts...)
+		if err != nil {
+			return nil, err
+		}
+		d.store = store
+		return d, nil
+	}
+	if info, err := os.Stat(location); err == nil && !info.IsDir() {
+		d.store = &dirDeadLetters{file: location}
+		return d, nil
+	}
+	if err := os.MkdirAll(location, 0o700); err != nil {
+		return nil, errors.Wrap(err, "failed to create the dead-letter directory")
+	}
+	d.store = &dirDeadLetters{dir: location}
+	return d, nil
+}
+
+// String returns the location.
+func (d *DeadLetters) String() string {
+	return d.location
+}
+
+// Put implements DeadLetterSink, it writes the records to a new file.
+func (d *DeadLetters) Put(ctx context.Context, records []DeadLetterRecord) error {
+	var b bytes.Buffer
+	if err := WriteDeadLetters(&b, records); err != nil {
+		return errors.Wrap(err, "failed to encode the dead-lettered samples")
+	}
+	return d.store.put(ctx, deadLetterName(time.Now()), b.Bytes())
+}
+
+// Files returns the names of the files of the location, oldest first.
+func (d *DeadLetters) Files(ctx context.Context) ([]string, error) {
+	names, err := d.store.list(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the dead-letter files of %s", d.location)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read returns the records of the file.
+func (d *DeadLetters) Read(ctx context.Context, name string) ([]DeadLetterRecord, error) {
+	r, err := d.store.open(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the dead-letter file %s", name)
+	}
+	defer r.Close()
+	records, err := ReadDeadLetters(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the dead-letter file %s", name)
+	}
+	return records, nil
+}
+
+// Remove deletes the file.
+func (d *DeadLetters) Remove(ctx context.Context, name string) error {
+	return errors.Wrapf(d.store.remove(ctx, name), "failed to remove the dead-letter file %s", name)
+}
+
+// deadLetterName returns a name for a new file, which sorts by time and doesn't collide
+// with the files of other adapters.
+func deadLetterName(now time.Time) string {
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	return now.UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix[:]) + deadLetterExt
+}
+
+// dirDeadLetters stores the files in a local directory, or reads a single file.
+type dirDeadLetters struct {
+	dir  string
+	file string
+}
+
+func (s *dirDeadLetters) put(_ context.Context, name string, data []byte) error {
+	if s.file != "" {
+		return errors.Errorf("dead-letter location %s is a file", s.file)
+	}
+	return writeSegment(filepath.Join(s.dir, name), data)
+}
+
+func (s *dirDeadLetters) list(context.Context) ([]string, error) {
+	if s.file != "" {
+		return []string{s.file}, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), deadLetterExt) {
+			names = append(names, filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	return names, nil
+}
+
+func (s *dirDeadLetters) open(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (s *dirDeadLetters) remove(_ context.Context, name string) error {
+	return os.Remove(name)
+}
+
+// gcsObjects stores the files as objects in a bucket of Cloud Storage, using its
+// JSON API. It holds the files of dead letters and the objects staged for load jobs.
+type gcsObjects struct {
+	client   *http.Client
+	endpoint string
+	bucket   string
+	prefix   string
+	// ext is the extension of the files, other objects of the prefix aren't listed.
+	ext         string
+	contentType string
+	// quarantinePrefix is the prefix quarantined objects are moved to.
+	quarantinePrefix string
+}
+
+// newGCSObjects creates the client of the JSON API of Cloud Storage for the objects of
+// the bucket and prefix with the extension, with the credentials of the options.
+func newGCSObjects(ctx context.Context, bucket, prefix, ext, contentType string, opts ...option.ClientOption) (*gcsObjects, error) {
+	client, endpoint, err := htransport.NewClient(ctx, append(opts, option.WithScopes(storageScope))...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the cloud storage client")
+	}
+	if endpoint == "" {
+		endpoint = storageEndpoint
+	}
+	return &gcsObjects{client: client, endpoint: strings.TrimSuffix(endpoint, "/"), bucket: bucket, prefix: prefix,
+		ext: ext, contentType: contentType}, nil
+}
+
+// object returns the name of the object of a file.
+func (s *gcsObjects) object(name string) string {
+	if s.prefix == "" || strings.HasSuffix(s.prefix, "/") {
+		return s.prefix + name
+	}
+	return s.prefix + "/" + name
+}
+
+// objectURL returns the URL of an object.
+func (s *gcsObjects) objectURL(object string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", s.endpoint, url.PathEscape(s.bucket), url.PathEscape(object))
+}
+
+// do sends the request and returns the response if it succeeded.
+func (s *gcsObjects) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := googleapi.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *gcsObjects) put(ctx context.Context, name string, data []byte) error {
+	query := url.Values{"uploadType": {"media"}, "name": {s.object(name)}, "ifGenerationMatch": {"0"}}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", s.endpoint, url.PathEscape(s.bucket), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *gcsObjects) list(ctx context.Context) ([]string, error) {
+	var names []string
+	query := url.Values{"prefix": {s.prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", s.endpoint, url.PathEscape(s.bucket), query.Encode())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode the list of objects")
+		}
+		for _, item := range page.Items {
+			if strings.HasSuffix(item.Name, s.ext) {
+				names = append(names, item.Name)
+			}
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+func (s *gcsObjects) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(name)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// uri returns the URI of an object, which load jobs read it from.
+func (s *gcsObjects) uri(object string) string {
+	return "gs://" + s.bucket + "/" + object
+}
+
+func (s *gcsObjects) remove(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(name), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// quarantine copies the object below the quarantine prefix and removes it.
+func (s *gcsObjects) quarantine(ctx context.Context, object string) (string, error) {
+	if s.quarantinePrefix == "" {
+		return "", errors.New("no quarantine prefix")
+	}
+	to := s.quarantinePrefix + strings.TrimPrefix(object, s.prefix)
+	u := fmt.Sprintf("%s/copyTo/b/%s/o/%s", s.objectURL(object), url.PathEscape(s.bucket), url.PathEscape(to))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to copy the object to %s", to)
+	}
+	resp.Body.Close()
+	return to, s.remove(ctx, object)
+}
@@ -0,0 +1,181 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+var deadLetterRecords = []DeadLetterRecord{
+	{Remote: "bigquerydb", Table: "dataset.table", Metric: "up", Labels: map[string]string{"job": "api"}, Timestamp: 1700000000000, Value: "1", Reason: "invalid", FirstFailure: firstFailure},
+}
+
+func TestDeadLettersDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "deadletter")
+	d, err := OpenDeadLetters(context.Background(), dir)
+	assert.NoError(t, err)
+	assert.NoError(t, d.Put(context.Background(), deadLetterRecords))
+	assert.NoError(t, d.Put(context.Background(), deadLetterRecords))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600))
+
+	files, err := d.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	records, err := d.Read(context.Background(), files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, deadLetterRecords, records)
+
+	single, err := OpenDeadLetters(context.Background(), files[1])
+	assert.NoError(t, err)
+	singleFiles, err := single.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, files[1:], singleFiles, "a file is a location of its own")
+	assert.Error(t, single.Put(context.Background(), deadLetterRecords))
+
+	assert.NoError(t, d.Remove(context.Background(), files[0]))
+	files, err = d.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestOpenDeadLettersErrors(t *testing.T) {
+	_, err := OpenDeadLetters(context.Background(), "s3://bucket/prefix")
+	assert.ErrorContains(t, err, "unsupported dead-letter location s3://bucket/prefix")
+	_, err = OpenDeadLetters(context.Background(), "gs:///prefix")
+	assert.ErrorContains(t, err, "has no bucket")
+}
+
+// fakeGCS serves the objects of a bucket with the JSON API of Cloud Storage, listing one
+// object per page.
+type fakeGCS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+		name := r.URL.Query().Get("name")
+		if _, ok := f.objects[name]; ok && r.URL.Query().Get("ifGenerationMatch") == "0" {
+			http.Error(w, `{"error":{"code":412,"message":"exists"}}`, http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.objects[name] = data
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/bucket/o":
+		var names []string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) && name > r.URL.Query().Get("pageToken") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		page := map[string]interface{}{}
+		if len(names) > 0 {
+			page["items"] = []map[string]string{{"name": names[0]}}
+			if len(names) > 1 {
+				page["nextPageToken"] = names[0]
+			}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/copyTo/b/bucket/o/"):
+		from, to, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"), "/copyTo/b/bucket/o/")
+		data, ok := f.objects[from]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		f.objects[to] = data
+		_, _ = w.Write([]byte(`{}`))
+	case strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")
+		data, ok := f.objects[name]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.objects, name)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestDeadLettersGCS(t *testing.T) {
+	gcs := &fakeGCS{objects: map[string][]byte{"other/file.ndjson": nil}}
+	srv := httptest.NewServer(gcs)
+	defer srv.Close()
+	d := &DeadLetters{location: "gs://bucket/dead/letters", store: &gcsObjects{client: srv.Client(), endpoint: srv.URL, bucket: "bucket", prefix: "dead/letters",
+		ext: deadLetterExt, contentType: "application/x-ndjson"}}
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, d.Put(context.Background(), deadLetterRecords))
+	}
+	files, err := d.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, files, 3, "all pages are listed, without the objects outside of the prefix")
+	for _, name := range files {
+		assert.True(t, strings.HasPrefix(name, "dead/letters/"), name)
+	}
+
+	records, err := d.Read(context.Background(), files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, deadLetterRecords, records)
+
+	assert.NoError(t, d.Remove(context.Background(), files[0]))
+	err = d.Remove(context.Background(), files[0])
+	var apiErr *googleapi.Error
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, http.StatusNotFound, apiErr.Code)
+	}
+	_, err = d.Read(context.Background(), files[0])
+	assert.ErrorContains(t, err, "failed to open the dead-letter file")
+}
+
+func TestGCSObjectsQuarantine(t *testing.T) {
+	gcs := &fakeGCS{objects: map[string][]byte{"stage/bigquerydb/1-0.json.gz": []byte("rows")}}
+	srv := httptest.NewServer(gcs)
+	defer srv.Close()
+	store := &gcsObjects{client: srv.Client(), endpoint: srv.URL, bucket: "bucket", prefix: "stage/bigquerydb/",
+		ext: stageObjectExt, quarantinePrefix: "stage/quarantine/bigquerydb/"}
+
+	object, err := store.quarantine(context.Background(), "stage/bigquerydb/1-0.json.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "stage/quarantine/bigquerydb/1-0.json.gz", object)
+	assert.Equal(t, map[string][]byte{object: []byte("rows")}, gcs.objects)
+	names, err := store.list(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, names, "quarantined objects aren't listed")
+}
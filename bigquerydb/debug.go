@@ -0,0 +1,93 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// QueryStats describes a query run by ReadDebug.
+type QueryStats struct {
+	SQL                 string                 `json:"sql"`
+	Parameters          map[string]interface{} `json:"parameters"`
+	JobID               string                 `json:"job_id,omitempty"`
+	TotalBytesProcessed int64                  `json:"total_bytes_processed"`
+	CacheHit            bool                   `json:"cache_hit"`
+	Rows                int                    `json:"rows"`
+	DurationSeconds     float64                `json:"duration_seconds"`
+}
+
+// queryStatsKey is the context key of the queryStats recorded by query.
+type queryStatsKey struct{}
+
+// queryStats collects the statistics of the queries of a single read.
+// The sub-range queries of split reads record theirs concurrently.
+type queryStats struct {
+	mu      sync.Mutex
+	queries []*QueryStats
+}
+
+// ReadDebug runs the read like Read and also returns the statistics of the queries sent
+// to BigQuery. Queries answered from the read cache aren't sent and not listed.
+func (c *BigqueryClient) ReadDebug(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, []QueryStats, error) {
+	stats := &queryStats{}
+	resp, err := c.Read(context.WithValue(ctx, queryStatsKey{}, stats), req)
+	queries := make([]QueryStats, 0, len(stats.queries))
+	for _, q := range stats.queries {
+		queries = append(queries, *q)
+	}
+	return resp, queries, err
+}
+
+// recordQuery starts recording the statistics of a query if the context asks for them.
+// It returns nil otherwise.
+func recordQuery(ctx context.Context, command string, params []bigquery.QueryParameter) *QueryStats {
+	stats, ok := ctx.Value(queryStatsKey{}).(*queryStats)
+	if !ok {
+		return nil
+	}
+	q := &QueryStats{SQL: command, Parameters: make(map[string]interface{}, len(params))}
+	for _, p := range params {
+		q.Parameters[p.Name] = p.Value
+	}
+	stats.mu.Lock()
+	stats.queries = append(stats.queries, q)
+	stats.mu.Unlock()
+	return q
+}
+
+// finish records the results of the query.
+func (q *QueryStats) finish(iter QueryIterator, rows int, duration time.Duration) {
+	if q == nil {
+		return
+	}
+	q.Rows = rows
+	q.DurationSeconds = duration.Seconds()
+	job := queryJob(iter)
+	if job == nil {
+		return
+	}
+	q.JobID = job.ID()
+	if status := job.LastStatus(); status != nil && status.Statistics != nil {
+		q.TotalBytesProcessed = status.Statistics.TotalBytesProcessed
+		if details, ok := status.Statistics.Details.(*bigquery.QueryStatistics); ok {
+			q.CacheHit = details.CacheHit
+		}
+	}
+}
@@ -0,0 +1,139 @@
+//go:build emulator
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+const emulatorProjectID = "test"
+
+// newEmulatorClient creates a dataset and table in the emulator listening on
+// BQ_ENDPOINT and returns a client writing to and reading from them.
+func newEmulatorClient(t *testing.T) *BigqueryClient {
+	endpoint := os.Getenv("BQ_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BQ_ENDPOINT is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := bigquery.NewClient(ctx, emulatorProjectID, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal("failed to create bigquery client", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schemaJSON, err := os.ReadFile("../bq-schema.json")
+	if err != nil {
+		t.Fatal("failed to read schema", err)
+	}
+	schema, err := bigquery.SchemaFromJSON(schemaJSON)
+	if err != nil {
+		t.Fatal("failed to parse schema", err)
+	}
+
+	datasetID := fmt.Sprintf("emulator_%d", time.Now().UnixNano())
+	dataset := admin.Dataset(datasetID)
+	if err := dataset.Create(ctx, nil); err != nil {
+		t.Fatal("failed to create dataset", err)
+	}
+	t.Cleanup(func() { _ = dataset.DeleteWithContents(ctx) })
+	if err := dataset.Table("metrics").Create(ctx, &bigquery.TableMetadata{Schema: schema}); err != nil {
+		t.Fatal("failed to create table", err)
+	}
+
+	c, err := NewClient(promslog.NewNopLogger(), "", emulatorProjectID, datasetID, "metrics", time.Minute, WithEndpoint(endpoint))
+	if err != nil {
+		t.Fatal("failed to create client", err)
+	}
+	return c
+}
+
+func emulatorSeries(name, label string, timestamp int64, value float64) *prompb.TimeSeries {
+	labels := []*prompb.Label{{Name: "__name__", Value: name}}
+	if label != "" {
+		labels = append(labels, &prompb.Label{Name: "label", Value: label})
+	}
+	return &prompb.TimeSeries{
+		Labels:  labels,
+		Samples: []prompb.Sample{{Timestamp: timestamp, Value: value}},
+	}
+}
+
+func TestEmulatorWriteRead(t *testing.T) {
+	client := newEmulatorClient(t)
+	now := time.Now().UnixMilli()
+
+	series := map[string]*prompb.TimeSeries{
+		"first":     emulatorSeries("first_metric", "first", now, 1),
+		"second":    emulatorSeries("second_metric", "sec.nd", now, 2),
+		"unlabeled": emulatorSeries("unlabeled_metric", "", now, 3),
+	}
+	err := client.Write(context.Background(), []*prompb.TimeSeries{
+		series["first"],
+		series["second"],
+		series["unlabeled"],
+		emulatorSeries("nan_metric", "nan", now, math.NaN()),
+	})
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		matcher  *prompb.LabelMatcher
+		expected []string
+	}{
+		"name_equals":         {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "first_metric"}, expected: []string{"first"}},
+		"name_not_equals":     {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: "__name__", Value: "first_metric"}, expected: []string{"second", "unlabeled"}},
+		"name_regex":          {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "fi.*"}, expected: []string{"first"}},
+		"name_not_regex":      {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "__name__", Value: "fi.*"}, expected: []string{"second", "unlabeled"}},
+		"label_equals":        {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "label", Value: "first"}, expected: []string{"first"}},
+		"label_not_equals":    {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: "label", Value: "first"}, expected: []string{"second", "unlabeled"}},
+		"label_regex_escaped": {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "label", Value: `sec\.nd`}, expected: []string{"second"}},
+		"label_not_regex":     {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "label", Value: "fi.*"}, expected: []string{"second", "unlabeled"}},
+		"label_absent":        {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "label", Value: ""}, expected: []string{"unlabeled"}},
+		"nan_skipped":         {matcher: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "label", Value: "nan"}, expected: []string{}},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, err := client.Read(context.Background(), &prompb.ReadRequest{
+				Queries: []*prompb.Query{{
+					StartTimestampMs: now,
+					EndTimestampMs:   now + 10000,
+					Matchers:         []*prompb.LabelMatcher{testCase.matcher},
+				}},
+			})
+			assert.NoError(t, err)
+			assert.Len(t, result.Results, 1)
+
+			expected := []*prompb.TimeSeries{}
+			for _, name := range testCase.expected {
+				expected = append(expected, series[name])
+			}
+			assert.ElementsMatch(t, expected, result.Results[0].Timeseries)
+		})
+	}
+}
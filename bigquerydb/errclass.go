@@ -0,0 +1,138 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrBadRequest is matched by errors of requests which fail the same way however often
+// they are retried, like read matchers with an invalid regex or an unknown match type,
+// or samples outside of the accepted time range.
+var ErrBadRequest = errors.New("bad request")
+
+// ErrUnavailable is matched by errors of temporary failures which may succeed when
+// retried later, like full queues or buffers or an open circuit breaker.
+var ErrUnavailable = errors.New("bigquery is temporarily unavailable")
+
+// ErrTooLarge is matched by errors of requests which are too large to ever succeed, like
+// a write of more samples than the write buffer holds.
+var ErrTooLarge = errors.New("request too large")
+
+// classError keeps the message of an error and makes it match the sentinel error of its
+// class as well.
+type classError struct {
+	err   error
+	class error
+}
+
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the classified error.
+func (e *classError) Unwrap() error {
+	return e.err
+}
+
+// Is makes the error match the sentinel error of its class.
+func (e *classError) Is(target error) bool {
+	return target == e.class
+}
+
+func badRequest(err error) error {
+	return &classError{err: err, class: ErrBadRequest}
+}
+
+func tooLarge(err error) error {
+	return &classError{err: err, class: ErrTooLarge}
+}
+
+func unavailable(err error) error {
+	return &classError{err: err, class: ErrUnavailable}
+}
+
+// IsUnavailable reports whether the error is a temporary failure, either matching
+// ErrUnavailable or because BigQuery couldn't be reached or failed on its side.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrUnavailable) || isUnavailable(err)
+}
+
+// Reasons of insert errors. BigQuery reports many more reasons, the others are counted as
+// other so that the number of series of the insert error counter stays bounded.
+const (
+	insertErrorInvalid      = "invalid"
+	insertErrorQuota        = "quotaExceeded"
+	insertErrorRateLimit    = "rateLimitExceeded"
+	insertErrorBackendError = "backendError"
+	insertErrorTimeout      = "timeout"
+	insertErrorOther        = "other"
+)
+
+// insertErrorReason classifies the error of an insert which failed as a whole, or the
+// error of a row rejected by an insert.
+func insertErrorReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return insertErrorTimeout
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, e := range apiErr.Errors {
+			if reason := bigqueryErrorReason(e.Reason); reason != insertErrorOther {
+				return reason
+			}
+		}
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			return insertErrorRateLimit
+		case apiErr.Code == http.StatusBadRequest:
+			return insertErrorInvalid
+		case apiErr.Code >= http.StatusInternalServerError:
+			return insertErrorBackendError
+		}
+		return insertErrorOther
+	}
+	var bqErr *bigquery.Error
+	if errors.As(err, &bqErr) {
+		return bigqueryErrorReason(bqErr.Reason)
+	}
+	if s, ok := status.FromError(err); ok && s.Code() == codes.DeadlineExceeded {
+		return insertErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return insertErrorTimeout
+	}
+	return insertErrorOther
+}
+
+// bigqueryErrorReason maps the reason reported by BigQuery to the reason the error is
+// counted as, see https://cloud.google.com/bigquery/docs/error-messages.
+func bigqueryErrorReason(reason string) string {
+	switch reason {
+	case insertErrorInvalid, insertErrorQuota, insertErrorRateLimit, insertErrorBackendError, insertErrorTimeout:
+		return reason
+	case "internalError":
+		return insertErrorBackendError
+	}
+	return insertErrorOther
+}
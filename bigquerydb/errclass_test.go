@@ -0,0 +1,100 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorClasses(t *testing.T) {
+	for _, err := range []error{ErrSampleTooOld, ErrSampleTooNew, ErrNoTenant} {
+		assert.ErrorIs(t, err, ErrBadRequest)
+		assert.NotErrorIs(t, err, ErrUnavailable)
+	}
+	for _, err := range []error{ErrQueueFull, ErrBufferFull, ErrCircuitOpen, &CircuitOpenError{RetryAfter: time.Second}} {
+		assert.ErrorIs(t, err, ErrUnavailable)
+		assert.NotErrorIs(t, err, ErrBadRequest)
+	}
+	assert.ErrorIs(t, &CircuitOpenError{}, ErrCircuitOpen)
+	assert.Equal(t, "bigquery insert queue is full", ErrQueueFull.Error(), "the message is kept")
+
+	wrapped := &WriteError{FailedSamples: 1, Errors: []error{errors.Wrap(ErrSampleTooOld, "sample of up")}}
+	assert.ErrorIs(t, wrapped, ErrBadRequest)
+	assert.ErrorIs(t, wrapped, ErrSampleTooOld)
+}
+
+func TestIsUnavailableClasses(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"queue_full":    {err: &WriteError{Errors: []error{ErrQueueFull}}, expected: true},
+		"circuit_open":  {err: &CircuitOpenError{RetryAfter: time.Second}, expected: true},
+		"backend_error": {err: &googleapi.Error{Code: http.StatusServiceUnavailable}, expected: true},
+		"timeout":       {err: errors.Wrap(context.DeadlineExceeded, "query timeout of 1m exceeded"), expected: true},
+		"bad_request":   {err: ErrSampleTooOld, expected: false},
+		"limit":         {err: newLimitError("range", "too long"), expected: false},
+		"access_denied": {err: &googleapi.Error{Code: http.StatusForbidden}, expected: false},
+		"nil":           {err: nil, expected: false},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, IsUnavailable(testCase.err))
+		})
+	}
+}
+
+func TestInsertErrorReason(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected string
+	}{
+		"row_invalid":     {err: &bigquery.Error{Reason: "invalid", Message: "no such field"}, expected: "invalid"},
+		"row_stopped":     {err: &bigquery.Error{Reason: "stopped"}, expected: "other"},
+		"row_internal":    {err: &bigquery.Error{Reason: "internalError"}, expected: "backendError"},
+		"api_quota":       {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, expected: "quotaExceeded"},
+		"api_rate_limit":  {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, expected: "rateLimitExceeded"},
+		"api_too_many":    {err: &googleapi.Error{Code: http.StatusTooManyRequests}, expected: "rateLimitExceeded"},
+		"api_bad_request": {err: &googleapi.Error{Code: http.StatusBadRequest}, expected: "invalid"},
+		"api_backend":     {err: &googleapi.Error{Code: http.StatusServiceUnavailable, Errors: []googleapi.ErrorItem{{Reason: "backendError"}}}, expected: "backendError"},
+		"api_server":      {err: &googleapi.Error{Code: http.StatusBadGateway}, expected: "backendError"},
+		"api_forbidden":   {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}, expected: "other"},
+		"wrapped_api":     {err: errors.Wrap(&googleapi.Error{Code: http.StatusTooManyRequests}, "insert"), expected: "rateLimitExceeded"},
+		"deadline":        {err: errors.Wrap(context.DeadlineExceeded, "write timeout of 1m exceeded"), expected: "timeout"},
+		"grpc_deadline":   {err: status.Error(codes.DeadlineExceeded, "deadline"), expected: "timeout"},
+		"net_timeout":     {err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, expected: "timeout"},
+		"unclassified":    {err: errors.New("connection reset"), expected: "other"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, insertErrorReason(testCase.err))
+		})
+	}
+}
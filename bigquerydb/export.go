@@ -0,0 +1,90 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/api/iterator"
+)
+
+// ExportStats summarizes the rows returned by Export.
+type ExportStats struct {
+	Series         int
+	Samples        int
+	BytesProcessed int64
+}
+
+// Export runs the query and passes every row to fn as it is read, sorted by series and
+// then by timestamp, so that exports larger than the memory of the process are possible.
+// The labels of a series are shared by all its rows and must not be modified. Unlike
+// Read, Export has no timeout and no limit on the returned rows.
+func (c *BigqueryClient) Export(ctx context.Context, q *prompb.Query, fn func(labels []*prompb.Label, sample prompb.Sample) error) (*ExportStats, error) {
+	command, params, err := c.buildOrderedCommand(q, "metricname, "+c.tagsSortSQL()+", timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	conn := c.acquire()
+	defer conn.release()
+	c.sqlQueryCount.Inc()
+	iter, err := c.querier.Read(ctx, c.newQuery(conn, command, params))
+	if err != nil {
+		return nil, c.translateQueryError(q, err)
+	}
+
+	stats := &ExportStats{}
+	// As the rows are sorted by series, only the labels of the current one are kept.
+	var key string
+	var labels []*prompb.Label
+	row := make(map[string]bigquery.Value, 4)
+	for {
+		err := iter.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				c.cancelJob(iter)
+			}
+			return nil, err
+		}
+
+		sample, err := rowSample(row)
+		if err != nil {
+			return nil, err
+		}
+		if rowKey := seriesKey(row); labels == nil || rowKey != key {
+			if _, _, labels, err = rowToSample(row); err != nil {
+				return nil, err
+			}
+			key = rowKey
+			stats.Series++
+		}
+		if err := fn(labels, sample); err != nil {
+			return nil, errors.Wrap(err, "failed to export sample")
+		}
+		stats.Samples++
+	}
+
+	if job := queryJob(iter); job != nil {
+		if status := job.LastStatus(); status != nil && status.Statistics != nil {
+			stats.BytesProcessed = status.Statistics.TotalBytesProcessed
+		}
+	}
+	return stats, nil
+}
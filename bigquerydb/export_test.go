@@ -0,0 +1,77 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"api"}`, 2000, 0),
+		testRow("up", `{"job":"web"}`, 1000, 1),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithMaxBytesBilled(1<<30), WithMaxRows(1))
+	q := &prompb.Query{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}
+
+	type exported struct {
+		labels []*prompb.Label
+		sample prompb.Sample
+	}
+	var samples []exported
+	stats, err := c.Export(context.Background(), q, func(labels []*prompb.Label, sample prompb.Sample) error {
+		samples = append(samples, exported{labels: labels, sample: sample})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &ExportStats{Series: 2, Samples: 3}, stats, "the row limit of reads doesn't apply")
+
+	api := []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}
+	web := []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "web"}}
+	assert.Equal(t, []exported{
+		{labels: api, sample: prompb.Sample{Timestamp: 1000, Value: 1}},
+		{labels: api, sample: prompb.Sample{Timestamp: 2000, Value: 0}},
+		{labels: web, sample: prompb.Sample{Timestamp: 1000, Value: 1}},
+	}, samples)
+
+	assert.Len(t, querier.queries, 1)
+	assert.True(t, strings.HasSuffix(querier.queries[0].Q, "ORDER BY metricname, tags, timestamp"), querier.queries[0].Q)
+	assert.Equal(t, int64(1<<30), querier.queries[0].MaxBytesBilled)
+}
+
+func TestExportErrors(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{err: errors.New("access denied")}))
+	_, err := c.Export(context.Background(), &prompb.Query{}, nil)
+	assert.ErrorContains(t, err, "access denied")
+
+	c = newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: []map[string]bigquery.Value{testRow("up", `{}`, 1000, 1)}}))
+	_, err = c.Export(context.Background(), &prompb.Query{}, func([]*prompb.Label, prompb.Sample) error {
+		return errors.New("disk full")
+	})
+	assert.ErrorContains(t, err, "disk full")
+}
@@ -0,0 +1,391 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/promslog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"google.golang.org/api/iterator"
+)
+
+// fakeInserter records the rows of every Put call.
+type fakeInserter struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	err      error
+	puts     [][]*Item
+	inFlight int
+	maxConc  int
+}
+
+func (f *fakeInserter) Put(ctx context.Context, src interface{}) error {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxConc {
+		f.maxConc = f.inFlight
+	}
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			f.mu.Lock()
+			f.inFlight--
+			f.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+	if f.err != nil {
+		return f.err
+	}
+	f.puts = append(f.puts, src.([]*Item))
+	return nil
+}
+
+func (f *fakeInserter) rows() []*Item {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rows []*Item
+	for _, p := range f.puts {
+		rows = append(rows, p...)
+	}
+	return rows
+}
+
+// failingInserter fails the Put call with the given index and records all others.
+type failingInserter struct {
+	*fakeInserter
+	failOn int
+	calls  int
+}
+
+func (f *failingInserter) Put(ctx context.Context, src interface{}) error {
+	f.mu.Lock()
+	call := f.calls
+	f.calls++
+	f.mu.Unlock()
+	if call == f.failOn {
+		return errors.New("insert failed")
+	}
+	return f.fakeInserter.Put(ctx, src)
+}
+
+// newTestClient returns a client writing to the given fake inserter.
+func newTestClient(ins Inserter, opts ...Option) *BigqueryClient {
+	c := newClient(promslog.NewNopLogger(), "dataset", "table", time.Minute, opts...)
+	c.inserter = ins
+	return c
+}
+
+// newTestQuery creates the query for the command on the current connection.
+func (c *BigqueryClient) newTestQuery(command string, params []bigquery.QueryParameter) *bigquery.Query {
+	return c.newQuery(c.conn, command, params)
+}
+
+// metricValue returns the value of a counter or gauge.
+func metricValue(m prometheus.Metric) float64 {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		panic(err)
+	}
+	if out.Counter != nil {
+		return out.Counter.GetValue()
+	}
+	return out.Gauge.GetValue()
+}
+
+// fakeRowIterator returns the given rows.
+type fakeRowIterator struct {
+	rows []map[string]bigquery.Value
+	pos  int
+}
+
+func (f *fakeRowIterator) IsAccelerated() bool {
+	return false
+}
+
+func (f *fakeRowIterator) Next(dst interface{}) error {
+	if f.pos >= len(f.rows) {
+		return iterator.Done
+	}
+	row := dst.(*map[string]bigquery.Value)
+	for k, v := range f.rows[f.pos] {
+		(*row)[k] = v
+	}
+	f.pos++
+	return nil
+}
+
+// fakeJobIterator returns the given rows, like the results of a query job with the given
+// statistics.
+type fakeJobIterator struct {
+	fakeRowIterator
+	stats    *bigquery.JobStatistics
+	statsErr error
+}
+
+func (f *fakeJobIterator) jobStatistics(ctx context.Context) (*bigquery.JobStatistics, error) {
+	return f.stats, f.statsErr
+}
+
+// fakeQuerier records the queries it runs and returns the given rows for each of them
+// after the delay. Queries with stats or statsErr set are run like query jobs.
+type fakeQuerier struct {
+	rows     []map[string]bigquery.Value
+	err      error
+	delay    time.Duration
+	stats    *bigquery.JobStatistics
+	statsErr error
+	queries  []*bigquery.Query
+}
+
+func (f *fakeQuerier) Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error) {
+	f.queries = append(f.queries, query)
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.stats != nil || f.statsErr != nil {
+		return &fakeJobIterator{fakeRowIterator: fakeRowIterator{rows: f.rows}, stats: f.stats, statsErr: f.statsErr}, nil
+	}
+	return &fakeRowIterator{rows: f.rows}, nil
+}
+
+// blockingQuerier returns iterators which block until the context of the query is done,
+// like a query job still running in BigQuery.
+type blockingQuerier struct {
+	mu        sync.Mutex
+	cancelled int
+	// waiting blocks Read instead, like a query job which didn't finish before its results are read.
+	waiting bool
+	// finished returns iterators without rows, which don't block.
+	finished bool
+}
+
+func (f *blockingQuerier) Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error) {
+	if f.waiting {
+		<-ctx.Done()
+		return nil, &fakeJobError{err: ctx.Err(), querier: f}
+	}
+	return &blockingRowIterator{ctx: ctx, querier: f}, nil
+}
+
+// fakeJobError is the error of a query job abandoned while waiting for its results.
+type fakeJobError struct {
+	err     error
+	querier *blockingQuerier
+}
+
+func (e *fakeJobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fakeJobError) Unwrap() error {
+	return e.err
+}
+
+func (e *fakeJobError) jobID() string {
+	return "job-waiting"
+}
+
+func (e *fakeJobError) cancelJob(ctx context.Context) error {
+	return e.querier.cancelJob()
+}
+
+func (f *blockingQuerier) cancelJob() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelled++
+	return nil
+}
+
+// blockingRowIterator blocks on Next until its context is done and records when its
+// job is cancelled.
+type blockingRowIterator struct {
+	ctx     context.Context
+	querier *blockingQuerier
+}
+
+func (f *blockingRowIterator) IsAccelerated() bool {
+	return false
+}
+
+func (f *blockingRowIterator) Next(dst interface{}) error {
+	if f.querier.finished {
+		return iterator.Done
+	}
+	<-f.ctx.Done()
+	return f.ctx.Err()
+}
+
+func (f *blockingRowIterator) jobID() string {
+	return "job-reading"
+}
+
+func (f *blockingRowIterator) cancelJob(ctx context.Context) error {
+	return f.querier.cancelJob()
+}
+
+// syntheticRowIterator generates n rows spread round-robin over the given number of series,
+// sorted by timestamp unless reversed.
+type syntheticRowIterator struct {
+	n        int
+	tags     []string
+	pos      int
+	reversed bool
+}
+
+func newSyntheticRowIterator(n, series int) *syntheticRowIterator {
+	it := &syntheticRowIterator{n: n}
+	for i := 0; i < series; i++ {
+		it.tags = append(it.tags, fmt.Sprintf(`{"instance":"host-%d","job":"node"}`, i))
+	}
+	return it
+}
+
+func (s *syntheticRowIterator) Next(dst interface{}) error {
+	if s.pos >= s.n {
+		return iterator.Done
+	}
+	pos := s.pos
+	if s.reversed {
+		pos = s.n - 1 - s.pos
+	}
+	row := dst.(*map[string]bigquery.Value)
+	(*row)["metricname"] = "node_cpu_seconds_total"
+	(*row)["tags"] = s.tags[pos%len(s.tags)]
+	(*row)["timestamp"] = int64(pos / len(s.tags) * 15000)
+	(*row)["value"] = float64(pos)
+	s.pos++
+	return nil
+}
+
+func testRow(metricname, tags string, timestamp int64, value float64) map[string]bigquery.Value {
+	return map[string]bigquery.Value{
+		"metricname": metricname,
+		"tags":       tags,
+		"timestamp":  timestamp,
+		"value":      value,
+	}
+}
+
+// spanRecorder is a tracer provider recording the spans started by its tracers.
+type spanRecorder struct {
+	embedded.TracerProvider
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+// newSpanRecorder installs a span recorder as the global tracer provider.
+func newSpanRecorder() *spanRecorder {
+	r := &spanRecorder{}
+	otel.SetTracerProvider(r)
+	return r
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{recorder: r}
+}
+
+// named returns the recorded spans with the given name.
+func (r *spanRecorder) named(name string) []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*recordedSpan
+	for _, s := range r.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	recorder *spanRecorder
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent, _ := trace.SpanFromContext(ctx).(*recordedSpan)
+	cfg := trace.NewSpanStartConfig(opts...)
+	s := &recordedSpan{
+		Span:   trace.SpanFromContext(context.Background()),
+		name:   name,
+		parent: parent,
+		attrs:  cfg.Attributes(),
+	}
+	t.recorder.mu.Lock()
+	t.recorder.spans = append(t.recorder.spans, s)
+	t.recorder.mu.Unlock()
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// recordedSpan records its attributes and whether it was ended.
+type recordedSpan struct {
+	trace.Span
+	name   string
+	parent *recordedSpan
+	mu     sync.Mutex
+	attrs  []attribute.KeyValue
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+}
+
+// attr returns the value of the attribute with the given key.
+func (s *recordedSpan) attr(key string) attribute.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, kv := range s.attrs {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
@@ -0,0 +1,534 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBigQuery is an in-process table which stores the rows inserted into it and
+// evaluates the queries generated by buildCommand against them. It only understands
+// the shapes of the conditions buildCommand generates and fails every other query, so
+// that a new shape can't silently match all rows.
+type fakeBigQuery struct {
+	mu        sync.Mutex
+	rows      []*Item
+	insertIDs map[string]bool
+	// aggregates are the rows of the downsampled tables, which are told apart by the
+	// queries of read resolutions by their interval only.
+	aggregates []*aggregateRow
+}
+
+var (
+	fakeSelect     = regexp.MustCompile(`^SELECT metricname, (tags|TO_JSON_STRING\(tags\) AS tags|labels), (?:UNIX_MILLIS\(timestamp\) as timestamp|timestamp), value(, special_value)?(, series_hash)? FROM \S+ WHERE (.+?)( QUALIFY ROW_NUMBER\(\) OVER \(PARTITION BY metricname, (?:tags|TO_JSON_STRING\(tags\)|TO_JSON_STRING\(labels\)), timestamp ORDER BY value NULLS LAST\) = 1)?( ORDER BY timestamp)?$`)
+	fakeTimestamp  = regexp.MustCompile(`^timestamp (>=|<=) (?:TIMESTAMP_MILLIS\()?@(\w+)\)?$`)
+	fakeCompare    = regexp.MustCompile(`^(.+) (=|!=) @(\w+)$`)
+	fakeIn         = regexp.MustCompile(`^(.+?) (NOT )?IN UNNEST\(@(\w+)\)$`)
+	fakeRegex      = regexp.MustCompile(`^(not )?REGEXP_CONTAINS\((.+), @(\w+)\)$`)
+	fakeTagValue   = regexp.MustCompile(`^IFNULL\(JSON_VALUE\(tags, '\$\."([^"]+)"'\), ''\)$`)
+	fakeLabelMatch = regexp.MustCompile(`^(NOT )?EXISTS\(SELECT 1 FROM UNNEST\(labels\) l WHERE l\.name = @(\w+) AND (.+)\)$`)
+	fakeValues     = regexp.MustCompile(`^SELECT DISTINCT (metricname|IFNULL\(JSON_VALUE\(tags, '\$\."[^"]+"'\), ''\)|\(SELECT l\.value FROM UNNEST\(labels\) l WHERE l\.name = @label LIMIT 1\)) AS value FROM \S+ WHERE (.+)$`)
+	fakeAggregate  = regexp.MustCompile(`^SELECT metricname, tags, UNIX_MILLIS\(timestamp\) AS timestamp, SAFE_DIVIDE\(SUM\(avg \* count\), SUM\(count\)\) AS value FROM \S+ WHERE (.+) GROUP BY metricname, tags, timestamp( ORDER BY timestamp)?$`)
+	fakeSeries     = regexp.MustCompile(`^SELECT DISTINCT metricname, (tags|TO_JSON_STRING\(tags\) AS tags|TO_JSON_STRING\(labels\) AS labels) FROM \S+ WHERE (.+)$`)
+)
+
+// Put stores the rows. Rows with an insert ID which was already inserted are dropped,
+// like BigQuery does on a best effort basis.
+func (f *fakeBigQuery) Put(ctx context.Context, src interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rows, ok := src.([]*aggregateRow); ok {
+		f.aggregates = append(f.aggregates, rows...)
+		return nil
+	}
+	if f.insertIDs == nil {
+		f.insertIDs = make(map[string]bool)
+	}
+	for _, item := range src.([]*Item) {
+		if item.insertID != "" {
+			if f.insertIDs[item.insertID] {
+				continue
+			}
+			f.insertIDs[item.insertID] = true
+		}
+		f.rows = append(f.rows, item)
+	}
+	return nil
+}
+
+// Read evaluates the query against the stored rows.
+func (f *fakeBigQuery) Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error) {
+	params := make(map[string]interface{}, len(query.Parameters))
+	for _, p := range query.Parameters {
+		params[p.Name] = p.Value
+	}
+	if match := fakeValues.FindStringSubmatch(query.Q); match != nil {
+		return f.readLabelValues(match[1], match[2], params)
+	}
+	if match := fakeSeries.FindStringSubmatch(query.Q); match != nil {
+		return f.readSeries(match[1], match[2], params)
+	}
+	if match := fakeAggregate.FindStringSubmatch(query.Q); match != nil {
+		return f.readAggregates(match[1], params, match[2] != "")
+	}
+	match := fakeSelect.FindStringSubmatch(query.Q)
+	if match == nil {
+		return nil, errors.Errorf("fake bigquery can't run the query %q", query.Q)
+	}
+	selected, err := f.selectRows(match[4], params)
+	if err != nil {
+		return nil, err
+	}
+	if match[5] != "" {
+		selected = fakeDeduplicate(selected)
+	}
+	if match[6] != "" {
+		sort.SliceStable(selected, func(i, j int) bool { return itemMillis(selected[i]) < itemMillis(selected[j]) })
+	}
+
+	it := &fakeRowIterator{}
+	for _, item := range selected {
+		row := map[string]bigquery.Value{
+			"metricname": item.metricname,
+			"timestamp":  itemMillis(item),
+			"value":      item.value,
+		}
+		if item.stale {
+			row["value"] = nil
+		}
+		if match[2] != "" {
+			row[specialValueColumn] = nil
+			if item.special != "" {
+				row["value"] = nil
+				row[specialValueColumn] = item.special
+			}
+		}
+		if match[3] != "" {
+			row[seriesHashColumn] = int64(item.seriesHash)
+		}
+		if match[1] == "labels" {
+			labels := make([]bigquery.Value, 0, len(item.labels))
+			for _, l := range item.labels {
+				labels = append(labels, map[string]bigquery.Value{"name": l.Name, "value": l.Value})
+			}
+			row["labels"] = labels
+		} else {
+			row["tags"] = item.tags
+		}
+		it.rows = append(it.rows, row)
+	}
+	return it, nil
+}
+
+// selectRows returns the stored rows matching the conditions of the WHERE clause.
+func (f *fakeBigQuery) selectRows(where string, params map[string]interface{}) ([]*Item, error) {
+	var conditions []func(*Item) bool
+	for _, sql := range splitConditions(where) {
+		condition, err := fakeCondition(sql, params)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var selected []*Item
+	for _, item := range f.rows {
+		matches := true
+		for _, condition := range conditions {
+			matches = matches && condition(item)
+		}
+		if matches {
+			selected = append(selected, item)
+		}
+	}
+	return selected, nil
+}
+
+// readLabelValues evaluates a query of the distinct values of the column, which is the
+// metric name or a label.
+func (f *fakeBigQuery) readLabelValues(column, where string, params map[string]interface{}) (QueryIterator, error) {
+	selected, err := f.selectRows(where, params)
+	if err != nil {
+		return nil, err
+	}
+	value := func(item *Item) string { return item.metricname }
+	if m := fakeTagValue.FindStringSubmatch(column); m != nil {
+		value = func(item *Item) string {
+			var tags map[string]string
+			_ = json.Unmarshal([]byte(item.tags), &tags)
+			return tags[m[1]]
+		}
+	} else if column != "metricname" {
+		name, _ := params["label"].(string)
+		value = func(item *Item) string {
+			for _, l := range item.labels {
+				if l.Name == name {
+					return l.Value
+				}
+			}
+			return ""
+		}
+	}
+
+	it := &fakeRowIterator{}
+	seen := map[string]bool{}
+	for _, item := range selected {
+		if v := value(item); !seen[v] {
+			seen[v] = true
+			it.rows = append(it.rows, map[string]bigquery.Value{"value": v})
+		}
+	}
+	return it, nil
+}
+
+// readSeries evaluates a query of the distinct metric names and labels, which are
+// selected as JSON from the labels column.
+func (f *fakeBigQuery) readSeries(column, where string, params map[string]interface{}) (QueryIterator, error) {
+	selected, err := f.selectRows(where, params)
+	if err != nil {
+		return nil, err
+	}
+	it := &fakeRowIterator{}
+	seen := map[string]bool{}
+	for _, item := range selected {
+		row := map[string]bigquery.Value{"metricname": item.metricname, "tags": item.tags}
+		if strings.HasSuffix(column, "labels") {
+			labels, err := json.Marshal(item.labels)
+			if err != nil {
+				return nil, err
+			}
+			row = map[string]bigquery.Value{"metricname": item.metricname, "labels": string(labels)}
+		}
+		if key := fmt.Sprint(row); !seen[key] {
+			seen[key] = true
+			it.rows = append(it.rows, row)
+		}
+	}
+	return it, nil
+}
+
+// readAggregates evaluates a query of the samples of a downsampled table, which merges
+// the rows of every series and interval into the average weighted by their counts.
+func (f *fakeBigQuery) readAggregates(where string, params map[string]interface{}, ordered bool) (QueryIterator, error) {
+	var conditions []func(*Item) bool
+	for _, sql := range splitConditions(where) {
+		condition, err := fakeCondition(sql, params)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	type group struct {
+		row        *aggregateRow
+		sum, count float64
+	}
+	var groups []*group
+	byKey := map[string]*group{}
+	for _, r := range f.aggregates {
+		item := &Item{metricname: r.metricname, tags: r.tags, timestamp: r.start}
+		matches := true
+		for _, condition := range conditions {
+			matches = matches && condition(item)
+		}
+		if !matches {
+			continue
+		}
+		key := fmt.Sprintf("%s\xff%s\xff%d", r.metricname, r.tags, r.start)
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{row: r}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.sum += r.sum
+		g.count += float64(r.count)
+	}
+	if ordered {
+		sort.SliceStable(groups, func(i, j int) bool { return groups[i].row.start < groups[j].row.start })
+	}
+
+	it := &fakeRowIterator{}
+	for _, g := range groups {
+		it.rows = append(it.rows, map[string]bigquery.Value{
+			"metricname": g.row.metricname,
+			"tags":       g.row.tags,
+			"timestamp":  g.row.start * 1000,
+			"value":      g.sum / g.count,
+		})
+	}
+	return it, nil
+}
+
+// fakeDeduplicate keeps the row with the lowest value of every series and timestamp, like
+// the QUALIFY clause of deduplicated reads. Rows with a NULL value are only kept if there
+// is no other.
+func fakeDeduplicate(items []*Item) []*Item {
+	isNull := func(item *Item) bool { return item.stale || item.special != "" }
+	kept := make(map[string]int, len(items))
+	var deduplicated []*Item
+	for _, item := range items {
+		key := fmt.Sprintf("%s\xff%s\xff%v\xff%d", item.metricname, item.tags, item.labels, itemMillis(item))
+		i, ok := kept[key]
+		if !ok {
+			kept[key] = len(deduplicated)
+			deduplicated = append(deduplicated, item)
+			continue
+		}
+		if other := deduplicated[i]; isNull(other) && !isNull(item) || !isNull(other) && !isNull(item) && item.value < other.value {
+			deduplicated[i] = item
+		}
+	}
+	return deduplicated
+}
+
+// splitConditions splits the WHERE clause at the ANDs which aren't nested in parentheses
+// or quoted.
+func splitConditions(where string) []string {
+	var conditions []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(where); i++ {
+		switch {
+		case where[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case where[i] == '(':
+			depth++
+		case where[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(where[i:], " AND "):
+			conditions = append(conditions, where[start:i])
+			start = i + len(" AND ")
+			i = start - 1
+		}
+	}
+	return append(conditions, where[start:])
+}
+
+// fakeCondition returns the condition of the WHERE clause as a function of a row.
+func fakeCondition(sql string, params map[string]interface{}) (func(*Item) bool, error) {
+	if sql == matchNothingSQL {
+		return func(*Item) bool { return false }, nil
+	}
+	if m := fakeTimestamp.FindStringSubmatch(sql); m != nil {
+		bound, ok := params[m[2]].(int64)
+		if !ok {
+			return nil, errors.Errorf("parameter %s is not a timestamp", m[2])
+		}
+		if m[1] == ">=" {
+			return func(item *Item) bool { return itemMillis(item) >= bound }, nil
+		}
+		return func(item *Item) bool { return itemMillis(item) <= bound }, nil
+	}
+
+	if m := fakeLabelMatch.FindStringSubmatch(sql); m != nil {
+		name, _ := params[m[2]].(string)
+		inner := m[3]
+		negated := m[1] != ""
+		if negated {
+			if !strings.HasPrefix(inner, "NOT (") || !strings.HasSuffix(inner, ")") {
+				return nil, errors.Errorf("fake bigquery can't evaluate %q", sql)
+			}
+			inner = strings.TrimSuffix(strings.TrimPrefix(inner, "NOT ("), ")")
+		}
+		column, compare, err := fakeComparison(inner, params)
+		if err != nil || column != "l.value" {
+			return nil, errors.Errorf("fake bigquery can't evaluate %q", sql)
+		}
+		return func(item *Item) bool {
+			for _, l := range item.labels {
+				if l.Name == name && compare(l.Value) != negated {
+					return !negated
+				}
+			}
+			return negated
+		}, nil
+	}
+
+	column, compare, err := fakeComparison(sql, params)
+	if err != nil {
+		return nil, err
+	}
+	if column == "metricname" {
+		return func(item *Item) bool { return compare(item.metricname) }, nil
+	}
+	m := fakeTagValue.FindStringSubmatch(column)
+	if m == nil {
+		return nil, errors.Errorf("fake bigquery can't evaluate the column %q", column)
+	}
+	return func(item *Item) bool {
+		var tags map[string]string
+		if err := json.Unmarshal([]byte(item.tags), &tags); err != nil {
+			return false
+		}
+		return compare(tags[m[1]])
+	}, nil
+}
+
+// fakeComparison returns the column a comparison or a regex match is evaluated on and
+// the comparison of its value.
+func fakeComparison(sql string, params map[string]interface{}) (string, func(string) bool, error) {
+	if m := fakeRegex.FindStringSubmatch(sql); m != nil {
+		pattern, _ := params[m[3]].(string)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "invalid regex in %q", sql)
+		}
+		negated := m[1] != ""
+		return m[2], func(v string) bool { return re.MatchString(v) != negated }, nil
+	}
+	if m := fakeIn.FindStringSubmatch(sql); m != nil {
+		values, ok := params[m[3]].([]string)
+		if !ok {
+			return "", nil, errors.Errorf("parameter %s is not a list", m[3])
+		}
+		negated := m[2] != ""
+		return m[1], func(v string) bool { return slices.Contains(values, v) != negated }, nil
+	}
+	if m := fakeCompare.FindStringSubmatch(sql); m != nil {
+		value, _ := params[m[3]].(string)
+		if m[2] == "=" {
+			return m[1], func(v string) bool { return v == value }, nil
+		}
+		return m[1], func(v string) bool { return v != value }, nil
+	}
+	return "", nil, errors.Errorf("fake bigquery can't evaluate %q", sql)
+}
+
+// newFakeBigQueryClient returns a client writing to and reading from a fake BigQuery table.
+func newFakeBigQueryClient(opts ...Option) *BigqueryClient {
+	fake := &fakeBigQuery{}
+	return newTestClient(fake, append(opts, WithQuerier(fake))...)
+}
+
+// TestLabelMatchersFakeBigQuery runs the matrix of TestLabelMatchers, which needs a real
+// BigQuery table, against the fake for every type of the tags column.
+func TestLabelMatchersFakeBigQuery(t *testing.T) {
+	nowUnix := time.Now().Unix() * 1000
+
+	timeseriesData := map[string][]*prompb.TimeSeries{
+		"first": {{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "first_metric"}, {Name: "label", Value: "first"}},
+			Samples: []prompb.Sample{{Timestamp: nowUnix, Value: 1}},
+		}},
+		"second": {{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "second_metric"}, {Name: "label", Value: "second"}},
+			Samples: []prompb.Sample{{Timestamp: nowUnix, Value: 1}},
+		}},
+		"nan": {{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "nan_metric"}, {Name: "label", Value: "NaN"}},
+			Samples: []prompb.Sample{{Timestamp: nowUnix, Value: math.NaN()}},
+		}},
+		"emptyResult": {},
+	}
+
+	testCases := map[string]struct {
+		matchName      string
+		matchValue     string
+		matchType      prompb.LabelMatcher_Type
+		expectedResult string
+	}{
+		"metric_name_equals":          {matchName: "__name__", matchValue: "first_metric", matchType: prompb.LabelMatcher_EQ, expectedResult: "first"},
+		"metric_name_not_equals":      {matchName: "__name__", matchValue: "first_metric", matchType: prompb.LabelMatcher_NEQ, expectedResult: "second"},
+		"metric_name_regex_match":     {matchName: "__name__", matchValue: "fi.*", matchType: prompb.LabelMatcher_RE, expectedResult: "first"},
+		"metric_name_regex_not_equal": {matchName: "__name__", matchValue: "fi.*", matchType: prompb.LabelMatcher_NRE, expectedResult: "second"},
+		"label_equals":                {matchName: "label", matchValue: "first", matchType: prompb.LabelMatcher_EQ, expectedResult: "first"},
+		"label_not_equals":            {matchName: "label", matchValue: "first", matchType: prompb.LabelMatcher_NEQ, expectedResult: "second"},
+		"label_regex_match":           {matchName: "label", matchValue: "fi.*", matchType: prompb.LabelMatcher_RE, expectedResult: "first"},
+		"label_regex_not_equal":       {matchName: "label", matchValue: "fi.*", matchType: prompb.LabelMatcher_NRE, expectedResult: "second"},
+		"nan_timeseries_sample_value": {matchName: "label", matchValue: "NaN", matchType: prompb.LabelMatcher_EQ, expectedResult: "emptyResult"},
+	}
+
+	for _, tagsType := range []string{TagsTypeString, TagsTypeJSON, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTagsType(tagsType))
+			for _, timeseries := range timeseriesData {
+				assert.NoError(t, c.Write(context.Background(), timeseries))
+			}
+
+			for name, testCase := range testCases {
+				t.Run(name, func(t *testing.T) {
+					request := prompb.ReadRequest{
+						Queries: []*prompb.Query{{
+							StartTimestampMs: nowUnix,
+							EndTimestampMs:   nowUnix + 10000,
+							Matchers:         []*prompb.LabelMatcher{{Type: testCase.matchType, Name: testCase.matchName, Value: testCase.matchValue}},
+						}},
+					}
+					result, err := c.Read(context.Background(), &request)
+					assert.NoError(t, err)
+					if assert.Len(t, result.Results, 1) {
+						assert.Equal(t, timeseriesData[testCase.expectedResult], result.Results[0].Timeseries)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestFakeBigQueryTimeRange(t *testing.T) {
+	c := newFakeBigQueryClient(WithDeduplication(true))
+	now := time.Now().Unix() * 1000
+	series := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: now - 60000, Value: 1}, {Timestamp: now - 30000, Value: 2}, {Timestamp: now, Value: 3}},
+	}
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{series}))
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{series}), "retried writes are deduplicated")
+
+	result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: now - 30000,
+		EndTimestampMs:   now,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Results, 1) && assert.Len(t, result.Results[0].Timeseries, 1) {
+		assert.Equal(t, []prompb.Sample{{Timestamp: now - 30000, Value: 2}, {Timestamp: now, Value: 3}}, result.Results[0].Timeseries[0].Samples)
+	}
+}
+
+func TestFakeBigQueryUnknownQuery(t *testing.T) {
+	_, err := (&fakeBigQuery{}).Read(context.Background(), &bigquery.Query{QueryConfig: bigquery.QueryConfig{Q: "SELECT 1"}})
+	assert.Error(t, err)
+}
+
+// itemMillis returns the timestamp of the row in milliseconds, like the SQL of read queries
+// selects it from either type of the timestamp column.
+func itemMillis(item *Item) int64 {
+	if item.timestampMs != 0 {
+		return item.timestampMs
+	}
+	return item.timestamp * 1000
+}
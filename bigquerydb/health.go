@@ -0,0 +1,126 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classes of the errors of failed writes and reads, as exposed by the last error metrics.
+const (
+	errorClassBadRequest    = "bad_request"
+	errorClassLimitExceeded = "limit_exceeded"
+	errorClassQuota         = "quota_exceeded"
+	errorClassTimeout       = "timeout"
+	errorClassUnavailable   = "unavailable"
+	errorClassOther         = "other"
+)
+
+// errorClass classifies the error of a failed write or read like the status code the
+// adapter answers it with.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrBadRequest), errors.Is(err, ErrTooLarge):
+		return errorClassBadRequest
+	case errors.Is(err, ErrLimitExceeded):
+		return errorClassLimitExceeded
+	case IsQuotaExceeded(err):
+		return errorClassQuota
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorClassTimeout
+	case IsUnavailable(err):
+		return errorClassUnavailable
+	}
+	return errorClassOther
+}
+
+// operationHealth tracks when the writes or reads of a client last succeeded and failed
+// and how many failed in a row, so that alerts on a backend not being written to don't
+// depend on rates, which misfire at low traffic.
+type operationHealth struct {
+	lastSuccess         prometheus.Gauge
+	lastFailure         prometheus.Gauge
+	consecutiveFailures prometheus.Gauge
+	lastError           *prometheus.GaugeVec
+
+	// mu keeps the streak and the class of the last error consistent.
+	mu       sync.Mutex
+	failures int
+}
+
+// newOperationHealth creates the metrics of the operation, write or read.
+func newOperationHealth(f metricfactory.Factory, operation string) *operationHealth {
+	return &operationHealth{
+		lastSuccess: f.NewGauge(prometheus.GaugeOpts{
+			Name: "last_successful_" + operation + "_timestamp_seconds",
+			Help: "Unix time of the last successful " + operation + " of the table.",
+		}),
+		lastFailure: f.NewGauge(prometheus.GaugeOpts{
+			Name: "last_failed_" + operation + "_timestamp_seconds",
+			Help: "Unix time of the last failed " + operation + " of the table.",
+		}),
+		consecutiveFailures: f.NewGauge(prometheus.GaugeOpts{
+			Name: "consecutive_" + operation + "_failures",
+			Help: "Number of " + operation + "s of the table which failed since the last successful one.",
+		}),
+		lastError: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "last_" + operation + "_error_info",
+			Help: "Class of the error of the last failed " + operation + " of the table, which is always 1.",
+		}, []string{"class"}),
+	}
+}
+
+// record records the outcome of a write or read. Operations cancelled by their caller
+// neither succeeded nor failed.
+func (h *operationHealth) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.failures = 0
+		h.consecutiveFailures.Set(0)
+		h.lastSuccess.SetToCurrentTime()
+		return
+	}
+	h.failures++
+	h.consecutiveFailures.Set(float64(h.failures))
+	h.lastFailure.SetToCurrentTime()
+	h.lastError.Reset()
+	h.lastError.WithLabelValues(errorClass(err)).Set(1)
+}
+
+// Describe implements prometheus.Collector.
+func (h *operationHealth) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.lastSuccess.Desc()
+	ch <- h.lastFailure.Desc()
+	ch <- h.consecutiveFailures.Desc()
+	h.lastError.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (h *operationHealth) Collect(ch chan<- prometheus.Metric) {
+	ch <- h.lastSuccess
+	ch <- h.lastFailure
+	ch <- h.consecutiveFailures
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastError.Collect(ch)
+}
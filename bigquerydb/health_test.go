@@ -0,0 +1,116 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestWriteHealthMetrics(t *testing.T) {
+	ins := &switchableInserter{}
+	c := newTestClient(ins)
+
+	before := scrape(t, c)
+	assert.Equal(t, 0.0, before["storage_bigquery_last_successful_write_timestamp_seconds"])
+	assert.Equal(t, 0.0, before["storage_bigquery_consecutive_write_failures"])
+
+	assert.NoError(t, writeUp(c))
+	values := scrape(t, c)
+	lastSuccess := values["storage_bigquery_last_successful_write_timestamp_seconds"]
+	assert.NotZero(t, lastSuccess)
+	assert.Equal(t, 0.0, values["storage_bigquery_last_failed_write_timestamp_seconds"])
+
+	ins.err = errUnavailable
+	for i := 1; i <= 3; i++ {
+		assert.Error(t, writeUp(c))
+		values = scrape(t, c)
+		assert.Equal(t, float64(i), values["storage_bigquery_consecutive_write_failures"])
+	}
+	assert.NotZero(t, values["storage_bigquery_last_failed_write_timestamp_seconds"])
+	assert.Equal(t, lastSuccess, values["storage_bigquery_last_successful_write_timestamp_seconds"])
+	assert.Equal(t, 1.0, values[`storage_bigquery_last_write_error_info{class="unavailable"}`])
+
+	// Only the class of the last error is exposed.
+	ins.err = badRequest(errors.New("invalid row"))
+	assert.Error(t, writeUp(c))
+	values = scrape(t, c)
+	assert.Equal(t, 4.0, values["storage_bigquery_consecutive_write_failures"])
+	assert.Equal(t, 1.0, values[`storage_bigquery_last_write_error_info{class="bad_request"}`])
+	assert.NotContains(t, values, `storage_bigquery_last_write_error_info{class="unavailable"}`)
+
+	// A success ends the streak but keeps the last failure.
+	ins.err = nil
+	assert.NoError(t, writeUp(c))
+	values = scrape(t, c)
+	assert.Equal(t, 0.0, values["storage_bigquery_consecutive_write_failures"])
+	assert.NotZero(t, values["storage_bigquery_last_failed_write_timestamp_seconds"])
+	assert.Equal(t, 1.0, values[`storage_bigquery_last_write_error_info{class="bad_request"}`])
+}
+
+func TestReadHealthMetrics(t *testing.T) {
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{testRow("up", `{}`, 1000, 1)}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+	read := func() error {
+		_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{}}})
+		return err
+	}
+
+	assert.NoError(t, read())
+	values := scrape(t, c)
+	assert.NotZero(t, values["storage_bigquery_last_successful_read_timestamp_seconds"])
+	assert.Equal(t, 0.0, values["storage_bigquery_consecutive_read_failures"])
+
+	querier.err = errUnavailable
+	assert.Error(t, read())
+	assert.Error(t, read())
+	values = scrape(t, c)
+	assert.Equal(t, 2.0, values["storage_bigquery_consecutive_read_failures"])
+	assert.NotZero(t, values["storage_bigquery_last_failed_read_timestamp_seconds"])
+	assert.Equal(t, 1.0, values[`storage_bigquery_last_read_error_info{class="unavailable"}`])
+
+	// Reads cancelled by Prometheus are no failures of BigQuery.
+	querier.err = context.Canceled
+	assert.Error(t, read())
+	assert.Equal(t, 2.0, scrape(t, c)["storage_bigquery_consecutive_read_failures"])
+
+	querier.err = nil
+	assert.NoError(t, read())
+	assert.Equal(t, 0.0, scrape(t, c)["storage_bigquery_consecutive_read_failures"])
+}
+
+func TestErrorClass(t *testing.T) {
+	for _, testCase := range []struct {
+		err   error
+		class string
+	}{
+		{badRequest(errors.New("invalid")), errorClassBadRequest},
+		{newLimitError("range", "range too long"), errorClassLimitExceeded},
+		{&googleapi.Error{Code: 429}, errorClassQuota},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), errorClassTimeout},
+		{errUnavailable, errorClassUnavailable},
+		{errors.New("unknown"), errorClassOther},
+	} {
+		assert.Equal(t, testCase.class, errorClass(testCase.err), testCase.err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ValidateIdentifier checks that a project, dataset or table name can be quoted in
+// generated SQL. Names may contain dashes and reserved words, but no backticks, which
+// would end the quoted identifier, and no control characters.
+func ValidateIdentifier(name string) error {
+	if name == "" {
+		return errors.New("must not be empty")
+	}
+	if strings.ContainsRune(name, '`') {
+		return errors.Errorf("%q must not contain a backtick", name)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errors.Errorf("%q must not contain control characters", name)
+	}
+	return nil
+}
+
+// tableName returns the name of the table in logs and errors, qualified with the data
+// project if one is set.
+func (c *BigqueryClient) tableName(datasetID, tableID string) string {
+	if c.dataProjectID != "" {
+		return c.dataProjectID + "." + datasetID + "." + tableID
+	}
+	return datasetID + "." + tableID
+}
+
+// tableRef returns the reference to the table in queries, quoted with backticks so that
+// names with dashes or reserved words are valid. Without a data project it resolves
+// against the project of the client.
+func (c *BigqueryClient) tableRef(datasetID, tableID string) string {
+	return "`" + c.tableName(datasetID, tableID) + "`"
+}
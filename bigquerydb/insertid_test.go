@@ -0,0 +1,69 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertIDDeterministic(t *testing.T) {
+	id := insertID("up", `{"job":"api"}`, 1600000000123, 1)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, insertID("up", `{"job":"api"}`, 1600000000123, 1))
+}
+
+func TestInsertIDDiffers(t *testing.T) {
+	base := insertID("up", `{"job":"api"}`, 1600000000123, 1)
+	testCases := map[string]string{
+		"metricname":       insertID("down", `{"job":"api"}`, 1600000000123, 1),
+		"tags":             insertID("up", `{"job":"web"}`, 1600000000123, 1),
+		"timestamp_millis": insertID("up", `{"job":"api"}`, 1600000000124, 1),
+		"value":            insertID("up", `{"job":"api"}`, 1600000000123, 2),
+		"name_tags_shift":  insertID("up{", `"job":"api"}`, 1600000000123, 1),
+	}
+	for name, id := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.NotEqual(t, base, id)
+		})
+	}
+}
+
+func TestWriteDeduplication(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ins := &fakeInserter{}
+		c := newTestClient(ins, WithDeduplication(enabled))
+		assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 2)))
+		assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 2)))
+
+		rows := ins.rows()
+		assert.Len(t, rows, 4)
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			_, id, err := row.Save()
+			assert.NoError(t, err)
+			ids = append(ids, id)
+		}
+		if !enabled {
+			assert.Equal(t, []string{"", "", "", ""}, ids)
+			continue
+		}
+		assert.Equal(t, ids[:2], ids[2:], "retried rows must have the same insert IDs")
+		assert.NotEqual(t, ids[0], ids[1], "different rows must have different insert IDs")
+	}
+}
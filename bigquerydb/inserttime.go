@@ -0,0 +1,52 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// insertTimeColumn is the column the time a row was sent to BigQuery is stored in.
+const insertTimeColumn = "insert_time"
+
+// WithInsertTimeColumn writes the time every row is sent to BigQuery to the TIMESTAMP
+// column insert_time, so that the arrival of samples can be told apart from their
+// timestamps. Rows retried or replayed from the spill directory get the time of the insert
+// which succeeded. Tables created by the adapter default the column to CURRENT_TIMESTAMP()
+// for rows written by other clients. Reads don't select the column.
+func WithInsertTimeColumn(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.insertTime = enabled
+	}
+}
+
+// writeLag returns how far the newest sample of the timeseries is behind now, which grows
+// when the remote write queue of Prometheus falls behind. Old samples of a backfill sent
+// together with current ones don't add to it. Samples in the future have no lag. It
+// returns false if there are no samples.
+func writeLag(timeseries []*prompb.TimeSeries, now time.Time) (time.Duration, bool) {
+	newest := int64(math.MinInt64)
+	for _, ts := range timeseries {
+		for _, s := range ts.Samples {
+			newest = max(newest, s.Timestamp)
+		}
+	}
+	if newest == math.MinInt64 {
+		return 0, false
+	}
+	return max(now.Sub(time.UnixMilli(newest)), 0), true
+}
@@ -0,0 +1,147 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestInsertTimeSave(t *testing.T) {
+	series := []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: time.Now().Add(-time.Hour).UnixMilli(), Value: 1}},
+	}}
+
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithInsertTimeColumn(true))
+	assert.NoError(t, c.Write(context.Background(), series))
+	if assert.Len(t, ins.rows(), 1) {
+		before := time.Now()
+		row, _, err := ins.rows()[0].Save()
+		assert.NoError(t, err)
+		insertTime, ok := row[insertTimeColumn].(time.Time)
+		if assert.True(t, ok, "%v", row) {
+			assert.WithinRange(t, insertTime, before, time.Now(), "the time the row is saved, not the sample time")
+		}
+	}
+
+	ins = &fakeInserter{}
+	c = newTestClient(ins)
+	assert.NoError(t, c.Write(context.Background(), series))
+	if assert.Len(t, ins.rows(), 1) {
+		row, _, err := ins.rows()[0].Save()
+		assert.NoError(t, err)
+		assert.NotContains(t, row, insertTimeColumn)
+	}
+}
+
+func TestInsertTimeSchema(t *testing.T) {
+	admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithInsertTimeColumn(true))
+	assert.Contains(t, c.requiredColumns(), requiredColumn{name: insertTimeColumn, typ: bigquery.TimestampFieldType, defaultValue: "CURRENT_TIMESTAMP()"})
+	assert.NoError(t, c.createTableIfMissing(context.Background()))
+	if assert.NotNil(t, admin.created) {
+		assert.Contains(t, admin.created.Schema, &bigquery.FieldSchema{Name: insertTimeColumn, Type: bigquery.TimestampFieldType, DefaultValueExpression: "CURRENT_TIMESTAMP()"})
+	}
+
+	// Reads select their columns and ignore the insert time.
+	query, _, err := c.buildCommand(sensorQuery(0, 1000))
+	assert.NoError(t, err)
+	assert.NotContains(t, query, insertTimeColumn)
+}
+
+func TestInsertTimeRoundTrip(t *testing.T) {
+	c := newFakeBigQueryClient(WithInsertTimeColumn(true))
+	now := time.Now().UnixMilli()
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: now, Value: 1}},
+	}}))
+	result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: now - 1000,
+		EndTimestampMs:   now + 1000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Results[0].Timeseries, 1) {
+		assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}}, result.Results[0].Timeseries[0].Labels)
+	}
+}
+
+func TestLoadInsertTime(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithInsertTimeColumn(true))
+	_, err := c.Load(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: 1}},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, loader.jobs, 1) {
+		assert.Regexp(t, regexp.MustCompile(`"timestamp":"2023-11-14 22:13:20","value":1,"insert_time":"\d{4}-\d\d-\d\d \d\d:\d\d:\d\d"}`), loader.jobs[0])
+	}
+}
+
+func TestWriteLag(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	series := func(timestamps ...int64) *prompb.TimeSeries {
+		ts := &prompb.TimeSeries{}
+		for _, timestamp := range timestamps {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: timestamp})
+		}
+		return ts
+	}
+	testCases := map[string]struct {
+		timeseries []*prompb.TimeSeries
+		lag        time.Duration
+		ok         bool
+	}{
+		"empty":         {timeseries: []*prompb.TimeSeries{series()}},
+		"current":       {timeseries: []*prompb.TimeSeries{series(1700000000000)}, ok: true},
+		"behind":        {timeseries: []*prompb.TimeSeries{series(1699999970000, 1699999985000)}, lag: 15 * time.Second, ok: true},
+		"newest wins":   {timeseries: []*prompb.TimeSeries{series(1699990000000), series(1699999999500)}, lag: 500 * time.Millisecond, ok: true},
+		"future":        {timeseries: []*prompb.TimeSeries{series(1700000060000)}, ok: true},
+		"no timeseries": {},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			lag, ok := writeLag(tc.timeseries, now)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.lag, lag)
+		})
+	}
+}
+
+func TestWriteLagMetric(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: time.Now().Add(-time.Minute).UnixMilli(), Value: 1}},
+	}}))
+	assert.NoError(t, c.Write(context.Background(), nil), "writes without samples aren't observed")
+
+	metrics := scrape(t, c)
+	assert.Equal(t, 1.0, metrics["storage_bigquery_write_lag_seconds_count"])
+	assert.InDelta(t, 60.0, metrics["storage_bigquery_write_lag_seconds_sum"], 5)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+)
+
+// Leader tells whether this replica is the leader of the replicas sharing a table, which
+// runs the periodic tasks that must not run on several replicas at once.
+type Leader interface {
+	IsLeader() bool
+}
+
+// WithLeader runs the periodic tasks changing the table, like enforcing the retention,
+// only while the replica is the leader, instead of holding a lease of its own per task.
+func WithLeader(leader Leader) Option {
+	return func(c *BigqueryClient) {
+		c.leader = leader
+	}
+}
+
+// leaderLockSchema returns the schema of the coordination table of LeaderLock.
+func leaderLockSchema() bigquery.Schema {
+	return bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		{Name: "holder", Type: bigquery.StringFieldType},
+		{Name: "expires", Type: bigquery.TimestampFieldType},
+	}
+}
+
+// LeaderLock is the lease of a leader election stored as a row of a coordination table,
+// with the name of the election, its holder and when the lease expires. The lease is
+// taken and renewed with a MERGE statement, which BigQuery runs one after another on the
+// same table, and compared with the time of BigQuery, so that the clocks of the replicas
+// don't need to agree.
+type LeaderLock struct {
+	c     *BigqueryClient
+	table string
+	name  string
+}
+
+// LeaderLock returns the lock with the name in the coordination table in the dataset of
+// the client. The table is created if it doesn't exist and the client creates tables.
+func (c *BigqueryClient) LeaderLock(ctx context.Context, tableID, name string) (*LeaderLock, error) {
+	if c.createTable {
+		if err := c.createLeaderLockTable(ctx, c.table(c.datasetID, tableID), tableID); err != nil {
+			return nil, err
+		}
+	}
+	return &LeaderLock{c: c, table: c.tableRef(c.datasetID, tableID), name: name}, nil
+}
+
+// String returns the table and name of the lock.
+func (l *LeaderLock) String() string {
+	return strings.Trim(l.table, "`") + "/" + l.name
+}
+
+// Acquire takes the lease for holder, or renews it, unless another holder's lease didn't
+// expire yet. It implements leader.Lock.
+func (l *LeaderLock) Acquire(ctx context.Context, holder string, leaseDuration time.Duration) (bool, error) {
+	command := fmt.Sprintf(`MERGE %s AS t
+USING (SELECT @name AS name) AS s
+ON t.name = s.name
+WHEN MATCHED AND (t.holder = @holder OR t.holder IS NULL OR t.expires IS NULL OR t.expires < CURRENT_TIMESTAMP()) THEN
+  UPDATE SET holder = @holder, expires = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @lease MILLISECOND)
+WHEN NOT MATCHED THEN
+  INSERT (name, holder, expires) VALUES (@name, @holder, TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @lease MILLISECOND))`, l.table)
+	stats, err := l.c.runStatement(ctx, command, []bigquery.QueryParameter{
+		{Name: "name", Value: l.name},
+		{Name: "holder", Value: holder},
+		{Name: "lease", Value: leaseDuration.Milliseconds()},
+	})
+	if isConcurrentUpdate(err) {
+		// Another replica changed the row at the same time.
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to take the lease of %s", l)
+	}
+	details, ok := stats.Details.(*bigquery.QueryStatistics)
+	return ok && details.NumDMLAffectedRows > 0, nil
+}
+
+// Release gives up the lease if holder holds it. It implements leader.Lock.
+func (l *LeaderLock) Release(ctx context.Context, holder string) error {
+	command := fmt.Sprintf("UPDATE %s SET holder = NULL, expires = NULL WHERE name = @name AND holder = @holder", l.table)
+	_, err := l.c.runStatement(ctx, command, []bigquery.QueryParameter{
+		{Name: "name", Value: l.name},
+		{Name: "holder", Value: holder},
+	})
+	return errors.Wrapf(err, "failed to release the lease of %s", l)
+}
+
+// isConcurrentUpdate returns whether a statement failed because another one changed the
+// table at the same time.
+func isConcurrentUpdate(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "concurrent update")
+}
+
+// createLeaderLockTable creates the coordination table if it doesn't exist.
+func (c *BigqueryClient) createLeaderLockTable(ctx context.Context, admin TableAdmin, tableID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	table := c.tableName(c.datasetID, tableID)
+	_, err := admin.Metadata(ctx)
+	if err == nil {
+		return nil
+	}
+	if !isHTTPError(err, http.StatusNotFound) {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", table)
+	}
+	err = admin.Create(ctx, &bigquery.TableMetadata{Schema: leaderLockSchema()})
+	if err != nil && !isHTTPError(err, http.StatusConflict) {
+		return errors.Wrapf(err, "failed to create the leader election table %s", table)
+	}
+	c.logger.Info("created leader election table", slog.String("table", table))
+	return nil
+}
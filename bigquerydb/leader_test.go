@@ -0,0 +1,112 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeLeader is the leader election of a test.
+type fakeLeader bool
+
+func (f *fakeLeader) IsLeader() bool {
+	return bool(*f)
+}
+
+func TestLeaderLock(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	lock, err := c.LeaderLock(context.Background(), "prombq_leader", "prombq-table")
+	assert.NoError(t, err)
+	assert.Equal(t, "dataset.prombq_leader/prombq-table", lock.String())
+
+	var commands []string
+	var params []bigquery.QueryParameter
+	var affected int64
+	var runErr error
+	c.runStatement = func(_ context.Context, command string, p []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+		commands, params = append(commands, command), p
+		return &bigquery.JobStatistics{Details: &bigquery.QueryStatistics{NumDMLAffectedRows: affected}}, runErr
+	}
+
+	affected = 1
+	acquired, err := lock.Acquire(context.Background(), "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Contains(t, commands[0], "MERGE `dataset.prombq_leader` AS t")
+	assert.Equal(t, []bigquery.QueryParameter{
+		{Name: "name", Value: "prombq-table"},
+		{Name: "holder", Value: "adapter-0"},
+		{Name: "lease", Value: int64(60000)},
+	}, params)
+
+	affected = 0
+	acquired, err = lock.Acquire(context.Background(), "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the row of another holder isn't changed")
+
+	runErr = errors.New("Could not serialize access to table due to concurrent update")
+	acquired, err = lock.Acquire(context.Background(), "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "a concurrent update loses the election")
+	runErr = errors.New("access denied")
+	_, err = lock.Acquire(context.Background(), "adapter-1", time.Minute)
+	assert.EqualError(t, err, "failed to take the lease of dataset.prombq_leader/prombq-table: access denied")
+
+	runErr = nil
+	assert.NoError(t, lock.Release(context.Background(), "adapter-0"))
+	assert.Equal(t, "UPDATE `dataset.prombq_leader` SET holder = NULL, expires = NULL WHERE name = @name AND holder = @holder", commands[len(commands)-1])
+}
+
+func TestLeaderLockCreateTable(t *testing.T) {
+	admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c := newTestClient(&fakeInserter{})
+	assert.NoError(t, c.createLeaderLockTable(context.Background(), admin, "prombq_leader"))
+	if assert.NotNil(t, admin.created) {
+		assert.Equal(t, leaderLockSchema(), admin.created.Schema)
+	}
+
+	admin = &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusForbidden}}
+	assert.ErrorContains(t, c.createLeaderLockTable(context.Background(), admin, "prombq_leader"), "failed to read the metadata of table dataset.prombq_leader")
+}
+
+func TestRetentionLeader(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{}}
+	c, statements := newRetentionTestClient(admin, true)
+	leading := fakeLeader(false)
+	WithLeader(&leading)(c)
+
+	assert.NoError(t, c.enforceRetention(context.Background()))
+	assert.Empty(t, statements.dryRuns, "followers don't enforce the retention")
+	assert.False(t, c.retentionDue(time.Time{}, time.Now()))
+
+	leading = true
+	assert.NoError(t, c.enforceRetention(context.Background()))
+	assert.Len(t, statements.runs, 1)
+	assert.Empty(t, admin.updates, "the leader doesn't take the lease of the table labels")
+
+	now := time.Now()
+	assert.True(t, c.retentionDue(time.Time{}, now), "a new leader enforces the retention right away")
+	assert.False(t, c.retentionDue(now.Add(-time.Minute), now))
+	assert.True(t, c.retentionDue(now.Add(-time.Hour), now))
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrLimitExceeded is returned by Read when a read is rejected by one of the configured limits.
+var ErrLimitExceeded = errors.New("read limit exceeded")
+
+// limitError describes which limit rejected a read.
+type limitError struct {
+	limit string
+	msg   string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+// Is makes limit errors match ErrLimitExceeded.
+func (e *limitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func newLimitError(limit, format string, args ...interface{}) error {
+	return &limitError{limit: limit, msg: fmt.Sprintf(format, args...)}
+}
+
+// ExceededLimit returns the name of the limit which rejected a read, like range or
+// metric_name, as counted in storage_bigquery_read_limit_exceeded_total.
+func ExceededLimit(err error) (string, bool) {
+	var limitErr *limitError
+	if !errors.As(err, &limitErr) {
+		return "", false
+	}
+	return limitErr.limit, true
+}
+
+// ReadLimits are the limits of reads, which can be replaced with SetReadLimits while the
+// client is in use. Values less than or equal to zero disable a limit.
+type ReadLimits struct {
+	// MaxSamples is the number of samples a single read may return.
+	MaxSamples int
+	// MaxResponseBytes is the approximate size of the marshaled response of a read.
+	MaxResponseBytes int
+	// MaxRows is the number of rows a single query may return.
+	MaxRows int
+	// MaxBytesScanned is the number of bytes a single query may scan, as estimated by a
+	// dry run.
+	MaxBytesScanned int64
+	// DryRunMinRange is the time range from which on queries are checked against
+	// MaxBytesScanned. Queries over a shorter range skip the dry run.
+	DryRunMinRange time.Duration
+	// RequireMetricName rejects queries without a matcher selecting metrics by name.
+	RequireMetricName bool
+	// MaxRange is the time range of a single query, MaxRangeBehavior what happens to
+	// queries over a longer one.
+	MaxRange         time.Duration
+	MaxRangeBehavior string
+	// SlowQueryThreshold is the duration after which queries are logged as slow.
+	SlowQueryThreshold time.Duration
+}
+
+// ReadLimits returns the current limits of reads.
+func (c *BigqueryClient) ReadLimits() ReadLimits {
+	return *c.readLimits.Load()
+}
+
+// SetReadLimits replaces the limits of reads. Reads which already started keep the
+// limits they started with.
+func (c *BigqueryClient) SetReadLimits(limits ReadLimits) {
+	c.readLimits.Store(&limits)
+}
+
+// updateReadLimits replaces the limits of reads with a copy changed by update.
+func (c *BigqueryClient) updateReadLimits(update func(*ReadLimits)) {
+	limits := c.ReadLimits()
+	update(&limits)
+	c.SetReadLimits(limits)
+}
+
+// newResultSet returns a result set with the limits of the response of a read.
+func (l *ReadLimits) newResultSet() *resultSet {
+	rs := newResultSet(l.MaxSamples)
+	rs.maxBytes = l.MaxResponseBytes
+	return rs
+}
+
+// Behaviors for queries exceeding the maximum range.
+const (
+	// RangeLimitReject rejects queries over a longer range.
+	RangeLimitReject = "reject"
+	// RangeLimitTruncate moves the start of queries over a longer range forward.
+	RangeLimitTruncate = "truncate"
+)
+
+// limitRange enforces the maximum range of a query. It returns the query, or a copy with
+// a later start if the range was truncated.
+func (c *BigqueryClient) limitRange(ctx context.Context, limits *ReadLimits, q *prompb.Query) (*prompb.Query, error) {
+	max := limits.MaxRange.Milliseconds()
+	requested := q.EndTimestampMs - q.StartTimestampMs
+	if max <= 0 || requested <= max {
+		return q, nil
+	}
+	if limits.MaxRangeBehavior != RangeLimitTruncate {
+		return nil, newLimitError("range", "query %s requests a range of %s, more than the limit of %s",
+			formatMatchers(q.Matchers), time.Duration(requested)*time.Millisecond, limits.MaxRange)
+	}
+	truncated := *q
+	truncated.StartTimestampMs = q.EndTimestampMs - max
+	c.readRangeTruncated.Inc()
+	c.logger.WarnContext(ctx, "truncated the range of a read query to the limit",
+		slog.String("matchers", formatMatchers(q.Matchers)),
+		slog.Duration("requested", time.Duration(requested)*time.Millisecond),
+		slog.Duration("limit", limits.MaxRange))
+	return &truncated, nil
+}
+
+// checkMetricName rejects the query if a metric name is required and none of its
+// matchers selects metrics by name.
+func (l *ReadLimits) checkMetricName(q *prompb.Query) error {
+	if !l.RequireMetricName {
+		return nil
+	}
+	for _, m := range q.Matchers {
+		if m.Name == model.MetricNameLabel && (m.Type == prompb.LabelMatcher_EQ || m.Type == prompb.LabelMatcher_RE) {
+			return nil
+		}
+	}
+	return newLimitError("metric_name", "query %s has no matcher for the metric name and would scan all metrics, add a metric name to the PromQL selector, e.g. up{job=\"api\"} or {__name__=~\"http_.+\"}",
+		formatMatchers(q.Matchers))
+}
+
+// rowLimitIterator fails once more than max rows were returned by the wrapped iterator.
+type rowLimitIterator struct {
+	rowIterator
+	max      int
+	rows     int
+	matchers string
+}
+
+func (it *rowLimitIterator) Next(dst interface{}) error {
+	if err := it.rowIterator.Next(dst); err != nil {
+		return err
+	}
+	it.rows++
+	if it.rows > it.max {
+		return newLimitError("rows", "query %s returned more than the limit of %d rows", it.matchers, it.max)
+	}
+	return nil
+}
+
+// limitRows wraps the iterator to enforce the configured row limit of a query.
+func (l *ReadLimits) limitRows(iter rowIterator, q *prompb.Query) rowIterator {
+	if l.MaxRows <= 0 {
+		return iter
+	}
+	return &rowLimitIterator{rowIterator: iter, max: l.MaxRows, matchers: formatMatchers(q.Matchers)}
+}
+
+// checkBytesScanned estimates the bytes the query would scan with a dry run and
+// rejects it if they exceed the configured limit. Queries over a range shorter than
+// DryRunMinRange are assumed to be cheap and run without the extra round trip.
+func (c *BigqueryClient) checkBytesScanned(ctx context.Context, limits *ReadLimits, q *prompb.Query, command string, params []bigquery.QueryParameter) error {
+	if limits.MaxBytesScanned <= 0 {
+		return nil
+	}
+	if q.EndTimestampMs-q.StartTimestampMs < limits.DryRunMinRange.Milliseconds() {
+		return nil
+	}
+	stats, err := c.dryRun(ctx, command, params)
+	if err != nil {
+		return errors.Wrap(err, "dry run failed")
+	}
+	c.readEstimatedBytes.Observe(float64(stats.TotalBytesProcessed))
+	if stats.TotalBytesProcessed > limits.MaxBytesScanned {
+		return newLimitError("bytes_scanned", "query %s would scan %d bytes, more than the limit of %d bytes, narrow its time range or select fewer metrics with a matcher on the metric name",
+			formatMatchers(q.Matchers), stats.TotalBytesProcessed, limits.MaxBytesScanned)
+	}
+	return nil
+}
+
+// bytesBilledLimitExceeded is the reason of the error BigQuery fails a query with,
+// when it would bill more bytes than the maximum set on the query.
+const bytesBilledLimitExceeded = "bytesBilledLimitExceeded"
+
+// translateQueryError turns the error of queries exceeding the maximum bytes billed
+// into a limit error, and returns all other errors unchanged.
+func (c *BigqueryClient) translateQueryError(q *prompb.Query, err error) error {
+	exceeded := false
+	var bqErr *bigquery.Error
+	if errors.As(err, &bqErr) && bqErr.Reason == bytesBilledLimitExceeded {
+		exceeded = true
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, e := range apiErr.Errors {
+			if e.Reason == bytesBilledLimitExceeded {
+				exceeded = true
+			}
+		}
+	}
+	if !exceeded {
+		return err
+	}
+	return newLimitError("bytes_billed", "query %s would bill more than the limit of %d bytes: %v",
+		formatMatchers(q.Matchers), c.maxBytesBilled, err)
+}
+
+// dryRunQuery returns the statistics BigQuery estimates for the query without running it.
+func (c *BigqueryClient) dryRunQuery(ctx context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+	conn := c.acquire()
+	defer conn.release()
+	query := c.newQuery(conn, command, params)
+	query.DryRun = true
+	job, err := query.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return job.LastStatus().Statistics, nil
+}
+
+// formatMatchers renders the matchers in PromQL selector syntax.
+func formatMatchers(matchers []*prompb.LabelMatcher) string {
+	ops := map[prompb.LabelMatcher_Type]string{
+		prompb.LabelMatcher_EQ:  "=",
+		prompb.LabelMatcher_NEQ: "!=",
+		prompb.LabelMatcher_RE:  "=~",
+		prompb.LabelMatcher_NRE: "!~",
+	}
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		parts = append(parts, fmt.Sprintf("%s%s%q", m.Name, ops[m.Type], m.Value))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
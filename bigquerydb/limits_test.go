@@ -0,0 +1,378 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
+)
+
+var testQuery = &prompb.Query{
+	Matchers: []*prompb.LabelMatcher{
+		{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+		{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api.*"},
+	},
+}
+
+func TestMaxRows(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithMaxRows(10))
+
+	rs := newResultSet(0)
+	assert.NoError(t, mergeResult(rs, c.readLimits.Load().limitRows(newSyntheticRowIterator(10, 2), testQuery)))
+
+	rs = newResultSet(0)
+	err := mergeResult(rs, c.readLimits.Load().limitRows(newSyntheticRowIterator(11, 2), testQuery))
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.ErrorContains(t, err, `query {__name__="up", job=~"api.*"} returned more than the limit of 10 rows`)
+}
+
+func TestMaxRowsDisabled(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	iter := newSyntheticRowIterator(10, 2)
+	assert.Same(t, iter, c.readLimits.Load().limitRows(iter, testQuery))
+}
+
+func TestMaxBytesScanned(t *testing.T) {
+	testCases := map[string]struct {
+		limit     int64
+		processed int64
+		exceeded  bool
+	}{
+		"disabled":    {limit: 0, processed: 1 << 40},
+		"under_limit": {limit: 1000, processed: 999},
+		"at_limit":    {limit: 1000, processed: 1000},
+		"over_limit":  {limit: 1000, processed: 1001, exceeded: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithMaxBytesScanned(testCase.limit))
+			dryRuns := 0
+			c.dryRun = func(_ context.Context, command string, _ []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+				dryRuns++
+				assert.Equal(t, "SELECT 1", command)
+				return &bigquery.JobStatistics{TotalBytesProcessed: testCase.processed}, nil
+			}
+
+			err := c.checkBytesScanned(context.Background(), c.readLimits.Load(), testQuery, "SELECT 1", nil)
+			if testCase.exceeded {
+				assert.True(t, errors.Is(err, ErrLimitExceeded))
+				assert.ErrorContains(t, err, `query {__name__="up", job=~"api.*"} would scan 1001 bytes`)
+			} else {
+				assert.NoError(t, err)
+			}
+			if testCase.limit > 0 {
+				assert.Equal(t, 1, dryRuns)
+			} else {
+				assert.Equal(t, 0, dryRuns)
+			}
+		})
+	}
+}
+
+func TestMaxBytesScannedDryRunError(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithMaxBytesScanned(1000))
+	c.dryRun = func(context.Context, string, []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+		return nil, errors.New("boom")
+	}
+	err := c.checkBytesScanned(context.Background(), c.readLimits.Load(), testQuery, "SELECT 1", nil)
+	assert.ErrorContains(t, err, "boom")
+	assert.False(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestDryRunMinRange(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithMaxBytesScanned(1<<30), WithDryRunMinRange(time.Hour))
+	dryRuns := 0
+	c.dryRun = func(context.Context, string, []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+		dryRuns++
+		return &bigquery.JobStatistics{TotalBytesProcessed: 5 << 30}, nil
+	}
+	query := func(rangeMs int64) *prompb.Query {
+		return &prompb.Query{StartTimestampMs: 1000, EndTimestampMs: 1000 + rangeMs, Matchers: testQuery.Matchers}
+	}
+
+	// Queries over a shorter range run without the dry run.
+	assert.NoError(t, c.checkBytesScanned(context.Background(), c.readLimits.Load(), query(time.Minute.Milliseconds()), "SELECT 1", nil))
+	assert.Equal(t, 0, dryRuns)
+	assert.Equal(t, 0.0, scrape(t, c)["storage_bigquery_read_estimated_bytes_scanned_count"])
+
+	err := c.checkBytesScanned(context.Background(), c.readLimits.Load(), query(time.Hour.Milliseconds()), "SELECT 1", nil)
+	assert.Equal(t, 1, dryRuns)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.ErrorContains(t, err, "would scan 5368709120 bytes, more than the limit of 1073741824 bytes, narrow its time range")
+	limit, _ := ExceededLimit(err)
+	assert.Equal(t, "bytes_scanned", limit)
+	assert.Equal(t, 1.0, scrape(t, c)["storage_bigquery_read_estimated_bytes_scanned_count"])
+}
+
+func TestRequireMetricName(t *testing.T) {
+	testCases := map[string]struct {
+		matchers []*prompb.LabelMatcher
+		rejected bool
+	}{
+		"eq": {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}, {Type: prompb.LabelMatcher_EQ, Name: "job", Value: "x"}}},
+		"re": {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "http_.+"}}},
+		"no_name": {
+			matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "x"}},
+			rejected: true,
+		},
+		"nre_only": {
+			matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_NRE, Name: "__name__", Value: "up"}, {Type: prompb.LabelMatcher_EQ, Name: "job", Value: "x"}},
+			rejected: true,
+		},
+		"neq_only": {
+			matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_NEQ, Name: "__name__", Value: "up"}},
+			rejected: true,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithRequireMetricName(true))
+			_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: testCase.matchers}}})
+			if !testCase.rejected {
+				assert.NoError(t, err)
+				assert.Len(t, querier.queries, 1)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrLimitExceeded))
+			assert.ErrorContains(t, err, "add a metric name to the PromQL selector")
+			assert.Empty(t, querier.queries, "the query isn't run")
+			assert.Equal(t, 1.0, metricValue(c.readLimitExceeded.WithLabelValues("metric_name")))
+		})
+	}
+
+	c := newTestClient(&fakeInserter{})
+	_, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "x"}}})
+	assert.NoError(t, err, "a metric name is only required when enabled")
+}
+
+func TestMaxSamplesIsLimitError(t *testing.T) {
+	rs := newResultSet(5)
+	err := mergeResult(rs, newSyntheticRowIterator(6, 1))
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestMaxBytesBilled(t *testing.T) {
+	query := newTestClient(&fakeInserter{}).newTestQuery("SELECT 1", nil)
+	assert.Equal(t, int64(0), query.MaxBytesBilled)
+
+	c := newTestClient(&fakeInserter{}, WithMaxBytesBilled(1<<30))
+	query = c.newTestQuery("SELECT 1", nil)
+	assert.Equal(t, int64(1<<30), query.MaxBytesBilled)
+	assert.Equal(t, float64(1<<30), metricValue(c.maxBytesBilledGauge))
+}
+
+func TestTranslateQueryError(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithMaxBytesBilled(1000))
+	testCases := map[string]struct {
+		err      error
+		exceeded bool
+	}{
+		"job_error":   {err: &bigquery.Error{Reason: "bytesBilledLimitExceeded", Message: "Query exceeded limit for bytes billed: 1000."}, exceeded: true},
+		"api_error":   {err: &googleapi.Error{Code: 400, Errors: []googleapi.ErrorItem{{Reason: "bytesBilledLimitExceeded"}}}, exceeded: true},
+		"wrapped":     {err: errors.Wrap(&bigquery.Error{Reason: "bytesBilledLimitExceeded"}, "query failed"), exceeded: true},
+		"other_job":   {err: &bigquery.Error{Reason: "notFound"}},
+		"other_api":   {err: &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}},
+		"other_error": {err: errors.New("boom")},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := c.translateQueryError(testQuery, testCase.err)
+			assert.Equal(t, testCase.exceeded, errors.Is(err, ErrLimitExceeded))
+			if testCase.exceeded {
+				assert.ErrorContains(t, err, `query {__name__="up", job=~"api.*"} would bill more than the limit of 1000 bytes`)
+			} else {
+				assert.Same(t, testCase.err, err)
+			}
+		})
+	}
+}
+
+func TestMaxRange(t *testing.T) {
+	testCases := map[string]struct {
+		behavior  string
+		start     int64
+		rejected  bool
+		truncated bool
+	}{
+		"reject_at_limit":     {behavior: RangeLimitReject, start: 1000},
+		"reject_over_limit":   {behavior: RangeLimitReject, start: 999, rejected: true},
+		"truncate_at_limit":   {behavior: RangeLimitTruncate, start: 1000},
+		"truncate_over_limit": {behavior: RangeLimitTruncate, start: 999, truncated: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithMaxRange(time.Hour, testCase.behavior))
+			end := 1000 + time.Hour.Milliseconds()
+			_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+				StartTimestampMs: testCase.start,
+				EndTimestampMs:   end,
+				Matchers:         testQuery.Matchers,
+			}}})
+			if testCase.rejected {
+				assert.True(t, errors.Is(err, ErrLimitExceeded))
+				assert.ErrorContains(t, err, `query {__name__="up", job=~"api.*"} requests a range of 1h0m0.001s, more than the limit of 1h0m0s`)
+				assert.Empty(t, querier.queries, "the query isn't run")
+				assert.Equal(t, 1.0, metricValue(c.readLimitExceeded.WithLabelValues("range")))
+				limit, ok := ExceededLimit(err)
+				assert.True(t, ok)
+				assert.Equal(t, "range", limit)
+				var queryErr *QueryError
+				if assert.ErrorAs(t, err, &queryErr) {
+					assert.Equal(t, `{__name__="up", job=~"api.*"}`, queryErr.Matchers)
+					assert.Contains(t, queryErr.SQL, "SELECT metricname")
+				}
+				return
+			}
+			assert.NoError(t, err)
+			if assert.Len(t, querier.queries, 1) {
+				assert.Contains(t, querier.queries[0].Parameters, bigquery.QueryParameter{Name: "start", Value: int64(1000)},
+					"the start is moved forward to the limit")
+			}
+			if testCase.truncated {
+				assert.Equal(t, 1.0, metricValue(c.readRangeTruncated))
+			} else {
+				assert.Zero(t, metricValue(c.readRangeTruncated))
+			}
+		})
+	}
+
+	c := newTestClient(&fakeInserter{})
+	q := &prompb.Query{StartTimestampMs: 0, EndTimestampMs: 365 * 24 * time.Hour.Milliseconds()}
+	limited, err := c.limitRange(context.Background(), c.readLimits.Load(), q)
+	assert.NoError(t, err)
+	assert.Same(t, q, limited, "the range is only limited when enabled")
+}
+
+func TestMaxRangeLogsTraceIDs(t *testing.T) {
+	var logs bytes.Buffer
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{}), WithMaxRange(time.Hour, RangeLimitTruncate))
+	c.logger = slog.New(tracing.NewLogHandler(slog.NewTextHandler(&logs, nil)))
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+
+	_, err := c.Read(trace.ContextWithSpanContext(context.Background(), sc), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		EndTimestampMs: 2 * time.Hour.Milliseconds(),
+		Matchers:       testQuery.Matchers,
+	}}})
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="truncated the range of a read query to the limit"`)
+	assert.Contains(t, logs.String(), "trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7")
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	// The size of the response of 100 rows of 10 series, which is the largest allowed one.
+	rs := newResultSet(0)
+	assert.NoError(t, mergeResult(rs, newSyntheticRowIterator(100, 10)))
+	size := rs.bytes
+	resp := rs.response()
+	assert.InDelta(t, resp.Size(), size, float64(resp.Size())/10, "the size is close to the marshaled one")
+
+	for name, tc := range map[string]struct {
+		rows     int
+		exceeded bool
+	}{
+		"below":    {rows: 99},
+		"at limit": {rows: 100},
+		"above":    {rows: 101, exceeded: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rs := newResultSet(0)
+			rs.maxBytes = size
+			rs.matchers = formatMatchers(testQuery.Matchers)
+			err := mergeResult(rs, newSyntheticRowIterator(tc.rows, 10))
+			if !tc.exceeded {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrLimitExceeded))
+			limit, _ := ExceededLimit(err)
+			assert.Equal(t, "response_bytes", limit)
+			assert.ErrorContains(t, err, `read exceeded the limit of `)
+			assert.ErrorContains(t, err, `bytes of the response while merging the rows of query {__name__="up", job=~"api.*"}, narrow the time range`)
+		})
+	}
+}
+
+func TestMaxResponseBytesRead(t *testing.T) {
+	var rows []map[string]bigquery.Value
+	iter := newSyntheticRowIterator(1000, 10)
+	for {
+		row := map[string]bigquery.Value{}
+		if iter.Next(&row) != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	q := &prompb.Query{EndTimestampMs: 10000000, Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "node_cpu_seconds_total"}}}
+
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: rows}), WithMaxResponseBytes(1<<20))
+	resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{q}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results[0].Timeseries, 10)
+
+	c = newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: rows}), WithMaxResponseBytes(10000))
+	resp, err = c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{q}})
+	assert.Nil(t, resp, "no partial response is returned")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.ErrorContains(t, err, `read exceeded the limit of 10000 bytes of the response while merging the rows of query {__name__="node_cpu_seconds_total"}`)
+	assert.Equal(t, 1.0, metricValue(c.readLimitExceeded.WithLabelValues("response_bytes")))
+
+	// Cached series count towards the limit as well.
+	c = newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: rows}), WithMaxResponseBytes(10000), WithReadCache(time.Minute, 10, time.Hour, time.Minute))
+	_, err = c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{q}})
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestSetReadLimits(t *testing.T) {
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"api"}`, 2000, 1),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithReadLimits(ReadLimits{MaxSamples: 2}))
+	req := &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}}}}
+	_, err := c.Read(context.Background(), req)
+	assert.NoError(t, err)
+
+	limits := c.ReadLimits()
+	limits.MaxSamples = 1
+	c.SetReadLimits(limits)
+	_, err = c.Read(context.Background(), req)
+	assert.ErrorContains(t, err, "read exceeded the limit of 1 samples")
+
+	c.SetReadLimits(ReadLimits{RequireMetricName: true})
+	_, err = c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"}}}}})
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Equal(t, ReadLimits{RequireMetricName: true}, c.ReadLimits())
+}
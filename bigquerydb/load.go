@@ -0,0 +1,197 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Loader loads rows given as newline-delimited JSON into the table with a load job.
+type Loader interface {
+	Load(ctx context.Context, src io.Reader) error
+}
+
+// bigqueryLoader runs load jobs in BigQuery.
+type bigqueryLoader struct {
+	table    tableRef
+	location string
+	labels   map[string]string
+}
+
+// Load appends the rows to the table and waits for the load job to complete.
+func (l *bigqueryLoader) Load(ctx context.Context, src io.Reader) error {
+	source := bigquery.NewReaderSource(src)
+	source.SourceFormat = bigquery.JSON
+	return l.run(ctx, source, "")
+}
+
+// loadObject appends the rows of the object in Cloud Storage, newline-delimited JSON
+// compressed with gzip, to the table and waits for the load job to complete. If a job
+// with the ID exists already, it's waited for instead of run again.
+func (l *bigqueryLoader) loadObject(ctx context.Context, uri, jobID string) error {
+	source := bigquery.NewGCSReference(uri)
+	source.SourceFormat = bigquery.JSON
+	source.Compression = bigquery.Gzip
+	return l.run(ctx, source, jobID)
+}
+
+// loadJobError is the error of a load job which completed without loading any rows.
+type loadJobError struct {
+	id  string
+	err error
+}
+
+func (e *loadJobError) Error() string {
+	return fmt.Sprintf("load job %s failed: %v", e.id, e.err)
+}
+
+func (e *loadJobError) Unwrap() error {
+	return e.err
+}
+
+// permanent returns whether another job of the same rows would fail as well, because
+// they are invalid or don't match the schema of the table.
+func (e *loadJobError) permanent() bool {
+	var bqErr *bigquery.Error
+	if !errors.As(e.err, &bqErr) {
+		return false
+	}
+	return bqErr.Reason == "invalid" || bqErr.Reason == "invalidQuery"
+}
+
+// run runs a load job of the source and waits for it to complete. The job gets the ID,
+// or a random one if it's empty. If a job with the ID exists already, it's waited for.
+// A failed job is returned as *loadJobError.
+func (l *bigqueryLoader) run(ctx context.Context, source bigquery.LoadSource, jobID string) error {
+	conn := l.table.c.acquire()
+	defer conn.release()
+	loader := l.table.in(conn).LoaderFrom(source)
+	loader.WriteDisposition = bigquery.WriteAppend
+	loader.Location = l.location
+	loader.Labels = l.labels
+	loader.JobID = jobID
+
+	job, err := loader.Run(ctx)
+	if jobID != "" && isHTTPError(err, http.StatusConflict) {
+		job, err = conn.client.JobFromIDLocation(ctx, jobID, l.location)
+	}
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for load job %s", job.ID())
+	}
+	if err := status.Err(); err != nil {
+		return &loadJobError{id: job.ID(), err: err}
+	}
+	return nil
+}
+
+// loadTimestampFormat is the format of the timestamp column in load jobs, in UTC.
+const loadTimestampFormat = "2006-01-02 15:04:05"
+
+// loadRow is the JSON representation of an Item in a load job. Staleness markers and
+// special values have a null value.
+type loadRow struct {
+	MetricName   string      `json:"metricname"`
+	Tags         interface{} `json:"tags,omitempty"`
+	Labels       []itemLabel `json:"labels,omitempty"`
+	Timestamp    interface{} `json:"timestamp"`
+	Value        *float64    `json:"value"`
+	SpecialValue string      `json:"special_value,omitempty"`
+	SeriesHash   int64       `json:"series_hash,omitempty"`
+	InsertTime   string      `json:"insert_time,omitempty"`
+}
+
+// Load writes the timeseries to the table with a single load job instead of streaming
+// inserts, which is cheaper for large amounts of historical samples. The samples are
+// converted into rows like by Write. It returns the number of rows loaded.
+func (c *BigqueryClient) Load(ctx context.Context, timeseries []*prompb.TimeSeries) (int, error) {
+	// Historical samples are loaded regardless of the maximum sample age and future skew.
+	batch, err := c.buildBatch(ctx, timeseries, "", unlimitedWindow)
+	if err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range batch {
+		if err := enc.Encode(c.loadRow(item, now)); err != nil {
+			return 0, err
+		}
+	}
+	size := buf.Len()
+	if err := c.loader.Load(ctx, &buf); err != nil {
+		return 0, err
+	}
+	c.writtenBytes.Add(float64(size))
+	c.writtenRows.Add(float64(len(batch)))
+	return len(batch), nil
+}
+
+// loadRow returns the row of the item in a load job, inserted at now.
+func (c *BigqueryClient) loadRow(item *Item, now time.Time) loadRow {
+	value := &item.value
+	if item.stale || item.special != "" {
+		value = nil
+	}
+	var timestamp interface{} = time.Unix(item.timestamp, 0).UTC().Format(loadTimestampFormat)
+	if c.timestampMillis() {
+		timestamp = item.timestampMs
+	}
+	var insertTime string
+	if item.insertTime {
+		insertTime = now.UTC().Format(loadTimestampFormat)
+	}
+	return loadRow{
+		MetricName:   item.metricname,
+		Tags:         c.loadTags(item.tags),
+		Labels:       item.labels,
+		Timestamp:    timestamp,
+		Value:        value,
+		SpecialValue: item.special,
+		SeriesHash:   int64(item.seriesHash),
+		InsertTime:   insertTime,
+	}
+}
+
+// CountRows returns the number of rows Write or Load turn the timeseries into,
+// which excludes samples with unsupported values.
+func CountRows(timeseries []*prompb.TimeSeries) int {
+	rows := 0
+	for _, ts := range timeseries {
+		for _, s := range ts.Samples {
+			if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+				rows++
+			}
+		}
+	}
+	return rows
+}
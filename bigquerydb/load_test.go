@@ -0,0 +1,112 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLoader records the rows of the load jobs.
+type fakeLoader struct {
+	jobs []string
+	err  error
+}
+
+func (f *fakeLoader) Load(ctx context.Context, src io.Reader) error {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	f.jobs = append(f.jobs, string(data))
+	return f.err
+}
+
+func loadTestSeries() []*prompb.TimeSeries {
+	return []*prompb.TimeSeries{
+		{
+			Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+			Samples: []prompb.Sample{
+				{Timestamp: 1700000000000, Value: 1},
+				{Timestamp: 1700000015000, Value: math.NaN()},
+				{Timestamp: 1700000030500, Value: 0},
+			},
+		},
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "temperature"}},
+			Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: math.Inf(1)}},
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader))
+
+	rows, err := c.Load(context.Background(), loadTestSeries())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, []string{strings.Join([]string{
+		`{"metricname":"up","tags":"{\"job\":\"api\"}","timestamp":"2023-11-14 22:13:20","value":1}`,
+		`{"metricname":"up","tags":"{\"job\":\"api\"}","timestamp":"2023-11-14 22:13:50","value":0}`,
+		"",
+	}, "\n")}, loader.jobs)
+	assert.Equal(t, 2.0, metricValue(c.writtenRows))
+	assert.Equal(t, 2.0, metricValue(c.ignoredSamples))
+}
+
+func TestLoadStaleMarkers(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithStaleMarkers(true))
+
+	rows, err := c.Load(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: math.Float64frombits(staleNaN)}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, []string{`{"metricname":"up","tags":"{}","timestamp":"2023-11-14 22:13:20","value":null}` + "\n"}, loader.jobs)
+}
+
+func TestLoadWithoutRows(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader))
+
+	rows, err := c.Load(context.Background(), loadTestSeries()[1:])
+	assert.NoError(t, err)
+	assert.Zero(t, rows)
+	assert.Empty(t, loader.jobs, "no job is run without rows")
+}
+
+func TestLoadError(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithLoader(&fakeLoader{err: errors.New("load job failed")}))
+
+	_, err := c.Load(context.Background(), loadTestSeries())
+	assert.ErrorContains(t, err, "load job failed")
+	assert.Zero(t, metricValue(c.writtenRows))
+}
+
+func TestCountRows(t *testing.T) {
+	assert.Equal(t, 2, CountRows(loadTestSeries()))
+	assert.Zero(t, CountRows(nil))
+}
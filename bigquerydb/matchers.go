@@ -0,0 +1,144 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"regexp/syntax"
+)
+
+// Conditions of matchers which don't depend on the value of the label. Matchers which
+// match every value have no condition at all.
+const (
+	matchAllSQL     = ""
+	matchNothingSQL = "FALSE"
+)
+
+// maxRegexLiterals is the maximum number of values a regex matcher is turned into an
+// IN list for. Patterns matching more values keep using the regex.
+const maxRegexLiterals = 64
+
+// regexKind is what an anchored regex matcher is equivalent to.
+type regexKind int
+
+const (
+	// regexOther patterns are evaluated as regex.
+	regexOther regexKind = iota
+	// regexAny patterns like .* match every value, including the empty one.
+	regexAny
+	// regexNonEmpty patterns like .+ match every value but the empty one.
+	regexNonEmpty
+	// regexLiterals patterns like api or (api|web) match a finite set of values.
+	regexLiterals
+)
+
+// analyzeRegex returns what the pattern of a regex matcher, which matches the whole
+// value, is equivalent to, and for regexLiterals the values it matches. Grafana variables
+// produce patterns like .* and (api|web), which are cheaper to evaluate as comparisons
+// than with REGEXP_CONTAINS. The analysis is conservative, patterns which aren't
+// recognized, use flags like (?i) or anchors, are regexOther.
+//
+// Like in Prometheus 3, . is treated as matching every character, so .* and .+ match
+// values with line breaks too.
+func analyzeRegex(pattern string) (regexKind, []string) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return regexOther, nil
+	}
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	switch re.Op {
+	case syntax.OpStar:
+		if anyChar(re.Sub[0]) {
+			return regexAny, nil
+		}
+	case syntax.OpPlus:
+		if anyChar(re.Sub[0]) {
+			return regexNonEmpty, nil
+		}
+	}
+	if values, ok := literals(re); ok {
+		return regexLiterals, values
+	}
+	return regexOther, nil
+}
+
+func anyChar(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpAnyChar || re.Op == syntax.OpAnyCharNotNL
+}
+
+// literals returns the values the regex matches if they are a finite set of at most
+// maxRegexLiterals values.
+func literals(re *syntax.Regexp) ([]string, bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, false
+		}
+		return []string{string(re.Rune)}, true
+	case syntax.OpCapture:
+		return literals(re.Sub[0])
+	case syntax.OpCharClass:
+		// The parser turns the common prefixes of alternations into concatenations with
+		// character classes, like ap[ix] for api|apx.
+		var values []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if len(values) == maxRegexLiterals {
+					return nil, false
+				}
+				values = append(values, string(r))
+			}
+		}
+		return values, len(values) > 0
+	case syntax.OpAlternate:
+		var values []string
+		seen := make(map[string]bool)
+		for _, sub := range re.Sub {
+			subValues, ok := literals(sub)
+			if !ok {
+				return nil, false
+			}
+			for _, v := range subValues {
+				if !seen[v] {
+					seen[v] = true
+					values = append(values, v)
+				}
+			}
+			if len(values) > maxRegexLiterals {
+				return nil, false
+			}
+		}
+		return values, true
+	case syntax.OpConcat:
+		values := []string{""}
+		for _, sub := range re.Sub {
+			subValues, ok := literals(sub)
+			if !ok || len(values)*len(subValues) > maxRegexLiterals {
+				return nil, false
+			}
+			combined := make([]string, 0, len(values)*len(subValues))
+			for _, prefix := range values {
+				for _, v := range subValues {
+					combined = append(combined, prefix+v)
+				}
+			}
+			values = combined
+		}
+		return values, true
+	}
+	return nil, false
+}
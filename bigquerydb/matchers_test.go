@@ -0,0 +1,107 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeRegex(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		kind    regexKind
+		values  []string
+	}{
+		{pattern: ".*", kind: regexAny},
+		{pattern: "(.*)", kind: regexAny},
+		{pattern: "(?s:.*)", kind: regexAny},
+		{pattern: ".+", kind: regexNonEmpty},
+		{pattern: "", kind: regexLiterals, values: []string{""}},
+		{pattern: "api", kind: regexLiterals, values: []string{"api"}},
+		{pattern: "api|web", kind: regexLiterals, values: []string{"api", "web"}},
+		{pattern: "(api|web)", kind: regexLiterals, values: []string{"api", "web"}},
+		{pattern: "api|apx", kind: regexLiterals, values: []string{"api", "apx"}},
+		{pattern: "ap[ix]", kind: regexLiterals, values: []string{"api", "apx"}},
+		{pattern: "api|api", kind: regexLiterals, values: []string{"api"}},
+		{pattern: `a\.b|c`, kind: regexLiterals, values: []string{"a.b", "c"}},
+		{pattern: "(?i)api", kind: regexOther},
+		{pattern: "^api", kind: regexOther},
+		{pattern: "api$", kind: regexOther},
+		{pattern: "a.*", kind: regexOther},
+		{pattern: "a.*b", kind: regexOther},
+		{pattern: ".?", kind: regexOther},
+		{pattern: "api|web.*", kind: regexOther},
+		{pattern: "[a-z]{3}", kind: regexOther},
+		{pattern: "[^a]", kind: regexOther},
+		{pattern: "(", kind: regexOther},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			kind, values := analyzeRegex(tc.pattern)
+			assert.Equal(t, tc.kind, kind)
+			assert.Equal(t, tc.values, values)
+		})
+	}
+}
+
+func TestAnalyzeRegexLiteralsLimit(t *testing.T) {
+	values := make([]string, maxRegexLiterals+1)
+	for i := range values {
+		values[i] = fmt.Sprintf("v%d", i)
+	}
+	kind, _ := analyzeRegex(strings.Join(values[:maxRegexLiterals], "|"))
+	assert.Equal(t, regexLiterals, kind)
+	kind, _ = analyzeRegex(strings.Join(values, "|"))
+	assert.Equal(t, regexOther, kind)
+}
+
+// TestSimplifiedMatchersEquivalent checks that the conditions of simplified regex
+// matchers select the same values as the anchored regex, for both the tags and the
+// labels column.
+func TestSimplifiedMatchersEquivalent(t *testing.T) {
+	labels := []string{"", "api", "web", "apx", "apix", "a.b", "axb", "API", "other", "\n", "a\nb", "api\nweb"}
+	patterns := []string{".*", ".+", "", "api", "api|web", "(api|web)", "ap[ix]", `a\.b`, "api|", "a.b", "a.*", ".*b"}
+
+	for _, pattern := range patterns {
+		for _, typ := range []prompb.LabelMatcher_Type{prompb.LabelMatcher_RE, prompb.LabelMatcher_NRE} {
+			m := &prompb.LabelMatcher{Type: typ, Name: "foo", Value: pattern}
+			t.Run(fmt.Sprintf("%s_%s", typ, pattern), func(t *testing.T) {
+				condition, value, err := matcherSQL(m, "p")
+				assert.NoError(t, err)
+				labelsCondition, labelsValue, err := labelsMatcherSQL(m, "n", "p")
+				assert.NoError(t, err)
+
+				// Prometheus 3 anchors the pattern and lets . match line breaks.
+				re := regexp.MustCompile("^(?s:" + pattern + ")$")
+				for _, label := range labels {
+					expected := re.MatchString(label) != (typ == prompb.LabelMatcher_NRE)
+					tags := map[string]string{}
+					if label != "" {
+						tags["foo"] = label
+					}
+					assert.Equal(t, expected, evalCondition(t, condition, value, tags), "tags column, value %q", label)
+					assert.Equal(t, expected, evalLabelsCondition(t, labelsCondition, labelsValue, tags), "labels column, value %q", label)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/api/iterator"
+)
+
+// LabelValues returns the distinct values of the label among the series matching the
+// matchers of the query within its time range, sorted. Like the label values API of
+// Prometheus, series without the label are ignored. The query is subject to the read
+// limits like the queries of reads.
+func (c *BigqueryClient) LabelValues(ctx context.Context, name string, q *prompb.Query) ([]string, error) {
+	column, params, err := c.labelValueColumnSQL(name)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	// Only series with a value of the label are selected.
+	selected := *q
+	selected.Matchers = append(append(make([]*prompb.LabelMatcher, 0, len(q.Matchers)+1), q.Matchers...),
+		&prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: name, Value: ""})
+
+	values := map[string]struct{}{}
+	err = c.metadataQuery(ctx, &selected, "DISTINCT "+column+" AS value", params, func(row map[string]bigquery.Value) error {
+		value, ok := row["value"].(string)
+		if !ok {
+			return errors.Errorf("unexpected value %v (%T) of label %q", row["value"], row["value"], name)
+		}
+		values[value] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]string, 0, len(values))
+	for value := range values {
+		sorted = append(sorted, value)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// Series returns the distinct label sets of the series matching the matchers of the query
+// within its time range, with their labels sorted by name. The query is subject to the
+// read limits like the queries of reads.
+func (c *BigqueryClient) Series(ctx context.Context, q *prompb.Query) ([][]*prompb.Label, error) {
+	seen := map[string]struct{}{}
+	var series [][]*prompb.Label
+	err := c.metadataQuery(ctx, q, "DISTINCT metricname, "+c.seriesTagsSQL(), nil, func(row map[string]bigquery.Value) error {
+		labels, err := c.seriesLabels(row)
+		if err != nil {
+			return err
+		}
+		// Tags with the same labels in another order are the same series.
+		key := formatLabels(labels)
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		seen[key] = struct{}{}
+		series = append(series, labels)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(series, func(i, j int) bool { return formatLabels(series[i]) < formatLabels(series[j]) })
+	return series, nil
+}
+
+// labelValueColumnSQL returns the SQL selecting the value of the label from a row, and
+// the query parameters it needs.
+func (c *BigqueryClient) labelValueColumnSQL(name string) (string, []bigquery.QueryParameter, error) {
+	switch {
+	case name == model.MetricNameLabel:
+		return "metricname", nil, nil
+	case c.tagsType == TagsTypeLabels:
+		if name == "" {
+			return "", nil, errors.Errorf("invalid label name %q", name)
+		}
+		return "(SELECT l.value FROM UNNEST(labels) l WHERE l.name = @label LIMIT 1)",
+			[]bigquery.QueryParameter{{Name: "label", Value: name}}, nil
+	}
+	column, err := labelValueSQL(name)
+	return column, nil, err
+}
+
+// seriesTagsSQL returns the SQL selecting the labels of a row for series queries. Neither
+// JSON values nor arrays can be compared by DISTINCT, so both are selected as strings.
+func (c *BigqueryClient) seriesTagsSQL() string {
+	if c.tagsType == TagsTypeLabels {
+		return "TO_JSON_STRING(labels) AS labels"
+	}
+	return c.tagsColumnSQL()
+}
+
+// seriesLabels returns the labels of a row of a series query, including the metric name
+// and without the tenant label, sorted by name.
+func (c *BigqueryClient) seriesLabels(row map[string]bigquery.Value) ([]*prompb.Label, error) {
+	metricname, ok := row["metricname"].(string)
+	if !ok {
+		return nil, errors.Errorf("unexpected metric name %v (%T)", row["metricname"], row["metricname"])
+	}
+	if encoded, ok := row["labels"].(string); ok {
+		// The labels column is selected as JSON, which rowLabels takes as records.
+		var records []map[string]bigquery.Value
+		decoder := json.NewDecoder(strings.NewReader(encoded))
+		decoder.UseNumber()
+		if err := decoder.Decode(&records); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode the labels of metric %q", metricname)
+		}
+		values := make([]bigquery.Value, 0, len(records))
+		for _, record := range records {
+			values = append(values, record)
+		}
+		row = map[string]bigquery.Value{"metricname": metricname, "labels": values}
+	}
+	tags, err := rowLabels(row)
+	if err != nil {
+		return nil, errors.Wrapf(err, "row of metric %q", metricname)
+	}
+	labels := make([]*prompb.Label, 0, len(tags)+1)
+	labels = append(labels, &prompb.Label{Name: model.MetricNameLabel, Value: metricname})
+	for name, v := range tags {
+		if v == nil {
+			continue
+		}
+		value, ok := labelValue(v)
+		if !ok {
+			return nil, errors.Errorf("row of metric %q has the unexpected value %v (%T) of tag %q", metricname, v, v, name)
+		}
+		labels = append(labels, &prompb.Label{Name: name, Value: value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	if c.tenancy {
+		labels = withoutTenant(labels)
+	}
+	return labels, nil
+}
+
+// formatLabels returns a string identifying the sorted labels.
+func formatLabels(labels []*prompb.Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		fmt.Fprintf(&b, "%s\xfe%s\xff", l.Name, l.Value)
+	}
+	return b.String()
+}
+
+// metadataQuery runs a query of the label values or series API, which selects the columns
+// of the rows matching the query, and passes every row to fn. It counts towards the
+// circuit breaker like a read, and fails with a QueryError like the queries of reads.
+func (c *BigqueryClient) metadataQuery(ctx context.Context, q *prompb.Query, columns string, extraParams []bigquery.QueryParameter, fn func(row map[string]bigquery.Value) error) (err error) {
+	done, err := c.breaker.allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		done(err)
+	}()
+
+	tenant, err := c.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	if c.tenancy {
+		q = tenantQuery(q, tenant)
+	}
+	command, err := c.runMetadataQuery(ctx, q, columns, extraParams, fn)
+	if err != nil {
+		if limit, ok := ExceededLimit(err); ok {
+			c.readLimitExceeded.WithLabelValues(limit).Inc()
+		}
+		return &QueryError{Matchers: formatMatchers(q.Matchers), SQL: command, Err: err}
+	}
+	return nil
+}
+
+// runMetadataQuery runs the query of metadataQuery and returns its SQL, if it was generated.
+// The range, metric name, bytes scanned and row limits of reads apply, and it counts
+// towards the concurrent queries.
+func (c *BigqueryClient) runMetadataQuery(ctx context.Context, q *prompb.Query, columns string, extraParams []bigquery.QueryParameter, fn func(row map[string]bigquery.Value) error) (string, error) {
+	limits := c.readLimits.Load()
+	q, err := c.limitRange(ctx, limits, q)
+	if err != nil {
+		return "", err
+	}
+	if err := limits.checkMetricName(q); err != nil {
+		return "", err
+	}
+	command, params, err := c.buildSelectCommand(q, columns, "", "")
+	if err != nil {
+		return "", err
+	}
+	params = append(params, extraParams...)
+
+	queryCtx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	if err := c.checkBytesScanned(queryCtx, limits, q, command, params); err != nil {
+		return command, timeoutError(queryCtx, err, "read", c.readTimeout)
+	}
+	releaseSlot, err := c.queryLimiter.acquire(ctx)
+	if err != nil {
+		return command, err
+	}
+	defer releaseSlot()
+
+	conn := c.acquire()
+	defer conn.release()
+	c.sqlQueryCount.Inc()
+	begin := time.Now()
+	iter, err := c.querier.Read(queryCtx, c.newQuery(conn, command, params))
+	if err != nil {
+		if queryCtx.Err() != nil {
+			c.cancelJob(err)
+		}
+		return command, timeoutError(queryCtx, c.translateQueryError(q, err), "read", c.readTimeout)
+	}
+	rows := limits.limitRows(iter, q)
+	row := make(map[string]bigquery.Value, 2)
+	for {
+		err := rows.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err == nil {
+			err = fn(row)
+		}
+		if err != nil {
+			if queryCtx.Err() != nil {
+				c.cancelJob(iter)
+			}
+			return command, timeoutError(queryCtx, err, "read", c.readTimeout)
+		}
+	}
+	c.sqlQueryDuration.Observe(time.Since(begin).Seconds())
+	c.logger.DebugContext(ctx, "bigquery metadata query", slog.String("matchers", formatMatchers(q.Matchers)), slog.Duration("duration", time.Since(begin)))
+	return command, nil
+}
@@ -0,0 +1,200 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeMetadataSeries writes a sample of three series at now and one of an old series an
+// hour before.
+func writeMetadataSeries(ctx context.Context, t *testing.T, c *BigqueryClient, now int64) {
+	series := func(ts int64, labels ...string) *prompb.TimeSeries {
+		s := &prompb.TimeSeries{Samples: []prompb.Sample{{Timestamp: ts, Value: 1}}}
+		for i := 0; i < len(labels); i += 2 {
+			s.Labels = append(s.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+		}
+		return s
+	}
+	assert.NoError(t, c.Write(ctx, []*prompb.TimeSeries{
+		series(now, "__name__", "up", "job", "api", "instance", "a"),
+		series(now, "__name__", "up", "job", "db"),
+		series(now, "__name__", "http_requests_total", "job", "api", "code", "200"),
+		series(now-time.Hour.Milliseconds(), "__name__", "old_metric", "job", "batch"),
+	}))
+}
+
+// metadataQuery returns a query of the last minute before now.
+func metadataQuery(now int64, matchers ...*prompb.LabelMatcher) *prompb.Query {
+	return &prompb.Query{StartTimestampMs: now - time.Minute.Milliseconds(), EndTimestampMs: now, Matchers: matchers}
+}
+
+func TestLabelValuesFakeBigQuery(t *testing.T) {
+	now := time.Now().UnixMilli()
+	for _, tagsType := range []string{TagsTypeString, TagsTypeJSON, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTagsType(tagsType))
+			writeMetadataSeries(context.Background(), t, c, now)
+
+			values, err := c.LabelValues(context.Background(), "__name__", metadataQuery(now))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"http_requests_total", "up"}, values, "the old metric is out of range")
+
+			values, err = c.LabelValues(context.Background(), "job", metadataQuery(now))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"api", "db"}, values)
+
+			values, err = c.LabelValues(context.Background(), "instance", metadataQuery(now))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a"}, values, "series without the label are ignored")
+
+			values, err = c.LabelValues(context.Background(), "job", metadataQuery(now,
+				&prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "http_requests_total"}))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"api"}, values)
+
+			values, err = c.LabelValues(context.Background(), "missing", metadataQuery(now))
+			assert.NoError(t, err)
+			assert.Empty(t, values)
+		})
+	}
+}
+
+func TestSeriesFakeBigQuery(t *testing.T) {
+	now := time.Now().UnixMilli()
+	for _, tagsType := range []string{TagsTypeString, TagsTypeJSON, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTagsType(tagsType))
+			writeMetadataSeries(context.Background(), t, c, now)
+			// A second sample of a series doesn't repeat it.
+			assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "db"}},
+				Samples: []prompb.Sample{{Timestamp: now - 1000, Value: 0}},
+			}}))
+
+			series, err := c.Series(context.Background(), metadataQuery(now,
+				&prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}))
+			assert.NoError(t, err)
+			assert.Equal(t, [][]*prompb.Label{
+				{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a"}, {Name: "job", Value: "api"}},
+				{{Name: "__name__", Value: "up"}, {Name: "job", Value: "db"}},
+			}, series)
+
+			series, err = c.Series(context.Background(), metadataQuery(now,
+				&prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api|batch"}))
+			assert.NoError(t, err)
+			assert.Equal(t, [][]*prompb.Label{
+				{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}, {Name: "job", Value: "api"}},
+				{{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a"}, {Name: "job", Value: "api"}},
+			}, series)
+		})
+	}
+}
+
+func TestMetadataTenancy(t *testing.T) {
+	now := time.Now().UnixMilli()
+	c := newFakeBigQueryClient(WithTenancy(true))
+	writeMetadataSeries(ContextWithTenant(context.Background(), "team"), t, c, now)
+	assert.NoError(t, c.Write(ContextWithTenant(context.Background(), "other"), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "secret_metric"}},
+		Samples: []prompb.Sample{{Timestamp: now, Value: 1}},
+	}}))
+
+	_, err := c.LabelValues(context.Background(), "__name__", metadataQuery(now))
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	ctx := ContextWithTenant(context.Background(), "other")
+	values, err := c.LabelValues(ctx, "__name__", metadataQuery(now))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"secret_metric"}, values)
+	series, err := c.Series(ctx, metadataQuery(now, &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: ".+"}))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]*prompb.Label{{{Name: "__name__", Value: "secret_metric"}}}, series, "without the tenant label")
+}
+
+func TestMetadataLimits(t *testing.T) {
+	now := time.Now().UnixMilli()
+	name := &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}
+	lookups := map[string]func(c *BigqueryClient, q *prompb.Query) error{
+		"label_values": func(c *BigqueryClient, q *prompb.Query) error {
+			_, err := c.LabelValues(context.Background(), "job", q)
+			return err
+		},
+		"series": func(c *BigqueryClient, q *prompb.Query) error {
+			_, err := c.Series(context.Background(), q)
+			return err
+		},
+	}
+
+	for lookup, run := range lookups {
+		t.Run(lookup, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithMaxRange(time.Minute, RangeLimitReject), WithRequireMetricName(true), WithMaxRows(1))
+			writeMetadataSeries(context.Background(), t, c, now)
+
+			long := metadataQuery(now, name)
+			long.StartTimestampMs -= time.Hour.Milliseconds()
+			err := run(c, long)
+			limit, _ := ExceededLimit(err)
+			assert.Equal(t, "range", limit, "%v", err)
+
+			err = run(c, metadataQuery(now))
+			limit, _ = ExceededLimit(err)
+			assert.Equal(t, "metric_name", limit, "%v", err)
+
+			err = run(c, metadataQuery(now, name))
+			limit, _ = ExceededLimit(err)
+			assert.Equal(t, "rows", limit, "%v", err)
+
+			c.updateReadLimits(func(l *ReadLimits) { l.MaxRows = 0; l.MaxBytesScanned = 1000 })
+			c.dryRun = func(_ context.Context, command string, _ []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+				assert.True(t, strings.HasPrefix(command, "SELECT DISTINCT "), command)
+				return &bigquery.JobStatistics{TotalBytesProcessed: 5000}, nil
+			}
+			err = run(c, metadataQuery(now, name))
+			limit, _ = ExceededLimit(err)
+			assert.Equal(t, "bytes_scanned", limit, "%v", err)
+
+			assert.Equal(t, 1.0, scrape(t, c)[`storage_bigquery_read_limit_exceeded_total{limit="bytes_scanned"}`])
+		})
+	}
+}
+
+func TestMetadataBytesBilled(t *testing.T) {
+	querier := &fakeQuerier{err: &bigquery.Error{Reason: bytesBilledLimitExceeded, Message: "Query exceeded limit for bytes billed: 1000."}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithMaxBytesBilled(1000))
+	_, err := c.LabelValues(context.Background(), "job", testQuery)
+	limit, _ := ExceededLimit(err)
+	assert.Equal(t, "bytes_billed", limit, "%v", err)
+	if assert.Len(t, querier.queries, 1) {
+		assert.Equal(t, int64(1000), querier.queries[0].MaxBytesBilled)
+	}
+}
+
+func TestLabelValuesInvalidName(t *testing.T) {
+	for _, tagsType := range []string{TagsTypeString, TagsTypeLabels} {
+		c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{err: errors.New("must not run")}), WithTagsType(tagsType))
+		_, err := c.LabelValues(context.Background(), "", testQuery)
+		assert.ErrorIs(t, err, ErrBadRequest, tagsType)
+	}
+}
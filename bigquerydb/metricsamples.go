@@ -0,0 +1,93 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"sync"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OtherMetricNames is the metricname label value the samples of all metric names over
+// the limit of WithPerMetricSamples are counted with.
+const OtherMetricNames = "other"
+
+// WithPerMetricSamples counts the written samples by metric name in
+// storage_bigquery_sent_samples_by_metric_total. The first limit metric names written
+// get a counter of their own, the samples of all later ones are counted as
+// OtherMetricNames, so that the cardinality of the metric stays bounded. Values less
+// than or equal to zero disable the metric.
+func WithPerMetricSamples(limit int) Option {
+	return func(c *BigqueryClient) {
+		c.metricSamplesLimit = limit
+	}
+}
+
+// metricSamplesCounter counts samples by metric name for at most limit metric names.
+type metricSamplesCounter struct {
+	limit int
+	vec   *prometheus.CounterVec
+
+	mu      sync.Mutex
+	tracked map[string]prometheus.Counter
+	other   prometheus.Counter
+}
+
+func newMetricSamplesCounter(f metricfactory.Factory, limit int) *metricSamplesCounter {
+	return &metricSamplesCounter{
+		limit: limit,
+		vec: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sent_samples_by_metric_total",
+				Help: "Total number of samples sent to BigQuery by metric name, for a limited number of metric names.",
+			},
+			[]string{"metricname"},
+		),
+		tracked: map[string]prometheus.Counter{},
+	}
+}
+
+// add counts the rows of a written chunk by their metric name.
+func (m *metricSamplesCounter) add(chunk []*Item) {
+	if m.limit <= 0 {
+		return
+	}
+	counts := map[string]int{}
+	for _, item := range chunk {
+		counts[item.metricname]++
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, n := range counts {
+		m.counter(name).Add(float64(n))
+	}
+}
+
+// counter returns the counter of the metric name, which is the counter of other metric
+// names once the limit is reached. It must be called with the mutex held.
+func (m *metricSamplesCounter) counter(name string) prometheus.Counter {
+	if counter, ok := m.tracked[name]; ok {
+		return counter
+	}
+	if len(m.tracked) < m.limit && name != OtherMetricNames {
+		counter := m.vec.WithLabelValues(name)
+		m.tracked[name] = counter
+		return counter
+	}
+	if m.other == nil {
+		m.other = m.vec.WithLabelValues(OtherMetricNames)
+	}
+	return m.other
+}
@@ -0,0 +1,90 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// metricSeries returns a series of the metric with the given number of samples.
+func metricSeries(name string, samples int) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: name}}}
+	for i := range samples {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i) * 1000, Value: 1})
+	}
+	return ts
+}
+
+// collectedSeries returns the number of series of the per metric samples counter.
+func collectedSeries(c *BigqueryClient) int {
+	ch := make(chan prometheus.Metric, 100)
+	c.metricSamples.vec.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestPerMetricSamplesLimit(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithPerMetricSamples(2))
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{metricSeries("up", 3), metricSeries("http_requests_total", 2)}))
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{metricSeries("node_load1", 4), metricSeries("up", 1), metricSeries("go_goroutines", 5)}))
+
+	assert.Equal(t, 4.0, metricValue(c.metricSamples.vec.WithLabelValues("up")))
+	assert.Equal(t, 2.0, metricValue(c.metricSamples.vec.WithLabelValues("http_requests_total")))
+	assert.Equal(t, 9.0, metricValue(c.metricSamples.vec.WithLabelValues(OtherMetricNames)), "metric names over the limit are counted as other")
+	assert.Len(t, c.metricSamples.tracked, 2)
+	assert.Equal(t, 3, collectedSeries(c), "the cardinality is capped")
+}
+
+func TestPerMetricSamplesDisabled(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{metricSeries("up", 3)}))
+	assert.Zero(t, collectedSeries(c))
+}
+
+func TestPerMetricSamplesFailedInsert(t *testing.T) {
+	c := newTestClient(&fakeInserter{err: errors.New("insert failed")}, WithPerMetricSamples(10))
+	assert.Error(t, c.Write(context.Background(), []*prompb.TimeSeries{metricSeries("up", 3)}))
+	assert.Empty(t, c.metricSamples.tracked, "only written samples are counted")
+}
+
+func TestPerMetricSamplesConcurrent(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithPerMetricSamples(5))
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{metricSeries(fmt.Sprintf("metric_%d", i), 10)}))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 6, collectedSeries(c))
+	total := metricValue(c.metricSamples.vec.WithLabelValues(OtherMetricNames))
+	for name := range c.metricSamples.tracked {
+		total += metricValue(c.metricSamples.vec.WithLabelValues(name))
+	}
+	assert.Equal(t, 200.0, total, "no sample is lost")
+	assert.Equal(t, 150.0, metricValue(c.metricSamples.vec.WithLabelValues(OtherMetricNames)))
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+)
+
+// MigrationPlan is the difference between the schema of a table and the schema the
+// adapter writes and reads with its configuration.
+type MigrationPlan struct {
+	Table string `json:"table"`
+	// Add are the missing columns, which are added as NULLABLE columns.
+	Add []MigrationColumn `json:"add"`
+	// Incompatible are the differences which can't be applied in place, like columns of
+	// another type or mode and another partitioning. The table has to be recreated, e.g. by
+	// copying it with a query, to resolve them.
+	Incompatible []string `json:"incompatible"`
+	// Notes are differences which don't keep the adapter from working, like a missing
+	// clustering on metricname.
+	Notes []string `json:"notes"`
+	// Applied is whether the missing columns were added.
+	Applied bool `json:"applied"`
+}
+
+// MigrationColumn is a column added by a migration.
+type MigrationColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// UpToDate returns whether the table needs no changes.
+func (p *MigrationPlan) UpToDate() bool {
+	return len(p.Add) == 0 && len(p.Incompatible) == 0
+}
+
+// Migrate compares the schema of the table with the columns the adapter writes and reads,
+// and returns the plan to migrate the table. With apply, the missing columns are added,
+// unless the plan has incompatible differences. Columns are never dropped or changed, so
+// migrating a table again changes nothing. The schema is updated with the etag of the
+// metadata it was planned with, which fails if the table was changed in the meantime.
+func (c *BigqueryClient) Migrate(ctx context.Context, apply bool) (*MigrationPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	table := c.tableName(c.datasetID, c.tableID)
+	md, err := c.tableAdmin.Metadata(ctx)
+	if isHTTPError(err, http.StatusNotFound) {
+		return nil, errors.Errorf("table %s doesn't exist, create it with bigquery.create-table or the schema in bq-schema.json", table)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the metadata of table %s", table)
+	}
+
+	plan := &MigrationPlan{Table: table, Add: []MigrationColumn{}, Incompatible: []string{}, Notes: []string{}}
+	var present []requiredColumn
+	var added []*bigquery.FieldSchema
+	for _, column := range c.requiredColumns() {
+		if !slices.ContainsFunc(md.Schema, func(field *bigquery.FieldSchema) bool { return field.Name == column.name }) {
+			plan.Add = append(plan.Add, MigrationColumn{Name: column.name, Type: column.typeName()})
+			added = append(added, column.fieldSchema())
+			continue
+		}
+		present = append(present, column)
+	}
+	mismatches, _ := checkColumns("", present, md.Schema)
+	plan.Incompatible = append(plan.Incompatible, mismatches...)
+
+	switch {
+	case c.dateSharding:
+		// The shards aren't partitioned.
+	case md.TimePartitioning != nil:
+		if mismatch := c.checkPartitioning(md.TimePartitioning); mismatch != "" {
+			plan.Incompatible = append(plan.Incompatible, mismatch)
+		}
+	case md.RangePartitioning == nil:
+		plan.Notes = append(plan.Notes, "the table isn't partitioned, every read scans the whole table")
+	}
+	if md.Clustering == nil || len(md.Clustering.Fields) == 0 || md.Clustering.Fields[0] != "metricname" {
+		plan.Notes = append(plan.Notes, "the table isn't clustered on metricname first, reads for a metric name scan the blocks of other metrics")
+	}
+
+	if !apply || len(added) == 0 || len(plan.Incompatible) > 0 {
+		return plan, nil
+	}
+	schema := append(slices.Clone(md.Schema), added...)
+	_, err = c.tableAdmin.Update(ctx, bigquery.TableMetadataToUpdate{Schema: schema}, md.ETag)
+	if isHTTPError(err, http.StatusPreconditionFailed) {
+		return plan, errors.Errorf("table %s was changed while migrating it, migrate it again", table)
+	}
+	if err != nil {
+		return plan, errors.Wrapf(err, "failed to add the columns to table %s", table)
+	}
+	plan.Applied = true
+	for _, column := range plan.Add {
+		c.logger.Info("added column", slog.String("table", table), slog.String("column", column.Name), slog.String("type", column.Type))
+	}
+	return plan, nil
+}
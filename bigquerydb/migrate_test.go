@@ -0,0 +1,116 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// migratedTable returns the metadata of a table with the schema of the adapter, partitioned
+// and clustered as created by the adapter.
+func migratedTable() *bigquery.TableMetadata {
+	return &bigquery.TableMetadata{
+		Schema:           adapterSchema(),
+		TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"},
+		Clustering:       &bigquery.Clustering{Fields: []string{"metricname"}},
+		ETag:             "etag-1",
+	}
+}
+
+func TestMigrateAddsColumns(t *testing.T) {
+	admin := &fakeTableAdmin{md: migratedTable()}
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithSeriesHashColumn(true), WithSpecialValueColumn(true))
+
+	plan, err := c.Migrate(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationColumn{{Name: specialValueColumn, Type: "STRING"}, {Name: seriesHashColumn, Type: "INT64"}}, plan.Add)
+	assert.Empty(t, plan.Incompatible)
+	assert.False(t, plan.Applied)
+	assert.Empty(t, admin.updates, "the plan alone changes nothing")
+
+	plan, err = c.Migrate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.True(t, plan.Applied)
+	if assert.Len(t, admin.updates, 1) {
+		schema := admin.updates[0].Schema
+		assert.Equal(t, adapterSchema(), schema[:4], "the existing columns are kept as they are")
+		assert.Equal(t, bigquery.Schema{
+			{Name: specialValueColumn, Type: bigquery.StringFieldType},
+			{Name: seriesHashColumn, Type: bigquery.IntegerFieldType},
+		}, schema[4:])
+	}
+	assert.Equal(t, []string{"etag-1"}, admin.etags)
+
+	// Migrating the migrated table again changes nothing.
+	admin.md.Schema = admin.updates[0].Schema
+	plan, err = c.Migrate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.True(t, plan.UpToDate())
+	assert.False(t, plan.Applied)
+	assert.Len(t, admin.updates, 1)
+}
+
+func TestMigrateUpToDate(t *testing.T) {
+	admin := &fakeTableAdmin{md: migratedTable()}
+	admin.md.Schema = append(admin.md.Schema, &bigquery.FieldSchema{Name: "comment", Type: bigquery.StringFieldType})
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin))
+
+	plan, err := c.Migrate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.True(t, plan.UpToDate(), "extra nullable columns are kept")
+	assert.Empty(t, plan.Notes)
+	assert.False(t, plan.Applied)
+	assert.Empty(t, admin.updates)
+}
+
+func TestMigrateRefusesIncompatibleChanges(t *testing.T) {
+	md := migratedTable()
+	md.Schema[3].Type = bigquery.StringFieldType
+	md.TimePartitioning = &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType, Field: "timestamp"}
+	md.Clustering = nil
+	admin := &fakeTableAdmin{md: md}
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithSeriesHashColumn(true))
+
+	plan, err := c.Migrate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []MigrationColumn{{Name: seriesHashColumn, Type: "INT64"}}, plan.Add)
+	assert.Equal(t, []string{
+		"column value: expected FLOAT64, found STRING",
+		"the table is partitioned by the column timestamp per hour, not by the column timestamp per day",
+	}, plan.Incompatible)
+	assert.Len(t, plan.Notes, 1)
+	assert.False(t, plan.Applied)
+	assert.Empty(t, admin.updates, "nothing is changed while there are incompatible differences")
+}
+
+func TestMigrateErrors(t *testing.T) {
+	admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithSeriesHashColumn(true))
+	_, err := c.Migrate(context.Background(), true)
+	assert.ErrorContains(t, err, "table dataset.table doesn't exist")
+
+	admin = &fakeTableAdmin{md: migratedTable(), updateErr: &googleapi.Error{Code: http.StatusPreconditionFailed}}
+	c = newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithSeriesHashColumn(true))
+	plan, err := c.Migrate(context.Background(), true)
+	assert.EqualError(t, err, "table dataset.table was changed while migrating it, migrate it again")
+	assert.False(t, plan.Applied)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+)
+
+// Behaviors for rows exceeding the maximum row size.
+const (
+	// OversizeDrop drops the rows.
+	OversizeDrop = "drop"
+	// OversizeTruncate truncates long label values and marks the series with TruncatedLabel.
+	OversizeTruncate = "truncate"
+)
+
+// TruncatedLabel is added to series whose label values were truncated to fit into a row.
+const TruncatedLabel = "__truncated__"
+
+// WithMaxRowSize limits the estimated size of a single row, as BigQuery rejects inserts
+// with rows over its row size limit. Rows over maxBytes are dropped with OversizeDrop, or
+// with OversizeTruncate their label values are truncated to maxLabelLength bytes. Values
+// of maxBytes less than or equal to zero disable the limit.
+func WithMaxRowSize(maxBytes int, behavior string, maxLabelLength int) Option {
+	return func(c *BigqueryClient) {
+		c.maxRowSize = maxBytes
+		c.oversizeBehavior = behavior
+		c.truncatedLabelLength = maxLabelLength
+	}
+}
+
+// rowSize estimates the size of the rows of a series like Item.estimatedSize.
+func rowSize(metricname, tags string) int {
+	return len(metricname) + len(tags) + itemOverhead
+}
+
+// fitRowSize handles a series whose rows exceed the maximum row size. With
+// OversizeTruncate it truncates the label values of the metric in place and returns the
+// new tags. It returns false if the rows of the series have to be dropped.
+func (c *BigqueryClient) fitRowSize(metric model.Metric, tags string) (string, bool) {
+	if c.oversizeBehavior != OversizeTruncate {
+		return tags, false
+	}
+	for name, value := range metric {
+		// The metric name and tenant are kept, so that the series can still be found.
+		if name == model.MetricNameLabel || name == TenantLabel || len(value) <= c.truncatedLabelLength {
+			continue
+		}
+		metric[name] = truncateLabelValue(value, c.truncatedLabelLength)
+	}
+	metric[TruncatedLabel] = "true"
+	tags = tagsFromMetric(metric)
+	return tags, rowSize(string(metric[model.MetricNameLabel]), tags) <= c.maxRowSize
+}
+
+// truncateLabelValue cuts the value to at most maxLength bytes without splitting a UTF-8
+// character.
+func truncateLabelValue(value model.LabelValue, maxLength int) model.LabelValue {
+	n := max(maxLength, 0)
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
@@ -0,0 +1,98 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// oversizedSeries returns a series with a multi-megabyte label value between two small series.
+func oversizedSeries() []*prompb.TimeSeries {
+	samples := []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}
+	return []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, Samples: samples},
+		{
+			Labels: []*prompb.Label{
+				{Name: "__name__", Value: "alerts"},
+				{Name: "description", Value: strings.Repeat("ä", 2*1024*1024)},
+				{Name: "severity", Value: "critical"},
+			},
+			Samples: samples,
+		},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "web"}}, Samples: samples},
+	}
+}
+
+func TestWriteOversizeDrop(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowSize(1024*1024, OversizeDrop, 1024))
+	var logs bytes.Buffer
+	c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	assert.NoError(t, c.Write(context.Background(), oversizedSeries()))
+	rows := ins.rows()
+	assert.Len(t, rows, 4, "the other rows of the batch are written")
+	for _, row := range rows {
+		assert.Equal(t, "up", row.metricname)
+	}
+	assert.Equal(t, 2.0, metricValue(c.droppedSamples.WithLabelValues("row_too_large")))
+	assert.Equal(t, 1, strings.Count(logs.String(), "rows exceed the maximum row size"), "a single warning is logged")
+	assert.Contains(t, logs.String(), "metric=alerts")
+}
+
+func TestWriteOversizeTruncate(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowSize(1024*1024, OversizeTruncate, 1001))
+
+	assert.NoError(t, c.Write(context.Background(), oversizedSeries()))
+	rows := ins.rows()
+	if !assert.Len(t, rows, 6) {
+		return
+	}
+	var tags map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(rows[2].tags), &tags))
+	assert.Equal(t, "alerts", rows[2].metricname)
+	assert.Equal(t, strings.Repeat("ä", 500), tags["description"], "values are truncated at a character boundary")
+	assert.Equal(t, "critical", tags["severity"])
+	assert.Equal(t, "true", tags[TruncatedLabel])
+	assert.Zero(t, metricValue(c.droppedSamples.WithLabelValues("row_too_large")))
+	assert.Equal(t, `{"job":"web"}`, rows[4].tags, "other series aren't changed")
+}
+
+func TestWriteOversizeTruncateStillTooLarge(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowSize(512, OversizeTruncate, 1024))
+
+	assert.NoError(t, c.Write(context.Background(), oversizedSeries()))
+	assert.Len(t, ins.rows(), 4)
+	assert.Equal(t, 2.0, metricValue(c.droppedSamples.WithLabelValues("row_too_large")))
+}
+
+func TestTruncateLabelValue(t *testing.T) {
+	assert.Equal(t, model.LabelValue("ab"), truncateLabelValue("abc", 2))
+	assert.Equal(t, model.LabelValue("a"), truncateLabelValue("aäc", 2))
+	assert.Equal(t, model.LabelValue("aä"), truncateLabelValue("aäc", 3))
+	assert.Equal(t, model.LabelValue(""), truncateLabelValue("abc", 0))
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Partitioning schemes of the tables.
+const (
+	// PartitioningColumn partitions the tables by the timestamp column.
+	PartitioningColumn = "column"
+	// PartitioningIngestion partitions the tables by the time BigQuery ingested the rows.
+	PartitioningIngestion = "ingestion"
+)
+
+// Granularities of the time partitions.
+const (
+	PartitionHour  = "hour"
+	PartitionDay   = "day"
+	PartitionMonth = "month"
+)
+
+// partitionConditionSQL selects the ingestion time partitions which may hold the samples of
+// the time range of a read. Rows in the streaming buffer have no partition time yet.
+const partitionConditionSQL = "(_PARTITIONTIME >= @partition_start OR _PARTITIONTIME IS NULL)"
+
+// WithPartitioning sets how the tables are partitioned: by the timestamp column or by
+// ingestion time, per hour, day or month. Tables are created with it, ValidateSchema
+// fails for tables partitioned in another way, and reads of tables partitioned by
+// ingestion time only scan the partitions which may hold samples of their time range.
+// A timestamp column of milliseconds is only partitioned by day.
+func WithPartitioning(scheme, granularity string) Option {
+	return func(c *BigqueryClient) {
+		c.partitioning = scheme
+		c.partitionGranularity = granularity
+	}
+}
+
+// timePartitioningType returns the type of the time partitions of the granularity.
+func timePartitioningType(granularity string) bigquery.TimePartitioningType {
+	switch granularity {
+	case PartitionHour:
+		return bigquery.HourPartitioningType
+	case PartitionMonth:
+		return bigquery.MonthPartitioningType
+	default:
+		return bigquery.DayPartitioningType
+	}
+}
+
+// timePartitioning returns the time partitioning tables are created with, which is nil
+// for tables partitioned by integer ranges of the timestamp column.
+func (c *BigqueryClient) timePartitioning() *bigquery.TimePartitioning {
+	if c.partitioning != PartitioningIngestion && c.timestampMillis() {
+		return nil
+	}
+	tp := &bigquery.TimePartitioning{Type: timePartitioningType(c.partitionGranularity)}
+	if c.partitioning != PartitioningIngestion {
+		tp.Field = "timestamp"
+	}
+	if c.retentionEnforce {
+		tp.Expiration = c.retention
+	}
+	return tp
+}
+
+// describePartitioning describes a time partitioning in mismatches.
+func describePartitioning(tp *bigquery.TimePartitioning) string {
+	granularity := strings.ToLower(string(tp.Type))
+	if granularity == "" {
+		granularity = PartitionDay
+	}
+	if tp.Field == "" {
+		return fmt.Sprintf("by ingestion time per %s", granularity)
+	}
+	return fmt.Sprintf("by the column %s per %s", tp.Field, granularity)
+}
+
+// checkPartitioning returns the mismatch of a time partitioned table with the configured
+// partitioning, if any.
+func (c *BigqueryClient) checkPartitioning(tp *bigquery.TimePartitioning) string {
+	expected := c.timePartitioning()
+	if expected == nil {
+		return fmt.Sprintf("the table is partitioned %s, not by integer ranges of the timestamp column", describePartitioning(tp))
+	}
+	actual := *tp
+	if actual.Type == "" {
+		actual.Type = bigquery.DayPartitioningType
+	}
+	if actual.Field != expected.Field || actual.Type != expected.Type {
+		return fmt.Sprintf("the table is partitioned %s, not %s", describePartitioning(&actual), describePartitioning(expected))
+	}
+	return ""
+}
+
+// tableConditions returns the conditions on the pseudo columns of the tables read from,
+// which select the shards or ingestion time partitions of the time range of a read.
+// Tables selected from a union have to apply them to every table of the union.
+func (c *BigqueryClient) tableConditions() []string {
+	switch {
+	case c.readTableID != "":
+		return nil
+	case c.dateSharding:
+		return []string{shardConditionSQL}
+	case c.partitioning == PartitioningIngestion && c.maxFutureSkew > 0:
+		return []string{partitionConditionSQL}
+	}
+	return nil
+}
+
+// tableConditionParams returns the parameters of the table conditions of the query.
+func (c *BigqueryClient) tableConditionParams(startMs, endMs int64) []bigquery.QueryParameter {
+	if c.dateSharding {
+		return shardParams(startMs, endMs)
+	}
+	// Samples ahead of the current time are ingested up to the future skew before their time.
+	start := time.UnixMilli(startMs).Add(-c.maxFutureSkew).UTC()
+	return []bigquery.QueryParameter{{Name: "partition_start", Value: truncatePartition(start, c.partitionGranularity)}}
+}
+
+// truncatePartition returns the start of the partition of the granularity containing t.
+func truncatePartition(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case PartitionHour:
+		return t.Truncate(time.Hour)
+	case PartitionMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
@@ -0,0 +1,105 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestPartitioning(t *testing.T) {
+	// The start of the query is 2026-03-15 10:30 UTC, the partitions start 10 minutes of
+	// future skew earlier.
+	start := time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		scheme, granularity string
+		partitioning        *bigquery.TimePartitioning
+		partitionStart      time.Time
+	}{
+		{PartitioningColumn, PartitionHour, &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType, Field: "timestamp"}, time.Time{}},
+		{PartitioningColumn, PartitionDay, &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "timestamp"}, time.Time{}},
+		{PartitioningColumn, PartitionMonth, &bigquery.TimePartitioning{Type: bigquery.MonthPartitioningType, Field: "timestamp"}, time.Time{}},
+		{PartitioningIngestion, PartitionHour, &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType}, time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)},
+		{PartitioningIngestion, PartitionDay, &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType}, time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{PartitioningIngestion, PartitionMonth, &bigquery.TimePartitioning{Type: bigquery.MonthPartitioningType}, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tc.scheme+"/"+tc.granularity, func(t *testing.T) {
+			admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+			c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithPartitioning(tc.scheme, tc.granularity), WithMaxFutureSkew(10*time.Minute, FutureSampleDrop))
+
+			// Created tables are partitioned as configured.
+			assert.NoError(t, c.createTableIfMissing(context.Background()))
+			if assert.NotNil(t, admin.created) {
+				assert.Equal(t, tc.partitioning, admin.created.TimePartitioning)
+			}
+
+			// Existing tables have to be partitioned as configured.
+			admin = &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: adapterSchema(), TimePartitioning: tc.partitioning}}
+			c.tableAdmin = admin
+			assert.NoError(t, c.ValidateSchema(context.Background()))
+			other := &bigquery.TimePartitioning{Type: bigquery.YearPartitioningType}
+			admin.md.TimePartitioning = other
+			err := c.ValidateSchema(context.Background())
+			var schemaErr *SchemaError
+			if assert.ErrorAs(t, err, &schemaErr) {
+				assert.Equal(t, []string{"the table is partitioned by ingestion time per year, not " + describePartitioning(tc.partitioning)}, schemaErr.Mismatches)
+			}
+
+			// Reads only prune ingestion time partitions themselves.
+			query, params, err := c.buildCommand(sensorQuery(start.UnixMilli(), start.Add(time.Hour).UnixMilli()))
+			assert.NoError(t, err)
+			if tc.scheme == PartitioningColumn {
+				assert.NotContains(t, query, "_PARTITIONTIME")
+				assert.Len(t, params, 3)
+				return
+			}
+			assert.Contains(t, query, " WHERE metricname = @m0 AND (_PARTITIONTIME >= @partition_start OR _PARTITIONTIME IS NULL) AND timestamp >= ")
+			assert.Contains(t, params, bigquery.QueryParameter{Name: "partition_start", Value: tc.partitionStart})
+		})
+	}
+}
+
+func TestPartitioningMismatchMessages(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.Empty(t, c.checkPartitioning(&bigquery.TimePartitioning{Field: "timestamp"}), "the type defaults to day")
+	assert.Equal(t, "the table is partitioned by the column timestamp per hour, not by the column timestamp per day",
+		c.checkPartitioning(&bigquery.TimePartitioning{Type: bigquery.HourPartitioningType, Field: "timestamp"}))
+	assert.Equal(t, "the table is partitioned by the column created per day, not by the column timestamp per day",
+		c.checkPartitioning(&bigquery.TimePartitioning{Field: "created"}))
+
+	c = newTestClient(&fakeInserter{}, WithTimestampType(TimestampTypeMillis))
+	assert.Equal(t, "the table is partitioned by ingestion time per day, not by integer ranges of the timestamp column",
+		c.checkPartitioning(&bigquery.TimePartitioning{}))
+}
+
+func TestPartitioningRoutesAndSkew(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithPartitioning(PartitioningIngestion, PartitionDay), WithMaxFutureSkew(time.Minute, FutureSampleDrop), WithRoutes(testRoutes()))
+	query, _, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `short.buckets` WHERE (_PARTITIONTIME >= @partition_start OR _PARTITIONTIME IS NULL))")
+
+	// Without a limit of the future skew samples may be ingested at any time before theirs.
+	c = newTestClient(&fakeInserter{}, WithPartitioning(PartitioningIngestion, PartitionDay))
+	query, _, err = c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.NotContains(t, query, "_PARTITIONTIME")
+}
@@ -0,0 +1,199 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape gathers the metrics of the client from a registry. The values are keyed by the
+// metric name followed by its labels, like name{reason="size"}; histograms are keyed by
+// their name with a _count and a _sum suffix.
+func scrape(t *testing.T, c *BigqueryClient) map[string]float64 {
+	reg := prometheus.NewPedanticRegistry()
+	assert.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			key := family.GetName()
+			if len(m.GetLabel()) > 0 {
+				key += "{"
+				for i, l := range m.GetLabel() {
+					if i > 0 {
+						key += ","
+					}
+					key += fmt.Sprintf("%s=%q", l.GetName(), l.GetValue())
+				}
+				key += "}"
+			}
+			switch {
+			case m.Counter != nil:
+				values[key] = m.Counter.GetValue()
+			case m.Gauge != nil:
+				values[key] = m.Gauge.GetValue()
+			case m.Histogram != nil:
+				values[key+"_count"] = float64(m.Histogram.GetSampleCount())
+				values[key+"_sum"] = m.Histogram.GetSampleSum()
+			}
+		}
+	}
+	return values
+}
+
+func TestBufferPipelineMetrics(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowsPerInsert(10), WithAsyncWrites(20, time.Hour))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 4)))
+	metrics := scrape(t, c)
+	assert.Equal(t, 4.0, metrics["storage_bigquery_buffered_samples"])
+	assert.Greater(t, metrics["storage_bigquery_buffered_bytes"], 0.0)
+	assert.Greater(t, metrics["storage_bigquery_buffer_oldest_sample_age_seconds"], 0.0)
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 6)))
+	assert.Eventually(t, func() bool { return len(ins.rows()) == 10 }, time.Second, 5*time.Millisecond)
+	metrics = scrape(t, c)
+	assert.Zero(t, metrics["storage_bigquery_buffered_samples"])
+	assert.Zero(t, metrics["storage_bigquery_buffered_bytes"])
+	assert.Zero(t, metrics["storage_bigquery_buffer_oldest_sample_age_seconds"])
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_buffer_flushes_total{reason="size"}`])
+	assert.Equal(t, 1.0, metrics["storage_bigquery_buffer_flush_rows_count"])
+	assert.Equal(t, 10.0, metrics["storage_bigquery_buffer_flush_rows_sum"])
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 8)))
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 15)))
+	assert.Equal(t, 15.0, scrape(t, c)[`storage_bigquery_backpressure_rejected_samples_total{stage="buffer"}`])
+
+	assert.NoError(t, c.Close())
+	metrics = scrape(t, c)
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_buffer_flushes_total{reason="shutdown"}`])
+	assert.Equal(t, 18.0, metrics["storage_bigquery_buffer_flush_rows_sum"])
+}
+
+func TestBufferFlushByTimeMetric(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithAsyncWrites(100, 20*time.Millisecond))
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	assert.Eventually(t, func() bool {
+		return scrape(t, c)[`storage_bigquery_buffer_flushes_total{reason="time"}`] == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCoalescePipelineMetrics(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithCoalescing(1000, 0, time.Hour))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return scrape(t, c)["storage_bigquery_coalesce_pending_samples"] == 6
+	}, time.Second, 5*time.Millisecond)
+	metrics := scrape(t, c)
+	assert.Greater(t, metrics["storage_bigquery_coalesce_pending_bytes"], 0.0)
+	assert.Greater(t, metrics["storage_bigquery_coalesce_oldest_sample_age_seconds"], 0.0)
+
+	assert.NoError(t, c.Close())
+	wg.Wait()
+	metrics = scrape(t, c)
+	assert.Zero(t, metrics["storage_bigquery_coalesce_pending_samples"])
+	assert.Zero(t, metrics["storage_bigquery_coalesce_pending_bytes"])
+	assert.Zero(t, metrics["storage_bigquery_coalesce_oldest_sample_age_seconds"])
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_coalesce_flushes_total{reason="shutdown"}`])
+	assert.Equal(t, 2.0, metrics["storage_bigquery_coalesce_flush_writes_sum"])
+	assert.Equal(t, 6.0, metrics["storage_bigquery_coalesce_flush_rows_sum"])
+}
+
+func TestQueueBackpressureMetric(t *testing.T) {
+	ins := &fakeInserter{delay: 50 * time.Millisecond}
+	c := newTestClient(ins, WithMaxRowsPerInsert(1), WithInsertConcurrency(1, 0))
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 4))
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, float64(writeErr.FailedSamples), scrape(t, c)[`storage_bigquery_backpressure_rejected_samples_total{stage="queue"}`])
+	}
+}
+
+func TestSpillPipelineMetrics(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	c := newSpillClient(t, ins, t.TempDir(), 1<<20)
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	metrics := scrape(t, c)
+	assert.Equal(t, 1.0, metrics["storage_bigquery_spill_segments"])
+	assert.Equal(t, float64(c.spill.bytes()), metrics["storage_bigquery_spill_bytes"])
+	assert.Greater(t, metrics["storage_bigquery_spill_bytes"], 0.0)
+
+	ins.setErr(nil)
+	c.spill.replayAll()
+	metrics = scrape(t, c)
+	assert.Zero(t, metrics["storage_bigquery_spill_segments"])
+	assert.Zero(t, metrics["storage_bigquery_spill_bytes"])
+	assert.Equal(t, 3.0, metrics["storage_bigquery_spill_replayed_samples_total"])
+}
+
+func TestMetricFactory(t *testing.T) {
+	f := metricfactory.Factory{Namespace: "prombq", ConstLabels: prometheus.Labels{"env": "test"}}
+	c := newTestClient(&fakeInserter{}, WithMetricFactory(f), WithPerMetricSamples(10))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 4)))
+	metrics := scrape(t, c)
+	assert.Equal(t, 4.0, metrics[`prombq_written_rows_total{env="test"}`])
+	assert.Equal(t, 4.0, metrics[`prombq_sent_samples_by_metric_total{env="test",metricname="up"}`])
+	for name := range metrics {
+		assert.NotContains(t, name, "storage_bigquery_")
+		assert.Contains(t, name, `env="test"`)
+	}
+}
+
+func TestMetricFactoryBuckets(t *testing.T) {
+	f := metricfactory.Factory{Namespace: "prombq", WriteDurationBuckets: []float64{0.01, 0.1}, ReadDurationBuckets: []float64{1, 60, 600}}
+	c := newTestClient(&fakeInserter{}, WithMetricFactory(f))
+	c.batchWriteDuration.Observe(0.05)
+	c.sqlQueryDuration.Observe(90)
+
+	reg := prometheus.NewRegistry()
+	assert.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	bounds := map[string][]float64{}
+	for _, family := range families {
+		for _, b := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			bounds[family.GetName()] = append(bounds[family.GetName()], b.GetUpperBound())
+		}
+	}
+	assert.Equal(t, []float64{0.01, 0.1}, bounds["prombq_batch_write_duration_seconds"])
+	assert.Equal(t, []float64{1, 60, 600}, bounds["prombq_sql_query_duration_seconds"])
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrQueueFull is returned when an insert cannot be queued because all workers are busy
+// and the submission queue is full. It matches ErrUnavailable.
+var ErrQueueFull = unavailable(errors.New("bigquery insert queue is full"))
+
+// insertPool runs inserts on a fixed number of workers fed by a bounded queue.
+type insertPool struct {
+	jobs          chan func()
+	activeWorkers prometheus.Gauge
+}
+
+// newInsertPool starts the given number of workers. Jobs submitted while all
+// workers are busy wait in a queue of queueSize entries.
+func newInsertPool(workers, queueSize int, activeWorkers prometheus.Gauge) *insertPool {
+	p := &insertPool{
+		jobs:          make(chan func(), queueSize),
+		activeWorkers: activeWorkers,
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *insertPool) work() {
+	for job := range p.jobs {
+		p.activeWorkers.Inc()
+		job()
+		p.activeWorkers.Dec()
+	}
+}
+
+// submit queues the job without blocking. It returns ErrQueueFull if the queue has no room.
+func (p *insertPool) submit(job func()) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// queueDepth returns the number of jobs waiting for a worker.
+func (p *insertPool) queueDepth() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.jobs)
+}
@@ -0,0 +1,89 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func seriesWithSamples(name string, n int) []*prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: name}}}
+	for i := 0; i < n; i++ {
+		ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(i) * 1000, Value: float64(i)})
+	}
+	return []*prompb.TimeSeries{ts}
+}
+
+func TestInsertPoolConcurrencyCeiling(t *testing.T) {
+	ins := &fakeInserter{delay: 20 * time.Millisecond}
+	c := newTestClient(ins, WithMaxRowsPerInsert(1), WithInsertConcurrency(3, 100))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, ins.maxConc)
+	assert.Len(t, ins.rows(), 20)
+	assert.Equal(t, 0.0, metricValue(c.activeInserts))
+	assert.Equal(t, 0.0, metricValue(c.insertQueueDepth))
+}
+
+func TestInsertPoolQueueFull(t *testing.T) {
+	ins := &fakeInserter{delay: 50 * time.Millisecond}
+	c := newTestClient(ins, WithMaxRowsPerInsert(1), WithInsertConcurrency(1, 1))
+
+	// One chunk is picked up by the worker, one waits in the queue and the rest are rejected.
+	err := c.Write(context.Background(), seriesWithSamples("up", 5))
+	assert.True(t, errors.Is(err, ErrQueueFull))
+
+	var writeErr *WriteError
+	assert.True(t, errors.As(err, &writeErr))
+	assert.GreaterOrEqual(t, writeErr.FailedSamples, 3)
+	assert.Len(t, ins.rows(), 5-writeErr.FailedSamples)
+}
+
+func TestWriteWithoutPool(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowsPerInsert(2))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	assert.Len(t, ins.puts, 3)
+	assert.Equal(t, 1, ins.maxConc)
+}
+
+func TestWriteChunkFailureDoesNotAbortOthers(t *testing.T) {
+	ins := &failingInserter{fakeInserter: &fakeInserter{}, failOn: 1}
+	c := newTestClient(ins, WithMaxRowsPerInsert(2))
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 5))
+	var writeErr *WriteError
+	assert.True(t, errors.As(err, &writeErr))
+	assert.Equal(t, 2, writeErr.FailedSamples)
+	assert.Len(t, ins.rows(), 3)
+}
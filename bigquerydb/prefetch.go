@@ -0,0 +1,161 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// prefetchPages is the number of pages of rows read ahead of their conversion.
+	prefetchPages = 2
+	// prefetchPageRows is the maximum number of rows of a page handed over at once, for
+	// iterators without pages or with larger ones.
+	prefetchPageRows = 10000
+)
+
+// pagedIterator is implemented by iterators which fetch their rows in pages, like the
+// iterators of query results.
+type pagedIterator interface {
+	// pageRemaining returns the number of rows of the current page which weren't
+	// returned yet. The next row after the last one of a page is fetched with a new request.
+	pageRemaining() int
+}
+
+func (it *bigqueryRowIterator) pageRemaining() int {
+	return it.PageInfo().Remaining()
+}
+
+// rowPage is a page of rows handed from the fetcher to the consumer. The rows are reused
+// for later pages once the consumer has converted them. err is the error the fetcher
+// stopped with after the rows, iterator.Done at the end of the results.
+type rowPage struct {
+	rows []map[string]bigquery.Value
+	n    int
+	err  error
+}
+
+// prefetchIterator reads the rows of a query result in a goroutine, up to prefetchPages
+// pages ahead of their conversion, so that the next page of results is fetched from
+// BigQuery while the rows of the current one are converted instead of after them. The
+// rows are returned in their original order, followed by the error the fetcher stopped
+// with. stop has to be called once the rows aren't needed anymore, before the wrapped
+// iterator is used again.
+type prefetchIterator struct {
+	pages   chan *rowPage
+	free    chan *rowPage
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	page    *rowPage
+	pos     int
+	waited  prometheus.Counter
+}
+
+// newPrefetchIterator starts fetching the rows of iter. Pages handed over are counted in
+// fetched, the time spent waiting for them in waited.
+func newPrefetchIterator(iter rowIterator, fetched, waited prometheus.Counter) *prefetchIterator {
+	it := &prefetchIterator{
+		pages:   make(chan *rowPage, prefetchPages),
+		free:    make(chan *rowPage, prefetchPages+1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		waited:  waited,
+	}
+	go it.fetch(iter, fetched)
+	return it
+}
+
+// fetch reads pages of rows from iter until it fails or ends, or the consumer stopped.
+func (it *prefetchIterator) fetch(iter rowIterator, fetched prometheus.Counter) {
+	defer close(it.stopped)
+	paged, _ := iter.(pagedIterator)
+	for {
+		var page *rowPage
+		select {
+		case page = <-it.free:
+			page.n = 0
+		default:
+			page = &rowPage{}
+		}
+		for page.err == nil && page.n < prefetchPageRows {
+			if page.n == len(page.rows) {
+				page.rows = append(page.rows, make(map[string]bigquery.Value, 4))
+			}
+			if page.err = iter.Next(&page.rows[page.n]); page.err != nil {
+				break
+			}
+			page.n++
+			if paged != nil && paged.pageRemaining() == 0 {
+				break
+			}
+		}
+		if page.n > 0 {
+			fetched.Inc()
+		}
+		// The page belongs to the consumer once it is handed over.
+		err := page.err
+		select {
+		case it.pages <- page:
+		case <-it.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Next sets dst, which has to be a *map[string]bigquery.Value, to the next row. Instead
+// of copying the row, dst is pointed to the map of the page, which is only valid until
+// the next call.
+func (it *prefetchIterator) Next(dst interface{}) error {
+	for it.page == nil || it.pos >= it.page.n {
+		if it.page != nil {
+			if it.page.err != nil {
+				return it.page.err
+			}
+			it.recycle(it.page)
+		}
+		begin := time.Now()
+		it.page = <-it.pages
+		it.waited.Add(time.Since(begin).Seconds())
+		it.pos = 0
+	}
+	*dst.(*map[string]bigquery.Value) = it.page.rows[it.pos]
+	it.pos++
+	return nil
+}
+
+// recycle hands a converted page back to the fetcher, unless enough pages are waiting.
+func (it *prefetchIterator) recycle(page *rowPage) {
+	page.err = nil
+	select {
+	case it.free <- page:
+	default:
+	}
+}
+
+// stop stops the fetcher and waits until it doesn't use the wrapped iterator anymore,
+// which may take until the page it is fetching has arrived.
+func (it *prefetchIterator) stop() {
+	it.once.Do(func() {
+		close(it.done)
+	})
+	<-it.stopped
+}
@@ -0,0 +1,196 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+)
+
+// fakePagingIterator returns the rows of a synthetic result in pages, and waits for latency
+// before the first row of every page like an iterator requesting the page from BigQuery.
+// The number of every page is sent to fetching, if set, before it is requested.
+type fakePagingIterator struct {
+	*syntheticRowIterator
+	pageSize  int
+	latency   time.Duration
+	remaining int
+	fetched   int
+	fetching  chan int
+	err       error
+}
+
+func newFakePagingIterator(rows, pageSize int, latency time.Duration) *fakePagingIterator {
+	return &fakePagingIterator{syntheticRowIterator: newSyntheticRowIterator(rows, 10), pageSize: pageSize, latency: latency}
+}
+
+func (f *fakePagingIterator) Next(dst interface{}) error {
+	if f.remaining == 0 && f.pos < f.n {
+		if f.err != nil && f.fetched > 0 {
+			return f.err
+		}
+		f.fetched++
+		if f.fetching != nil {
+			f.fetching <- f.fetched
+		}
+		time.Sleep(f.latency)
+		f.remaining = min(f.pageSize, f.n-f.pos)
+	}
+	if err := f.syntheticRowIterator.Next(dst); err != nil {
+		return err
+	}
+	f.remaining--
+	return nil
+}
+
+func (f *fakePagingIterator) pageRemaining() int {
+	return f.remaining
+}
+
+// newTestPrefetchIterator prefetches the rows of iter and returns the counters of the
+// fetched pages and of the time waited for them.
+func newTestPrefetchIterator(iter rowIterator) (*prefetchIterator, prometheus.Counter, prometheus.Counter) {
+	fetched := prometheus.NewCounter(prometheus.CounterOpts{Name: "pages"})
+	waited := prometheus.NewCounter(prometheus.CounterOpts{Name: "wait"})
+	return newPrefetchIterator(iter, fetched, waited), fetched, waited
+}
+
+func TestPrefetchIteratorOrder(t *testing.T) {
+	for name, tc := range map[string]struct {
+		iter  rowIterator
+		pages float64
+	}{
+		"paged":   {iter: newFakePagingIterator(2500, 1000, 0), pages: 3},
+		"unpaged": {iter: newSyntheticRowIterator(2*prefetchPageRows+1, 10), pages: 3},
+		"empty":   {iter: newSyntheticRowIterator(0, 10), pages: 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			it, fetched, waited := newTestPrefetchIterator(tc.iter)
+			defer it.stop()
+
+			var row map[string]bigquery.Value
+			var values []float64
+			for {
+				err := it.Next(&row)
+				if err == iterator.Done {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				values = append(values, row["value"].(float64))
+			}
+			for i, v := range values {
+				if !assert.Equal(t, float64(i), v, "rows are returned in order") {
+					break
+				}
+			}
+			assert.Equal(t, iterator.Done, it.Next(&row), "the end is returned again")
+			assert.Equal(t, tc.pages, metricValue(fetched))
+			assert.Positive(t, metricValue(waited))
+		})
+	}
+}
+
+func TestPrefetchIteratorError(t *testing.T) {
+	iter := newFakePagingIterator(5000, 1000, 0)
+	iter.err = errors.New("connection reset")
+	it, _, _ := newTestPrefetchIterator(iter)
+	defer it.stop()
+
+	rows := 0
+	var row map[string]bigquery.Value
+	var err error
+	for err = it.Next(&row); err == nil; err = it.Next(&row) {
+		rows++
+	}
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, 1000, rows, "the rows before the error are returned")
+}
+
+func TestPrefetchIteratorOverlap(t *testing.T) {
+	iter := newFakePagingIterator(3000, 1000, 0)
+	iter.fetching = make(chan int, 3)
+	it, _, _ := newTestPrefetchIterator(iter)
+	defer it.stop()
+
+	var row map[string]bigquery.Value
+	assert.NoError(t, it.Next(&row))
+	assert.Equal(t, 1, <-iter.fetching)
+	// The second page is requested while the consumer still holds the first one.
+	select {
+	case page := <-iter.fetching:
+		assert.Equal(t, 2, page)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second page wasn't fetched ahead")
+	}
+}
+
+func TestPrefetchIteratorStop(t *testing.T) {
+	// The fetcher is blocked on the full channel of pages.
+	iter := newFakePagingIterator(100*prefetchPageRows, 100, 0)
+	it, _, _ := newTestPrefetchIterator(iter)
+	var row map[string]bigquery.Value
+	assert.NoError(t, it.Next(&row))
+	it.stop()
+	it.stop()
+	assert.Less(t, iter.pos, iter.n, "the fetcher stopped before the end")
+
+	// The fetcher is waiting for a page.
+	iter = newFakePagingIterator(1000, 100, 50*time.Millisecond)
+	it, _, _ = newTestPrefetchIterator(iter)
+	it.stop()
+	assert.LessOrEqual(t, iter.fetched, prefetchPages+2)
+}
+
+func TestPrefetchMergeResult(t *testing.T) {
+	it, _, _ := newTestPrefetchIterator(newFakePagingIterator(11, 3, 0))
+	defer it.stop()
+	rs := newResultSet(10)
+	assert.ErrorContains(t, mergeResult(rs, it), "limit of 10 samples")
+}
+
+// BenchmarkMergeResultPaged merges 100000 rows fetched in pages of 10000 rows with a
+// latency of 5ms per page, directly from the iterator and fetched ahead of the conversion.
+func BenchmarkMergeResultPaged(b *testing.B) {
+	fetched := prometheus.NewCounter(prometheus.CounterOpts{Name: "pages"})
+	waited := prometheus.NewCounter(prometheus.CounterOpts{Name: "wait"})
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := mergeResult(newResultSet(0), newFakePagingIterator(100000, 10000, 5*time.Millisecond)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("prefetch", func(b *testing.B) {
+		before := metricValue(waited)
+		for i := 0; i < b.N; i++ {
+			it := newPrefetchIterator(newFakePagingIterator(100000, 10000, 5*time.Millisecond), fetched, waited)
+			err := mergeResult(newResultSet(0), it)
+			it.stop()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric((metricValue(waited)-before)*1000/float64(b.N), "wait-ms/op")
+	})
+}
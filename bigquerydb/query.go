@@ -0,0 +1,213 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// readQuery holds the parts of the SQL of a read query, which the read template puts
+// together. The fields are exported for the template.
+type readQuery struct {
+	// Columns are the selected columns.
+	Columns string
+	// Table is the table or subquery the rows are selected from.
+	Table string
+	// Matchers are the conditions of the label matchers, which are combined with AND.
+	Matchers []string
+	// Start and End are the SQL of the bounds of the time range, which are comparable
+	// with the timestamp column.
+	Start string
+	End   string
+	// Qualify filters the rows after window functions, if set.
+	Qualify string
+	// OrderBy are the columns the rows are sorted by, if set.
+	OrderBy string
+	// TagsColumn is the column holding the labels, tags or labels.
+	TagsColumn string
+}
+
+// sql renders the SQL of the query with the template.
+func (r *readQuery) sql(tmpl *template.Template) (string, error) {
+	var sql strings.Builder
+	if err := tmpl.Execute(&sql, r); err != nil {
+		return "", errors.Wrap(err, "failed to render the read query template")
+	}
+	return strings.TrimSpace(sql.String()), nil
+}
+
+// WithReadDeduplication makes read queries return a single row for every series and
+// timestamp, so that rows written twice, e.g. by retried inserts or by several Prometheus
+// replicas, aren't returned as repeated samples. Of rows with different values the one
+// with the lowest value is returned, rows with a NULL value only if there is no other.
+func WithReadDeduplication(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.readDeduplicate = enabled
+	}
+}
+
+// buildCommand generates the SQL for the query. Matcher values and the time range
+// are passed as query parameters, only the structure of the query is part of the SQL.
+// The rows are only sorted by timestamp with server-side sorting. Matchers which can't
+// be translated fail with an error matching ErrBadRequest.
+func (c *BigqueryClient) buildCommand(q *prompb.Query) (string, []bigquery.QueryParameter, error) {
+	if !c.serverSideSort {
+		return c.buildOrderedCommand(q, "")
+	}
+	return c.buildOrderedCommand(q, "timestamp")
+}
+
+// buildOrderedCommand generates the SQL for the query like buildCommand, with the rows
+// sorted by the given columns, if any.
+func (c *BigqueryClient) buildOrderedCommand(q *prompb.Query, orderBy string) (string, []bigquery.QueryParameter, error) {
+	return c.buildSelectCommand(q, c.selectColumnsSQL(), c.deduplicateSQL(), orderBy)
+}
+
+// buildSelectCommand generates the SQL selecting the columns of the rows matching the
+// query, with the QUALIFY condition and the sort order, if any.
+func (c *BigqueryClient) buildSelectCommand(q *prompb.Query, columns, qualify, orderBy string) (string, []bigquery.QueryParameter, error) {
+	conditions, params, err := c.queryConditions(q)
+	if err != nil {
+		return "", nil, err
+	}
+	if tableConditions := c.tableConditions(); len(tableConditions) > 0 {
+		// With routes every table of the union applies them.
+		if len(c.destinations) <= 1 {
+			conditions = append(conditions, tableConditions...)
+		}
+		params = append(params, c.tableConditionParams(q.StartTimestampMs, q.EndTimestampMs)...)
+	}
+	query, err := (&readQuery{
+		Columns:    columns,
+		Table:      c.tableSQL(),
+		Matchers:   conditions,
+		Start:      c.timestampParamSQL("start"),
+		End:        c.timestampParamSQL("end"),
+		Qualify:    qualify,
+		OrderBy:    orderBy,
+		TagsColumn: c.tagsColumn(),
+	}).sql(c.readTemplate)
+	if err != nil {
+		return "", nil, err
+	}
+	c.logger.Debug("bigquery read", slog.Any("sql query", query), slog.Any("parameters", params))
+
+	return query, params, nil
+}
+
+// queryConditions returns the conditions of the matchers of the query and their
+// parameters, which include the bounds of the time range.
+func (c *BigqueryClient) queryConditions(q *prompb.Query) ([]string, []bigquery.QueryParameter, error) {
+	return c.matcherConditions(q, c.tagsType == TagsTypeLabels)
+}
+
+// matcherConditions returns the conditions of the matchers of the query like
+// queryConditions, on the labels column if labels is set and on the tags column otherwise.
+func (c *BigqueryClient) matcherConditions(q *prompb.Query, labels bool) ([]string, []bigquery.QueryParameter, error) {
+	conditions := make([]string, 0, len(q.Matchers)+2)
+	params := make([]bigquery.QueryParameter, 0, len(q.Matchers)+2)
+	for i, m := range orderMatchers(q.Matchers) {
+		param, nameParam := fmt.Sprintf("m%d", i), ""
+		var condition string
+		var value interface{}
+		var err error
+		if labels && m.Name != model.MetricNameLabel {
+			nameParam = fmt.Sprintf("n%d", i)
+			condition, value, err = labelsMatcherSQL(m, nameParam, param)
+		} else {
+			condition, value, err = matcherSQL(m, param)
+		}
+		if err != nil {
+			return nil, nil, badRequest(err)
+		}
+		switch condition {
+		case matchAllSQL:
+			continue
+		case matchNothingSQL:
+			conditions = append(conditions, condition)
+			continue
+		}
+		conditions = append(conditions, condition)
+		if nameParam != "" {
+			params = append(params, bigquery.QueryParameter{Name: nameParam, Value: m.Name})
+		}
+		params = append(params, bigquery.QueryParameter{Name: param, Value: value})
+	}
+	params = append(params,
+		bigquery.QueryParameter{Name: "start", Value: q.StartTimestampMs},
+		bigquery.QueryParameter{Name: "end", Value: q.EndTimestampMs},
+	)
+	return conditions, params, nil
+}
+
+// selectColumnsSQL returns the columns read queries select.
+func (c *BigqueryClient) selectColumnsSQL() string {
+	return fmt.Sprintf("metricname, %s, %s, %s", c.tagsColumnSQL(), c.timestampColumnSQL(), c.sampleColumnsSQL())
+}
+
+// sampleColumnsSQL returns the columns read queries select besides the metric name, the
+// labels and the timestamp.
+func (c *BigqueryClient) sampleColumnsSQL() string {
+	columns := "value"
+	if c.specialValues {
+		columns += ", " + specialValueColumn
+	}
+	if c.seriesHash {
+		columns += ", " + seriesHashColumn
+	}
+	return columns
+}
+
+// deduplicateSQL returns the QUALIFY condition keeping a single row for every series and
+// timestamp with read deduplication, and an empty string without. The columns are those
+// of the table, as the JSON and the labels column can't be partitioned by.
+func (c *BigqueryClient) deduplicateSQL() string {
+	if !c.readDeduplicate {
+		return ""
+	}
+	tags := "tags"
+	switch c.tagsType {
+	case TagsTypeJSON:
+		tags = "TO_JSON_STRING(tags)"
+	case TagsTypeLabels:
+		tags = "TO_JSON_STRING(labels)"
+	}
+	return fmt.Sprintf("ROW_NUMBER() OVER (PARTITION BY metricname, %s, timestamp ORDER BY value NULLS LAST) = 1", tags)
+}
+
+// orderMatchers returns the matchers with the ones for an exact metric name first. The
+// table is clustered on metricname, and comparing the plain column with a constant at the
+// start of the conditions lets BigQuery skip the blocks of all other metrics.
+func orderMatchers(matchers []*prompb.LabelMatcher) []*prompb.LabelMatcher {
+	ordered := make([]*prompb.LabelMatcher, 0, len(matchers))
+	for _, m := range matchers {
+		if m.Name == model.MetricNameLabel && m.Type == prompb.LabelMatcher_EQ {
+			ordered = append(ordered, m)
+		}
+	}
+	for _, m := range matchers {
+		if m.Name != model.MetricNameLabel || m.Type != prompb.LabelMatcher_EQ {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,806 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestBuildCommand(t *testing.T) {
+	q := &prompb.Query{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_NEQ, Name: "job", Value: "it's"},
+			{Type: prompb.LabelMatcher_RE, Name: "path", Value: `C:\\temp\\.*`},
+			{Type: prompb.LabelMatcher_NRE, Name: "__name__", Value: "a'\nb+"},
+		},
+	}
+
+	// Label values are read with JSON_VALUE from both column types, only the
+	// selected tags differ.
+	for tagsType, tags := range map[string]string{
+		TagsTypeString: "tags",
+		TagsTypeJSON:   "TO_JSON_STRING(tags) AS tags",
+	} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithTagsType(tagsType))
+			command, params, err := c.buildCommand(q)
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT metricname, "+tags+", UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table` WHERE "+
+				"metricname = @m0 AND "+
+				`IFNULL(JSON_VALUE(tags, '$."job"'), '') != @m1 AND `+
+				`REGEXP_CONTAINS(IFNULL(JSON_VALUE(tags, '$."path"'), ''), @m2) AND `+
+				"not REGEXP_CONTAINS(metricname, @m3) AND "+
+				"timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) ORDER BY timestamp", command)
+			assert.Equal(t, []bigquery.QueryParameter{
+				{Name: "m0", Value: "up"},
+				{Name: "m1", Value: "it's"},
+				{Name: "m2", Value: `^(?s:C:\\temp\\.*)$`},
+				{Name: "m3", Value: "^(?s:a'\nb+)$"},
+				{Name: "start", Value: int64(1000)},
+				{Name: "end", Value: int64(2000)},
+			}, params)
+			for _, v := range []string{"it's", `\`, "\n"} {
+				assert.NotContains(t, command, v, "matcher values must not be part of the SQL")
+			}
+		})
+	}
+}
+
+// TestBuildCommandMetricNameFirst checks that exact metric name matchers come first and
+// compare the plain column, so BigQuery can prune the blocks of a table clustered on it.
+func TestBuildCommandMetricNameFirst(t *testing.T) {
+	for _, tagsType := range []string{TagsTypeString, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithTagsType(tagsType))
+			command, params, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{
+				{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"},
+				{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "up|down"},
+				{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			}})
+			assert.NoError(t, err)
+			assert.Contains(t, command, " WHERE metricname = @m0 AND ")
+			assert.Less(t, strings.Index(command, "metricname IN UNNEST(@m2)"), strings.Index(command, "timestamp >="))
+			assert.Equal(t, bigquery.QueryParameter{Name: "m0", Value: "up"}, params[0])
+		})
+	}
+}
+
+func TestBuildCommandDataProject(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithDataProject("analytics"))
+	command, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}})
+	assert.NoError(t, err)
+	assert.Contains(t, command, " FROM `analytics.dataset.table` WHERE ")
+}
+
+func TestBuildCommandQuotedTable(t *testing.T) {
+	c := newClient(promslog.NewNopLogger(), "metrics-prod", "select", time.Minute)
+	command, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}})
+	assert.NoError(t, err)
+	assert.Contains(t, command, " FROM `metrics-prod.select` WHERE ")
+}
+
+func TestReadQuerySQL(t *testing.T) {
+	r := &readQuery{Columns: "metricname, tags", Table: "`dataset.table`", Matchers: []string{"metricname = @m0"}, Start: "TIMESTAMP_MILLIS(@start)", End: "TIMESTAMP_MILLIS(@end)"}
+	sql, err := r.sql(defaultReadTemplate)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT metricname, tags FROM `dataset.table` WHERE metricname = @m0 AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end)", sql)
+	r.OrderBy = "timestamp"
+	sql, err = r.sql(defaultReadTemplate)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT metricname, tags FROM `dataset.table` WHERE metricname = @m0 AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) ORDER BY timestamp", sql)
+	r.Qualify = "ROW_NUMBER() OVER (PARTITION BY metricname) = 1"
+	r.Matchers = nil
+	sql, err = r.sql(defaultReadTemplate)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT metricname, tags FROM `dataset.table` WHERE timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) "+
+		"QUALIFY ROW_NUMBER() OVER (PARTITION BY metricname) = 1 ORDER BY timestamp", sql)
+}
+
+// TestBuildCommandDeduplication checks the SQL of deduplicated reads for every type of
+// the tags column, with and without sorting and routes.
+func TestBuildCommandDeduplication(t *testing.T) {
+	q := &prompb.Query{StartTimestampMs: 1000, EndTimestampMs: 2000, Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}}
+	where := " WHERE metricname = @m0 AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end)"
+	qualify := " QUALIFY ROW_NUMBER() OVER (PARTITION BY metricname, %s, timestamp ORDER BY value NULLS LAST) = 1"
+
+	testCases := map[string]struct {
+		opts     []Option
+		expected string
+	}{
+		"disabled": {
+			opts:     []Option{WithReadDeduplication(false)},
+			expected: "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table`" + where + " ORDER BY timestamp",
+		},
+		"string": {
+			opts:     []Option{WithReadDeduplication(true)},
+			expected: "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table`" + where + fmt.Sprintf(qualify, "tags") + " ORDER BY timestamp",
+		},
+		"json": {
+			opts: []Option{WithReadDeduplication(true), WithTagsType(TagsTypeJSON)},
+			expected: "SELECT metricname, TO_JSON_STRING(tags) AS tags, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table`" + where +
+				fmt.Sprintf(qualify, "TO_JSON_STRING(tags)") + " ORDER BY timestamp",
+		},
+		"labels": {
+			opts: []Option{WithReadDeduplication(true), WithTagsType(TagsTypeLabels)},
+			expected: "SELECT metricname, labels, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table`" + where +
+				fmt.Sprintf(qualify, "TO_JSON_STRING(labels)") + " ORDER BY timestamp",
+		},
+		"unsorted": {
+			opts:     []Option{WithReadDeduplication(true), WithServerSideSort(false)},
+			expected: "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table`" + where + fmt.Sprintf(qualify, "tags"),
+		},
+		"routes": {
+			opts: []Option{WithReadDeduplication(true), WithRoutes([]Route{{Metric: regexp.MustCompile(`^up$`), TableID: "up"}})},
+			expected: "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM " +
+				"(SELECT metricname, tags, timestamp, value FROM `dataset.table` UNION ALL SELECT metricname, tags, timestamp, value FROM `dataset.up`)" +
+				where + fmt.Sprintf(qualify, "tags") + " ORDER BY timestamp",
+		},
+		"extra_columns": {
+			opts: []Option{WithReadDeduplication(true), WithSpecialValueColumn(true), WithSeriesHashColumn(true)},
+			expected: "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value, special_value, series_hash FROM `dataset.table`" + where +
+				fmt.Sprintf(qualify, "tags") + " ORDER BY timestamp",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, tc.opts...)
+			command, _, err := c.buildCommand(q)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, command)
+		})
+	}
+
+	c := newTestClient(&fakeInserter{}, WithReadDeduplication(true))
+	command, _, err := c.buildOrderedCommand(q, "metricname, tags, timestamp")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(command, fmt.Sprintf(qualify, "tags")+" ORDER BY metricname, tags, timestamp"), "exports are deduplicated before sorting")
+}
+
+// TestReadDeduplicationFakeBigQuery writes the same samples twice, like retried inserts,
+// and with a different value, like a second Prometheus replica, and checks that every
+// timestamp is only returned once by deduplicated reads.
+func TestReadDeduplicationFakeBigQuery(t *testing.T) {
+	now := time.Now().Unix() * 1000
+	labels := []*prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}}
+	writes := [][]prompb.Sample{
+		{{Timestamp: now, Value: 10}, {Timestamp: now + 1000, Value: 20}},
+		{{Timestamp: now, Value: 10}, {Timestamp: now + 1000, Value: 20}},
+		{{Timestamp: now + 1000, Value: 21}},
+	}
+	read := func(c *BigqueryClient) []prompb.Sample {
+		result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+			StartTimestampMs: now,
+			EndTimestampMs:   now + 10000,
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "requests_total"}},
+		}}})
+		assert.NoError(t, err)
+		if !assert.Len(t, result.Results[0].Timeseries, 1) {
+			return nil
+		}
+		return result.Results[0].Timeseries[0].Samples
+	}
+
+	for _, tagsType := range []string{TagsTypeString, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			fake := &fakeBigQuery{}
+			for _, samples := range writes {
+				c := newTestClient(fake, WithQuerier(fake), WithTagsType(tagsType))
+				assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{Labels: labels, Samples: samples}}))
+			}
+			assert.Len(t, fake.rows, 5)
+
+			c := newTestClient(fake, WithQuerier(fake), WithTagsType(tagsType))
+			assert.Len(t, read(c), 3, "only samples with the same value are merged without deduplication")
+
+			c = newTestClient(fake, WithQuerier(fake), WithTagsType(tagsType), WithReadDeduplication(true))
+			assert.Equal(t, []prompb.Sample{{Timestamp: now, Value: 10}, {Timestamp: now + 1000, Value: 20}}, read(c))
+		})
+	}
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	assert.NoError(t, ValidateIdentifier("metrics-prod"))
+	assert.NoError(t, ValidateIdentifier("select"))
+	assert.ErrorContains(t, ValidateIdentifier("metrics`; DROP TABLE x; --"), "must not contain a backtick")
+	assert.ErrorContains(t, ValidateIdentifier("metrics\nprod"), "must not contain control characters")
+	assert.Error(t, ValidateIdentifier(""))
+}
+
+func TestBuildCommandClientSideSort(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithServerSideSort(false))
+	command, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(command, "WHERE metricname = @m0 AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end)"), command)
+}
+
+// TestReadClientSideSort reads rows in the order BigQuery returns them with and without
+// server-side sorting, and expects the same response.
+func TestReadClientSideSort(t *testing.T) {
+	sorted := []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"api"}`, 2000, 0),
+		testRow("up", `{"job":"api"}`, 2000, 1),
+		testRow("up", `{"job":"api"}`, 3000, 1),
+	}
+	unsorted := []map[string]bigquery.Value{sorted[3], sorted[2], sorted[0], sorted[1]}
+	req := &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   3000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}}
+
+	serverSide := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: sorted}))
+	expected, err := serverSide.Read(context.Background(), req)
+	assert.NoError(t, err)
+	clientSide := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: unsorted}), WithServerSideSort(false))
+	resp, err := clientSide.Read(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, resp)
+}
+
+func TestBuildCommandErrors(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	testCases := map[string]*prompb.LabelMatcher{
+		"invalid_label_name":      {Type: prompb.LabelMatcher_EQ, Name: "job') OR ('1", Value: "x"},
+		"unknown_type":            {Type: prompb.LabelMatcher_Type(42), Name: "job", Value: "x"},
+		"unknown_metricname_type": {Type: prompb.LabelMatcher_Type(42), Name: "__name__", Value: "x"},
+	}
+
+	for name, m := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{m}})
+			assert.ErrorIs(t, err, ErrBadRequest)
+		})
+	}
+}
+
+// TestAnchorRegex evaluates the anchored patterns with RE2, which BigQuery uses as well,
+// and compares the result with the outcome of the matcher in Prometheus.
+func TestAnchorRegex(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		value   string
+		matches bool
+	}{
+		{pattern: "", value: "", matches: true},
+		{pattern: "", value: "api", matches: false},
+		{pattern: ".*", value: "", matches: true},
+		{pattern: ".*", value: "anything", matches: true},
+		{pattern: ".+", value: "", matches: false},
+		{pattern: "api", value: "api", matches: true},
+		{pattern: "api", value: "my-api-gateway", matches: false},
+		{pattern: "fi.*", value: "first", matches: true},
+		{pattern: "fi.*", value: "wifi", matches: false},
+		{pattern: "api|web", value: "web", matches: true},
+		{pattern: "api|web", value: "api-web", matches: false},
+		{pattern: "a|", value: "", matches: true},
+		{pattern: "^api$", value: "api", matches: true},
+		{pattern: "^api", value: "api-gateway", matches: false},
+		{pattern: "api$", value: "my-api", matches: false},
+		{pattern: "(?i)API", value: "api", matches: true},
+		{pattern: "a\nb", value: "a\nb", matches: true},
+	}
+
+	for _, testCase := range testCases {
+		re := regexp.MustCompile(anchorRegex(testCase.pattern))
+		assert.Equal(t, testCase.matches, re.MatchString(testCase.value), "pattern %q on value %q", testCase.pattern, testCase.value)
+	}
+}
+
+// TestMatcherSQLAbsentLabels evaluates the conditions generated for label matchers
+// against rows where the label is present, empty or absent, for the tags and for the
+// labels column, and compares the result with the outcome of the matcher in Prometheus,
+// where an absent label is the same as an empty one.
+func TestMatcherSQLAbsentLabels(t *testing.T) {
+	present := map[string]string{"foo": "bar"}
+	empty := map[string]string{"foo": ""}
+	absent := map[string]string{}
+
+	testCases := []struct {
+		matcher  prompb.LabelMatcher
+		expected [3]bool // present, empty, absent
+	}{
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "foo", Value: "bar"}, [3]bool{true, false, false}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "foo", Value: ""}, [3]bool{false, true, true}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: "foo", Value: "bar"}, [3]bool{false, true, true}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: "foo", Value: ""}, [3]bool{true, false, false}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "foo", Value: ".+"}, [3]bool{true, false, false}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "foo", Value: ".*"}, [3]bool{true, true, true}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "foo", Value: "bar|"}, [3]bool{true, true, true}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "foo", Value: "b.*"}, [3]bool{true, false, false}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "foo", Value: ".+"}, [3]bool{false, true, true}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "foo", Value: ".*"}, [3]bool{false, false, false}},
+		{prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "foo", Value: "b.*"}, [3]bool{false, true, true}},
+	}
+
+	for _, testCase := range testCases {
+		m := testCase.matcher
+		condition, value, err := matcherSQL(&m, "p")
+		assert.NoError(t, err)
+		column, err := labelValueSQL("foo")
+		assert.NoError(t, err)
+		if condition != matchAllSQL && condition != matchNothingSQL {
+			assert.Contains(t, condition, column)
+		}
+		labelsCondition, labelsValue, err := labelsMatcherSQL(&m, "n", "p")
+		assert.NoError(t, err)
+
+		for i, tags := range []map[string]string{present, empty, absent} {
+			assert.Equal(t, testCase.expected[i], evalCondition(t, condition, value, tags),
+				"%s on %v", formatMatchers([]*prompb.LabelMatcher{&m}), tags)
+			assert.Equal(t, testCase.expected[i], evalLabelsCondition(t, labelsCondition, labelsValue, tags),
+				"%s on labels %v", formatMatchers([]*prompb.LabelMatcher{&m}), tags)
+		}
+	}
+}
+
+// evalCondition evaluates a condition generated by matcherSQL for the label foo,
+// applying IFNULL to a missing label like BigQuery does.
+func evalCondition(t *testing.T, condition string, value interface{}, tags map[string]string) bool {
+	column, _ := labelValueSQL("foo")
+	return evalComparison(t, column, condition, value, tags["foo"])
+}
+
+// evalLabelsCondition evaluates a condition generated by labelsMatcherSQL for the label
+// foo, whose name is passed as @n, on a labels column holding the tags.
+func evalLabelsCondition(t *testing.T, condition string, value interface{}, tags map[string]string) bool {
+	switch condition {
+	case matchAllSQL:
+		return true
+	case matchNothingSQL:
+		return false
+	}
+	negated := strings.HasPrefix(condition, "NOT ")
+	comparison := strings.TrimPrefix(condition, "NOT ")
+	comparison = strings.TrimPrefix(comparison, "EXISTS(SELECT 1 FROM UNNEST(labels) l WHERE l.name = @n AND ")
+	comparison = strings.TrimSuffix(comparison, ")")
+	if negated {
+		comparison = strings.TrimSuffix(strings.TrimPrefix(comparison, "NOT ("), ")")
+	}
+
+	exists := false
+	for name, label := range tags {
+		if name == "foo" && evalComparison(t, "l.value", comparison, value, label) != negated {
+			exists = true
+		}
+	}
+	return exists != negated
+}
+
+// evalComparison evaluates a condition generated by compareSQL for the column and the
+// parameter @p on the value of the label.
+func evalComparison(t *testing.T, column, condition string, value interface{}, label string) bool {
+	switch condition {
+	case matchAllSQL:
+		return true
+	case matchNothingSQL:
+		return false
+	case column + " = @p":
+		return label == value.(string)
+	case column + " != @p":
+		return label != value.(string)
+	case column + " IN UNNEST(@p)":
+		return slices.Contains(value.([]string), label)
+	case column + " NOT IN UNNEST(@p)":
+		return !slices.Contains(value.([]string), label)
+	case "REGEXP_CONTAINS(" + column + ", @p)":
+		return regexp.MustCompile(value.(string)).MatchString(label)
+	case "not REGEXP_CONTAINS(" + column + ", @p)":
+		return !regexp.MustCompile(value.(string)).MatchString(label)
+	}
+	t.Fatalf("unexpected condition %q", condition)
+	return false
+}
+
+// TestRegexSpecialCharacters builds queries for patterns with characters which broke
+// the former string interpolation, and filters rows with the resulting parameter
+// like BigQuery does to check that the right series are returned.
+func TestRegexSpecialCharacters(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	paths := []string{`it's`, `C:\temp`, `/var/log`, `/var/log/app`, `Grüße`, `日本`, `other`}
+
+	testCases := map[string]struct {
+		pattern  string
+		expected []string
+	}{
+		"single_quote":   {pattern: `it's`, expected: []string{`it's`}},
+		"backslash":      {pattern: `C:\\temp`, expected: []string{`C:\temp`}},
+		"slash":          {pattern: `/var/log`, expected: []string{`/var/log`}},
+		"slash_prefix":   {pattern: `/var/.*`, expected: []string{`/var/log`, `/var/log/app`}},
+		"unicode":        {pattern: `Grü.e|日本`, expected: []string{`Grüße`, `日本`}},
+		"quote_in_class": {pattern: `it['"]s`, expected: []string{`it's`}},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "path", Value: testCase.pattern}
+			command, params, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{m}})
+			assert.NoError(t, err)
+			condition, value, err := matcherSQL(m, "p")
+			assert.NoError(t, err)
+			assert.Contains(t, command, strings.Replace(condition, "@p", "@m0", 1))
+			assert.Equal(t, value, params[0].Value)
+			column, _ := labelValueSQL("path")
+
+			iter := &fakeRowIterator{}
+			for i, path := range paths {
+				if evalComparison(t, column, condition, value, path) {
+					iter.rows = append(iter.rows, testRow("files", fmt.Sprintf(`{"path":%q}`, path), int64(i), 1))
+				}
+			}
+			rs := newResultSet(0)
+			assert.NoError(t, mergeResult(rs, iter))
+
+			var got []string
+			for _, ts := range rs.response().Results[0].Timeseries {
+				for _, l := range ts.Labels {
+					if l.Name == "path" {
+						got = append(got, l.Value)
+					}
+				}
+			}
+			assert.ElementsMatch(t, testCase.expected, got)
+		})
+	}
+}
+
+func TestUnsupportedRegex(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	for _, pattern := range []string{`(?=api)`, `api\1`, `(unclosed`} {
+		_, _, err := c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_NRE, Name: "job", Value: pattern},
+		}})
+		assert.ErrorContains(t, err, "invalid regex", pattern)
+		assert.ErrorIs(t, err, ErrBadRequest, pattern)
+	}
+}
+
+func TestLabelValueSQL(t *testing.T) {
+	testCases := map[string]struct {
+		name     string
+		expected string
+	}{
+		"identifier": {name: "job", expected: `IFNULL(JSON_VALUE(tags, '$."job"'), '')`},
+		"dotted":     {name: "host.name", expected: `IFNULL(JSON_VALUE(tags, '$."host.name"'), '')`},
+		"dashed":     {name: "label-with-dash", expected: `IFNULL(JSON_VALUE(tags, '$."label-with-dash"'), '')`},
+		"utf8":       {name: "größe 🌡", expected: `IFNULL(JSON_VALUE(tags, '$."größe 🌡"'), '')`},
+		"brackets":   {name: "a[0]$.b", expected: `IFNULL(JSON_VALUE(tags, '$."a[0]$.b"'), '')`},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			column, err := labelValueSQL(testCase.name)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, column)
+		})
+	}
+}
+
+func TestLabelValueSQLUnsupportedNames(t *testing.T) {
+	for _, name := range []string{"", `it's`, `say "hi"`, `back\slash`, "new\nline", "\xff"} {
+		_, err := labelValueSQL(name)
+		assert.Error(t, err, "label name %q", name)
+	}
+}
+
+func TestNewQuery(t *testing.T) {
+	params := []bigquery.QueryParameter{{Name: "m0", Value: "up"}}
+
+	query := newTestClient(&fakeInserter{}).newTestQuery("SELECT 1", params)
+	assert.Equal(t, "SELECT 1", query.Q)
+	assert.Equal(t, params, query.Parameters)
+	assert.Empty(t, query.Location)
+
+	query = newTestClient(&fakeInserter{}, WithLocation("europe-west3")).newTestQuery("SELECT 1", params)
+	assert.Equal(t, "europe-west3", query.Location)
+}
+
+func TestNewQueryPriority(t *testing.T) {
+	testCases := map[string]bigquery.QueryPriority{
+		"":            "",
+		"interactive": bigquery.InteractivePriority,
+		"batch":       bigquery.BatchPriority,
+	}
+
+	for priority, expected := range testCases {
+		query := newTestClient(&fakeInserter{}, WithQueryPriority(priority)).newTestQuery("SELECT 1", nil)
+		assert.Equal(t, expected, query.Priority)
+	}
+}
+
+func TestNewQueryJobLabels(t *testing.T) {
+	labels := map[string]string{"team": "observability", "adapter_version": "v0_8_0"}
+	query := newTestClient(&fakeInserter{}, WithJobLabels(labels)).newTestQuery("SELECT 1", nil)
+	assert.Equal(t, labels, query.Labels)
+}
+
+func TestReadWithQuerier(t *testing.T) {
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 2000, 1),
+		testRow("up", `{"job":"api"}`, 1000, 0),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithLocation("EU"))
+
+	resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	assert.Equal(t, []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 0}, {Timestamp: 2000, Value: 1}},
+	}}, resp.Results[0].Timeseries)
+
+	assert.Len(t, querier.queries, 1)
+	assert.Contains(t, querier.queries[0].Q, "metricname = @m0")
+	assert.Equal(t, "EU", querier.queries[0].Location)
+	assert.Equal(t, 1.0, metricValue(c.sqlQueryCount))
+}
+
+func TestReadDebug(t *testing.T) {
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+
+	resp, queries, err := c.ReadDebug(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results[0].Timeseries, 1)
+	assert.Len(t, queries, 1)
+	assert.Equal(t, querier.queries[0].Q, queries[0].SQL)
+	assert.Equal(t, map[string]interface{}{"m0": "up", "start": int64(1000), "end": int64(2000)}, queries[0].Parameters)
+	assert.Equal(t, 1, queries[0].Rows)
+
+	// Plain reads don't record statistics.
+	_, err = c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{}}})
+	assert.NoError(t, err)
+}
+
+func TestReadDebugFailedQuery(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{err: errors.New("backend unavailable")}))
+	_, queries, err := c.ReadDebug(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.ErrorContains(t, err, "backend unavailable")
+	assert.Len(t, queries, 1)
+	assert.Contains(t, queries[0].SQL, "metricname = @m0")
+}
+
+func TestReadQuerierError(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{err: errors.New("backend unavailable")}))
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.ErrorContains(t, err, "backend unavailable")
+}
+
+func TestReadTimeout(t *testing.T) {
+	c := newTestClient(&fakeInserter{delay: 100 * time.Millisecond}, WithQuerier(&fakeQuerier{delay: time.Second}), WithReadTimeout(50*time.Millisecond))
+
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.ErrorContains(t, err, "read timeout of 50ms exceeded")
+
+	// Writes are slower than the read timeout, but within the write timeout.
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}))
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	testCases := map[string]struct {
+		level     slog.Level
+		delay     time.Duration
+		logged    bool
+		loggedSQL bool
+	}{
+		"fast":       {level: slog.LevelInfo},
+		"slow":       {level: slog.LevelInfo, delay: 30 * time.Millisecond, logged: true},
+		"slow_debug": {level: slog.LevelDebug, delay: 30 * time.Millisecond, logged: true, loggedSQL: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			querier := &fakeQuerier{delay: tc.delay, rows: []map[string]bigquery.Value{
+				testRow("up", `{"job":"api"}`, 1000, 1),
+			}}
+			c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithSlowQueryThreshold(20*time.Millisecond))
+			var logs bytes.Buffer
+			c.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: tc.level}))
+
+			_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{testQuery}})
+			assert.NoError(t, err)
+
+			if !tc.logged {
+				assert.NotContains(t, logs.String(), "slow bigquery query")
+				assert.Zero(t, metricValue(c.slowQueries))
+				return
+			}
+			assert.Equal(t, 1.0, metricValue(c.slowQueries))
+			assert.Contains(t, logs.String(), `level=WARN msg="slow bigquery query"`)
+			assert.Contains(t, logs.String(), `matchers="{__name__=\"up\", job=~\"api.*\"}"`)
+			assert.Contains(t, logs.String(), "rows=1")
+			if tc.loggedSQL {
+				assert.Contains(t, logs.String(), "sql=")
+			} else {
+				assert.NotContains(t, logs.String(), "sql=")
+			}
+		})
+	}
+}
+
+func TestReadCancelled(t *testing.T) {
+	testCases := map[string]Querier{
+		"query_running": &fakeQuerier{delay: time.Minute},
+		"reading_rows":  &blockingQuerier{},
+	}
+
+	for name, querier := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			begin := time.Now()
+			_, err := c.Read(ctx, &prompb.ReadRequest{Queries: []*prompb.Query{{
+				Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			}}})
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Less(t, time.Since(begin), 5*time.Second)
+			assert.Equal(t, 1.0, metricValue(c.cancelledOperations.WithLabelValues("read")))
+			assert.Equal(t, 0.0, metricValue(c.cancelledOperations.WithLabelValues("write")))
+		})
+	}
+}
+
+func TestReadCancelsJob(t *testing.T) {
+	for _, waiting := range []bool{false, true} {
+		t.Run(fmt.Sprintf("waiting=%t", waiting), func(t *testing.T) {
+			querier := &blockingQuerier{waiting: waiting}
+			c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithReadTimeout(50*time.Millisecond))
+
+			_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+				Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			}}})
+			assert.ErrorContains(t, err, "read timeout of 50ms exceeded")
+			assert.Equal(t, 1, querier.cancelled)
+			assert.Equal(t, 1.0, metricValue(c.cancelledQueries))
+			// Timeouts aren't cancellations by the client.
+			assert.Equal(t, 0.0, metricValue(c.cancelledOperations.WithLabelValues("read")))
+		})
+	}
+}
+
+func TestReadCancelsWaitingJob(t *testing.T) {
+	querier := &blockingQuerier{waiting: true}
+	var logs bytes.Buffer
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+	c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := c.Read(ctx, &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, querier.cancelled)
+	assert.Equal(t, 1.0, metricValue(c.cancelledQueries))
+	assert.Contains(t, logs.String(), "job_id=job-waiting")
+}
+
+func TestReadCompletedJobNotCancelled(t *testing.T) {
+	querier := &blockingQuerier{finished: true}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	assert.Zero(t, querier.cancelled)
+	assert.Zero(t, metricValue(c.cancelledQueries))
+}
+
+func TestReadJobStatistics(t *testing.T) {
+	recorder := newSpanRecorder()
+	querier := &fakeQuerier{
+		rows: []map[string]bigquery.Value{testRow("up", `{"job":"api"}`, 1000, 1)},
+		stats: &bigquery.JobStatistics{
+			TotalBytesProcessed: 4096,
+			Details:             &bigquery.QueryStatistics{SlotMillis: 1500, CacheHit: true},
+		},
+	}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{testQuery}})
+		assert.NoError(t, err)
+	}
+	metrics := scrape(t, c)
+	assert.Equal(t, 8192.0, metrics["storage_bigquery_query_bytes_processed_total"])
+	assert.Equal(t, 3.0, metrics["storage_bigquery_query_slot_seconds_total"])
+	assert.Equal(t, 2.0, metrics["storage_bigquery_query_cache_hits_total"])
+	assert.Equal(t, 2.0, metrics["storage_bigquery_read_bytes_processed_count"])
+
+	spans := recorder.named("bigquery.query")
+	assert.Len(t, spans, 2)
+	assert.Equal(t, int64(4096), spans[0].attr("bigquery.total_bytes_processed").AsInt64())
+	assert.Equal(t, int64(1500), spans[0].attr("bigquery.slot_ms").AsInt64())
+	assert.True(t, spans[0].attr("bigquery.cache_hit").AsBool())
+}
+
+func TestReadJobStatisticsUnavailable(t *testing.T) {
+	querier := &fakeQuerier{
+		rows:     []map[string]bigquery.Value{testRow("up", `{"job":"api"}`, 1000, 1)},
+		statsErr: errors.New("backend unavailable"),
+	}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+
+	// The query succeeds even though its statistics can't be fetched.
+	resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{testQuery}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results[0].Timeseries, 1)
+	metrics := scrape(t, c)
+	assert.Zero(t, metrics["storage_bigquery_query_bytes_processed_total"])
+	assert.Zero(t, metrics["storage_bigquery_query_cache_hits_total"])
+}
+
+func TestReadSpans(t *testing.T) {
+	recorder := newSpanRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /read")
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"web"}`, 1000, 1),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier))
+	_, err := c.Read(ctx, &prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := recorder.named("bigquery.query")
+	assert.Len(t, spans, 1)
+	assert.Same(t, parent, spans[0].parent)
+	assert.True(t, spans[0].ended)
+	assert.Equal(t, int64(2), spans[0].attr("bigquery.rows").AsInt64())
+	assert.Equal(t, sqlHash(querier.queries[0].Q), spans[0].attr("bigquery.sql_hash").AsString())
+	assert.Len(t, spans[0].attr("bigquery.sql_hash").AsString(), 16)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrQueryQueueTimeout is matched by the errors of reads which waited too long for a
+// query slot of the QueryLimiter. It matches ErrUnavailable.
+var ErrQueryQueueTimeout = unavailable(errors.New("timed out waiting for a bigquery query slot"))
+
+// QueryQueueTimeoutError is returned by Read when a query waited for a slot longer than
+// the queue timeout of the QueryLimiter. It matches ErrQueryQueueTimeout.
+type QueryQueueTimeoutError struct {
+	// MaxQueries is the number of queries the limiter runs at once.
+	MaxQueries int
+	// RetryAfter is when to retry the read, which is the queue timeout.
+	RetryAfter time.Duration
+}
+
+func (e *QueryQueueTimeoutError) Error() string {
+	return fmt.Sprintf("%s, all %d slots stayed busy for %s", ErrQueryQueueTimeout, e.MaxQueries, e.RetryAfter)
+}
+
+// Is makes queue timeouts match ErrQueryQueueTimeout and ErrUnavailable.
+func (e *QueryQueueTimeoutError) Is(target error) bool {
+	return target == ErrQueryQueueTimeout || target == ErrUnavailable
+}
+
+// QueryLimiter limits the number of BigQuery query jobs the clients sharing it run at
+// once, so that a burst of reads, like a dashboard loading many panels, queues in the
+// adapter instead of exceeding the concurrent query quota of the project. Every query of
+// a read request takes a slot of its own while it runs and its rows are read; queries
+// answered from the read cache don't. A nil limiter doesn't limit anything.
+type QueryLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+
+	running  prometheus.Gauge
+	queued   prometheus.Gauge
+	timeouts prometheus.Counter
+}
+
+// NewQueryLimiter returns a limiter running maxQueries queries at once. Queries wait for
+// a slot up to the timeout, or as long as their read if it is 0. Its metrics are created
+// with the factory and registered with reg.
+func NewQueryLimiter(maxQueries int, timeout time.Duration, reg prometheus.Registerer, f metricfactory.Factory) *QueryLimiter {
+	return &QueryLimiter{
+		slots:   make(chan struct{}, maxQueries),
+		timeout: timeout,
+		running: metricfactory.Register(reg, f.NewGauge(prometheus.GaugeOpts{
+			Name: "read_queries_running",
+			Help: "Number of BigQuery queries of reads running within the limit of concurrent queries.",
+		})),
+		queued: metricfactory.Register(reg, f.NewGauge(prometheus.GaugeOpts{
+			Name: "read_queries_queued",
+			Help: "Number of BigQuery queries of reads waiting for a slot to run.",
+		})),
+		timeouts: metricfactory.Register(reg, f.NewCounter(prometheus.CounterOpts{
+			Name: "read_query_queue_timeouts_total",
+			Help: "Total number of reads failed because a query waited longer than the queue timeout for a slot.",
+		})),
+	}
+}
+
+// size returns the number of queries run at once, or defaultReadSplitConcurrency for a
+// nil limiter.
+func (l *QueryLimiter) size() int {
+	if l == nil {
+		return defaultReadSplitConcurrency
+	}
+	return cap(l.slots)
+}
+
+// acquire waits for a slot and returns the function releasing it. It fails with a
+// *QueryQueueTimeoutError once the timeout passed, or with the error of ctx.
+func (l *QueryLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release := func() {
+		<-l.slots
+		l.running.Dec()
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.running.Inc()
+		return release, nil
+	default:
+	}
+
+	l.queued.Inc()
+	defer l.queued.Dec()
+	var expired <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.running.Inc()
+		return release, nil
+	case <-expired:
+		l.timeouts.Inc()
+		return nil, &QueryQueueTimeoutError{MaxQueries: cap(l.slots), RetryAfter: l.timeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WithQueryLimiter runs the queries of reads within the slots of the limiter, which may
+// be shared by several clients to limit their queries together.
+func WithQueryLimiter(limiter *QueryLimiter) Option {
+	return func(c *BigqueryClient) {
+		c.queryLimiter = limiter
+	}
+}
@@ -0,0 +1,177 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedQuerier holds every query until the gate is opened, like a slow backend, and
+// records how many of them ran at once.
+type gatedQuerier struct {
+	gate chan struct{}
+
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+	queries    int
+}
+
+func newGatedQuerier() *gatedQuerier {
+	return &gatedQuerier{gate: make(chan struct{})}
+}
+
+func (f *gatedQuerier) Read(ctx context.Context, _ *bigquery.Query) (QueryIterator, error) {
+	f.mu.Lock()
+	f.running++
+	f.queries++
+	f.maxRunning = max(f.maxRunning, f.running)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+	select {
+	case <-f.gate:
+		return &fakeRowIterator{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *gatedQuerier) stats() (running, maxRunning, queries int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running, f.maxRunning, f.queries
+}
+
+// limitedReadRequest returns a read request of n queries.
+func limitedReadRequest(n int) *prompb.ReadRequest {
+	req := &prompb.ReadRequest{}
+	for i := 0; i < n; i++ {
+		req.Queries = append(req.Queries, &prompb.Query{
+			StartTimestampMs: 0,
+			EndTimestampMs:   1000,
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+		})
+	}
+	return req
+}
+
+func newTestQueryLimiter(maxQueries int, timeout time.Duration) *QueryLimiter {
+	return NewQueryLimiter(maxQueries, timeout, prometheus.NewRegistry(), metricfactory.Default())
+}
+
+func TestQueryLimiterCeiling(t *testing.T) {
+	querier := newGatedQuerier()
+	limiter := newTestQueryLimiter(2, 0)
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithQueryLimiter(limiter))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.Read(context.Background(), limitedReadRequest(1))
+		}(i)
+	}
+	assert.Eventually(t, func() bool {
+		return metricValue(limiter.running) == 2 && metricValue(limiter.queued) == 3
+	}, time.Second, time.Millisecond, "reads beyond the limit queue")
+	running, _, _ := querier.stats()
+	assert.Equal(t, 2, running)
+
+	close(querier.gate)
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	_, maxRunning, queries := querier.stats()
+	assert.Equal(t, 2, maxRunning, "no more queries than the limit ran at once")
+	assert.Equal(t, 5, queries, "the queued reads ran once slots were free")
+	assert.Zero(t, metricValue(limiter.running))
+	assert.Zero(t, metricValue(limiter.queued))
+}
+
+func TestQueryLimiterSharedAndMultipleQueries(t *testing.T) {
+	querier := newGatedQuerier()
+	close(querier.gate)
+	limiter := newTestQueryLimiter(1, time.Second)
+	primary := newTestClient(&fakeInserter{}, WithQuerier(querier), WithQueryLimiter(limiter))
+	target := newTestClient(&fakeInserter{}, WithQuerier(querier), WithQueryLimiter(limiter))
+
+	var wg sync.WaitGroup
+	for _, c := range []*BigqueryClient{primary, target} {
+		wg.Add(1)
+		go func(c *BigqueryClient) {
+			defer wg.Done()
+			_, err := c.Read(context.Background(), limitedReadRequest(3))
+			assert.NoError(t, err, "the queries of a request take a slot one after another")
+		}(c)
+	}
+	wg.Wait()
+	_, maxRunning, queries := querier.stats()
+	assert.Equal(t, 1, maxRunning, "clients sharing the limiter share its slots")
+	assert.Equal(t, 6, queries)
+}
+
+func TestQueryLimiterTimeout(t *testing.T) {
+	querier := newGatedQuerier()
+	defer close(querier.gate)
+	limiter := newTestQueryLimiter(1, 20*time.Millisecond)
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithQueryLimiter(limiter))
+
+	go func() {
+		_, _ = c.Read(context.Background(), limitedReadRequest(1))
+	}()
+	assert.Eventually(t, func() bool { return metricValue(limiter.running) == 1 }, time.Second, time.Millisecond)
+
+	_, err := c.Read(context.Background(), limitedReadRequest(1))
+	var queueErr *QueryQueueTimeoutError
+	if assert.ErrorAs(t, err, &queueErr) {
+		assert.Equal(t, &QueryQueueTimeoutError{MaxQueries: 1, RetryAfter: 20 * time.Millisecond}, queueErr)
+	}
+	assert.ErrorIs(t, err, ErrQueryQueueTimeout)
+	assert.True(t, IsUnavailable(err))
+	assert.Equal(t, 1.0, metricValue(limiter.timeouts))
+	assert.Zero(t, metricValue(limiter.queued))
+	_, _, queries := querier.stats()
+	assert.Equal(t, 1, queries, "the timed out read didn't run its query")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.acquire(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), "reads cancelled while queued stop waiting")
+}
+
+func TestQueryLimiterNil(t *testing.T) {
+	var limiter *QueryLimiter
+	release, err := limiter.acquire(context.Background())
+	assert.NoError(t, err)
+	release()
+}
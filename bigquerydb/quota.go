@@ -0,0 +1,72 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"net/http"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// quotaReasons are the error reasons BigQuery answers requests over a quota or rate
+// limit with.
+var quotaReasons = map[string]bool{
+	"rateLimitExceeded": true,
+	"quotaExceeded":     true,
+}
+
+// IsQuotaExceeded reports whether the error means that a quota or rate limit of
+// BigQuery, e.g. of streaming inserts, was exceeded, so that the write should be retried
+// later instead of right away. Rows rejected for exceeding a quota count as well.
+func IsQuotaExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	var writeErr *WriteError
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.Errors {
+			if IsQuotaExceeded(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == http.StatusTooManyRequests {
+			return true
+		}
+		for _, e := range apiErr.Errors {
+			if quotaReasons[e.Reason] {
+				return true
+			}
+		}
+		return false
+	}
+	var multiError bigquery.PutMultiError
+	if errors.As(err, &multiError) {
+		for _, rowErr := range multiError {
+			for _, e := range rowErr.Errors {
+				if IsQuotaExceeded(e) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var bqErr *bigquery.Error
+	return errors.As(err, &bqErr) && quotaReasons[bqErr.Reason]
+}
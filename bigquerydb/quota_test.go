@@ -0,0 +1,60 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsQuotaExceeded(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"nil":                  {err: nil, expected: false},
+		"rate_limit_exceeded":  {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, expected: true},
+		"quota_exceeded":       {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, expected: true},
+		"too_many_requests":    {err: &googleapi.Error{Code: http.StatusTooManyRequests}, expected: true},
+		"access_denied":        {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}, expected: false},
+		"backend_error":        {err: &googleapi.Error{Code: http.StatusInternalServerError, Errors: []googleapi.ErrorItem{{Reason: "backendError"}}}, expected: false},
+		"wrapped":              {err: errors.Wrap(&googleapi.Error{Code: http.StatusTooManyRequests}, "insert"), expected: true},
+		"row_quota_exceeded":   {err: syntheticPutMultiError(2, "quotaExceeded"), expected: true},
+		"row_invalid":          {err: syntheticPutMultiError(2, "invalid"), expected: false},
+		"write_error_quota":    {err: &WriteError{Errors: []error{errors.New("boom"), &googleapi.Error{Code: http.StatusTooManyRequests}}}, expected: true},
+		"write_error_no_quota": {err: &WriteError{Errors: []error{ErrQueueFull}}, expected: false},
+		"bigquery_error":       {err: &bigquery.Error{Reason: "rateLimitExceeded"}, expected: true},
+		"other":                {err: errors.New("boom"), expected: false},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, IsQuotaExceeded(testCase.err))
+		})
+	}
+}
+
+func TestWriteQuotaExceeded(t *testing.T) {
+	c := newTestClient(&fakeInserter{err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}})
+	err := c.Write(context.Background(), seriesWithSamples("up", 2))
+	assert.True(t, IsQuotaExceeded(err), "the write fails with the error of the insert")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReadTemplate is the text/template of the SQL of read queries. It receives the
+// selected columns as .Columns, the table as .Table, the conditions of the label matchers
+// as .Matchers, the bounds of the time range as .Start and .End, the QUALIFY condition of
+// read deduplication as .Qualify, the columns to sort by as .OrderBy and the name of the
+// column holding the labels as .TagsColumn.
+const DefaultReadTemplate = "SELECT {{.Columns}} FROM {{.Table}} WHERE {{range .Matchers}}{{.}} AND {{end}}" +
+	"timestamp >= {{.Start}} AND timestamp <= {{.End}}{{with .Qualify}} QUALIFY {{.}}{{end}}{{with .OrderBy}} ORDER BY {{.}}{{end}}"
+
+var defaultReadTemplate = template.Must(template.New("read").Parse(DefaultReadTemplate))
+
+// ParseReadTemplate parses a template of the SQL of read queries like DefaultReadTemplate.
+// The template is rendered once with an example query, so that references to unknown
+// fields fail when it is parsed rather than with every query.
+func ParseReadTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("read").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the read query template")
+	}
+	example := &readQuery{
+		Columns:    "metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value",
+		Table:      "`dataset.table`",
+		Matchers:   []string{"metricname = @m0"},
+		Start:      "TIMESTAMP_MILLIS(@start)",
+		End:        "TIMESTAMP_MILLIS(@end)",
+		TagsColumn: "tags",
+	}
+	sql, err := example.sql(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if sql == "" {
+		return nil, errors.New("the read query template renders an empty query")
+	}
+	return tmpl, nil
+}
+
+// WithReadTemplate sets the template the SQL of read queries and exports is rendered with,
+// e.g. to select from a view which joins the samples with other tables. The query has to
+// return the columns of the default query and use its parameters.
+func WithReadTemplate(tmpl *template.Template) Option {
+	return func(c *BigqueryClient) {
+		if tmpl != nil {
+			c.readTemplate = tmpl
+		}
+	}
+}
+
+// WithReadTable makes read queries and exports select from another table or view than the
+// one samples are written to, e.g. a view which renames labels. The view needs the columns
+// of the table.
+func WithReadTable(datasetID, tableID string) Option {
+	return func(c *BigqueryClient) {
+		c.readDatasetID = datasetID
+		c.readTableID = tableID
+	}
+}
@@ -0,0 +1,151 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// concatenatedSQL returns the SQL of a read query the way it was put together before
+// read templates, which the default template has to render byte for byte.
+func concatenatedSQL(c *BigqueryClient, q *prompb.Query, orderBy string) (string, error) {
+	conditions, _, err := c.queryConditions(q)
+	if err != nil {
+		return "", err
+	}
+	conditions = append(conditions, "timestamp >= "+c.timestampParamSQL("start"), "timestamp <= "+c.timestampParamSQL("end"))
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", c.selectColumnsSQL(), c.tableSQL(), strings.Join(conditions, " AND "))
+	if qualify := c.deduplicateSQL(); qualify != "" {
+		query += " QUALIFY " + qualify
+	}
+	if orderBy != "" {
+		query += " ORDER BY " + orderBy
+	}
+	return query, nil
+}
+
+func TestDefaultReadTemplate(t *testing.T) {
+	queries := map[string]*prompb.Query{
+		"name":      sensorQuery(1000, 2000),
+		"no name":   {Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api|web"}}},
+		"match all": {Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "job", Value: ".*"}}},
+		"nothing":   {Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}, {Type: prompb.LabelMatcher_RE, Name: "job", Value: ""}, {Type: prompb.LabelMatcher_NRE, Name: "job", Value: ".*"}}},
+		"several": {Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_NEQ, Name: "job", Value: "db"},
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_NRE, Name: "instance", Value: "a.*"},
+		}},
+	}
+	options := map[string][]Option{
+		"default":      nil,
+		"json":         {WithTagsType(TagsTypeJSON)},
+		"labels":       {WithTagsType(TagsTypeLabels), WithSeriesHashColumn(true)},
+		"sorted":       {WithServerSideSort(true), WithSpecialValueColumn(true)},
+		"deduplicated": {WithReadDeduplication(true), WithTimestampType(TimestampTypeMillis)},
+		"routes":       {WithRoutes(testRoutes()), WithReadDeduplication(true), WithServerSideSort(true)},
+	}
+	for name, opts := range options {
+		for queryName, q := range queries {
+			t.Run(name+"/"+queryName, func(t *testing.T) {
+				c := newTestClient(&fakeInserter{}, opts...)
+				orderBy := ""
+				if c.serverSideSort {
+					orderBy = "timestamp"
+				}
+				expected, err := concatenatedSQL(c, q, orderBy)
+				assert.NoError(t, err)
+				query, _, err := c.buildCommand(q)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, query)
+			})
+		}
+	}
+}
+
+func TestParseReadTemplate(t *testing.T) {
+	tmpl, err := ParseReadTemplate(DefaultReadTemplate)
+	assert.NoError(t, err)
+	c := newTestClient(&fakeInserter{}, WithReadTemplate(tmpl))
+	query, _, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Equal(t, defaultReadTemplate.Root.String(), tmpl.Root.String())
+	assert.True(t, strings.HasPrefix(query, "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table` WHERE metricname = @m0 AND "), query)
+
+	for template, errMsg := range map[string]string{
+		"SELECT {{.Columns}":                              "failed to parse the read query template",
+		"SELECT {{.Columns}} FROM {{.Tables}}":            "can't evaluate field Tables",
+		"SELECT {{index .Matchers 3}} FROM {{.Table}}":    "index out of range",
+		"{{if .OrderBy}}SELECT {{.Columns}}{{end}}\n\t\n": "renders an empty query",
+	} {
+		_, err := ParseReadTemplate(template)
+		assert.ErrorContains(t, err, errMsg, template)
+	}
+}
+
+func TestCustomReadTemplate(t *testing.T) {
+	tmpl, err := ParseReadTemplate(`
+WITH samples AS (
+  SELECT s.metricname, s.{{.TagsColumn}}, s.timestamp, s.value
+  FROM {{.Table}} AS s JOIN ` + "`dataset.allowlist`" + ` AS a USING (metricname)
+)
+SELECT {{.Columns}} FROM samples
+WHERE {{range .Matchers}}{{.}} AND {{end}}timestamp BETWEEN {{.Start}} AND {{.End}}
+{{with .OrderBy}}ORDER BY {{.}}{{end}}
+`)
+	assert.NoError(t, err)
+
+	c := newTestClient(&fakeInserter{}, WithReadTemplate(tmpl), WithServerSideSort(true))
+	query, params, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Equal(t, "WITH samples AS (\n"+
+		"  SELECT s.metricname, s.tags, s.timestamp, s.value\n"+
+		"  FROM `dataset.table` AS s JOIN `dataset.allowlist` AS a USING (metricname)\n"+
+		")\n"+
+		"SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM samples\n"+
+		"WHERE metricname = @m0 AND timestamp BETWEEN TIMESTAMP_MILLIS(@start) AND TIMESTAMP_MILLIS(@end)\n"+
+		"ORDER BY timestamp", query)
+	assert.Equal(t, []bigquery.QueryParameter{
+		{Name: "m0", Value: "sensor"},
+		{Name: "start", Value: int64(1000)},
+		{Name: "end", Value: int64(2000)},
+	}, params)
+
+	// Exports render the same template, sorted by series.
+	query, _, err = c.buildOrderedCommand(sensorQuery(1000, 2000), "metricname, tags, timestamp")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(query, "\nORDER BY metricname, tags, timestamp"), query)
+}
+
+func TestReadTable(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithReadTable("curated", "metrics-view"))
+	query, _, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `curated.metrics-view` WHERE ")
+
+	// The view replaces the union of the tables of the routes, writes still use the routes.
+	c = newTestClient(&fakeInserter{}, WithRoutes(testRoutes()), WithReadTable("dataset", "all_metrics"), WithDataProject("data"))
+	query, _, err = c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `data.dataset.all_metrics` WHERE ")
+	assert.NotContains(t, query, "UNION ALL")
+	assert.Equal(t, "short.buckets", c.destinationFor("latency_bucket").name())
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// rawResolution is the table label of the queries served by the table of raw samples.
+const rawResolution = "raw"
+
+// ReadResolution is a table of downsampled samples with the schema of
+// bq-aggregate-schema.json, like the one written by WithAggregation, which serves the read
+// queries of long time ranges instead of the table of raw samples.
+type ReadResolution struct {
+	// DatasetID is the dataset of the table, the one of the client if empty.
+	DatasetID string
+	TableID   string
+	// Interval is the interval the samples of the table are aggregated over.
+	Interval time.Duration
+	// MinRange is the shortest time range of the queries the table serves.
+	MinRange time.Duration
+}
+
+// WithReadResolutions serves read queries from the downsampled tables of the resolutions.
+// A query is served by the resolution of the longest interval whose minimum range the
+// query spans and whose interval isn't longer than the step of the query, if it has one,
+// and by the table of raw samples if there is none. Every row of a downsampled table
+// becomes a sample at the start of its interval with the average of the interval as value.
+// With forceRaw, all queries are served by the table of raw samples.
+func WithReadResolutions(resolutions []ReadResolution, forceRaw bool) Option {
+	return func(c *BigqueryClient) {
+		c.readResolutions = resolutions
+		c.readForceRaw = forceRaw
+	}
+}
+
+// resolutionFor returns the resolution serving the query, or nil for the table of raw
+// samples.
+func (c *BigqueryClient) resolutionFor(q *prompb.Query) *ReadResolution {
+	if c.readForceRaw {
+		return nil
+	}
+	queryRange := time.Duration(q.EndTimestampMs-q.StartTimestampMs) * time.Millisecond
+	step := time.Duration(q.GetHints().GetStepMs()) * time.Millisecond
+	var selected *ReadResolution
+	for i := range c.readResolutions {
+		r := &c.readResolutions[i]
+		if queryRange < r.MinRange || step > 0 && step < r.Interval {
+			continue
+		}
+		if selected == nil || r.Interval > selected.Interval {
+			selected = r
+		}
+	}
+	return selected
+}
+
+// resolutionKey is the context key of the resolution serving a query.
+type resolutionKey struct{}
+
+// withResolution returns the context of the query, with the resolution serving it if it
+// isn't served by the table of raw samples, and counts the table serving it.
+func (c *BigqueryClient) withResolution(ctx context.Context, q *prompb.Query) context.Context {
+	r := c.resolutionFor(q)
+	if r == nil {
+		c.resolutionQueries.WithLabelValues(rawResolution).Inc()
+		return ctx
+	}
+	c.resolutionQueries.WithLabelValues(c.resolutionTable(r)).Inc()
+	return context.WithValue(ctx, resolutionKey{}, r)
+}
+
+// resolutionFrom returns the resolution serving the query of the context, or nil for the
+// table of raw samples.
+func resolutionFrom(ctx context.Context) *ReadResolution {
+	r, _ := ctx.Value(resolutionKey{}).(*ReadResolution)
+	return r
+}
+
+// resolutionTable returns the name of the table of the resolution.
+func (c *BigqueryClient) resolutionTable(r *ReadResolution) string {
+	datasetID := r.DatasetID
+	if datasetID == "" {
+		datasetID = c.datasetID
+	}
+	return c.tableName(datasetID, r.TableID)
+}
+
+// buildReadCommand generates the SQL of the query for the table serving it.
+func (c *BigqueryClient) buildReadCommand(ctx context.Context, q *prompb.Query) (string, []bigquery.QueryParameter, error) {
+	if r := resolutionFrom(ctx); r != nil {
+		return c.buildResolutionCommand(q, r)
+	}
+	return c.buildCommand(q)
+}
+
+// buildResolutionCommand generates the SQL selecting the rows of the downsampled table of
+// the resolution as samples. The rows of an interval written in parts, e.g. around a
+// restart of the adapter, are merged into a single sample with the average weighted by
+// the number of samples of every part. Downsampled tables always have JSON tags in a
+// STRING and a TIMESTAMP column, and aren't read through the read template.
+func (c *BigqueryClient) buildResolutionCommand(q *prompb.Query, r *ReadResolution) (string, []bigquery.QueryParameter, error) {
+	conditions, params, err := c.matcherConditions(q, false)
+	if err != nil {
+		return "", nil, err
+	}
+	conditions = append(conditions, "timestamp >= TIMESTAMP_MILLIS(@start)", "timestamp <= TIMESTAMP_MILLIS(@end)")
+	query := fmt.Sprintf("SELECT metricname, tags, UNIX_MILLIS(timestamp) AS timestamp, SAFE_DIVIDE(SUM(avg * count), SUM(count)) AS value FROM `%s` WHERE %s GROUP BY metricname, tags, timestamp",
+		c.resolutionTable(r), strings.Join(conditions, " AND "))
+	if c.serverSideSort {
+		query += " ORDER BY timestamp"
+	}
+	c.logger.Debug("bigquery read", slog.Any("sql query", query), slog.Any("parameters", params))
+	return query, params, nil
+}
@@ -0,0 +1,158 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResolutions are a 5m table for ranges from 6h and a 1h table for ranges from 7d.
+var testResolutions = []ReadResolution{
+	{TableID: "metrics_5m", Interval: 5 * time.Minute, MinRange: 6 * time.Hour},
+	{DatasetID: "rollups", TableID: "metrics_1h", Interval: time.Hour, MinRange: 7 * 24 * time.Hour},
+}
+
+func TestResolutionFor(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithReadResolutions(testResolutions, false))
+	query := func(queryRange, step time.Duration) *prompb.Query {
+		q := &prompb.Query{StartTimestampMs: 1700000000000, EndTimestampMs: 1700000000000 + queryRange.Milliseconds()}
+		if step > 0 {
+			q.Hints = &prompb.ReadHints{StepMs: step.Milliseconds()}
+		}
+		return q
+	}
+	testCases := map[string]struct {
+		query *prompb.Query
+		table string
+	}{
+		"short range":              {query: query(time.Hour, time.Minute)},
+		"just below the threshold": {query: query(6*time.Hour-time.Millisecond, 0)},
+		"threshold without step":   {query: query(6*time.Hour, 0), table: "metrics_5m"},
+		"step below the interval":  {query: query(6*time.Hour, time.Minute)},
+		"step of the interval":     {query: query(6*time.Hour, 5*time.Minute), table: "metrics_5m"},
+		"coarsest without step":    {query: query(10*24*time.Hour, 0), table: "metrics_1h"},
+		"coarsest the step allows": {query: query(10*24*time.Hour, 10*time.Minute), table: "metrics_5m"},
+		"coarsest with long step":  {query: query(10*24*time.Hour, 2*time.Hour), table: "metrics_1h"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := c.resolutionFor(tc.query)
+			if tc.table == "" {
+				assert.Nil(t, r)
+				return
+			}
+			if assert.NotNil(t, r) {
+				assert.Equal(t, tc.table, r.TableID)
+			}
+		})
+	}
+
+	forced := newTestClient(&fakeInserter{}, WithReadResolutions(testResolutions, true))
+	assert.Nil(t, forced.resolutionFor(query(10*24*time.Hour, 0)), "forced to read raw samples")
+}
+
+func TestBuildResolutionCommand(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithTagsType(TagsTypeLabels), WithServerSideSort(true))
+	command, params, err := c.buildResolutionCommand(&prompb.Query{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"},
+		},
+	}, &testResolutions[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT metricname, tags, UNIX_MILLIS(timestamp) AS timestamp, SAFE_DIVIDE(SUM(avg * count), SUM(count)) AS value "+
+		"FROM `rollups.metrics_1h` WHERE metricname = @m0 AND IFNULL(JSON_VALUE(tags, '$.\"job\"'), '') = @m1 "+
+		"AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) GROUP BY metricname, tags, timestamp ORDER BY timestamp",
+		command, "downsampled tables have JSON tags regardless of the tags type")
+	assert.Len(t, params, 4)
+}
+
+func TestReadResolutionFakeBigQuery(t *testing.T) {
+	end := time.Now().Truncate(time.Hour)
+	start := end.Add(-7 * time.Hour)
+	c := newFakeBigQueryClient(WithReadResolutions(testResolutions[:1], false), WithServerSideSort(true))
+	writeSplitSeries(t, c, start.UnixMilli(), end.UnixMilli())
+	fake := c.querier.(*fakeBigQuery)
+	bucket := end.Add(-time.Hour).Unix()
+	fake.aggregates = []*aggregateRow{
+		{metricname: "up", tags: `{"job":"api"}`, start: bucket, min: 1, max: 3, sum: 6, count: 3},
+		// The second part of the interval after a restart is merged into the same sample.
+		{metricname: "up", tags: `{"job":"api"}`, start: bucket, min: 10, max: 10, sum: 10, count: 1},
+		{metricname: "up", tags: `{"job":"api"}`, start: bucket + 300, min: 5, max: 5, sum: 5, count: 1},
+		{metricname: "up", tags: `{"job":"db"}`, start: bucket, min: 7, max: 7, sum: 7, count: 1},
+	}
+	read := func(start, end time.Time, step time.Duration) []*prompb.TimeSeries {
+		resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+			StartTimestampMs: start.UnixMilli(),
+			EndTimestampMs:   end.UnixMilli(),
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"}},
+			Hints:            &prompb.ReadHints{StepMs: step.Milliseconds()},
+		}}})
+		assert.NoError(t, err)
+		return resp.Results[0].Timeseries
+	}
+
+	series := read(start, end, 5*time.Minute)
+	if assert.Len(t, series, 1) {
+		assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, series[0].Labels)
+		assert.Equal(t, []prompb.Sample{{Timestamp: bucket * 1000, Value: 4}, {Timestamp: (bucket + 300) * 1000, Value: 5}}, series[0].Samples,
+			"the samples of the 5m table, with the average weighted by the counts")
+	}
+
+	series = read(end.Add(-time.Hour), end, 5*time.Minute)
+	if assert.Len(t, series, 1) {
+		assert.Len(t, series[0].Samples, 121, "a short range reads the raw samples")
+	}
+	series = read(start, end, 30*time.Second)
+	if assert.Len(t, series, 1) {
+		assert.Len(t, series[0].Samples, 841, "a step below the interval reads the raw samples")
+	}
+
+	metrics := scrape(t, c)
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_read_resolution_queries_total{table="dataset.metrics_5m"}`])
+	assert.Equal(t, 2.0, metrics[`storage_bigquery_read_resolution_queries_total{table="raw"}`])
+}
+
+func TestReadResolutionCache(t *testing.T) {
+	end := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	start := end.Add(-7 * time.Hour)
+	c := newFakeBigQueryClient(WithReadResolutions(testResolutions[:1], false), WithReadCache(time.Minute, 10, time.Minute, 0))
+	writeSplitSeries(t, c, start.UnixMilli(), end.UnixMilli())
+	c.querier.(*fakeBigQuery).aggregates = []*aggregateRow{
+		{metricname: "up", tags: `{"job":"api"}`, start: start.Unix(), min: 1, max: 1, sum: 1, count: 1},
+	}
+	read := func(step time.Duration) int {
+		resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+			StartTimestampMs: start.UnixMilli(),
+			EndTimestampMs:   end.UnixMilli(),
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"}},
+			Hints:            &prompb.ReadHints{StepMs: step.Milliseconds()},
+		}}})
+		assert.NoError(t, err)
+		return len(resp.Results[0].Timeseries[0].Samples)
+	}
+	assert.Equal(t, 1, read(5*time.Minute))
+	assert.Equal(t, 841, read(30*time.Second), "the raw samples of the same range aren't served from the downsampled ones")
+	assert.Equal(t, 1, read(5*time.Minute))
+	assert.Equal(t, 1.0, metricValue(c.readCacheHits))
+}
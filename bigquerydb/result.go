@@ -0,0 +1,404 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/api/iterator"
+)
+
+// rowIterator is the subset of *bigquery.RowIterator used to read query results.
+type rowIterator interface {
+	Next(dst interface{}) error
+}
+
+// resultSet collects the timeseries returned by the queries of a read request.
+type resultSet struct {
+	series map[model.Fingerprint]*prompb.TimeSeries
+	// byKey indexes the series by their raw metric name and tags, so the labels
+	// only have to be decoded for the first row of every series.
+	byKey      map[string]*prompb.TimeSeries
+	samples    int
+	maxSamples int
+	// bytes is the approximate size of the marshaled response, which may not exceed
+	// maxBytes. matchers are those of the query being merged, for the error.
+	bytes    int
+	maxBytes int
+	matchers string
+	// skipBadRows skips rows which can't be converted instead of failing the read.
+	// The skipped rows are counted in badRows, and the first error is kept in badRowErr.
+	skipBadRows bool
+	badRows     int
+	badRowErr   error
+}
+
+func newResultSet(maxSamples int) *resultSet {
+	return &resultSet{
+		series:     map[model.Fingerprint]*prompb.TimeSeries{},
+		byKey:      map[string]*prompb.TimeSeries{},
+		maxSamples: maxSamples,
+	}
+}
+
+// sortSamples sorts the samples of every series by timestamp, as rows of
+// different queries can interleave and queries may return them unsorted, and
+// drops samples which were returned more than once with the same timestamp and
+// value. Samples with the same timestamp are sorted by value, so the result
+// doesn't depend on the order the rows arrived in. It returns the number of
+// dropped samples.
+func (rs *resultSet) sortSamples() int {
+	duplicates := 0
+	for _, ts := range rs.series {
+		samples := ts.Samples
+		less := func(i, j int) bool {
+			if samples[i].Timestamp != samples[j].Timestamp {
+				return samples[i].Timestamp < samples[j].Timestamp
+			}
+			return samples[i].Value < samples[j].Value
+		}
+		if !sort.SliceIsSorted(samples, less) {
+			sort.Slice(samples, less)
+		}
+		n := 0
+		for i, s := range samples {
+			// Values are compared by their bits, as staleness markers are NaN.
+			if i > 0 && s.Timestamp == samples[n-1].Timestamp && math.Float64bits(s.Value) == math.Float64bits(samples[n-1].Value) {
+				continue
+			}
+			samples[n] = s
+			n++
+		}
+		duplicates += len(samples) - n
+		ts.Samples = samples[:n]
+	}
+	rs.samples -= duplicates
+	return duplicates
+}
+
+// response returns the collected timeseries as a read response.
+func (rs *resultSet) response() *prompb.ReadResponse {
+	timeseries := make([]*prompb.TimeSeries, 0, len(rs.series))
+	for _, ts := range rs.series {
+		timeseries = append(timeseries, ts)
+	}
+	return &prompb.ReadResponse{
+		Results: []*prompb.QueryResult{
+			{Timeseries: timeseries},
+		},
+	}
+}
+
+// mergeResult iterates over the BigQuery data and adds the rows to the timeseries of the result set.
+// It only converts the rows, reads fetch them ahead with a prefetchIterator.
+func mergeResult(rs *resultSet, iter rowIterator) error {
+	if iter == nil {
+		return nil
+	}
+	row := make(map[string]bigquery.Value, 4)
+	for {
+		err := iter.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := rs.addRow(row); err != nil {
+			if !rs.skipBadRows {
+				return err
+			}
+			if rs.badRowErr == nil {
+				rs.badRowErr = err
+			}
+			rs.badRows++
+			continue
+		}
+
+		rs.samples++
+		if err := rs.checkLimits(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkLimits fails once the collected samples exceed one of the limits of the response.
+func (rs *resultSet) checkLimits() error {
+	if rs.maxSamples > 0 && rs.samples > rs.maxSamples {
+		return newLimitError("samples", "read exceeded the limit of %d samples, narrow the time range or use more selective matchers", rs.maxSamples)
+	}
+	if rs.maxBytes > 0 && rs.bytes > rs.maxBytes {
+		return newLimitError("response_bytes", "read exceeded the limit of %d bytes of the response while merging the rows of query %s, narrow the time range or use more selective matchers",
+			rs.maxBytes, rs.matchers)
+	}
+	return nil
+}
+
+// Approximations of the marshaled size of the parts of a response, which include the
+// field tag and the length of every message.
+const (
+	seriesOverheadBytes = 4
+	fieldOverheadBytes  = 2
+)
+
+// labelsSize returns the approximate marshaled size of a series without its samples.
+func labelsSize(labels []*prompb.Label) int {
+	size := seriesOverheadBytes
+	for _, l := range labels {
+		size += l.Size() + fieldOverheadBytes
+	}
+	return size
+}
+
+// sampleSize returns the approximate marshaled size of a sample.
+func sampleSize(s prompb.Sample) int {
+	return s.Size() + fieldOverheadBytes
+}
+
+// addRow adds the sample of a BigQuery row to its series.
+func (rs *resultSet) addRow(row map[string]bigquery.Value) error {
+	key := seriesKey(row)
+	if ts, ok := rs.byKey[key]; ok {
+		sample, err := rowSample(row)
+		if err != nil {
+			return err
+		}
+		ts.Samples = append(ts.Samples, sample)
+		rs.bytes += sampleSize(sample)
+		return nil
+	}
+
+	sample, metric, labels, err := rowToSample(row)
+	if err != nil {
+		return err
+	}
+	// The series hash column holds the fingerprint of the labels computed when the row
+	// was written.
+	fp, ok := rowSeriesHash(row)
+	if !ok {
+		fp = metric.Fingerprint()
+	}
+	ts := rs.seriesFor(fp, labels)
+	rs.byKey[key] = ts
+	ts.Samples = append(ts.Samples, sample)
+	rs.bytes += labelsSize(labels) + sampleSize(sample)
+	return nil
+}
+
+// seriesFor returns the series with the fingerprint and labels, which is added if it
+// doesn't exist yet. Series with colliding fingerprints are stored under the next free
+// fingerprint, so that they are told apart by comparing their labels.
+func (rs *resultSet) seriesFor(fp model.Fingerprint, labels []*prompb.Label) *prompb.TimeSeries {
+	for {
+		ts, ok := rs.series[fp]
+		if !ok {
+			ts = &prompb.TimeSeries{Labels: labels}
+			rs.series[fp] = ts
+			return ts
+		}
+		if sameLabels(ts.Labels, labels) {
+			return ts
+		}
+		fp++
+	}
+}
+
+// addSeries adds the samples of the series within the time range to the result set.
+// The given series are not modified.
+func (rs *resultSet) addSeries(series []*prompb.TimeSeries, start, end int64) error {
+	for _, s := range series {
+		metric := make(model.Metric, len(s.Labels))
+		for _, l := range s.Labels {
+			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		}
+		fp := metric.Fingerprint()
+		var ts *prompb.TimeSeries
+		for _, sample := range s.Samples {
+			if sample.Timestamp < start || sample.Timestamp > end {
+				continue
+			}
+			if ts == nil {
+				ts = rs.seriesFor(fp, s.Labels)
+				rs.bytes += labelsSize(s.Labels)
+			}
+			ts.Samples = append(ts.Samples, sample)
+			rs.samples++
+			rs.bytes += sampleSize(sample)
+			if err := rs.checkLimits(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rowToSample converts a BigQuery row to a sample and also processes the labels for later consumption
+func rowToSample(row map[string]bigquery.Value) (prompb.Sample, model.Metric, []*prompb.Label, error) {
+	metricname, ok := row["metricname"].(string)
+	if !ok {
+		return prompb.Sample{}, nil, nil, errors.Errorf("unexpected metric name %v (%T)", row["metricname"], row["metricname"])
+	}
+	sample, err := rowSample(row)
+	if err != nil {
+		return prompb.Sample{}, nil, nil, err
+	}
+	labels, err := rowLabels(row)
+	if err != nil {
+		return prompb.Sample{}, nil, nil, errors.Wrapf(err, "row of metric %q", metricname)
+	}
+	labelPairs := make([]*prompb.Label, 0, len(labels)+1)
+	metric := make(model.Metric, len(labels)+1)
+	for name, v := range labels {
+		// Like in Prometheus, a label without a value is the same as no label.
+		if v == nil {
+			continue
+		}
+		value, ok := labelValue(v)
+		if !ok {
+			return prompb.Sample{}, nil, nil, errors.Errorf("row of metric %q has the unexpected value %v (%T) of tag %q", metricname, v, v, name)
+		}
+		labelPairs = append(labelPairs, &prompb.Label{
+			Name:  name,
+			Value: value,
+		})
+		metric[model.LabelName(name)] = model.LabelValue(value)
+	}
+	labelPairs = append(labelPairs, &prompb.Label{
+		Name:  model.MetricNameLabel,
+		Value: metricname,
+	})
+	// Make sure we sort the labels, so the test cases won't blow up
+	sort.Slice(labelPairs, func(i, j int) bool { return labelPairs[i].Name < labelPairs[j].Name })
+	metric[model.LabelName(model.MetricNameLabel)] = model.LabelValue(metricname)
+	return sample, metric, labelPairs, nil
+}
+
+// labelValue converts the value of a tag into a label value. Numbers and booleans written
+// into the tags by other pipelines are converted into their string forms. Objects and
+// arrays can't be converted.
+func labelValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// rowLabels returns the labels of a BigQuery row without the metric name, from the
+// repeated labels field if it was selected, and from the JSON tags otherwise.
+func rowLabels(row map[string]bigquery.Value) (map[string]interface{}, error) {
+	repeated, ok := row["labels"]
+	if !ok {
+		labelsJSON, ok := row["tags"].(string)
+		if !ok {
+			return nil, errors.Errorf("unexpected tags %v (%T)", row["tags"], row["tags"])
+		}
+		var labels map[string]interface{}
+		// Numbers are kept in the form they were written in.
+		decoder := json.NewDecoder(strings.NewReader(labelsJSON))
+		decoder.UseNumber()
+		if err := decoder.Decode(&labels); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the tags")
+		}
+		return labels, nil
+	}
+
+	// A NULL array is returned as nil, which is the same as an empty one.
+	records, ok := repeated.([]bigquery.Value)
+	if !ok && repeated != nil {
+		return nil, errors.Errorf("unexpected labels %v (%T)", repeated, repeated)
+	}
+	labels := make(map[string]interface{}, len(records))
+	for _, record := range records {
+		label, ok := record.(map[string]bigquery.Value)
+		if !ok {
+			return nil, errors.Errorf("unexpected label %v (%T)", record, record)
+		}
+		name, ok := label["name"].(string)
+		if !ok {
+			return nil, errors.Errorf("unexpected label name %v (%T)", label["name"], label["name"])
+		}
+		labels[name] = label["value"]
+	}
+	return labels, nil
+}
+
+// seriesKey returns the raw metric name and labels of a BigQuery row, which are equal
+// for all rows of a series.
+func seriesKey(row map[string]bigquery.Value) string {
+	metricname, _ := row["metricname"].(string)
+	records, ok := row["labels"].([]bigquery.Value)
+	if !ok {
+		tags, _ := row["tags"].(string)
+		return metricname + "\xff" + tags
+	}
+	var key strings.Builder
+	key.WriteString(metricname)
+	for _, record := range records {
+		label, _ := record.(map[string]bigquery.Value)
+		name, _ := label["name"].(string)
+		// Values which aren't strings are converted like in rowToSample, and NULL
+		// values are told apart from empty ones.
+		if label["value"] == nil {
+			key.WriteString("\xff" + name + "\xfd")
+			continue
+		}
+		value, _ := labelValue(label["value"])
+		key.WriteString("\xff" + name + "\xfe" + value)
+	}
+	return key.String()
+}
+
+// rowSample returns the timestamp and value of a BigQuery row. Rows with a NULL value are
+// staleness markers, unless their special value column holds a NaN or infinite value.
+func rowSample(row map[string]bigquery.Value) (prompb.Sample, error) {
+	timestamp, ok := row["timestamp"].(int64)
+	if !ok {
+		return prompb.Sample{}, errors.Errorf("row of metric %q has the unexpected timestamp %v (%T)", row["metricname"], row["timestamp"], row["timestamp"])
+	}
+	if row["value"] == nil {
+		if special, ok := row[specialValueColumn].(string); ok {
+			value, err := parseSpecialValue(special)
+			if err != nil {
+				return prompb.Sample{}, errors.Wrapf(err, "row of metric %q", row["metricname"])
+			}
+			return prompb.Sample{Timestamp: timestamp, Value: value}, nil
+		}
+		return prompb.Sample{Timestamp: timestamp, Value: math.Float64frombits(staleNaN)}, nil
+	}
+	value, ok := row["value"].(float64)
+	if !ok {
+		return prompb.Sample{}, errors.Errorf("row of metric %q has the unexpected value %v (%T)", row["metricname"], row["value"], row["value"])
+	}
+	return prompb.Sample{Timestamp: timestamp, Value: value}, nil
+}
@@ -0,0 +1,296 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeResult(t *testing.T) {
+	rs := newResultSet(0)
+	iter := &fakeRowIterator{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"web"}`, 1000, 0),
+		testRow("up", `{"job":"api"}`, 2000, 1),
+	}}
+	assert.NoError(t, mergeResult(rs, iter))
+	assert.Equal(t, 3, rs.samples)
+
+	resp := rs.response()
+	assert.Len(t, resp.Results, 1)
+	assert.Len(t, resp.Results[0].Timeseries, 2)
+	for _, ts := range resp.Results[0].Timeseries {
+		assert.Equal(t, "__name__", ts.Labels[0].Name)
+		assert.Equal(t, "job", ts.Labels[1].Name)
+		if ts.Labels[1].Value == "api" {
+			assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}}, ts.Samples)
+		} else {
+			assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 0}}, ts.Samples)
+		}
+	}
+}
+
+func TestMergeResultSameSeriesDifferentTagsEncoding(t *testing.T) {
+	rs := newResultSet(0)
+	iter := &fakeRowIterator{rows: []map[string]bigquery.Value{
+		testRow("up", `{"a":"1","b":"2"}`, 1000, 1),
+		testRow("up", `{"b":"2","a":"1"}`, 2000, 1),
+	}}
+	assert.NoError(t, mergeResult(rs, iter))
+	assert.Len(t, rs.response().Results[0].Timeseries, 1)
+}
+
+func TestMergeResultMaxSamples(t *testing.T) {
+	rs := newResultSet(10)
+	assert.NoError(t, mergeResult(rs, newSyntheticRowIterator(10, 3)))
+
+	rs = newResultSet(10)
+	err := mergeResult(rs, newSyntheticRowIterator(11, 3))
+	assert.ErrorContains(t, err, "limit of 10 samples")
+}
+
+// BenchmarkMergeResult merges a million rows spread over a thousand series.
+func BenchmarkMergeResult(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rs := newResultSet(0)
+		if err := mergeResult(rs, newSyntheticRowIterator(1000000, 1000)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSortSamplesAcrossQueries(t *testing.T) {
+	rs := newResultSet(0)
+	first := &fakeRowIterator{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"api"}`, 3000, 1),
+		testRow("up", `{"job":"api"}`, 5000, 1),
+	}}
+	second := &fakeRowIterator{rows: []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 2000, 0),
+		testRow("up", `{"job":"api"}`, 3000, 1),
+		testRow("up", `{"job":"api"}`, 3000, 0),
+		testRow("up", `{"job":"api"}`, 4000, 1),
+	}}
+	assert.NoError(t, mergeResult(rs, first))
+	assert.NoError(t, mergeResult(rs, second))
+
+	assert.Equal(t, 1, rs.sortSamples())
+	assert.Equal(t, 6, rs.samples)
+
+	resp := rs.response()
+	assert.Len(t, resp.Results[0].Timeseries, 1)
+	samples := resp.Results[0].Timeseries[0].Samples
+	assert.Equal(t, []prompb.Sample{
+		{Timestamp: 1000, Value: 1},
+		{Timestamp: 2000, Value: 0},
+		{Timestamp: 3000, Value: 0},
+		{Timestamp: 3000, Value: 1},
+		{Timestamp: 4000, Value: 1},
+		{Timestamp: 5000, Value: 1},
+	}, samples)
+	for i := 1; i < len(samples); i++ {
+		assert.LessOrEqual(t, samples[i-1].Timestamp, samples[i].Timestamp)
+	}
+}
+
+// BenchmarkSortSamples merges and sorts a million rows spread over a thousand series,
+// returned sorted by timestamp like with server-side sorting, or in reverse order.
+func BenchmarkSortSamples(b *testing.B) {
+	for name, reversed := range map[string]bool{"server-side": false, "client-side": true} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rs := newResultSet(0)
+				it := newSyntheticRowIterator(1000000, 1000)
+				it.reversed = reversed
+				if err := mergeResult(rs, it); err != nil {
+					b.Fatal(err)
+				}
+				rs.sortSamples()
+			}
+		})
+	}
+}
+
+// TestSortSamplesOrderIndependent merges the same rows in different orders, including
+// samples with equal timestamps, and expects the same series every time.
+func TestSortSamplesOrderIndependent(t *testing.T) {
+	rows := []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		testRow("up", `{"job":"api"}`, 2000, 1),
+		testRow("up", `{"job":"api"}`, 2000, 0),
+		testRow("up", `{"job":"api"}`, 2000, 1),
+		testRow("up", `{"job":"api"}`, 3000, 2),
+		testRow("up", `{"job":"web"}`, 1000, 5),
+		testRow("up", `{"job":"web"}`, 1000, 4),
+	}
+	expected := map[string][]prompb.Sample{
+		"api": {{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}, {Timestamp: 2000, Value: 1}, {Timestamp: 3000, Value: 2}},
+		"web": {{Timestamp: 1000, Value: 4}, {Timestamp: 1000, Value: 5}},
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		shuffled := append([]map[string]bigquery.Value(nil), rows...)
+		rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		rs := newResultSet(0)
+		assert.NoError(t, mergeResult(rs, &fakeRowIterator{rows: shuffled}))
+		assert.Equal(t, 1, rs.sortSamples())
+
+		series := map[string][]prompb.Sample{}
+		for _, ts := range rs.response().Results[0].Timeseries {
+			series[ts.Labels[1].Value] = ts.Samples
+		}
+		assert.Equal(t, expected, series)
+	}
+}
+
+func TestSortSamplesAlreadySorted(t *testing.T) {
+	rs := newResultSet(0)
+	assert.NoError(t, mergeResult(rs, newSyntheticRowIterator(100, 5)))
+	assert.Equal(t, 0, rs.sortSamples())
+	assert.Equal(t, 100, rs.samples)
+}
+
+func TestMergeResultMalformedRows(t *testing.T) {
+	testCases := map[string]map[string]bigquery.Value{
+		"tags_not_json":        testRow("up", "job=api", 1000, 1),
+		"tags_not_object":      testRow("up", `["api"]`, 1000, 1),
+		"tag_value_object":     testRow("up", `{"job":{"name":"api"}}`, 1000, 1),
+		"tag_value_array":      testRow("up", `{"job":["api"]}`, 1000, 1),
+		"labels_wrong_type":    {"metricname": "up", "labels": "job=api", "timestamp": int64(1000), "value": 1.0},
+		"label_name_missing":   {"metricname": "up", "labels": []bigquery.Value{map[string]bigquery.Value{"value": "api"}}, "timestamp": int64(1000), "value": 1.0},
+		"tags_missing":         {"metricname": "up", "timestamp": int64(1000), "value": 1.0},
+		"metricname_missing":   {"tags": "{}", "timestamp": int64(1000), "value": 1.0},
+		"timestamp_wrong_type": {"metricname": "up", "tags": "{}", "timestamp": "1000", "value": 1.0},
+		"value_wrong_type":     {"metricname": "up", "tags": "{}", "timestamp": int64(1000), "value": "1"},
+	}
+
+	for name, row := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rs := newResultSet(0)
+			err := mergeResult(rs, &fakeRowIterator{rows: []map[string]bigquery.Value{row}})
+			assert.Error(t, err)
+
+			// All rows of a query have the same columns.
+			valid := testRow("up", `{"job":"api"}`, 2000, 2)
+			if _, ok := row["labels"]; ok {
+				valid = map[string]bigquery.Value{"metricname": "up", "labels": []bigquery.Value{}, "timestamp": int64(2000), "value": 2.0}
+			}
+			rs = newResultSet(0)
+			rs.skipBadRows = true
+			err = mergeResult(rs, &fakeRowIterator{rows: []map[string]bigquery.Value{row, valid}})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, rs.badRows)
+			assert.Error(t, rs.badRowErr)
+			assert.Equal(t, 1, rs.samples, "the valid rows are still read")
+		})
+	}
+}
+
+func TestMergeResultErrorMessages(t *testing.T) {
+	for _, testCase := range []struct {
+		row      map[string]bigquery.Value
+		expected string
+	}{
+		{map[string]bigquery.Value{"metricname": "up", "tags": "{}", "timestamp": "1000", "value": 1.0}, `row of metric "up" has the unexpected timestamp 1000 (string)`},
+		{map[string]bigquery.Value{"metricname": "up", "tags": "{}", "timestamp": int64(1000), "value": "1"}, `row of metric "up" has the unexpected value 1 (string)`},
+		{testRow("up", `{"job":[1]}`, 1000, 1), `row of metric "up" has the unexpected value [1] ([]interface {}) of tag "job"`},
+		{testRow("up", "job=api", 1000, 1), `row of metric "up": failed to decode the tags: invalid character 'j' looking for beginning of value`},
+	} {
+		err := mergeResult(newResultSet(0), &fakeRowIterator{rows: []map[string]bigquery.Value{testCase.row}})
+		assert.EqualError(t, err, testCase.expected)
+	}
+}
+
+func TestRowToSampleCoercesTagValues(t *testing.T) {
+	_, _, labels, err := rowToSample(testRow("http_requests_total", `{"code":200,"ratio":0.5,"big":12345678901234567890,"cached":true,"instance":null}`, 1000, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, []*prompb.Label{
+		{Name: "__name__", Value: "http_requests_total"},
+		{Name: "big", Value: "12345678901234567890"},
+		{Name: "cached", Value: "true"},
+		{Name: "code", Value: "200"},
+		{Name: "ratio", Value: "0.5"},
+	}, labels, "numbers keep the form they were written in, null values are no labels")
+
+	_, _, labels, err = rowToSample(map[string]bigquery.Value{
+		"metricname": "up",
+		"labels": []bigquery.Value{
+			map[string]bigquery.Value{"name": "code", "value": int64(200)},
+			map[string]bigquery.Value{"name": "job", "value": nil},
+		},
+		"timestamp": int64(1000),
+		"value":     1.0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "code", Value: "200"}}, labels)
+}
+
+func TestReadSkipBadRows(t *testing.T) {
+	rows := []map[string]bigquery.Value{
+		testRow("up", `{"job":"api"}`, 1000, 1),
+		{"metricname": "up", "tags": `{"job":"api"}`, "timestamp": int64(2000), "value": "NaN"},
+		{"metricname": "up", "tags": 42, "timestamp": int64(3000), "value": 1.0},
+		testRow("up", `{"job":"api"}`, 4000, 1),
+	}
+	req := &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}}}}
+
+	c := newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: rows}))
+	_, err := c.Read(context.Background(), req)
+	assert.Error(t, err)
+
+	c = newTestClient(&fakeInserter{}, WithQuerier(&fakeQuerier{rows: rows}), WithSkipBadRows(true))
+	resp, err := c.Read(context.Background(), req)
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Results[0].Timeseries, 1) {
+		assert.Len(t, resp.Results[0].Timeseries[0].Samples, 2)
+	}
+	assert.Equal(t, 2.0, metricValue(c.skippedRows))
+}
+
+func TestMergeResultMalformedRowOfKnownSeries(t *testing.T) {
+	rs := newResultSet(0)
+	err := mergeResult(rs, &fakeRowIterator{rows: []map[string]bigquery.Value{
+		testRow("up", "{}", 1000, 1),
+		{"metricname": "up", "tags": "{}", "timestamp": int64(2000), "value": "1"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestRowSampleNullValue(t *testing.T) {
+	sample, err := rowSample(map[string]bigquery.Value{"timestamp": int64(1000), "value": nil})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), sample.Timestamp)
+	assert.Equal(t, staleNaN, math.Float64bits(sample.Value), "NULL values are staleness markers")
+}
+
+func TestRowToSampleNullTags(t *testing.T) {
+	sample, metric, labels, err := rowToSample(testRow("up", "null", 1000, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, prompb.Sample{Timestamp: 1000, Value: 1}, sample)
+	assert.Len(t, metric, 1)
+	assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}}, labels)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// retentionHolderLabel is the table label naming the replica enforcing the retention.
+	retentionHolderLabel = "prombq-retention-holder"
+	// retentionLeaseLabel is the table label holding the Unix time the lease of the
+	// replica enforcing the retention expires at.
+	retentionLeaseLabel = "prombq-retention-lease"
+	// retentionLeaderCheck is how often a replica checks whether it became the leader
+	// enforcing the retention.
+	retentionLeaderCheck = time.Minute
+)
+
+// TableAdmin creates the table, and reads and updates its metadata. It is implemented by *bigquery.Table.
+type TableAdmin interface {
+	Create(ctx context.Context, tm *bigquery.TableMetadata) error
+	Metadata(ctx context.Context, opts ...bigquery.TableMetadataOption) (*bigquery.TableMetadata, error)
+	Update(ctx context.Context, tm bigquery.TableMetadataToUpdate, etag string, opts ...bigquery.TableUpdateOption) (*bigquery.TableMetadata, error)
+}
+
+// startRetention enforces the retention right away and then every retention interval,
+// until Close is called. With leader election, the leadership is checked every
+// retentionLeaderCheck, so that a new leader enforces the retention soon after it took over.
+func (c *BigqueryClient) startRetention() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.retentionStop = cancel
+	c.retentionStopped = make(chan struct{})
+	go func() {
+		defer close(c.retentionStopped)
+		interval := c.retentionInterval
+		if c.leader != nil {
+			interval = min(interval, retentionLeaderCheck)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last time.Time
+		for {
+			if c.retentionDue(last, time.Now()) {
+				last = time.Now()
+				if err := c.enforceRetention(ctx); err != nil && ctx.Err() == nil {
+					c.logger.Error("failed to enforce the retention", slog.Any("error", err), slog.Any("table", c.tableID))
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// retentionDue returns whether the retention is to be enforced, given when this replica
+// last enforced it. With leader election that's once per retention interval while it
+// leads, otherwise on every tick.
+func (c *BigqueryClient) retentionDue(last, now time.Time) bool {
+	if c.leader == nil {
+		return true
+	}
+	return c.leader.IsLeader() && (last.IsZero() || now.Sub(last) >= c.retentionInterval)
+}
+
+// stopRetention cancels a running enforcement and waits for it to end.
+func (c *BigqueryClient) stopRetention() {
+	if c.retentionStop == nil {
+		return
+	}
+	c.retentionStop()
+	<-c.retentionStopped
+}
+
+// enforceRetention makes sure no samples older than the retention are kept. Partitioned
+// tables get a partition expiration equal to the retention, from other tables the
+// expired rows are deleted. Only the leader, or without leader election the replica
+// holding the lease in the labels of the table, enforces the retention, the others return
+// without doing anything. Unless enforcing is enabled, the changes are only logged.
+func (c *BigqueryClient) enforceRetention(ctx context.Context) error {
+	if c.leader != nil && !c.leader.IsLeader() {
+		c.logger.Debug("retention is enforced by the leader")
+		return nil
+	}
+	md, err := c.tableAdmin.Metadata(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the table metadata")
+	}
+	if c.leader == nil {
+		leader, err := c.acquireRetentionLease(ctx, md)
+		if err != nil {
+			return errors.Wrap(err, "failed to acquire the retention lease")
+		}
+		if !leader {
+			return nil
+		}
+	}
+
+	if md.TimePartitioning != nil {
+		err = c.updatePartitionExpiration(ctx, md.TimePartitioning)
+	} else {
+		err = c.deleteExpiredRows(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	c.retentionLastRun.SetToCurrentTime()
+	return nil
+}
+
+// acquireRetentionLease takes or renews the lease on enforcing the retention, unless
+// another replica holds a lease which didn't expire yet. The labels are updated with the
+// etag of the metadata, so only one of several replicas taking the lease at once succeeds.
+func (c *BigqueryClient) acquireRetentionLease(ctx context.Context, md *bigquery.TableMetadata) (bool, error) {
+	now := time.Now()
+	holder := md.Labels[retentionHolderLabel]
+	until, _ := strconv.ParseInt(md.Labels[retentionLeaseLabel], 10, 64)
+	if holder != "" && holder != c.retentionHolder && now.Unix() < until {
+		c.logger.Debug("retention is enforced by another replica", slog.String("holder", holder), slog.Time("lease_until", time.Unix(until, 0)))
+		return false, nil
+	}
+
+	// The lease outlasts the next enforcement of the holder, so that it's renewed in time.
+	var update bigquery.TableMetadataToUpdate
+	update.SetLabel(retentionHolderLabel, c.retentionHolder)
+	update.SetLabel(retentionLeaseLabel, strconv.FormatInt(now.Add(2*c.retentionInterval).Unix(), 10))
+	_, err := c.tableAdmin.Update(ctx, update, md.ETag)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		c.logger.Debug("another replica took the retention lease first")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updatePartitionExpiration sets the partition expiration of the table to the retention.
+func (c *BigqueryClient) updatePartitionExpiration(ctx context.Context, partitioning *bigquery.TimePartitioning) error {
+	if partitioning.Expiration == c.retention {
+		c.logger.Debug("partition expiration matches the retention", slog.Duration("retention", c.retention))
+		return nil
+	}
+	if !c.retentionEnforce {
+		c.logger.Warn("partition expiration doesn't match the retention, not updating it as enforcing the retention is disabled",
+			slog.Duration("partition_expiration", partitioning.Expiration), slog.Duration("retention", c.retention))
+		return nil
+	}
+
+	updated := *partitioning
+	updated.Expiration = c.retention
+	if _, err := c.tableAdmin.Update(ctx, bigquery.TableMetadataToUpdate{TimePartitioning: &updated}, ""); err != nil {
+		return errors.Wrap(err, "failed to update the partition expiration")
+	}
+	c.logger.Info("partition expiration updated", slog.Duration("previous_expiration", partitioning.Expiration), slog.Duration("retention", c.retention))
+	return nil
+}
+
+// deleteExpiredRows deletes the rows older than the retention. The bytes the statement
+// scans are estimated with a dry run and logged first.
+func (c *BigqueryClient) deleteExpiredRows(ctx context.Context) error {
+	cutoff := "TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @retention SECOND)"
+	if c.timestampMillis() {
+		cutoff = "UNIX_MILLIS(" + cutoff + ")"
+	}
+	command := fmt.Sprintf("DELETE FROM %s WHERE timestamp < %s", c.tableRef(c.datasetID, c.tableID), cutoff)
+	params := []bigquery.QueryParameter{{Name: "retention", Value: int64(c.retention / time.Second)}}
+
+	estimate, err := c.dryRun(ctx, command, params)
+	if err != nil {
+		return errors.Wrap(err, "dry run of the retention delete failed")
+	}
+	if !c.retentionEnforce {
+		c.logger.Warn("not deleting rows older than the retention as enforcing the retention is disabled",
+			slog.Duration("retention", c.retention), slog.Int64("estimated_bytes_scanned", estimate.TotalBytesProcessed))
+		return nil
+	}
+	c.logger.Info("deleting rows older than the retention", slog.Duration("retention", c.retention), slog.Int64("estimated_bytes_scanned", estimate.TotalBytesProcessed))
+
+	stats, err := c.runStatement(ctx, command, params)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete the rows older than the retention")
+	}
+	var deleted int64
+	if details, ok := stats.Details.(*bigquery.QueryStatistics); ok {
+		deleted = details.NumDMLAffectedRows
+	}
+	c.retentionDeletedRows.Add(float64(deleted))
+	c.logger.Info("rows older than the retention deleted", slog.Int64("rows", deleted), slog.Int64("bytes_scanned", stats.TotalBytesProcessed))
+	return nil
+}
+
+// runStatementQuery runs the statement as a query job and waits for it to complete.
+func (c *BigqueryClient) runStatementQuery(ctx context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+	conn := c.acquire()
+	defer conn.release()
+	query := c.newQuery(conn, command, params)
+	// The maximum bytes billed is a limit of read queries.
+	query.MaxBytesBilled = 0
+	job, err := query.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wait for query job %s", job.ID())
+	}
+	if err := status.Err(); err != nil {
+		return nil, errors.Wrapf(err, "query job %s failed", job.ID())
+	}
+	return status.Statistics, nil
+}
+
+// retentionHolderID identifies the replica in the retention lease. It's the host name,
+// which is the pod name on Kubernetes, turned into a valid label value.
+func retentionHolderID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = fmt.Sprintf("pid-%d", os.Getpid())
+	}
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(host))
+	if len(id) > 63 {
+		id = id[:63]
+	}
+	return id
+}
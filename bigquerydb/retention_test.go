@@ -0,0 +1,167 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeTableAdmin serves the metadata of a table and records the updates.
+type fakeTableAdmin struct {
+	md          *bigquery.TableMetadata
+	metadataErr error
+	updateErr   error
+	createErr   error
+	updates     []bigquery.TableMetadataToUpdate
+	etags       []string
+	created     *bigquery.TableMetadata
+}
+
+func (f *fakeTableAdmin) Create(_ context.Context, tm *bigquery.TableMetadata) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.created = tm
+	return nil
+}
+
+func (f *fakeTableAdmin) Metadata(context.Context, ...bigquery.TableMetadataOption) (*bigquery.TableMetadata, error) {
+	return f.md, f.metadataErr
+}
+
+func (f *fakeTableAdmin) Update(_ context.Context, tm bigquery.TableMetadataToUpdate, etag string, _ ...bigquery.TableUpdateOption) (*bigquery.TableMetadata, error) {
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	f.updates = append(f.updates, tm)
+	f.etags = append(f.etags, etag)
+	return f.md, nil
+}
+
+// retentionStatements records the statements of the dry runs and of the jobs run.
+type retentionStatements struct {
+	dryRuns []string
+	runs    []string
+	params  []bigquery.QueryParameter
+}
+
+func newRetentionTestClient(admin *fakeTableAdmin, enforce bool) (*BigqueryClient, *retentionStatements) {
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithRetention(30*24*time.Hour, time.Hour, enforce))
+	c.retentionHolder = "adapter-0"
+	statements := &retentionStatements{}
+	c.dryRun = func(_ context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+		statements.dryRuns = append(statements.dryRuns, command)
+		return &bigquery.JobStatistics{TotalBytesProcessed: 1 << 30}, nil
+	}
+	c.runStatement = func(_ context.Context, command string, params []bigquery.QueryParameter) (*bigquery.JobStatistics, error) {
+		statements.runs = append(statements.runs, command)
+		statements.params = params
+		return &bigquery.JobStatistics{Details: &bigquery.QueryStatistics{NumDMLAffectedRows: 42}}, nil
+	}
+	return c, statements
+}
+
+func TestRetentionPartitionExpiration(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{
+		ETag:             "etag-1",
+		TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "timestamp"},
+	}}
+	c, statements := newRetentionTestClient(admin, true)
+
+	assert.NoError(t, c.enforceRetention(context.Background()))
+	if assert.Len(t, admin.updates, 2) {
+		assert.Equal(t, "etag-1", admin.etags[0], "the lease is taken with the etag of the metadata")
+		assert.Equal(t, &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "timestamp", Expiration: 30 * 24 * time.Hour},
+			admin.updates[1].TimePartitioning)
+	}
+	assert.Empty(t, statements.dryRuns)
+	assert.NotZero(t, metricValue(c.retentionLastRun))
+}
+
+func TestRetentionPartitionExpirationNotEnforced(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{TimePartitioning: &bigquery.TimePartitioning{}}}
+	c, _ := newRetentionTestClient(admin, false)
+
+	assert.NoError(t, c.enforceRetention(context.Background()))
+	assert.Len(t, admin.updates, 1, "only the lease is taken")
+}
+
+func TestRetentionDelete(t *testing.T) {
+	for _, enforce := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enforce), func(t *testing.T) {
+			admin := &fakeTableAdmin{md: &bigquery.TableMetadata{}}
+			c, statements := newRetentionTestClient(admin, enforce)
+
+			assert.NoError(t, c.enforceRetention(context.Background()))
+			statement := "DELETE FROM `dataset.table` WHERE timestamp < TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @retention SECOND)"
+			assert.Equal(t, []string{statement}, statements.dryRuns)
+			if enforce {
+				assert.Equal(t, []string{statement}, statements.runs)
+				assert.Equal(t, []bigquery.QueryParameter{{Name: "retention", Value: int64(30 * 24 * 3600)}}, statements.params)
+				assert.Equal(t, 42.0, metricValue(c.retentionDeletedRows))
+			} else {
+				assert.Empty(t, statements.runs)
+				assert.Zero(t, metricValue(c.retentionDeletedRows))
+			}
+		})
+	}
+}
+
+func TestRetentionLease(t *testing.T) {
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	for _, tc := range []struct {
+		name      string
+		labels    map[string]string
+		updateErr error
+		leader    bool
+	}{
+		{name: "no holder", leader: true},
+		{name: "held by this replica", labels: map[string]string{retentionHolderLabel: "adapter-0", retentionLeaseLabel: future}, leader: true},
+		{name: "held by another replica", labels: map[string]string{retentionHolderLabel: "adapter-1", retentionLeaseLabel: future}},
+		{name: "expired lease of another replica", labels: map[string]string{retentionHolderLabel: "adapter-1", retentionLeaseLabel: past}, leader: true},
+		{name: "taken concurrently", updateErr: &googleapi.Error{Code: http.StatusPreconditionFailed}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Labels: tc.labels}, updateErr: tc.updateErr}
+			c, statements := newRetentionTestClient(admin, true)
+
+			assert.NoError(t, c.enforceRetention(context.Background()))
+			if tc.leader {
+				assert.Len(t, statements.runs, 1)
+			} else {
+				assert.Empty(t, statements.runs)
+				assert.Zero(t, metricValue(c.retentionLastRun))
+			}
+		})
+	}
+}
+
+func TestRetentionHolderID(t *testing.T) {
+	id := retentionHolderID()
+	assert.NotEmpty(t, id)
+	assert.LessOrEqual(t, len(id), 63)
+	assert.Regexp(t, `^[a-z0-9_-]+$`, id)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route writes the samples of the metrics whose name matches Metric to another table
+// of the project of the client. The table needs the same schema as the table of the client.
+type Route struct {
+	// Metric is matched against the metric name, it must be anchored to match the whole name.
+	Metric *regexp.Regexp
+	// DatasetID defaults to the dataset of the client.
+	DatasetID string
+	TableID   string
+}
+
+// destination is a table rows are written to and read from.
+type destination struct {
+	datasetID string
+	tableID   string
+	// inserter writes rows to the table, it is nil for the table of the client, which
+	// uses the inserter of the client.
+	inserter Inserter
+	// shard is set for the shards of date sharding, which are created on their first
+	// insert once createMu was locked.
+	shard    bool
+	createMu sync.Mutex
+	created  bool
+}
+
+func (d *destination) name() string {
+	return d.datasetID + "." + d.tableID
+}
+
+// route is a Route with its destination, which is shared by all routes to the same table.
+type route struct {
+	metric *regexp.Regexp
+	dest   *destination
+}
+
+// WithRoutes writes the samples of a metric to the table of the first route matching its
+// name, and the samples of all other metrics to the table of the client. Reads query all
+// of these tables and merge their results, so series written before a route was added
+// or changed are still read.
+func WithRoutes(routes []Route) Option {
+	return func(c *BigqueryClient) {
+		c.routeSpecs = routes
+	}
+}
+
+// setupRoutes creates the destinations of the routes, with one destination per table.
+func (c *BigqueryClient) setupRoutes() {
+	c.defaultDestination = &destination{datasetID: c.datasetID, tableID: c.tableID}
+	c.destinations = []*destination{c.defaultDestination}
+	for _, spec := range c.routeSpecs {
+		datasetID := spec.DatasetID
+		if datasetID == "" {
+			datasetID = c.datasetID
+		}
+		var dest *destination
+		for _, d := range c.destinations {
+			if d.datasetID == datasetID && d.tableID == spec.TableID {
+				dest = d
+				break
+			}
+		}
+		if dest == nil {
+			dest = &destination{datasetID: datasetID, tableID: spec.TableID}
+			c.destinations = append(c.destinations, dest)
+		}
+		c.routes = append(c.routes, route{metric: spec.Metric, dest: dest})
+	}
+}
+
+// destinationFor returns the destination of the rows of the metric.
+func (c *BigqueryClient) destinationFor(metricname string) *destination {
+	for _, r := range c.routes {
+		if r.metric.MatchString(metricname) {
+			return r.dest
+		}
+	}
+	return c.defaultDestination
+}
+
+// routeBatch groups the rows of the batch by their destination, in the order of the
+// destinations, followed by the template tables in the order of their first row.
+func (c *BigqueryClient) routeBatch(batch []*Item) ([]*destination, [][]*Item) {
+	if len(c.routes) == 0 && c.templateSuffix == nil && !c.dateSharding {
+		return []*destination{c.defaultDestination}, [][]*Item{batch}
+	}
+	// The rows of a series are adjacent, so the destination is only looked up once per series.
+	rows := make(map[*destination][]*Item, len(c.destinations))
+	var suffixed []*destination
+	var last, lastSuffix string
+	var dest *destination
+	for i, item := range batch {
+		if i == 0 || item.metricname != last || item.suffix != lastSuffix {
+			last, lastSuffix = item.metricname, item.suffix
+			dest = c.suffixed(c.destinationFor(item.metricname), item.suffix)
+			if item.suffix != "" && rows[dest] == nil {
+				suffixed = append(suffixed, dest)
+			}
+		}
+		rows[dest] = append(rows[dest], item)
+	}
+	dests := make([]*destination, 0, len(rows))
+	groups := make([][]*Item, 0, len(rows))
+	for _, d := range append(slices.Clip(c.destinations), suffixed...) {
+		if len(rows[d]) > 0 {
+			dests = append(dests, d)
+			groups = append(groups, rows[d])
+		}
+	}
+	return dests, groups
+}
+
+// tableSQL returns the table read queries select from, which combines all destinations
+// when there are routes, unless reads are overridden to select from another table.
+func (c *BigqueryClient) tableSQL() string {
+	if c.readTableID != "" {
+		return c.tableRef(c.readDatasetID, c.readTableID)
+	}
+	if len(c.destinations) <= 1 {
+		return c.templateTableSQL(c.datasetID, c.tableID)
+	}
+	selects := make([]string, 0, len(c.destinations))
+	for _, d := range c.destinations {
+		sel := fmt.Sprintf("SELECT metricname, %s, timestamp, %s FROM %s", c.tagsColumn(), c.sampleColumnsSQL(), c.templateTableSQL(d.datasetID, d.tableID))
+		if tableConditions := c.tableConditions(); len(tableConditions) > 0 {
+			sel += " WHERE " + strings.Join(tableConditions, " AND ")
+		}
+		selects = append(selects, sel)
+	}
+	return "(" + strings.Join(selects, " UNION ALL ") + ")"
+}
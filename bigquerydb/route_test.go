@@ -0,0 +1,143 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRoutes sends histogram buckets to a short-retention table, and all other metrics
+// starting with http_ as well as the bucket of http_requests to an http table.
+func testRoutes() []Route {
+	return []Route{
+		{Metric: regexp.MustCompile(`^http_requests_bucket$`), TableID: "http"},
+		{Metric: regexp.MustCompile(`^.*_bucket$`), DatasetID: "short", TableID: "buckets"},
+		{Metric: regexp.MustCompile(`^http_.*$`), TableID: "http"},
+	}
+}
+
+func TestDestinationFor(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithRoutes(testRoutes()))
+
+	for metric, expected := range map[string]string{
+		"http_requests_bucket": "dataset.http",
+		"latency_bucket":       "short.buckets",
+		"http_requests_total":  "dataset.http",
+		"up":                   "dataset.table",
+		"bucket":               "dataset.table",
+	} {
+		assert.Equal(t, expected, c.destinationFor(metric).name(), metric)
+	}
+	assert.Len(t, c.destinations, 3, "routes to the same table share the destination")
+}
+
+func TestWriteRoutes(t *testing.T) {
+	primary, http, buckets := &fakeInserter{}, &fakeInserter{}, &fakeInserter{}
+	c := newTestClient(primary, WithRoutes(testRoutes()))
+	c.destinations[1].inserter = http
+	c.destinations[2].inserter = buckets
+
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "latency_bucket"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}}},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "http_requests_bucket"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 3}}},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "http_requests_total"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 4}}},
+	}))
+
+	metricnames := func(ins *fakeInserter) []string {
+		var names []string
+		for _, item := range ins.rows() {
+			names = append(names, item.metricname)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"up"}, metricnames(primary))
+	assert.Equal(t, []string{"http_requests_bucket", "http_requests_total"}, metricnames(http))
+	assert.Equal(t, []string{"latency_bucket", "latency_bucket"}, metricnames(buckets))
+	assert.Len(t, http.puts, 1, "one insert per table")
+	assert.Equal(t, 2.0, metricValue(c.tableSentSamples.WithLabelValues("short.buckets")))
+	assert.Equal(t, 1.0, metricValue(c.tableSentSamples.WithLabelValues("dataset.table")))
+}
+
+func TestWriteRoutesFailure(t *testing.T) {
+	failing := &fakeInserter{err: errors.New("table not found")}
+	c := newTestClient(&fakeInserter{}, WithRoutes(testRoutes()))
+	c.destinations[1].inserter = &fakeInserter{}
+	c.destinations[2].inserter = failing
+
+	err := c.Write(context.Background(), []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "latency_bucket"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}}},
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}}, Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}}},
+	})
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 1, writeErr.FailedSamples, "only the samples of the failed table are lost")
+	}
+	assert.Equal(t, 1.0, metricValue(c.tableFailedSamples.WithLabelValues("short.buckets")))
+	assert.Equal(t, 1.0, metricValue(c.tableSentSamples.WithLabelValues("dataset.table")))
+}
+
+func TestReadRoutes(t *testing.T) {
+	// The same series was written to the primary table before the route was added.
+	querier := &fakeQuerier{rows: []map[string]bigquery.Value{
+		testRow("latency_bucket", `{"le":"1"}`, 1000, 1),
+		testRow("latency_bucket", `{"le":"1"}`, 2000, 2),
+		testRow("latency_bucket", `{"le":"1"}`, 2000, 2),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithRoutes(testRoutes()))
+
+	resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "latency_bucket"}},
+	}}})
+	assert.NoError(t, err)
+	if assert.Len(t, querier.queries, 1) {
+		assert.Equal(t, "SELECT metricname, tags, UNIX_MILLIS(timestamp) as timestamp, value FROM ("+
+			"SELECT metricname, tags, timestamp, value FROM `dataset.table` UNION ALL "+
+			"SELECT metricname, tags, timestamp, value FROM `dataset.http` UNION ALL "+
+			"SELECT metricname, tags, timestamp, value FROM `short.buckets`) "+
+			"WHERE metricname = @m0 AND timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) ORDER BY timestamp",
+			querier.queries[0].Q)
+	}
+	assert.Equal(t, []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "latency_bucket"}, {Name: "le", Value: "1"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}},
+	}}, resp.Results[0].Timeseries, "the rows of all tables are merged")
+}
+
+func TestTableSQL(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.Equal(t, "`dataset.table`", c.tableSQL())
+
+	c = newTestClient(&fakeInserter{}, WithTagsType(TagsTypeLabels), WithRoutes([]Route{{Metric: regexp.MustCompile(`^up$`), TableID: "up"}}))
+	assert.Equal(t, "(SELECT metricname, labels, timestamp, value FROM `dataset.table` UNION ALL SELECT metricname, labels, timestamp, value FROM `dataset.up`)", c.tableSQL())
+}
+
+func TestTableSQLDataProject(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithDataProject("analytics"))
+	assert.Equal(t, "`analytics.dataset.table`", c.tableSQL())
+
+	c = newTestClient(&fakeInserter{}, WithDataProject("analytics"), WithRoutes([]Route{{Metric: regexp.MustCompile(`^up$`), DatasetID: "other", TableID: "up"}}))
+	assert.Equal(t, "(SELECT metricname, tags, timestamp, value FROM `analytics.dataset.table` UNION ALL SELECT metricname, tags, timestamp, value FROM `analytics.other.up`)", c.tableSQL())
+}
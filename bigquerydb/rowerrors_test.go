@@ -0,0 +1,227 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func syntheticPutMultiError(rows int, reason string) bigquery.PutMultiError {
+	multiError := make(bigquery.PutMultiError, 0, rows)
+	for i := 0; i < rows; i++ {
+		multiError = append(multiError, bigquery.RowInsertionError{
+			RowIndex: i,
+			Errors:   bigquery.MultiError{&bigquery.Error{Reason: reason, Location: "value", Message: "no such field"}},
+		})
+	}
+	return multiError
+}
+
+func TestInsertRowErrorsLogging(t *testing.T) {
+	testCases := map[string]struct {
+		rows          int
+		maxLogged     int
+		expectedLines int
+		summary       bool
+	}{
+		"under_cap": {rows: 3, maxLogged: 10, expectedLines: 3},
+		"at_cap":    {rows: 10, maxLogged: 10, expectedLines: 10},
+		"over_cap":  {rows: 25, maxLogged: 10, expectedLines: 11, summary: true},
+		"no_rows":   {rows: 25, maxLogged: 0, expectedLines: 1, summary: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			ins := &fakeInserter{err: syntheticPutMultiError(testCase.rows, "invalid")}
+			c := newTestClient(ins, WithMaxLoggedRowErrors(testCase.maxLogged))
+			c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+			assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", testCase.rows)), "invalid rows are dropped")
+
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			assert.Len(t, lines, testCase.expectedLines)
+			if testCase.maxLogged > 0 {
+				assert.Contains(t, lines[0], "row_index=0")
+				assert.Contains(t, lines[0], "metricname=up")
+				assert.Contains(t, lines[0], "reason=invalid")
+				assert.Contains(t, lines[0], "location=value")
+			}
+			if testCase.summary {
+				assert.Contains(t, lines[len(lines)-1], "count=")
+			}
+			assert.Equal(t, float64(testCase.rows), metricValue(c.insertRowErrors.WithLabelValues("invalid")))
+		})
+	}
+}
+
+func TestInsertRowErrorsReasons(t *testing.T) {
+	multiError := append(syntheticPutMultiError(2, "invalid"), syntheticPutMultiError(1, "stopped")...)
+	multiError = append(multiError, bigquery.RowInsertionError{RowIndex: 5})
+	ins := &fakeInserter{err: multiError}
+	c := newTestClient(ins)
+
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 6)))
+	assert.Equal(t, 2.0, metricValue(c.insertRowErrors.WithLabelValues("invalid")))
+	assert.Equal(t, 1.0, metricValue(c.insertRowErrors.WithLabelValues("stopped")))
+	assert.Equal(t, 1.0, metricValue(c.insertRowErrors.WithLabelValues("unknown")))
+	assert.Equal(t, 2.0, metricValue(c.insertErrors.WithLabelValues("invalid")))
+	assert.Equal(t, 2.0, metricValue(c.insertErrors.WithLabelValues("other")))
+}
+
+func TestInsertErrorsWholeBatch(t *testing.T) {
+	ins := &fakeInserter{err: &googleapi.Error{Code: http.StatusServiceUnavailable}}
+	c := newTestClient(ins)
+
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	assert.Equal(t, 1.0, metricValue(c.insertErrors.WithLabelValues("backendError")))
+	assert.Zero(t, metricValue(c.insertRowErrors.WithLabelValues("unknown")))
+}
+
+func TestInserterOptions(t *testing.T) {
+	c, err := NewClient(nil, "", "project", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"))
+	assert.NoError(t, err)
+	inserter, ok := c.inserter.(*tableInserter)
+	if assert.True(t, ok) {
+		assert.True(t, inserter.skipInvalidRows)
+		assert.False(t, inserter.ignoreUnknownValues)
+	}
+
+	c, err = NewClient(nil, "", "project", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"),
+		WithSkipInvalidRows(false), WithIgnoreUnknownValues(true), WithRoutes([]Route{{Metric: regexp.MustCompile("^up$"), TableID: "archive"}}))
+	assert.NoError(t, err)
+	for _, inserter := range []Inserter{c.inserter, c.destinations[1].inserter} {
+		inserter, ok := inserter.(*tableInserter)
+		if assert.True(t, ok) {
+			assert.False(t, inserter.skipInvalidRows)
+			assert.True(t, inserter.ignoreUnknownValues)
+		}
+	}
+}
+
+func TestInsertRowErrorsWithoutSkipInvalidRows(t *testing.T) {
+	// Without skipping invalid rows, BigQuery reports the valid rows of the insert as stopped.
+	multiError := append(syntheticPutMultiError(1, "invalid"), syntheticPutMultiError(2, "stopped")[1:]...)
+	ins := &fakeInserter{err: multiError}
+	c := newTestClient(ins, WithSkipInvalidRows(false))
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 2))
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 1, writeErr.FailedSamples, "the invalid row is dropped, the stopped one fails")
+	}
+	assert.Equal(t, 1.0, metricValue(c.insertRowErrors.WithLabelValues("invalid")))
+	assert.Equal(t, 1.0, metricValue(c.insertRowErrors.WithLabelValues("stopped")))
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("rejected_invalid")))
+}
+
+// scriptedInserter fails its calls with the given errors in order and records the rows of every call.
+type scriptedInserter struct {
+	mu    sync.Mutex
+	errs  []error
+	calls [][]*Item
+}
+
+func (s *scriptedInserter) Put(_ context.Context, src interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, src.([]*Item))
+	if len(s.calls) <= len(s.errs) {
+		return s.errs[len(s.calls)-1]
+	}
+	return nil
+}
+
+// rowError returns a PutMultiError of the rows with the given reasons by row index.
+func rowError(reasons map[int]string) bigquery.PutMultiError {
+	var multiError bigquery.PutMultiError
+	for index, reason := range reasons {
+		multiError = append(multiError, bigquery.RowInsertionError{
+			RowIndex: index,
+			Errors:   bigquery.MultiError{&bigquery.Error{Reason: reason}},
+		})
+	}
+	return multiError
+}
+
+func TestInsertRetriesFailedRows(t *testing.T) {
+	ins := &scriptedInserter{errs: []error{rowError(map[int]string{1: "invalid", 3: "backendError", 4: "stopped"})}}
+	c := newTestClient(ins, WithRowRetries(2, time.Millisecond))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	if assert.Len(t, ins.calls, 2) {
+		retried := ins.calls[1]
+		if assert.Len(t, retried, 2, "only the failed rows are retried") {
+			assert.Equal(t, ins.calls[0][3], retried[0])
+			assert.Equal(t, ins.calls[0][4], retried[1])
+		}
+	}
+	assert.Equal(t, 4.0, metricValue(c.writtenRows))
+	assert.Equal(t, 4.0, metricValue(c.tableSentSamples.WithLabelValues("dataset.table")))
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("rejected_invalid")))
+	assert.Equal(t, 2.0, metricValue(c.retriedRows))
+}
+
+func TestInsertRowRetriesExhausted(t *testing.T) {
+	failing := rowError(map[int]string{0: "backendError"})
+	ins := &scriptedInserter{errs: []error{rowError(map[int]string{0: "backendError", 2: "invalid"}), failing, failing}}
+	c := newTestClient(ins, WithRowRetries(1, time.Millisecond))
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 3))
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 1, writeErr.FailedSamples, "the written and the dropped rows don't count as failed")
+	}
+	assert.Len(t, ins.calls, 2)
+	assert.Equal(t, 1.0, metricValue(c.tableSentSamples.WithLabelValues("dataset.table")))
+	assert.Equal(t, 1.0, metricValue(c.tableFailedSamples.WithLabelValues("dataset.table")))
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("rejected_invalid")))
+}
+
+func TestInsertWithoutRowRetries(t *testing.T) {
+	ins := &scriptedInserter{errs: []error{rowError(map[int]string{1: "backendError"})}}
+	c := newTestClient(ins)
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 2))
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 1, writeErr.FailedSamples)
+	}
+	assert.Len(t, ins.calls, 1)
+	assert.Equal(t, 1.0, metricValue(c.writtenRows), "the other row is written")
+}
+
+func TestInsertRowRetryCancelled(t *testing.T) {
+	ins := &scriptedInserter{errs: []error{rowError(map[int]string{0: "backendError"})}}
+	c := newTestClient(ins, WithRowRetries(3, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, c.Write(ctx, seriesWithSamples("up", 1)))
+	assert.Len(t, ins.calls, 1, "the backoff ends with the request")
+}
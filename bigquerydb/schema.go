@@ -0,0 +1,301 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// requiredColumn is a column the adapter writes and reads.
+type requiredColumn struct {
+	name     string
+	typ      bigquery.FieldType
+	repeated bool
+	// fields are the required fields of a RECORD column.
+	fields []requiredColumn
+	// defaultValue is the default value expression of the column in created tables.
+	defaultValue string
+}
+
+// requiredColumns returns the columns the adapter writes and reads, with their types.
+func (c *BigqueryClient) requiredColumns() []requiredColumn {
+	tags := requiredColumn{name: "tags", typ: bigquery.StringFieldType}
+	switch c.tagsType {
+	case TagsTypeJSON:
+		tags.typ = bigquery.JSONFieldType
+	case TagsTypeLabels:
+		tags = requiredColumn{name: "labels", typ: bigquery.RecordFieldType, repeated: true, fields: []requiredColumn{
+			{name: "name", typ: bigquery.StringFieldType},
+			{name: "value", typ: bigquery.StringFieldType},
+		}}
+	}
+	timestamp := requiredColumn{name: "timestamp", typ: bigquery.TimestampFieldType}
+	if c.timestampMillis() {
+		timestamp.typ = bigquery.IntegerFieldType
+	}
+	columns := []requiredColumn{
+		{name: "metricname", typ: bigquery.StringFieldType},
+		tags,
+		timestamp,
+		{name: "value", typ: bigquery.FloatFieldType},
+	}
+	if c.specialValues {
+		columns = append(columns, requiredColumn{name: specialValueColumn, typ: bigquery.StringFieldType})
+	}
+	if c.seriesHash {
+		columns = append(columns, requiredColumn{name: seriesHashColumn, typ: bigquery.IntegerFieldType})
+	}
+	if c.insertTime {
+		columns = append(columns, requiredColumn{name: insertTimeColumn, typ: bigquery.TimestampFieldType, defaultValue: "CURRENT_TIMESTAMP()"})
+	}
+	return columns
+}
+
+// SchemaError is returned by ValidateSchema when the table doesn't match the schema the
+// adapter needs. Every mismatch describes a single column.
+type SchemaError struct {
+	Table      string
+	Mismatches []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("schema of table %s doesn't match: %s", e.Table, strings.Join(e.Mismatches, "; "))
+}
+
+// ValidateSchema checks that the table exists and has the columns the adapter writes and
+// reads, with compatible types and modes, and that a time partitioned table is partitioned
+// as configured. It fails with a SchemaError on mismatches. Extra nullable columns and a
+// table that isn't partitioned or clustered on the columns read by queries only log a warning.
+func (c *BigqueryClient) ValidateSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	table := c.tableName(c.datasetID, c.tableID)
+	md, err := c.tableAdmin.Metadata(ctx)
+	if isHTTPError(err, http.StatusNotFound) {
+		return errors.Errorf("table %s doesn't exist, create it with the schema in bq-schema.json", table)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", table)
+	}
+
+	mismatches, extra := checkColumns("", c.requiredColumns(), md.Schema)
+	for _, field := range extra {
+		if !field.Required {
+			c.logger.Warn("table has a column the adapter doesn't use", slog.String("table", table), slog.String("column", field.Name), slog.String("type", sqlTypeName(field.Type)))
+		}
+	}
+	if len(mismatches) > 0 {
+		return &SchemaError{Table: table, Mismatches: mismatches}
+	}
+
+	if md.TimePartitioning != nil && !c.dateSharding {
+		if mismatch := c.checkPartitioning(md.TimePartitioning); mismatch != "" {
+			return &SchemaError{Table: table, Mismatches: []string{mismatch}}
+		}
+	}
+	switch {
+	case c.partitioning == PartitioningIngestion && md.TimePartitioning == nil:
+		c.logger.Warn("table isn't partitioned by ingestion time, every read scans the whole table", slog.String("table", table))
+	case c.partitioning == PartitioningIngestion:
+		// Partitioned by ingestion time as configured.
+	case c.timestampMillis() && md.RangePartitioning == nil:
+		c.logger.Warn("table isn't partitioned by range, every read scans the whole table", slog.String("table", table))
+	case c.timestampMillis() && md.RangePartitioning.Field != "timestamp":
+		c.logger.Warn("table isn't partitioned by the timestamp column, reads can't skip partitions outside of their time range", slog.String("table", table))
+	case c.timestampMillis():
+		// Partitioned by integer ranges of the timestamp column.
+	case md.TimePartitioning == nil:
+		c.logger.Warn("table isn't partitioned by time, every read scans the whole table", slog.String("table", table))
+	}
+	switch {
+	case md.Clustering == nil || len(md.Clustering.Fields) == 0:
+		c.logger.Warn("table isn't clustered, clustering on metricname reduces the bytes scanned by reads", slog.String("table", table))
+	case md.Clustering.Fields[0] != "metricname":
+		c.logger.Warn("table isn't clustered on metricname first, reads for a metric name can't skip the blocks of other metrics",
+			slog.String("table", table), slog.Any("clustering", md.Clustering.Fields))
+	default:
+		c.logger.Info("table is clustered on metricname", slog.String("table", table), slog.Any("clustering", md.Clustering.Fields))
+	}
+	return nil
+}
+
+// createTableIfMissing creates the table with the columns the adapter writes and reads
+// if it doesn't exist. The table is partitioned as configured, by day on the timestamp
+// column by default, with the retention as partition expiration if it is enforced, and
+// clustered on metricname, so reads only scan the partitions of their time range and the
+// blocks of their metric names.
+// A timestamp column of milliseconds is partitioned by integer ranges of a day instead,
+// which have no expiration. The shards of date sharding aren't partitioned.
+func (c *BigqueryClient) createTableIfMissing(ctx context.Context) error {
+	datasetID, tableID := c.datasetID, c.tableID
+	if c.dateSharding {
+		tableID += shardSuffix(time.Now())
+	}
+	return c.createMissingTable(ctx, c.tableAdmin, datasetID, tableID)
+}
+
+// createMissingTable creates the table of the admin like createTableIfMissing.
+func (c *BigqueryClient) createMissingTable(ctx context.Context, admin TableAdmin, datasetID, tableID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	table := c.tableName(datasetID, tableID)
+	_, err := admin.Metadata(ctx)
+	if err == nil {
+		return nil
+	}
+	if !isHTTPError(err, http.StatusNotFound) {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", table)
+	}
+
+	columns := c.requiredColumns()
+	schema := make(bigquery.Schema, 0, len(columns))
+	for _, column := range columns {
+		schema = append(schema, column.fieldSchema())
+	}
+	md := &bigquery.TableMetadata{
+		Schema:     schema,
+		Clustering: &bigquery.Clustering{Fields: []string{"metricname"}},
+	}
+	partitioning := "none"
+	switch {
+	case c.dateSharding:
+	case c.timePartitioning() == nil:
+		md.RangePartitioning = millisRangePartitioning()
+		partitioning = "timestamp ranges"
+	default:
+		md.TimePartitioning = c.timePartitioning()
+		partitioning = describePartitioning(md.TimePartitioning)
+	}
+	err = admin.Create(ctx, md)
+	// Another replica may have created the table in the meantime.
+	if isHTTPError(err, http.StatusConflict) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to create table %s", table)
+	}
+	c.logger.Info("created table", slog.String("table", table), slog.String("partitioning", partitioning), slog.String("clustering", "metricname"))
+	return nil
+}
+
+// isHTTPError returns whether the error is an error of the BigQuery API with the status code.
+func isHTTPError(err error, code int) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// checkColumns compares the fields of the schema with the required columns, including the
+// fields of RECORD columns, whose names get the prefix. It returns the mismatches and the
+// fields which aren't required.
+func checkColumns(prefix string, required []requiredColumn, schema bigquery.Schema) ([]string, []*bigquery.FieldSchema) {
+	columns := make(map[string]*bigquery.FieldSchema, len(schema))
+	for _, field := range schema {
+		columns[field.Name] = field
+	}
+	var mismatches []string
+	for _, column := range required {
+		name := prefix + column.name
+		field, ok := columns[column.name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("column %s: missing, expected %s", name, column.typeName()))
+			continue
+		}
+		delete(columns, column.name)
+		if field.Type != column.typ {
+			mismatches = append(mismatches, fmt.Sprintf("column %s: expected %s, found %s", name, sqlTypeName(column.typ), sqlTypeName(field.Type)))
+		}
+		switch {
+		case column.repeated && !field.Repeated:
+			mismatches = append(mismatches, fmt.Sprintf("column %s: expected mode REPEATED, found %s", name, fieldMode(field)))
+		case !column.repeated && field.Repeated:
+			mismatches = append(mismatches, fmt.Sprintf("column %s: expected mode NULLABLE or REQUIRED, found REPEATED", name))
+		}
+		if field.Type == column.typ && len(column.fields) > 0 {
+			nested, _ := checkColumns(name+".", column.fields, field.Schema)
+			mismatches = append(mismatches, nested...)
+		}
+	}
+
+	var extra []*bigquery.FieldSchema
+	for _, field := range schema {
+		if _, ok := columns[field.Name]; !ok {
+			continue
+		}
+		if field.Required {
+			mismatches = append(mismatches, fmt.Sprintf("column %s%s: the adapter doesn't write it, so it must not be REQUIRED", prefix, field.Name))
+		}
+		extra = append(extra, field)
+	}
+	return mismatches, extra
+}
+
+// fieldSchema returns the schema of the column for creating a table.
+func (c requiredColumn) fieldSchema() *bigquery.FieldSchema {
+	field := &bigquery.FieldSchema{Name: c.name, Type: c.typ, Repeated: c.repeated, DefaultValueExpression: c.defaultValue}
+	for _, nested := range c.fields {
+		field.Schema = append(field.Schema, nested.fieldSchema())
+	}
+	return field
+}
+
+// typeName returns the GoogleSQL type of the column.
+func (c requiredColumn) typeName() string {
+	name := sqlTypeName(c.typ)
+	if len(c.fields) > 0 {
+		fields := make([]string, 0, len(c.fields))
+		for _, field := range c.fields {
+			fields = append(fields, field.name+" "+field.typeName())
+		}
+		name = "STRUCT<" + strings.Join(fields, ", ") + ">"
+	}
+	if c.repeated {
+		name = "ARRAY<" + name + ">"
+	}
+	return name
+}
+
+// fieldMode returns the mode of the field.
+func fieldMode(field *bigquery.FieldSchema) string {
+	switch {
+	case field.Repeated:
+		return "REPEATED"
+	case field.Required:
+		return "REQUIRED"
+	}
+	return "NULLABLE"
+}
+
+// sqlTypeName returns the GoogleSQL name of a field type.
+func sqlTypeName(typ bigquery.FieldType) string {
+	switch typ {
+	case bigquery.FloatFieldType:
+		return "FLOAT64"
+	case bigquery.IntegerFieldType:
+		return "INT64"
+	case bigquery.BooleanFieldType:
+		return "BOOL"
+	case bigquery.RecordFieldType:
+		return "STRUCT"
+	}
+	return string(typ)
+}
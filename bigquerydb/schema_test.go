@@ -0,0 +1,144 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func adapterSchema() bigquery.Schema {
+	return bigquery.Schema{
+		{Name: "metricname", Type: bigquery.StringFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType, Required: true},
+		{Name: "value", Type: bigquery.FloatFieldType},
+	}
+}
+
+// validateTestSchema validates the metadata and returns the warnings logged and the error.
+func validateTestSchema(admin *fakeTableAdmin) (string, error) {
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin))
+	var logs bytes.Buffer
+	c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	err := c.ValidateSchema(context.Background())
+	return logs.String(), err
+}
+
+func TestValidateSchema(t *testing.T) {
+	logs, err := validateTestSchema(&fakeTableAdmin{md: &bigquery.TableMetadata{
+		Schema:           adapterSchema(),
+		TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"},
+		Clustering:       &bigquery.Clustering{Fields: []string{"metricname"}},
+	}})
+	assert.NoError(t, err)
+	assert.Contains(t, logs, "table is clustered on metricname")
+	assert.NotContains(t, logs, "level=WARN")
+}
+
+func TestValidateSchemaWarnings(t *testing.T) {
+	schema := append(adapterSchema(), &bigquery.FieldSchema{Name: "comment", Type: bigquery.StringFieldType})
+	logs, err := validateTestSchema(&fakeTableAdmin{md: &bigquery.TableMetadata{Schema: schema}})
+	assert.NoError(t, err)
+	assert.Contains(t, logs, "column=comment")
+	assert.Contains(t, logs, "table isn't partitioned by time")
+	assert.Contains(t, logs, "table isn't clustered")
+
+	logs, err = validateTestSchema(&fakeTableAdmin{md: &bigquery.TableMetadata{
+		Schema:     adapterSchema(),
+		Clustering: &bigquery.Clustering{Fields: []string{"tags", "metricname"}},
+	}})
+	assert.NoError(t, err)
+	assert.Contains(t, logs, "table isn't clustered on metricname first")
+}
+
+func TestValidateSchemaMismatch(t *testing.T) {
+	schema := adapterSchema()
+	schema[1].Repeated = true
+	schema[2].Type = bigquery.IntegerFieldType
+	schema[3].Type = bigquery.StringFieldType
+	schema = append(schema[1:], &bigquery.FieldSchema{Name: "host", Type: bigquery.StringFieldType, Required: true})
+
+	_, err := validateTestSchema(&fakeTableAdmin{md: &bigquery.TableMetadata{Schema: schema}})
+	var schemaErr *SchemaError
+	if assert.ErrorAs(t, err, &schemaErr) {
+		assert.Equal(t, "dataset.table", schemaErr.Table)
+		assert.Equal(t, []string{
+			"column metricname: missing, expected STRING",
+			"column tags: expected mode NULLABLE or REQUIRED, found REPEATED",
+			"column timestamp: expected TIMESTAMP, found INT64",
+			"column value: expected FLOAT64, found STRING",
+			"column host: the adapter doesn't write it, so it must not be REQUIRED",
+		}, schemaErr.Mismatches)
+	}
+}
+
+func TestValidateSchemaMissingTable(t *testing.T) {
+	_, err := validateTestSchema(&fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}})
+	assert.ErrorContains(t, err, "table dataset.table doesn't exist")
+
+	_, err = validateTestSchema(&fakeTableAdmin{metadataErr: errors.New("permission denied")})
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestCreateTableIfMissing(t *testing.T) {
+	admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithRetention(30*24*time.Hour, time.Hour, true))
+
+	assert.NoError(t, c.createTableIfMissing(context.Background()))
+	assert.Equal(t, &bigquery.TableMetadata{
+		Schema: bigquery.Schema{
+			{Name: "metricname", Type: bigquery.StringFieldType},
+			{Name: "tags", Type: bigquery.StringFieldType},
+			{Name: "timestamp", Type: bigquery.TimestampFieldType},
+			{Name: "value", Type: bigquery.FloatFieldType},
+		},
+		TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "timestamp", Expiration: 30 * 24 * time.Hour},
+		Clustering:       &bigquery.Clustering{Fields: []string{"metricname"}},
+	}, admin.created)
+
+	admin = &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c = newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTagsType(TagsTypeLabels))
+	assert.NoError(t, c.createTableIfMissing(context.Background()))
+	if assert.NotNil(t, admin.created) {
+		assert.Equal(t, labelsSchema()[1], admin.created.Schema[1])
+	}
+}
+
+func TestCreateTableIfMissingExisting(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: adapterSchema()}}
+	assert.NoError(t, newTestClient(&fakeInserter{}, WithTableAdmin(admin)).createTableIfMissing(context.Background()))
+	assert.Nil(t, admin.created)
+
+	admin = &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}, createErr: &googleapi.Error{Code: http.StatusConflict}}
+	assert.NoError(t, newTestClient(&fakeInserter{}, WithTableAdmin(admin)).createTableIfMissing(context.Background()),
+		"a table created concurrently is fine")
+
+	admin = &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}, createErr: &googleapi.Error{Code: http.StatusForbidden}}
+	assert.ErrorContains(t, newTestClient(&fakeInserter{}, WithTableAdmin(admin)).createTableIfMissing(context.Background()), "failed to create table dataset.table")
+
+	admin = &fakeTableAdmin{metadataErr: errors.New("permission denied")}
+	assert.ErrorContains(t, newTestClient(&fakeInserter{}, WithTableAdmin(admin)).createTableIfMissing(context.Background()), "permission denied")
+}
@@ -0,0 +1,315 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"encoding/json"
+	"hash/maphash"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesSeed is the seed of the fingerprints of the labels of series.
+var seriesSeed = maphash.MakeSeed()
+
+// convertedSeries is what the rows of a series share: the metric name, the tags and the
+// labels, which are only set when the labels column is used.
+type convertedSeries struct {
+	// raw are the labels the series was converted from.
+	raw    []*prompb.Label
+	name   string
+	tags   string
+	labels []itemLabel
+	// oversized marks series whose rows exceed the maximum row size, dropped the ones
+	// which don't fit even after truncating their label values.
+	oversized bool
+	dropped   bool
+	// droppedLabels is the number of labels removed by the configured label drops.
+	droppedLabels int
+	// hash is the fingerprint of the labels if the series hash column is written.
+	hash model.Fingerprint
+}
+
+// seriesSample identifies a sample of a converted series.
+type seriesSample struct {
+	name      string
+	tags      string
+	timestamp int64
+}
+
+// seriesConverter converts the labels of the series of a write request. Prometheus sends
+// every sample as a timeseries of its own, so the same series is usually sent several
+// times within a request and its conversion is cached by the fingerprint of its labels.
+type seriesConverter struct {
+	client *BigqueryClient
+	tenant string
+	buf    []prompb.Label
+	merged []prompb.Label
+	cache  map[uint64]*convertedSeries
+}
+
+// WithStaticLabels adds the labels to every written series. Labels of the series take
+// precedence over static labels with the same name, unless override is set. The label
+// names have to be valid and must not be reserved, i.e. start with two underscores.
+func WithStaticLabels(labels map[string]string, override bool) Option {
+	return func(c *BigqueryClient) {
+		c.staticLabels = make([]prompb.Label, 0, len(labels))
+		for name, value := range labels {
+			c.staticLabels = append(c.staticLabels, prompb.Label{Name: name, Value: value})
+		}
+		sort.Slice(c.staticLabels, func(i, j int) bool { return c.staticLabels[i].Name < c.staticLabels[j].Name })
+		c.staticLabelOverride = override
+	}
+}
+
+func (c *BigqueryClient) newSeriesConverter(tenant string, series int) *seriesConverter {
+	return &seriesConverter{
+		client: c,
+		tenant: tenant,
+		cache:  make(map[uint64]*convertedSeries, series),
+	}
+}
+
+// convert returns the conversion of the labels of the timeseries.
+func (sc *seriesConverter) convert(ts *prompb.TimeSeries) *convertedSeries {
+	fingerprint := seriesFingerprint(ts.Labels)
+	cached, ok := sc.cache[fingerprint]
+	if ok && sameLabels(cached.raw, ts.Labels) {
+		return cached
+	}
+	s := sc.convertLabels(ts)
+	// Of series with colliding fingerprints, only the first one is cached.
+	if !ok {
+		sc.cache[fingerprint] = s
+	}
+	return s
+}
+
+func (sc *seriesConverter) convertLabels(ts *prompb.TimeSeries) *convertedSeries {
+	c := sc.client
+	sc.buf = seriesLabels(sc.buf, ts.Labels, sc.tenant)
+	dropped := 0
+	if c.dropsLabels() {
+		sc.buf, dropped = c.dropLabels(sc.buf, sc.tenant)
+	}
+	// Static labels are added after dropping labels, so that they are never dropped.
+	if len(c.staticLabels) > 0 {
+		sc.merged = mergeStaticLabels(sc.merged, sc.buf, c.staticLabels, c.staticLabelOverride)
+		sc.buf, sc.merged = sc.merged, sc.buf
+	}
+	s := &convertedSeries{raw: ts.Labels, tags: tagsFromLabels(sc.buf), droppedLabels: dropped}
+	for _, l := range sc.buf {
+		if l.Name == model.MetricNameLabel {
+			s.name = l.Value
+			break
+		}
+	}
+
+	if c.maxRowSize > 0 && rowSize(s.name, s.tags) > c.maxRowSize {
+		s.oversized = true
+		metric := make(model.Metric, len(sc.buf))
+		for _, l := range sc.buf {
+			metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		}
+		var fits bool
+		if s.tags, fits = c.fitRowSize(metric, s.tags); !fits {
+			s.dropped = true
+			return s
+		}
+		if c.seriesHash {
+			s.hash = metric.Fingerprint()
+		}
+		if c.tagsType == TagsTypeLabels {
+			s.labels = labelsFromMetric(metric)
+		}
+		return s
+	}
+	if c.seriesHash {
+		s.hash = labelsFingerprint(sc.buf)
+	}
+	if c.tagsType == TagsTypeLabels {
+		s.labels = make([]itemLabel, 0, len(sc.buf))
+		for _, l := range sc.buf {
+			if l.Name != model.MetricNameLabel {
+				s.labels = append(s.labels, itemLabel{Name: l.Name, Value: l.Value})
+			}
+		}
+	}
+	return s
+}
+
+// seriesFingerprint hashes the names and values of the labels.
+func seriesFingerprint(labels []*prompb.Label) uint64 {
+	var h maphash.Hash
+	h.SetSeed(seriesSeed)
+	for _, l := range labels {
+		h.WriteString(l.Name)
+		h.WriteByte(0xff)
+		h.WriteString(l.Value)
+		h.WriteByte(0xff)
+	}
+	return h.Sum64()
+}
+
+func sameLabels(a, b []*prompb.Label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesLabels returns the labels sorted by name, reusing buf. Like in a model.Metric,
+// the last of several labels with the same name is kept. A non-empty tenant replaces
+// the tenant label.
+func seriesLabels(buf []prompb.Label, labels []*prompb.Label, tenant string) []prompb.Label {
+	buf = buf[:0]
+	// Prometheus sends the labels sorted, they only have to be sorted for other clients.
+	sorted := true
+	for _, l := range labels {
+		if tenant != "" && l.Name == TenantLabel {
+			continue
+		}
+		if n := len(buf); n > 0 && buf[n-1].Name >= l.Name {
+			sorted = false
+		}
+		buf = append(buf, *l)
+	}
+	if !sorted {
+		sort.SliceStable(buf, func(i, j int) bool { return buf[i].Name < buf[j].Name })
+		unique := buf[:0]
+		for i, l := range buf {
+			if i+1 < len(buf) && buf[i+1].Name == l.Name {
+				continue
+			}
+			unique = append(unique, l)
+		}
+		buf = unique
+	}
+	if tenant != "" {
+		i := sort.Search(len(buf), func(i int) bool { return buf[i].Name > TenantLabel })
+		buf = append(buf, prompb.Label{})
+		copy(buf[i+1:], buf[i:])
+		buf[i] = prompb.Label{Name: TenantLabel, Value: tenant}
+	}
+	return buf
+}
+
+// WithDropLabels removes the labels with the given names, and the labels whose names the
+// regex matches, from every written series. The metric name and the tenant label are
+// never removed. Series which only differ in removed labels are written as one series.
+func WithDropLabels(names []string, regex *regexp.Regexp) Option {
+	return func(c *BigqueryClient) {
+		c.dropLabelNames = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.dropLabelNames[name] = true
+		}
+		c.dropLabelRegex = regex
+	}
+}
+
+func (c *BigqueryClient) dropsLabels() bool {
+	return len(c.dropLabelNames) > 0 || c.dropLabelRegex != nil
+}
+
+// dropLabels removes the labels configured to be dropped in place and returns the
+// remaining labels and the number of removed ones.
+func (c *BigqueryClient) dropLabels(labels []prompb.Label, tenant string) ([]prompb.Label, int) {
+	kept := labels[:0]
+	for _, l := range labels {
+		reserved := l.Name == model.MetricNameLabel || (tenant != "" && l.Name == TenantLabel)
+		if !reserved && (c.dropLabelNames[l.Name] || (c.dropLabelRegex != nil && c.dropLabelRegex.MatchString(l.Name))) {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept, len(labels) - len(kept)
+}
+
+// mergeStaticLabels merges the sorted static labels into the sorted labels of a series,
+// reusing buf. Of labels with the same name, the label of the series is kept unless
+// override is set.
+func mergeStaticLabels(buf, labels, static []prompb.Label, override bool) []prompb.Label {
+	buf = buf[:0]
+	i, j := 0, 0
+	for i < len(labels) || j < len(static) {
+		switch {
+		case j == len(static) || (i < len(labels) && labels[i].Name < static[j].Name):
+			buf = append(buf, labels[i])
+			i++
+		case i == len(labels) || static[j].Name < labels[i].Name:
+			buf = append(buf, static[j])
+			j++
+		default:
+			if override {
+				buf = append(buf, static[j])
+			} else {
+				buf = append(buf, labels[i])
+			}
+			i++
+			j++
+		}
+	}
+	return buf
+}
+
+// tagsFromLabels returns the labels without the metric name as a JSON object. The labels
+// have to be sorted by name and unique, the result is the same as that of json.Marshal
+// for a map of the labels.
+func tagsFromLabels(labels []prompb.Label) string {
+	size := 2
+	for _, l := range labels {
+		size += len(l.Name) + len(l.Value) + 6
+	}
+	var b strings.Builder
+	b.Grow(size)
+	b.WriteByte('{')
+	for _, l := range labels {
+		if l.Name == model.MetricNameLabel {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, l.Name)
+		b.WriteByte(':')
+		writeJSONString(&b, l.Value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// writeJSONString writes the string as a JSON string. Strings with characters which
+// json.Marshal escapes or validates are encoded with it.
+func writeJSONString(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			quoted, _ := json.Marshal(s)
+			b.Write(quoted)
+			return
+		}
+	}
+	b.WriteByte('"')
+	b.WriteString(s)
+	b.WriteByte('"')
+}
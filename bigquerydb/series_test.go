@@ -0,0 +1,201 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagsFromLabelsMatchesJSON(t *testing.T) {
+	for name, value := range map[string]string{
+		"plain":      "value",
+		"empty":      "",
+		"quoted":     `say "hi" \ bye`,
+		"html":       "<a href='x'>&</a>",
+		"control":    "line\nbreak\ttab\x01",
+		"unicode":    "grüße 日本",
+		"separators": "  ",
+		"invalid":    "bad \xff utf8",
+		"gr\xfcn":    "invalid name",
+	} {
+		labels := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "a", Value: "first"}, {Name: name, Value: value}}
+		expected, err := json.Marshal(map[string]string{"a": "first", name: value})
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), tagsFromLabels(labels), name)
+	}
+	assert.Equal(t, "{}", tagsFromLabels([]prompb.Label{{Name: "__name__", Value: "up"}}))
+	assert.Equal(t, `{"job":"api","zone":"a"}`, tagsFromMetric(model.Metric{"zone": "a", "__name__": "up", "job": "api"}))
+}
+
+func TestSeriesLabels(t *testing.T) {
+	labels := []*prompb.Label{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}, {Name: "job", Value: "web"}, {Name: TenantLabel, Value: "spoofed"}}
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: TenantLabel, Value: "spoofed"}, {Name: "job", Value: "web"}},
+		seriesLabels(nil, labels, ""), "labels are sorted and the last duplicate wins")
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: TenantLabel, Value: "team-a"}, {Name: "job", Value: "web"}},
+		seriesLabels(nil, labels, "team-a"), "the tenant replaces the tenant label")
+	assert.Equal(t, []prompb.Label{{Name: TenantLabel, Value: "team-a"}},
+		seriesLabels(nil, nil, "team-a"))
+}
+
+func TestSeriesConverterCache(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithTagsType(TagsTypeLabels))
+	sc := c.newSeriesConverter("", 2)
+	first := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}}
+	again := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}}
+
+	s := sc.convert(first)
+	assert.Equal(t, "up", s.name)
+	assert.Equal(t, `{"job":"api"}`, s.tags)
+	assert.Equal(t, []itemLabel{{Name: "job", Value: "api"}}, s.labels)
+	assert.Same(t, s, sc.convert(again), "the series is converted once")
+
+	// A series whose fingerprint collides with a cached one is converted on its own.
+	other := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "down"}}}
+	sc.cache[seriesFingerprint(other.Labels)] = s
+	assert.Equal(t, "down", sc.convert(other).name)
+	assert.Same(t, s, sc.cache[seriesFingerprint(other.Labels)])
+}
+
+func TestBuildBatchRepeatedSeries(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithDeduplication(true))
+	timeseries := benchmarkSeries(3, 2)
+	batch, err := c.buildBatch(context.Background(), timeseries, "", unlimitedWindow)
+	assert.NoError(t, err)
+	if assert.Len(t, batch, 6) {
+		for i, item := range batch {
+			assert.Equal(t, "container_cpu_usage_seconds_total", item.metricname)
+			assert.Equal(t, batch[i%3].tags, item.tags, "the samples of a series share its tags")
+			assert.Equal(t, insertID(item.metricname, item.tags, timeseries[i].Samples[0].Timestamp, item.value), item.insertID)
+		}
+		assert.NotEqual(t, batch[0].tags, batch[1].tags)
+	}
+
+	ins := &fakeInserter{}
+	c = newTestClient(ins, WithTenancy(true))
+	ctx := ContextWithTenant(context.Background(), "team-a")
+	assert.NoError(t, c.Write(ctx, benchmarkSeries(1, 2)))
+	for _, item := range ins.rows() {
+		assert.Contains(t, item.tags, `"__tenant__":"team-a"`)
+	}
+}
+
+func TestMergeStaticLabels(t *testing.T) {
+	labels := []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "cluster", Value: "sent"}, {Name: "job", Value: "api"}}
+	static := []prompb.Label{{Name: "cluster", Value: "static"}, {Name: "region", Value: "eu"}}
+
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "cluster", Value: "sent"}, {Name: "job", Value: "api"}, {Name: "region", Value: "eu"}},
+		mergeStaticLabels(nil, labels, static, false), "labels of the series take precedence")
+	assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "cluster", Value: "static"}, {Name: "job", Value: "api"}, {Name: "region", Value: "eu"}},
+		mergeStaticLabels(nil, labels, static, true), "static labels override")
+	assert.Equal(t, static, mergeStaticLabels(nil, nil, static, false))
+}
+
+func TestStaticLabelsReadBack(t *testing.T) {
+	for _, override := range []bool{false, true} {
+		c := newFakeBigQueryClient(WithStaticLabels(map[string]string{"cluster": "eu-west1", "env": "prod"}, override), WithTenancy(true))
+		ctx := ContextWithTenant(context.Background(), "team-a")
+		now := time.Now().Unix() * 1000
+		assert.NoError(t, c.Write(ctx, []*prompb.TimeSeries{
+			{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, Samples: []prompb.Sample{{Timestamp: now, Value: 1}}},
+			{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "env", Value: "dev"}, {Name: "job", Value: "web"}}, Samples: []prompb.Sample{{Timestamp: now, Value: 1}}},
+		}))
+
+		result, err := c.Read(ctx, &prompb.ReadRequest{Queries: []*prompb.Query{{
+			StartTimestampMs: now,
+			EndTimestampMs:   now,
+			Matchers: []*prompb.LabelMatcher{
+				{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+				{Type: prompb.LabelMatcher_EQ, Name: "cluster", Value: "eu-west1"},
+				{Type: prompb.LabelMatcher_EQ, Name: "env", Value: "prod"},
+			},
+		}}})
+		assert.NoError(t, err)
+		var jobs []string
+		for _, ts := range result.Results[0].Timeseries {
+			assert.Contains(t, ts.Labels, &prompb.Label{Name: "cluster", Value: "eu-west1"})
+			for _, l := range ts.Labels {
+				assert.NotEqual(t, TenantLabel, l.Name, "static labels don't affect tenancy")
+				if l.Name == "job" {
+					jobs = append(jobs, l.Value)
+				}
+			}
+		}
+		if override {
+			assert.ElementsMatch(t, []string{"api", "web"}, jobs, "env=dev is replaced by the static label")
+		} else {
+			assert.Equal(t, []string{"api"}, jobs, "env=dev is kept")
+		}
+	}
+}
+
+func TestDropLabels(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithDropLabels([]string{"pod_template_hash"}, regexp.MustCompile("^(?:container_.*)$")))
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "container_id", Value: "a1"}, {Name: "job", Value: "api"}, {Name: "pod_template_hash", Value: "5d8f"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}},
+		},
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "container_id", Value: "b2"}, {Name: "job", Value: "api"}, {Name: "pod_template_hash", Value: "7c4a"}},
+			Samples: []prompb.Sample{{Timestamp: 2000, Value: 0}, {Timestamp: 3000, Value: 0}},
+		},
+	}))
+
+	rows := ins.rows()
+	if assert.Len(t, rows, 3, "the samples of the merged series at 2000 are written once") {
+		for _, item := range rows {
+			assert.Equal(t, `{"job":"api"}`, item.tags)
+		}
+		assert.Equal(t, []float64{1, 1, 0}, []float64{rows[0].value, rows[1].value, rows[2].value}, "the first series of the request wins")
+	}
+	assert.Equal(t, 4.0, metricValue(c.droppedLabels))
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("duplicate_series")))
+}
+
+func TestDropLabelsReserved(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithDropLabels(nil, regexp.MustCompile("^(?:.*)$")), WithTenancy(true),
+		WithStaticLabels(map[string]string{"cluster": "eu-west1"}, false))
+	ctx := ContextWithTenant(context.Background(), "team-a")
+	assert.NoError(t, c.Write(ctx, []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "cluster", Value: "sent"}, {Name: "job", Value: "api"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}))
+	if rows := ins.rows(); assert.Len(t, rows, 1) {
+		assert.Equal(t, "up", rows[0].metricname)
+		assert.Equal(t, `{"__tenant__":"team-a","cluster":"eu-west1"}`, rows[0].tags, "only the metric name, the tenant and the static labels are kept")
+	}
+}
+
+// BenchmarkTagsFromMetric converts the labels of a series into its tags.
+func BenchmarkTagsFromMetric(b *testing.B) {
+	ts := benchmarkSeries(1, 1)[0]
+	var buf []prompb.Label
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = seriesLabels(buf, ts.Labels, "")
+		tagsFromLabels(buf)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"hash/fnv"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesHashColumn is the column the fingerprint of the labels of a row is stored in.
+const seriesHashColumn = "series_hash"
+
+// WithSeriesHashColumn writes the fingerprint of the labels of every series, including the
+// metric name, to the INT64 column series_hash, and reads use it instead of computing the
+// fingerprints of the series they return. The fingerprint is the one of model.Fingerprint,
+// stored as a signed integer, so queries can group by it instead of metricname and tags.
+func WithSeriesHashColumn(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.seriesHash = enabled
+	}
+}
+
+// labelsFingerprint returns the same fingerprint as model.Fingerprint for the labels, which
+// have to be sorted by name and unique.
+func labelsFingerprint(labels []prompb.Label) model.Fingerprint {
+	if len(labels) == 0 {
+		return model.LabelSet{}.Fingerprint()
+	}
+	h := fnv.New64a()
+	for _, l := range labels {
+		h.Write([]byte(l.Name))
+		h.Write([]byte{model.SeparatorByte})
+		h.Write([]byte(l.Value))
+		h.Write([]byte{model.SeparatorByte})
+	}
+	return model.Fingerprint(h.Sum64())
+}
+
+// rowSeriesHash returns the fingerprint stored in the series hash column of a BigQuery row.
+func rowSeriesHash(row map[string]bigquery.Value) (model.Fingerprint, bool) {
+	hash, ok := row[seriesHashColumn].(int64)
+	return model.Fingerprint(hash), ok
+}
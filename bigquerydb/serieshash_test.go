@@ -0,0 +1,147 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// labelsMetric returns the labels as a model.Metric.
+func labelsMetric(labels []*prompb.Label) model.Metric {
+	metric := make(model.Metric, len(labels))
+	for _, l := range labels {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric
+}
+
+func TestLabelsFingerprint(t *testing.T) {
+	testCases := map[string][]prompb.Label{
+		"empty":       nil,
+		"name_only":   {{Name: "__name__", Value: "up"}},
+		"labels":      {{Name: "__name__", Value: "up"}, {Name: "instance", Value: "a:9090"}, {Name: "job", Value: "api"}},
+		"empty_value": {{Name: "__name__", Value: "up"}, {Name: "job", Value: ""}},
+		"utf8":        {{Name: "__name__", Value: "up"}, {Name: "host.name", Value: "Grüße"}},
+	}
+	for name, labels := range testCases {
+		t.Run(name, func(t *testing.T) {
+			metric := model.Metric{}
+			for _, l := range labels {
+				metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+			}
+			assert.Equal(t, metric.Fingerprint(), labelsFingerprint(labels))
+		})
+	}
+}
+
+func TestSeriesHashRoundTrip(t *testing.T) {
+	series := []*prompb.TimeSeries{
+		{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}, {Name: "pod", Value: "api-1"}}},
+		{Labels: []*prompb.Label{{Name: "job", Value: "web"}, {Name: "__name__", Value: "up"}}},
+	}
+	for _, tagsType := range []string{TagsTypeString, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTagsType(tagsType), WithSeriesHashColumn(true),
+				WithDropLabels([]string{"pod"}, nil), WithStaticLabels(map[string]string{"cluster": "eu"}, false))
+			now := time.Now().Unix() * 1000
+			for _, ts := range series {
+				ts.Samples = []prompb.Sample{{Timestamp: now, Value: 1}}
+			}
+			assert.NoError(t, c.Write(context.Background(), series))
+
+			result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+				StartTimestampMs: now,
+				EndTimestampMs:   now + 1000,
+				Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			}}})
+			assert.NoError(t, err)
+			timeseries := result.Results[0].Timeseries
+			assert.Len(t, timeseries, 2)
+
+			// The hash of the written rows is the fingerprint of the labels read back.
+			read := map[model.Fingerprint]bool{}
+			for _, ts := range timeseries {
+				assert.Equal(t, model.LabelValue("eu"), labelsMetric(ts.Labels)["cluster"])
+				read[labelsMetric(ts.Labels).Fingerprint()] = true
+			}
+			rows := c.querier.(*fakeBigQuery).rows
+			if assert.Len(t, rows, 2) {
+				for _, item := range rows {
+					assert.True(t, read[item.seriesHash], "hash of %s %s", item.metricname, item.tags)
+				}
+			}
+		})
+	}
+}
+
+func TestSeriesHashTruncatedLabels(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithSeriesHashColumn(true), WithMaxRowSize(1024*1024, OversizeTruncate, 1001))
+	assert.NoError(t, c.Write(context.Background(), oversizedSeries()))
+
+	for _, item := range ins.rows() {
+		row, _, err := item.Save()
+		assert.NoError(t, err)
+		row["timestamp"] = row["timestamp"].(int64) * 1000
+		_, metric, _, err := rowToSample(row)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(metric.Fingerprint()), row[seriesHashColumn], "hash of %s %s", item.metricname, item.tags)
+	}
+}
+
+func TestSeriesHashCollision(t *testing.T) {
+	// Rows of different series with the same hash, e.g. from a collision, and a row
+	// without a hash, like the ones written before the column was added.
+	rows := []map[string]bigquery.Value{
+		{"metricname": "up", "tags": `{"job":"api"}`, "timestamp": int64(1000), "value": 1.0, seriesHashColumn: int64(42)},
+		{"metricname": "up", "tags": `{"job":"web"}`, "timestamp": int64(1000), "value": 2.0, seriesHashColumn: int64(42)},
+		{"metricname": "up", "tags": `{"job":"api"}`, "timestamp": int64(2000), "value": 3.0, seriesHashColumn: int64(42)},
+		{"metricname": "up", "tags": `{"job":"db"}`, "timestamp": int64(1000), "value": 4.0},
+	}
+	rs := newResultSet(0)
+	assert.NoError(t, mergeResult(rs, &fakeRowIterator{rows: rows}))
+	assert.Len(t, rs.series, 3)
+	assert.Contains(t, rs.series, model.Fingerprint(42))
+
+	samples := map[string][]prompb.Sample{}
+	for _, ts := range rs.response().Results[0].Timeseries {
+		samples[string(labelsMetric(ts.Labels)["job"])] = ts.Samples
+	}
+	assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 3}}, samples["api"])
+	assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 2}}, samples["web"])
+	assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 4}}, samples["db"])
+}
+
+func TestSeriesHashColumnQuery(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithSeriesHashColumn(true), WithSpecialValueColumn(true))
+	query, _, err := c.buildCommand(sensorQuery(0, 1000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, "UNIX_MILLIS(timestamp) as timestamp, value, special_value, series_hash FROM")
+	assert.Contains(t, c.requiredColumns(), requiredColumn{name: seriesHashColumn, typ: bigquery.IntegerFieldType})
+
+	c = newTestClient(&fakeInserter{})
+	query, _, err = c.buildCommand(sensorQuery(0, 1000))
+	assert.NoError(t, err)
+	assert.NotContains(t, query, seriesHashColumn)
+	assert.Len(t, c.requiredColumns(), 4)
+}
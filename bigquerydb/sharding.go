@@ -0,0 +1,104 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// Date sharding of the tables.
+const (
+	// DateShardingNone writes to the tables themselves.
+	DateShardingNone = "none"
+	// DateShardingDaily writes the rows of a day to a table named like the table followed
+	// by _YYYYMMDD of the day in UTC.
+	DateShardingDaily = "daily"
+)
+
+// shardSuffixFormat formats the suffix of the shard of a day.
+const shardSuffixFormat = "_20060102"
+
+// shardConditionSQL selects the shards of the time range of a read from a wildcard table.
+const shardConditionSQL = "_TABLE_SUFFIX BETWEEN @shard_start AND @shard_end"
+
+// WithDateSharding writes the rows of every day to a table of their own, the shard of the
+// day, named like the table of the client or the route followed by _YYYYMMDD, instead of
+// to the table itself. With WithCreateTable the shards are created on their first insert.
+// Reads select from the shards of the days of their time range. The schema of the shard
+// of the current day is checked at startup.
+func WithDateSharding(sharding string) Option {
+	return func(c *BigqueryClient) {
+		c.dateSharding = sharding == DateShardingDaily
+	}
+}
+
+// shardSuffix returns the suffix of the shard of the time.
+func shardSuffix(t time.Time) string {
+	return t.UTC().Format(shardSuffixFormat)
+}
+
+// setShardSuffixes sets the suffix of every row to the one of the shard of its day.
+func setShardSuffixes(batch []*Item) {
+	var day int64
+	var suffix string
+	for _, item := range batch {
+		// Days in UTC have the same number of seconds.
+		d := item.timestamp / 86400
+		if item.timestamp%86400 < 0 {
+			d--
+		}
+		if suffix == "" || d != day {
+			day, suffix = d, shardSuffix(time.Unix(item.timestamp, 0))
+		}
+		item.suffix = suffix
+	}
+}
+
+// shardInserter is implemented by inserters which can insert into the shards of their table.
+type shardInserter interface {
+	withTable(tableID string) Inserter
+}
+
+func (i *tableInserter) withTable(tableID string) Inserter {
+	shard := *i
+	shard.table.tableID = tableID
+	return &shard
+}
+
+// createShard creates the table of the shard on its first insert. Failed creations are
+// tried again with the next insert.
+func (c *BigqueryClient) createShard(ctx context.Context, dest *destination) error {
+	dest.createMu.Lock()
+	defer dest.createMu.Unlock()
+	if dest.created {
+		return nil
+	}
+	if err := c.createMissingTable(ctx, c.tableAdminFor(dest.datasetID, dest.tableID), dest.datasetID, dest.tableID); err != nil {
+		return err
+	}
+	dest.created = true
+	return nil
+}
+
+// shardParams returns the parameters of the suffixes of the first and the last shard of
+// the time range of the query.
+func shardParams(startMs, endMs int64) []bigquery.QueryParameter {
+	return []bigquery.QueryParameter{
+		{Name: "shard_start", Value: time.UnixMilli(startMs).UTC().Format(shardSuffixFormat[1:])},
+		{Name: "shard_end", Value: time.UnixMilli(endMs).UTC().Format(shardSuffixFormat[1:])},
+	}
+}
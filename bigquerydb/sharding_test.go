@@ -0,0 +1,125 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// shardFakeInserter is a fake inserter which records the table it was derived for. Every
+// shard gets a fake of its own.
+type shardFakeInserter struct {
+	*fakeInserter
+	tableID string
+}
+
+func (f *shardFakeInserter) withTable(tableID string) Inserter {
+	return &shardFakeInserter{fakeInserter: &fakeInserter{}, tableID: tableID}
+}
+
+func TestShardingReadSQL(t *testing.T) {
+	day := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		start, end time.Time
+		shards     []string
+	}{
+		"single day": {start: day.Add(time.Hour), end: day.Add(2 * time.Hour), shards: []string{"20260115", "20260115"}},
+		"multi day":  {start: day.Add(-time.Hour), end: day.Add(49 * time.Hour), shards: []string{"20260114", "20260117"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithDateSharding(DateShardingDaily))
+			query, params, err := c.buildCommand(sensorQuery(tc.start.UnixMilli(), tc.end.UnixMilli()))
+			assert.NoError(t, err)
+			assert.Contains(t, query, " FROM `dataset.table_*` WHERE metricname = @m0 AND _TABLE_SUFFIX BETWEEN @shard_start AND @shard_end AND timestamp >= ")
+			assert.Contains(t, params, bigquery.QueryParameter{Name: "shard_start", Value: tc.shards[0]})
+			assert.Contains(t, params, bigquery.QueryParameter{Name: "shard_end", Value: tc.shards[1]})
+		})
+	}
+
+	// Every table of the union selects its shards.
+	c := newTestClient(&fakeInserter{}, WithDateSharding(DateShardingDaily), WithRoutes(testRoutes()))
+	query, _, err := c.buildCommand(sensorQuery(day.UnixMilli(), day.Add(time.Hour).UnixMilli()))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `dataset.table_*` WHERE _TABLE_SUFFIX BETWEEN @shard_start AND @shard_end UNION ALL ")
+	assert.Contains(t, query, " FROM `short.buckets_*` WHERE _TABLE_SUFFIX BETWEEN @shard_start AND @shard_end)")
+	assert.Equal(t, 3, strings.Count(query, shardConditionSQL), "the primary table, http and short.buckets")
+
+	// Without sharding nothing changes.
+	c = newTestClient(&fakeInserter{}, WithDateSharding(DateShardingNone))
+	query, params, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.NotContains(t, query, "_TABLE_SUFFIX")
+	assert.Len(t, params, 3)
+}
+
+func TestShardingWriteAcrossMidnight(t *testing.T) {
+	midnight := time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC)
+	c := newTestClient(&shardFakeInserter{fakeInserter: &fakeInserter{}}, WithDateSharding(DateShardingDaily), WithMaxSampleAge(0, false))
+	series := []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{
+			{Timestamp: midnight.Add(-2 * time.Second).UnixMilli(), Value: 1},
+			{Timestamp: midnight.Add(-time.Second).UnixMilli(), Value: 2},
+			{Timestamp: midnight.UnixMilli(), Value: 3},
+		},
+	}}
+	assert.NoError(t, c.Write(context.Background(), series))
+
+	for suffix, values := range map[string][]float64{"_20260115": {1, 2}, "_20260116": {3}} {
+		dest := c.suffixed(c.defaultDestination, suffix)
+		if inserter, ok := dest.inserter.(*shardFakeInserter); assert.True(t, ok, suffix) {
+			assert.Equal(t, "table"+suffix, inserter.tableID)
+			var written []float64
+			for _, item := range inserter.rows() {
+				written = append(written, item.value)
+			}
+			assert.Equal(t, values, written, suffix)
+		}
+	}
+}
+
+func TestShardingCreatesShards(t *testing.T) {
+	c := newTestClient(&shardFakeInserter{fakeInserter: &fakeInserter{}}, WithDateSharding(DateShardingDaily), WithCreateTable(true), WithMaxSampleAge(0, false))
+	admins := map[string]*fakeTableAdmin{}
+	c.tableAdminFor = func(datasetID, tableID string) TableAdmin {
+		admins[datasetID+"."+tableID] = &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+		return admins[datasetID+"."+tableID]
+	}
+	day := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: day.UnixMilli(), Value: 1}},
+	}}))
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: day.Add(time.Hour).UnixMilli(), Value: 1}},
+	}}))
+
+	if assert.Len(t, admins, 1, "the shard is only created once") && assert.NotNil(t, admins["dataset.table_20260115"].created) {
+		md := admins["dataset.table_20260115"].created
+		assert.Nil(t, md.TimePartitioning, "shards aren't partitioned")
+		assert.Equal(t, []string{"metricname"}, md.Clustering.Fields)
+	}
+}
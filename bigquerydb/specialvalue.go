@@ -0,0 +1,68 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// specialValueColumn is the column NaN and infinite values are stored in, as FLOAT64
+// columns of BigQuery can't hold them in streaming inserts.
+const specialValueColumn = "special_value"
+
+// Values of the special value column.
+const (
+	specialNaN    = "NaN"
+	specialPosInf = "+Inf"
+	specialNegInf = "-Inf"
+)
+
+// WithSpecialValueColumn writes NaN and infinite values as rows with a NULL value and the
+// value in the special_value column instead of dropping them, and reads them back as the
+// original values. The table needs a nullable STRING column special_value. Staleness
+// markers aren't special values, they are handled by WithStaleMarkers.
+func WithSpecialValueColumn(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.specialValues = enabled
+	}
+}
+
+// specialValue returns the value of the special value column for NaN and infinite values,
+// and an empty string for all other values.
+func specialValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return specialNaN
+	case math.IsInf(v, 1):
+		return specialPosInf
+	case math.IsInf(v, -1):
+		return specialNegInf
+	}
+	return ""
+}
+
+// parseSpecialValue returns the value a value of the special value column stands for.
+func parseSpecialValue(s string) (float64, error) {
+	switch s {
+	case specialNaN:
+		return math.NaN(), nil
+	case specialPosInf:
+		return math.Inf(1), nil
+	case specialNegInf:
+		return math.Inf(-1), nil
+	}
+	return 0, errors.Errorf("unknown special value %q", s)
+}
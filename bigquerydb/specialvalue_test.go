@@ -0,0 +1,140 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// specialValueSeries returns a series with a sample of every special value, a staleness
+// marker and an ordinary value, one second apart from start.
+func specialValueSeries(start int64) []*prompb.TimeSeries {
+	return []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "sensor"}, {Name: "id", Value: "1"}},
+		Samples: []prompb.Sample{
+			{Timestamp: start, Value: 1.5},
+			{Timestamp: start + 1000, Value: math.NaN()},
+			{Timestamp: start + 2000, Value: math.Inf(1)},
+			{Timestamp: start + 3000, Value: math.Inf(-1)},
+			{Timestamp: start + 4000, Value: math.Float64frombits(staleNaN)},
+		},
+	}}
+}
+
+// sensorQuery returns a query for the series of specialValueSeries.
+func sensorQuery(start, end int64) *prompb.Query {
+	return &prompb.Query{
+		StartTimestampMs: start,
+		EndTimestampMs:   end,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "sensor"}},
+	}
+}
+
+func TestSpecialValuesRoundTrip(t *testing.T) {
+	for _, tagsType := range []string{TagsTypeString, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTagsType(tagsType), WithSpecialValueColumn(true), WithStaleMarkers(true))
+			start := time.Now().Unix() * 1000
+			assert.NoError(t, c.Write(context.Background(), specialValueSeries(start)))
+			assert.Zero(t, metricValue(c.ignoredSamples), "special values aren't dropped")
+
+			result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{sensorQuery(start, start+10000)}})
+			assert.NoError(t, err)
+			timeseries := result.Results[0].Timeseries
+			if !assert.Len(t, timeseries, 1) || !assert.Len(t, timeseries[0].Samples, 5) {
+				return
+			}
+			samples := timeseries[0].Samples
+			assert.Equal(t, 1.5, samples[0].Value)
+			assert.True(t, math.IsNaN(samples[1].Value))
+			assert.False(t, isStaleMarker(samples[1].Value), "NaN isn't read as a staleness marker")
+			assert.True(t, math.IsInf(samples[2].Value, 1))
+			assert.True(t, math.IsInf(samples[3].Value, -1))
+			assert.True(t, isStaleMarker(samples[4].Value), "staleness markers stay staleness markers")
+		})
+	}
+}
+
+func TestSpecialValuesDroppedByDefault(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins)
+	assert.NoError(t, c.Write(context.Background(), specialValueSeries(1000)))
+	assert.Len(t, ins.rows(), 1)
+	assert.Equal(t, 4.0, metricValue(c.ignoredSamples))
+	metrics := scrape(t, c)
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_dropped_samples_total{reason="nan"}`])
+	assert.Equal(t, 2.0, metrics[`storage_bigquery_dropped_samples_total{reason="inf"}`])
+}
+
+func TestSpecialValueRows(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithSpecialValueColumn(true))
+	assert.NoError(t, c.Write(context.Background(), specialValueSeries(1000)))
+	rows := ins.rows()
+	if !assert.Len(t, rows, 4, "staleness markers are still dropped by default") {
+		return
+	}
+
+	expected := []interface{}{nil, specialNaN, specialPosInf, specialNegInf}
+	for i, item := range rows {
+		row, _, err := item.Save()
+		assert.NoError(t, err)
+		assert.Equal(t, expected[i], row[specialValueColumn])
+		if i > 0 {
+			assert.Nil(t, row["value"], "special values are written with a NULL value")
+		}
+	}
+	metrics := scrape(t, c)
+	assert.Zero(t, metrics[`storage_bigquery_dropped_samples_total{reason="nan"}`])
+	assert.Zero(t, metrics[`storage_bigquery_dropped_samples_total{reason="inf"}`])
+	assert.Equal(t, 1.0, metricValue(c.ignoredSamples), "only the staleness marker is counted")
+}
+
+func TestSpecialValueColumnQuery(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithSpecialValueColumn(true))
+	query, _, err := c.buildCommand(sensorQuery(0, 1000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, "UNIX_MILLIS(timestamp) as timestamp, value, special_value FROM")
+	assert.Contains(t, c.requiredColumns(), requiredColumn{name: specialValueColumn, typ: bigquery.StringFieldType})
+
+	c = newTestClient(&fakeInserter{}, WithSpecialValueColumn(true), WithRoutes(testRoutes()))
+	assert.Contains(t, c.tableSQL(), "SELECT metricname, tags, timestamp, value, special_value FROM `dataset.http`")
+}
+
+func TestRowSampleUnknownSpecialValue(t *testing.T) {
+	_, err := rowSample(map[string]bigquery.Value{"metricname": "sensor", "timestamp": int64(1000), "value": nil, specialValueColumn: "Inf"})
+	assert.ErrorContains(t, err, `unknown special value "Inf"`)
+}
+
+func TestLoadSpecialValues(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithSpecialValueColumn(true))
+
+	rows, err := c.Load(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: math.Inf(1)}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, []string{`{"metricname":"up","tags":"{}","timestamp":"2023-11-14 22:13:20","value":null,"special_value":"+Inf"}` + "\n"}, loader.jobs)
+}
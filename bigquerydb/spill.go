@@ -0,0 +1,495 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// ErrSpillTooLarge is returned when a batch alone exceeds the size bound of the spill.
+var ErrSpillTooLarge = errors.New("batch exceeds the maximum size of the spill directory")
+
+const (
+	spillSegmentExt = ".seg"
+	spillTempExt    = ".tmp"
+	// spillHeaderSize is the size of the CRC32 checksum preceding the rows of a segment.
+	spillHeaderSize = 4
+)
+
+// spillRow is the encoding of an Item in a spill segment.
+type spillRow struct {
+	Value       float64     `json:"v"`
+	Metric      string      `json:"m"`
+	Timestamp   int64       `json:"t"`
+	Tags        string      `json:"g,omitempty"`
+	Labels      []itemLabel `json:"l,omitempty"`
+	InsertID    string      `json:"i,omitempty"`
+	Stale       bool        `json:"s,omitempty"`
+	Special     string      `json:"x,omitempty"`
+	Hash        uint64      `json:"h,omitempty"`
+	InsertTime  bool        `json:"it,omitempty"`
+	TimestampMs int64       `json:"tm,omitempty"`
+	Suffix      string      `json:"sf,omitempty"`
+	FailedAt    int64       `json:"fa,omitempty"`
+}
+
+// spillSegment is a file of the spill directory, holding the rows of one failed write.
+type spillSegment struct {
+	seq  uint64
+	rows int
+	size int64
+}
+
+func (s spillSegment) name() string {
+	return fmt.Sprintf("%020d-%d%s", s.seq, s.rows, spillSegmentExt)
+}
+
+// parseSpillSegment parses the name of a segment file, which holds its sequence number
+// and its number of rows, so the rows of dropped segments can be counted without reading them.
+func parseSpillSegment(name string) (spillSegment, bool) {
+	var seg spillSegment
+	if !strings.HasSuffix(name, spillSegmentExt) {
+		return seg, false
+	}
+	_, err := fmt.Sscanf(strings.TrimSuffix(name, spillSegmentExt), "%d-%d", &seg.seq, &seg.rows)
+	return seg, err == nil
+}
+
+// spill is a size-bounded write-ahead log of rows which couldn't be written to BigQuery.
+// The segments are replayed in order in the background and removed once written.
+type spill struct {
+	mu        sync.Mutex
+	dir       string
+	maxBytes  int64
+	segments  []spillSegment
+	size      int64
+	nextSeq   uint64
+	interval  time.Duration
+	replay    func([]*Item) ([]*Item, error)
+	logger    *slog.Logger
+	spilled   prometheus.Counter
+	replayed  prometheus.Counter
+	dropped   prometheus.Counter
+	corrupted prometheus.Counter
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// openSpill opens the spill directory, creating it if needed, and picks up the segments
+// left by a previous run.
+func openSpill(dir string, maxBytes int64, interval time.Duration, replay func([]*Item) ([]*Item, error), logger *slog.Logger,
+	spilled, replayed, dropped, corrupted prometheus.Counter) (*spill, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "failed to create the spill directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the spill directory")
+	}
+	s := &spill{
+		dir:       dir,
+		maxBytes:  maxBytes,
+		interval:  interval,
+		replay:    replay,
+		logger:    logger,
+		spilled:   spilled,
+		replayed:  replayed,
+		dropped:   dropped,
+		corrupted: corrupted,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), spillTempExt) {
+			// A segment which was being written when the adapter stopped.
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		seg, ok := parseSpillSegment(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the spill directory")
+		}
+		seg.size = info.Size()
+		if i := slices.IndexFunc(s.segments, func(existing spillSegment) bool { return existing.seq == seg.seq }); i >= 0 {
+			// A segment which was being rewritten when the adapter stopped. The rewritten
+			// one holds fewer rows, only the ones which weren't written yet.
+			stale := seg
+			if seg.rows < s.segments[i].rows {
+				stale = s.segments[i]
+				s.size += seg.size - stale.size
+				s.segments[i] = seg
+			}
+			_ = os.Remove(filepath.Join(dir, stale.name()))
+			continue
+		}
+		s.segments = append(s.segments, seg)
+		s.size += seg.size
+		if seg.seq >= s.nextSeq {
+			s.nextSeq = seg.seq + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	if len(s.segments) > 0 {
+		logger.Info("replaying spilled samples", slog.Int("segments", len(s.segments)), slog.Int64("bytes", s.size))
+	}
+	return s, nil
+}
+
+// start replays the segments every interval until close is called.
+func (s *spill) start() {
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.replayAll()
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the replay. The remaining segments are replayed after the next start.
+func (s *spill) close() {
+	close(s.done)
+	<-s.stopped
+}
+
+// append writes the rows to a new segment. The oldest segments are dropped when the
+// directory would exceed its size bound.
+func (s *spill) append(rows []*Item) error {
+	data, err := encodeSegment(rows)
+	if err != nil {
+		return err
+	}
+	if s.maxBytes > 0 && int64(len(data)) > s.maxBytes {
+		return ErrSpillTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.maxBytes > 0 && len(s.segments) > 0 && s.size+int64(len(data)) > s.maxBytes {
+		oldest := s.segments[0]
+		s.removeLocked(oldest)
+		s.dropped.Add(float64(oldest.rows))
+		s.logger.Warn("spill directory full, dropped the oldest spilled samples", slog.Int("samples", oldest.rows))
+	}
+	seg := spillSegment{seq: s.nextSeq, rows: len(rows), size: int64(len(data))}
+	if err := writeSegment(filepath.Join(s.dir, seg.name()), data); err != nil {
+		return errors.Wrap(err, "failed to write the spill segment")
+	}
+	s.nextSeq++
+	s.segments = append(s.segments, seg)
+	s.size += seg.size
+	s.spilled.Add(float64(len(rows)))
+	return nil
+}
+
+// encodeSegment returns the content of a segment holding the rows.
+func encodeSegment(rows []*Item) ([]byte, error) {
+	encoded := make([]spillRow, len(rows))
+	for i, item := range rows {
+		encoded[i] = spillRow{
+			Value:       item.value,
+			Metric:      item.metricname,
+			Timestamp:   item.timestamp,
+			Tags:        item.tags,
+			Labels:      item.labels,
+			InsertID:    item.insertID,
+			Stale:       item.stale,
+			Special:     item.special,
+			Hash:        uint64(item.seriesHash),
+			InsertTime:  item.insertTime,
+			TimestampMs: item.timestampMs,
+			Suffix:      item.suffix,
+			FailedAt:    item.failedAt,
+		}
+	}
+	payload, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode the spilled rows")
+	}
+	data := make([]byte, spillHeaderSize, spillHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(data, crc32.ChecksumIEEE(payload))
+	return append(data, payload...), nil
+}
+
+// writeSegment writes the file under a temporary name and renames it when it is complete,
+// so a crash never leaves a partial segment behind.
+func writeSegment(path string, data []byte) error {
+	tmp := path + spillTempExt
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// read decodes the rows of the segment.
+func (s *spill) read(seg spillSegment) ([]*Item, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, seg.name()))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < spillHeaderSize {
+		return nil, errors.New("segment is truncated")
+	}
+	payload := data[spillHeaderSize:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data) {
+		return nil, errors.New("segment checksum mismatch")
+	}
+	var encoded []spillRow
+	if err := json.Unmarshal(payload, &encoded); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the segment")
+	}
+	rows := make([]*Item, len(encoded))
+	for i, r := range encoded {
+		rows[i] = &Item{
+			value:       r.Value,
+			metricname:  r.Metric,
+			timestamp:   r.Timestamp,
+			tags:        r.Tags,
+			labels:      r.Labels,
+			insertID:    r.InsertID,
+			stale:       r.Stale,
+			special:     r.Special,
+			seriesHash:  model.Fingerprint(r.Hash),
+			insertTime:  r.InsertTime,
+			timestampMs: r.TimestampMs,
+			suffix:      r.Suffix,
+			failedAt:    r.FailedAt,
+		}
+	}
+	return rows, nil
+}
+
+// replayAll writes the segments to BigQuery, oldest first. It stops at the first segment
+// failing with a retryable error, which is tried again on the next replay with only the
+// rows which weren't written.
+func (s *spill) replayAll() {
+	for {
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		seg := s.segments[0]
+		s.mu.Unlock()
+
+		rows, err := s.read(seg)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				s.corrupted.Inc()
+				s.logger.Warn("skipping corrupted spill segment", slog.String("segment", seg.name()), slog.Any("error", err))
+			}
+			s.remove(seg)
+			continue
+		}
+		failed, err := s.replay(rows)
+		if err != nil {
+			if isRetryable(err) {
+				if len(failed) > 0 && len(failed) < len(rows) {
+					s.replayed.Add(float64(len(rows) - len(failed)))
+					s.rewrite(seg, failed)
+				}
+				return
+			}
+			s.logger.Warn("failed to replay spilled samples", slog.String("segment", seg.name()), slog.Any("error", err))
+		}
+		// The rows rejected for good are dead-lettered, the others were written.
+		s.replayed.Add(float64(len(rows) - len(failed)))
+		s.remove(seg)
+	}
+}
+
+// rewrite replaces the rows of the segment by the given ones, which keep its place in the
+// order of the segments. If that fails, the segment is kept as it is. The rewritten segment
+// has the same sequence number and fewer rows, which lets openSpill tell it apart from the
+// original if the adapter stops before the original is removed.
+func (s *spill) rewrite(seg spillSegment, rows []*Item) {
+	data, err := encodeSegment(rows)
+	if err != nil {
+		s.logger.Warn("failed to rewrite spill segment", slog.String("segment", seg.name()), slog.Any("error", err))
+		return
+	}
+	rewritten := spillSegment{seq: seg.seq, rows: len(rows), size: int64(len(data))}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.segments, func(existing spillSegment) bool { return existing.seq == seg.seq })
+	if i < 0 {
+		// The segment was dropped meanwhile.
+		return
+	}
+	if err := writeSegment(filepath.Join(s.dir, rewritten.name()), data); err != nil {
+		s.logger.Warn("failed to rewrite spill segment", slog.String("segment", seg.name()), slog.Any("error", err))
+		return
+	}
+	if err := os.Remove(filepath.Join(s.dir, seg.name())); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("failed to remove spill segment", slog.String("segment", seg.name()), slog.Any("error", err))
+	}
+	s.size += rewritten.size - s.segments[i].size
+	s.segments[i] = rewritten
+}
+
+// remove deletes the segment, unless it was already dropped.
+func (s *spill) remove(seg spillSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(seg)
+}
+
+func (s *spill) removeLocked(seg spillSegment) {
+	for i, existing := range s.segments {
+		if existing.seq == seg.seq {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.size -= existing.size
+			if err := os.Remove(filepath.Join(s.dir, seg.name())); err != nil && !os.IsNotExist(err) {
+				s.logger.Warn("failed to remove spill segment", slog.String("segment", seg.name()), slog.Any("error", err))
+			}
+			return
+		}
+	}
+}
+
+// bytes returns the size of the segments.
+func (s *spill) bytes() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// len returns the number of segments.
+func (s *spill) len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+// isRetryable returns whether a write failing with the error may succeed later, so its
+// rows are spilled instead of given up.
+func isRetryable(err error) bool {
+	return IsUnavailable(err) || IsQuotaExceeded(err)
+}
+
+// spillRows spills the rows of a write which failed with the error, if the error is
+// retryable. It returns whether the rows were spilled.
+func (c *BigqueryClient) spillRows(rows []*Item, err error) bool {
+	if c.spill == nil || len(rows) == 0 || !isRetryable(err) {
+		return false
+	}
+	now := time.Now().UnixMilli()
+	for _, item := range rows {
+		if item.failedAt == 0 {
+			item.failedAt = now
+		}
+	}
+	if spillErr := c.spill.append(rows); spillErr != nil {
+		c.logger.Warn("failed to spill samples", slog.Int("samples", len(rows)), slog.Any("error", spillErr))
+		return false
+	}
+	return true
+}
+
+// spillResults spills the rows of the chunks which failed with a retryable error and
+// clears their error, so the rows count as written.
+func (c *BigqueryClient) spillResults(results []insertResult) {
+	for i, r := range results {
+		if r.err != nil && c.spillRows(r.rows, r.err) {
+			results[i].err = nil
+		}
+	}
+}
+
+// replaySpilled writes rows read back from the spill directory and returns the rows which
+// weren't written. If the replay fails with a permanent error, the failed rows are given
+// up and stored in the dead-letter sink.
+func (c *BigqueryClient) replaySpilled(rows []*Item) ([]*Item, error) {
+	done, err := c.breaker.allow()
+	if err != nil {
+		return rows, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.writeTimeout)
+	defer cancel()
+	results := c.insertChunks(ctx, rows)
+	err = writeError(results)
+	done(err)
+	if err != nil && !isRetryable(err) {
+		c.deadLetterResults(results)
+	}
+	var failed []*Item
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r.rows...)
+		}
+	}
+	return failed, err
+}
+
+// startSpill opens the spill directory of the client and starts replaying it.
+func (c *BigqueryClient) startSpill() error {
+	if c.spillDir == "" {
+		return nil
+	}
+	s, err := openSpill(filepath.Join(c.spillDir, c.name), c.spillMaxBytes, c.spillReplayInterval, c.replaySpilled, c.logger,
+		c.spilledSamples, c.spillReplayedSamples, c.spillDroppedSamples, c.spillCorruptSegments)
+	if err != nil {
+		return err
+	}
+	c.spill = s
+	s.start()
+	return nil
+}
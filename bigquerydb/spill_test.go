@@ -0,0 +1,289 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// newSpillClient returns a client spilling to dir, without the background replay.
+func newSpillClient(t *testing.T, ins *fakeInserter, dir string, maxBytes int64, opts ...Option) *BigqueryClient {
+	c := newTestClient(ins, append(opts, WithSpill(dir, maxBytes, time.Hour))...)
+	s, err := openSpill(filepath.Join(dir, c.name), maxBytes, time.Hour, c.replaySpilled, c.logger,
+		c.spilledSamples, c.spillReplayedSamples, c.spillDroppedSamples, c.spillCorruptSegments)
+	assert.NoError(t, err)
+	c.spill = s
+	return c
+}
+
+// setErr changes the error the inserter fails with.
+func (f *fakeInserter) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func TestSpillFailedWrites(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	c := newSpillClient(t, ins, t.TempDir(), 1<<20)
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)), "spilled samples count as written")
+	assert.Equal(t, 1, c.spill.len())
+	assert.Equal(t, 3.0, metricValue(c.spilledSamples))
+
+	ins.setErr(&googleapi.Error{Code: 400, Message: "invalid"})
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 2)), "rejected samples aren't spilled")
+	assert.Equal(t, 1, c.spill.len())
+}
+
+func TestSpillCircuitOpen(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	c := newSpillClient(t, ins, t.TempDir(), 1<<20, WithCircuitBreaker(1, 0, 0, time.Hour, 1))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)))
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)), "writes are spilled while the circuit is open")
+	assert.Equal(t, 2, c.spill.len())
+}
+
+func TestSpillReplayOrder(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	c := newSpillClient(t, ins, t.TempDir(), 1<<20, WithDeduplication(true))
+
+	for _, name := range []string{"first", "second", "third"} {
+		assert.NoError(t, c.Write(context.Background(), seriesWithSamples(name, 2)))
+	}
+	c.spill.replayAll()
+	assert.Equal(t, 3, c.spill.len(), "segments are kept while bigquery is unavailable")
+
+	ins.setErr(nil)
+	c.spill.replayAll()
+	assert.Zero(t, c.spill.len())
+	assert.Zero(t, c.spill.bytes())
+	assert.Equal(t, 6.0, metricValue(c.spillReplayedSamples))
+
+	rows := ins.rows()
+	if assert.Len(t, rows, 6) {
+		for i, name := range []string{"first", "first", "second", "second", "third", "third"} {
+			assert.Equal(t, name, rows[i].metricname)
+			assert.NotEmpty(t, rows[i].insertID, "insert ids are kept")
+		}
+		assert.Equal(t, insertID("first", rows[0].tags, rows[0].timestamp, rows[0].value), rows[0].insertID)
+	}
+}
+
+// partialInserter lets the given number of puts through and fails the others with
+// failErr, or errUnavailable if it isn't set.
+type partialInserter struct {
+	fakeInserter
+	allow   int
+	failErr error
+}
+
+func (f *partialInserter) Put(ctx context.Context, src interface{}) error {
+	f.mu.Lock()
+	allowed := f.allow > 0
+	f.allow--
+	f.mu.Unlock()
+	if !allowed {
+		if f.failErr != nil {
+			return f.failErr
+		}
+		return errUnavailable
+	}
+	return f.fakeInserter.Put(ctx, src)
+}
+
+func TestSpillPartialReplay(t *testing.T) {
+	ins := &partialInserter{}
+	c := newTestClient(ins, WithSpill(t.TempDir(), 1<<20, time.Hour))
+	s, err := openSpill(filepath.Join(c.spillDir, c.name), 1<<20, time.Hour, c.replaySpilled, c.logger,
+		c.spilledSamples, c.spillReplayedSamples, c.spillDroppedSamples, c.spillCorruptSegments)
+	assert.NoError(t, err)
+	c.spill = s
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	assert.Equal(t, 1, c.spill.len())
+
+	// The replay writes the first chunk and fails on the second.
+	c.maxRowsPerInsert = 2
+	ins.allow = 1
+	c.spill.replayAll()
+	assert.Len(t, ins.rows(), 2)
+	assert.Equal(t, 2.0, metricValue(c.spillReplayedSamples))
+	if assert.Equal(t, 1, c.spill.len(), "the segment is kept") {
+		assert.Equal(t, 3, c.spill.segments[0].rows, "only with the rows which weren't written")
+	}
+	reopened, err := openSpill(filepath.Join(c.spillDir, c.name), 1<<20, time.Hour, c.replaySpilled, c.logger,
+		c.spilledSamples, c.spillReplayedSamples, c.spillDroppedSamples, c.spillCorruptSegments)
+	assert.NoError(t, err)
+	assert.Equal(t, c.spill.segments, reopened.segments, "the rewritten segment survives a restart")
+	assert.Equal(t, c.spill.bytes(), reopened.bytes())
+
+	ins.allow = 10
+	c.spill.replayAll()
+	assert.Zero(t, c.spill.len())
+	assert.Equal(t, 5.0, metricValue(c.spillReplayedSamples))
+	rows := ins.rows()
+	if assert.Len(t, rows, 5, "no row is written twice") {
+		for i, row := range rows {
+			assert.Equal(t, int64(i), row.timestamp)
+		}
+	}
+}
+
+// spillItems returns n rows of the metric with the timestamps 0 to n-1.
+func spillItems(name string, n int) []*Item {
+	rows := make([]*Item, n)
+	for i := range rows {
+		rows[i] = &Item{metricname: name, timestamp: int64(i), value: 1}
+	}
+	return rows
+}
+
+func TestSpillPartialReplayRejected(t *testing.T) {
+	ins := &partialInserter{failErr: &googleapi.Error{Code: 400, Message: "invalid"}}
+	c := newTestClient(ins, WithSpill(t.TempDir(), 1<<20, time.Hour))
+	s, err := openSpill(filepath.Join(c.spillDir, c.name), 1<<20, time.Hour, c.replaySpilled, c.logger,
+		c.spilledSamples, c.spillReplayedSamples, c.spillDroppedSamples, c.spillCorruptSegments)
+	assert.NoError(t, err)
+	c.spill = s
+	assert.NoError(t, c.spill.append(spillItems("up", 5)))
+
+	c.maxRowsPerInsert = 2
+	ins.allow = 1
+	c.spill.replayAll()
+	assert.Zero(t, c.spill.len(), "rejected rows aren't replayed again")
+	assert.Len(t, ins.rows(), 2)
+	assert.Equal(t, 2.0, metricValue(c.spillReplayedSamples), "the written rows count as replayed")
+}
+
+func TestSpillInterruptedRewrite(t *testing.T) {
+	dir := t.TempDir()
+	ins := &fakeInserter{}
+	c := newSpillClient(t, ins, dir, 1<<20)
+	rows := spillItems("up", 3)
+	assert.NoError(t, c.spill.append(rows))
+
+	// The adapter stopped after the rewritten segment was written, before the original
+	// one was removed.
+	data, err := encodeSegment(rows[2:])
+	assert.NoError(t, err)
+	rewritten := spillSegment{seq: c.spill.segments[0].seq, rows: 1, size: int64(len(data))}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, c.name, rewritten.name()), data, 0o600))
+	original := filepath.Join(dir, c.name, c.spill.segments[0].name())
+
+	c = newSpillClient(t, ins, dir, 1<<20)
+	assert.Equal(t, []spillSegment{rewritten}, c.spill.segments, "only the rewritten segment is kept")
+	assert.Equal(t, rewritten.size, c.spill.bytes())
+	assert.NoFileExists(t, original)
+
+	c.spill.replayAll()
+	if rows := ins.rows(); assert.Len(t, rows, 1, "no row is written twice") {
+		assert.Equal(t, int64(2), rows[0].timestamp)
+	}
+}
+
+func TestSpillRestartRecovery(t *testing.T) {
+	dir := t.TempDir()
+	ins := &fakeInserter{err: errUnavailable}
+	c := newSpillClient(t, ins, dir, 1<<20)
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("first", 1)))
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("second", 1)))
+
+	// A segment left half written by a crash is removed.
+	leftover := filepath.Join(dir, c.name, "00000000000000000009-1.seg.tmp")
+	assert.NoError(t, os.WriteFile(leftover, []byte("partial"), 0o600))
+
+	restarted := &fakeInserter{}
+	c = newSpillClient(t, restarted, dir, 1<<20)
+	assert.Equal(t, 2, c.spill.len())
+	assert.NoFileExists(t, leftover)
+
+	assert.NoError(t, c.spill.append([]*Item{{metricname: "third", suffix: "_dev"}}))
+	c.spill.replayAll()
+	rows := restarted.rows()
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, "first", rows[0].metricname)
+		assert.Equal(t, "second", rows[1].metricname)
+		assert.Equal(t, "third", rows[2].metricname, "new segments follow the recovered ones")
+		assert.Equal(t, "_dev", rows[2].suffix, "the template suffix is kept")
+	}
+}
+
+func TestSpillCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "bigquerydb"), 0o700))
+	for name, data := range map[string]string{
+		"00000000000000000001-2.seg": "\x00\x00\x00\x00[]",
+		"00000000000000000002-1.seg": "",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "bigquerydb", name), []byte(data), 0o600))
+	}
+	ins := &fakeInserter{}
+	c := newSpillClient(t, ins, dir, 1<<20)
+	assert.NoError(t, c.spill.append([]*Item{{metricname: "up"}}))
+
+	c.spill.replayAll()
+	assert.Equal(t, 2.0, metricValue(c.spillCorruptSegments))
+	assert.Zero(t, c.spill.len())
+	assert.Len(t, ins.rows(), 1, "segments after corrupted ones are replayed")
+}
+
+func TestSpillSizeBound(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	dir := t.TempDir()
+	c := newSpillClient(t, ins, dir, 1<<20)
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("first", 2)))
+	segmentSize := c.spill.bytes()
+
+	c = newSpillClient(t, ins, t.TempDir(), 2*segmentSize+segmentSize/2)
+	for _, name := range []string{"first", "second", "third"} {
+		assert.NoError(t, c.Write(context.Background(), seriesWithSamples(name, 2)))
+	}
+	assert.Equal(t, 2, c.spill.len())
+	assert.Equal(t, 2.0, metricValue(c.spillDroppedSamples), "the oldest segment is dropped")
+	assert.LessOrEqual(t, c.spill.bytes(), 2*segmentSize+segmentSize/2)
+
+	ins.setErr(nil)
+	c.spill.replayAll()
+	rows := ins.rows()
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, "second", rows[0].metricname)
+		assert.Equal(t, "third", rows[3].metricname)
+	}
+
+	c = newSpillClient(t, &fakeInserter{err: errUnavailable}, t.TempDir(), 10)
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 2)), "a batch larger than the bound fails")
+}
+
+func TestSpillBackgroundReplay(t *testing.T) {
+	ins := &fakeInserter{err: errUnavailable}
+	c := newTestClient(ins, WithSpill(t.TempDir(), 1<<20, 10*time.Millisecond))
+	assert.NoError(t, c.startSpill())
+	defer c.Close()
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 2)))
+	ins.setErr(nil)
+	assert.Eventually(t, func() bool { return len(ins.rows()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return c.spill.len() == 0 }, time.Second, 10*time.Millisecond)
+}
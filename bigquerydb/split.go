@@ -0,0 +1,123 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultReadSplitConcurrency is the number of sub-range queries of a read query run at
+// once if the queries of reads aren't limited by a QueryLimiter.
+const defaultReadSplitConcurrency = 8
+
+// WithReadSplitInterval splits the time range of read queries spanning more than one
+// multiple of the interval since the epoch into sub-ranges at those multiples, which are
+// queried concurrently and merged. The sub-ranges are aligned, so that they are cached
+// again by later reads of overlapping ranges. 0 disables splitting.
+func WithReadSplitInterval(interval time.Duration) Option {
+	return func(c *BigqueryClient) {
+		if interval > 0 {
+			c.readSplitInterval = interval
+		}
+	}
+}
+
+// timeRange is an inclusive range of timestamps in milliseconds, like that of a query.
+type timeRange struct {
+	start, end int64
+}
+
+// splitRange splits the inclusive range [start, end] at the multiples of interval. Every
+// sub-range but the first starts at a multiple and every sub-range but the last ends a
+// millisecond before the next multiple, so that each timestamp of the range is in exactly
+// one sub-range.
+func splitRange(start, end, interval int64) []timeRange {
+	if interval <= 0 || end < start {
+		return []timeRange{{start: start, end: end}}
+	}
+	var ranges []timeRange
+	for start <= end {
+		// The next multiple after start, rounding towards negative infinity.
+		next := start - start%interval
+		if start%interval < 0 {
+			next -= interval
+		}
+		next += interval
+		if next > end {
+			break
+		}
+		ranges = append(ranges, timeRange{start: start, end: next - 1})
+		start = next
+	}
+	return append(ranges, timeRange{start: start, end: end})
+}
+
+// splitQuery runs the query, split into sub-ranges by the split interval. The sub-range
+// queries run concurrently, at most as many at once as the query limiter allows, and each
+// is served from the cache like a query of its own. Their results are merged into the
+// result set in the order of their ranges, which enforces the limits of the response on
+// the merged result. The first failing sub-range query cancels the others and fails the
+// read, since a partial result would silently miss samples.
+func (c *BigqueryClient) splitQuery(ctx context.Context, limits *ReadLimits, rs *resultSet, q *prompb.Query) error {
+	ranges := splitRange(q.StartTimestampMs, q.EndTimestampMs, c.readSplitInterval.Milliseconds())
+	if len(ranges) == 1 {
+		return c.cachedQuery(ctx, limits, rs, q)
+	}
+	c.readSplits.Observe(float64(len(ranges)))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.queryLimiter.size())
+	results := make([]*resultSet, len(ranges))
+	for i, r := range ranges {
+		sub := *q
+		sub.StartTimestampMs, sub.EndTimestampMs = r.start, r.end
+		srs := limits.newResultSet()
+		srs.matchers = rs.matchers
+		results[i] = srs
+		g.Go(func() error {
+			err := gctx.Err()
+			if err == nil {
+				err = c.cachedQuery(gctx, limits, srs, &sub)
+			}
+			c.readSplitQueries.WithLabelValues(splitResult(gctx, err)).Inc()
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	for i, srs := range results {
+		if err := rs.addSeries(srs.response().Results[0].Timeseries, ranges[i].start, ranges[i].end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitResult returns the result label of a sub-range query which returned err.
+func splitResult(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case ctx.Err() != nil && errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "failure"
+	}
+}
@@ -0,0 +1,160 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int64
+		want       []timeRange
+	}{
+		{name: "within an interval", start: 1010, end: 1990, want: []timeRange{{1010, 1990}}},
+		{name: "ending on a multiple", start: 1010, end: 2000, want: []timeRange{{1010, 1999}, {2000, 2000}}},
+		{name: "starting on a multiple", start: 2000, end: 2500, want: []timeRange{{2000, 2500}}},
+		{name: "aligned", start: 1000, end: 4000, want: []timeRange{{1000, 1999}, {2000, 2999}, {3000, 3999}, {4000, 4000}}},
+		{name: "unaligned", start: 1500, end: 3500, want: []timeRange{{1500, 1999}, {2000, 2999}, {3000, 3500}}},
+		{name: "negative", start: -1500, end: 500, want: []timeRange{{-1500, -1001}, {-1000, -1}, {0, 500}}},
+		{name: "single timestamp", start: 3000, end: 3000, want: []timeRange{{3000, 3000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitRange(tt.start, tt.end, 1000))
+		})
+	}
+	assert.Equal(t, []timeRange{{1500, 3500}}, splitRange(1500, 3500, 0), "0 doesn't split")
+}
+
+// writeSplitSeries writes two series with a sample every 30s, on and between the minutes,
+// from start to end.
+func writeSplitSeries(t *testing.T, c *BigqueryClient, start, end int64) {
+	var series []*prompb.TimeSeries
+	for _, job := range []string{"api", "db"} {
+		s := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: job}}}
+		for ts := start; ts <= end; ts += 30000 {
+			s.Samples = append(s.Samples, prompb.Sample{Timestamp: ts, Value: float64(ts)})
+		}
+		series = append(series, s)
+	}
+	assert.NoError(t, c.Write(context.Background(), series))
+}
+
+func TestSplitQueryFakeBigQuery(t *testing.T) {
+	// The range starts and ends on minutes, so that samples lie on the edges of sub-ranges.
+	end := time.Now().Truncate(time.Minute).UnixMilli()
+	start := end - 10*time.Minute.Milliseconds()
+	split := newFakeBigQueryClient(WithReadSplitInterval(time.Minute))
+	unsplit := newFakeBigQueryClient()
+	for _, c := range []*BigqueryClient{split, unsplit} {
+		writeSplitSeries(t, c, start-time.Minute.Milliseconds(), end+time.Minute.Milliseconds())
+	}
+
+	read := func(c *BigqueryClient, start, end int64) *prompb.ReadResponse {
+		resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+			StartTimestampMs: start,
+			EndTimestampMs:   end,
+			Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+		}}})
+		assert.NoError(t, err)
+		// The order of the series is that of a map.
+		series := resp.Results[0].Timeseries
+		sort.Slice(series, func(i, j int) bool { return formatLabels(series[i].Labels) < formatLabels(series[j].Labels) })
+		return resp
+	}
+	for _, r := range []timeRange{{start, end}, {start + 1, end - 1}, {start - 30000, end + 30000}} {
+		got := read(split, r.start, r.end)
+		assert.Equal(t, read(unsplit, r.start, r.end), got, "%d-%d", r.start, r.end)
+		if assert.Len(t, got.Results[0].Timeseries, 2) {
+			first, last := r.start+(30000-r.start%30000)%30000, r.end-r.end%30000
+			samples := got.Results[0].Timeseries[0].Samples
+			assert.Equal(t, int((last-first)/30000)+1, len(samples), "neither duplicated nor dropped")
+			assert.Equal(t, first, samples[0].Timestamp)
+			assert.Equal(t, last, samples[len(samples)-1].Timestamp)
+		}
+	}
+
+	metrics := scrape(t, split)
+	assert.Equal(t, 3.0, metrics["storage_bigquery_read_splits_count"])
+	// The ranges ending on a minute have a sub-range of their last millisecond.
+	assert.Equal(t, 11.0+10+12, metrics["storage_bigquery_read_splits_sum"])
+	assert.Equal(t, 33.0, metrics[`storage_bigquery_read_split_queries_total{result="success"}`])
+	assert.Equal(t, 0.0, scrape(t, unsplit)["storage_bigquery_read_splits_count"])
+}
+
+// failingRangeQuerier fails the queries starting at failStart and runs the others on the
+// fake.
+type failingRangeQuerier struct {
+	*fakeBigQuery
+	failStart int64
+}
+
+func (f *failingRangeQuerier) Read(ctx context.Context, query *bigquery.Query) (QueryIterator, error) {
+	for _, p := range query.Parameters {
+		if p.Name == "start" && p.Value == f.failStart {
+			return nil, errors.New("backend failure")
+		}
+	}
+	return f.fakeBigQuery.Read(ctx, query)
+}
+
+func TestSplitQueryFailure(t *testing.T) {
+	end := time.Now().Truncate(time.Minute).UnixMilli()
+	start := end - 10*time.Minute.Milliseconds()
+	fake := &fakeBigQuery{}
+	c := newTestClient(fake, WithQuerier(&failingRangeQuerier{fakeBigQuery: fake, failStart: start + 5*time.Minute.Milliseconds()}),
+		WithReadSplitInterval(time.Minute))
+	writeSplitSeries(t, c, start, end)
+
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: start,
+		EndTimestampMs:   end,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.ErrorContains(t, err, "backend failure", "a failed sub-range fails the read")
+
+	metrics := scrape(t, c)
+	assert.Equal(t, 1.0, metrics[`storage_bigquery_read_split_queries_total{result="failure"}`])
+	assert.Equal(t, 10.0, metrics[`storage_bigquery_read_split_queries_total{result="success"}`]+
+		metrics[`storage_bigquery_read_split_queries_total{result="cancelled"}`])
+}
+
+func TestSplitQueryMaxSamples(t *testing.T) {
+	end := time.Now().Truncate(time.Minute).UnixMilli()
+	start := end - 10*time.Minute.Milliseconds()
+	c := newFakeBigQueryClient(WithReadSplitInterval(time.Minute))
+	writeSplitSeries(t, c, start, end)
+	// Every sub-range is within the limit, the merged result isn't.
+	c.updateReadLimits(func(l *ReadLimits) { l.MaxSamples = 30 })
+
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: start,
+		EndTimestampMs:   end,
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	limit, _ := ExceededLimit(err)
+	assert.Equal(t, "samples", limit, "%v", err)
+}
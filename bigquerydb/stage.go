@@ -0,0 +1,456 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/option"
+)
+
+// Write methods, which set how the rows are written to BigQuery.
+const (
+	// WriteMethodStreaming inserts the rows with the streaming API.
+	WriteMethodStreaming = "streaming"
+	// WriteMethodLoadJob stages the rows as objects in Cloud Storage and loads them with
+	// load jobs.
+	WriteMethodLoadJob = "load-job"
+)
+
+const (
+	stageObjectExt = ".json.gz"
+	// maxSealedObjects is the number of full objects waiting to be uploaded, beyond which
+	// writes fail until Cloud Storage is available again.
+	maxSealedObjects = 4
+	// maxLoadJobs is the number of failed load jobs of an object, after which it's moved
+	// to the quarantine prefix.
+	maxLoadJobs = 5
+	// stageQuarantinePrefix is the prefix below the location the objects which can't be
+	// loaded are moved to, followed by the name of the client.
+	stageQuarantinePrefix = "quarantine/"
+)
+
+// stageStore stores the objects staged for load jobs.
+type stageStore interface {
+	// put stores the object with the name, relative to the prefix of the store.
+	put(ctx context.Context, name string, data []byte) error
+	// list returns the names of the objects of the prefix.
+	list(ctx context.Context) ([]string, error)
+	remove(ctx context.Context, object string) error
+	// object returns the name of the object stored by put with the name.
+	object(name string) string
+	uri(object string) string
+	// quarantine moves the object out of the prefix and returns its new name.
+	quarantine(ctx context.Context, object string) (string, error)
+}
+
+// objectLoader loads an object of newline-delimited JSON compressed with gzip into the
+// table with a load job, and waits for the job to complete. A job whose ID already exists
+// isn't run again, but waited for.
+type objectLoader interface {
+	loadObject(ctx context.Context, uri, jobID string) error
+}
+
+// loadJobID returns the ID of the given load job of the object at the URI, counted from
+// 0. Retries of a job use the same ID, so a job BigQuery accepted before the attempt
+// failed or the adapter stopped isn't run a second time. Only once a job failed, the
+// next one is run.
+func loadJobID(uri string, job int) string {
+	sum := sha256.Sum256([]byte(uri))
+	return fmt.Sprintf("prombq_load_%s_%d", hex.EncodeToString(sum[:16]), job)
+}
+
+// WithLoadJobWrites writes the rows with load jobs instead of streaming inserts, which
+// are cheaper and don't count against the streaming quotas, at the cost of a delay until
+// the samples can be read. The rows are staged as objects of newline-delimited JSON
+// compressed with gzip in the location, given as gs://bucket/prefix or gcs://bucket/prefix.
+// An object is loaded once its uncompressed rows exceed maxBytes or its first row is
+// older than the interval. Cloud Storage is accessed with the credentials of the options.
+func WithLoadJobWrites(location string, maxBytes int64, interval time.Duration, opts ...option.ClientOption) Option {
+	return func(c *BigqueryClient) {
+		c.stageLocation = location
+		c.stageMaxBytes = maxBytes
+		c.stageInterval = interval
+		c.stageOptions = opts
+	}
+}
+
+// stagedObject is an object of rows staged for a load job.
+type stagedObject struct {
+	// name is the name of the object in the store, key the name it's stored with by put.
+	name string
+	key  string
+	// data is the content of the object until it is uploaded.
+	data []byte
+	rows int
+	// staged is when the first row of the object was staged. It is zero for objects
+	// left by a previous run.
+	staged   time.Time
+	uploaded bool
+	loaded   bool
+	attempts int
+	// jobs is the number of load jobs of the object which failed, unloadable is set once
+	// its rows are invalid or too many of them failed.
+	jobs       int
+	unloadable bool
+}
+
+// stager buffers the rows written to the table in an object, which is uploaded to Cloud
+// Storage and loaded into the table with a load job once it's full or old enough. Objects
+// whose upload or load job failed are kept and retried, objects are only removed once
+// loaded.
+type stager struct {
+	mu       sync.Mutex
+	store    stageStore
+	loader   objectLoader
+	maxBytes int64
+	interval time.Duration
+	timeout  time.Duration
+	encode   func(*Item, time.Time) loadRow
+	now      func() time.Time
+	logger   *slog.Logger
+	// buf holds the compressed rows of the current object.
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	size    int64
+	rows    int
+	first   time.Time
+	nextSeq uint64
+	objects []*stagedObject
+	closed  bool
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	stagedBytes prometheus.Counter
+	loadJobs    *prometheus.CounterVec
+	delay       prometheus.Histogram
+	quarantined prometheus.Counter
+}
+
+// Put implements Inserter, it appends the rows to the current object. It fails while too
+// many full objects couldn't be uploaded yet.
+func (s *stager) Put(_ context.Context, src interface{}) error {
+	rows, ok := src.([]*Item)
+	if !ok {
+		return errors.Errorf("unsupported rows of type %T", src)
+	}
+	var lines bytes.Buffer
+	now := s.now()
+	enc := json.NewEncoder(&lines)
+	for _, item := range rows {
+		if err := enc.Encode(s.encode(item, now)); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("load job writes are stopped")
+	}
+	if s.sealed() >= maxSealedObjects {
+		return unavailable(errors.Errorf("%d staged objects are waiting to be uploaded to cloud storage", maxSealedObjects))
+	}
+	if s.rows == 0 {
+		s.first = now
+	}
+	if _, err := s.gz.Write(lines.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to compress the staged rows")
+	}
+	s.size += int64(lines.Len())
+	s.rows += len(rows)
+	if s.size >= s.maxBytes {
+		if err := s.seal(); err != nil {
+			return err
+		}
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// sealed returns the number of objects which haven't been uploaded yet.
+func (s *stager) sealed() int {
+	n := 0
+	for _, obj := range s.objects {
+		if !obj.uploaded {
+			n++
+		}
+	}
+	return n
+}
+
+// seal completes the current object and queues it for the upload. It must be called
+// with the lock held.
+func (s *stager) seal() error {
+	if s.rows == 0 {
+		return nil
+	}
+	if err := s.gz.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress the staged rows")
+	}
+	name := fmt.Sprintf("%d-%d%s", s.first.UnixNano(), s.nextSeq, stageObjectExt)
+	s.objects = append(s.objects, &stagedObject{
+		name:   s.store.object(name),
+		key:    name,
+		data:   bytes.Clone(s.buf.Bytes()),
+		rows:   s.rows,
+		staged: s.first,
+	})
+	s.nextSeq++
+	s.buf.Reset()
+	s.gz.Reset(&s.buf)
+	s.size, s.rows = 0, 0
+	return nil
+}
+
+// len returns the number of objects which haven't been loaded yet.
+func (s *stager) len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+// recover queues the objects left in the store by a previous run for their load jobs.
+func (s *stager) recover(ctx context.Context) error {
+	names, err := s.store.list(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the staged objects")
+	}
+	sort.Strings(names)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		s.objects = append(s.objects, &stagedObject{name: name, uploaded: true})
+	}
+	if len(names) > 0 {
+		s.logger.Info("loading objects staged by a previous run", slog.Int("objects", len(names)))
+	}
+	return nil
+}
+
+// start processes the objects periodically, and as soon as one is full, until close is called.
+func (s *stager) start() {
+	go func() {
+		defer close(s.stopped)
+		// Objects are sealed at most a quarter of the interval after they are due.
+		ticker := time.NewTicker(max(s.interval/4, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.kick:
+			case <-s.done:
+				return
+			}
+			s.process(false)
+		}
+	}()
+}
+
+// close stops the processing and loads the current object, as well as the objects whose
+// upload or load job failed before. Objects which still fail are left in the store
+// for the next run, if they could be uploaded.
+func (s *stager) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	close(s.done)
+	<-s.stopped
+	s.process(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lost := 0
+	for _, obj := range s.objects {
+		if !obj.uploaded {
+			lost += obj.rows
+		}
+	}
+	if len(s.objects) > 0 {
+		s.logger.Warn("staged objects weren't loaded", slog.Int("objects", len(s.objects)), slog.Int("lost_samples", lost))
+	}
+}
+
+// process seals the current object if it's due, or always if final is set, uploads the
+// sealed objects and loads the uploaded ones.
+func (s *stager) process(final bool) {
+	s.mu.Lock()
+	if s.rows > 0 && (final || s.now().Sub(s.first) >= s.interval) {
+		if err := s.seal(); err != nil {
+			s.logger.Warn("failed to seal the staged object", slog.Any("error", err))
+		}
+	}
+	objects := slices.Clone(s.objects)
+	s.mu.Unlock()
+
+	for _, obj := range objects {
+		if !s.processObject(obj) {
+			continue
+		}
+		s.mu.Lock()
+		s.objects = slices.DeleteFunc(s.objects, func(o *stagedObject) bool { return o == obj })
+		s.mu.Unlock()
+	}
+}
+
+// processObject uploads the object if needed, loads it and removes it from the store.
+// It returns whether the object is done with.
+func (s *stager) processObject(obj *stagedObject) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	logger := s.logger.With(slog.String("object", obj.name))
+	if !obj.uploaded {
+		if err := s.store.put(ctx, obj.key, obj.data); err != nil {
+			logger.Warn("failed to upload the staged object to cloud storage", slog.Any("error", err))
+			return false
+		}
+		s.stagedBytes.Add(float64(len(obj.data)))
+		s.mu.Lock()
+		obj.uploaded, obj.data = true, nil
+		s.mu.Unlock()
+	}
+	if !obj.loaded && !obj.unloadable {
+		uri := s.store.uri(obj.name)
+		if err := s.loader.loadObject(ctx, uri, loadJobID(uri, obj.jobs)); err != nil {
+			obj.attempts++
+			s.loadJobs.WithLabelValues("failed").Inc()
+			var jobErr *loadJobError
+			if !errors.As(err, &jobErr) {
+				logger.Warn("load job of the staged object failed, retrying", slog.Int("attempts", obj.attempts), slog.Any("error", err))
+				return false
+			}
+			// The job loaded no rows, the next attempt runs a new one.
+			obj.jobs++
+			if !jobErr.permanent() && obj.jobs < maxLoadJobs {
+				logger.Warn("load job of the staged object failed, retrying", slog.Int("attempts", obj.attempts), slog.Any("error", err))
+				return false
+			}
+			logger.Error("the rows of the staged object can't be loaded", slog.Int("load_jobs", obj.jobs), slog.Any("error", err))
+			obj.unloadable = true
+		} else {
+			s.loadJobs.WithLabelValues("succeeded").Inc()
+			if !obj.staged.IsZero() {
+				s.delay.Observe(s.now().Sub(obj.staged).Seconds())
+			}
+			obj.loaded = true
+		}
+	}
+	if obj.unloadable {
+		// Moved out of the prefix, the object isn't loaded again by the next run, but
+		// kept for an inspection.
+		object, err := s.store.quarantine(ctx, obj.name)
+		if err != nil {
+			logger.Warn("failed to move the staged object to the quarantine prefix", slog.Any("error", err))
+			return false
+		}
+		s.quarantined.Inc()
+		logger.Warn("moved the staged object to the quarantine prefix", slog.String("quarantined_object", object), slog.Int("samples", obj.rows))
+		return true
+	}
+	// A loaded object left in the store would be loaded again by the next run.
+	if err := s.store.remove(ctx, obj.name); err != nil {
+		logger.Warn("failed to remove the loaded object from cloud storage", slog.Any("error", err))
+		return false
+	}
+	return true
+}
+
+// startStager replaces the inserter of the client by a stager, if load job writes are
+// configured, and starts it.
+func (c *BigqueryClient) startStager(ctx context.Context) error {
+	if c.stageLocation == "" {
+		return nil
+	}
+	s, err := c.newStager(ctx)
+	if err != nil {
+		return err
+	}
+	c.stager = s
+	c.inserter = s
+	s.start()
+	return nil
+}
+
+// newStager creates the stager of the client and picks up the objects left by a previous run.
+func (c *BigqueryClient) newStager(ctx context.Context) (*stager, error) {
+	if c.stageStore == nil {
+		scheme, rest, _ := strings.Cut(c.stageLocation, "://")
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if (scheme != "gs" && scheme != "gcs") || bucket == "" {
+			return nil, errors.Errorf("unsupported load job location %s, use gs://bucket/prefix", c.stageLocation)
+		}
+		// Every client stages its objects under its own prefix.
+		if prefix != "" {
+			prefix = strings.TrimSuffix(prefix, "/") + "/"
+		}
+		store, err := newGCSObjects(ctx, bucket, prefix+c.name+"/", stageObjectExt, "application/gzip", c.stageOptions...)
+		if err != nil {
+			return nil, err
+		}
+		store.quarantinePrefix = prefix + stageQuarantinePrefix + c.name + "/"
+		c.stageStore = store
+	}
+	if c.objectLoader == nil {
+		c.objectLoader = &bigqueryLoader{
+			table:    c.table(c.datasetID, c.tableID),
+			location: c.location,
+			labels:   c.jobLabels,
+		}
+	}
+	s := &stager{
+		store:       c.stageStore,
+		loader:      c.objectLoader,
+		maxBytes:    c.stageMaxBytes,
+		interval:    c.stageInterval,
+		timeout:     max(c.writeTimeout, c.stageInterval),
+		encode:      c.loadRow,
+		now:         time.Now,
+		logger:      c.logger,
+		kick:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		stagedBytes: c.loadStagedBytes,
+		loadJobs:    c.loadJobs,
+		delay:       c.loadDelay,
+		quarantined: c.loadQuarantined,
+	}
+	s.gz = gzip.NewWriter(&s.buf)
+	recoverCtx, cancel := context.WithTimeout(ctx, c.writeTimeout)
+	defer cancel()
+	if err := s.recover(recoverCtx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
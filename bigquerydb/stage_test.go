@@ -0,0 +1,401 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStageStore keeps the staged objects in memory, under the prefix.
+type fakeStageStore struct {
+	mu        sync.Mutex
+	prefix    string
+	objects   map[string][]byte
+	putErr    error
+	removeErr error
+}
+
+func (s *fakeStageStore) put(_ context.Context, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.putErr != nil {
+		return s.putErr
+	}
+	s.objects[s.object(name)] = data
+	return nil
+}
+
+func (s *fakeStageStore) list(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, s.prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fakeStageStore) remove(_ context.Context, object string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removeErr != nil {
+		return s.removeErr
+	}
+	delete(s.objects, object)
+	return nil
+}
+
+func (s *fakeStageStore) object(name string) string {
+	return s.prefix + name
+}
+
+func (s *fakeStageStore) uri(object string) string {
+	return "gs://bucket/" + object
+}
+
+func (s *fakeStageStore) quarantine(_ context.Context, object string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	to := "quarantine/" + object
+	s.objects[to] = s.objects[object]
+	delete(s.objects, object)
+	return to, nil
+}
+
+func (s *fakeStageStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+// fakeObjectLoader loads the objects of the store, after failing the given number of jobs.
+// Like BigQuery, it doesn't run a job whose ID it accepted before again. With timeouts, the
+// given number of accepted jobs fail like a Wait which timed out. With jobErr, every job
+// fails with it.
+type fakeObjectLoader struct {
+	mu       sync.Mutex
+	store    *fakeStageStore
+	failures int
+	timeouts int
+	jobErr   error
+	jobs     map[string]bool
+	jobIDs   []string
+	uris     []string
+	rows     []loadRow
+}
+
+func (l *fakeObjectLoader) loadObject(_ context.Context, uri, jobID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.uris = append(l.uris, uri)
+	l.jobIDs = append(l.jobIDs, jobID)
+	if l.failures > 0 {
+		l.failures--
+		return errors.New("load job failed")
+	}
+	if l.jobErr != nil {
+		return &loadJobError{id: jobID, err: l.jobErr}
+	}
+	if l.jobs[jobID] {
+		return nil
+	}
+	l.store.mu.Lock()
+	data, ok := l.store.objects[strings.TrimPrefix(uri, "gs://bucket/")]
+	l.store.mu.Unlock()
+	if !ok {
+		return errors.New("object not found")
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var row loadRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return err
+		}
+		l.rows = append(l.rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if l.jobs == nil {
+		l.jobs = map[string]bool{}
+	}
+	l.jobs[jobID] = true
+	if l.timeouts > 0 {
+		l.timeouts--
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func (l *fakeObjectLoader) loaded() ([]string, []loadRow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.uris, l.rows
+}
+
+// newStageClient returns a client with load job writes to the fake store and loader, and
+// its stager, which isn't started.
+func newStageClient(t *testing.T, maxBytes int64, objects map[string][]byte) (*BigqueryClient, *stager, *fakeStageStore, *fakeObjectLoader) {
+	c := newTestClient(nil, WithLoadJobWrites("gs://bucket/prefix", maxBytes, time.Minute))
+	store := &fakeStageStore{prefix: "prefix/bigquerydb/", objects: objects}
+	loader := &fakeObjectLoader{store: store}
+	c.stageStore, c.objectLoader = store, loader
+	s, err := c.newStager(context.Background())
+	assert.NoError(t, err)
+	c.stager, c.inserter = s, s
+	return c, s, store, loader
+}
+
+func TestStagerRotation(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 300, map[string][]byte{})
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 2)))
+	s.process(false)
+	uris, _ := loader.loaded()
+	assert.Empty(t, uris, "the object is neither full nor due")
+
+	// Rotated by size.
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	assert.Equal(t, 1, s.len())
+	now = now.Add(5 * time.Second)
+	s.process(false)
+	uris, rows := loader.loaded()
+	if assert.Len(t, uris, 1) {
+		assert.True(t, strings.HasPrefix(uris[0], "gs://bucket/prefix/bigquerydb/"), uris[0])
+		assert.True(t, strings.HasSuffix(uris[0], stageObjectExt), uris[0])
+	}
+	assert.Len(t, rows, 5)
+	assert.Equal(t, 0, store.len(), "loaded objects are removed")
+	assert.Equal(t, 0, s.len())
+
+	// Rotated by time.
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 1)))
+	now = now.Add(59 * time.Second)
+	s.process(false)
+	uris, _ = loader.loaded()
+	assert.Len(t, uris, 1)
+	now = now.Add(time.Second)
+	s.process(false)
+	uris, rows = loader.loaded()
+	assert.Len(t, uris, 2)
+	assert.Len(t, rows, 6)
+	assert.Equal(t, "up", rows[5].MetricName)
+
+	assert.Equal(t, 2.0, metricValue(c.loadJobs.WithLabelValues("succeeded")))
+	assert.Greater(t, metricValue(c.loadStagedBytes), 0.0)
+	metrics := scrape(t, c)
+	assert.Equal(t, 2.0, metrics["storage_bigquery_load_delay_seconds_count"])
+	assert.Equal(t, 65.0, metrics["storage_bigquery_load_delay_seconds_sum"])
+}
+
+func TestStagerLoadRetry(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	loader.failures = 2
+
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	s.process(false)
+	s.process(false)
+	assert.Equal(t, 1, store.len(), "the object of failed load jobs is kept")
+	assert.Equal(t, 1, s.len())
+	assert.Equal(t, 2.0, metricValue(c.loadJobs.WithLabelValues("failed")))
+
+	s.process(false)
+	uris, rows := loader.loaded()
+	assert.Len(t, uris, 3)
+	assert.Equal(t, uris[0], uris[2], "the same object is loaded again")
+	assert.Len(t, rows, 1)
+	assert.Equal(t, 0, store.len())
+	assert.Equal(t, 1.0, metricValue(c.loadJobs.WithLabelValues("succeeded")))
+}
+
+func TestStagerLoadTimeout(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	loader.timeouts = 1
+
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	s.process(false)
+	assert.Equal(t, 1, store.len(), "the object is kept while the load job is unknown")
+	assert.Equal(t, 1.0, metricValue(c.loadJobs.WithLabelValues("failed")))
+
+	s.process(false)
+	uris, rows := loader.loaded()
+	assert.Len(t, uris, 2)
+	assert.Len(t, rows, 1, "the retry waits for the accepted job instead of loading the rows again")
+	assert.Equal(t, 0, store.len())
+	assert.Equal(t, 1.0, metricValue(c.loadJobs.WithLabelValues("succeeded")))
+}
+
+func TestStagerRecoverLoaded(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	store.removeErr = errUnavailable
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	s.process(false)
+	assert.Equal(t, 1, store.len(), "the object isn't removed")
+
+	// The next run finds the loaded object again.
+	store.removeErr = nil
+	s, err := c.newStager(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.len())
+	s.process(false)
+	_, rows := loader.loaded()
+	assert.Len(t, rows, 1, "the load job of the previous run isn't run again")
+	assert.Equal(t, 0, store.len())
+}
+
+func TestStagerLoadJobFailures(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	loader.jobErr = &bigquery.Error{Reason: "backendError", Message: "error"}
+
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	for i := 0; i < maxLoadJobs+2; i++ {
+		s.process(false)
+	}
+	loader.mu.Lock()
+	jobIDs := loader.jobIDs
+	loader.mu.Unlock()
+	if assert.Len(t, jobIDs, maxLoadJobs, "the attempts are capped") {
+		for i, id := range jobIDs {
+			assert.True(t, strings.HasSuffix(id, fmt.Sprintf("_%d", i)), "every failed job is followed by a new one: %s", id)
+		}
+	}
+	assert.Equal(t, 0, s.len())
+	assert.Equal(t, 1, store.len())
+	for name := range store.objects {
+		assert.True(t, strings.HasPrefix(name, "quarantine/"), "the object is moved to the quarantine prefix: %s", name)
+	}
+	assert.Equal(t, 1.0, metricValue(c.loadQuarantined))
+	assert.Equal(t, float64(maxLoadJobs), metricValue(c.loadJobs.WithLabelValues("failed")))
+}
+
+func TestStagerInvalidRows(t *testing.T) {
+	c, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	loader.jobErr = &bigquery.Error{Reason: "invalid", Message: "no such field: foo"}
+
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	s.process(false)
+	uris, _ := loader.loaded()
+	assert.Len(t, uris, 1, "invalid rows aren't loaded again")
+	assert.Equal(t, 0, s.len())
+	assert.Equal(t, 1, store.len())
+	assert.Equal(t, 1.0, metricValue(c.loadQuarantined))
+}
+
+func TestLoadJobID(t *testing.T) {
+	id := loadJobID("gs://bucket/prefix/bigquerydb/1-0.json.gz", 0)
+	assert.Equal(t, id, loadJobID("gs://bucket/prefix/bigquerydb/1-0.json.gz", 0))
+	assert.NotEqual(t, id, loadJobID("gs://bucket/prefix/bigquerydb/1-0.json.gz", 1))
+	assert.NotEqual(t, id, loadJobID("gs://bucket/prefix/bigquerydb/2-0.json.gz", 0))
+	assert.Regexp(t, "^[a-zA-Z0-9_-]+$", id)
+}
+
+func TestStagerUploadFailure(t *testing.T) {
+	_, s, store, loader := newStageClient(t, 1, map[string][]byte{})
+	store.putErr = errUnavailable
+
+	for i := 0; i < maxSealedObjects; i++ {
+		assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+	}
+	s.process(false)
+	err := s.Put(context.Background(), []*Item{{metricname: "up", value: 1}})
+	assert.ErrorIs(t, err, ErrUnavailable, "writes fail while too many objects can't be uploaded")
+
+	store.mu.Lock()
+	store.putErr = nil
+	store.mu.Unlock()
+	s.process(false)
+	_, rows := loader.loaded()
+	assert.Len(t, rows, maxSealedObjects)
+	assert.Equal(t, 0, s.len())
+	assert.NoError(t, s.Put(context.Background(), []*Item{{metricname: "up", value: 1}}))
+}
+
+func TestStagerRecover(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(`{"metricname":"up","timestamp":"2026-01-01 00:00:00","value":1}` + "\n"))
+	assert.NoError(t, gz.Close())
+	objects := map[string][]byte{
+		"prefix/bigquerydb/1-0.json.gz": buf.Bytes(),
+		"prefix/other/1-0.json.gz":      buf.Bytes(),
+	}
+	c, s, store, loader := newStageClient(t, 1<<20, objects)
+
+	assert.Equal(t, 1, s.len(), "objects of other clients are left alone")
+	s.process(false)
+	uris, rows := loader.loaded()
+	assert.Equal(t, []string{"gs://bucket/prefix/bigquerydb/1-0.json.gz"}, uris)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, 1, store.len())
+	assert.Equal(t, 0.0, scrape(t, c)["storage_bigquery_load_delay_seconds_count"], "the delay of objects of a previous run is unknown")
+}
+
+func TestLoadJobWritesShutdown(t *testing.T) {
+	c := newTestClient(nil, WithLoadJobWrites("gs://bucket/prefix", 1<<20, time.Hour))
+	store := &fakeStageStore{prefix: "prefix/bigquerydb/", objects: map[string][]byte{}}
+	loader := &fakeObjectLoader{store: store}
+	c.stageStore, c.objectLoader = store, loader
+	assert.NoError(t, c.startStager(context.Background()))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 3)))
+	uris, _ := loader.loaded()
+	assert.Empty(t, uris)
+	assert.Equal(t, 3.0, metricValue(c.writtenRows), "staged samples count as written")
+
+	assert.NoError(t, c.Close())
+	uris, rows := loader.loaded()
+	assert.Len(t, uris, 1, "the current object is loaded on shutdown")
+	assert.Len(t, rows, 3)
+	assert.Equal(t, 0, store.len())
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 1)), "writes fail once stopped")
+}
+
+func TestLoadJobWritesLocation(t *testing.T) {
+	c := newTestClient(nil, WithLoadJobWrites("/tmp/staging", 1<<20, time.Hour))
+	assert.ErrorContains(t, c.startStager(context.Background()), "unsupported load job location")
+}
+
+func TestLoadJobWritesStartFailure(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewClient(nil, "", "project", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"),
+		WithLoadJobWrites("/tmp/staging", 1<<20, time.Hour), WithSpill(dir, 1<<20, time.Hour))
+	assert.ErrorContains(t, err, "unsupported load job location")
+	assert.NoDirExists(t, filepath.Join(dir, "bigquerydb"), "the spill isn't opened before the load job writes")
+}
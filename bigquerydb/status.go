@@ -0,0 +1,69 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ClientStatus describes the table of a client and the state of its optional components.
+type ClientStatus struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+	Dataset string `json:"dataset"`
+	Table   string `json:"table"`
+	// InsertQueueDepth is only set with a pool of insert workers.
+	InsertQueueDepth *int `json:"insert_queue_depth,omitempty"`
+	// BufferedSamples is only set in asynchronous write mode.
+	BufferedSamples *int `json:"buffered_samples,omitempty"`
+	// CircuitBreaker is the state of the circuit breaker, if configured.
+	CircuitBreaker string `json:"circuit_breaker,omitempty"`
+}
+
+// Status returns the status of the client. The states are read from the metrics of the client.
+func (c *BigqueryClient) Status() ClientStatus {
+	conn := c.acquire()
+	defer conn.release()
+	status := ClientStatus{
+		Name:    c.name,
+		Project: conn.client.Project(),
+		Dataset: c.datasetID,
+		Table:   c.tableID,
+	}
+	if c.dataProjectID != "" {
+		status.Project = c.dataProjectID
+	}
+	if c.pool != nil {
+		depth := int(gaugeValue(c.insertQueueDepth))
+		status.InsertQueueDepth = &depth
+	}
+	if c.buffer != nil {
+		buffered := int(gaugeValue(c.bufferedSamples))
+		status.BufferedSamples = &buffered
+	}
+	if c.breaker != nil {
+		status.CircuitBreaker = breakerStateNames[int(gaugeValue(c.breakerState))]
+	}
+	return status
+}
+
+// gaugeValue returns the current value of a gauge.
+func gaugeValue(m prometheus.Metric) float64 {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		return 0
+	}
+	return out.GetGauge().GetValue()
+}
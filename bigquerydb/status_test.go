@@ -0,0 +1,42 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	c := newTestClient(&fakeInserter{})
+	assert.Equal(t, ClientStatus{Name: "bigquerydb", Dataset: "dataset", Table: "table"}, c.Status())
+
+	c = newTestClient(&fakeInserter{}, WithAsyncWrites(100, time.Hour), WithInsertConcurrency(1, 1), WithCircuitBreaker(5, 0, 0, time.Minute, 1))
+	defer c.Close()
+	assert.NoError(t, c.Write(context.Background(), loadTestSeries()))
+
+	status := c.Status()
+	if assert.NotNil(t, status.BufferedSamples) {
+		assert.Equal(t, 2, *status.BufferedSamples)
+	}
+	if assert.NotNil(t, status.InsertQueueDepth) {
+		assert.Zero(t, *status.InsertQueueDepth)
+	}
+	assert.Equal(t, "closed", status.CircuitBreaker)
+}
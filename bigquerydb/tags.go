@@ -0,0 +1,177 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Types of the tags column.
+const (
+	// TagsTypeString stores the tags as a JSON encoded STRING.
+	TagsTypeString = "string"
+	// TagsTypeJSON stores the tags in a column of the native JSON type.
+	TagsTypeJSON = "json"
+	// TagsTypeLabels stores the labels in the column labels of type
+	// REPEATED RECORD<name STRING, value STRING> instead of the tags column.
+	TagsTypeLabels = "labels"
+	// TagsTypeAuto detects the type from the schema of the table.
+	TagsTypeAuto = "auto"
+)
+
+// itemLabel is a label of a row in the labels column.
+type itemLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// detectTagsType sets the type of the tags column from the schema of the table. A table
+// with a labels column uses it instead of the tags column.
+func (c *BigqueryClient) detectTagsType(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	md, err := c.tableAdmin.Metadata(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", c.tableName(c.datasetID, c.tableID))
+	}
+	var tags, labels *bigquery.FieldSchema
+	for _, field := range md.Schema {
+		switch field.Name {
+		case "tags":
+			tags = field
+		case "labels":
+			labels = field
+		}
+	}
+	switch {
+	case tags != nil && labels != nil:
+		return errors.Errorf("table %s has both a tags and a labels column", c.tableName(c.datasetID, c.tableID))
+	case labels != nil:
+		c.tagsType = TagsTypeLabels
+	case tags == nil:
+		return errors.Errorf("table %s has neither a tags nor a labels column", c.tableName(c.datasetID, c.tableID))
+	case tags.Type == bigquery.StringFieldType:
+		c.tagsType = TagsTypeString
+	case tags.Type == bigquery.JSONFieldType:
+		c.tagsType = TagsTypeJSON
+	default:
+		return errors.Errorf("column tags of table %s has the unsupported type %s", c.tableName(c.datasetID, c.tableID), sqlTypeName(tags.Type))
+	}
+	return nil
+}
+
+// tagsColumnSQL returns the SQL selecting the labels of a row. JSON values can't be sorted,
+// and TO_JSON_STRING always serializes equal values the same way, so the rows of a series
+// read from a JSON column still have equal tags.
+func (c *BigqueryClient) tagsColumnSQL() string {
+	switch c.tagsType {
+	case TagsTypeJSON:
+		return "TO_JSON_STRING(tags) AS tags"
+	case TagsTypeLabels:
+		return "labels"
+	}
+	return "tags"
+}
+
+// tagsColumn returns the name of the column holding the labels.
+func (c *BigqueryClient) tagsColumn() string {
+	if c.tagsType == TagsTypeLabels {
+		return "labels"
+	}
+	return "tags"
+}
+
+// tagsSortSQL returns the SQL sorting rows by their labels. Arrays can't be sorted, but
+// the labels of a series are always written in the same order.
+func (c *BigqueryClient) tagsSortSQL() string {
+	if c.tagsType == TagsTypeLabels {
+		return "TO_JSON_STRING(labels)"
+	}
+	return "tags"
+}
+
+// loadTags returns the tags of a row of a load job, which are nil when the labels column
+// is used. A JSON string in a JSON column would be loaded as a JSON string value instead
+// of an object, so they are embedded as an object.
+// Streaming inserts take the JSON of a JSON column as a string, which is why rows written
+// with Write always contain the tags as a string.
+func (c *BigqueryClient) loadTags(tags string) interface{} {
+	switch c.tagsType {
+	case TagsTypeJSON:
+		return json.RawMessage(tags)
+	case TagsTypeLabels:
+		return nil
+	}
+	return tags
+}
+
+// labelsFromMetric returns the labels of the metric without the metric name, sorted by name.
+func labelsFromMetric(m model.Metric) []itemLabel {
+	labels := make([]itemLabel, 0, len(m))
+	for l, v := range m {
+		if l != model.MetricNameLabel {
+			labels = append(labels, itemLabel{Name: string(l), Value: string(v)})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+// labelsMatcherSQL returns the condition for a matcher on a label in the labels column,
+// which compares the name of the label with the named query parameter nameParam, and its
+// value with the named query parameter param, and the value of that parameter. Like in
+// Prometheus a missing label is the same as a label with an empty value, so matchers
+// matching the empty value match as long as no label with the name has a value the
+// matcher doesn't match.
+func labelsMatcherSQL(m *prompb.LabelMatcher, nameParam, param string) (string, interface{}, error) {
+	if m.Name == "" || !utf8.ValidString(m.Name) {
+		return "", nil, errors.Errorf("invalid label name %q", m.Name)
+	}
+	condition, value, err := compareSQL("l.value", m, param)
+	if err != nil {
+		return "", nil, err
+	}
+	if condition == matchAllSQL || condition == matchNothingSQL {
+		return condition, nil, nil
+	}
+	if matchesEmpty(m) {
+		return fmt.Sprintf("NOT EXISTS(SELECT 1 FROM UNNEST(labels) l WHERE l.name = @%s AND NOT (%s))", nameParam, condition), value, nil
+	}
+	return fmt.Sprintf("EXISTS(SELECT 1 FROM UNNEST(labels) l WHERE l.name = @%s AND %s)", nameParam, condition), value, nil
+}
+
+// matchesEmpty returns whether the matcher, whose regex is valid, matches the empty value.
+func matchesEmpty(m *prompb.LabelMatcher) bool {
+	switch m.Type {
+	case prompb.LabelMatcher_EQ:
+		return m.Value == ""
+	case prompb.LabelMatcher_NEQ:
+		return m.Value != ""
+	case prompb.LabelMatcher_RE:
+		return regexp.MustCompile(anchorRegex(m.Value)).MatchString("")
+	case prompb.LabelMatcher_NRE:
+		return !regexp.MustCompile(anchorRegex(m.Value)).MatchString("")
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectTagsType(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		schema   bigquery.Schema
+		err      error
+		expected string
+		errMsg   string
+	}{
+		{name: "string", schema: adapterSchema(), expected: TagsTypeString},
+		{name: "json", schema: bigquery.Schema{{Name: "tags", Type: bigquery.JSONFieldType}}, expected: TagsTypeJSON},
+		{name: "labels", schema: labelsSchema(), expected: TagsTypeLabels},
+		{name: "unsupported", schema: bigquery.Schema{{Name: "tags", Type: bigquery.BytesFieldType}}, errMsg: "unsupported type BYTES"},
+		{name: "tags and labels", schema: append(labelsSchema(), &bigquery.FieldSchema{Name: "tags", Type: bigquery.StringFieldType}), errMsg: "both a tags and a labels column"},
+		{name: "missing", schema: bigquery.Schema{{Name: "metricname", Type: bigquery.StringFieldType}}, errMsg: "neither a tags nor a labels column"},
+		{name: "metadata error", err: errors.New("permission denied"), errMsg: "permission denied"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: tc.schema}, metadataErr: tc.err}
+			c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTagsType(TagsTypeAuto))
+
+			err := c.detectTagsType(context.Background())
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, c.tagsType)
+		})
+	}
+}
+
+// labelsSchema returns the schema of a table with a labels column.
+func labelsSchema() bigquery.Schema {
+	schema := adapterSchema()
+	schema[1] = &bigquery.FieldSchema{Name: "labels", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "value", Type: bigquery.StringFieldType},
+	}}
+	return schema
+}
+
+func TestBuildCommandLabels(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithTagsType(TagsTypeLabels))
+	command, params, err := c.buildCommand(&prompb.Query{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_NEQ, Name: "job", Value: "it's"},
+			{Type: prompb.LabelMatcher_RE, Name: `label"with'quotes`, Value: "(a.*)?"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT metricname, labels, UNIX_MILLIS(timestamp) as timestamp, value FROM `dataset.table` WHERE "+
+		"metricname = @m0 AND "+
+		"NOT EXISTS(SELECT 1 FROM UNNEST(labels) l WHERE l.name = @n1 AND NOT (l.value != @m1)) AND "+
+		"NOT EXISTS(SELECT 1 FROM UNNEST(labels) l WHERE l.name = @n2 AND NOT (REGEXP_CONTAINS(l.value, @m2))) AND "+
+		"timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end) ORDER BY timestamp", command)
+	assert.Equal(t, []bigquery.QueryParameter{
+		{Name: "m0", Value: "up"},
+		{Name: "n1", Value: "job"},
+		{Name: "m1", Value: "it's"},
+		{Name: "n2", Value: `label"with'quotes`},
+		{Name: "m2", Value: "^(?s:(a.*)?)$"},
+		{Name: "start", Value: int64(1000)},
+		{Name: "end", Value: int64(2000)},
+	}, params, "label names are passed as parameters, so any name works")
+
+	_, _, err = c.buildCommand(&prompb.Query{Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "", Value: "x"}}})
+	assert.Error(t, err)
+}
+
+// TestTagsRoundTrip writes series with every column type, turns the inserted rows into
+// the rows BigQuery returns for the read query, and reads them back.
+func TestTagsRoundTrip(t *testing.T) {
+	written := []*prompb.TimeSeries{
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "host.name", Value: "it's"}, {Name: "job", Value: `C:\temp "x"`}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 0}},
+		},
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "Grüße 日本"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 2}},
+		},
+	}
+
+	for _, tagsType := range []string{TagsTypeString, TagsTypeJSON, TagsTypeLabels} {
+		t.Run(tagsType, func(t *testing.T) {
+			ins := &fakeInserter{}
+			c := newTestClient(ins, WithTagsType(tagsType))
+			assert.NoError(t, c.Write(context.Background(), written))
+
+			querier := &fakeQuerier{}
+			for _, item := range ins.rows() {
+				saved, _, err := item.Save()
+				assert.NoError(t, err)
+				row := testRow(item.metricname, item.tags, item.timestamp*1000, item.value)
+				switch tagsType {
+				case TagsTypeJSON:
+					// A JSON column stores the parsed value, TO_JSON_STRING serializes it again.
+					var value interface{}
+					assert.NoError(t, json.Unmarshal([]byte(saved["tags"].(string)), &value))
+					serialized, err := json.Marshal(value)
+					assert.NoError(t, err)
+					row["tags"] = string(serialized)
+				case TagsTypeLabels:
+					// Repeated records are read as a slice of maps.
+					assert.NotContains(t, saved, "tags")
+					delete(row, "tags")
+					labels := []bigquery.Value{}
+					for _, l := range saved["labels"].([]itemLabel) {
+						labels = append(labels, map[string]bigquery.Value{"name": l.Name, "value": l.Value})
+					}
+					row["labels"] = labels
+				}
+				querier.rows = append(querier.rows, row)
+			}
+			c.querier = querier
+
+			resp, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{
+				StartTimestampMs: 1000,
+				EndTimestampMs:   2000,
+				Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+			}}})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, written, resp.Results[0].Timeseries)
+			if assert.Len(t, querier.queries, 1) {
+				assert.Contains(t, querier.queries[0].Q, "SELECT metricname, "+c.tagsColumnSQL()+",")
+			}
+		})
+	}
+}
+
+func TestLoadJSONTags(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithTagsType(TagsTypeJSON))
+
+	_, err := c.Load(context.Background(), loadTestSeries())
+	assert.NoError(t, err)
+	if assert.Len(t, loader.jobs, 1) {
+		assert.True(t, strings.HasPrefix(loader.jobs[0], `{"metricname":"up","tags":{"job":"api"},"timestamp":"2023-11-14 22:13:20","value":1}`),
+			"the tags are embedded as an object: %s", loader.jobs[0])
+	}
+}
+
+func TestLoadLabels(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithTagsType(TagsTypeLabels))
+
+	_, err := c.Load(context.Background(), loadTestSeries())
+	assert.NoError(t, err)
+	if assert.Len(t, loader.jobs, 1) {
+		assert.True(t, strings.HasPrefix(loader.jobs[0], `{"metricname":"up","labels":[{"name":"job","value":"api"}],"timestamp":"2023-11-14 22:13:20","value":1}`),
+			"the labels replace the tags: %s", loader.jobs[0])
+	}
+}
+
+func TestRowToSampleLabels(t *testing.T) {
+	row := testRow("up", "", 1000, 1)
+	delete(row, "tags")
+	row["labels"] = nil
+	_, _, labels, err := rowToSample(row)
+	assert.NoError(t, err)
+	assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}}, labels, "a NULL array has no labels")
+
+	row["labels"] = []bigquery.Value{map[string]bigquery.Value{"name": nil, "value": "api"}}
+	_, _, _, err = rowToSample(row)
+	assert.ErrorContains(t, err, "unexpected label name")
+}
+
+func TestValidateSchemaLabels(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: labelsSchema()}}
+	err := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTagsType(TagsTypeLabels)).ValidateSchema(context.Background())
+	assert.NoError(t, err)
+
+	var schemaErr *SchemaError
+	err = newTestClient(&fakeInserter{}, WithTableAdmin(&fakeTableAdmin{md: &bigquery.TableMetadata{Schema: adapterSchema()}}), WithTagsType(TagsTypeLabels)).
+		ValidateSchema(context.Background())
+	if assert.ErrorAs(t, err, &schemaErr) {
+		assert.Equal(t, []string{"column labels: missing, expected ARRAY<STRUCT<name STRING, value STRING>>"}, schemaErr.Mismatches)
+	}
+
+	schema := labelsSchema()
+	schema[1].Repeated = false
+	schema[1].Schema = bigquery.Schema{
+		{Name: "name", Type: bigquery.IntegerFieldType},
+		{Name: "comment", Type: bigquery.StringFieldType, Required: true},
+	}
+	err = newTestClient(&fakeInserter{}, WithTableAdmin(&fakeTableAdmin{md: &bigquery.TableMetadata{Schema: schema}}), WithTagsType(TagsTypeLabels)).
+		ValidateSchema(context.Background())
+	if assert.ErrorAs(t, err, &schemaErr) {
+		assert.Equal(t, []string{
+			"column labels: expected mode REPEATED, found NULLABLE",
+			"column labels.name: expected STRING, found INT64",
+			"column labels.value: missing, expected STRING",
+			"column labels.comment: the adapter doesn't write it, so it must not be REQUIRED",
+		}, schemaErr.Mismatches)
+	}
+}
+
+func TestValidateSchemaJSONTags(t *testing.T) {
+	schema := adapterSchema()
+	schema[1].Type = bigquery.JSONFieldType
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: schema}}
+
+	err := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTagsType(TagsTypeJSON)).ValidateSchema(context.Background())
+	assert.NoError(t, err)
+
+	err = newTestClient(&fakeInserter{}, WithTableAdmin(admin)).ValidateSchema(context.Background())
+	var schemaErr *SchemaError
+	if assert.ErrorAs(t, err, &schemaErr) {
+		assert.Equal(t, []string{"column tags: expected STRING, found JSON"}, schemaErr.Mismatches)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// templateSuffixPattern matches the suffixes BigQuery accepts for template tables.
+var templateSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// TemplateSuffix is the suffix of the tables rows are inserted into. BigQuery creates the
+// table of a suffix from the table written to, its template, on the first insert.
+type TemplateSuffix struct {
+	tmpl   *template.Template
+	labels map[string]string
+	// static is the suffix if it doesn't depend on the tenant.
+	static string
+}
+
+// templateSuffixData is what the template of a suffix is rendered with.
+type templateSuffixData struct {
+	Tenant string
+	Labels map[string]string
+}
+
+// ParseTemplateSuffix parses a text/template of the suffix of template tables, e.g. _dev,
+// _{{.Labels.env}} or _{{.Tenant}}. It receives the tenant of a write as .Tenant and the
+// static labels as .Labels. The suffix must only consist of letters, digits and underscores.
+func ParseTemplateSuffix(text string, staticLabels map[string]string) (*TemplateSuffix, error) {
+	tmpl, err := template.New("suffix").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the template suffix")
+	}
+	s := &TemplateSuffix{tmpl: tmpl, labels: staticLabels}
+	// The suffix is static if it is the same for different tenants.
+	first, err := s.render("tenant")
+	if err != nil {
+		return nil, err
+	}
+	second, err := s.render("other")
+	if err != nil {
+		return nil, err
+	}
+	if first == second {
+		s.static = first
+	}
+	return s, nil
+}
+
+// Static returns whether the suffix doesn't depend on the tenant.
+func (s *TemplateSuffix) Static() bool {
+	return s.static != ""
+}
+
+// render returns the suffix of the tables of the tenant.
+func (s *TemplateSuffix) render(tenant string) (string, error) {
+	if s.static != "" {
+		return s.static, nil
+	}
+	var b strings.Builder
+	if err := s.tmpl.Execute(&b, &templateSuffixData{Tenant: tenant, Labels: s.labels}); err != nil {
+		return "", errors.Wrap(err, "failed to render the template suffix")
+	}
+	suffix := b.String()
+	if !templateSuffixPattern.MatchString(suffix) {
+		return "", errors.Errorf("the template suffix %q must only consist of letters, digits and underscores", suffix)
+	}
+	return suffix, nil
+}
+
+// WithTemplateSuffix inserts rows into the template tables of the suffix instead of the
+// tables of the client and the routes, which are their templates. Reads select from the
+// table of a static suffix, and from all tables starting with the name of the template
+// otherwise. Load jobs still write to the template.
+func WithTemplateSuffix(suffix *TemplateSuffix) Option {
+	return func(c *BigqueryClient) {
+		c.templateSuffix = suffix
+	}
+}
+
+// templateSuffixFor returns the suffix of the rows of the tenant, which is empty without
+// template tables.
+func (c *BigqueryClient) templateSuffixFor(tenant string) (string, error) {
+	if c.templateSuffix == nil {
+		return "", nil
+	}
+	suffix, err := c.templateSuffix.render(tenant)
+	if err != nil {
+		return "", badRequest(err)
+	}
+	return suffix, nil
+}
+
+// templateInserter is implemented by inserters which can insert into template tables.
+type templateInserter interface {
+	withTemplateSuffix(suffix string) Inserter
+}
+
+func (i *tableInserter) withTemplateSuffix(suffix string) Inserter {
+	suffixed := *i
+	suffixed.templateSuffix = suffix
+	return &suffixed
+}
+
+// suffixedKey identifies the template table of a destination.
+type suffixedKey struct {
+	dest   *destination
+	suffix string
+}
+
+// suffixed returns the destination of the template table or the shard of dest with the
+// suffix. The destinations are created on first use.
+func (c *BigqueryClient) suffixed(dest *destination, suffix string) *destination {
+	if suffix == "" {
+		return dest
+	}
+	key := suffixedKey{dest: dest, suffix: suffix}
+	if d, ok := c.suffixedDests.Load(key); ok {
+		return d.(*destination)
+	}
+	inserter := dest.inserter
+	if inserter == nil {
+		inserter = c.inserter
+	}
+	if s, ok := inserter.(shardInserter); ok && c.dateSharding {
+		inserter = s.withTable(dest.tableID + suffix)
+	} else if t, ok := inserter.(templateInserter); ok && !c.dateSharding {
+		inserter = t.withTemplateSuffix(suffix)
+	}
+	d, _ := c.suffixedDests.LoadOrStore(key, &destination{datasetID: dest.datasetID, tableID: dest.tableID + suffix, inserter: inserter, shard: c.dateSharding})
+	return d.(*destination)
+}
+
+// templateTableSQL returns the reference to the tables read from instead of the table of a
+// destination with template tables or date sharding.
+func (c *BigqueryClient) templateTableSQL(datasetID, tableID string) string {
+	switch {
+	case c.dateSharding:
+		return c.tableRef(datasetID, tableID+"_*")
+	case c.templateSuffix == nil:
+		return c.tableRef(datasetID, tableID)
+	case c.templateSuffix.Static():
+		return c.tableRef(datasetID, tableID+c.templateSuffix.static)
+	default:
+		return c.tableRef(datasetID, tableID+"*")
+	}
+}
@@ -0,0 +1,122 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// templateFakeInserter is a fake inserter which records the template suffix it was
+// derived with. The rows of all suffixes are inserted into the same fake.
+type templateFakeInserter struct {
+	*fakeInserter
+	suffix string
+}
+
+func (f *templateFakeInserter) withTemplateSuffix(suffix string) Inserter {
+	return &templateFakeInserter{fakeInserter: &fakeInserter{}, suffix: suffix}
+}
+
+// mustParseTemplateSuffix parses a template suffix of valid tests.
+func mustParseTemplateSuffix(t *testing.T, text string, labels map[string]string) *TemplateSuffix {
+	suffix, err := ParseTemplateSuffix(text, labels)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return suffix
+}
+
+func TestParseTemplateSuffix(t *testing.T) {
+	labels := map[string]string{"env": "staging"}
+	for text, static := range map[string]bool{"_dev": true, "_{{.Labels.env}}": true, "_{{.Tenant}}": false, "_{{.Labels.env}}_{{.Tenant}}": false} {
+		suffix := mustParseTemplateSuffix(t, text, labels)
+		assert.Equal(t, static, suffix.Static(), text)
+	}
+	assert.Equal(t, "_staging", mustParseTemplateSuffix(t, "_{{.Labels.env}}", labels).static)
+
+	for text, errMsg := range map[string]string{
+		"_{{.Tenant":          "failed to parse the template suffix",
+		"_{{.Labels.region}}": `map has no entry for key "region"`,
+		"_{{.Team}}":          "can't evaluate field Team",
+		"-dev":                `the template suffix "-dev" must only consist of letters, digits and underscores`,
+		"":                    `the template suffix "" must only consist`,
+	} {
+		_, err := ParseTemplateSuffix(text, labels)
+		assert.ErrorContains(t, err, errMsg, text)
+	}
+}
+
+func TestTemplateSuffixWrite(t *testing.T) {
+	ins := &templateFakeInserter{fakeInserter: &fakeInserter{}}
+	c := newTestClient(ins, WithTemplateSuffix(mustParseTemplateSuffix(t, "_{{.Tenant}}", nil)), WithTenancy(true),
+		WithRoutes([]Route{{Metric: regexp.MustCompile("^up$"), TableID: "archive"}}))
+
+	assert.NoError(t, c.Write(ContextWithTenant(context.Background(), "team_a"), append(seriesWithSamples("up", 2), seriesWithSamples("sensor", 3)...)))
+	assert.NoError(t, c.Write(ContextWithTenant(context.Background(), "team_b"), seriesWithSamples("sensor", 1)))
+	assert.Empty(t, ins.rows(), "nothing is inserted into the template")
+
+	for table, rows := range map[string]int{"dataset.table_team_a": 3, "dataset.table_team_b": 1} {
+		dest := c.suffixed(c.defaultDestination, table[len("dataset.table"):])
+		assert.Equal(t, table, dest.name())
+		if inserter, ok := dest.inserter.(*templateFakeInserter); assert.True(t, ok) {
+			assert.Equal(t, table[len("dataset.table"):], inserter.suffix)
+			assert.Len(t, inserter.rows(), rows, table)
+		}
+		assert.Equal(t, float64(rows), metricValue(c.tableSentSamples.WithLabelValues(table)))
+	}
+	assert.Equal(t, 2.0, metricValue(c.tableSentSamples.WithLabelValues("dataset.archive_team_a")))
+
+	err := c.Write(ContextWithTenant(context.Background(), "team-c"), seriesWithSamples("sensor", 1))
+	assert.ErrorIs(t, err, ErrBadRequest)
+	assert.ErrorContains(t, err, `the template suffix "_team-c" must only consist`)
+}
+
+func TestTemplateSuffixInserter(t *testing.T) {
+	c, err := NewClient(nil, "", "project", "dataset", "table", time.Minute, WithEndpoint("http://localhost:9050"),
+		WithTemplateSuffix(mustParseTemplateSuffix(t, "_dev", nil)))
+	assert.NoError(t, err)
+	dest := c.suffixed(c.defaultDestination, "_dev")
+	if inserter, ok := dest.inserter.(*tableInserter); assert.True(t, ok) {
+		assert.Equal(t, "_dev", inserter.templateSuffix)
+		assert.Equal(t, "table", inserter.table.tableID, "the template is inserted into")
+		assert.True(t, inserter.skipInvalidRows)
+	}
+	assert.Empty(t, c.inserter.(*tableInserter).templateSuffix)
+}
+
+func TestTemplateSuffixReadTable(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithTemplateSuffix(mustParseTemplateSuffix(t, "_{{.Labels.env}}", map[string]string{"env": "dev"})))
+	query, _, err := c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `dataset.table_dev` WHERE ")
+
+	c = newTestClient(&fakeInserter{}, WithTemplateSuffix(mustParseTemplateSuffix(t, "_{{.Tenant}}", nil)), WithTenancy(true), WithRoutes(testRoutes()))
+	query, _, err = c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `dataset.table*` UNION ALL ")
+	assert.Contains(t, query, " FROM `short.buckets*`")
+
+	// The read table replaces the template tables.
+	c = newTestClient(&fakeInserter{}, WithTemplateSuffix(mustParseTemplateSuffix(t, "_dev", nil)), WithReadTable("dataset", "view"))
+	query, _, err = c.buildCommand(sensorQuery(1000, 2000))
+	assert.NoError(t, err)
+	assert.Contains(t, query, " FROM `dataset.view` WHERE ")
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// TenantLabel is the reserved label the tenant of a series is stored in with tenancy.
+const TenantLabel = "__tenant__"
+
+// ErrNoTenant is returned by Write and Read with tenancy when the context has no tenant.
+// It matches ErrBadRequest.
+var ErrNoTenant = badRequest(errors.New("no tenant given"))
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context for the writes and reads of the tenant.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the context, if it has one.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// WithTenancy separates the data of tenants, which Write and Read take from their
+// context. Every written series gets the tenant in the label TenantLabel, replacing any
+// such label sent by the tenant, and reads only return the series of their tenant,
+// without the label. Writes and reads without a tenant fail with ErrNoTenant.
+func WithTenancy(enabled bool) Option {
+	return func(c *BigqueryClient) {
+		c.tenancy = enabled
+	}
+}
+
+// tenant returns the tenant of the context with tenancy, and an empty tenant without.
+func (c *BigqueryClient) tenant(ctx context.Context) (string, error) {
+	if !c.tenancy {
+		return "", nil
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return tenant, nil
+}
+
+// tenantQuery returns a copy of the query which only matches the series of the tenant.
+// The matcher is combined with all other matchers, which can't widen it, and is part of
+// the key of cached queries.
+func tenantQuery(q *prompb.Query, tenant string) *prompb.Query {
+	scoped := *q
+	scoped.Matchers = make([]*prompb.LabelMatcher, 0, len(q.Matchers)+1)
+	scoped.Matchers = append(scoped.Matchers, q.Matchers...)
+	scoped.Matchers = append(scoped.Matchers, &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: TenantLabel, Value: tenant})
+	return &scoped
+}
+
+// withoutTenant returns the labels without the tenant label.
+func withoutTenant(labels []*prompb.Label) []*prompb.Label {
+	stripped := make([]*prompb.Label, 0, len(labels))
+	for _, l := range labels {
+		if l.Name != TenantLabel {
+			stripped = append(stripped, l)
+		}
+	}
+	return stripped
+}
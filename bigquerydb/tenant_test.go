@@ -0,0 +1,172 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTenant(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithTenancy(true))
+
+	err := c.Write(ContextWithTenant(context.Background(), "team-a"), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: TenantLabel, Value: "team-b"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, ins.rows(), 1) {
+		assert.Equal(t, `{"__tenant__":"team-a"}`, ins.rows()[0].tags, "the tenant can't write series of another tenant")
+	}
+
+	err = c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}},
+	}})
+	assert.ErrorIs(t, err, ErrNoTenant)
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 2, writeErr.FailedSamples)
+	}
+	assert.Len(t, ins.rows(), 1)
+}
+
+func TestWriteWithoutTenancy(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins)
+
+	assert.NoError(t, c.Write(ContextWithTenant(context.Background(), "team-a"), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}))
+	assert.Equal(t, "{}", ins.rows()[0].tags, "the tenant is ignored without tenancy")
+}
+
+// filteringQuerier returns the rows matching the conditions of the WHERE clause of a read
+// query, evaluated like BigQuery does for a table with a STRING tags column.
+type filteringQuerier struct {
+	t    *testing.T
+	rows []map[string]bigquery.Value
+}
+
+var tagsColumnPattern = regexp.MustCompile(`IFNULL\(JSON_VALUE\(tags, '\$\."([^"]+)"'\), ''\)`)
+
+func (f *filteringQuerier) Read(_ context.Context, query *bigquery.Query) (QueryIterator, error) {
+	params := map[string]interface{}{}
+	for _, p := range query.Parameters {
+		params["@"+p.Name] = p.Value
+	}
+	where := strings.TrimSuffix(strings.SplitN(query.Q, " WHERE ", 2)[1], " ORDER BY timestamp")
+
+	var rows []map[string]bigquery.Value
+	for _, row := range f.rows {
+		var tags map[string]string
+		assert.NoError(f.t, json.Unmarshal([]byte(row["tags"].(string)), &tags))
+		matches := true
+		for _, condition := range strings.Split(where, " AND ") {
+			if strings.Contains(condition, "TIMESTAMP_MILLIS") {
+				continue
+			}
+			// Every condition compares a single column with a single parameter.
+			param := regexp.MustCompile(`@m\d+`).FindString(condition)
+			condition = strings.Replace(condition, param, "@p", 1)
+			column, label := "metricname", row["metricname"].(string)
+			if m := tagsColumnPattern.FindStringSubmatch(condition); m != nil {
+				column, label = m[0], tags[m[1]]
+			}
+			matches = matches && evalComparison(f.t, column, condition, params[param], label)
+		}
+		if matches {
+			rows = append(rows, row)
+		}
+	}
+	return &fakeRowIterator{rows: rows}, nil
+}
+
+func TestReadTenantIsolation(t *testing.T) {
+	querier := &filteringQuerier{t: t, rows: []map[string]bigquery.Value{
+		testRow("up", `{"__tenant__":"team-a","job":"api"}`, 1000, 1),
+		testRow("up", `{"__tenant__":"team-b","job":"api"}`, 1000, 2),
+		testRow("up", `{"job":"api"}`, 1000, 3),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithTenancy(true))
+	ctx := ContextWithTenant(context.Background(), "team-a")
+
+	teamA := []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}}
+	testCases := map[string]struct {
+		matchers []*prompb.LabelMatcher
+		expected []*prompb.TimeSeries
+	}{
+		"metric":            {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}}, expected: teamA},
+		"all_metrics":       {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: ".*"}}, expected: teamA},
+		"other_tenant":      {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: TenantLabel, Value: "team-b"}}},
+		"any_tenant_regex":  {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: TenantLabel, Value: ".*"}}, expected: teamA},
+		"both_tenant_regex": {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: TenantLabel, Value: "team-a|team-b"}}, expected: teamA},
+		"not_own_tenant":    {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_NEQ, Name: TenantLabel, Value: "team-a"}}},
+		"not_own_regex":     {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_NRE, Name: TenantLabel, Value: "team-a"}}},
+		"empty_tenant":      {matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: TenantLabel, Value: ""}}},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := c.Read(ctx, &prompb.ReadRequest{Queries: []*prompb.Query{{StartTimestampMs: 0, EndTimestampMs: 2000, Matchers: testCase.matchers}}})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, testCase.expected, resp.Results[0].Timeseries)
+		})
+	}
+
+	_, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{Matchers: metricMatchers("up")}}})
+	assert.ErrorIs(t, err, ErrNoTenant)
+}
+
+// metricMatchers returns the matchers of a query for the metric name.
+func metricMatchers(metric string) []*prompb.LabelMatcher {
+	return []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: metric}}
+}
+
+func TestReadTenantCache(t *testing.T) {
+	querier := &filteringQuerier{t: t, rows: []map[string]bigquery.Value{
+		testRow("up", `{"__tenant__":"team-a"}`, 1000, 1),
+		testRow("up", `{"__tenant__":"team-b"}`, 1000, 2),
+	}}
+	c := newTestClient(&fakeInserter{}, WithQuerier(querier), WithTenancy(true), WithReadCache(time.Minute, 10, time.Minute, 0))
+	req := &prompb.ReadRequest{Queries: []*prompb.Query{{StartTimestampMs: 0, EndTimestampMs: 60000, Matchers: metricMatchers("up")}}}
+
+	for _, tenant := range []string{"team-a", "team-b", "team-a"} {
+		resp, err := c.Read(ContextWithTenant(context.Background(), tenant), req)
+		assert.NoError(t, err)
+		if assert.Len(t, resp.Results[0].Timeseries, 1) {
+			expected := 1.0
+			if tenant == "team-b" {
+				expected = 2
+			}
+			assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: expected}}, resp.Results[0].Timeseries[0].Samples, tenant)
+		}
+	}
+	assert.Equal(t, 1.0, metricValue(c.readCacheHits), "only the second read of team-a is served from the cache")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+)
+
+// Types of the timestamp column.
+const (
+	// TimestampTypeTimestamp stores the timestamp in a TIMESTAMP column, with second precision.
+	TimestampTypeTimestamp = "timestamp"
+	// TimestampTypeMillis stores the timestamp as an INT64 of milliseconds since the epoch.
+	TimestampTypeMillis = "int64_millis"
+	// TimestampTypeAuto detects the type from the schema of the table.
+	TimestampTypeAuto = "auto"
+)
+
+// WithTimestampType sets how the timestamp column stores the time of a sample, as a
+// TIMESTAMP with TimestampTypeTimestamp or as an INT64 of milliseconds since the epoch
+// with TimestampTypeMillis. With TimestampTypeAuto NewClient detects it from the schema of
+// the table.
+func WithTimestampType(typ string) Option {
+	return func(c *BigqueryClient) {
+		c.timestampType = typ
+	}
+}
+
+// detectTimestampType sets the type of the timestamp column from the schema of the table.
+func (c *BigqueryClient) detectTimestampType(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.readTimeout)
+	defer cancel()
+	md, err := c.tableAdmin.Metadata(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the metadata of table %s", c.tableName(c.datasetID, c.tableID))
+	}
+	for _, field := range md.Schema {
+		if field.Name != "timestamp" {
+			continue
+		}
+		switch field.Type {
+		case bigquery.TimestampFieldType:
+			c.timestampType = TimestampTypeTimestamp
+		case bigquery.IntegerFieldType:
+			c.timestampType = TimestampTypeMillis
+		default:
+			return errors.Errorf("column timestamp of table %s has the unsupported type %s", c.tableName(c.datasetID, c.tableID), sqlTypeName(field.Type))
+		}
+		return nil
+	}
+	return errors.Errorf("table %s has no timestamp column", c.tableName(c.datasetID, c.tableID))
+}
+
+// timestampMillis returns whether the timestamp column holds milliseconds since the epoch.
+func (c *BigqueryClient) timestampMillis() bool {
+	return c.timestampType == TimestampTypeMillis
+}
+
+// timestampColumnSQL returns the SQL selecting the timestamp of a row in milliseconds.
+func (c *BigqueryClient) timestampColumnSQL() string {
+	if c.timestampMillis() {
+		return "timestamp"
+	}
+	return "UNIX_MILLIS(timestamp) as timestamp"
+}
+
+// timestampParamSQL returns the SQL comparable with the timestamp column for the named
+// query parameter holding milliseconds since the epoch. The column itself is always
+// compared as is, so BigQuery can skip the partitions outside of the time range.
+func (c *BigqueryClient) timestampParamSQL(param string) string {
+	if c.timestampMillis() {
+		return "@" + param
+	}
+	return "TIMESTAMP_MILLIS(@" + param + ")"
+}
+
+// Bounds of the range partitioning of tables created with a timestamp column of
+// milliseconds. BigQuery allows up to 10000 ranges, which are days from 2020 until 2047.
+// Rows outside of them go to the unpartitioned partition.
+const (
+	millisPartitionStart    = int64(1577836800000)
+	millisPartitionInterval = int64(24 * time.Hour / time.Millisecond)
+	millisPartitions        = 10000
+)
+
+// millisRangePartitioning returns the partitioning by day of a timestamp column of
+// milliseconds.
+func millisRangePartitioning() *bigquery.RangePartitioning {
+	return &bigquery.RangePartitioning{
+		Field: "timestamp",
+		Range: &bigquery.RangePartitioningRange{
+			Start:    millisPartitionStart,
+			End:      millisPartitionStart + millisPartitions*millisPartitionInterval,
+			Interval: millisPartitionInterval,
+		},
+	}
+}
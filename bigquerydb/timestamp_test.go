@@ -0,0 +1,206 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestDetectTimestampType(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		schema   bigquery.Schema
+		err      error
+		expected string
+		errMsg   string
+	}{
+		{name: "timestamp", schema: adapterSchema(), expected: TimestampTypeTimestamp},
+		{name: "millis", schema: bigquery.Schema{{Name: "timestamp", Type: bigquery.IntegerFieldType}}, expected: TimestampTypeMillis},
+		{name: "unsupported", schema: bigquery.Schema{{Name: "timestamp", Type: bigquery.DateTimeFieldType}}, errMsg: "unsupported type DATETIME"},
+		{name: "missing", schema: bigquery.Schema{{Name: "metricname", Type: bigquery.StringFieldType}}, errMsg: "no timestamp column"},
+		{name: "metadata error", err: errors.New("permission denied"), errMsg: "permission denied"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := &fakeTableAdmin{md: &bigquery.TableMetadata{Schema: tc.schema}, metadataErr: tc.err}
+			c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTimestampType(TimestampTypeAuto))
+
+			err := c.detectTimestampType(context.Background())
+			if tc.errMsg != "" {
+				assert.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, c.timestampType)
+		})
+	}
+}
+
+func TestTimestampTypeQuery(t *testing.T) {
+	for _, tc := range []struct {
+		typ       string
+		column    string
+		condition string
+	}{
+		{typ: TimestampTypeTimestamp, column: "UNIX_MILLIS(timestamp) as timestamp", condition: "timestamp >= TIMESTAMP_MILLIS(@start) AND timestamp <= TIMESTAMP_MILLIS(@end)"},
+		{typ: TimestampTypeMillis, column: "timestamp", condition: "timestamp >= @start AND timestamp <= @end"},
+	} {
+		t.Run(tc.typ, func(t *testing.T) {
+			c := newTestClient(&fakeInserter{}, WithTimestampType(tc.typ), WithReadDeduplication(true), WithServerSideSort(true))
+			query, params, err := c.buildCommand(sensorQuery(1000, 2000))
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT metricname, tags, "+tc.column+", value FROM `dataset.table` WHERE metricname = @m0 AND "+tc.condition+
+				" QUALIFY ROW_NUMBER() OVER (PARTITION BY metricname, tags, timestamp ORDER BY value NULLS LAST) = 1 ORDER BY timestamp", query)
+			// The bounds are milliseconds in both cases, the column is compared as is so
+			// that the partitions outside of the time range are skipped.
+			assert.Contains(t, params, bigquery.QueryParameter{Name: "start", Value: int64(1000)})
+			assert.Contains(t, params, bigquery.QueryParameter{Name: "end", Value: int64(2000)})
+		})
+	}
+}
+
+func TestTimestampTypeRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		typ       string
+		precision int64
+	}{
+		{typ: TimestampTypeTimestamp, precision: 1000},
+		{typ: TimestampTypeMillis, precision: 1},
+	} {
+		t.Run(tc.typ, func(t *testing.T) {
+			c := newFakeBigQueryClient(WithTimestampType(tc.typ))
+			start := time.Now().Add(-time.Minute).Unix()*1000 + 250
+			samples := []prompb.Sample{{Timestamp: start, Value: 1}, {Timestamp: start + 1500, Value: 2}, {Timestamp: start + 3001, Value: 3}}
+			assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "sensor"}},
+				Samples: samples,
+			}}))
+
+			// The query starts after the first sample, which is only excluded with millisecond precision.
+			result, err := c.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{sensorQuery(start+100, start+5000)}})
+			assert.NoError(t, err)
+			var expected []prompb.Sample
+			for _, s := range samples {
+				s.Timestamp -= s.Timestamp % tc.precision
+				if s.Timestamp >= start+100 {
+					expected = append(expected, s)
+				}
+			}
+			if assert.Len(t, result.Results[0].Timeseries, 1) {
+				assert.Equal(t, expected, result.Results[0].Timeseries[0].Samples)
+			}
+		})
+	}
+}
+
+func TestTimestampMillisSave(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithTimestampType(TimestampTypeMillis))
+	now := time.Now().UnixMilli()
+	assert.NoError(t, c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "sensor"}},
+		Samples: []prompb.Sample{{Timestamp: now, Value: 1}},
+	}}))
+	if assert.Len(t, ins.rows(), 1) {
+		row, _, err := ins.rows()[0].Save()
+		assert.NoError(t, err)
+		assert.Equal(t, now, row["timestamp"])
+	}
+}
+
+func TestTimestampMillisSchema(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithTimestampType(TimestampTypeMillis))
+	assert.Contains(t, c.requiredColumns(), requiredColumn{name: "timestamp", typ: bigquery.IntegerFieldType})
+
+	admin := &fakeTableAdmin{metadataErr: &googleapi.Error{Code: http.StatusNotFound}}
+	c = newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTimestampType(TimestampTypeMillis), WithRetention(30*24*time.Hour, time.Hour, true))
+	assert.NoError(t, c.createTableIfMissing(context.Background()))
+	if assert.NotNil(t, admin.created) {
+		assert.Equal(t, &bigquery.FieldSchema{Name: "timestamp", Type: bigquery.IntegerFieldType}, admin.created.Schema[2])
+		assert.Nil(t, admin.created.TimePartitioning)
+		assert.Equal(t, millisRangePartitioning(), admin.created.RangePartitioning)
+		assert.Equal(t, 2047, time.UnixMilli(admin.created.RangePartitioning.Range.End).UTC().Year())
+	}
+
+	for _, tc := range []struct {
+		name         string
+		partitioning *bigquery.RangePartitioning
+		warning      string
+	}{
+		{name: "range", partitioning: millisRangePartitioning()},
+		{name: "unpartitioned", warning: "table isn't partitioned by range"},
+		{name: "other column", partitioning: &bigquery.RangePartitioning{Field: "day"}, warning: "table isn't partitioned by the timestamp column"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			admin := &fakeTableAdmin{md: &bigquery.TableMetadata{
+				Schema:            schemaWithMillis(),
+				RangePartitioning: tc.partitioning,
+				Clustering:        &bigquery.Clustering{Fields: []string{"metricname"}},
+			}}
+			c := newTestClient(&fakeInserter{}, WithTableAdmin(admin), WithTimestampType(TimestampTypeMillis))
+			var logs bytes.Buffer
+			c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+			assert.NoError(t, c.ValidateSchema(context.Background()))
+			if tc.warning == "" {
+				assert.NotContains(t, logs.String(), "level=WARN")
+			} else {
+				assert.Contains(t, logs.String(), tc.warning)
+			}
+		})
+	}
+
+	_, err := validateTestSchema(&fakeTableAdmin{md: &bigquery.TableMetadata{Schema: schemaWithMillis()}})
+	assert.ErrorContains(t, err, "timestamp", "a timestamp column of milliseconds needs the option")
+}
+
+// schemaWithMillis returns the schema of the adapter with a timestamp column of milliseconds.
+func schemaWithMillis() bigquery.Schema {
+	schema := adapterSchema()
+	schema[2] = &bigquery.FieldSchema{Name: "timestamp", Type: bigquery.IntegerFieldType, Required: true}
+	return schema
+}
+
+func TestTimestampMillisRetention(t *testing.T) {
+	admin := &fakeTableAdmin{md: &bigquery.TableMetadata{RangePartitioning: millisRangePartitioning()}}
+	c, statements := newRetentionTestClient(admin, true)
+	c.timestampType = TimestampTypeMillis
+
+	assert.NoError(t, c.enforceRetention(context.Background()))
+	assert.Equal(t, []string{"DELETE FROM `dataset.table` WHERE timestamp < UNIX_MILLIS(TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @retention SECOND))"}, statements.runs)
+}
+
+func TestLoadTimestampMillis(t *testing.T) {
+	loader := &fakeLoader{}
+	c := newTestClient(&fakeInserter{}, WithLoader(loader), WithTimestampType(TimestampTypeMillis))
+
+	rows, err := c.Load(context.Background(), []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000000123, Value: 1}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rows)
+	assert.Equal(t, []string{`{"metricname":"up","tags":"{}","timestamp":1700000000123,"value":1}` + "\n"}, loader.jobs)
+}
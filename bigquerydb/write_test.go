@@ -0,0 +1,361 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigquerydb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestWriteSkipsUnsupportedValues(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins)
+	err := c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{
+			{Timestamp: 1000, Value: 1},
+			{Timestamp: 2000, Value: math.NaN()},
+			{Timestamp: 3000, Value: math.Inf(1)},
+			{Timestamp: 4000, Value: math.Inf(-1)},
+			{Timestamp: 5000, Value: 0},
+		},
+	}})
+	assert.NoError(t, err)
+
+	rows := ins.rows()
+	assert.Len(t, rows, 2)
+	assert.Equal(t, 1.0, rows[0].value)
+	assert.Equal(t, 0.0, rows[1].value)
+	assert.Equal(t, 3.0, metricValue(c.ignoredSamples))
+	assert.Equal(t, 5.0, metricValue(c.recordsFetched))
+}
+
+func TestWriteDroppedSampleReasons(t *testing.T) {
+	now := time.Now()
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxSampleAge(time.Hour, false), WithMaxFutureSkew(time.Hour, FutureSampleDrop))
+	err := c.Write(context.Background(), []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{
+			{Timestamp: now.UnixMilli(), Value: 1},
+			{Timestamp: now.UnixMilli(), Value: math.NaN()},
+			{Timestamp: now.UnixMilli(), Value: math.Inf(1)},
+			{Timestamp: now.UnixMilli(), Value: math.Inf(-1)},
+			{Timestamp: now.UnixMilli(), Value: math.Float64frombits(staleNaN)},
+			{Timestamp: now.Add(-2 * time.Hour).UnixMilli(), Value: 1},
+			{Timestamp: now.Add(2 * time.Hour).UnixMilli(), Value: 1},
+		},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, ins.rows(), 1)
+
+	for reason, expected := range map[string]float64{"nan": 1, "inf": 2, "stale_marker": 1, "too_old": 1, "future": 1} {
+		assert.Equal(t, expected, metricValue(c.droppedSamples.WithLabelValues(reason)), reason)
+	}
+	assert.Equal(t, 6.0, metricValue(c.ignoredSamples), "the deprecated counter is the sum of all reasons")
+}
+
+func TestWriteTags(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins)
+	err := c.Write(context.Background(), []*prompb.TimeSeries{
+		{
+			Labels: []*prompb.Label{
+				{Name: "job", Value: "api"},
+				{Name: "__name__", Value: "http_requests_total"},
+				{Name: "path", Value: `/a"b`},
+			},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+		},
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+		},
+	})
+	assert.NoError(t, err)
+
+	rows := ins.rows()
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "http_requests_total", rows[0].metricname)
+	assert.JSONEq(t, `{"job":"api","path":"/a\"b"}`, rows[0].tags)
+	assert.Equal(t, "up", rows[1].metricname)
+	assert.Equal(t, "{}", rows[1].tags)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	c := newTestClient(&fakeInserter{delay: time.Second}, WithReadTimeout(time.Minute))
+	c.writeTimeout = 50 * time.Millisecond
+
+	err := c.Write(context.Background(), seriesWithSamples("up", 1))
+	assert.ErrorContains(t, err, "write timeout of 50ms exceeded")
+	var writeErr *WriteError
+	assert.ErrorAs(t, err, &writeErr)
+	assert.Equal(t, 1, writeErr.FailedSamples)
+}
+
+func TestWriteCancelled(t *testing.T) {
+	c := newTestClient(&fakeInserter{delay: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	begin := time.Now()
+	err := c.Write(ctx, []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+	}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(begin), 5*time.Second)
+	assert.Equal(t, 1.0, metricValue(c.cancelledOperations.WithLabelValues("write")))
+}
+
+func TestWriteBatchMetrics(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxRowsPerInsert(10))
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 25)))
+
+	size := 0
+	for _, item := range ins.rows() {
+		size += item.estimatedSize()
+	}
+	assert.Equal(t, float64(size), metricValue(c.writtenBytes))
+	assert.Equal(t, 25.0, metricValue(c.writtenRows))
+
+	var out dto.Metric
+	assert.NoError(t, c.insertBatchRows.Write(&out))
+	assert.Equal(t, uint64(3), out.Histogram.GetSampleCount())
+	assert.Equal(t, 25.0, out.Histogram.GetSampleSum())
+}
+
+func TestWriteBatchMetricsFailedInsert(t *testing.T) {
+	c := newTestClient(&fakeInserter{err: errors.New("insert failed")})
+	assert.Error(t, c.Write(context.Background(), seriesWithSamples("up", 5)))
+	assert.Equal(t, 0.0, metricValue(c.writtenBytes))
+	assert.Equal(t, 0.0, metricValue(c.writtenRows))
+}
+
+func TestWriteSpans(t *testing.T) {
+	recorder := newSpanRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /write")
+	c := newTestClient(&fakeInserter{}, WithMaxRowsPerInsert(10))
+	assert.NoError(t, c.Write(ctx, seriesWithSamples("up", 25)))
+	parent.End()
+
+	spans := recorder.named("bigquery.insert")
+	assert.Len(t, spans, 3)
+	rows := []int64{}
+	for _, s := range spans {
+		assert.Same(t, parent, s.parent)
+		assert.True(t, s.ended)
+		assert.Equal(t, "dataset", s.attr("bigquery.dataset").AsString())
+		assert.Equal(t, "table", s.attr("bigquery.table").AsString())
+		assert.Positive(t, s.attr("bigquery.estimated_bytes").AsInt64())
+		rows = append(rows, s.attr("bigquery.rows").AsInt64())
+	}
+	assert.ElementsMatch(t, []int64{10, 10, 5}, rows)
+}
+
+func TestWriteDryRun(t *testing.T) {
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithWriteDryRun(true), WithMaxRowsPerInsert(10))
+	var logs bytes.Buffer
+	c.logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	assert.NoError(t, c.Write(context.Background(), seriesWithSamples("up", 25)))
+	assert.Empty(t, ins.rows(), "nothing is sent to BigQuery")
+	assert.Equal(t, 25.0, metricValue(c.writtenRows))
+	assert.Positive(t, metricValue(c.writtenBytes))
+	assert.Equal(t, 3, strings.Count(logs.String(), "dry run, not writing rows to bigquery"))
+	assert.Contains(t, logs.String(), "rows=10")
+	assert.Contains(t, logs.String(), "metric_names=1")
+}
+
+func TestWriteMaxSampleAge(t *testing.T) {
+	series := func(now time.Time) []*prompb.TimeSeries {
+		return []*prompb.TimeSeries{{
+			Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{
+				{Timestamp: now.Add(-2 * time.Hour).UnixMilli(), Value: 1},
+				{Timestamp: now.UnixMilli(), Value: 2},
+			},
+		}}
+	}
+
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxSampleAge(time.Hour, false))
+	assert.NoError(t, c.Write(context.Background(), series(time.Now())))
+	rows := ins.rows()
+	assert.Len(t, rows, 1, "old samples are dropped")
+	assert.Equal(t, 2.0, rows[0].value)
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("too_old")))
+
+	ins = &fakeInserter{}
+	c = newTestClient(ins, WithMaxSampleAge(time.Hour, true))
+	err := c.Write(context.Background(), series(time.Now()))
+	assert.ErrorIs(t, err, ErrSampleTooOld)
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 2, writeErr.FailedSamples, "the whole request is rejected")
+	}
+	assert.Empty(t, ins.rows())
+}
+
+func TestWriteMaxFutureSkew(t *testing.T) {
+	now := time.Now()
+	// The second sample is ahead by less than a second, which the truncated seconds of
+	// the row would hide.
+	series := []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{
+			{Timestamp: now.Add(-time.Minute).UnixMilli(), Value: 1},
+			{Timestamp: now.Add(2*time.Hour + 500*time.Millisecond).UnixMilli(), Value: 2},
+		},
+	}}
+
+	ins := &fakeInserter{}
+	c := newTestClient(ins, WithMaxFutureSkew(2*time.Hour, FutureSampleDrop))
+	assert.NoError(t, c.Write(context.Background(), series))
+	rows := ins.rows()
+	assert.Len(t, rows, 1, "future samples are dropped")
+	assert.Equal(t, 1.0, rows[0].value)
+	assert.Equal(t, 1.0, metricValue(c.droppedSamples.WithLabelValues("future")))
+
+	ins = &fakeInserter{}
+	c = newTestClient(ins, WithMaxFutureSkew(2*time.Hour, FutureSampleClamp))
+	assert.NoError(t, c.Write(context.Background(), series))
+	rows = ins.rows()
+	assert.Len(t, rows, 2)
+	assert.Equal(t, 2.0, rows[1].value)
+	assert.InDelta(t, time.Now().Unix(), rows[1].timestamp, 1, "future samples are clamped to the current time")
+	assert.Zero(t, metricValue(c.droppedSamples.WithLabelValues("future")))
+
+	ins = &fakeInserter{}
+	c = newTestClient(ins, WithMaxFutureSkew(2*time.Hour, FutureSampleReject))
+	err := c.Write(context.Background(), series)
+	assert.ErrorIs(t, err, ErrSampleTooNew)
+	var writeErr *WriteError
+	if assert.ErrorAs(t, err, &writeErr) {
+		assert.Equal(t, 2, writeErr.FailedSamples, "the whole request is rejected")
+	}
+	assert.Empty(t, ins.rows())
+}
+
+func TestBuildBatchWindow(t *testing.T) {
+	c := newTestClient(&fakeInserter{}, WithMaxSampleAge(time.Minute, false), WithMaxFutureSkew(time.Minute, FutureSampleDrop))
+	batch, err := c.buildBatch(context.Background(), []*prompb.TimeSeries{{
+		Labels: []*prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Timestamp: 999, Value: 1}, {Timestamp: 1000, Value: 2}, {Timestamp: 1001, Value: 3},
+			{Timestamp: 2000, Value: 4}, {Timestamp: 2001, Value: 5}},
+	}}, "", sampleWindow{min: 1000, max: 2000, now: 1500})
+	assert.NoError(t, err)
+	assert.Len(t, batch, 3, "samples at the bounds of the window are kept")
+
+	assert.Equal(t, unlimitedWindow.min, newTestClient(&fakeInserter{}).sampleWindow(time.Now()).min)
+	assert.Equal(t, unlimitedWindow.max, newTestClient(&fakeInserter{}).sampleWindow(time.Now()).max)
+	now := time.Unix(3600, 0)
+	assert.Equal(t, sampleWindow{min: 3540000, max: 3660000, now: 3600000}, c.sampleWindow(now))
+}
+
+func TestStaleMarkersRoundTrip(t *testing.T) {
+	stale := math.Float64frombits(staleNaN)
+	series := []*prompb.TimeSeries{{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}},
+		Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: math.NaN()}, {Timestamp: 3000, Value: stale}},
+	}}
+
+	ins := &fakeInserter{}
+	c := newTestClient(ins)
+	assert.NoError(t, c.Write(context.Background(), series))
+	assert.Len(t, ins.rows(), 1, "staleness markers are dropped by default")
+
+	ins = &fakeInserter{}
+	c = newTestClient(ins, WithStaleMarkers(true))
+	assert.NoError(t, c.Write(context.Background(), series))
+	var rows []map[string]bigquery.Value
+	for _, item := range ins.rows() {
+		row, _, err := item.Save()
+		assert.NoError(t, err)
+		// Reads select the timestamp in milliseconds.
+		row["timestamp"] = row["timestamp"].(int64) * 1000
+		rows = append(rows, row)
+	}
+	if !assert.Len(t, rows, 2, "ordinary NaN values are still dropped") {
+		return
+	}
+	assert.Nil(t, rows[1]["value"], "staleness markers are written as NULL")
+	assert.Equal(t, 1.0, metricValue(c.ignoredSamples))
+
+	rs := newResultSet(0)
+	assert.NoError(t, mergeResult(rs, &fakeRowIterator{rows: append(rows, rows[1])}))
+	assert.Equal(t, 1, rs.sortSamples(), "duplicate staleness markers are dropped")
+	timeseries := rs.response().Results[0].Timeseries
+	if assert.Len(t, timeseries, 1) && assert.Len(t, timeseries[0].Samples, 2) {
+		assert.Equal(t, prompb.Sample{Timestamp: 1000, Value: 1}, timeseries[0].Samples[0])
+		assert.Equal(t, int64(3000), timeseries[0].Samples[1].Timestamp)
+		assert.Equal(t, staleNaN, math.Float64bits(timeseries[0].Samples[1].Value), "the series ends with a staleness marker")
+	}
+}
+
+// benchmarkSeries returns the timeseries of a remote write request with the given number of
+// samples for each series. Like Prometheus does, every sample is sent as its own timeseries.
+func benchmarkSeries(series, samples int) []*prompb.TimeSeries {
+	timeseries := make([]*prompb.TimeSeries, 0, series*samples)
+	for s := 0; s < samples; s++ {
+		for i := 0; i < series; i++ {
+			timeseries = append(timeseries, &prompb.TimeSeries{
+				Labels: []*prompb.Label{
+					{Name: "__name__", Value: "container_cpu_usage_seconds_total"},
+					{Name: "container", Value: "app"},
+					{Name: "cpu", Value: "total"},
+					{Name: "env", Value: "production"},
+					{Name: "instance", Value: fmt.Sprintf("10.0.%d.%d:10250", i/256, i%256)},
+					{Name: "job", Value: "kubelet"},
+					{Name: "namespace", Value: "default"},
+					{Name: "node", Value: fmt.Sprintf("node-%d", i%50)},
+					{Name: "pod", Value: fmt.Sprintf("app-%d", i)},
+					{Name: "region", Value: "us-central1"},
+				},
+				Samples: []prompb.Sample{{Timestamp: int64(1700000000000 + s*15000), Value: float64(i)}},
+			})
+		}
+	}
+	return timeseries
+}
+
+// BenchmarkWriteBatchBuild converts a request with 4 samples of each of 500 series into rows.
+func BenchmarkWriteBatchBuild(b *testing.B) {
+	timeseries := benchmarkSeries(500, 4)
+	c := newTestClient(&fakeInserter{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.buildBatch(context.Background(), timeseries, "", unlimitedWindow); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// accessEntry collects what the handlers learn about a request for its access log line.
+type accessEntry struct {
+	requestBytes int
+	decodedBytes int
+	samples      int
+}
+
+type accessEntryKey struct{}
+
+// requestAccessEntry returns the access log entry of the request, which is nil if the
+// request isn't logged.
+func requestAccessEntry(ctx context.Context) *accessEntry {
+	entry, _ := ctx.Value(accessEntryKey{}).(*accessEntry)
+	return entry
+}
+
+// recordBody records the size of the request body as received and after decompression.
+func recordBody(r *http.Request, requestBytes, decodedBytes int) {
+	if entry := requestAccessEntry(r.Context()); entry != nil {
+		entry.requestBytes, entry.decodedBytes = requestBytes, decodedBytes
+	}
+}
+
+// recordSamples records the number of samples of a write request.
+func recordSamples(ctx context.Context, samples int) {
+	if entry := requestAccessEntry(ctx); entry != nil {
+		entry.samples = samples
+	}
+}
+
+// accessLogWriter remembers the status code and the size of the response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush keeps streamed read responses working.
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLog logs one line per request of the handler with access logging enabled, or
+// one line per every cfg.accessLogSample requests. Without access logging it returns
+// the handler itself.
+func accessLog(logger slog.Logger, cfg *Config, name string, handler http.Handler) http.Handler {
+	if !cfg.accessLog {
+		return handler
+	}
+	sample := uint64(max(cfg.accessLogSample, 1))
+	var requests atomic.Uint64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%sample != 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		begin := time.Now()
+		entry := &accessEntry{}
+		lw := &accessLogWriter{ResponseWriter: w}
+		handler.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		if entry.requestBytes == 0 && r.ContentLength > 0 {
+			entry.requestBytes = int(r.ContentLength)
+		}
+		attrs := []slog.Attr{
+			slog.String("handler", name),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remote_addr", remoteAddr(r, cfg.trustForwardedFor)),
+			slog.String("user_agent", r.UserAgent()),
+			slog.Int("status", lw.status),
+			slog.Int("request_bytes", entry.requestBytes),
+			slog.Int("decoded_bytes", entry.decodedBytes),
+			slog.Int("response_bytes", lw.bytes),
+		}
+		if entry.samples > 0 {
+			attrs = append(attrs, slog.Int("samples", entry.samples))
+		}
+		attrs = append(attrs, slog.Duration("duration", time.Since(begin)))
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "http request", attrs...)
+	})
+}
+
+// remoteAddr returns the address of the client. Behind a trusted proxy it is the first
+// address of the X-Forwarded-For header, if there is one.
+func remoteAddr(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			client, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(client)
+		}
+	}
+	return r.RemoteAddr
+}
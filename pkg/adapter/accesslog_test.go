@@ -0,0 +1,139 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// accessLogLines returns the access log lines of the JSON logs.
+func accessLogLines(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["msg"] == "http request" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func accessLogMux(cfg *Config, logs *bytes.Buffer, w writer) *http.ServeMux {
+	mux := http.NewServeMux()
+	cfg.writePath, cfg.readPath = defaultWritePath, defaultReadPath
+	registerHandlers(mux, *slog.New(slog.NewJSONHandler(logs, nil)), cfg, []writer{w}, nil)
+	return mux
+}
+
+func TestAccessLogWrite(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, accessLog: true, accessLogSample: 1})
+	mux := accessLogMux(cfg, &logs, &mockWriter{name: "bigquerydb"})
+
+	body := writeRequestBody(t, seriesWithSamples("up", "node", prompb.Sample{Timestamp: 1000, Value: 1}, prompb.Sample{Timestamp: 2000, Value: 1}))
+	requestBytes := body.Len()
+	req := httptest.NewRequest(http.MethodPost, "/write", body)
+	req.RemoteAddr = "10.0.0.1:41234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	req.Header.Set("User-Agent", "Prometheus/3.0.0")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := accessLogLines(t, &logs)
+	if !assert.Len(t, lines, 1) {
+		return
+	}
+	line := lines[0]
+	assert.Equal(t, "INFO", line["level"])
+	assert.Equal(t, "write", line["handler"])
+	assert.Equal(t, "POST", line["method"])
+	assert.Equal(t, "/write", line["path"])
+	assert.Equal(t, "10.0.0.1:41234", line["remote_addr"], "X-Forwarded-For isn't trusted by default")
+	assert.Equal(t, "Prometheus/3.0.0", line["user_agent"])
+	assert.Equal(t, float64(http.StatusOK), line["status"])
+	assert.Equal(t, float64(requestBytes), line["request_bytes"])
+	assert.Greater(t, line["decoded_bytes"], float64(0))
+	assert.Equal(t, float64(2), line["samples"])
+	assert.Contains(t, line, "duration")
+}
+
+func TestAccessLogFailedRequest(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, accessLog: true, accessLogSample: 1, trustForwardedFor: true})
+	mux := accessLogMux(cfg, &logs, &mockWriter{name: "bigquerydb"})
+
+	req := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader([]byte("not snappy")))
+	req.Header.Set("X-Forwarded-For", "192.0.2.1, 10.0.0.2")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := accessLogLines(t, &logs)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "192.0.2.1", lines[0]["remote_addr"])
+		assert.Equal(t, float64(http.StatusBadRequest), lines[0]["status"])
+		assert.NotContains(t, lines[0], "samples")
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := testConfig(&Config{accessLog: true, accessLogSample: 3})
+	mux := accessLogMux(cfg, &logs, &mockWriter{name: "bigquerydb"})
+
+	for range 7 {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/version", nil))
+	}
+	lines := accessLogLines(t, &logs)
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Equal(t, "version", line["handler"])
+		assert.Equal(t, float64(http.StatusOK), line["status"])
+		assert.Greater(t, line["response_bytes"], float64(0))
+	}
+}
+
+func TestAccessLogDisabled(t *testing.T) {
+	var logs bytes.Buffer
+	mux := accessLogMux(testConfig(&Config{}), &logs, &mockWriter{name: "bigquerydb"})
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Empty(t, accessLogLines(t, &logs))
+
+	handler := http.FileServer(http.Dir("."))
+	assert.Same(t, handler, accessLog(*slog.Default(), testConfig(&Config{}), "files", handler), "the handler isn't wrapped")
+}
+
+func TestAccessLogFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.accessLog)
+	assert.Equal(t, 1, cfg.accessLogSample)
+	assert.False(t, cfg.trustForwardedFor)
+
+	cfg, err = parseTestFlags("--web.access-log", "--web.access-log-sample=100", "--web.access-log-trust-forwarded-for")
+	assert.NoError(t, err)
+	assert.True(t, cfg.accessLog)
+	assert.Equal(t, 100, cfg.accessLogSample)
+	assert.True(t, cfg.trustForwardedFor)
+}
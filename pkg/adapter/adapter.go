@@ -0,0 +1,2383 @@
+/*
+Copyright 2020 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package adapter serves the Prometheus remote storage API backed by BigQuery. The adapter
+// binary only parses its flags with LoadConfig and runs an Adapter, other programs can run
+// several adapters in one process, each with its own configuration, logger and metrics.
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/leader"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/version"
+	"github.com/alecthomas/units"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Config is the configuration of an Adapter. It is loaded from command line arguments by
+// LoadConfig, only its exported fields are set by programs embedding the adapter.
+type Config struct {
+	// Logger is the logger of the adapter. By default the adapter logs as configured by the
+	// log flags.
+	Logger *slog.Logger
+	// Registerer is the registry the metrics of the adapter are registered with, which is
+	// prometheus.DefaultRegisterer by default.
+	Registerer prometheus.Registerer
+	// Gatherer is the registry whose metrics the adapter serves. It defaults to Registerer
+	// if that is a gatherer, and to prometheus.DefaultGatherer otherwise.
+	Gatherer prometheus.Gatherer
+
+	googleProjectID          string
+	googleAPIjsonkeypath     string
+	googleAPIjsonkey         string
+	keyCheckInterval         time.Duration
+	googleAPIdatasetID       string
+	googleAPItableID         string
+	googleAPIdataProject     string
+	googleAPIlocation        string
+	bigqueryEndpoint         string
+	storage                  string
+	noopLatency              time.Duration
+	noopErrorRate            float64
+	impersonate              string
+	impersonateDelegates     []string
+	impersonateScopes        []string
+	remoteTimeout            time.Duration
+	writeTimeout             time.Duration
+	readTimeout              time.Duration
+	maxRowsPerInsert         int
+	maxBytesPerInsert        units.Base2Bytes
+	writeConcurrency         int
+	writeQueueSize           int
+	writeAsync               bool
+	writeBufferSize          int
+	writeFlushInterval       time.Duration
+	coalesceMaxRows          int
+	coalesceMaxBytes         units.Base2Bytes
+	coalesceMaxDelay         time.Duration
+	spillDir                 string
+	spillMaxBytes            units.Base2Bytes
+	spillReplayInterval      time.Duration
+	writeMethod              string
+	loadJobLocation          string
+	loadJobMaxBytes          units.Base2Bytes
+	loadJobInterval          time.Duration
+	deadLetter               string
+	deadLetterTable          string
+	deadLetterMaxBytes       units.Base2Bytes
+	writeDeduplicate         bool
+	writeDryRun              bool
+	writeMaxSampleAge        time.Duration
+	writeRejectOld           bool
+	writeMaxFutureSkew       time.Duration
+	writeFutureBehavior      string
+	writeStoreStale          bool
+	writeStrict              bool
+	writeAllowUTF8Names      bool
+	writeMaxSeries           int
+	writeMaxSeriesBehavior   string
+	writeMaxLabels           int
+	writeMaxLabelValueLength int
+	writeStaticLabels        map[string]string
+	writeStaticOverride      bool
+	writeMaxRowSize          units.Base2Bytes
+	writeOversize            string
+	writeTruncatedLength     int
+	perMetricSamples         bool
+	perMetricSamplesLimit    int
+	skipSchemaCheck          bool
+	tagsType                 string
+	specialValueColumn       bool
+	seriesHashColumn         bool
+	insertTimeColumn         bool
+	timestampType            string
+	createTable              bool
+	templateSuffixSpec       string
+	dateSharding             string
+	partitioning             string
+	partitionGranularity     string
+	templateSuffix           *bigquerydb.TemplateSuffix
+	skipInvalidRows          bool
+	ignoreUnknownValues      bool
+	aggregateTable           string
+	aggregateInterval        time.Duration
+	aggregateLateness        time.Duration
+	retention                time.Duration
+	retentionInterval        time.Duration
+	retentionEnforce         bool
+	leaderElection           bool
+	leaderKubernetes         bool
+	leaderName               string
+	leaderNamespace          string
+	leaderTable              string
+	leaderLeaseDuration      time.Duration
+	leaderRenewInterval      time.Duration
+	writeRateLimit           float64
+	writeRateBurst           int
+	writeRateLimitUnit       string
+	writeQuotaBackoff        time.Duration
+	writeQuotaMaxBackoff     time.Duration
+	maxLoggedRowErrors       int
+	rowRetries               int
+	rowRetryBackoff          time.Duration
+	readMaxSamples           int
+	readMaxResponseBytes     units.Base2Bytes
+	readMaxRows              int
+	readMaxBytesScanned      units.Base2Bytes
+	readDryRunMinRange       time.Duration
+	readRequireMetricName    bool
+	readSkipBadRows          bool
+	readMaxRange             time.Duration
+	readMaxRangeBehavior     string
+	readSlowQuery            time.Duration
+	readCacheTTL             time.Duration
+	readCacheMaxEntries      int
+	readCacheBucket          time.Duration
+	readCacheFreshness       time.Duration
+	readUseStorageAPI        bool
+	readServerSideSort       bool
+	readDeduplicate          bool
+	readTableOverride        string
+	readDatasetID            string
+	readTableID              string
+	readSQLTemplate          string
+	readTemplate             *template.Template
+	readQueryPriority        string
+	readMaxBytesBilled       units.Base2Bytes
+	readMaxQueries           int
+	readQueueTimeout         time.Duration
+	readSplitInterval        time.Duration
+	jobLabels                map[string]string
+	breakerFailures          int
+	breakerFailureRatio      float64
+	breakerWindow            int
+	breakerOpenDuration      time.Duration
+	breakerProbes            int
+	listenAddr               string
+	adminListenAddr          string
+	telemetryListenAddr      string
+	socketModeSpec           string
+	socketMode               os.FileMode
+	adminMetrics             bool
+	enablePprof              bool
+	accessLog                bool
+	accessLogSample          int
+	trustForwardedFor        bool
+	maxRequestSize           units.Base2Bytes
+	httpReadTimeout          time.Duration
+	httpHeaderTimeout        time.Duration
+	httpWriteTimeout         time.Duration
+	httpIdleTimeout          time.Duration
+	enableDebugRead          bool
+	enableConfig             bool
+	enableMetadataAPI        bool
+	jsonErrors               bool
+	otlpEnabled              bool
+	telemetryPath            string
+	routePrefix              string
+	writePath                string
+	readPath                 string
+	legacyPaths              bool
+	externalURL              string
+	metricsNamespace         string
+	metricsConstLabels       map[string]string
+	metricsWriteBuckets      string
+	metricsReadBuckets       string
+	metricFactory            metricfactory.Factory
+	promslogConfig           promslog.Config
+	logFormat                string
+	logSampleLimit           int
+	logSampleWindow          time.Duration
+	printVersion             bool
+	keepMetrics              []string
+	dropMetrics              []string
+	seriesFilter             *seriesFilter
+	writeDropLabels          []string
+	writeDropLabelRegex      []string
+	dropLabelRegex           *regexp.Regexp
+	writeTargetSpecs         []string
+	writeTargets             []bigqueryTarget
+	writeTargetPolicy        string
+	multiTargetPolicy        string
+	writeRouteSpecs          []string
+	writeRoutes              []bigquerydb.Route
+	tenancyEnabled           bool
+	tenancyDefaultTenant     string
+	haClusterLabel           string
+	haReplicaLabel           string
+	haFailoverTimeout        time.Duration
+	haTracker                *haTracker
+	elector                  *leader.Elector
+	queryLimiter             *bigquerydb.QueryLimiter
+	quotaBackoff             *quotaBackoff
+	readTargetSpecs          []string
+	readTargets              []bigqueryTarget
+	readTargetPolicy         string
+	readResolutionSpecs      []string
+	readResolutions          []bigquerydb.ReadResolution
+	readForceRaw             bool
+	command                  string
+	backfillDir              string
+	backfillStateFile        string
+	backfillDryRun           bool
+	exportMatchers           []string
+	exportStart              string
+	exportEnd                string
+	exportFormat             string
+	exportOutput             string
+	migrateApply             bool
+	migrateOutput            string
+	replayLocation           string
+	replayDelete             bool
+	// args are the command line arguments the configuration was loaded from.
+	args []string
+	// flags holds the values of the flags by name, to tell which ones a reload changes.
+	flags map[string]string
+	// effective holds the redacted values of the flags and their sources, for the config
+	// endpoint and the startup log.
+	effective map[string]configValue
+	reloader  *reloader
+	// metrics and state are the ones of the adapter, created by New.
+	metrics *metrics
+	state   *adapterState
+}
+
+// metrics are the metrics of an adapter.
+type metrics struct {
+	receivedSamples         prometheus.Counter
+	sentSamples             *prometheus.CounterVec
+	failedSamples           *prometheus.CounterVec
+	sentBatchDuration       *prometheus.HistogramVec
+	droppedSeries           *prometheus.CounterVec
+	invalidSeries           *prometheus.CounterVec
+	partialReads            prometheus.Counter
+	otlpSkippedMetrics      *prometheus.CounterVec
+	writeResponses          *prometheus.CounterVec
+	rejectedRequests        *prometheus.CounterVec
+	writeErrors             prometheus.Counter
+	readErrors              prometheus.Counter
+	httpRequests            *prometheus.CounterVec
+	httpRequestDuration     *prometheus.HistogramVec
+	httpRequestsInFlight    *prometheus.GaugeVec
+	writeProcessingDuration *prometheus.HistogramVec
+	buildInfo               *prometheus.GaugeVec
+	haElectedReplica        *prometheus.GaugeVec
+	haElectedReplicaChanges *prometheus.CounterVec
+	haDroppedSamples        *prometheus.CounterVec
+	readProcessingDuration  *prometheus.HistogramVec
+	configReloads           *prometheus.CounterVec
+	requestBytes            *prometheus.HistogramVec
+	requestDecodedBytes     *prometheus.HistogramVec
+	writeRequestSeries      *prometheus.HistogramVec
+	writeRequestSamples     *prometheus.HistogramVec
+	readResponseBytes       prometheus.Histogram
+}
+
+// sizeBuckets are the buckets of the histograms of body sizes, from 1 KiB to 256 MiB.
+var sizeBuckets = prometheus.ExponentialBuckets(1024, 4, 10)
+
+// countBuckets are the buckets of the histograms of the series and samples per write
+// request, from 1 to 262144.
+var countBuckets = prometheus.ExponentialBuckets(1, 4, 10)
+
+// newMetrics creates the metrics of an adapter with the factory and registers them with
+// reg. The http metrics are named like the ones of other exporters and only get the
+// constant labels of the factory.
+func newMetrics(reg prometheus.Registerer, f metricfactory.Factory) *metrics {
+	unprefixed := f.WithoutNamespace()
+	m := &metrics{}
+	m.receivedSamples = metricfactory.Register(reg, f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "received_samples_total",
+			Help: "Total number of received samples.",
+		},
+	))
+	m.sentSamples = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sent_samples_total",
+			Help: "Total number of processed samples sent to remote storage.",
+		},
+		[]string{"remote", "tenant"},
+	))
+	m.failedSamples = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "failed_samples_total",
+			Help: "Total number of processed samples which failed on send to remote storage.",
+		},
+		[]string{"remote", "tenant"},
+	))
+	m.sentBatchDuration = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sent_batch_duration_seconds",
+			Help:    "Duration of sample batch send calls to the remote storage.",
+			Buckets: f.WriteBuckets(),
+		},
+		[]string{"remote", "tenant"},
+	))
+	m.droppedSeries = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dropped_series_total",
+			Help: "Total number of received series which were not sent to remote storage.",
+		},
+		[]string{"reason"},
+	))
+	m.invalidSeries = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "invalid_series_total",
+			Help: "Total number of received series with a malformed label set.",
+		},
+		[]string{"reason"},
+	))
+	m.partialReads = metricfactory.Register(reg, f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "partial_reads_total",
+			Help: "Total number of read requests answered with the results of only some of the readers.",
+		},
+	))
+	m.otlpSkippedMetrics = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otlp_skipped_metrics_total",
+			Help: "Total number of received OTLP metrics which were skipped because their type or temporality isn't supported.",
+		},
+		[]string{"type"},
+	))
+	m.writeResponses = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "write_responses_total",
+			Help: "Total number of processed write requests, by the class of their response status.",
+		},
+		[]string{"class"},
+	))
+	m.rejectedRequests = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rejected_requests_total",
+			Help: "Total number of write and read requests rejected before processing.",
+		},
+		[]string{"api", "reason"},
+	))
+	m.writeErrors = metricfactory.Register(reg, f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "write_errors_total",
+			Help: "Total number of write errors to BigQuery.",
+		},
+	))
+	m.readErrors = metricfactory.Register(reg, f.NewCounter(
+		prometheus.CounterOpts{
+			Name: "read_errors_total",
+			Help: "Total number of read errors from BigQuery.",
+		},
+	))
+	m.httpRequests = metricfactory.Register(reg, unprefixed.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of http requests by handler, status code and method.",
+		},
+		[]string{"handler", "code", "method"},
+	))
+	m.httpRequestDuration = metricfactory.Register(reg, unprefixed.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of http requests by handler.",
+			Buckets: unprefixed.ReadBuckets(),
+		},
+		[]string{"handler"},
+	))
+	m.httpRequestsInFlight = metricfactory.Register(reg, unprefixed.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of http requests currently being served by handler.",
+		},
+		[]string{"handler"},
+	))
+	m.writeProcessingDuration = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "write_api_seconds",
+			Help:    "Duration of the write api processing.",
+			Buckets: f.WriteBuckets(),
+		},
+		[]string{"remote", "tenant"},
+	))
+	m.buildInfo = metricfactory.Register(reg, f.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "build_info",
+			Help: "A metric with a constant '1' value labeled by the version, revision, branch and go version the adapter was built from.",
+		},
+		[]string{"version", "revision", "branch", "goversion"},
+	))
+	m.haElectedReplica = metricfactory.Register(reg, f.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ha_elected_replica",
+			Help: "The elected replica of every cluster of Prometheus replicas, which is always 1.",
+		},
+		[]string{"tenant", "cluster", "replica"},
+	))
+	m.haElectedReplicaChanges = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ha_elected_replica_changes_total",
+			Help: "Total number of failovers to another replica of a cluster of Prometheus replicas.",
+		},
+		[]string{"tenant", "cluster"},
+	))
+	m.haDroppedSamples = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ha_dropped_samples_total",
+			Help: "Total number of received samples of replicas which weren't elected in their cluster.",
+		},
+		[]string{"tenant", "cluster"},
+	))
+	m.readProcessingDuration = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "read_api_seconds",
+			Help:    "Duration of the read api processing.",
+			Buckets: f.ReadBuckets(),
+		},
+		[]string{"remote", "tenant"},
+	))
+	m.configReloads = metricfactory.Register(reg, f.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Total number of configuration reloads, by result.",
+		},
+		[]string{"result"},
+	))
+	m.requestBytes = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "request_bytes",
+			Help:    "Size of the bodies of write and read requests as received, before decompressing them.",
+			Buckets: sizeBuckets,
+		},
+		[]string{"api"},
+	))
+	m.requestDecodedBytes = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "request_decompressed_bytes",
+			Help:    "Size of the bodies of write and read requests after decompressing them.",
+			Buckets: sizeBuckets,
+		},
+		[]string{"api"},
+	))
+	m.writeRequestSeries = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "write_request_series",
+			Help:    "Number of series per write request.",
+			Buckets: countBuckets,
+		},
+		[]string{"api"},
+	))
+	m.writeRequestSamples = metricfactory.Register(reg, f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "write_request_samples",
+			Help:    "Number of samples per write request.",
+			Buckets: countBuckets,
+		},
+		[]string{"api"},
+	))
+	m.readResponseBytes = metricfactory.Register(reg, f.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "read_response_bytes",
+			Help:    "Size of the bodies of read responses as sent, after compressing them.",
+			Buckets: sizeBuckets,
+		},
+	))
+	info := version.Info()
+	m.buildInfo.WithLabelValues(info.Version, info.Revision, info.Branch, info.GoVersion).Set(1)
+	return m
+}
+
+// LoadConfig parses the command line arguments, without the name of the program, and the
+// environment variables into the configuration of an adapter and checks it. Arguments
+// starting with @ are read from the file following it, one per line.
+func LoadConfig(args []string) (*Config, error) {
+	cfg, _, err := loadConfig(args)
+	return cfg, err
+}
+
+// VersionRequested returns whether the arguments asked for the version of the adapter.
+func (cfg *Config) VersionRequested() bool {
+	return cfg.printVersion
+}
+
+// Usage writes the usage of the command line arguments to stderr.
+func Usage(args []string) {
+	a, _ := newApp(&Config{})
+	a.Usage(args)
+}
+
+// Adapter serves the remote storage API, or runs the backfill, export, migrate or replay
+// command of its configuration.
+type Adapter struct {
+	cfg     *Config
+	logger  *slog.Logger
+	logs    *swapHandler
+	writers []writer
+	readers []reader
+	// listeners and servers are the ones of the serve command, in the same order.
+	listeners []listener
+	servers   []*http.Server
+	// ready is closed once the servers listen, netListeners holds what they listen on.
+	ready        chan struct{}
+	netListeners []net.Listener
+
+	// leaderLock is the lock of the leader election of cfg.elector.
+	leaderLock leader.Lock
+
+	shutdownOnce sync.Once
+	// stopped is closed once Shutdown completed with shutdownErr.
+	stopped     chan struct{}
+	shutdownErr error
+}
+
+// New returns an adapter of the configuration, which it takes over. It registers the
+// metrics and, for the serve command, creates the BigQuery clients and checks the schema
+// of their tables. Errors are logged as well as returned.
+func New(cfg *Config) (*Adapter, error) {
+	a := newAdapter(cfg)
+	logger := a.logger
+	logger.Info(version.Get())
+	if cfg.command != "serve" {
+		return a, nil
+	}
+	logEffectiveConfig(logger, cfg)
+
+	if timeout := maxRemoteTimeout(cfg); cfg.httpWriteTimeout <= timeout {
+		logger.Warn("the http write timeout is not larger than the timeout of the BigQuery requests, slow reads will be cut off before their response is sent",
+			slog.Any("httpWriteTimeout", cfg.httpWriteTimeout), slog.Any("remoteTimeout", timeout))
+	}
+
+	if cfg.readMaxQueries > 0 && cfg.storage != storageNoop {
+		cfg.queryLimiter = bigquerydb.NewQueryLimiter(cfg.readMaxQueries, cfg.readQueueTimeout, cfg.Registerer, cfg.metricFactory)
+	}
+	if cfg.leaderElection {
+		cfg.elector = leader.NewElector(logger, leader.HolderID(), cfg.leaderLeaseDuration, cfg.leaderRenewInterval, cfg.Registerer, cfg.metricFactory)
+	}
+	writers, readers, err := buildClients(*logger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.elector != nil {
+		if a.leaderLock, err = leaderLock(context.Background(), cfg, writers); err != nil {
+			logger.Error("failed to create the lock of the leader election", slog.Any("error", err))
+			closeClients(writers, readers)
+			return nil, err
+		}
+		logger.Info("leader election enabled", slog.String("lock", fmt.Sprint(a.leaderLock)), slog.String("holder", cfg.elector.Holder()))
+	}
+	a.setClients(writers, readers)
+	return a, nil
+}
+
+// newAdapter returns an adapter of the configuration with its logger and metrics, but
+// without clients.
+func newAdapter(cfg *Config) *Adapter {
+	a := &Adapter{cfg: cfg, logger: cfg.Logger, ready: make(chan struct{}), stopped: make(chan struct{})}
+	if a.logger == nil {
+		// The handler is replaced when a reload changes the log flags.
+		a.logs = newSwapHandler(newLogHandler(cfg))
+		// Log lines of requests carry the IDs of their traces.
+		a.logger = slog.New(tracing.NewLogHandler(a.logs))
+	}
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+	if cfg.Gatherer == nil {
+		cfg.Gatherer = prometheus.DefaultGatherer
+		if g, ok := cfg.Registerer.(prometheus.Gatherer); ok {
+			cfg.Gatherer = g
+		}
+	}
+	cfg.metrics = newMetrics(cfg.Registerer, cfg.metricFactory)
+	cfg.state = newAdapterState(time.Now())
+	return a
+}
+
+// setClients sets the clients the adapter serves the remote storage API with, and creates
+// the reloader, the listeners and the servers of the serve command.
+func (a *Adapter) setClients(writers []writer, readers []reader) {
+	a.writers, a.readers = writers, readers
+	newReloader(*a.logger, a.cfg, a.cfg.args, a.logs, readers)
+	a.listeners = newListeners(*a.logger, a.cfg, writers, readers)
+	a.servers = newServers(a.cfg, a.listeners)
+}
+
+// loadConfig parses the command line arguments and environment variables into a config
+// and checks it. Arguments starting with @ are read from the file following it, one per
+// line. The application is returned for the usage on errors.
+func loadConfig(args []string) (*Config, *kingpin.Application, error) {
+	cfg := &Config{
+		promslogConfig: promslog.Config{},
+		args:           args,
+	}
+	a, googleProjectIDFlagCause := newApp(cfg)
+
+	command, err := a.Parse(args)
+	cfg.command = command
+	if err != nil || cfg.printVersion {
+		return cfg, a, err
+	}
+
+	if err := checkCredentialFlags(cfg); err != nil {
+		return cfg, a, err
+	}
+	if cfg.googleAPIjsonkeypath == "" && cfg.googleAPIjsonkey == "" {
+		googleProjectIDFlagCause.Required().StringVar(&cfg.googleProjectID)
+		if _, err := a.Parse(args); err != nil {
+			return cfg, a, err
+		}
+	}
+
+	cfg.seriesFilter, err = newSeriesFilter(cfg.keepMetrics, cfg.dropMetrics)
+	if err != nil {
+		return cfg, a, err
+	}
+
+	cfg.dropLabelRegex, err = dropLabelRegex(cfg.writeDropLabels, cfg.writeDropLabelRegex)
+	if err != nil {
+		return cfg, a, err
+	}
+
+	cfg.haTracker, err = newHATracker(cfg.haClusterLabel, cfg.haReplicaLabel, cfg.haFailoverTimeout)
+	if err != nil {
+		return cfg, a, err
+	}
+	if err := checkLeaderElection(cfg); err != nil {
+		return cfg, a, err
+	}
+
+	cfg.quotaBackoff = newQuotaBackoff(cfg.writeQuotaBackoff, cfg.writeQuotaMaxBackoff)
+
+	cfg.jobLabels, err = jobLabels(cfg.jobLabels)
+	if err != nil {
+		return cfg, a, err
+	}
+
+	cfg.metricFactory = metricfactory.Factory{Namespace: cfg.metricsNamespace, ConstLabels: cfg.metricsConstLabels}
+	if cfg.metricFactory.WriteDurationBuckets, err = parseBuckets("metrics.write-duration-buckets", cfg.metricsWriteBuckets); err != nil {
+		return cfg, a, err
+	}
+	if cfg.metricFactory.ReadDurationBuckets, err = parseBuckets("metrics.read-duration-buckets", cfg.metricsReadBuckets); err != nil {
+		return cfg, a, err
+	}
+	if err := cfg.metricFactory.Validate(); err != nil {
+		return cfg, a, err
+	}
+
+	if cfg.writeMaxSeries < 0 || cfg.writeMaxLabels < 0 || cfg.writeMaxLabelValueLength < 0 {
+		return cfg, a, errors.New("write.max-series-per-request, write.max-labels-per-series and write.max-label-value-length must not be negative")
+	}
+	if cfg.readMaxQueries < 0 || cfg.readQueueTimeout < 0 {
+		return cfg, a, errors.New("read.max-concurrent-queries and read.queue-timeout must not be negative")
+	}
+	if cfg.readSplitInterval < 0 {
+		return cfg, a, errors.New("read.split-interval must not be negative")
+	}
+	if cfg.readDryRunMinRange < 0 {
+		return cfg, a, errors.New("read.dry-run-min-range must not be negative")
+	}
+	if err := validateStaticLabels(cfg.writeStaticLabels, cfg.writeAllowUTF8Names); err != nil {
+		return cfg, a, err
+	}
+	cfg.templateSuffix, err = parseTemplateSuffix(cfg.templateSuffixSpec, cfg.writeStaticLabels, cfg.tenancyEnabled)
+	if err != nil {
+		return cfg, a, err
+	}
+	if cfg.dateSharding != bigquerydb.DateShardingNone && cfg.templateSuffix != nil {
+		return cfg, a, errors.New("bigquery.date-sharding and bigquery.template-suffix are mutually exclusive")
+	}
+	if cfg.partitioning == bigquerydb.PartitioningColumn && cfg.partitionGranularity != bigquerydb.PartitionDay && cfg.timestampType == bigquerydb.TimestampTypeMillis {
+		return cfg, a, errors.New("a timestamp column of bigquery.timestamp-type int64_millis is only partitioned per day, set bigquery.partition-granularity=day or bigquery.partitioning=ingestion")
+	}
+	if cfg.dateSharding != bigquerydb.DateShardingNone && cfg.retention > 0 {
+		return cfg, a, errors.New("bigquery.date-sharding and bigquery.retention are mutually exclusive, expire the shards with the default table expiration of the dataset instead")
+	}
+
+	if cfg.writeAsync && cfg.coalesceMaxDelay > 0 {
+		return cfg, a, errors.New("write.async and write.coalesce-max-delay are mutually exclusive")
+	}
+
+	if cfg.spillDir != "" && cfg.spillReplayInterval <= 0 {
+		return cfg, a, errors.New("write.spill-replay-interval must be positive")
+	}
+
+	if cfg.writeMethod == bigquerydb.WriteMethodLoadJob {
+		if !strings.HasPrefix(cfg.loadJobLocation, "gs://") && !strings.HasPrefix(cfg.loadJobLocation, "gcs://") {
+			return cfg, a, errors.Errorf("invalid write.load-job-location %q, bigquery.write-method load-job stages the rows in gs://bucket/prefix", cfg.loadJobLocation)
+		}
+		if cfg.loadJobMaxBytes <= 0 || cfg.loadJobInterval <= 0 {
+			return cfg, a, errors.New("write.load-job-max-bytes and write.load-job-interval must be positive")
+		}
+		if len(cfg.writeRouteSpecs) > 0 || cfg.templateSuffix != nil || cfg.dateSharding != bigquerydb.DateShardingNone {
+			return cfg, a, errors.New("bigquery.write-method load-job only writes to the table, it is mutually exclusive with write.route, bigquery.template-suffix and bigquery.date-sharding")
+		}
+	}
+
+	if cfg.deadLetter != "" && cfg.deadLetterTable != "" {
+		return cfg, a, errors.New("write.deadletter and write.deadletter-table are mutually exclusive")
+	}
+
+	if strings.Count(cfg.deadLetterTable, ".") > 1 {
+		return cfg, a, errors.Errorf("invalid write.deadletter-table %q, expected dataset.table or table", cfg.deadLetterTable)
+	}
+
+	if cfg.logSampleLimit > 0 && cfg.logSampleWindow <= 0 {
+		return cfg, a, errors.New("log.sample-window must be positive")
+	}
+
+	if cfg.noopLatency < 0 {
+		return cfg, a, errors.New("storage.noop-latency must not be negative")
+	}
+	if cfg.noopErrorRate < 0 || cfg.noopErrorRate > 1 {
+		return cfg, a, errors.New("storage.noop-error-rate must be between 0 and 1")
+	}
+
+	if cfg.adminMetrics && cfg.adminListenAddr == "" {
+		return cfg, a, errors.New("web.admin-metrics requires web.admin-listen-address")
+	}
+	cfg.socketMode, err = parseSocketMode(cfg.socketModeSpec)
+	if err != nil {
+		return cfg, a, err
+	}
+	cfg.routePrefix, err = normalizeRoutePrefix(cfg.routePrefix)
+	if err != nil {
+		return cfg, a, err
+	}
+	cfg.externalURL, err = normalizeExternalURL(cfg.externalURL)
+	if err != nil {
+		return cfg, a, err
+	}
+	if err := checkEndpointPaths(cfg); err != nil {
+		return cfg, a, err
+	}
+
+	if cfg.adminMetrics && cfg.telemetryListenAddr != "" {
+		return cfg, a, errors.New("web.admin-metrics and web.telemetry-listen-address are mutually exclusive")
+	}
+
+	if cfg.impersonate == "" && (len(cfg.impersonateDelegates) > 0 || len(cfg.impersonateScopes) > 0) {
+		return cfg, a, errors.New("googleAPI-impersonate-delegate and googleAPI-impersonate-scope require googleAPI-impersonate-service-account")
+	}
+
+	resolveTimeouts(cfg)
+	if cfg.multiTargetPolicy != "" {
+		cfg.writeTargetPolicy = cfg.multiTargetPolicy
+	}
+
+	cfg.writeTargets, err = parseTargets(cfg.writeTargetSpecs, cfg.googleProjectID, cfg.writeTimeout)
+	if err != nil {
+		return cfg, a, err
+	}
+	cfg.readTargets, err = parseTargets(cfg.readTargetSpecs, cfg.googleProjectID, cfg.readTimeout)
+	if err != nil {
+		return cfg, a, err
+	}
+	cfg.writeRoutes, err = parseRoutes(cfg.writeRouteSpecs)
+	if err != nil {
+		return cfg, a, err
+	}
+	cfg.readResolutions, err = parseResolutions(cfg.readResolutionSpecs)
+	if err != nil {
+		return cfg, a, err
+	}
+	if cfg.readTableOverride != "" {
+		cfg.readDatasetID, cfg.readTableID, err = parseReadTable(cfg.readTableOverride, cfg.googleAPIdatasetID)
+		if err != nil {
+			return cfg, a, err
+		}
+	}
+	cfg.readTemplate, err = parseReadTemplate(cfg.readSQLTemplate)
+	if err != nil {
+		return cfg, a, err
+	}
+	if err := checkIdentifiers(cfg); err != nil {
+		return cfg, a, err
+	}
+
+	if cfg.httpWriteTimeout == 0 {
+		cfg.httpWriteTimeout = maxRemoteTimeout(cfg) + writeTimeoutMargin
+	}
+	cfg.flags = flagValues(a)
+	cfg.effective = effectiveConfig(a, args)
+
+	return cfg, a, nil
+}
+
+// checkCredentialFlags makes sure at most one service account key is given.
+func checkCredentialFlags(cfg *Config) error {
+	if cfg.googleAPIjsonkeypath != "" && cfg.googleAPIjsonkey != "" {
+		return errors.New("googleAPIjsonkeypath and googleAPIjsonkey-content are mutually exclusive")
+	}
+	return nil
+}
+
+// checkIdentifiers makes sure the configured projects, datasets and tables can be
+// quoted in the generated SQL.
+func checkIdentifiers(cfg *Config) error {
+	var err error
+	check := func(flag string, names ...string) {
+		for _, name := range names {
+			if err == nil {
+				if invalid := bigquerydb.ValidateIdentifier(name); invalid != nil {
+					err = errors.Wrapf(invalid, "invalid %s", flag)
+				}
+			}
+		}
+	}
+	check("googleAPIdatasetID", cfg.googleAPIdatasetID)
+	check("googleAPItableID", cfg.googleAPItableID)
+	if cfg.googleAPIdataProject != "" {
+		check("googleAPIdataProjectID", cfg.googleAPIdataProject)
+	}
+	if cfg.aggregateTable != "" {
+		check("write.aggregate-table", cfg.aggregateTable)
+	}
+	for _, route := range cfg.writeRoutes {
+		if route.DatasetID != "" {
+			check("write.route", route.DatasetID)
+		}
+		check("write.route", route.TableID)
+	}
+	for _, target := range cfg.writeTargets {
+		check("write.target", target.datasetID, target.tableID)
+	}
+	for _, target := range cfg.readTargets {
+		check("read.target", target.datasetID, target.tableID)
+	}
+	if cfg.readTableID != "" {
+		check("read.table-override", cfg.readDatasetID, cfg.readTableID)
+	}
+	return err
+}
+
+// parseReadTemplate reads and parses the template of the SQL of read queries, which is
+// nil without one, so that errors in it fail at startup instead of with every query.
+func parseReadTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return nil, nil
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read read.sql-template")
+	}
+	tmpl, err := bigquerydb.ParseReadTemplate(string(text))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid read.sql-template %s", path)
+	}
+	return tmpl, nil
+}
+
+// parseBuckets parses the comma-separated upper bounds of the buckets of a histogram.
+func parseBuckets(flag, value string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || math.IsNaN(bound) {
+			return nil, errors.Errorf("invalid %s %q, expected a comma-separated list of numbers", flag, value)
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
+
+// formatBuckets formats the upper bounds of buckets as accepted by parseBuckets.
+func formatBuckets(buckets []float64) string {
+	fields := make([]string, len(buckets))
+	for i, bound := range buckets {
+		fields[i] = strconv.FormatFloat(bound, 'g', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseTemplateSuffix parses the template suffix, which may only depend on the tenant
+// with tenancy.
+func parseTemplateSuffix(spec string, staticLabels map[string]string, tenancy bool) (*bigquerydb.TemplateSuffix, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	suffix, err := bigquerydb.ParseTemplateSuffix(spec, staticLabels)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid bigquery.template-suffix %q", spec)
+	}
+	if !suffix.Static() && !tenancy {
+		return nil, errors.Errorf("invalid bigquery.template-suffix %q, it depends on the tenant without tenancy.enabled", spec)
+	}
+	return suffix, nil
+}
+
+// newApp defines the command line flags, which are parsed into cfg. It also returns
+// the googleProjectID flag, which is only required without a service account key.
+func newApp(cfg *Config) (*kingpin.Application, *kingpin.FlagClause) {
+	a := kingpin.New(filepath.Base(os.Args[0]), "Remote storage adapter")
+	a.HelpFlag.Short('h')
+
+	a.Command("serve", "Run the remote storage adapter.").Default()
+	backfill := a.Command("backfill", "Load the timestamped samples of Prometheus text exposition files in a directory into the table with BigQuery load jobs, one job per file.")
+	backfill.Arg("directory", "Directory holding the files to load. Hidden files are ignored.").
+		Required().ExistingDirVar(&cfg.backfillDir)
+	backfill.Flag("state-file", "File recording the files loaded so far, which are skipped when the backfill is run again. Defaults to .backfill-state in the directory.").
+		StringVar(&cfg.backfillStateFile)
+	backfill.Flag("dry-run", "Only parse the files and report the number of rows they would be loaded as.").
+		Default("false").BoolVar(&cfg.backfillDryRun)
+	migrate := a.Command("migrate", "Add the columns the configuration needs to the table and the write targets. Without --apply, only the plan is printed. Columns are never dropped or changed.")
+	migrate.Flag("apply", "Add the missing columns, unless a table has differences which can't be applied in place.").
+		Default("false").BoolVar(&cfg.migrateApply)
+	migrate.Flag("output", "Format of the plan. One of: [text, json]").
+		Default(migrateText).EnumVar(&cfg.migrateOutput, migrateText, migrateJSON)
+	replay := a.Command("replay", "Write the samples of dead-letter files again, with the clients of the tables they failed to be written to.")
+	replay.Arg("location", "Location of the dead-letter files, gs://bucket/prefix, a directory or a single file.").
+		Required().StringVar(&cfg.replayLocation)
+	replay.Flag("delete", "Delete every file once its samples were written.").
+		Default("false").BoolVar(&cfg.replayDelete)
+	export := a.Command("export", "Write the samples of the series matching the given matchers within a time range to a file.")
+	export.Flag("match", "Matcher selecting the exported series, given as label=value, label!=value, label=~regex, label!~regex or a plain metric name. Can be repeated.").
+		Required().StringsVar(&cfg.exportMatchers)
+	export.Flag("start", "Start of the exported time range, in RFC 3339 or as Unix timestamp in seconds.").
+		Required().StringVar(&cfg.exportStart)
+	export.Flag("end", "End of the exported time range, in RFC 3339 or as Unix timestamp in seconds. Defaults to now.").
+		StringVar(&cfg.exportEnd)
+	export.Flag("format", "Format of the output. One of: [openmetrics, csv, json]").
+		Default(exportOpenMetrics).EnumVar(&cfg.exportFormat, exportOpenMetrics, exportCSV, exportJSON)
+	export.Flag("output", "File the samples are written to, - for stdout.").
+		Default("-").StringVar(&cfg.exportOutput)
+
+	a.Flag("version", "Print version and build information, then exit").
+		Default("false").BoolVar(&cfg.printVersion)
+	a.Flag("googleAPIjsonkeypath", "Path to json keyfile for GCP service account. JSON keyfile also contains project_id").
+		Envar("PROMBQ_GCP_JSON").ExistingFileVar(&cfg.googleAPIjsonkeypath)
+	a.Flag("googleAPIjsonkey-check-interval", "How often the keyfile of googleAPIjsonkeypath is checked for changes. When its content changed, e.g. because the key was rotated, the BigQuery client is replaced with one using the new key. 0 disables the checks.").
+		Envar("PROMBQ_GCP_JSON_CHECK_INTERVAL").Default("1m").DurationVar(&cfg.keyCheckInterval)
+	a.Flag("googleAPIjsonkey-content", "Content of the json keyfile for GCP service account, as an alternative to googleAPIjsonkeypath. JSON keyfile also contains project_id").
+		Envar("PROMBQ_GCP_JSON_CONTENT").StringVar(&cfg.googleAPIjsonkey)
+	googleProjectIDFlagCause := a.Flag("googleProjectID", "The GCP Project ID is mandatory when neither googleAPIjsonkeypath nor googleAPIjsonkey-content is provided").
+		Envar("PROMBQ_GCP_PROJECT_ID")
+	googleProjectIDFlagCause.StringVar(&cfg.googleProjectID)
+	a.Flag("googleAPIdatasetID", "Dataset name as shown in GCP.").
+		Envar("PROMBQ_DATASET").Required().StringVar(&cfg.googleAPIdatasetID)
+	a.Flag("googleAPItableID", "Table name as shown in GCP.").
+		Envar("PROMBQ_TABLE").Required().StringVar(&cfg.googleAPItableID)
+	a.Flag("googleAPIdataProjectID", "Project of the dataset, when it differs from the project the BigQuery jobs run in and are billed to. Defaults to googleProjectID.").
+		Envar("PROMBQ_DATA_PROJECT_ID").StringVar(&cfg.googleAPIdataProject)
+	a.Flag("googleAPIlocation", "Location the BigQuery jobs run in, e.g. europe-west3. Derived from the dataset when not set.").
+		Envar("PROMBQ_LOCATION").StringVar(&cfg.googleAPIlocation)
+	a.Flag("bigquery.endpoint", "Endpoint of the BigQuery API, e.g. of an emulator for local development. Requests to it aren't authenticated.").
+		Envar("PROMBQ_BQ_ENDPOINT").StringVar(&cfg.bigqueryEndpoint)
+	a.Flag("storage", "Storage the serve command writes to and reads from: the BigQuery tables, or noop, which discards the written samples and answers reads without series, e.g. to load test the adapter without BigQuery. One of: [bigquery, noop]").
+		Envar("PROMBQ_STORAGE").Default(storageBigQuery).EnumVar(&cfg.storage, storageBigQuery, storageNoop)
+	a.Flag("storage.noop-latency", "Time every write and read of the noop storage takes.").
+		Envar("PROMBQ_STORAGE_NOOP_LATENCY").Default("0s").DurationVar(&cfg.noopLatency)
+	a.Flag("storage.noop-error-rate", "Fraction of the writes and reads of the noop storage which fail, between 0 and 1.").
+		Envar("PROMBQ_STORAGE_NOOP_ERROR_RATE").Default("0").Float64Var(&cfg.noopErrorRate)
+	a.Flag("googleAPI-impersonate-service-account", "Email of a service account to impersonate. The credentials of the adapter, e.g. from googleAPIjsonkeypath, need the Service Account Token Creator role on it.").
+		Envar("PROMBQ_IMPERSONATE_SERVICE_ACCOUNT").StringVar(&cfg.impersonate)
+	a.Flag("googleAPI-impersonate-delegate", "Email of a service account in the delegation chain used to impersonate the service account. Can be repeated.").
+		Envar("PROMBQ_IMPERSONATE_DELEGATES").StringsVar(&cfg.impersonateDelegates)
+	a.Flag("googleAPI-impersonate-scope", "OAuth2 scope of the impersonated credentials. Can be repeated. Defaults to the scopes of the BigQuery API.").
+		Envar("PROMBQ_IMPERSONATE_SCOPES").StringsVar(&cfg.impersonateScopes)
+	a.Flag("send-timeout", "Deprecated: use write.timeout and read.timeout. The default of both timeouts.").
+		Envar("PROMBQ_TIMEOUT").Default("30s").DurationVar(&cfg.remoteTimeout)
+	a.Flag("write.timeout", "The timeout of inserts into BigQuery. Defaults to send-timeout.").
+		Envar("PROMBQ_WRITE_TIMEOUT").Default("0s").DurationVar(&cfg.writeTimeout)
+	a.Flag("read.timeout", "The timeout of read queries. Defaults to send-timeout.").
+		Envar("PROMBQ_READ_TIMEOUT").Default("0s").DurationVar(&cfg.readTimeout)
+	a.Flag("write.max-rows-per-insert", "Maximum number of rows sent to BigQuery in a single insert call. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_ROWS_PER_INSERT").Default("50000").IntVar(&cfg.maxRowsPerInsert)
+	a.Flag("write.max-bytes-per-insert", "Maximum estimated size of a single insert call to BigQuery. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_BYTES_PER_INSERT").Default("9MiB").BytesVar(&cfg.maxBytesPerInsert)
+	a.Flag("write.concurrency", "Number of workers shared by all requests for inserting into BigQuery. 0 inserts directly from every request.").
+		Envar("PROMBQ_WRITE_CONCURRENCY").Default("0").IntVar(&cfg.writeConcurrency)
+	a.Flag("write.queue-size", "Number of inserts waiting for a free worker before write requests are rejected. Only used when write.concurrency is set.").
+		Envar("PROMBQ_WRITE_QUEUE_SIZE").Default("100").IntVar(&cfg.writeQueueSize)
+	a.Flag("write.async", "Buffer samples in memory and write them to BigQuery in the background instead of within the write request.").
+		Envar("PROMBQ_WRITE_ASYNC").Default("false").BoolVar(&cfg.writeAsync)
+	a.Flag("write.buffer-size", "Maximum number of samples held in memory in asynchronous mode. Write requests are rejected while the buffer is full, and larger requests always.").
+		Envar("PROMBQ_WRITE_BUFFER_SIZE").Default("100000").IntVar(&cfg.writeBufferSize)
+	a.Flag("write.flush-interval", "Maximum time samples are buffered in asynchronous mode before they are written to BigQuery.").
+		Envar("PROMBQ_WRITE_FLUSH_INTERVAL").Default("5s").DurationVar(&cfg.writeFlushInterval)
+	a.Flag("write.coalesce-max-delay", "Maximum time a write request waits for concurrent write requests to share its inserts. 0 disables the coalescing.").
+		Envar("PROMBQ_WRITE_COALESCE_MAX_DELAY").Default("0").DurationVar(&cfg.coalesceMaxDelay)
+	a.Flag("write.coalesce-max-rows", "Number of pending rows of coalesced write requests which are flushed immediately. 0 uses write.max-rows-per-insert.").
+		Envar("PROMBQ_WRITE_COALESCE_MAX_ROWS").Default("0").IntVar(&cfg.coalesceMaxRows)
+	a.Flag("write.coalesce-max-bytes", "Estimated size of the pending rows of coalesced write requests which are flushed immediately. 0 uses write.max-bytes-per-insert.").
+		Envar("PROMBQ_WRITE_COALESCE_MAX_BYTES").Default("0").BytesVar(&cfg.coalesceMaxBytes)
+	a.Flag("write.spill-dir", "Directory the samples of writes failing with a retryable error are written to and replayed from once BigQuery recovers. Empty disables the spill.").
+		Envar("PROMBQ_WRITE_SPILL_DIR").Default("").StringVar(&cfg.spillDir)
+	a.Flag("write.spill-max-bytes", "Maximum size of the spill directory per table. The oldest spilled samples are dropped when it is full.").
+		Envar("PROMBQ_WRITE_SPILL_MAX_BYTES").Default("1GiB").BytesVar(&cfg.spillMaxBytes)
+	a.Flag("write.spill-replay-interval", "Interval at which spilled samples are replayed to BigQuery.").
+		Envar("PROMBQ_WRITE_SPILL_REPLAY_INTERVAL").Default("10s").DurationVar(&cfg.spillReplayInterval)
+	a.Flag("bigquery.write-method", "How the rows are written to BigQuery: streaming to insert them with the streaming API, or load-job to stage them as objects in Cloud Storage and load them with load jobs, which is cheaper but delays the samples.").
+		Envar("PROMBQ_BIGQUERY_WRITE_METHOD").Default(bigquerydb.WriteMethodStreaming).EnumVar(&cfg.writeMethod, bigquerydb.WriteMethodStreaming, bigquerydb.WriteMethodLoadJob)
+	a.Flag("write.load-job-location", "Location the rows are staged in with bigquery.write-method load-job, gs://bucket/prefix. Every table gets its own prefix below it.").
+		Envar("PROMBQ_WRITE_LOAD_JOB_LOCATION").Default("").StringVar(&cfg.loadJobLocation)
+	a.Flag("write.load-job-max-bytes", "Uncompressed size of the rows of a staged object which is loaded immediately.").
+		Envar("PROMBQ_WRITE_LOAD_JOB_MAX_BYTES").Default("64MiB").BytesVar(&cfg.loadJobMaxBytes)
+	a.Flag("write.load-job-interval", "Age of the first row of a staged object at which it is loaded, and interval at which failed uploads and load jobs are retried.").
+		Envar("PROMBQ_WRITE_LOAD_JOB_INTERVAL").Default("5m").DurationVar(&cfg.loadJobInterval)
+	a.Flag("write.deadletter", "Location the samples the adapter gives up writing are stored in as files of newline-delimited JSON, gs://bucket/prefix or a directory. Empty disables the dead-letter sink.").
+		Envar("PROMBQ_WRITE_DEADLETTER").Default("").StringVar(&cfg.deadLetter)
+	a.Flag("write.deadletter-table", "Table the samples the adapter gives up writing are stored in, as dataset.table or as table in the dataset of the table written to. Empty disables it.").
+		Envar("PROMBQ_WRITE_DEADLETTER_TABLE").Default("").StringVar(&cfg.deadLetterTable)
+	a.Flag("write.deadletter-max-bytes", "Maximum size of the samples stored in the dead-letter sink per hour and table. The samples beyond are dropped. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_DEADLETTER_MAX_BYTES").Default("100MiB").BytesVar(&cfg.deadLetterMaxBytes)
+	a.Flag("write.deduplicate", "Attach a deterministic insert ID to every row, so BigQuery drops rows sent again by retried write requests on a best-effort basis.").
+		Envar("PROMBQ_WRITE_DEDUPLICATE").Default("false").BoolVar(&cfg.writeDeduplicate)
+	a.Flag("bigquery.skip-schema-check", "Start even if the table doesn't exist or its schema doesn't match the columns the adapter writes and reads.").
+		Envar("PROMBQ_BIGQUERY_SKIP_SCHEMA_CHECK").Default("false").BoolVar(&cfg.skipSchemaCheck)
+	a.Flag("bigquery.create-table", "Create the tables written to if they don't exist, partitioned as set by bigquery.partitioning and bigquery.partition-granularity and clustered on metricname.").
+		Envar("PROMBQ_BIGQUERY_CREATE_TABLE").Default("false").BoolVar(&cfg.createTable)
+	a.Flag("bigquery.template-suffix", "Insert into template tables named like the table followed by this suffix, which BigQuery creates from the table on the first insert, e.g. _dev. It is a text/template of the static labels as .Labels, e.g. _{{.Labels.env}}, and, with tenancy.enabled, the tenant as .Tenant.").
+		Envar("PROMBQ_BIGQUERY_TEMPLATE_SUFFIX").StringVar(&cfg.templateSuffixSpec)
+	a.Flag("bigquery.partitioning", "How the tables are partitioned: column by the timestamp column, or ingestion by the time BigQuery ingested the rows. Tables are created with it, startup fails for tables partitioned in another way, and reads of tables partitioned by ingestion time only scan the partitions which may hold samples of their time range.").
+		Envar("PROMBQ_BIGQUERY_PARTITIONING").Default(bigquerydb.PartitioningColumn).EnumVar(&cfg.partitioning, bigquerydb.PartitioningColumn, bigquerydb.PartitioningIngestion)
+	a.Flag("bigquery.partition-granularity", "Time span of a partition: hour, day or month.").
+		Envar("PROMBQ_BIGQUERY_PARTITION_GRANULARITY").Default(bigquerydb.PartitionDay).EnumVar(&cfg.partitionGranularity, bigquerydb.PartitionHour, bigquerydb.PartitionDay, bigquerydb.PartitionMonth)
+	a.Flag("bigquery.date-sharding", "How the tables are sharded by date: none, or daily to write the samples of every day to a table named like the table followed by _YYYYMMDD of the day in UTC, and read from the shards of the days of the time range.").
+		Envar("PROMBQ_BIGQUERY_DATE_SHARDING").Default(bigquerydb.DateShardingNone).EnumVar(&cfg.dateSharding, bigquerydb.DateShardingNone, bigquerydb.DateShardingDaily)
+	a.Flag("bigquery.skip-invalid-rows", "Insert the valid rows of an insert with invalid rows. When disabled, BigQuery rejects inserts with an invalid row as a whole.").
+		Envar("PROMBQ_BIGQUERY_SKIP_INVALID_ROWS").Default("true").BoolVar(&cfg.skipInvalidRows)
+	a.Flag("bigquery.ignore-unknown-values", "Ignore values of rows which don't match a column of the table instead of rejecting the rows.").
+		Envar("PROMBQ_BIGQUERY_IGNORE_UNKNOWN_VALUES").Default("false").BoolVar(&cfg.ignoreUnknownValues)
+	a.Flag("bigquery.tags-type", "How the labels are stored: string for a tags column with a JSON encoded STRING, json for a tags column of the native JSON type, labels for a labels column of REPEATED RECORD<name, value>, or auto to detect it from the schema of every table.").
+		Envar("PROMBQ_BIGQUERY_TAGS_TYPE").Default(bigquerydb.TagsTypeString).EnumVar(&cfg.tagsType, bigquerydb.TagsTypeString, bigquerydb.TagsTypeJSON, bigquerydb.TagsTypeLabels, bigquerydb.TagsTypeAuto)
+	a.Flag("bigquery.special-value-column", "Write NaN and infinite values as rows with a NULL value and the value in a nullable STRING column special_value instead of dropping them, and read them back as the original values.").
+		Envar("PROMBQ_BIGQUERY_SPECIAL_VALUE_COLUMN").Default("false").BoolVar(&cfg.specialValueColumn)
+	a.Flag("bigquery.series-hash-column", "Write the fingerprint of the labels of every series to an INT64 column series_hash, and use it to merge the rows of reads into series.").
+		Envar("PROMBQ_BIGQUERY_SERIES_HASH_COLUMN").Default("false").BoolVar(&cfg.seriesHashColumn)
+	a.Flag("bigquery.insert-time-column", "Write the time every row is sent to BigQuery to a TIMESTAMP column insert_time, which reads ignore.").
+		Envar("PROMBQ_BIGQUERY_INSERT_TIME_COLUMN").Default("false").BoolVar(&cfg.insertTimeColumn)
+	a.Flag("bigquery.timestamp-type", "How the timestamp column stores the time of a sample: timestamp for a TIMESTAMP with second precision, int64_millis for an INT64 of milliseconds since the epoch, or auto to detect it from the schema of every table.").
+		Envar("PROMBQ_BIGQUERY_TIMESTAMP_TYPE").Default(bigquerydb.TimestampTypeTimestamp).EnumVar(&cfg.timestampType, bigquerydb.TimestampTypeTimestamp, bigquerydb.TimestampTypeMillis, bigquerydb.TimestampTypeAuto)
+	a.Flag("write.dry-run", "Build the rows of write requests and update the metrics, but never send them to BigQuery. Summaries of the inserts are logged at debug level.").
+		Envar("PROMBQ_WRITE_DRY_RUN").Default("false").BoolVar(&cfg.writeDryRun)
+	a.Flag("write.max-sample-age", "Drop samples older than this when they are written. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_SAMPLE_AGE").Default("0").DurationVar(&cfg.writeMaxSampleAge)
+	a.Flag("write.reject-old", "Reject write requests with samples older than write.max-sample-age with 400 instead of dropping the samples.").
+		Envar("PROMBQ_WRITE_REJECT_OLD").Default("false").BoolVar(&cfg.writeRejectOld)
+	a.Flag("write.max-future-skew", "Handle samples further than this ahead of the current time according to write.future-behavior. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_FUTURE_SKEW").Default("10m").DurationVar(&cfg.writeMaxFutureSkew)
+	a.Flag("write.future-behavior", "What to do with samples beyond write.max-future-skew: drop them, clamp them to the current time or reject the write request with 400.").
+		Envar("PROMBQ_WRITE_FUTURE_BEHAVIOR").Default(bigquerydb.FutureSampleDrop).EnumVar(&cfg.writeFutureBehavior, bigquerydb.FutureSampleDrop, bigquerydb.FutureSampleClamp, bigquerydb.FutureSampleReject)
+	a.Flag("write.store-stale-markers", "Write the staleness markers of Prometheus as rows with a NULL value instead of dropping them.").
+		Envar("PROMBQ_WRITE_STORE_STALE_MARKERS").Default("false").BoolVar(&cfg.writeStoreStale)
+	a.Flag("write.strict-validation", "Reject write requests with series with a malformed label set with 400 instead of dropping these series.").
+		Envar("PROMBQ_WRITE_STRICT_VALIDATION").Default("false").BoolVar(&cfg.writeStrict)
+	a.Flag("write.allow-utf8-names", "Accept metric and label names with any UTF-8 characters instead of only the legacy Prometheus charset.").
+		Envar("PROMBQ_WRITE_ALLOW_UTF8_NAMES").Default("false").BoolVar(&cfg.writeAllowUTF8Names)
+	a.Flag("write.max-series-per-request", "Maximum number of series of a write request. Larger requests are handled according to write.max-series-behavior. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_SERIES_PER_REQUEST").Default("100000").IntVar(&cfg.writeMaxSeries)
+	a.Flag("write.max-series-behavior", "What happens to write requests with more series than write.max-series-per-request. One of: [reject, trim]").
+		Envar("PROMBQ_WRITE_MAX_SERIES_BEHAVIOR").Default(seriesLimitReject).EnumVar(&cfg.writeMaxSeriesBehavior, seriesLimitReject, seriesLimitTrim)
+	a.Flag("write.max-labels-per-series", "Drop series with more labels than this, including the metric name. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_LABELS_PER_SERIES").Default("128").IntVar(&cfg.writeMaxLabels)
+	a.Flag("write.max-label-value-length", "Drop series with a label value longer than this many bytes. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_LABEL_VALUE_LENGTH").Default("4096").IntVar(&cfg.writeMaxLabelValueLength)
+	cfg.writeStaticLabels = map[string]string{}
+	a.Flag("write.static-label", "Label added to every written series as key=value, e.g. the cluster of the adapter. Labels sent with the series take precedence unless write.static-label-override is set. Can be repeated.").
+		Envar("PROMBQ_WRITE_STATIC_LABELS").StringMapVar(&cfg.writeStaticLabels)
+	a.Flag("write.static-label-override", "Replace labels sent with the series by the static labels of the same name instead of keeping them.").
+		Envar("PROMBQ_WRITE_STATIC_LABEL_OVERRIDE").Default("false").BoolVar(&cfg.writeStaticOverride)
+	a.Flag("write.max-row-size", "Maximum estimated size of a single row, BigQuery rejects inserts with larger rows. Larger rows are handled according to write.oversize-behavior. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_MAX_ROW_SIZE").Default("1MiB").BytesVar(&cfg.writeMaxRowSize)
+	a.Flag("write.oversize-behavior", "What to do with rows larger than write.max-row-size: drop them, or truncate their label values to write.truncated-label-length and add the label __truncated__=\"true\".").
+		Envar("PROMBQ_WRITE_OVERSIZE_BEHAVIOR").Default(bigquerydb.OversizeDrop).EnumVar(&cfg.writeOversize, bigquerydb.OversizeDrop, bigquerydb.OversizeTruncate)
+	a.Flag("write.truncated-label-length", "Length in bytes label values of oversized rows are truncated to with write.oversize-behavior=truncate.").
+		Envar("PROMBQ_WRITE_TRUNCATED_LABEL_LENGTH").Default("1024").IntVar(&cfg.writeTruncatedLength)
+	a.Flag("metrics.per-metric-samples", "Expose the number of written samples by metric name in storage_bigquery_sent_samples_by_metric_total.").
+		Envar("PROMBQ_METRICS_PER_METRIC_SAMPLES").Default("false").BoolVar(&cfg.perMetricSamples)
+	a.Flag("metrics.namespace", "Prefix of the names of the metrics of the adapter, except the http ones. Empty for no prefix.").
+		Envar("PROMBQ_METRICS_NAMESPACE").Default(metricfactory.DefaultNamespace).StringVar(&cfg.metricsNamespace)
+	cfg.metricsConstLabels = map[string]string{}
+	a.Flag("metrics.const-label", "Label added to all metrics of the adapter as key=value, e.g. to tell instances apart. Can be repeated.").
+		Envar("PROMBQ_METRICS_CONST_LABELS").StringMapVar(&cfg.metricsConstLabels)
+	a.Flag("metrics.write-duration-buckets", "Comma-separated upper bounds of the buckets of the histograms of write durations, in seconds.").
+		Envar("PROMBQ_METRICS_WRITE_DURATION_BUCKETS").Default(formatBuckets(metricfactory.DefaultWriteDurationBuckets)).StringVar(&cfg.metricsWriteBuckets)
+	a.Flag("metrics.read-duration-buckets", "Comma-separated upper bounds of the buckets of the histograms of read durations, in seconds.").
+		Envar("PROMBQ_METRICS_READ_DURATION_BUCKETS").Default(formatBuckets(metricfactory.DefaultReadDurationBuckets)).StringVar(&cfg.metricsReadBuckets)
+	a.Flag("metrics.per-metric-samples-limit", "Maximum number of metric names counted on their own with metrics.per-metric-samples. The samples of all further metric names are counted as \"other\".").
+		Envar("PROMBQ_METRICS_PER_METRIC_SAMPLES_LIMIT").Default("100").IntVar(&cfg.perMetricSamplesLimit)
+	a.Flag("bigquery.retention", "How long samples are kept in the table. Partitioned tables get a partition expiration equal to it, from other tables older rows are deleted. 0 keeps samples forever.").
+		Envar("PROMBQ_BIGQUERY_RETENTION").Default("0s").DurationVar(&cfg.retention)
+	a.Flag("retention.interval", "Interval the retention is enforced at after startup.").
+		Envar("PROMBQ_RETENTION_INTERVAL").Default("24h").DurationVar(&cfg.retentionInterval)
+	a.Flag("retention.enforce", "Update the partition expiration or delete rows to enforce bigquery.retention. When disabled, the changes are only logged.").
+		Envar("PROMBQ_RETENTION_ENFORCE").Default("false").BoolVar(&cfg.retentionEnforce)
+	a.Flag("leader-election.enabled", "Run the periodic tasks changing the table, like enforcing the retention, only on the replica elected as leader.").
+		Envar("PROMBQ_LEADER_ELECTION_ENABLED").Default("false").BoolVar(&cfg.leaderElection)
+	a.Flag("leader-election.kubernetes", "Elect the leader with a Kubernetes Lease instead of a row in leader-election.table.").
+		Envar("PROMBQ_LEADER_ELECTION_KUBERNETES").Default("false").BoolVar(&cfg.leaderKubernetes)
+	a.Flag("leader-election.name", "Name of the election, shared by the replicas of a deployment. Defaults to prombq- and the table ID.").
+		Envar("PROMBQ_LEADER_ELECTION_NAME").StringVar(&cfg.leaderName)
+	a.Flag("leader-election.namespace", "Namespace of the Kubernetes Lease. Defaults to the namespace of the pod.").
+		Envar("PROMBQ_LEADER_ELECTION_NAMESPACE").StringVar(&cfg.leaderNamespace)
+	a.Flag("leader-election.table", "Table in the dataset of the primary table holding the lease of the leader, unless leader-election.kubernetes is set.").
+		Envar("PROMBQ_LEADER_ELECTION_TABLE").Default("prombq_leader").StringVar(&cfg.leaderTable)
+	a.Flag("leader-election.lease-duration", "How long the lease of the leader lasts without being renewed, after which another replica takes over.").
+		Envar("PROMBQ_LEADER_ELECTION_LEASE_DURATION").Default("60s").DurationVar(&cfg.leaderLeaseDuration)
+	a.Flag("leader-election.renew-interval", "Interval the lease is taken or renewed at. Must be shorter than leader-election.lease-duration.").
+		Envar("PROMBQ_LEADER_ELECTION_RENEW_INTERVAL").Default("20s").DurationVar(&cfg.leaderRenewInterval)
+	a.Flag("write.aggregate-table", "Table in the same dataset the minimum, maximum, average and count of every series per write.aggregate-interval are written to. Empty disables the aggregation.").
+		Envar("PROMBQ_WRITE_AGGREGATE_TABLE").StringVar(&cfg.aggregateTable)
+	a.Flag("write.aggregate-interval", "Interval the samples written to write.aggregate-table are aggregated over.").
+		Envar("PROMBQ_WRITE_AGGREGATE_INTERVAL").Default("5m").DurationVar(&cfg.aggregateInterval)
+	a.Flag("write.aggregate-lateness", "How long after the end of an interval samples are still added to its aggregates, before they are written to write.aggregate-table. Later samples are left out.").
+		Envar("PROMBQ_WRITE_AGGREGATE_LATENESS").Default("5m").DurationVar(&cfg.aggregateLateness)
+	a.Flag("write.rate-limit", "Maximum rate of write requests per second, or of samples per second with write.rate-limit-unit=samples. Requests above it are rejected with 429. 0 disables the limit.").
+		Envar("PROMBQ_WRITE_RATE_LIMIT").Default("0").Float64Var(&cfg.writeRateLimit)
+	a.Flag("write.rate-burst", "Number of write requests, or samples, accepted at once above write.rate-limit. With write.rate-limit-unit=samples, larger requests are rejected with 413.").
+		Envar("PROMBQ_WRITE_RATE_BURST").Default("10").IntVar(&cfg.writeRateBurst)
+	a.Flag("write.rate-limit-unit", "What write.rate-limit and write.rate-burst count. One of: [requests, samples]").
+		Envar("PROMBQ_WRITE_RATE_LIMIT_UNIT").Default(rateLimitRequests).EnumVar(&cfg.writeRateLimitUnit, rateLimitRequests, rateLimitSamples)
+	a.Flag("write.quota-backoff", "Retry-After of the first write answered with 429 because a BigQuery quota or rate limit was exceeded. It doubles with every consecutive one up to write.quota-max-backoff.").
+		Envar("PROMBQ_WRITE_QUOTA_BACKOFF").Default("5s").DurationVar(&cfg.writeQuotaBackoff)
+	a.Flag("write.quota-max-backoff", "Maximum Retry-After of writes answered with 429 because a BigQuery quota or rate limit was exceeded.").
+		Envar("PROMBQ_WRITE_QUOTA_MAX_BACKOFF").Default("2m").DurationVar(&cfg.writeQuotaMaxBackoff)
+	a.Flag("write.max-logged-row-errors", "Maximum number of rows rejected by BigQuery which are logged individually per insert.").
+		Envar("PROMBQ_WRITE_MAX_LOGGED_ROW_ERRORS").Default("10").IntVar(&cfg.maxLoggedRowErrors)
+	a.Flag("write.row-retries", "Number of times rows rejected by BigQuery are inserted again, without the rows which were written. Rows rejected as invalid are dropped instead.").
+		Envar("PROMBQ_WRITE_ROW_RETRIES").Default("2").IntVar(&cfg.rowRetries)
+	a.Flag("write.row-retry-backoff", "Time to wait before the first retry of rejected rows. It doubles with every further retry.").
+		Envar("PROMBQ_WRITE_ROW_RETRY_BACKOFF").Default("100ms").DurationVar(&cfg.rowRetryBackoff)
+	a.Flag("read.max-samples", "Maximum number of samples a single read request may return. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_SAMPLES").Default("0").IntVar(&cfg.readMaxSamples)
+	a.Flag("read.max-response-bytes", "Maximum approximate size of the response of a single read request. Reads exceeding it are aborted while their rows are merged. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_RESPONSE_BYTES").Default("0").BytesVar(&cfg.readMaxResponseBytes)
+	a.Flag("read.max-rows", "Maximum number of rows a single query of a read request may return. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_ROWS").Default("0").IntVar(&cfg.readMaxRows)
+	a.Flag("read.max-bytes-scanned", "Maximum number of bytes a single query of a read request may scan, as estimated by a dry run. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_BYTES_SCANNED").Default("0").BytesVar(&cfg.readMaxBytesScanned)
+	a.Flag("read.dry-run-min-range", "Queries over a time range shorter than this skip the dry run of read.max-bytes-scanned, saving a round trip to BigQuery for queries assumed to be cheap. 0 checks all queries.").
+		Envar("PROMBQ_READ_DRY_RUN_MIN_RANGE").Default("0").DurationVar(&cfg.readDryRunMinRange)
+	a.Flag("read.require-metric-name", "Reject read queries without an equality or regex matcher on the metric name, which would scan all metrics.").
+		Envar("PROMBQ_READ_REQUIRE_METRIC_NAME").Default("false").BoolVar(&cfg.readRequireMetricName)
+	a.Flag("read.skip-bad-rows", "Leave rows which can't be converted into samples out of read responses instead of failing the read.").
+		Envar("PROMBQ_READ_SKIP_BAD_ROWS").Default("false").BoolVar(&cfg.readSkipBadRows)
+	a.Flag("read.max-range", "Maximum time range of a single query of a read request. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_RANGE").Default("0").DurationVar(&cfg.readMaxRange)
+	a.Flag("read.max-range-behavior", "What happens to queries over a longer range than read.max-range. One of: [reject, truncate]").
+		Envar("PROMBQ_READ_MAX_RANGE_BEHAVIOR").Default(bigquerydb.RangeLimitReject).EnumVar(&cfg.readMaxRangeBehavior, bigquerydb.RangeLimitReject, bigquerydb.RangeLimitTruncate)
+	a.Flag("read.slow-query-threshold", "Log the read queries which take longer than this at warn level, with their matchers, time range, duration, rows and BigQuery job. The SQL is only logged at debug level. 0 disables the log.").
+		Envar("PROMBQ_READ_SLOW_QUERY_THRESHOLD").Default("0").DurationVar(&cfg.readSlowQuery)
+	a.Flag("read.cache-ttl", "How long the results of read queries are cached. 0 disables the cache.").
+		Envar("PROMBQ_READ_CACHE_TTL").Default("0s").DurationVar(&cfg.readCacheTTL)
+	a.Flag("read.cache-max-entries", "Maximum number of read queries held in the cache.").
+		Envar("PROMBQ_READ_CACHE_MAX_ENTRIES").Default("1000").IntVar(&cfg.readCacheMaxEntries)
+	a.Flag("read.cache-bucket", "The time range of cached read queries is widened to multiples of this duration, so that repeated queries with a slightly moved time range hit the cache.").
+		Envar("PROMBQ_READ_CACHE_BUCKET").Default("1m").DurationVar(&cfg.readCacheBucket)
+	a.Flag("read.cache-freshness", "Read queries ending less than this duration ago are not cached, as their data may still change.").
+		Envar("PROMBQ_READ_CACHE_FRESHNESS").Default("10m").DurationVar(&cfg.readCacheFreshness)
+	a.Flag("read.use-storage-api", "Fetch the results of read queries with the BigQuery Storage Read API. Requires the bigquery.readsessions.create permission.").
+		Envar("PROMBQ_READ_USE_STORAGE_API").Default("false").BoolVar(&cfg.readUseStorageAPI)
+	a.Flag("read.server-side-sort", "Let BigQuery sort the rows of read queries by timestamp. When disabled, the samples of every series are only sorted by the adapter, which saves BigQuery from sorting all rows.").
+		Envar("PROMBQ_READ_SERVER_SIDE_SORT").Default("true").BoolVar(&cfg.readServerSideSort)
+	a.Flag("read.deduplicate", "Return a single row for every series and timestamp from read queries, so that rows written more than once, e.g. by retried inserts or several Prometheus replicas, aren't returned as repeated samples.").
+		Envar("PROMBQ_READ_DEDUPLICATE").Default("false").BoolVar(&cfg.readDeduplicate)
+	a.Flag("read.table-override", "Table or view read queries and exports select from instead of the table samples are written to, given as table or dataset.table. The dataset defaults to googleAPIdatasetID.").
+		Envar("PROMBQ_READ_TABLE_OVERRIDE").StringVar(&cfg.readTableOverride)
+	a.Flag("read.sql-template", "File with a text/template rendering the SQL of read queries and exports from the columns, the table, the matcher conditions and the time range. Defaults to the built-in query.").
+		Envar("PROMBQ_READ_SQL_TEMPLATE").ExistingFileVar(&cfg.readSQLTemplate)
+	a.Flag("read.query-priority", "Priority of read queries. Batch queries may wait for free slots, but have to complete within read.timeout. One of: [interactive, batch]").
+		Envar("PROMBQ_READ_QUERY_PRIORITY").Default("interactive").EnumVar(&cfg.readQueryPriority, "interactive", "batch")
+	a.Flag("read.max-bytes-billed", "Maximum number of bytes a single read query may bill. BigQuery fails queries above it. 0 uses the project default.").
+		Envar("PROMBQ_READ_MAX_BYTES_BILLED").Default("0").BytesVar(&cfg.readMaxBytesBilled)
+	a.Flag("read.max-concurrent-queries", "Maximum number of BigQuery queries the reads of all tables run at once. Further queries wait for a slot. 0 disables the limit.").
+		Envar("PROMBQ_READ_MAX_CONCURRENT_QUERIES").Default("0").IntVar(&cfg.readMaxQueries)
+	a.Flag("read.queue-timeout", "How long a query waits for a slot of read.max-concurrent-queries before its read fails with 503. 0 waits as long as the read.").
+		Envar("PROMBQ_READ_QUEUE_TIMEOUT").Default("10s").DurationVar(&cfg.readQueueTimeout)
+	a.Flag("read.split-interval", "Split read queries at the multiples of this interval into sub-range queries which run concurrently, at most read.max-concurrent-queries at once. 0 disables splitting.").
+		Envar("PROMBQ_READ_SPLIT_INTERVAL").Default("0s").DurationVar(&cfg.readSplitInterval)
+	cfg.jobLabels = map[string]string{}
+	a.Flag("bigquery.job-label", "Label attached to the BigQuery jobs of the adapter as key=value, e.g. for cost attribution. Can be repeated.").
+		Envar("PROMBQ_JOB_LABELS").StringMapVar(&cfg.jobLabels)
+	a.Flag("bigquery.breaker-failures", "Number of consecutive failed writes or reads which open the circuit breaker. While open, requests fail immediately with 503. 0 disables the condition.").
+		Envar("PROMBQ_BREAKER_FAILURES").Default("0").IntVar(&cfg.breakerFailures)
+	a.Flag("bigquery.breaker-failure-ratio", "Ratio of failed writes and reads among the last bigquery.breaker-window ones which opens the circuit breaker. 0 disables the condition.").
+		Envar("PROMBQ_BREAKER_FAILURE_RATIO").Default("0").Float64Var(&cfg.breakerFailureRatio)
+	a.Flag("bigquery.breaker-window", "Number of the last writes and reads bigquery.breaker-failure-ratio is computed over.").
+		Envar("PROMBQ_BREAKER_WINDOW").Default("20").IntVar(&cfg.breakerWindow)
+	a.Flag("bigquery.breaker-open-duration", "How long the circuit breaker stays open before it lets probe requests through.").
+		Envar("PROMBQ_BREAKER_OPEN_DURATION").Default("30s").DurationVar(&cfg.breakerOpenDuration)
+	a.Flag("bigquery.breaker-half-open-probes", "Number of probe requests which must succeed to close the circuit breaker again.").
+		Envar("PROMBQ_BREAKER_HALF_OPEN_PROBES").Default("1").IntVar(&cfg.breakerProbes)
+	a.Flag("web.listen-address", "Address to listen on for web endpoints, host:port or unix:// followed by the path of a UNIX domain socket.").
+		Envar("PROMBQ_LISTEN").Default(":9201").StringVar(&cfg.listenAddr)
+	a.Flag("web.socket-mode", "Octal permissions of the UNIX domain sockets listened on.").
+		Envar("PROMBQ_SOCKET_MODE").Default("0660").StringVar(&cfg.socketModeSpec)
+	a.Flag("web.telemetry-listen-address", "Address of a separate listener for the metrics, e.g. :9203, for scrapers which can't reach web.listen-address. By default the metrics are served on web.listen-address.").
+		Envar("PROMBQ_TELEMETRY_LISTEN").Default("").StringVar(&cfg.telemetryListenAddr)
+	a.Flag("web.admin-listen-address", "Address of a separate listener for the pprof endpoints and, with web.admin-metrics, the metrics, e.g. localhost:9202. By default they are served on web.listen-address.").
+		Envar("PROMBQ_ADMIN_LISTEN").Default("").StringVar(&cfg.adminListenAddr)
+	a.Flag("web.admin-metrics", "Serve the metrics on web.admin-listen-address instead of web.listen-address.").
+		Envar("PROMBQ_ADMIN_METRICS").Default("false").BoolVar(&cfg.adminMetrics)
+	a.Flag("web.access-log", "Log one line per request with the client, the status code, the size of the request, the number of written samples and the duration.").
+		Envar("PROMBQ_ACCESS_LOG").Default("false").BoolVar(&cfg.accessLog)
+	a.Flag("web.access-log-sample", "Only log every n-th request with web.access-log.").
+		Envar("PROMBQ_ACCESS_LOG_SAMPLE").Default("1").IntVar(&cfg.accessLogSample)
+	a.Flag("web.access-log-trust-forwarded-for", "Log the first address of the X-Forwarded-For header as the client with web.access-log. Only enable it behind a proxy which sets the header.").
+		Envar("PROMBQ_ACCESS_LOG_TRUST_FORWARDED_FOR").Default("false").BoolVar(&cfg.trustForwardedFor)
+	a.Flag("web.enable-pprof", "Enable the /debug/pprof endpoints, which expose heap profiles and goroutine dumps of the adapter.").
+		Envar("PROMBQ_ENABLE_PPROF").Default("false").BoolVar(&cfg.enablePprof)
+	a.Flag("web.max-request-size", "Maximum size of a write or read request body, both compressed and decompressed. Larger requests are rejected with 413. 0 disables the limit.").
+		Envar("PROMBQ_MAX_REQUEST_SIZE").Default("64MiB").BytesVar(&cfg.maxRequestSize)
+	a.Flag("web.read-timeout", "Maximum duration for reading an entire request, including the body. 0 disables the timeout.").
+		Envar("PROMBQ_HTTP_READ_TIMEOUT").Default("1m").DurationVar(&cfg.httpReadTimeout)
+	a.Flag("web.read-header-timeout", "Maximum duration for reading the headers of a request. 0 disables the timeout.").
+		Envar("PROMBQ_HTTP_READ_HEADER_TIMEOUT").Default("5s").DurationVar(&cfg.httpHeaderTimeout)
+	a.Flag("web.write-timeout", "Maximum duration from the end of reading the request headers until the end of writing the response. Must be larger than read.timeout. Defaults to the larger of write.timeout and read.timeout plus 15s.").
+		Envar("PROMBQ_HTTP_WRITE_TIMEOUT").Default("0s").DurationVar(&cfg.httpWriteTimeout)
+	a.Flag("web.idle-timeout", "Maximum duration to wait for the next request on a keep-alive connection.").
+		Envar("PROMBQ_HTTP_IDLE_TIMEOUT").Default("120s").DurationVar(&cfg.httpIdleTimeout)
+	a.Flag("web.enable-debug-read", "Enable the /api/v1/read_debug endpoint, which runs JSON encoded matchers like a remote read and returns the generated SQL, the BigQuery job statistics and the resulting series.").
+		Envar("PROMBQ_ENABLE_DEBUG_READ").Default("false").BoolVar(&cfg.enableDebugRead)
+	a.Flag("web.enable-config", "Enable the /api/v1/config endpoint, which returns the values of all flags and where they came from, with secrets redacted. It is served on web.admin-listen-address if set.").
+		Envar("PROMBQ_ENABLE_CONFIG").Default("false").BoolVar(&cfg.enableConfig)
+	a.Flag("web.enable-metadata-api", "Enable the /api/v1/label/<name>/values and /api/v1/series endpoints of the Prometheus API, which look up label values and series in BigQuery, e.g. for the variables of Grafana dashboards. The read limits apply to their queries.").
+		Envar("PROMBQ_ENABLE_METADATA_API").Default("false").BoolVar(&cfg.enableMetadataAPI)
+	a.Flag("web.json-errors", "Answer failed /write and /read requests with a JSON body like the error envelope of the Prometheus API, also if the client doesn't send Accept: application/json.").
+		Envar("PROMBQ_JSON_ERRORS").Default("false").BoolVar(&cfg.jsonErrors)
+	a.Flag("otlp.enabled", "Enable the /otlp/v1/metrics endpoint, which accepts OTLP/HTTP protobuf metrics and writes them like remote write requests.").
+		Envar("PROMBQ_OTLP_ENABLED").Default("false").BoolVar(&cfg.otlpEnabled)
+	a.Flag("web.telemetry-path", "Address to listen on for web endpoints.").
+		Envar("PROMBQ_TELEMETRY").Default("/metrics").StringVar(&cfg.telemetryPath)
+	a.Flag("web.route-prefix", "Prefix of the paths of all endpoints on all listeners, e.g. /bq-adapter when a reverse proxy forwards the requests below that path unchanged.").
+		Envar("PROMBQ_ROUTE_PREFIX").Default("/").StringVar(&cfg.routePrefix)
+	a.Flag("web.write-path", "Path of the remote write endpoint, e.g. /api/v1/write.").
+		Envar("PROMBQ_WRITE_PATH").Default(defaultWritePath).StringVar(&cfg.writePath)
+	a.Flag("web.read-path", "Path of the remote read endpoint, e.g. /api/v1/read.").
+		Envar("PROMBQ_READ_PATH").Default(defaultReadPath).StringVar(&cfg.readPath)
+	a.Flag("web.legacy-paths", "Serve the write and read endpoints at /write and /read as well as at web.write-path and web.read-path, while Prometheus servers are moved to the new paths.").
+		Envar("PROMBQ_LEGACY_PATHS").Default("false").BoolVar(&cfg.legacyPaths)
+	a.Flag("web.external-url", "URL the adapter is reachable at from the outside, e.g. behind an ingress, shown by the status endpoint and logged at startup.").
+		Envar("PROMBQ_EXTERNAL_URL").StringVar(&cfg.externalURL)
+	cfg.promslogConfig.Level = &promslog.AllowedLevel{}
+	a.Flag("log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error]").
+		Envar("PROMBQ_LOG_LEVEL").Default("info").SetValue(cfg.promslogConfig.Level)
+	a.Flag("log.format", "Output format of log messages. gcp writes the JSON Google Cloud Logging parses, with severities and, with tracing enabled, the traces of googleProjectID. One of: [logfmt, json, gcp]").
+		Envar("PROMBQ_LOG_FORMAT").Default(logFormatLogfmt).EnumVar(&cfg.logFormat, logFormatLogfmt, logFormatJSON, logFormatGCP)
+	a.Flag("log.sample-limit", "Log at most this many occurrences of the same warning or error per log.sample-window, and a summary with the number of suppressed ones at the end of the window. 0 logs all occurrences.").
+		Envar("PROMBQ_LOG_SAMPLE_LIMIT").Default("10").IntVar(&cfg.logSampleLimit)
+	a.Flag("log.sample-window", "Window in which occurrences of the same warning or error are counted for log.sample-limit.").
+		Envar("PROMBQ_LOG_SAMPLE_WINDOW").Default("1m").DurationVar(&cfg.logSampleWindow)
+	a.Flag("write.keep-metrics", "Only write series matching this regex. Matches the metric name, or an arbitrary label when given as label=regex. Can be repeated.").
+		Envar("PROMBQ_WRITE_KEEP_METRICS").StringsVar(&cfg.keepMetrics)
+	a.Flag("write.drop-metrics", "Do not write series matching this regex. Matches the metric name, or an arbitrary label when given as label=regex. Can be repeated.").
+		Envar("PROMBQ_WRITE_DROP_METRICS").StringsVar(&cfg.dropMetrics)
+	a.Flag("write.drop-label", "Remove the label with this name from every written series. __name__ can't be removed. Can be repeated.").
+		Envar("PROMBQ_WRITE_DROP_LABELS").StringsVar(&cfg.writeDropLabels)
+	a.Flag("write.drop-label-regex", "Remove the labels whose names match this regex from every written series. __name__ is never removed. Can be repeated.").
+		Envar("PROMBQ_WRITE_DROP_LABEL_REGEX").StringsVar(&cfg.writeDropLabelRegex)
+	a.Flag("write.target", "Additional table samples are written to, given as name=...,project=...,dataset=...,table=...,timeout=... Only dataset and table are required. Can be repeated.").
+		Envar("PROMBQ_WRITE_TARGETS").StringsVar(&cfg.writeTargetSpecs)
+	a.Flag("write.target-policy", "Deprecated: use write.multi-target-policy. One of: [all, any]").
+		Envar("PROMBQ_WRITE_TARGET_POLICY").Default(policyAll).EnumVar(&cfg.writeTargetPolicy, policyAll, policyAny)
+	a.Flag("write.multi-target-policy", "When a write request to several tables succeeds: all tables must succeed (all), at least one (any), or the primary table, ignoring the others (primary). Responses name the failed tables in the X-Failed-Targets header. Defaults to write.target-policy. One of: [all, any, primary]").
+		Envar("PROMBQ_WRITE_MULTI_TARGET_POLICY").EnumVar(&cfg.multiTargetPolicy, policyAll, policyAny, policyPrimary)
+	a.Flag("write.route", "Write the samples of the metrics whose name matches a regex to another table of the primary project instead of the primary table, given as regex=table or regex=dataset.table. The first matching route wins. Reads query the primary table and all routed tables. Can be repeated.").
+		Envar("PROMBQ_WRITE_ROUTES").StringsVar(&cfg.writeRouteSpecs)
+	a.Flag("tenancy.enabled", "Separate the data of tenants by the X-Scope-OrgID header of write and read requests. Writes store the tenant in the __tenant__ label of every series and reads only return the series of their tenant.").
+		Envar("PROMBQ_TENANCY_ENABLED").Default("false").BoolVar(&cfg.tenancyEnabled)
+	a.Flag("tenancy.default-tenant", "Tenant of requests without the X-Scope-OrgID header. If empty, they are rejected with 401.").
+		Envar("PROMBQ_TENANCY_DEFAULT_TENANT").StringVar(&cfg.tenancyDefaultTenant)
+	a.Flag("ha.cluster-label", "Label of the series of Prometheus replicas naming their cluster. Together with ha.replica-label, only the samples of the elected replica of every cluster are written.").
+		Envar("PROMBQ_HA_CLUSTER_LABEL").StringVar(&cfg.haClusterLabel)
+	a.Flag("ha.replica-label", "Label of the series of Prometheus replicas naming the replica. It is removed from the written series.").
+		Envar("PROMBQ_HA_REPLICA_LABEL").StringVar(&cfg.haReplicaLabel)
+	a.Flag("ha.failover-timeout", "Time after the last write of the elected replica of a cluster when the next replica writing for the cluster is elected.").
+		Envar("PROMBQ_HA_FAILOVER_TIMEOUT").Default("30s").DurationVar(&cfg.haFailoverTimeout)
+	a.Flag("read.target", "Additional table samples are read from, given as name=...,project=...,dataset=...,table=...,timeout=... Only dataset and table are required. Can be repeated.").
+		Envar("PROMBQ_READ_TARGETS").StringsVar(&cfg.readTargetSpecs)
+	a.Flag("read.target-policy", "When a read request from several tables succeeds: all tables must succeed (all) or at least one, returning the results of the successful ones (any). One of: [all, any]").
+		Envar("PROMBQ_READ_TARGET_POLICY").Default(policyAll).EnumVar(&cfg.readTargetPolicy, policyAll, policyAny)
+	a.Flag("read.resolution", "Downsampled table with the schema of bq-aggregate-schema.json which serves the read queries of the primary table spanning at least min-range with a step of at least interval, given as table=...,interval=...,min-range=... The table may be given as dataset.table. Of several matching tables the one of the longest interval is read. Can be repeated.").
+		Envar("PROMBQ_READ_RESOLUTIONS").StringsVar(&cfg.readResolutionSpecs)
+	a.Flag("read.force-raw", "Serve all read queries from the table of raw samples, ignoring read.resolution.").
+		Envar("PROMBQ_READ_FORCE_RAW").Default("false").BoolVar(&cfg.readForceRaw)
+
+	return a, googleProjectIDFlagCause
+}
+
+type writer interface {
+	Write(ctx context.Context, timeseries []*prompb.TimeSeries) error
+	Name() string
+}
+
+type reader interface {
+	Read(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, error)
+	Name() string
+}
+
+// buildClients creates the clients of the primary table and of the write and read targets,
+// and checks the schemas of their tables. The noop storage takes their place if it is
+// configured.
+func buildClients(logger slog.Logger, cfg *Config) ([]writer, []reader, error) {
+	if cfg.storage == storageNoop {
+		writers, readers := noopClients(logger, cfg)
+		logger.Info("starting up...")
+		return writers, readers, nil
+	}
+	var writers []writer
+	var readers []reader
+	deadLetter, err := deadLetterOptions(cfg)
+	if err != nil {
+		logger.Error("failed to open the dead-letter location", slog.Any("error", err))
+		return nil, nil, err
+	}
+
+	opts := append(connectionOptions(cfg),
+		bigquerydb.WithMetricFactory(cfg.metricFactory),
+		bigquerydb.WithMaxRowsPerInsert(cfg.maxRowsPerInsert),
+		bigquerydb.WithMaxBytesPerInsert(int(cfg.maxBytesPerInsert)),
+		bigquerydb.WithInsertConcurrency(cfg.writeConcurrency, cfg.writeQueueSize),
+		bigquerydb.WithDeduplication(cfg.writeDeduplicate),
+		bigquerydb.WithWriteDryRun(cfg.writeDryRun),
+		bigquerydb.WithSkipInvalidRows(cfg.skipInvalidRows),
+		bigquerydb.WithIgnoreUnknownValues(cfg.ignoreUnknownValues),
+		bigquerydb.WithMaxSampleAge(cfg.writeMaxSampleAge, cfg.writeRejectOld),
+		bigquerydb.WithMaxFutureSkew(cfg.writeMaxFutureSkew, cfg.writeFutureBehavior),
+		bigquerydb.WithStaleMarkers(cfg.writeStoreStale),
+		bigquerydb.WithStaticLabels(cfg.writeStaticLabels, cfg.writeStaticOverride),
+		bigquerydb.WithDropLabels(cfg.writeDropLabels, cfg.dropLabelRegex),
+		bigquerydb.WithMaxRowSize(int(cfg.writeMaxRowSize), cfg.writeOversize, cfg.writeTruncatedLength),
+		bigquerydb.WithMaxLoggedRowErrors(cfg.maxLoggedRowErrors),
+		bigquerydb.WithRowRetries(cfg.rowRetries, cfg.rowRetryBackoff),
+		bigquerydb.WithReadLimits(readLimits(cfg)),
+		bigquerydb.WithSkipBadRows(cfg.readSkipBadRows),
+		bigquerydb.WithReadCache(cfg.readCacheTTL, cfg.readCacheMaxEntries, cfg.readCacheBucket, cfg.readCacheFreshness),
+		bigquerydb.WithStorageReadAPI(cfg.readUseStorageAPI),
+		bigquerydb.WithServerSideSort(cfg.readServerSideSort),
+		bigquerydb.WithReadDeduplication(cfg.readDeduplicate),
+		bigquerydb.WithReadTemplate(cfg.readTemplate),
+		bigquerydb.WithQueryPriority(cfg.readQueryPriority),
+		bigquerydb.WithMaxBytesBilled(int64(cfg.readMaxBytesBilled)),
+		bigquerydb.WithQueryLimiter(cfg.queryLimiter),
+		bigquerydb.WithReadSplitInterval(cfg.readSplitInterval),
+		bigquerydb.WithCircuitBreaker(cfg.breakerFailures, cfg.breakerFailureRatio, cfg.breakerWindow, cfg.breakerOpenDuration, cfg.breakerProbes),
+		bigquerydb.WithTenancy(cfg.tenancyEnabled),
+	)
+	if cfg.templateSuffix != nil {
+		opts = append(opts, bigquerydb.WithTemplateSuffix(cfg.templateSuffix))
+	}
+	if cfg.writeAsync {
+		opts = append(opts, bigquerydb.WithAsyncWrites(cfg.writeBufferSize, cfg.writeFlushInterval))
+	}
+	if cfg.coalesceMaxDelay > 0 {
+		opts = append(opts, bigquerydb.WithCoalescing(cfg.coalesceMaxRows, int(cfg.coalesceMaxBytes), cfg.coalesceMaxDelay))
+	}
+	if cfg.perMetricSamples {
+		opts = append(opts, bigquerydb.WithPerMetricSamples(cfg.perMetricSamplesLimit))
+	}
+	if cfg.writeMethod == bigquerydb.WriteMethodLoadJob {
+		storageOpts, err := storageOptions(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, bigquerydb.WithLoadJobWrites(cfg.loadJobLocation, int64(cfg.loadJobMaxBytes), cfg.loadJobInterval, storageOpts...))
+	}
+	c, err := bigquerydb.NewClient(
+		logger.With("storage", "bigquery"),
+		cfg.googleAPIjsonkeypath,
+		cfg.googleProjectID,
+		cfg.googleAPIdatasetID,
+		cfg.googleAPItableID,
+		cfg.writeTimeout,
+		append(opts,
+			bigquerydb.WithDataProject(cfg.googleAPIdataProject),
+			bigquerydb.WithReadTimeout(cfg.readTimeout),
+			bigquerydb.WithCreateTable(cfg.createTable),
+			bigquerydb.WithRoutes(cfg.writeRoutes),
+			bigquerydb.WithReadTable(cfg.readDatasetID, cfg.readTableID),
+			bigquerydb.WithReadResolutions(cfg.readResolutions, cfg.readForceRaw),
+			bigquerydb.WithSpill(cfg.spillDir, int64(cfg.spillMaxBytes), cfg.spillReplayInterval),
+			deadLetter,
+			bigquerydb.WithAggregation(cfg.aggregateTable, cfg.aggregateInterval, cfg.aggregateLateness),
+			bigquerydb.WithRetention(cfg.retention, cfg.retentionInterval, cfg.retentionEnforce),
+			leaderOption(cfg))...)
+	if err != nil {
+		logger.Error("failed to create bigquery client", slog.Any("error", err))
+		return nil, nil, errors.Wrap(err, "failed to create bigquery client")
+	}
+	if err := checkSchema(logger, cfg, c); err != nil {
+		logger.Error("table schema check failed", slog.Any("error", err))
+		_ = c.Close()
+		return nil, nil, err
+	}
+	labeled := len(cfg.writeTargets)+len(cfg.readTargets) > 0
+	registerClient(cfg.Registerer, c, labeled, cfg.writeDryRun)
+	writers = append(writers, c)
+	readers = append(readers, c)
+
+	for _, target := range cfg.writeTargets {
+		t, err := bigquerydb.NewClient(
+			logger.With("storage", "bigquery", "target", target.name),
+			cfg.googleAPIjsonkeypath,
+			target.projectID,
+			target.datasetID,
+			target.tableID,
+			target.timeout,
+			append(opts, bigquerydb.WithName(target.name), bigquerydb.WithCreateTable(cfg.createTable),
+				bigquerydb.WithSpill(cfg.spillDir, int64(cfg.spillMaxBytes), cfg.spillReplayInterval), deadLetter)...)
+		if err != nil {
+			logger.Error("failed to create bigquery client", slog.Any("target", target.name), slog.Any("error", err))
+			closeClients(writers, readers)
+			return nil, nil, errors.Wrapf(err, "failed to create bigquery client of target %s", target.name)
+		}
+		if err := checkSchema(logger, cfg, t); err != nil {
+			logger.Error("table schema check failed", slog.Any("target", target.name), slog.Any("error", err))
+			closeClients(append(writers, t), readers)
+			return nil, nil, err
+		}
+		registerClient(cfg.Registerer, t, labeled, cfg.writeDryRun)
+		writers = append(writers, t)
+	}
+	for _, target := range cfg.readTargets {
+		t, err := bigquerydb.NewClient(
+			logger.With("storage", "bigquery", "target", target.name),
+			cfg.googleAPIjsonkeypath,
+			target.projectID,
+			target.datasetID,
+			target.tableID,
+			target.timeout,
+			append(opts, bigquerydb.WithName(target.name))...)
+		if err != nil {
+			logger.Error("failed to create bigquery client", slog.Any("target", target.name), slog.Any("error", err))
+			closeClients(writers, readers)
+			return nil, nil, errors.Wrapf(err, "failed to create bigquery client of target %s", target.name)
+		}
+		if err := checkSchema(logger, cfg, t); err != nil {
+			logger.Error("table schema check failed", slog.Any("target", target.name), slog.Any("error", err))
+			closeClients(writers, append(readers, t))
+			return nil, nil, err
+		}
+		registerClient(cfg.Registerer, t, labeled, false)
+		readers = append(readers, t)
+	}
+	logger.Info("starting up...")
+	return writers, readers, nil
+}
+
+// closeClients closes the clients which were built when building the others failed, so
+// their background tasks stop. Clients which are writer and reader are closed once.
+func closeClients(writers []writer, readers []reader) {
+	closed := make(map[io.Closer]bool)
+	closeOnce := func(client interface{}) {
+		if c, ok := client.(io.Closer); ok && !closed[c] {
+			closed[c] = true
+			_ = c.Close()
+		}
+	}
+	for _, w := range writers {
+		closeOnce(w)
+	}
+	for _, r := range readers {
+		closeOnce(r)
+	}
+}
+
+// backfill runs the backfill subcommand until it completed or ctx is done.
+func backfill(ctx context.Context, logger slog.Logger, cfg *Config) error {
+	var l loader
+	if !cfg.backfillDryRun {
+		c, err := bigquerydb.NewClient(
+			logger.With("storage", "bigquery"),
+			cfg.googleAPIjsonkeypath,
+			cfg.googleProjectID,
+			cfg.googleAPIdatasetID,
+			cfg.googleAPItableID,
+			cfg.writeTimeout,
+			append(connectionOptions(cfg), bigquerydb.WithDataProject(cfg.googleAPIdataProject), bigquerydb.WithCreateTable(cfg.createTable))...)
+		if err != nil {
+			return errors.Wrap(err, "failed to create bigquery client")
+		}
+		defer c.Close()
+		if err := checkSchema(logger, cfg, c); err != nil {
+			return err
+		}
+		l = c
+	}
+	return runBackfill(ctx, logger, cfg, l)
+}
+
+// export runs the export subcommand until it completed or ctx is done.
+func export(ctx context.Context, logger slog.Logger, cfg *Config) error {
+	c, err := bigquerydb.NewClient(
+		logger.With("storage", "bigquery"),
+		cfg.googleAPIjsonkeypath,
+		cfg.googleProjectID,
+		cfg.googleAPIdatasetID,
+		cfg.googleAPItableID,
+		cfg.readTimeout,
+		append(connectionOptions(cfg),
+			bigquerydb.WithDataProject(cfg.googleAPIdataProject),
+			bigquerydb.WithQueryPriority(cfg.readQueryPriority),
+			bigquerydb.WithMaxBytesBilled(int64(cfg.readMaxBytesBilled)),
+			bigquerydb.WithReadDeduplication(cfg.readDeduplicate),
+			bigquerydb.WithReadTemplate(cfg.readTemplate),
+			bigquerydb.WithReadTable(cfg.readDatasetID, cfg.readTableID),
+			bigquerydb.WithRoutes(cfg.writeRoutes))...)
+	if err != nil {
+		return errors.Wrap(err, "failed to create bigquery client")
+	}
+	defer c.Close()
+	return runExport(ctx, logger, cfg, c)
+}
+
+// migrate runs the migrate subcommand on the table and the write targets, whose clients
+// are created without checking their schemas.
+func migrate(ctx context.Context, logger slog.Logger, cfg *Config) error {
+	tables := append([]bigqueryTarget{{projectID: cfg.googleProjectID, datasetID: cfg.googleAPIdatasetID, tableID: cfg.googleAPItableID}}, cfg.writeTargets...)
+	migrators := make([]migrator, 0, len(tables))
+	for _, table := range tables {
+		opts := append(connectionOptions(cfg), bigquerydb.WithReadTimeout(cfg.readTimeout))
+		if table.name == "" {
+			opts = append(opts, bigquerydb.WithDataProject(cfg.googleAPIdataProject))
+		} else {
+			opts = append(opts, bigquerydb.WithName(table.name))
+		}
+		c, err := bigquerydb.NewClient(logger.With("storage", "bigquery"), cfg.googleAPIjsonkeypath, table.projectID, table.datasetID, table.tableID, cfg.writeTimeout, opts...)
+		if err != nil {
+			return errors.Wrap(err, "failed to create bigquery client")
+		}
+		defer c.Close()
+		migrators = append(migrators, c)
+	}
+	return runMigrate(ctx, logger, cfg, os.Stdout, migrators)
+}
+
+// connectionOptions returns the options of how the clients connect to BigQuery and run jobs.
+func connectionOptions(cfg *Config) []bigquerydb.Option {
+	return []bigquerydb.Option{
+		bigquerydb.WithLocation(cfg.googleAPIlocation),
+		bigquerydb.WithJobLabels(cfg.jobLabels),
+		bigquerydb.WithEndpoint(cfg.bigqueryEndpoint),
+		bigquerydb.WithCredentialsJSON([]byte(cfg.googleAPIjsonkey)),
+		bigquerydb.WithKeyRotation(cfg.keyCheckInterval),
+		bigquerydb.WithImpersonation(cfg.impersonate, cfg.impersonateDelegates, cfg.impersonateScopes),
+		bigquerydb.WithTagsType(cfg.tagsType),
+		bigquerydb.WithSpecialValueColumn(cfg.specialValueColumn),
+		bigquerydb.WithSeriesHashColumn(cfg.seriesHashColumn),
+		bigquerydb.WithInsertTimeColumn(cfg.insertTimeColumn),
+		bigquerydb.WithTimestampType(cfg.timestampType),
+		bigquerydb.WithDateSharding(cfg.dateSharding),
+		bigquerydb.WithPartitioning(cfg.partitioning, cfg.partitionGranularity),
+	}
+}
+
+// checkSchema validates the schema of the table of the client, unless the check is
+// skipped, and logs every mismatch on its own line.
+func checkSchema(logger slog.Logger, cfg *Config, c *bigquerydb.BigqueryClient) error {
+	if cfg.skipSchemaCheck {
+		return nil
+	}
+	err := c.ValidateSchema(context.Background())
+	var schemaErr *bigquerydb.SchemaError
+	if errors.As(err, &schemaErr) {
+		for _, mismatch := range schemaErr.Mismatches {
+			logger.Error("table schema mismatch", slog.String("table", schemaErr.Table), slog.String("mismatch", mismatch))
+		}
+		return errors.Errorf("schema of table %s doesn't match, fix the table or start with --bigquery.skip-schema-check", schemaErr.Table)
+	}
+	return err
+}
+
+// registerClient registers the metrics of the client. With several clients, their
+// metrics are told apart by a remote label holding the name of the client. The metrics
+// of clients in write dry-run mode get a dry_run label.
+func registerClient(reg prometheus.Registerer, c *bigquerydb.BigqueryClient, labeled, dryRun bool) {
+	labels := prometheus.Labels{}
+	if labeled {
+		labels["remote"] = c.Name()
+	}
+	if dryRun {
+		labels["dry_run"] = "true"
+	}
+	if len(labels) == 0 {
+		reg.MustRegister(c)
+		return
+	}
+	prometheus.WrapRegistererWith(labels, reg).MustRegister(c)
+}
+
+// Run runs the command of the configuration until it completed or ctx is done: it serves
+// the remote storage API, or runs a backfill, an export, a migration or a replay. Serving
+// stops like Shutdown when ctx is done. Errors are logged as well as returned.
+func (a *Adapter) Run(ctx context.Context) error {
+	switch a.cfg.command {
+	case "backfill":
+		if err := backfill(ctx, *a.logger, a.cfg); err != nil {
+			a.logger.Error("backfill failed", slog.Any("error", err))
+			return err
+		}
+		return nil
+	case "export":
+		if err := export(ctx, *a.logger, a.cfg); err != nil {
+			a.logger.Error("export failed", slog.Any("error", err))
+			return err
+		}
+		return nil
+	case "migrate":
+		if err := migrate(ctx, *a.logger, a.cfg); err != nil {
+			a.logger.Error("migration failed", slog.Any("error", err))
+			return err
+		}
+		return nil
+	case "replay":
+		if err := replay(ctx, *a.logger, a.cfg); err != nil {
+			a.logger.Error("replay failed", slog.Any("error", err))
+			return err
+		}
+		return nil
+	}
+	return a.serve(ctx)
+}
+
+// newServers returns the servers of the listeners.
+func newServers(cfg *Config, listeners []listener) []*http.Server {
+	servers := make([]*http.Server, 0, len(listeners))
+	for i, l := range listeners {
+		srv := newServer(cfg)
+		if i > 0 {
+			// Only the main listener answers slow remote reads, the others keep the defaults.
+			srv = &http.Server{ReadHeaderTimeout: cfg.httpHeaderTimeout, IdleTimeout: cfg.httpIdleTimeout}
+		}
+		srv.Addr, srv.Handler = l.addr, l.mux
+		servers = append(servers, srv)
+	}
+	return servers
+}
+
+// serve serves the listeners until ctx is done, Shutdown is called or a server fails.
+func (a *Adapter) serve(ctx context.Context) error {
+	logger, cfg := a.logger, a.cfg
+	for _, l := range a.listeners {
+		ln, err := listen(l.addr, cfg.socketMode)
+		if err != nil {
+			logger.Error("failed to listen", slog.Any("listener", l.name), slog.Any("addr", l.addr), slog.Any("error", err))
+			for _, ln := range a.netListeners {
+				_ = ln.Close()
+			}
+			return errors.Wrapf(err, "failed to listen on %s", l.addr)
+		}
+		a.netListeners = append(a.netListeners, ln)
+		logger.Info("listening", slog.Any("listener", l.name), slog.Any("addr", l.addr), slog.Any("route_prefix", cfg.routePrefix+"/"), slog.Any("external_url", cfg.externalURL))
+	}
+	close(a.ready)
+
+	if cfg.elector != nil {
+		cfg.elector.Start(a.leaderLock)
+	}
+	if cfg.reloader != nil {
+		stop := cfg.reloader.reloadOnSignal()
+		defer stop()
+	}
+	failed := make(chan error, len(a.servers))
+	for i, srv := range a.servers {
+		go func(l listener, srv *http.Server, ln net.Listener) {
+			if err := srv.Serve(ln); err != http.ErrServerClosed {
+				logger.Error("failed to serve", slog.Any("listener", l.name), slog.Any("addr", l.addr), slog.Any("error", err))
+				failed <- errors.Wrapf(err, "failed to serve on %s", l.addr)
+			}
+		}(a.listeners[i], srv, a.netListeners[i])
+	}
+
+	select {
+	case <-ctx.Done():
+		logger.Warn("stopping http server...", slog.Any("cause", context.Cause(ctx)))
+		return a.Shutdown(context.Background())
+	case err := <-failed:
+		_ = a.Shutdown(context.Background())
+		return err
+	case <-a.stopped:
+		return a.shutdownErr
+	}
+}
+
+// Shutdown stops the adapter gracefully: the servers stop listening and wait for the
+// requests in flight, then the writers flush their buffered samples and are closed. Only
+// the first call shuts down, all of them return its error.
+func (a *Adapter) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		a.shutdownErr = a.shutdown(ctx)
+		close(a.stopped)
+	})
+	<-a.stopped
+	return a.shutdownErr
+}
+
+func (a *Adapter) shutdown(ctx context.Context) error {
+	// The main server is shut down first, so that the metrics of a separate listener
+	// can still be scraped while its last requests finish.
+	for i, srv := range a.servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			a.logger.Error("error while shutting down http server", slog.Any("listener", a.listeners[i].name), slog.Any("error", err))
+			return err
+		}
+	}
+	if len(a.servers) > 0 {
+		a.logger.Warn("http server shutdown, and connections closed")
+	}
+
+	for _, w := range a.writers {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				a.logger.Error("error while closing writer", slog.Any("storage", w.Name()), slog.Any("error", err))
+			}
+		}
+	}
+	// The lease is released once the tasks of the leader stopped with the writers.
+	if a.cfg.elector != nil {
+		a.cfg.elector.Stop()
+	}
+	return nil
+}
+
+// listener is an address the adapter listens on and what it serves there.
+type listener struct {
+	name string
+	addr string
+	mux  *http.ServeMux
+}
+
+// newListeners returns the main listener serving the remote storage API, followed by
+// the telemetry and admin listeners if their addresses are set. The metrics are served
+// on the telemetry listener if there is one, on the admin listener with admin metrics,
+// and on the main listener otherwise. The pprof endpoints, if enabled, are served on the
+// admin listener if there is one. The default mux, which importing net/http/pprof
+// registers the endpoints on, isn't served.
+func newListeners(logger slog.Logger, cfg *Config, writers []writer, readers []reader) []listener {
+	primary := listener{name: "main", addr: cfg.listenAddr, mux: http.NewServeMux()}
+	registerHandlers(primary.mux, logger, cfg, writers, readers)
+	listeners := []listener{primary}
+
+	metrics, admin := primary.mux, primary.mux
+	if cfg.telemetryListenAddr != "" {
+		telemetry := listener{name: "telemetry", addr: cfg.telemetryListenAddr, mux: http.NewServeMux()}
+		listeners = append(listeners, telemetry)
+		metrics = telemetry.mux
+	}
+	if cfg.adminListenAddr != "" {
+		adminListener := listener{name: "admin", addr: cfg.adminListenAddr, mux: http.NewServeMux()}
+		listeners = append(listeners, adminListener)
+		admin = adminListener.mux
+		if cfg.adminMetrics {
+			metrics = admin
+		}
+	}
+	metrics.Handle(cfg.telemetryPath, promhttp.InstrumentMetricHandler(cfg.Registerer, promhttp.HandlerFor(cfg.Gatherer, promhttp.HandlerOpts{})))
+	if cfg.enablePprof {
+		registerPprof(admin)
+	}
+	if cfg.reloader != nil {
+		admin.Handle("/-/reload", reloadHandler(cfg.reloader))
+	}
+	if cfg.enableConfig {
+		admin.Handle("/api/v1/config", configHandler(logger, cfg))
+	}
+	for i := range listeners {
+		listeners[i].mux = withRoutePrefix(cfg.routePrefix, listeners[i].mux)
+	}
+	return listeners
+}
+
+// registerPprof adds the pprof endpoints to the mux, like importing net/http/pprof does
+// for the default mux.
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// registerHandlers adds the handlers of the remote storage API to the mux.
+func registerHandlers(mux *http.ServeMux, logger slog.Logger, cfg *Config, writers []writer, readers []reader) {
+	handle := func(path, name string, handler http.Handler) {
+		mux.Handle(path, accessLog(logger, cfg, name, instrumentHandler(cfg.metrics, name, handler)))
+	}
+
+	write := otelhttp.NewHandler(writeHandler(logger, cfg, writers), "write")
+	handle(cfg.writePath, "write", write)
+	if cfg.legacyPaths && cfg.writePath != defaultWritePath {
+		handle(defaultWritePath, "write", write)
+	}
+
+	read := otelhttp.NewHandler(readHandler(logger, cfg, readers), "read")
+	handle(cfg.readPath, "read", read)
+	if cfg.legacyPaths && cfg.readPath != defaultReadPath {
+		handle(defaultReadPath, "read", read)
+	}
+
+	handle("/version", "version", versionHandler(logger))
+
+	handle("/api/v1/status", "status", statusHandler(logger, cfg, writers, readers))
+
+	if cfg.enableDebugRead {
+		handle("/api/v1/read_debug", "read_debug", otelhttp.NewHandler(readDebugHandler(logger, cfg, readers), "read_debug"))
+	}
+
+	if cfg.enableMetadataAPI {
+		handle("/api/v1/label/", "label_values", otelhttp.NewHandler(labelValuesHandler(logger, cfg, readers), "label_values"))
+		handle("/api/v1/series", "series", otelhttp.NewHandler(seriesHandler(logger, cfg, readers), "series"))
+	}
+
+	if cfg.otlpEnabled {
+		handle("/otlp/v1/metrics", "otlp", otelhttp.NewHandler(otlpHandler(logger, cfg, writers), "otlp"))
+	}
+}
+
+// writeTimeoutMargin is added to the BigQuery timeout for the default http write timeout,
+// leaving time to encode and send the response of a read which took the whole timeout.
+const writeTimeoutMargin = 15 * time.Second
+
+// newServer creates the http server with the configured timeouts.
+func newServer(cfg *Config) *http.Server {
+	return &http.Server{
+		Addr:              cfg.listenAddr,
+		ReadTimeout:       cfg.httpReadTimeout,
+		ReadHeaderTimeout: cfg.httpHeaderTimeout,
+		WriteTimeout:      cfg.httpWriteTimeout,
+		IdleTimeout:       cfg.httpIdleTimeout,
+	}
+}
+
+// resolveTimeouts defaults the write and read timeouts to the deprecated send-timeout.
+func resolveTimeouts(cfg *Config) {
+	if cfg.writeTimeout <= 0 {
+		cfg.writeTimeout = cfg.remoteTimeout
+	}
+	if cfg.readTimeout <= 0 {
+		cfg.readTimeout = cfg.remoteTimeout
+	}
+}
+
+// maxRemoteTimeout returns the largest timeout of the BigQuery requests of all clients.
+func maxRemoteTimeout(cfg *Config) time.Duration {
+	timeout := max(cfg.writeTimeout, cfg.readTimeout)
+	for _, targets := range [][]bigqueryTarget{cfg.writeTargets, cfg.readTargets} {
+		for _, target := range targets {
+			timeout = max(timeout, target.timeout)
+		}
+	}
+	return timeout
+}
+
+// instrumentHandler counts the requests of the handler by status code and method,
+// and tracks their duration and the number of requests in flight.
+func instrumentHandler(m *metrics, name string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerInFlight(m.httpRequestsInFlight.With(labels),
+		promhttp.InstrumentHandlerDuration(m.httpRequestDuration.MustCurryWith(labels),
+			promhttp.InstrumentHandlerCounter(m.httpRequests.MustCurryWith(labels), handler)))
+}
+
+// writeHandler decodes remote write requests and sends the samples to all writers.
+func writeHandler(logger slog.Logger, cfg *Config, writers []writer) http.HandlerFunc {
+	limiters := &limiterCache{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.DebugContext(r.Context(), "write request received", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+		cfg := cfg.current()
+		limiter := limiters.get(cfg)
+
+		reply := errorReply(r, cfg)
+		ctx, tenant, ok := requestTenant(w, r, cfg, "write", reply)
+		if !ok {
+			return
+		}
+		begin := time.Now()
+		if limiter != nil && !limiter.bySamples && !allowWrite(cfg.metrics, w, reply, limiter, "write", 1, begin) {
+			return
+		}
+		reqBuf, releaseBody, status, err := decodeRequestBody(w, r, cfg.metrics, "write", int64(cfg.maxRequestSize))
+		if err != nil {
+			logger.ErrorContext(ctx, "decode error", slog.Any("error", err.Error()))
+			reply(w, err, status)
+			countRejectedBody(cfg.metrics, "write", status)
+			cfg.metrics.writeErrors.Inc()
+			cfg.state.recordError("write", err, time.Now())
+			return
+		}
+
+		// Unmarshalling copies all strings, the body isn't referenced by the request.
+		req, releaseReq, err := decodeWriteRequest(reqBuf)
+		releaseBody()
+		if err != nil {
+			logger.ErrorContext(ctx, "unmarshal error", slog.Any("error", err.Error()))
+			reply(w, err, http.StatusBadRequest)
+			cfg.metrics.writeErrors.Inc()
+			cfg.state.recordError("write", err, time.Now())
+			return
+		}
+		defer releaseReq()
+		writeTimeseries(ctx, w, reply, logger, cfg, writers, limiter, "write", tenant, req.Timeseries, begin)
+	}
+}
+
+// errNoStorage answers requests when no storage is configured for them.
+var errNoStorage = errors.New("no storage configured")
+
+// writeTimeseries validates, deduplicates and filters the decoded timeseries of a write
+// request of the api and sends them to all writers. It answers the request if the series
+// aren't written or writing them failed, and returns whether they were written.
+func writeTimeseries(ctx context.Context, w http.ResponseWriter, reply replyFunc, logger slog.Logger, cfg *Config, writers []writer, limiter *writeLimiter,
+	api, tenant string, timeseries []*prompb.TimeSeries, begin time.Time) bool {
+	samples := countSamples(timeseries)
+	cfg.metrics.receivedSamples.Add(float64(samples))
+	cfg.metrics.writeRequestSeries.WithLabelValues(api).Observe(float64(len(timeseries)))
+	cfg.metrics.writeRequestSamples.WithLabelValues(api).Observe(float64(samples))
+	recordSamples(ctx, samples)
+
+	timeseries, err := validateWriteRequest(cfg.metrics, timeseries, cfg.writeStrict, cfg.writeAllowUTF8Names)
+	if err != nil {
+		logger.ErrorContext(ctx, "invalid series", slog.Any("error", err.Error()))
+		reply(w, err, http.StatusBadRequest)
+		cfg.metrics.rejectedRequests.WithLabelValues(api, "invalid_series").Inc()
+		cfg.metrics.writeErrors.Inc()
+		cfg.state.recordError("write", err, time.Now())
+		return false
+	}
+	timeseries, err = limitSeries(ctx, logger, cfg, timeseries)
+	if err != nil {
+		logger.WarnContext(ctx, "write request over the series limit", slog.Any("error", err.Error()))
+		reply(w, err, http.StatusBadRequest)
+		cfg.metrics.rejectedRequests.WithLabelValues(api, "too_many_series").Inc()
+		cfg.metrics.writeErrors.Inc()
+		cfg.state.recordError("write", err, time.Now())
+		return false
+	}
+
+	if ok, cluster := cfg.haTracker.apply(cfg.metrics, tenant, timeseries, begin); !ok {
+		cfg.metrics.haDroppedSamples.WithLabelValues(tenant, cluster).Add(float64(countSamples(timeseries)))
+		// Like Cortex, answer with 202 so that the replica doesn't retry the request.
+		w.WriteHeader(http.StatusAccepted)
+		return false
+	}
+
+	timeseries, dropped := cfg.seriesFilter.apply(timeseries)
+	if dropped > 0 {
+		cfg.metrics.droppedSeries.WithLabelValues("relabel").Add(float64(dropped))
+	}
+	if limiter != nil && limiter.bySamples && !allowWrite(cfg.metrics, w, reply, limiter, api, countSamples(timeseries), begin) {
+		return false
+	}
+
+	if len(writers) == 0 {
+		reply(w, errNoStorage, http.StatusInternalServerError)
+		cfg.metrics.writeErrors.Inc()
+		cfg.state.recordError("write", errNoStorage, time.Now())
+		return false
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(writers))
+	for i, w := range writers {
+		wg.Add(1)
+		go func(i int, rw writer) {
+			errs[i] = sendSamples(ctx, logger, cfg.metrics, rw, tenant, timeseries)
+			// Failed writes are observed as well, to see the latency during incidents.
+			cfg.metrics.writeProcessingDuration.WithLabelValues(rw.Name(), tenant).Observe(time.Since(begin).Seconds())
+			wg.Done()
+		}(i, w)
+	}
+	wg.Wait()
+	duration := time.Since(begin).Seconds()
+
+	status, err := writeStatus(errs, cfg.writeTargetPolicy)
+	cfg.metrics.writeResponses.WithLabelValues(writeStatusClass(status)).Inc()
+	if len(writers) > 1 {
+		succeeded, failed := writeOutcome(writers, errs)
+		level := slog.LevelDebug
+		if len(failed) > 0 {
+			level = slog.LevelWarn
+			// Even successful responses name the failed targets, for debugging.
+			w.Header().Set(failedTargetsHeader, strings.Join(failed, ","))
+			if err != nil {
+				err = &targetsError{err: err, failed: failed}
+			}
+		}
+		logger.Log(ctx, level, "write request fanned out", slog.String("api", api), slog.String("policy", cfg.writeTargetPolicy),
+			slog.Any("succeeded", succeeded), slog.Any("failed", failed), slog.Int("status", status))
+	}
+	if err != nil {
+		if status == http.StatusTooManyRequests {
+			setRetryAfter(w, cfg.quotaBackoff.next())
+		} else {
+			setErrorRetryAfter(w, err)
+		}
+		reply(w, err, status)
+		cfg.state.recordError("write", err, time.Now())
+		return false
+	}
+	cfg.quotaBackoff.reset()
+	cfg.state.recordWrite(time.Now())
+
+	logger.DebugContext(ctx, "write request completed", slog.String("api", api), slog.Any("duration", duration))
+	return true
+}
+
+// readHandler decodes remote read requests, runs them on all readers and merges the results.
+func readHandler(logger slog.Logger, cfg *Config, readers []reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.DebugContext(r.Context(), "read request receieved", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+		reply := errorReply(r, cfg)
+		ctx, tenant, ok := requestTenant(w, r, cfg, "read", reply)
+		if !ok {
+			return
+		}
+		begin := time.Now()
+		if err := checkReadContentType(r); err != nil {
+			reply(w, err, http.StatusUnsupportedMediaType)
+			countRejectedBody(cfg.metrics, "read", http.StatusUnsupportedMediaType)
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", err, time.Now())
+			return
+		}
+		reqBuf, releaseBody, status, err := decodeRequestBody(w, r, cfg.metrics, "read", int64(cfg.maxRequestSize))
+		if err != nil {
+			logger.ErrorContext(ctx, "decode error", slog.Any("error", err.Error()))
+			reply(w, err, status)
+			countRejectedBody(cfg.metrics, "read", status)
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", err, time.Now())
+			return
+		}
+
+		var req prompb.ReadRequest
+		err = proto.Unmarshal(reqBuf, &req)
+		var accepted []uint64
+		if err == nil {
+			accepted, err = acceptedResponseTypes(reqBuf)
+		}
+		releaseBody()
+		if err != nil {
+			logger.ErrorContext(ctx, "unmarshal error", slog.Any("error", err.Error()))
+			reply(w, err, http.StatusBadRequest)
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", err, time.Now())
+			return
+		}
+		responseType, err := negotiateResponseType(r, accepted)
+		if err != nil {
+			reply(w, err, http.StatusNotAcceptable)
+			cfg.metrics.rejectedRequests.WithLabelValues("read", "not_acceptable").Inc()
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", err, time.Now())
+			return
+		}
+
+		if len(readers) == 0 {
+			reply(w, errNoStorage, http.StatusInternalServerError)
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", errNoStorage, time.Now())
+			return
+		}
+		var wg sync.WaitGroup
+		resps := make([]*prompb.ReadResponse, len(readers))
+		errs := make([]error, len(readers))
+		for i, rd := range readers {
+			wg.Add(1)
+			go func(i int, rd reader) {
+				resps[i], errs[i] = rd.Read(ctx, &req)
+				wg.Done()
+			}(i, rd)
+		}
+		wg.Wait()
+
+		failed := 0
+		for i, err := range errs {
+			if err != nil {
+				logger.WarnContext(ctx, "error executing query", slog.Any("query", req), slog.Any("storage", readers[i].Name()), slog.Any("error", err))
+				failed++
+			}
+		}
+		if failed > 0 {
+			if cfg.readTargetPolicy != policyAny || failed == len(readers) {
+				status, err := errorStatus(errs)
+				setErrorRetryAfter(w, err)
+				reply(w, err, status)
+				cfg.metrics.readErrors.Inc()
+				cfg.state.recordError("read", err, time.Now())
+				return
+			}
+			logger.WarnContext(ctx, "returning partial read result", slog.Any("failed_readers", failed), slog.Any("readers", len(readers)))
+			cfg.metrics.partialReads.Inc()
+		}
+		resp := mergeReadResponses(resps)
+
+		if responseType == responseTypeStreamedXORChunks {
+			// Once the first frame was written, errors can't change the status anymore.
+			size, err := streamReadResponse(w, resp)
+			cfg.metrics.readResponseBytes.Observe(float64(size))
+			if err != nil {
+				logger.WarnContext(ctx, "error streaming response", slog.Any("error", err))
+				cfg.metrics.readErrors.Inc()
+				cfg.state.recordError("read", err, time.Now())
+				return
+			}
+			cfg.state.recordRead(time.Now())
+			duration := observeReadDuration(cfg.metrics, readers, errs, tenant, begin)
+			logger.DebugContext(ctx, "streamed read request completed", slog.Any("duration", duration))
+			return
+		}
+
+		// The response mirrors the encoding of the request, which was validated when decoding it.
+		encoding, _ := requestEncoding(r)
+		compressed, release, err := encodeReadResponse(resp, encoding)
+		if err != nil {
+			reply(w, err, http.StatusInternalServerError)
+			cfg.metrics.readErrors.Inc()
+			cfg.state.recordError("read", err, time.Now())
+			return
+		}
+		defer release()
+
+		w.Header().Set("Content-Type", readContentType)
+		if encoding != encodingIdentity {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+
+		cfg.metrics.readResponseBytes.Observe(float64(len(compressed)))
+		if _, err := w.Write(compressed); err != nil {
+			logger.WarnContext(ctx, "error writing response", slog.Any("error", err))
+			cfg.metrics.readErrors.Inc()
+		}
+		cfg.state.recordRead(time.Now())
+		duration := observeReadDuration(cfg.metrics, readers, errs, tenant, begin)
+		logger.DebugContext(ctx, "read request completed", slog.Any("duration", duration))
+	}
+}
+
+// observeReadDuration observes the duration of a served read request for every reader
+// whose response was part of the result, and returns it.
+func observeReadDuration(m *metrics, readers []reader, errs []error, tenant string, begin time.Time) float64 {
+	duration := time.Since(begin).Seconds()
+	for i, rd := range readers {
+		if errs[i] == nil {
+			m.readProcessingDuration.WithLabelValues(rd.Name(), tenant).Observe(duration)
+		}
+	}
+	return duration
+}
+
+// allowWrite checks the write rate limit for a request of the api of n requests or
+// samples. If the request is rejected, it answers it with 429 and when to retry, or with
+// 413 if the request can never fit into the burst.
+func allowWrite(m *metrics, w http.ResponseWriter, reply replyFunc, limiter *writeLimiter, api string, n int, now time.Time) bool {
+	delay, ok := limiter.reserve(n, now)
+	if !ok {
+		reply(w, errors.Errorf("write request of %d samples exceeds the rate limit burst of %d", n, limiter.limiter.Burst()), http.StatusRequestEntityTooLarge)
+		m.rejectedRequests.WithLabelValues(api, "too_large").Inc()
+		return false
+	}
+	if delay > 0 {
+		setRetryAfter(w, delay)
+		reply(w, errors.New("write rate limit exceeded"), http.StatusTooManyRequests)
+		m.rejectedRequests.WithLabelValues(api, "rate_limited").Inc()
+		return false
+	}
+	return true
+}
+
+// setErrorRetryAfter tells the client when to retry a request rejected by an open circuit
+// breaker or because its queries waited too long for a slot.
+func setErrorRetryAfter(w http.ResponseWriter, err error) {
+	var openErr *bigquerydb.CircuitOpenError
+	if errors.As(err, &openErr) {
+		setRetryAfter(w, openErr.RetryAfter)
+	}
+	var queueErr *bigquerydb.QueryQueueTimeoutError
+	if errors.As(err, &queueErr) {
+		setRetryAfter(w, queueErr.RetryAfter)
+	}
+}
+
+// requestBuffers holds the buffers request bodies are read and decompressed into, so that
+// every request doesn't allocate two request sized buffers.
+var requestBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// writeRequests holds decoded write requests, so that the slice of their timeseries is reused.
+var writeRequests = sync.Pool{New: func() interface{} { return new(prompb.WriteRequest) }}
+
+// decodeRequestBody reads and decompresses the snappy, zstd or uncompressed body of the
+// request into pooled buffers. Bodies larger than maxSize, compressed or decompressed, are
+// rejected. A maxSize of 0 disables the limit. The sizes of decoded bodies are observed in
+// the metrics of the api. On failure it returns the status code to answer the request
+// with. The returned release function must be called once the data is no longer used.
+func decodeRequestBody(w http.ResponseWriter, r *http.Request, m *metrics, api string, maxSize int64) ([]byte, func(), int, error) {
+	encoding, err := requestEncoding(r)
+	if err != nil {
+		return nil, nil, http.StatusUnsupportedMediaType, err
+	}
+	return decodeBody(w, r, m, api, encoding, maxSize)
+}
+
+// decodeBody reads and decompresses the body of the request with the given encoding like
+// decodeRequestBody.
+func decodeBody(w http.ResponseWriter, r *http.Request, m *metrics, api, encoding string, maxSize int64) ([]byte, func(), int, error) {
+	compressed := requestBuffers.Get().(*[]byte)
+	decoded := requestBuffers.Get().(*[]byte)
+	release := func() {
+		requestBuffers.Put(compressed)
+		requestBuffers.Put(decoded)
+	}
+
+	body := r.Body
+	if maxSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	buf := bytes.NewBuffer((*compressed)[:0])
+	if r.ContentLength > 0 && (maxSize <= 0 || r.ContentLength <= maxSize) {
+		buf.Grow(int(r.ContentLength))
+	}
+	_, err := buf.ReadFrom(body)
+	*compressed = buf.Bytes()
+	if err != nil {
+		release()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds the limit of %d bytes", maxSize)
+		}
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	reqBuf, err := decompress(encoding, *decoded, *compressed, maxSize)
+	if err != nil {
+		release()
+		var sizeErr *decodedSizeError
+		if errors.As(err, &sizeErr) {
+			return nil, nil, http.StatusRequestEntityTooLarge, err
+		}
+		return nil, nil, http.StatusBadRequest, err
+	}
+	if encoding != encodingIdentity {
+		// Keep the possibly grown buffer for the next request.
+		*decoded = reqBuf
+	}
+	recordBody(r, len(*compressed), len(reqBuf))
+	m.requestBytes.WithLabelValues(api).Observe(float64(len(*compressed)))
+	m.requestDecodedBytes.WithLabelValues(api).Observe(float64(len(reqBuf)))
+	return reqBuf, release, http.StatusOK, nil
+}
+
+// countRejectedBody counts requests rejected because of their body by the status code
+// decodeRequestBody answered them with.
+func countRejectedBody(m *metrics, api string, status int) {
+	switch status {
+	case http.StatusRequestEntityTooLarge:
+		m.rejectedRequests.WithLabelValues(api, "too_large").Inc()
+	case http.StatusUnsupportedMediaType:
+		m.rejectedRequests.WithLabelValues(api, "unsupported_encoding").Inc()
+	}
+}
+
+// decodeWriteRequest unmarshals a write request into a pooled request. The returned
+// release function must be called once the request and its timeseries are no longer used.
+func decodeWriteRequest(data []byte) (*prompb.WriteRequest, func(), error) {
+	req := writeRequests.Get().(*prompb.WriteRequest)
+	release := func() {
+		clear(req.Timeseries)
+		req.Timeseries = req.Timeseries[:0]
+		writeRequests.Put(req)
+	}
+	// Unmarshal appends to the timeseries, unlike proto.Unmarshal it doesn't reset them first.
+	if err := req.Unmarshal(data); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return req, release, nil
+}
+
+// responseBuffers holds the buffers used to encode read responses, so that a read
+// doesn't allocate two response sized buffers every time.
+var responseBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// encodeReadResponse marshals and compresses the response with the given encoding into
+// pooled buffers. The returned release function must be called once the data is no longer used.
+func encodeReadResponse(resp *prompb.ReadResponse, encoding string) ([]byte, func(), error) {
+	data := responseBuffers.Get().(*[]byte)
+	compressed := responseBuffers.Get().(*[]byte)
+	release := func() {
+		responseBuffers.Put(data)
+		responseBuffers.Put(compressed)
+	}
+
+	size := resp.Size()
+	if cap(*data) < size {
+		*data = make([]byte, size)
+	}
+	n, err := resp.MarshalTo((*data)[:size])
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	encoded := compress(encoding, *compressed, (*data)[:n])
+	if encoding != encodingIdentity {
+		*compressed = encoded
+	}
+	return encoded, release, nil
+}
+
+func sendSamples(ctx context.Context, logger slog.Logger, m *metrics, w writer, tenant string, timeseries []*prompb.TimeSeries) error {
+	begin := time.Now()
+	err := w.Write(ctx, timeseries)
+	duration := time.Since(begin).Seconds()
+	numSamples := countSamples(timeseries)
+	if err != nil {
+		failed := numSamples
+		var writeErr *bigquerydb.WriteError
+		if errors.As(err, &writeErr) {
+			failed = writeErr.FailedSamples
+		}
+		logger.WarnContext(ctx, "error sending samples to remote storage", slog.Any("error", err), slog.Any("storage", w.Name()), slog.Any("num_samples", numSamples), slog.Any("failed_samples", failed))
+		m.failedSamples.WithLabelValues(w.Name(), tenant).Add(float64(failed))
+		m.sentSamples.WithLabelValues(w.Name(), tenant).Add(float64(numSamples - failed))
+		m.writeErrors.Inc()
+	} else {
+		logger.DebugContext(ctx, "sent samples", slog.Any("num_samples", numSamples))
+		m.sentSamples.WithLabelValues(w.Name(), tenant).Add(float64(numSamples))
+		m.sentBatchDuration.WithLabelValues(w.Name(), tenant).Observe(duration)
+	}
+	return err
+}
+
+func countSamples(timeseries []*prompb.TimeSeries) int {
+	n := 0
+	for _, ts := range timeseries {
+		n += len(ts.Samples)
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTestAdapter runs an adapter with a mock writer and reader, listening on a random
+// port with a registry of its own. It returns the adapter, the URL it serves, and the
+// channel Run returns on.
+func startTestAdapter(t *testing.T, ctx context.Context, listenAddr string) (*Adapter, string, <-chan error) {
+	cfg, err := LoadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table",
+		"--web.listen-address=" + listenAddr})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.Logger = promslog.NewNopLogger()
+	cfg.Registerer = prometheus.NewRegistry()
+	a := newAdapter(cfg)
+	a.setClients([]writer{&mockWriter{name: "bigquerydb"}}, []reader{&mockReader{name: "bigquerydb", resp: readResponse()}})
+
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+	select {
+	case <-a.ready:
+	case err := <-done:
+		t.Fatalf("the adapter failed to start: %v", err)
+	}
+	return a, "http://" + a.netListeners[0].Addr().String(), done
+}
+
+func scrape(t *testing.T, url string) string {
+	resp, err := http.Get(url + "/metrics")
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestAdaptersInOneProcess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, firstURL, firstDone := startTestAdapter(t, ctx, "127.0.0.1:0")
+	second, secondURL, secondDone := startTestAdapter(t, context.Background(), "127.0.0.1:0")
+	assert.NotEqual(t, firstURL, secondURL)
+
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+	for _, url := range []string{firstURL, firstURL, secondURL} {
+		resp, err := http.Post(url+"/write", "application/x-protobuf", writeRequestBody(t, seriesWithSamples("up", "api", sample)))
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}
+	assert.Contains(t, scrape(t, firstURL), "storage_bigquery_received_samples_total 2\n")
+	assert.Contains(t, scrape(t, secondURL), "storage_bigquery_received_samples_total 1\n", "every adapter has metrics of its own")
+
+	// The first adapter stops with its context, the second one with Shutdown.
+	cancel()
+	assert.NoError(t, <-firstDone)
+	_, err := http.Get(firstURL + "/metrics")
+	assert.Error(t, err, "the stopped adapter doesn't listen anymore")
+	assert.Contains(t, scrape(t, secondURL), "storage_bigquery_received_samples_total 1\n", "the other adapter keeps serving")
+
+	assert.NoError(t, second.Shutdown(context.Background()))
+	assert.NoError(t, <-secondDone)
+	assert.NoError(t, second.Shutdown(context.Background()), "shutting down again is harmless")
+	assert.NoError(t, first.Shutdown(context.Background()))
+}
+
+func TestAdapterListenError(t *testing.T) {
+	first, url, _ := startTestAdapter(t, context.Background(), "127.0.0.1:0")
+	defer first.Shutdown(context.Background()) //nolint:errcheck
+
+	cfg, err := LoadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table",
+		"--web.listen-address=" + url[len("http://"):]})
+	assert.NoError(t, err)
+	cfg.Logger = promslog.NewNopLogger()
+	cfg.Registerer = prometheus.NewRegistry()
+	a := newAdapter(cfg)
+	a.setClients([]writer{&mockWriter{name: "bigquerydb"}}, nil)
+	assert.ErrorContains(t, a.Run(context.Background()), "failed to listen on "+url[len("http://"):])
+}
+
+// closingClient counts how often it was closed.
+type closingClient struct {
+	mockWriter
+	closed int
+}
+
+func (c *closingClient) Read(context.Context, *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	return readResponse(), nil
+}
+
+func (c *closingClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestCloseClients(t *testing.T) {
+	primary, writeTarget, readTarget := &closingClient{}, &closingClient{}, &closingClient{}
+	closeClients([]writer{primary, writeTarget, &mockWriter{}}, []reader{primary, readTarget, &mockReader{}})
+	assert.Equal(t, 1, primary.closed, "a client which is writer and reader is closed once")
+	assert.Equal(t, 1, writeTarget.closed)
+	assert.Equal(t, 1, readTarget.closed)
+}
@@ -0,0 +1,113 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/assert"
+)
+
+// getStatus returns the status code of a GET request of the path served by the mux.
+func getStatus(mux *http.ServeMux, path string) int {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+// testListeners returns the muxes of the listeners configured by the flags by name.
+func testListeners(t *testing.T, args ...string) map[string]*http.ServeMux {
+	cfg, err := parseTestFlags(args...)
+	assert.NoError(t, err)
+	muxes := map[string]*http.ServeMux{}
+	for _, l := range newListeners(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}}, []reader{&mockReader{name: "bigquerydb"}}) {
+		muxes[l.name] = l.mux
+	}
+	return muxes
+}
+
+func TestPprofDisabledByDefault(t *testing.T) {
+	muxes := testListeners(t)
+	assert.Len(t, muxes, 1)
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["main"], "/debug/pprof/"))
+	assert.Equal(t, http.StatusOK, getStatus(muxes["main"], "/metrics"))
+}
+
+func TestPprofOnMainListener(t *testing.T) {
+	muxes := testListeners(t, "--web.enable-pprof")
+	assert.Len(t, muxes, 1)
+	assert.Equal(t, http.StatusOK, getStatus(muxes["main"], "/debug/pprof/"))
+	assert.Equal(t, http.StatusOK, getStatus(muxes["main"], "/debug/pprof/cmdline"))
+}
+
+func TestAdminListener(t *testing.T) {
+	muxes := testListeners(t, "--web.enable-pprof", "--web.admin-listen-address=localhost:9202")
+	if !assert.Contains(t, muxes, "admin") {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["main"], "/debug/pprof/"))
+	assert.Equal(t, http.StatusOK, getStatus(muxes["admin"], "/debug/pprof/"))
+	assert.Equal(t, http.StatusOK, getStatus(muxes["main"], "/metrics"), "the metrics stay on the main listener")
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["admin"], "/metrics"))
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["admin"], "/version"), "the API is only served on the main listener")
+}
+
+func TestAdminMetrics(t *testing.T) {
+	muxes := testListeners(t, "--web.admin-listen-address=localhost:9202", "--web.admin-metrics")
+	if !assert.Contains(t, muxes, "admin") {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["main"], "/metrics"))
+	assert.Equal(t, http.StatusOK, getStatus(muxes["admin"], "/metrics"))
+	assert.Equal(t, http.StatusNotFound, getStatus(muxes["admin"], "/debug/pprof/"), "pprof isn't enabled")
+}
+
+func TestTelemetryListener(t *testing.T) {
+	muxes := testListeners(t, "--web.telemetry-listen-address=:9203")
+	if !assert.Contains(t, muxes, "telemetry") {
+		return
+	}
+	primary := httptest.NewServer(muxes["main"])
+	defer primary.Close()
+	telemetry := httptest.NewServer(muxes["telemetry"])
+	defer telemetry.Close()
+
+	for _, testCase := range []struct {
+		server   *httptest.Server
+		method   string
+		path     string
+		expected int
+	}{
+		{primary, http.MethodGet, "/metrics", http.StatusNotFound},
+		{primary, http.MethodGet, "/version", http.StatusOK},
+		{primary, http.MethodPost, "/write", http.StatusBadRequest},
+		{telemetry, http.MethodGet, "/metrics", http.StatusOK},
+		{telemetry, http.MethodGet, "/version", http.StatusNotFound},
+		{telemetry, http.MethodPost, "/write", http.StatusNotFound},
+		{telemetry, http.MethodPost, "/read", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(testCase.method, testCase.server.URL+testCase.path, nil)
+		assert.NoError(t, err)
+		resp, err := testCase.server.Client().Do(req)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, testCase.expected, resp.StatusCode, testCase.path)
+		}
+	}
+}
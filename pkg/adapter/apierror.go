@@ -0,0 +1,130 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+)
+
+// Error types of JSON error responses, like in the error envelope of the Prometheus API.
+const (
+	errorTypeBadData     = "bad_data"
+	errorTypeUnavailable = "unavailable"
+	errorTypeInternal    = "internal"
+)
+
+// apiError is the JSON body of a failed request.
+type apiError struct {
+	Status    string            `json:"status"`
+	ErrorType string            `json:"errorType"`
+	Error     string            `json:"error"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// replyFunc answers a failed request with the error and the status code.
+type replyFunc func(w http.ResponseWriter, err error, status int)
+
+// plainError answers a failed request with the bare error message, like http.Error.
+func plainError(w http.ResponseWriter, err error, status int) {
+	http.Error(w, err.Error(), status)
+}
+
+// errorReply returns how failed /write and /read requests are answered: with a JSON body
+// if the client accepts JSON or JSON errors are enabled, with the plain message otherwise.
+// The generated SQL of failed queries is only part of the details with debug reads enabled.
+func errorReply(r *http.Request, cfg *Config) replyFunc {
+	if !cfg.jsonErrors && !acceptsJSON(r) {
+		return plainError
+	}
+	return jsonError(cfg)
+}
+
+// jsonError returns how failed requests are answered with the JSON error envelope of the
+// Prometheus API.
+func jsonError(cfg *Config) replyFunc {
+	return func(w http.ResponseWriter, err error, status int) {
+		body, marshalErr := json.Marshal(apiError{
+			Status:    "error",
+			ErrorType: errorType(status),
+			Error:     err.Error(),
+			Details:   errorDetails(err, cfg.enableDebugRead),
+		})
+		if marshalErr != nil {
+			plainError(w, err, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		_, _ = w.Write(append(body, '\n'))
+	}
+}
+
+// acceptsJSON reports whether the Accept header of the request names application/json.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errorType returns the error type of a response status. Retrying requests which failed
+// with bad_data doesn't help.
+func errorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return errorTypeUnavailable
+	case status >= http.StatusInternalServerError:
+		return errorTypeInternal
+	}
+	return errorTypeBadData
+}
+
+// errorDetails returns what is known about the failure beyond the message: the matchers
+// and, with debug, the generated SQL of a failed query, the exceeded read limit, the
+// number of samples which weren't written and the targets they weren't written to.
+func errorDetails(err error, debug bool) map[string]string {
+	details := map[string]string{}
+	var queryErr *bigquerydb.QueryError
+	if errors.As(err, &queryErr) {
+		details["query"] = queryErr.Matchers
+		if debug && queryErr.SQL != "" {
+			details["sql"] = queryErr.SQL
+		}
+	}
+	if limit, ok := bigquerydb.ExceededLimit(err); ok {
+		details["limit"] = limit
+	}
+	var writeErr *bigquerydb.WriteError
+	if errors.As(err, &writeErr) {
+		details["failedSamples"] = strconv.Itoa(writeErr.FailedSamples)
+	}
+	var targetsErr *targetsError
+	if errors.As(err, &targetsErr) {
+		details["failedTargets"] = strings.Join(targetsErr.failed, ",")
+	}
+	return details
+}
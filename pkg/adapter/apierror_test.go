@@ -0,0 +1,162 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// failedQuery returns the error of a read query which failed with err.
+func failedQuery(err error) error {
+	return &bigquerydb.QueryError{Matchers: `{__name__="up"}`, SQL: "SELECT metricname FROM `dataset.table`", Err: err}
+}
+
+func decodeAPIError(t *testing.T, rec *httptest.ResponseRecorder) apiError {
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body apiError
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "error", body.Status)
+	return body
+}
+
+func TestReadHandlerJSONErrors(t *testing.T) {
+	testCases := map[string]struct {
+		err       error
+		status    int
+		errorType string
+	}{
+		"bad_data":    {err: failedQuery(errors.Wrap(bigquerydb.ErrBadRequest, "unknown match type 7")), status: http.StatusBadRequest, errorType: errorTypeBadData},
+		"limit":       {err: failedQuery(errors.Wrap(bigquerydb.ErrLimitExceeded, "too many rows")), status: http.StatusUnprocessableEntity, errorType: errorTypeBadData},
+		"unavailable": {err: failedQuery(bigquerydb.ErrCircuitOpen), status: http.StatusServiceUnavailable, errorType: errorTypeUnavailable},
+		"internal":    {err: failedQuery(errors.New("boom")), status: http.StatusInternalServerError, errorType: errorTypeInternal},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{&mockReader{name: "bigquerydb", err: testCase.err}})
+			req := httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t))
+			req.Header.Set("Accept", "text/plain;q=0.5, application/json")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			assert.Equal(t, testCase.status, rec.Code)
+			body := decodeAPIError(t, rec)
+			assert.Equal(t, testCase.errorType, body.ErrorType)
+			assert.Equal(t, testCase.err.Error(), body.Error)
+			assert.Equal(t, map[string]string{"query": `{__name__="up"}`}, body.Details, "the SQL is only included with debug reads")
+		})
+	}
+}
+
+func TestReadHandlerJSONErrorsDebug(t *testing.T) {
+	cfg := testConfig(&Config{readTargetPolicy: policyAll, jsonErrors: true, enableDebugRead: true})
+	handler := readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", err: failedQuery(errors.New("boom"))}})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "SELECT metricname FROM `dataset.table`", decodeAPIError(t, rec).Details["sql"])
+}
+
+func TestReadHandlerPlainErrors(t *testing.T) {
+	handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll, enableDebugRead: true}), []reader{&mockReader{name: "bigquerydb", err: failedQuery(errors.New("boom"))}})
+	req := httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t))
+	req.Header.Set("Accept", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "boom\n", rec.Body.String())
+}
+
+func TestWriteHandlerJSONErrors(t *testing.T) {
+	series := seriesWithSamples("up", "node", prompb.Sample{Timestamp: 1000, Value: 1})
+	testCases := map[string]struct {
+		err       error
+		status    int
+		errorType string
+		details   map[string]string
+	}{
+		"too_old":     {err: &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{bigquerydb.ErrSampleTooOld}}, status: http.StatusBadRequest, errorType: errorTypeBadData, details: map[string]string{"failedSamples": "1"}},
+		"quota":       {err: quotaError("quotaExceeded"), status: http.StatusTooManyRequests, errorType: errorTypeUnavailable, details: map[string]string{"failedSamples": "1"}},
+		"too_large":   {err: &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{bigquerydb.ErrBatchTooLarge}}, status: http.StatusRequestEntityTooLarge, errorType: errorTypeBadData, details: map[string]string{"failedSamples": "1"}},
+		"unavailable": {err: bigquerydb.ErrBufferFull, status: http.StatusServiceUnavailable, errorType: errorTypeUnavailable},
+		"internal":    {err: errors.New("boom"), status: http.StatusInternalServerError, errorType: errorTypeInternal},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig(&Config{writeTargetPolicy: policyAll, jsonErrors: true})
+			handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb", err: testCase.err}})
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series)))
+
+			assert.Equal(t, testCase.status, rec.Code)
+			body := decodeAPIError(t, rec)
+			assert.Equal(t, testCase.errorType, body.ErrorType)
+			assert.Equal(t, testCase.err.Error(), body.Error)
+			assert.Equal(t, testCase.details, body.Details)
+		})
+	}
+}
+
+func TestWriteHandlerJSONDecodeError(t *testing.T) {
+	handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll}), []writer{&mockWriter{name: "bigquerydb"}})
+	req := httptest.NewRequest(http.MethodPost, "/write", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errorTypeBadData, decodeAPIError(t, rec).ErrorType)
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"application/json":                  true,
+		"application/json; charset=utf-8":   true,
+		"text/plain, application/json;q=.9": true,
+		"application/x-protobuf":            false,
+		"*/*":                               false,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/read", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		assert.Equal(t, expected, acceptsJSON(req), accept)
+	}
+}
+
+func TestJSONErrorsFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.jsonErrors)
+
+	cfg, err = parseTestFlags("--web.json-errors")
+	assert.NoError(t, err)
+	assert.True(t, cfg.jsonErrors)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// backfillStateFile is the default name of the file in the backfill directory which
+// records the files loaded so far.
+const backfillStateFile = ".backfill-state"
+
+// loader loads samples into a table with load jobs. It is implemented by *bigquerydb.BigqueryClient.
+type loader interface {
+	Load(ctx context.Context, timeseries []*prompb.TimeSeries) (int, error)
+}
+
+// runBackfill loads every file of the backfill directory with a load job of its own and
+// records it in the state file, so that an interrupted backfill continues with the first
+// file not loaded yet. In dry-run mode the files are only parsed and l may be nil.
+func runBackfill(ctx context.Context, logger slog.Logger, cfg *Config, l loader) error {
+	stateFile := cfg.backfillStateFile
+	if stateFile == "" {
+		stateFile = filepath.Join(cfg.backfillDir, backfillStateFile)
+	}
+	files, err := backfillFiles(cfg.backfillDir, stateFile)
+	if err != nil {
+		return err
+	}
+	loaded, err := readBackfillState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	var state *os.File
+	if !cfg.backfillDryRun {
+		state, err = os.OpenFile(stateFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "failed to open the backfill state file")
+		}
+		defer state.Close()
+	}
+
+	begin := time.Now()
+	totalRows, skipped := 0, 0
+	for i, name := range files {
+		progress := fmt.Sprintf("%d/%d", i+1, len(files))
+		if loaded[name] {
+			logger.Info("skipping file loaded before", slog.String("file", name), slog.String("progress", progress))
+			skipped++
+			continue
+		}
+
+		fileBegin := time.Now()
+		timeseries, err := parseExpositionFile(filepath.Join(cfg.backfillDir, name))
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", name)
+		}
+		if cfg.backfillDryRun {
+			rows := bigquerydb.CountRows(timeseries)
+			logger.Info("file parsed", slog.String("file", name), slog.String("progress", progress), slog.Int("samples", len(timeseries)), slog.Int("rows", rows))
+			totalRows += rows
+			continue
+		}
+
+		rows, err := l.Load(ctx, timeseries)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load %s", name)
+		}
+		if _, err := fmt.Fprintln(state, name); err != nil {
+			return errors.Wrap(err, "failed to record the loaded file")
+		}
+		if err := state.Sync(); err != nil {
+			return errors.Wrap(err, "failed to record the loaded file")
+		}
+		logger.Info("file loaded", slog.String("file", name), slog.String("progress", progress), slog.Int("rows", rows), slog.Duration("duration", time.Since(fileBegin)))
+		totalRows += rows
+	}
+
+	logger.Info("backfill completed", slog.Bool("dry_run", cfg.backfillDryRun), slog.Int("files", len(files)), slog.Int("skipped_files", skipped),
+		slog.Int("rows", totalRows), slog.Duration("duration", time.Since(begin)))
+	return nil
+}
+
+// backfillFiles returns the names of the regular files in dir sorted by name, without
+// hidden files and the state file.
+func backfillFiles(dir, stateFile string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	statePath, err := filepath.Abs(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if path, err := filepath.Abs(filepath.Join(dir, entry.Name())); err == nil && path == statePath {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+	return files, nil
+}
+
+// readBackfillState returns the files recorded as loaded in the state file. A missing
+// state file means that no file was loaded yet.
+func readBackfillState(stateFile string) (map[string]bool, error) {
+	f, err := os.Open(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the backfill state file")
+	}
+	defer f.Close()
+
+	loaded := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if name := scanner.Text(); name != "" {
+			loaded[name] = true
+		}
+	}
+	return loaded, errors.Wrap(scanner.Err(), "failed to read the backfill state file")
+}
+
+// parseExpositionFile parses a file in the Prometheus text exposition format.
+func parseExpositionFile(path string) ([]*prompb.TimeSeries, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseExposition(f)
+}
+
+// parseExposition turns every sample of the Prometheus text exposition format into a
+// timeseries of its own. Every sample needs a timestamp. The text parser merges the
+// lines of a histogram or summary with the same labels regardless of their timestamps,
+// so their series have to be given without a TYPE line, which reads them as untyped.
+func parseExposition(r io.Reader) ([]*prompb.TimeSeries, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var timeseries []*prompb.TimeSeries
+	for _, name := range names {
+		mf := families[name]
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				return nil, fmt.Errorf("%s is a %s, only counters, gauges and untyped series can be backfilled, remove its TYPE line to read its series as untyped",
+					name, strings.ToLower(mf.GetType().String()))
+			}
+			if m.TimestampMs == nil {
+				return nil, fmt.Errorf("sample of %s has no timestamp", name)
+			}
+
+			labels := make([]*prompb.Label, 0, len(m.GetLabel())+1)
+			labels = append(labels, &prompb.Label{Name: model.MetricNameLabel, Value: name})
+			for _, lp := range m.GetLabel() {
+				labels = append(labels, &prompb.Label{Name: lp.GetName(), Value: lp.GetValue()})
+			}
+			timeseries = append(timeseries, &prompb.TimeSeries{
+				Labels:  labels,
+				Samples: []prompb.Sample{{Value: value, Timestamp: m.GetTimestampMs()}},
+			})
+		}
+	}
+	return timeseries, nil
+}
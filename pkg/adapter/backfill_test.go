@@ -0,0 +1,158 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+const backfillFixture = `# HELP http_requests_total Total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{job="api",code="200"} 10 1700000000000
+http_requests_total{job="api",code="200"} 25 1700000015000
+# TYPE temperature gauge
+temperature{room="lab"} 21.5 1700000000000
+temperature{room="lab"} NaN 1700000015000
+request_duration_seconds_bucket{le="+Inf"} 3 1700000000000
+`
+
+// mockLoader records the series of every load and fails loading the files with err
+// once failAfter loads succeeded.
+type mockLoader struct {
+	loads     [][]*prompb.TimeSeries
+	failAfter int
+	err       error
+}
+
+func (l *mockLoader) Load(_ context.Context, timeseries []*prompb.TimeSeries) (int, error) {
+	if l.err != nil && len(l.loads) >= l.failAfter {
+		return 0, l.err
+	}
+	l.loads = append(l.loads, timeseries)
+	return len(timeseries), nil
+}
+
+func writeBackfillFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	return dir
+}
+
+func TestParseExposition(t *testing.T) {
+	timeseries, err := parseExposition(strings.NewReader(backfillFixture))
+	assert.NoError(t, err)
+	assert.Len(t, timeseries, 5)
+
+	assert.Equal(t, &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}, {Name: "code", Value: "200"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000015000, Value: 25}},
+	}, timeseries[1])
+	assert.Equal(t, &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: "request_duration_seconds_bucket"}, {Name: "le", Value: "+Inf"}},
+		Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: 3}},
+	}, timeseries[2])
+	assert.True(t, math.IsNaN(timeseries[4].Samples[0].Value))
+}
+
+func TestParseExpositionErrors(t *testing.T) {
+	testCases := map[string]struct {
+		content string
+		err     string
+	}{
+		"no_timestamp": {content: "up 1\n", err: "sample of up has no timestamp"},
+		"histogram":    {content: "# TYPE latency histogram\nlatency_bucket{le=\"1\"} 1 1000\n", err: "latency is a histogram"},
+		"invalid":      {content: "up{job=} 1 1000\n", err: "text format parsing error"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseExposition(strings.NewReader(testCase.content))
+			assert.ErrorContains(t, err, testCase.err)
+		})
+	}
+}
+
+func TestRunBackfill(t *testing.T) {
+	dir := writeBackfillFiles(t, map[string]string{
+		"1.prom":  "up 1 1000\n",
+		"2.prom":  "up 1 2000\nup 0 3000\n",
+		"3.prom":  "up 1 4000\n",
+		".hidden": "not an exposition file",
+	})
+	cfg := testConfig(&Config{backfillDir: dir})
+
+	// The backfill stops at the first file which fails to load.
+	l := &mockLoader{failAfter: 1, err: errors.New("load job failed")}
+	err := runBackfill(context.Background(), *promslog.NewNopLogger(), cfg, l)
+	assert.ErrorContains(t, err, "failed to load 2.prom")
+	assert.Len(t, l.loads, 1)
+
+	// Running it again continues with the file which failed.
+	l = &mockLoader{}
+	assert.NoError(t, runBackfill(context.Background(), *promslog.NewNopLogger(), cfg, l))
+	assert.Len(t, l.loads, 2)
+	assert.Len(t, l.loads[0], 2)
+
+	state, err := os.ReadFile(filepath.Join(dir, backfillStateFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.prom\n2.prom\n3.prom\n", string(state))
+
+	l = &mockLoader{}
+	assert.NoError(t, runBackfill(context.Background(), *promslog.NewNopLogger(), cfg, l))
+	assert.Empty(t, l.loads, "all files were loaded before")
+}
+
+func TestRunBackfillDryRun(t *testing.T) {
+	dir := writeBackfillFiles(t, map[string]string{"metrics.prom": backfillFixture})
+	stateFile := filepath.Join(t.TempDir(), "state")
+	cfg := testConfig(&Config{backfillDir: dir, backfillStateFile: stateFile, backfillDryRun: true})
+
+	assert.NoError(t, runBackfill(context.Background(), *promslog.NewNopLogger(), cfg, nil))
+	_, err := os.Stat(stateFile)
+	assert.ErrorIs(t, err, os.ErrNotExist, "a dry run doesn't record files")
+
+	cfg.backfillDir = writeBackfillFiles(t, map[string]string{"broken.prom": "up 1\n"})
+	assert.ErrorContains(t, runBackfill(context.Background(), *promslog.NewNopLogger(), cfg, nil), "failed to parse broken.prom")
+}
+
+func TestBackfillFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, "serve", cfg.command)
+
+	dir := t.TempDir()
+	cfg, err = parseTestFlags("backfill", dir, "--dry-run", "--state-file=/tmp/state")
+	assert.NoError(t, err)
+	assert.Equal(t, "backfill", cfg.command)
+	assert.Equal(t, dir, cfg.backfillDir)
+	assert.Equal(t, "/tmp/state", cfg.backfillStateFile)
+	assert.True(t, cfg.backfillDryRun)
+
+	_, err = parseTestFlags("backfill", filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
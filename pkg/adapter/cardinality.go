@@ -0,0 +1,131 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// What happens to write requests with more series than write.max-series-per-request.
+const (
+	seriesLimitReject = "reject"
+	seriesLimitTrim   = "trim"
+)
+
+// Reasons of series dropped by the cardinality limits, as counted in
+// storage_bigquery_dropped_series_total.
+const (
+	droppedSeriesLimit         = "series_limit"
+	droppedTooManyLabels       = "too_many_labels"
+	droppedLabelValueTooLong   = "label_value_too_long"
+	exampleSeriesMaxValueBytes = 64
+)
+
+// seriesLimitError rejects a write request with more series than allowed.
+type seriesLimitError struct {
+	series int
+	limit  int
+}
+
+func (e *seriesLimitError) Error() string {
+	return fmt.Sprintf("write request has %d series, more than the limit of %d", e.series, e.limit)
+}
+
+// limitSeries applies the cardinality limits of the configuration to the validated series
+// of a write request. A request over write.max-series-per-request is rejected, or trimmed
+// to the limit with write.max-series-behavior=trim. Series with more labels than
+// write.max-labels-per-series or a label value longer than write.max-label-value-length
+// are dropped, and one of them is logged per request as example.
+func limitSeries(ctx context.Context, logger slog.Logger, cfg *Config, timeseries []*prompb.TimeSeries) ([]*prompb.TimeSeries, error) {
+	if cfg.writeMaxSeries > 0 && len(timeseries) > cfg.writeMaxSeries {
+		if cfg.writeMaxSeriesBehavior != seriesLimitTrim {
+			return nil, &seriesLimitError{series: len(timeseries), limit: cfg.writeMaxSeries}
+		}
+		trimmed := len(timeseries) - cfg.writeMaxSeries
+		cfg.metrics.droppedSeries.WithLabelValues(droppedSeriesLimit).Add(float64(trimmed))
+		logger.WarnContext(ctx, "trimmed write request over the series limit", slog.Int("series", len(timeseries)), slog.Int("limit", cfg.writeMaxSeries))
+		clear(timeseries[cfg.writeMaxSeries:])
+		timeseries = timeseries[:cfg.writeMaxSeries]
+	}
+	if cfg.writeMaxLabels <= 0 && cfg.writeMaxLabelValueLength <= 0 {
+		return timeseries, nil
+	}
+
+	kept := timeseries[:0]
+	var example *prompb.TimeSeries
+	var exampleReason string
+	dropped := 0
+	for _, ts := range timeseries {
+		reason := seriesOverLimits(ts, cfg.writeMaxLabels, cfg.writeMaxLabelValueLength)
+		if reason == "" {
+			kept = append(kept, ts)
+			continue
+		}
+		cfg.metrics.droppedSeries.WithLabelValues(reason).Inc()
+		if example == nil {
+			example, exampleReason = ts, reason
+		}
+		dropped++
+	}
+	if example != nil {
+		logger.WarnContext(ctx, "dropped series over the label limits", slog.Int("series", dropped),
+			slog.String("reason", exampleReason), slog.String("example", exampleSeries(example)))
+	}
+	clear(timeseries[len(kept):])
+	return kept, nil
+}
+
+// seriesOverLimits returns the reason the series exceeds the label limits, or an empty
+// string. The metric name counts as label.
+func seriesOverLimits(ts *prompb.TimeSeries, maxLabels, maxValueLength int) string {
+	if maxLabels > 0 && len(ts.Labels) > maxLabels {
+		return droppedTooManyLabels
+	}
+	if maxValueLength > 0 {
+		for _, l := range ts.Labels {
+			if len(l.Value) > maxValueLength {
+				return droppedLabelValueTooLong
+			}
+		}
+	}
+	return ""
+}
+
+// exampleSeries formats the series for logging, with the label values shortened so that
+// the huge values the limits are about don't flood the log.
+func exampleSeries(ts *prompb.TimeSeries) string {
+	var b strings.Builder
+	var name string
+	for _, l := range ts.Labels {
+		if l.Name == model.MetricNameLabel {
+			name = l.Value
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		value := l.Value
+		if len(value) > exampleSeriesMaxValueBytes {
+			value = value[:exampleSeriesMaxValueBytes] + "..."
+		}
+		fmt.Fprintf(&b, "%s=%q", l.Name, value)
+	}
+	return fmt.Sprintf("%s{%s}", name, b.String())
+}
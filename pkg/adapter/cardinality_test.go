@@ -0,0 +1,129 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestSeries returns n series of the metric up with distinct jobs.
+func requestSeries(n int) []*prompb.TimeSeries {
+	timeseries := make([]*prompb.TimeSeries, n)
+	for i := range timeseries {
+		timeseries[i] = seriesWithSamples("up", fmt.Sprintf("job-%d", i), prompb.Sample{Timestamp: 1000, Value: 1})
+	}
+	return timeseries
+}
+
+func TestLimitSeriesCount(t *testing.T) {
+	cfg := testConfig(&Config{writeMaxSeries: 3, writeMaxSeriesBehavior: seriesLimitReject})
+	timeseries, err := limitSeries(context.Background(), *promslog.NewNopLogger(), cfg, requestSeries(3))
+	assert.NoError(t, err)
+	assert.Len(t, timeseries, 3, "requests at the limit are written")
+
+	_, err = limitSeries(context.Background(), *promslog.NewNopLogger(), cfg, requestSeries(4))
+	assert.EqualError(t, err, "write request has 4 series, more than the limit of 3")
+
+	cfg.writeMaxSeriesBehavior = seriesLimitTrim
+	timeseries, err = limitSeries(context.Background(), *promslog.NewNopLogger(), cfg, requestSeries(5))
+	assert.NoError(t, err)
+	assert.Equal(t, requestSeries(3), timeseries, "the first series are kept")
+	assert.Equal(t, 2.0, counterValue(cfg.metrics.droppedSeries.WithLabelValues(droppedSeriesLimit)))
+
+	cfg.writeMaxSeries = 0
+	timeseries, err = limitSeries(context.Background(), *promslog.NewNopLogger(), cfg, requestSeries(5))
+	assert.NoError(t, err)
+	assert.Len(t, timeseries, 5, "0 disables the limit")
+}
+
+func TestLimitSeriesLabels(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	cfg := testConfig(&Config{writeMaxLabels: 3, writeMaxLabelValueLength: 8})
+
+	atLimits := testSeries("up", "job", "12345678", "instance", "a")
+	tooManyLabels := testSeries("up", "job", "api", "instance", "a", "pod", "b")
+	tooLong := testSeries("up", "job", "123456789")
+	timeseries, err := limitSeries(context.Background(), *logger, cfg, []*prompb.TimeSeries{tooManyLabels, atLimits, tooLong})
+	assert.NoError(t, err)
+	assert.Equal(t, []*prompb.TimeSeries{atLimits}, timeseries, "series at the limits are kept")
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.droppedSeries.WithLabelValues(droppedTooManyLabels)))
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.droppedSeries.WithLabelValues(droppedLabelValueTooLong)))
+	assert.Equal(t, 1, strings.Count(logs.String(), "dropped series over the label limits"), "one line per request")
+	assert.Contains(t, logs.String(), `series=2 reason=too_many_labels example="up{job=\"api\",instance=\"a\",pod=\"b\"}"`)
+
+	cfg.writeMaxLabels, cfg.writeMaxLabelValueLength = 0, 0
+	timeseries, err = limitSeries(context.Background(), *logger, cfg, []*prompb.TimeSeries{tooManyLabels, tooLong})
+	assert.NoError(t, err)
+	assert.Len(t, timeseries, 2, "0 disables the limits")
+}
+
+func TestExampleSeries(t *testing.T) {
+	ts := testSeries("up", "annotation", strings.Repeat("a", 100), "job", "api")
+	assert.Equal(t, `up{annotation="`+strings.Repeat("a", 64)+`...",job="api"}`, exampleSeries(ts))
+}
+
+func TestWriteHandlerCardinalityLimits(t *testing.T) {
+	w := &mockWriter{name: "bigquerydb"}
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, writeMaxSeries: 2, writeMaxSeriesBehavior: seriesLimitReject, writeMaxLabels: 3})
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, requestSeries(3)...)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "more than the limit of 2")
+	assert.Zero(t, w.series, "nothing is written of a rejected request")
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "too_many_series")))
+
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+	wide := testSeries("up", "job", "api", "instance", "a", "pod", "b")
+	wide.Samples = []prompb.Sample{sample}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, wide, seriesWithSamples("up", "web", sample))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, w.series, "the valid series of the request are written")
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.droppedSeries.WithLabelValues(droppedTooManyLabels)))
+}
+
+func TestCardinalityFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 100000, cfg.writeMaxSeries)
+	assert.Equal(t, seriesLimitReject, cfg.writeMaxSeriesBehavior)
+	assert.Equal(t, 128, cfg.writeMaxLabels)
+	assert.Equal(t, 4096, cfg.writeMaxLabelValueLength)
+
+	cfg, err = parseTestFlags("--write.max-series-per-request=500", "--write.max-series-behavior=trim", "--write.max-labels-per-series=0")
+	assert.NoError(t, err)
+	assert.Equal(t, 500, cfg.writeMaxSeries)
+	assert.Equal(t, seriesLimitTrim, cfg.writeMaxSeriesBehavior)
+	assert.Zero(t, cfg.writeMaxLabels)
+
+	_, _, err = loadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table", "--write.max-label-value-length=-1"})
+	assert.ErrorContains(t, err, "must not be negative")
+	_, err = parseTestFlags("--write.max-series-behavior=drop")
+	assert.Error(t, err)
+}
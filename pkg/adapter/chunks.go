@@ -0,0 +1,149 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// samplesPerChunk is the number of samples the Prometheus TSDB cuts its chunks at.
+const samplesPerChunk = 120
+
+// bitWriter appends single bits and groups of bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	stream []byte
+	// free is the number of unused bits of the last byte.
+	free uint8
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.stream = append(w.stream, 0)
+		w.free = 8
+	}
+	if bit {
+		w.stream[len(w.stream)-1] |= 1 << (w.free - 1)
+	}
+	w.free--
+}
+
+func (w *bitWriter) writeByte(b byte) {
+	if w.free == 0 {
+		w.stream = append(w.stream, b)
+		return
+	}
+	w.stream[len(w.stream)-1] |= b >> (8 - w.free)
+	w.stream = append(w.stream, b<<w.free)
+}
+
+// writeBits writes the nbits least significant bits of u.
+func (w *bitWriter) writeBits(u uint64, nbits int) {
+	u <<= 64 - uint(nbits)
+	for ; nbits >= 8; nbits -= 8 {
+		w.writeByte(byte(u >> 56))
+		u <<= 8
+	}
+	for ; nbits > 0; nbits-- {
+		w.writeBit(u>>63 == 1)
+		u <<= 1
+	}
+}
+
+// appendXORChunk appends the samples encoded as an XOR chunk of the Prometheus TSDB to
+// dst. The chunk starts with the number of samples, followed by the first timestamp and
+// value, and then for every sample the delta of the delta of its timestamp and the XOR of
+// its value with the previous one, both with a variable number of bits. The samples must
+// be sorted by timestamp, and a chunk holds at most 65535 of them.
+func appendXORChunk(dst []byte, samples []prompb.Sample) []byte {
+	w := bitWriter{stream: binary.BigEndian.AppendUint16(dst, uint16(len(samples)))}
+	var tDelta uint64
+	leading, trailing := uint8(0xff), uint8(0)
+	var buf [binary.MaxVarintLen64]byte
+	for i, s := range samples {
+		switch i {
+		case 0:
+			for _, b := range buf[:binary.PutVarint(buf[:], s.Timestamp)] {
+				w.writeByte(b)
+			}
+			w.writeBits(math.Float64bits(s.Value), 64)
+			continue
+		case 1:
+			tDelta = uint64(s.Timestamp - samples[0].Timestamp)
+			for _, b := range buf[:binary.PutUvarint(buf[:], tDelta)] {
+				w.writeByte(b)
+			}
+		default:
+			delta := uint64(s.Timestamp - samples[i-1].Timestamp)
+			dod := int64(delta - tDelta)
+			tDelta = delta
+			switch {
+			case dod == 0:
+				w.writeBit(false)
+			case bitRange(dod, 14):
+				w.writeBits(0b10, 2)
+				w.writeBits(uint64(dod), 14)
+			case bitRange(dod, 17):
+				w.writeBits(0b110, 3)
+				w.writeBits(uint64(dod), 17)
+			case bitRange(dod, 20):
+				w.writeBits(0b1110, 4)
+				w.writeBits(uint64(dod), 20)
+			default:
+				w.writeBits(0b1111, 4)
+				w.writeBits(uint64(dod), 64)
+			}
+		}
+		writeXORValue(&w, s.Value, samples[i-1].Value, &leading, &trailing)
+	}
+	return w.stream
+}
+
+// bitRange returns whether x fits into nbits bits the way XOR chunks encode it.
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// writeXORValue writes the XOR of the value with the previous one. Only the bits between
+// the leading and trailing zeros are written, reusing the previous window if they fit into it.
+func writeXORValue(w *bitWriter, value, previous float64, leading, trailing *uint8) {
+	delta := math.Float64bits(value) ^ math.Float64bits(previous)
+	if delta == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	newLeading := uint8(bits.LeadingZeros64(delta))
+	newTrailing := uint8(bits.TrailingZeros64(delta))
+	// The number of leading zeros is written with 5 bits.
+	if newLeading >= 32 {
+		newLeading = 31
+	}
+	if *leading != 0xff && newLeading >= *leading && newTrailing >= *trailing {
+		w.writeBit(false)
+		w.writeBits(delta>>*trailing, 64-int(*leading)-int(*trailing))
+		return
+	}
+	*leading, *trailing = newLeading, newTrailing
+	w.writeBit(true)
+	w.writeBits(uint64(newLeading), 5)
+	// 64 significant bits overflow the 6 bits to 0, which is read back as 64.
+	sigbits := 64 - newLeading - newTrailing
+	w.writeBits(uint64(sigbits), 6)
+	w.writeBits(delta>>newTrailing, int(sigbits))
+}
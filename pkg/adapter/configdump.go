@@ -0,0 +1,205 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of the values of flags in the configuration dump.
+const (
+	sourceFlag    = "flag"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceDefault = "default"
+)
+
+// redactedValue replaces the values of secret flags in the configuration dump.
+const redactedValue = "<redacted>"
+
+// secretFlags are the flags whose values are never shown. Passwords of URLs are masked
+// in the values of all flags.
+var secretFlags = map[string]bool{
+	"googleAPIjsonkey-content": true,
+}
+
+// configValue is the value of a flag in the configuration dump, a string or, for flags
+// which can be repeated, a list or a map of strings.
+type configValue struct {
+	Value  interface{} `json:"value" yaml:"value"`
+	Source string      `json:"source" yaml:"source"`
+}
+
+// configResponse is the answer of the config endpoint.
+type configResponse struct {
+	Flags map[string]configValue `json:"flags" yaml:"flags"`
+}
+
+// effectiveConfig returns the redacted values of the parsed flags of the application
+// by name, with the source each one came from: the command line, a file of an argument
+// starting with @, an environment variable or the default.
+func effectiveConfig(a *kingpin.Application, args []string) map[string]configValue {
+	model := a.Model()
+	names := make(map[string]bool, len(model.Flags))
+	for _, flag := range model.Flags {
+		names[flag.Name] = true
+	}
+	sources := argumentSources(args, names)
+
+	values := make(map[string]configValue, len(model.Flags))
+	for _, flag := range model.Flags {
+		source, ok := sources[flag.Name]
+		switch {
+		case ok:
+		case flag.Envar != "" && os.Getenv(flag.Envar) != "":
+			source = sourceEnv
+		default:
+			source = sourceDefault
+		}
+		values[flag.Name] = configValue{Value: redactFlag(flag), Source: source}
+	}
+	return values
+}
+
+// argumentSources returns the source of every flag set by the arguments, which is a file
+// for the arguments read from files. Repeatable flags given more than once keep the source
+// of the last one.
+func argumentSources(args []string, names map[string]bool) map[string]string {
+	sources := map[string]string{}
+	var scan func(args []string, source string)
+	scan = func(args []string, source string) {
+		for _, arg := range args {
+			if arg == "--" {
+				return
+			}
+			if file, ok := strings.CutPrefix(arg, "@"); ok {
+				// Unreadable files already failed the parsing of the configuration.
+				if expanded, err := kingpin.ExpandArgsFromFile(file); err == nil {
+					scan(expanded, sourceFile)
+				}
+				continue
+			}
+			name, ok := strings.CutPrefix(arg, "--")
+			if !ok {
+				continue
+			}
+			name, _, _ = strings.Cut(name, "=")
+			if negated, ok := strings.CutPrefix(name, "no-"); ok && !names[name] {
+				name = negated
+			}
+			sources[name] = source
+		}
+	}
+	scan(args, sourceFlag)
+	return sources
+}
+
+// redactFlag returns the value of the flag as shown by the configuration dump.
+func redactFlag(flag *kingpin.FlagModel) interface{} {
+	if secretFlags[flag.Name] {
+		if flag.Value.String() == "" {
+			return ""
+		}
+		return redactedValue
+	}
+	if getter, ok := flag.Value.(kingpin.Getter); ok {
+		switch v := reflect.Indirect(reflect.ValueOf(getter.Get())); v.Kind() {
+		case reflect.Slice:
+			values := make([]string, 0, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, redactURL(fmt.Sprint(v.Index(i).Interface())))
+			}
+			return values
+		case reflect.Map:
+			values := make(map[string]string, v.Len())
+			for iter := v.MapRange(); iter.Next(); {
+				values[fmt.Sprint(iter.Key().Interface())] = redactURL(fmt.Sprint(iter.Value().Interface()))
+			}
+			return values
+		}
+	}
+	return redactURL(flag.Value.String())
+}
+
+// redactURL masks the password of the value if it is a URL with one.
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
+
+// logEffectiveConfig logs the redacted values of all flags and their sources.
+func logEffectiveConfig(logger *slog.Logger, cfg *Config) {
+	names := make([]string, 0, len(cfg.effective))
+	for name := range cfg.effective {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attrs := make([]any, 0, len(names))
+	for _, name := range names {
+		value := cfg.effective[name]
+		attrs = append(attrs, slog.Group(name, slog.Any("value", value.Value), slog.String("source", value.Source)))
+	}
+	logger.Info("configuration settings", attrs...)
+}
+
+// configHandler answers with the redacted values of all flags of the configuration the
+// requests are handled with and their sources, as JSON or, with format=yaml, as YAML.
+func configHandler(logger slog.Logger, cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := configResponse{Flags: cfg.current().effective}
+		var err error
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			err = enc.Encode(resp)
+		case "yaml":
+			w.Header().Set("Content-Type", "application/yaml")
+			err = yaml.NewEncoder(w).Encode(resp)
+		default:
+			http.Error(w, fmt.Sprintf("unknown format %q, expected json or yaml", format), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Warn("error writing response", slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// deadLetterOptions returns the option of the dead-letter sink of the clients writing
+// to BigQuery, opening the dead-letter location if one is configured.
+func deadLetterOptions(cfg *Config) (bigquerydb.Option, error) {
+	if cfg.deadLetterTable != "" {
+		datasetID, tableID, ok := strings.Cut(cfg.deadLetterTable, ".")
+		if !ok {
+			datasetID, tableID = "", cfg.deadLetterTable
+		}
+		return bigquerydb.WithDeadLetterTable(datasetID, tableID, int64(cfg.deadLetterMaxBytes)), nil
+	}
+	if cfg.deadLetter == "" {
+		return bigquerydb.WithDeadLetter(nil, 0), nil
+	}
+	opts, err := storageOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := bigquerydb.OpenDeadLetters(context.Background(), cfg.deadLetter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return bigquerydb.WithDeadLetter(sink, int64(cfg.deadLetterMaxBytes)), nil
+}
+
+// storageOptions returns the options of how the dead-letter files and the objects staged
+// for load jobs are accessed in Cloud Storage: with the credentials of BigQuery,
+// impersonating its service account if one is configured.
+func storageOptions(cfg *Config) ([]option.ClientOption, error) {
+	var opts []option.ClientOption
+	switch {
+	case cfg.googleAPIjsonkey != "":
+		opts = append(opts, option.WithCredentialsJSON([]byte(cfg.googleAPIjsonkey)))
+	case cfg.googleAPIjsonkeypath != "":
+		key, err := os.ReadFile(cfg.googleAPIjsonkeypath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the service account key")
+		}
+		opts = append(opts, option.WithCredentialsJSON(key))
+	}
+	if cfg.impersonate != "" {
+		//nolint:staticcheck // the impersonate package replacing it isn't a dependency yet.
+		opts = append(opts, option.ImpersonateCredentials(cfg.impersonate, cfg.impersonateDelegates...))
+	}
+	return opts, nil
+}
+
+// deadLetterFiles lists, reads and removes dead-letter files. It is implemented by
+// *bigquerydb.DeadLetters.
+type deadLetterFiles interface {
+	Files(ctx context.Context) ([]string, error)
+	Read(ctx context.Context, name string) ([]bigquerydb.DeadLetterRecord, error)
+	Remove(ctx context.Context, name string) error
+}
+
+// replay runs the replay subcommand until all files were replayed or ctx is done. The
+// samples are written synchronously by the clients of serve, without spilling or
+// dead-lettering them again.
+func replay(ctx context.Context, logger slog.Logger, cfg *Config) error {
+	opts, err := storageOptions(cfg)
+	if err != nil {
+		return err
+	}
+	files, err := bigquerydb.OpenDeadLetters(ctx, cfg.replayLocation, opts...)
+	if err != nil {
+		return err
+	}
+	cfg.storage = storageBigQuery
+	cfg.writeAsync = false
+	cfg.coalesceMaxDelay = 0
+	cfg.spillDir = ""
+	cfg.deadLetter = ""
+	cfg.deadLetterTable = ""
+	cfg.readTargets = nil
+	writers, _, err := buildClients(logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, w := range writers {
+			if c, ok := w.(io.Closer); ok {
+				_ = c.Close()
+			}
+		}
+	}()
+	return runReplay(ctx, logger, cfg, files, writers)
+}
+
+// runReplay writes the samples of every file, oldest first, with the writer of the client
+// which gave them up, and deletes the file afterwards with replay --delete. It stops at
+// the first file which fails, so replaying again continues with it.
+func runReplay(ctx context.Context, logger slog.Logger, cfg *Config, files deadLetterFiles, writers []writer) error {
+	byName := make(map[string]writer, len(writers))
+	for _, w := range writers {
+		byName[w.Name()] = w
+	}
+	names, err := files.Files(ctx)
+	if err != nil {
+		return err
+	}
+	samples := 0
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		records, err := files.Read(ctx, name)
+		if err != nil {
+			return err
+		}
+		for _, group := range groupDeadLetters(records, cfg.tenancyEnabled) {
+			w, ok := byName[group.remote]
+			if !ok {
+				return errors.Errorf("samples of %s were given up by %s, which isn't configured", name, group.remote)
+			}
+			timeseries, err := bigquerydb.DeadLetterTimeSeries(group.records)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", name)
+			}
+			writeCtx := ctx
+			if group.tenant != "" {
+				writeCtx = bigquerydb.ContextWithTenant(ctx, group.tenant)
+			}
+			if err := w.Write(writeCtx, timeseries); err != nil {
+				return errors.Wrapf(err, "failed to write the samples of %s", name)
+			}
+		}
+		samples += len(records)
+		if cfg.replayDelete {
+			if err := files.Remove(ctx, name); err != nil {
+				return err
+			}
+		}
+		logger.Info("replayed dead-letter file", slog.String("file", name), slog.Int("samples", len(records)))
+	}
+	logger.Info("replay completed", slog.Int("files", len(names)), slog.Int("samples", samples), slog.Bool("deleted", cfg.replayDelete))
+	return nil
+}
+
+// deadLetterGroup are the records of a file written by the same client for the same tenant.
+type deadLetterGroup struct {
+	remote  string
+	tenant  string
+	records []bigquerydb.DeadLetterRecord
+}
+
+// groupDeadLetters groups the records by client, and by tenant with tenancy, in the order
+// of their first record.
+func groupDeadLetters(records []bigquerydb.DeadLetterRecord, tenancy bool) []*deadLetterGroup {
+	var groups []*deadLetterGroup
+	index := map[[2]string]*deadLetterGroup{}
+	for _, record := range records {
+		key := [2]string{record.Remote}
+		if tenancy {
+			key[1] = record.Labels[bigquerydb.TenantLabel]
+		}
+		group, ok := index[key]
+		if !ok {
+			group = &deadLetterGroup{remote: key[0], tenant: key[1]}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.records = append(group.records, record)
+	}
+	return groups
+}
@@ -0,0 +1,132 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/alecthomas/units"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func deadLetterRecord(remote, tenant string, timestamp int64) bigquerydb.DeadLetterRecord {
+	labels := map[string]string{"job": "api"}
+	if tenant != "" {
+		labels[bigquerydb.TenantLabel] = tenant
+	}
+	return bigquerydb.DeadLetterRecord{Remote: remote, Metric: "up", Labels: labels, Timestamp: timestamp, Value: "1"}
+}
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	files, err := bigquerydb.OpenDeadLetters(context.Background(), dir)
+	assert.NoError(t, err)
+	assert.NoError(t, files.Put(context.Background(), []bigquerydb.DeadLetterRecord{
+		deadLetterRecord("bigquerydb", "", 1000),
+		deadLetterRecord("archive", "", 1000),
+		deadLetterRecord("bigquerydb", "", 2000),
+	}))
+	primary := &mockWriter{name: "bigquerydb"}
+	archive := &mockWriter{name: "archive"}
+
+	cfg := &Config{}
+	assert.NoError(t, runReplay(context.Background(), *promslog.NewNopLogger(), cfg, files, []writer{primary, archive}))
+	if assert.Len(t, primary.received, 1, "the samples of a series are written together") {
+		assert.Equal(t, []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}}, primary.received[0].Samples)
+	}
+	assert.Len(t, archive.received, 1)
+	names, err := files.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, names, 1, "files are kept without --delete")
+
+	cfg.replayDelete = true
+	assert.NoError(t, runReplay(context.Background(), *promslog.NewNopLogger(), cfg, files, []writer{primary, archive}))
+	names, err = files.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestRunReplayFailures(t *testing.T) {
+	files, err := bigquerydb.OpenDeadLetters(context.Background(), t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, files.Put(context.Background(), []bigquerydb.DeadLetterRecord{deadLetterRecord("archive", "", 1000)}))
+	cfg := &Config{replayDelete: true}
+
+	err = runReplay(context.Background(), *promslog.NewNopLogger(), cfg, files, []writer{&mockWriter{name: "bigquerydb"}})
+	assert.ErrorContains(t, err, "were given up by archive, which isn't configured")
+
+	failing := &mockWriter{name: "archive", err: errors.New("insert failed")}
+	err = runReplay(context.Background(), *promslog.NewNopLogger(), cfg, files, []writer{failing})
+	assert.ErrorContains(t, err, "failed to write the samples of")
+	names, err := files.Files(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, names, 1, "files which failed are kept")
+}
+
+func TestRunReplayTenants(t *testing.T) {
+	files, err := bigquerydb.OpenDeadLetters(context.Background(), t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, files.Put(context.Background(), []bigquerydb.DeadLetterRecord{
+		deadLetterRecord("bigquerydb", "team-a", 1000),
+		deadLetterRecord("bigquerydb", "team-b", 1000),
+		deadLetterRecord("bigquerydb", "team-a", 2000),
+	}))
+	w := &tenantWriter{}
+
+	assert.NoError(t, runReplay(context.Background(), *promslog.NewNopLogger(), &Config{tenancyEnabled: true}, files, []writer{w}))
+	assert.Equal(t, []string{"team-a", "team-b"}, w.tenants, "every tenant is written with its own context")
+
+	w.tenants = nil
+	assert.NoError(t, runReplay(context.Background(), *promslog.NewNopLogger(), &Config{}, files, []writer{w}))
+	assert.Equal(t, []string{""}, w.tenants, "without tenancy the tenant label is an ordinary label")
+}
+
+func TestDeadLetterFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.deadLetter)
+	assert.Empty(t, cfg.deadLetterTable)
+	assert.Equal(t, 100*units.MiB, cfg.deadLetterMaxBytes)
+
+	cfg, err = parseTestFlags("--write.deadletter=gs://bucket/prefix", "--write.deadletter-max-bytes=1GiB")
+	assert.NoError(t, err)
+	assert.Equal(t, "gs://bucket/prefix", cfg.deadLetter)
+	assert.Equal(t, units.GiB, cfg.deadLetterMaxBytes)
+
+	load := func(flags ...string) error {
+		_, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return err
+	}
+	err = load("--write.deadletter=/tmp/deadletter", "--write.deadletter-table=deadletter")
+	assert.EqualError(t, err, "write.deadletter and write.deadletter-table are mutually exclusive")
+	err = load("--write.deadletter-table=project.dataset.table")
+	assert.EqualError(t, err, `invalid write.deadletter-table "project.dataset.table", expected dataset.table or table`)
+
+	dir := filepath.Join(t.TempDir(), "deadletter")
+	cfg, err = parseTestFlags("replay", dir, "--delete")
+	assert.NoError(t, err)
+	assert.Equal(t, "replay", cfg.command)
+	assert.Equal(t, dir, cfg.replayLocation)
+	assert.True(t, cfg.replayDelete)
+	_, err = parseTestFlags("replay")
+	assert.Error(t, err)
+}
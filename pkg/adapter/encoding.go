@@ -0,0 +1,136 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings of request and response bodies.
+const (
+	encodingSnappy   = "snappy"
+	encodingZstd     = "zstd"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+// requestEncoding returns the content encoding of the request body. Requests without
+// a Content-Encoding header are snappy encoded, as remote write and read require it.
+func requestEncoding(r *http.Request) (string, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "":
+		return encodingSnappy, nil
+	case encodingSnappy, encodingZstd, encodingIdentity:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unsupported content encoding %q, must be one of snappy, zstd, identity", encoding)
+}
+
+// zstdDecoders holds decoders which decode streams synchronously, without goroutines
+// that would have to be closed.
+var zstdDecoders = sync.Pool{New: func() interface{} {
+	d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	return d
+}}
+
+// zstdEncoder compresses read responses. EncodeAll may be called concurrently.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+
+// decompress decodes the body into dst and returns the decoded data. Bodies decoding to
+// more than maxSize bytes fail with a *decodedSizeError. A maxSize of 0 disables the limit.
+func decompress(encoding string, dst, body []byte, maxSize int64) ([]byte, error) {
+	switch encoding {
+	case encodingIdentity:
+		return body, nil
+	case encodingZstd, encodingGzip:
+		var r io.Reader
+		if encoding == encodingGzip {
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			r = gz
+		} else {
+			d := zstdDecoders.Get().(*zstd.Decoder)
+			defer zstdDecoders.Put(d)
+			if err := d.Reset(bytes.NewReader(body)); err != nil {
+				return nil, err
+			}
+			r = d
+		}
+		if maxSize > 0 {
+			r = io.LimitReader(r, maxSize+1)
+		}
+		buf := bytes.NewBuffer(dst[:0])
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		if maxSize > 0 && int64(buf.Len()) > maxSize {
+			return nil, &decodedSizeError{maxSize: maxSize}
+		}
+		return buf.Bytes(), nil
+	}
+
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(size) > maxSize {
+		return nil, &decodedSizeError{size: size, maxSize: maxSize}
+	}
+	if cap(dst) < size {
+		dst = make([]byte, size)
+	}
+	return snappy.Decode(dst[:cap(dst)], body)
+}
+
+// decodedSizeError is returned by decompress when the decoded body exceeds the size limit.
+type decodedSizeError struct {
+	size    int
+	maxSize int64
+}
+
+func (e *decodedSizeError) Error() string {
+	if e.size == 0 {
+		return fmt.Sprintf("decompressed request body exceeds the limit of %d bytes", e.maxSize)
+	}
+	return fmt.Sprintf("decompressed request body of %d bytes exceeds the limit of %d bytes", e.size, e.maxSize)
+}
+
+// compress encodes the data into dst with the given encoding and returns the encoded data.
+func compress(encoding string, dst, data []byte) []byte {
+	switch encoding {
+	case encodingIdentity:
+		return data
+	case encodingZstd:
+		return zstdEncoder.EncodeAll(data, dst[:0])
+	}
+	if maxLen := snappy.MaxEncodedLen(len(data)); cap(dst) < maxLen {
+		dst = make([]byte, maxLen)
+	}
+	return snappy.Encode(dst[:cap(dst)], data)
+}
@@ -0,0 +1,194 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeTestBody compresses data with the encoding, like a client sending it would.
+func encodeTestBody(t *testing.T, encoding string, data []byte) []byte {
+	switch encoding {
+	case encodingZstd:
+		enc, err := zstd.NewWriter(nil)
+		assert.NoError(t, err)
+		defer enc.Close()
+		return enc.EncodeAll(data, nil)
+	case encodingIdentity:
+		return data
+	}
+	return snappy.Encode(nil, data)
+}
+
+// decodeTestBody decompresses a response body with the encoding.
+func decodeTestBody(t *testing.T, encoding string, data []byte) []byte {
+	switch encoding {
+	case encodingZstd:
+		dec, err := zstd.NewReader(nil)
+		assert.NoError(t, err)
+		defer dec.Close()
+		decoded, err := dec.DecodeAll(data, nil)
+		assert.NoError(t, err)
+		return decoded
+	case encodingIdentity:
+		return data
+	}
+	decoded, err := snappy.Decode(nil, data)
+	assert.NoError(t, err)
+	return decoded
+}
+
+func TestRequestEncoding(t *testing.T) {
+	testCases := map[string]struct {
+		header   string
+		expected string
+		err      bool
+	}{
+		"missing":  {header: "", expected: encodingSnappy},
+		"snappy":   {header: "snappy", expected: encodingSnappy},
+		"zstd":     {header: "zstd", expected: encodingZstd},
+		"identity": {header: "identity", expected: encodingIdentity},
+		"case":     {header: " ZSTD ", expected: encodingZstd},
+		"gzip":     {header: "gzip", err: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/write", nil)
+			if testCase.header != "" {
+				r.Header.Set("Content-Encoding", testCase.header)
+			}
+			encoding, err := requestEncoding(r)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, encoding)
+		})
+	}
+}
+
+func TestWriteHandlerEncodings(t *testing.T) {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{testSeries("up"), testSeries("down")}})
+	assert.NoError(t, err)
+
+	for _, encoding := range []string{encodingSnappy, encodingZstd, encodingIdentity} {
+		t.Run(encoding, func(t *testing.T) {
+			w := &mockWriter{name: "bigquerydb"}
+			handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll, maxRequestSize: 1 << 20}), []writer{w})
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(encodeTestBody(t, encoding, data)))
+			r.Header.Set("Content-Encoding", encoding)
+			handler(rec, r)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, 2, w.series)
+
+			// A body which isn't valid for the codec is a bad request.
+			rec = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+			r.Header.Set("Content-Encoding", encoding)
+			handler(rec, r)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, 2, w.series)
+		})
+	}
+}
+
+func TestReadHandlerEncodings(t *testing.T) {
+	data, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+	expected := readResponse(seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}))
+
+	for _, encoding := range []string{encodingSnappy, encodingZstd, encodingIdentity} {
+		t.Run(encoding, func(t *testing.T) {
+			handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{&mockReader{name: "bigquerydb", resp: expected}})
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(encodeTestBody(t, encoding, data)))
+			r.Header.Set("Content-Encoding", encoding)
+			handler(rec, r)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			// The response is encoded like the request.
+			if encoding == encodingIdentity {
+				assert.Empty(t, rec.Header().Get("Content-Encoding"))
+			} else {
+				assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+			}
+			var resp prompb.ReadResponse
+			assert.NoError(t, proto.Unmarshal(decodeTestBody(t, encoding, rec.Body.Bytes()), &resp))
+			assert.Equal(t, expected, &resp)
+
+			rec = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+			r.Header.Set("Content-Encoding", encoding)
+			handler(rec, r)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	w := &mockWriter{name: "bigquerydb"}
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll})
+	handlers := map[string]http.HandlerFunc{
+		"write": writeHandler(*promslog.NewNopLogger(), cfg, []writer{w}),
+		"read":  readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", resp: readResponse()}}),
+	}
+
+	for api, handler := range handlers {
+		t.Run(api, func(t *testing.T) {
+			rejected := counterValue(cfg.metrics.rejectedRequests.WithLabelValues(api, "unsupported_encoding"))
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/"+api, writeRequestBody(t, testSeries("up")))
+			r.Header.Set("Content-Encoding", "gzip")
+			handler(rec, r)
+			assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+			assert.Equal(t, rejected+1, counterValue(cfg.metrics.rejectedRequests.WithLabelValues(api, "unsupported_encoding")))
+		})
+	}
+	assert.Zero(t, w.series)
+}
+
+func TestZstdMaxRequestSize(t *testing.T) {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{testSeries("up", "padding", string(make([]byte, 4096)))}})
+	assert.NoError(t, err)
+	body := encodeTestBody(t, encodingZstd, data)
+	assert.Less(t, len(body), 1024, "zeros compress well")
+
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll, maxRequestSize: 1024}), []writer{w})
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", encodingZstd)
+	handler(rec, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Zero(t, w.series)
+}
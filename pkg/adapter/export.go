@@ -0,0 +1,305 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	exportOpenMetrics = "openmetrics"
+	exportCSV         = "csv"
+	exportJSON        = "json"
+)
+
+// exporter streams the rows of a query. It is implemented by *bigquerydb.BigqueryClient.
+type exporter interface {
+	Export(ctx context.Context, q *prompb.Query, fn func(labels []*prompb.Label, sample prompb.Sample) error) (*bigquerydb.ExportStats, error)
+}
+
+// runExport writes the samples of the export query to the output file, or to stdout
+// if it is -, and logs a summary of the export.
+func runExport(ctx context.Context, logger slog.Logger, cfg *Config, e exporter) error {
+	q, err := exportQuery(cfg.exportMatchers, cfg.exportStart, cfg.exportEnd, time.Now())
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if cfg.exportOutput != "-" {
+		out, err = os.Create(cfg.exportOutput)
+		if err != nil {
+			return errors.Wrap(err, "failed to create the output file")
+		}
+		defer out.Close()
+	}
+
+	begin := time.Now()
+	buf := bufio.NewWriter(out)
+	w := newExportWriter(cfg.exportFormat, buf)
+	stats, err := e.Export(ctx, q, w.write)
+	if err != nil {
+		return err
+	}
+	if err := w.close(); err != nil {
+		return errors.Wrap(err, "failed to write the output")
+	}
+	if err := buf.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write the output")
+	}
+	if cfg.exportOutput != "-" {
+		if err := out.Sync(); err != nil {
+			return errors.Wrap(err, "failed to write the output")
+		}
+	}
+
+	logger.Info("export completed", slog.String("output", cfg.exportOutput), slog.String("format", cfg.exportFormat),
+		slog.Int("series", stats.Series), slog.Int("samples", stats.Samples), slog.Int64("bytes_scanned", stats.BytesProcessed),
+		slog.Duration("duration", time.Since(begin)))
+	return nil
+}
+
+// exportQuery builds the query of an export from its matchers and time range. The end
+// defaults to now.
+func exportQuery(matchers []string, start, end string, now time.Time) (*prompb.Query, error) {
+	q := &prompb.Query{}
+	for _, m := range matchers {
+		matcher, err := parseExportMatcher(m)
+		if err != nil {
+			return nil, err
+		}
+		q.Matchers = append(q.Matchers, matcher)
+	}
+
+	var err error
+	if q.StartTimestampMs, err = parseExportTime(start); err != nil {
+		return nil, errors.Wrap(err, "invalid start")
+	}
+	q.EndTimestampMs = now.UnixMilli()
+	if end != "" {
+		if q.EndTimestampMs, err = parseExportTime(end); err != nil {
+			return nil, errors.Wrap(err, "invalid end")
+		}
+	}
+	if q.EndTimestampMs < q.StartTimestampMs {
+		return nil, errors.New("the end of the export is before its start")
+	}
+	return q, nil
+}
+
+// parseExportMatcher parses a matcher given as label=value, label!=value, label=~regex
+// or label!~regex. A plain metric name matches the metric name.
+func parseExportMatcher(s string) (*prompb.LabelMatcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i < 0 {
+		if !model.IsValidMetricName(model.LabelValue(s)) {
+			return nil, errors.Errorf("invalid metric name %q", s)
+		}
+		return &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: model.MetricNameLabel, Value: s}, nil
+	}
+	if i == 0 {
+		return nil, errors.Errorf("matcher %q has no label name", s)
+	}
+
+	name, op := s[:i], s[i:]
+	for _, candidate := range []struct {
+		op  string
+		typ prompb.LabelMatcher_Type
+	}{
+		{op: "=~", typ: prompb.LabelMatcher_RE},
+		{op: "!~", typ: prompb.LabelMatcher_NRE},
+		{op: "!=", typ: prompb.LabelMatcher_NEQ},
+		{op: "=", typ: prompb.LabelMatcher_EQ},
+	} {
+		if strings.HasPrefix(op, candidate.op) {
+			return &prompb.LabelMatcher{Type: candidate.typ, Name: name, Value: op[len(candidate.op):]}, nil
+		}
+	}
+	return nil, errors.Errorf("matcher %q has no operator, must be one of =, !=, =~, !~", s)
+}
+
+// parseExportTime parses a time given in RFC 3339 or as Unix timestamp in seconds
+// and returns it in milliseconds.
+func parseExportTime(s string) (int64, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UnixMilli(), nil
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("%q is neither an RFC 3339 time nor a Unix timestamp", s)
+	}
+	return int64(math.Round(seconds * 1000)), nil
+}
+
+// exportWriter writes the samples of an export in one of the output formats.
+type exportWriter interface {
+	write(labels []*prompb.Label, sample prompb.Sample) error
+	// close writes what has to follow the last sample.
+	close() error
+}
+
+func newExportWriter(format string, w io.Writer) exportWriter {
+	switch format {
+	case exportCSV:
+		return newCSVExportWriter(w)
+	case exportJSON:
+		return &jsonExportWriter{enc: json.NewEncoder(w)}
+	}
+	return &openMetricsExportWriter{w: w}
+}
+
+// openMetricsExportWriter writes the samples in the OpenMetrics text format, which a
+// local Prometheus can import with promtool tsdb create-blocks-from openmetrics.
+type openMetricsExportWriter struct {
+	w io.Writer
+}
+
+func (o *openMetricsExportWriter) write(labels []*prompb.Label, sample prompb.Sample) error {
+	var b strings.Builder
+	var name string
+	for _, l := range labels {
+		if l.Name == model.MetricNameLabel {
+			name = l.Value
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l.Value))
+		b.WriteByte('"')
+	}
+	if b.Len() > 0 {
+		b.WriteByte('}')
+	}
+	_, err := fmt.Fprintf(o.w, "%s%s %s %s\n", name, b.String(), formatExportValue(sample.Value),
+		strconv.FormatFloat(float64(sample.Timestamp)/1000, 'f', -1, 64))
+	return err
+}
+
+func (o *openMetricsExportWriter) close() error {
+	_, err := io.WriteString(o.w, "# EOF\n")
+	return err
+}
+
+// labelValueEscaper escapes label values in the OpenMetrics text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// formatExportValue formats a sample value like the Prometheus text formats do.
+func formatExportValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// csvExportWriter writes a row with the metric name, the other labels as JSON object,
+// the timestamp in milliseconds and the value for every sample.
+type csvExportWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVExportWriter(w io.Writer) *csvExportWriter {
+	return &csvExportWriter{w: csv.NewWriter(w)}
+}
+
+// writeHeader writes the header before the first row, or into an otherwise empty file.
+func (c *csvExportWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write([]string{"metricname", "labels", "timestamp", "value"})
+}
+
+func (c *csvExportWriter) write(labels []*prompb.Label, sample prompb.Sample) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	var name string
+	tags := make(map[string]string, len(labels))
+	for _, l := range labels {
+		if l.Name == model.MetricNameLabel {
+			name = l.Value
+			continue
+		}
+		tags[l.Name] = l.Value
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return c.w.Write([]string{name, string(tagsJSON), strconv.FormatInt(sample.Timestamp, 10), formatExportValue(sample.Value)})
+}
+
+func (c *csvExportWriter) close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonExportWriter writes a JSON object per sample and line. The value is a string,
+// like in the HTTP API of Prometheus, as JSON numbers can't represent NaN and Inf.
+type jsonExportWriter struct {
+	enc *json.Encoder
+}
+
+type jsonExportSample struct {
+	Metric    map[string]string `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     string            `json:"value"`
+}
+
+func (j *jsonExportWriter) write(labels []*prompb.Label, sample prompb.Sample) error {
+	metric := make(map[string]string, len(labels))
+	for _, l := range labels {
+		metric[l.Name] = l.Value
+	}
+	return j.enc.Encode(jsonExportSample{Metric: metric, Timestamp: sample.Timestamp, Value: formatExportValue(sample.Value)})
+}
+
+func (j *jsonExportWriter) close() error {
+	return nil
+}
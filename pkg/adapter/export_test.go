@@ -0,0 +1,195 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockExporter passes the samples of the series to the export function in order.
+type mockExporter struct {
+	series []*prompb.TimeSeries
+	query  *prompb.Query
+}
+
+func (m *mockExporter) Export(_ context.Context, q *prompb.Query, fn func(labels []*prompb.Label, sample prompb.Sample) error) (*bigquerydb.ExportStats, error) {
+	m.query = q
+	stats := &bigquerydb.ExportStats{Series: len(m.series), BytesProcessed: 1024}
+	for _, ts := range m.series {
+		for _, s := range ts.Samples {
+			if err := fn(ts.Labels, s); err != nil {
+				return nil, err
+			}
+			stats.Samples++
+		}
+	}
+	return stats, nil
+}
+
+func exportTestSeries() []*prompb.TimeSeries {
+	return []*prompb.TimeSeries{
+		{
+			Labels: []*prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "code", Value: "200"}, {Name: "path", Value: `/a"b\c`}},
+			Samples: []prompb.Sample{
+				{Timestamp: 1700000000000, Value: 10},
+				{Timestamp: 1700000015250, Value: 2.5e+21},
+			},
+		},
+		{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Timestamp: 1700000000000, Value: math.Inf(1)}},
+		},
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	testCases := map[string]string{
+		exportOpenMetrics: `http_requests_total{code="200",path="/a\"b\\c"} 10 1700000000
+http_requests_total{code="200",path="/a\"b\\c"} 2.5e+21 1700000015.25
+up +Inf 1700000000
+# EOF
+`,
+		exportCSV: `metricname,labels,timestamp,value
+http_requests_total,"{""code"":""200"",""path"":""/a\""b\\c""}",1700000000000,10
+http_requests_total,"{""code"":""200"",""path"":""/a\""b\\c""}",1700000015250,2.5e+21
+up,{},1700000000000,+Inf
+`,
+		exportJSON: `{"metric":{"__name__":"http_requests_total","code":"200","path":"/a\"b\\c"},"timestamp":1700000000000,"value":"10"}
+{"metric":{"__name__":"http_requests_total","code":"200","path":"/a\"b\\c"},"timestamp":1700000015250,"value":"2.5e+21"}
+{"metric":{"__name__":"up"},"timestamp":1700000000000,"value":"+Inf"}
+`,
+	}
+
+	for format, expected := range testCases {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newExportWriter(format, &buf)
+			for _, ts := range exportTestSeries() {
+				for _, s := range ts.Samples {
+					assert.NoError(t, w.write(ts.Labels, s))
+				}
+			}
+			assert.NoError(t, w.close())
+			assert.Equal(t, expected, buf.String())
+		})
+	}
+}
+
+func TestExportEmptyCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w := newExportWriter(exportCSV, &buf)
+	assert.NoError(t, w.close())
+	assert.Equal(t, "metricname,labels,timestamp,value\n", buf.String())
+}
+
+func TestRunExport(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "export.json")
+	cfg := testConfig(&Config{
+		exportMatchers: []string{"up", "job=~api|web"},
+		exportStart:    "2023-11-14T22:13:20Z",
+		exportEnd:      "1700003600",
+		exportFormat:   exportJSON,
+		exportOutput:   output,
+	})
+	e := &mockExporter{series: exportTestSeries()[1:]}
+
+	assert.NoError(t, runExport(context.Background(), *promslog.NewNopLogger(), cfg, e))
+	assert.Equal(t, &prompb.Query{
+		StartTimestampMs: 1700000000000,
+		EndTimestampMs:   1700003600000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api|web"},
+		},
+	}, e.query)
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"metric":{"__name__":"up"},"timestamp":1700000000000,"value":"+Inf"}`+"\n", string(data))
+}
+
+func TestExportQuery(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	q, err := exportQuery([]string{"up"}, "1699990000.5", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1699990000500), q.StartTimestampMs)
+	assert.Equal(t, int64(1700000000000), q.EndTimestampMs, "the end defaults to now")
+
+	_, err = exportQuery([]string{"up"}, "yesterday", "", now)
+	assert.ErrorContains(t, err, "invalid start")
+	_, err = exportQuery([]string{"up"}, "1700000000", "1600000000", now)
+	assert.ErrorContains(t, err, "before its start")
+}
+
+func TestParseExportMatcher(t *testing.T) {
+	testCases := map[string]struct {
+		expected *prompb.LabelMatcher
+		err      bool
+	}{
+		"up":             {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+		"job=api":        {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "api"}},
+		"job!=api":       {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NEQ, Name: "job", Value: "api"}},
+		"job=~api|web":   {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "job", Value: "api|web"}},
+		"job!~api":       {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_NRE, Name: "job", Value: "api"}},
+		"path=/a=b":      {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "path", Value: "/a=b"}},
+		"job=":           {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: "job", Value: ""}},
+		"=api":           {err: true},
+		"job!api":        {err: true},
+		"not a metric":   {err: true},
+		"__name__=~up.*": {expected: &prompb.LabelMatcher{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "up.*"}},
+	}
+
+	for matcher, testCase := range testCases {
+		t.Run(matcher, func(t *testing.T) {
+			m, err := parseExportMatcher(matcher)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, m)
+		})
+	}
+}
+
+func TestExportFlags(t *testing.T) {
+	cfg, err := parseTestFlags("export", "--match=up", "--match=job=api", "--start=1700000000", "--format=csv", "--output=out.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "export", cfg.command)
+	assert.Equal(t, []string{"up", "job=api"}, cfg.exportMatchers)
+	assert.Equal(t, exportCSV, cfg.exportFormat)
+	assert.Equal(t, "out.csv", cfg.exportOutput)
+
+	cfg, err = parseTestFlags("export", "--match=up", "--start=1700000000")
+	assert.NoError(t, err)
+	assert.Equal(t, exportOpenMetrics, cfg.exportFormat)
+	assert.Equal(t, "-", cfg.exportOutput)
+
+	_, err = parseTestFlags("export", "--start=1700000000")
+	assert.Error(t, err, "a matcher is required")
+	_, err = parseTestFlags("export", "--match=up", "--start=1700000000", "--format=parquet")
+	assert.Error(t, err)
+}
@@ -0,0 +1,685 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/alecthomas/units"
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseTestFlags(args ...string) (*Config, error) {
+	cfg := testConfig(&Config{promslogConfig: promslog.Config{}})
+	a, _ := newApp(cfg)
+	command, err := a.Parse(append([]string{"--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, args...))
+	cfg.command = command
+	return testConfig(cfg), err
+}
+
+func TestQueryPriorityFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, "interactive", cfg.readQueryPriority)
+
+	cfg, err = parseTestFlags("--read.query-priority=batch")
+	assert.NoError(t, err)
+	assert.Equal(t, "batch", cfg.readQueryPriority)
+
+	_, err = parseTestFlags("--read.query-priority=urgent")
+	assert.Error(t, err)
+}
+
+func TestImpersonationFlags(t *testing.T) {
+	cfg, err := parseTestFlags(
+		"--googleAPI-impersonate-service-account=bigquery@project.iam.gserviceaccount.com",
+		"--googleAPI-impersonate-delegate=first@project.iam.gserviceaccount.com",
+		"--googleAPI-impersonate-delegate=second@project.iam.gserviceaccount.com",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "bigquery@project.iam.gserviceaccount.com", cfg.impersonate)
+	assert.Equal(t, []string{"first@project.iam.gserviceaccount.com", "second@project.iam.gserviceaccount.com"}, cfg.impersonateDelegates)
+	assert.Empty(t, cfg.impersonateScopes)
+}
+
+func TestCredentialFlags(t *testing.T) {
+	keyfile := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(keyfile, []byte(`{"project_id": "my-project"}`), 0o600))
+
+	cfg, err := parseTestFlags(`--googleAPIjsonkey-content={"project_id": "my-project"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, checkCredentialFlags(cfg))
+
+	cfg, err = parseTestFlags("--googleAPIjsonkeypath=" + keyfile)
+	assert.NoError(t, err)
+	assert.NoError(t, checkCredentialFlags(cfg))
+
+	cfg, err = parseTestFlags("--googleAPIjsonkeypath="+keyfile, `--googleAPIjsonkey-content={"project_id": "my-project"}`)
+	assert.NoError(t, err)
+	assert.Error(t, checkCredentialFlags(cfg))
+}
+
+func TestTimeoutFlags(t *testing.T) {
+	testCases := map[string]struct {
+		args          []string
+		expectedWrite time.Duration
+		expectedRead  time.Duration
+	}{
+		"defaults":     {expectedWrite: 30 * time.Second, expectedRead: 30 * time.Second},
+		"send_timeout": {args: []string{"--send-timeout=10s"}, expectedWrite: 10 * time.Second, expectedRead: 10 * time.Second},
+		"separate":     {args: []string{"--send-timeout=10s", "--write.timeout=5s", "--read.timeout=3m"}, expectedWrite: 5 * time.Second, expectedRead: 3 * time.Minute},
+		"read_only":    {args: []string{"--read.timeout=3m"}, expectedWrite: 30 * time.Second, expectedRead: 3 * time.Minute},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := parseTestFlags(testCase.args...)
+			assert.NoError(t, err)
+			resolveTimeouts(cfg)
+			assert.Equal(t, testCase.expectedWrite, cfg.writeTimeout)
+			assert.Equal(t, testCase.expectedRead, cfg.readTimeout)
+		})
+	}
+}
+
+func TestWriteDryRunFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.writeDryRun)
+
+	cfg, err = parseTestFlags("--write.dry-run")
+	assert.NoError(t, err)
+	assert.True(t, cfg.writeDryRun)
+}
+
+func TestSkipSchemaCheck(t *testing.T) {
+	cfg, err := parseTestFlags("--bigquery.skip-schema-check")
+	assert.NoError(t, err)
+	assert.True(t, cfg.skipSchemaCheck)
+	assert.NoError(t, checkSchema(*promslog.NewNopLogger(), cfg, nil), "the table isn't accessed when the check is skipped")
+}
+
+func TestTagsTypeFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TagsTypeString, cfg.tagsType)
+
+	cfg, err = parseTestFlags("--bigquery.tags-type=auto")
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TagsTypeAuto, cfg.tagsType)
+
+	cfg, err = parseTestFlags("--bigquery.tags-type=labels")
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TagsTypeLabels, cfg.tagsType)
+
+	_, err = parseTestFlags("--bigquery.tags-type=bytes")
+	assert.Error(t, err)
+}
+
+func TestCreateTableFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.createTable)
+
+	t.Setenv("PROMBQ_BIGQUERY_CREATE_TABLE", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.createTable)
+}
+
+func TestDataProjectFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.googleAPIdataProject)
+
+	t.Setenv("PROMBQ_DATA_PROJECT_ID", "analytics")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, "analytics", cfg.googleAPIdataProject)
+}
+
+func TestCheckIdentifiers(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	cfg.googleAPIdatasetID = "metrics-prod"
+	assert.NoError(t, checkIdentifiers(cfg), "dashes are quoted")
+
+	cfg.googleAPItableID = "samples`"
+	assert.EqualError(t, checkIdentifiers(cfg), "invalid googleAPItableID: \"samples`\" must not contain a backtick")
+
+	cfg, err = parseTestFlags("--write.target=dataset=archive,table=sam\tples")
+	assert.NoError(t, err)
+	cfg.writeTargets, err = parseTargets(cfg.writeTargetSpecs, "project", cfg.writeTimeout)
+	assert.NoError(t, err)
+	assert.ErrorContains(t, checkIdentifiers(cfg), "invalid write.target")
+}
+
+func TestInsertOptionFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.skipInvalidRows)
+	assert.False(t, cfg.ignoreUnknownValues)
+
+	cfg, err = parseTestFlags("--no-bigquery.skip-invalid-rows", "--bigquery.ignore-unknown-values")
+	assert.NoError(t, err)
+	assert.False(t, cfg.skipInvalidRows)
+	assert.True(t, cfg.ignoreUnknownValues)
+}
+
+func TestServerSideSortFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.readServerSideSort)
+
+	cfg, err = parseTestFlags("--no-read.server-side-sort")
+	assert.NoError(t, err)
+	assert.False(t, cfg.readServerSideSort)
+}
+
+func TestSkipBadRowsFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.readSkipBadRows)
+
+	cfg, err = parseTestFlags("--read.skip-bad-rows")
+	assert.NoError(t, err)
+	assert.True(t, cfg.readSkipBadRows)
+}
+
+func TestRequireMetricNameFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.readRequireMetricName)
+
+	t.Setenv("PROMBQ_READ_REQUIRE_METRIC_NAME", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.readRequireMetricName)
+}
+
+func TestMaxRangeFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.readMaxRange)
+	assert.Equal(t, bigquerydb.RangeLimitReject, cfg.readMaxRangeBehavior)
+
+	cfg, err = parseTestFlags("--read.max-range=720h", "--read.max-range-behavior=truncate")
+	assert.NoError(t, err)
+	assert.Equal(t, 720*time.Hour, cfg.readMaxRange)
+	assert.Equal(t, bigquerydb.RangeLimitTruncate, cfg.readMaxRangeBehavior)
+
+	_, err = parseTestFlags("--read.max-range-behavior=clamp")
+	assert.Error(t, err)
+}
+
+func TestSlowQueryThresholdFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.readSlowQuery)
+
+	cfg, err = parseTestFlags("--read.slow-query-threshold=30s")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.readSlowQuery)
+}
+
+func TestStaticLabelFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.writeStaticLabels)
+	assert.False(t, cfg.writeStaticOverride)
+
+	cfg, err = parseTestFlags("--write.static-label=cluster=eu-west1", "--write.static-label=env=prod", "--write.static-label-override")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cluster": "eu-west1", "env": "prod"}, cfg.writeStaticLabels)
+	assert.True(t, cfg.writeStaticOverride)
+}
+
+func TestDropLabelFlags(t *testing.T) {
+	cfg, err := parseTestFlags("--write.drop-label=pod_template_hash", "--write.drop-label=container_id", "--write.drop-label-regex=__meta_.*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pod_template_hash", "container_id"}, cfg.writeDropLabels)
+	assert.Equal(t, []string{"__meta_.*"}, cfg.writeDropLabelRegex)
+}
+
+func TestMaxSampleAgeFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.writeMaxSampleAge)
+	assert.False(t, cfg.writeRejectOld)
+
+	cfg, err = parseTestFlags("--write.max-sample-age=168h", "--write.reject-old")
+	assert.NoError(t, err)
+	assert.Equal(t, 168*time.Hour, cfg.writeMaxSampleAge)
+	assert.True(t, cfg.writeRejectOld)
+}
+
+func TestMaxFutureSkewFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.writeMaxFutureSkew)
+	assert.Equal(t, bigquerydb.FutureSampleDrop, cfg.writeFutureBehavior)
+
+	cfg, err = parseTestFlags("--write.max-future-skew=1h", "--write.future-behavior=clamp")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.writeMaxFutureSkew)
+	assert.Equal(t, bigquerydb.FutureSampleClamp, cfg.writeFutureBehavior)
+
+	_, err = parseTestFlags("--write.future-behavior=shift")
+	assert.Error(t, err)
+}
+
+func TestStoreStaleMarkersFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.writeStoreStale)
+
+	t.Setenv("PROMBQ_WRITE_STORE_STALE_MARKERS", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.writeStoreStale)
+}
+
+func TestOversizeFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, units.MiB, cfg.writeMaxRowSize)
+	assert.Equal(t, bigquerydb.OversizeDrop, cfg.writeOversize)
+	assert.Equal(t, 1024, cfg.writeTruncatedLength)
+
+	cfg, err = parseTestFlags("--write.max-row-size=512KiB", "--write.oversize-behavior=truncate", "--write.truncated-label-length=256")
+	assert.NoError(t, err)
+	assert.Equal(t, 512*units.KiB, cfg.writeMaxRowSize)
+	assert.Equal(t, bigquerydb.OversizeTruncate, cfg.writeOversize)
+	assert.Equal(t, 256, cfg.writeTruncatedLength)
+
+	_, err = parseTestFlags("--write.oversize-behavior=split")
+	assert.Error(t, err)
+}
+
+func TestPerMetricSamplesFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.perMetricSamples)
+	assert.Equal(t, 100, cfg.perMetricSamplesLimit)
+
+	cfg, err = parseTestFlags("--metrics.per-metric-samples", "--metrics.per-metric-samples-limit=20")
+	assert.NoError(t, err)
+	assert.True(t, cfg.perMetricSamples)
+	assert.Equal(t, 20, cfg.perMetricSamplesLimit)
+}
+
+func TestAdminFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.enablePprof)
+	assert.Empty(t, cfg.adminListenAddr)
+	assert.False(t, cfg.adminMetrics)
+
+	cfg, err = parseTestFlags("--web.enable-pprof", "--web.admin-listen-address=localhost:9202", "--web.admin-metrics")
+	assert.NoError(t, err)
+	assert.True(t, cfg.enablePprof)
+	assert.Equal(t, "localhost:9202", cfg.adminListenAddr)
+	assert.True(t, cfg.adminMetrics)
+
+	cfg, err = parseTestFlags("--web.telemetry-listen-address=:9203")
+	assert.NoError(t, err)
+	assert.Equal(t, ":9203", cfg.telemetryListenAddr)
+}
+
+func TestCoalesceFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.coalesceMaxDelay)
+
+	cfg, err = parseTestFlags("--write.coalesce-max-delay=200ms", "--write.coalesce-max-rows=5000", "--write.coalesce-max-bytes=2MiB")
+	assert.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, cfg.coalesceMaxDelay)
+	assert.Equal(t, 5000, cfg.coalesceMaxRows)
+	assert.Equal(t, 2*units.MiB, cfg.coalesceMaxBytes)
+}
+
+func TestSpillFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.spillDir)
+	assert.Equal(t, units.GiB, cfg.spillMaxBytes)
+	assert.Equal(t, 10*time.Second, cfg.spillReplayInterval)
+
+	cfg, err = parseTestFlags("--write.spill-dir=/var/lib/prombq", "--write.spill-max-bytes=64MiB", "--write.spill-replay-interval=1m")
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/prombq", cfg.spillDir)
+	assert.Equal(t, 64*units.MiB, cfg.spillMaxBytes)
+	assert.Equal(t, time.Minute, cfg.spillReplayInterval)
+}
+
+func TestRowRetryFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cfg.rowRetries)
+	assert.Equal(t, 100*time.Millisecond, cfg.rowRetryBackoff)
+
+	cfg, err = parseTestFlags("--write.row-retries=0", "--write.row-retry-backoff=1s")
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.rowRetries)
+	assert.Equal(t, time.Second, cfg.rowRetryBackoff)
+}
+
+func TestLogSampleFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, cfg.logSampleLimit)
+	assert.Equal(t, time.Minute, cfg.logSampleWindow)
+
+	cfg, err = parseTestFlags("--log.sample-limit=0", "--log.sample-window=5m")
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.logSampleLimit)
+	assert.Equal(t, 5*time.Minute, cfg.logSampleWindow)
+}
+
+func TestSpecialValueColumnFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.specialValueColumn)
+
+	t.Setenv("PROMBQ_BIGQUERY_SPECIAL_VALUE_COLUMN", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.specialValueColumn)
+}
+
+func TestSeriesHashColumnFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.seriesHashColumn)
+
+	t.Setenv("PROMBQ_BIGQUERY_SERIES_HASH_COLUMN", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.seriesHashColumn)
+}
+
+func TestInsertTimeColumnFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.insertTimeColumn)
+
+	t.Setenv("PROMBQ_BIGQUERY_INSERT_TIME_COLUMN", "true")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.True(t, cfg.insertTimeColumn)
+}
+
+func TestReadDeduplicateFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.readDeduplicate)
+
+	cfg, err = parseTestFlags("--read.deduplicate")
+	assert.NoError(t, err)
+	assert.True(t, cfg.readDeduplicate)
+}
+
+func TestTimestampTypeFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TimestampTypeTimestamp, cfg.timestampType)
+
+	cfg, err = parseTestFlags("--bigquery.timestamp-type=int64_millis")
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TimestampTypeMillis, cfg.timestampType)
+
+	t.Setenv("PROMBQ_BIGQUERY_TIMESTAMP_TYPE", "auto")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.TimestampTypeAuto, cfg.timestampType)
+
+	_, err = parseTestFlags("--bigquery.timestamp-type=datetime")
+	assert.Error(t, err)
+}
+
+func TestReadTableOverrideFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.readTableOverride)
+
+	cfg, err = parseTestFlags("--read.table-override=curated.metrics-view")
+	assert.NoError(t, err)
+	assert.Equal(t, "curated.metrics-view", cfg.readTableOverride)
+
+	cfg.readDatasetID, cfg.readTableID, err = parseReadTable(cfg.readTableOverride, cfg.googleAPIdatasetID)
+	assert.NoError(t, err)
+	assert.NoError(t, checkIdentifiers(cfg))
+	cfg.readTableID = "metrics`view"
+	assert.ErrorContains(t, checkIdentifiers(cfg), "invalid read.table-override")
+}
+
+func TestReadSQLTemplateFlag(t *testing.T) {
+	tmpl, err := parseReadTemplate("")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "read.sql.tmpl")
+	assert.NoError(t, os.WriteFile(valid, []byte("SELECT {{.Columns}} FROM {{.Table}} WHERE timestamp >= {{.Start}} AND timestamp <= {{.End}}\n"), 0o600))
+	t.Setenv("PROMBQ_READ_SQL_TEMPLATE", valid)
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, valid, cfg.readSQLTemplate)
+	tmpl, err = parseReadTemplate(cfg.readSQLTemplate)
+	assert.NoError(t, err)
+	assert.NotNil(t, tmpl)
+
+	invalid := filepath.Join(dir, "invalid.sql.tmpl")
+	assert.NoError(t, os.WriteFile(invalid, []byte("SELECT {{.Columns}} FROM {{.View}}"), 0o600))
+	_, err = parseReadTemplate(invalid)
+	assert.ErrorContains(t, err, "invalid read.sql-template")
+
+	_, err = parseTestFlags("--read.sql-template=" + filepath.Join(dir, "missing.sql.tmpl"))
+	assert.Error(t, err, "the file has to exist")
+}
+
+func TestMaxResponseBytesFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, units.Base2Bytes(0), cfg.readMaxResponseBytes)
+
+	t.Setenv("PROMBQ_READ_MAX_RESPONSE_BYTES", "512MiB")
+	cfg, err = parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 512*units.MiB, cfg.readMaxResponseBytes)
+}
+
+func TestDryRunMinRangeFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.readDryRunMinRange)
+
+	cfg, err = parseTestFlags("--read.max-bytes-scanned=10GiB", "--read.dry-run-min-range=6h")
+	assert.NoError(t, err)
+	limits := readLimits(cfg)
+	assert.Equal(t, int64(10<<30), limits.MaxBytesScanned)
+	assert.Equal(t, 6*time.Hour, limits.DryRunMinRange)
+
+	_, _, err = loadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table", "--read.dry-run-min-range=-1h"})
+	assert.EqualError(t, err, "read.dry-run-min-range must not be negative")
+}
+
+func TestLogFormatFlag(t *testing.T) {
+	for format, expected := range map[string]string{
+		"logfmt": `level=WARN source=flags_test.go`,
+		"json":   `"level":"WARN"`,
+		"gcp":    `"severity":"WARNING"`,
+	} {
+		cfg, err := parseTestFlags("--googleProjectID=project", "--log.format="+format)
+		assert.NoError(t, err)
+		var logs bytes.Buffer
+		cfg.promslogConfig.Writer = &logs
+		slog.New(newLogHandler(cfg)).Warn("formatted")
+		assert.Contains(t, logs.String(), expected, format)
+	}
+
+	_, err := parseTestFlags("--log.format=text")
+	assert.ErrorContains(t, err, "enum value must be one of logfmt,json,gcp")
+}
+
+func TestKeyCheckIntervalFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.keyCheckInterval)
+
+	cfg, err = parseTestFlags("--googleAPIjsonkey-check-interval=0")
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.keyCheckInterval)
+}
+
+func TestMetricsFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, "storage_bigquery", cfg.metricsNamespace)
+	assert.Empty(t, cfg.metricsConstLabels)
+
+	t.Setenv("PROMBQ_METRICS_NAMESPACE", "prombq")
+	cfg, err = parseTestFlags("--metrics.const-label=env=prod", "--metrics.const-label=adapter=bigquery")
+	assert.NoError(t, err)
+	assert.Equal(t, "prombq", cfg.metricsNamespace)
+	assert.Equal(t, map[string]string{"env": "prod", "adapter": "bigquery"}, cfg.metricsConstLabels)
+
+	_, _, err = loadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table", "--metrics.const-label=env-name=prod"})
+	assert.EqualError(t, err, "invalid name of the constant label env-name")
+}
+
+func TestTemplateSuffixFlag(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.templateSuffix)
+
+	cfg, err = load("--bigquery.template-suffix=_{{.Labels.env}}", "--write.static-label=env=dev")
+	if assert.NoError(t, err) {
+		assert.True(t, cfg.templateSuffix.Static())
+	}
+	cfg, err = load("--bigquery.template-suffix=_{{.Tenant}}", "--tenancy.enabled")
+	if assert.NoError(t, err) {
+		assert.False(t, cfg.templateSuffix.Static())
+	}
+
+	_, err = load("--bigquery.template-suffix=_{{.Tenant}}")
+	assert.EqualError(t, err, `invalid bigquery.template-suffix "_{{.Tenant}}", it depends on the tenant without tenancy.enabled`)
+	_, err = load("--bigquery.template-suffix=_{{.Labels.env}}")
+	assert.ErrorContains(t, err, `invalid bigquery.template-suffix "_{{.Labels.env}}"`)
+}
+
+func TestDateShardingFlag(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "none", cfg.dateSharding)
+
+	cfg, err = load("--bigquery.date-sharding=daily")
+	assert.NoError(t, err)
+	assert.Equal(t, "daily", cfg.dateSharding)
+
+	_, err = load("--bigquery.date-sharding=monthly")
+	assert.Error(t, err)
+	_, err = load("--bigquery.date-sharding=daily", "--bigquery.template-suffix=_dev")
+	assert.EqualError(t, err, "bigquery.date-sharding and bigquery.template-suffix are mutually exclusive")
+	_, err = load("--bigquery.date-sharding=daily", "--bigquery.retention=720h")
+	assert.ErrorContains(t, err, "bigquery.date-sharding and bigquery.retention are mutually exclusive")
+}
+
+func TestPartitioningFlags(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "column", cfg.partitioning)
+	assert.Equal(t, "day", cfg.partitionGranularity)
+
+	cfg, err = load("--bigquery.partitioning=ingestion", "--bigquery.partition-granularity=hour")
+	assert.NoError(t, err)
+	assert.Equal(t, "ingestion", cfg.partitioning)
+	assert.Equal(t, "hour", cfg.partitionGranularity)
+
+	_, err = load("--bigquery.partitioning=range")
+	assert.Error(t, err)
+	_, err = load("--bigquery.partition-granularity=year")
+	assert.Error(t, err)
+	_, err = load("--bigquery.timestamp-type=int64_millis", "--bigquery.partition-granularity=month")
+	assert.EqualError(t, err, "a timestamp column of bigquery.timestamp-type int64_millis is only partitioned per day, set bigquery.partition-granularity=day or bigquery.partitioning=ingestion")
+	_, err = load("--bigquery.timestamp-type=int64_millis", "--bigquery.partitioning=ingestion", "--bigquery.partition-granularity=month")
+	assert.NoError(t, err)
+}
+
+func TestMultiTargetPolicyFlag(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "all", cfg.writeTargetPolicy)
+
+	cfg, err = load("--write.target-policy=any")
+	assert.NoError(t, err)
+	assert.Equal(t, "any", cfg.writeTargetPolicy, "the deprecated flag still applies")
+
+	cfg, err = load("--write.target-policy=any", "--write.multi-target-policy=primary")
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", cfg.writeTargetPolicy)
+
+	_, err = load("--write.multi-target-policy=majority")
+	assert.Error(t, err)
+}
+
+func TestStorageFlags(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "bigquery", cfg.storage)
+	assert.Zero(t, cfg.noopLatency)
+	assert.Zero(t, cfg.noopErrorRate)
+
+	cfg, err = load("--storage=noop", "--storage.noop-latency=20ms", "--storage.noop-error-rate=0.05")
+	assert.NoError(t, err)
+	assert.Equal(t, "noop", cfg.storage)
+	assert.Equal(t, 20*time.Millisecond, cfg.noopLatency)
+	assert.Equal(t, 0.05, cfg.noopErrorRate)
+
+	_, err = load("--storage=memory")
+	assert.Error(t, err)
+	_, err = load("--storage.noop-error-rate=1.5")
+	assert.EqualError(t, err, "storage.noop-error-rate must be between 0 and 1")
+	_, err = load("--storage.noop-latency=-1s")
+	assert.EqualError(t, err, "storage.noop-latency must not be negative")
+}
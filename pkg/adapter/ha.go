@@ -0,0 +1,136 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// haTracker deduplicates the writes of Prometheus servers running as replicas of a
+// cluster, like the HA tracker of Cortex. The first replica writing for a cluster is
+// elected, and the samples of all other replicas are dropped until the elected replica
+// didn't write for the failover timeout. A nil *haTracker writes everything.
+type haTracker struct {
+	clusterLabel    string
+	replicaLabel    string
+	failoverTimeout time.Duration
+
+	mu      sync.Mutex
+	elected map[haCluster]*haReplica
+}
+
+// haCluster identifies a cluster, whose name is only unique per tenant.
+type haCluster struct {
+	tenant string
+	name   string
+}
+
+// haReplica is the elected replica of a cluster.
+type haReplica struct {
+	name     string
+	lastSeen time.Time
+}
+
+// newHATracker returns a tracker electing replicas by the cluster and replica labels, or
+// nil if neither label is given.
+func newHATracker(clusterLabel, replicaLabel string, failoverTimeout time.Duration) (*haTracker, error) {
+	if clusterLabel == "" && replicaLabel == "" {
+		return nil, nil
+	}
+	if clusterLabel == "" || replicaLabel == "" {
+		return nil, errors.New("ha.cluster-label and ha.replica-label must be given together")
+	}
+	if clusterLabel == replicaLabel {
+		return nil, errors.New("ha.cluster-label and ha.replica-label must differ")
+	}
+	if failoverTimeout <= 0 {
+		return nil, errors.New("ha.failover-timeout must be positive")
+	}
+	return &haTracker{
+		clusterLabel:    clusterLabel,
+		replicaLabel:    replicaLabel,
+		failoverTimeout: failoverTimeout,
+		elected:         map[haCluster]*haReplica{},
+	}, nil
+}
+
+// apply decides whether the series of a write request of the tenant are written. A write
+// request is sent by a single Prometheus server, so its cluster and replica are taken from
+// the labels of the first series. Requests without both labels are always written. The
+// replica label is removed from the series of written requests. If the request comes from
+// a replica which isn't elected, it returns false and the cluster of the request.
+func (t *haTracker) apply(m *metrics, tenant string, timeseries []*prompb.TimeSeries, now time.Time) (bool, string) {
+	if t == nil || len(timeseries) == 0 {
+		return true, ""
+	}
+	var cluster, replica string
+	for _, l := range timeseries[0].Labels {
+		switch l.Name {
+		case t.clusterLabel:
+			cluster = l.Value
+		case t.replicaLabel:
+			replica = l.Value
+		}
+	}
+	if cluster == "" || replica == "" {
+		return true, cluster
+	}
+	if !t.accept(m, haCluster{tenant: tenant, name: cluster}, replica, now) {
+		return false, cluster
+	}
+	for _, ts := range timeseries {
+		ts.Labels = removeLabel(ts.Labels, t.replicaLabel)
+	}
+	return true, cluster
+}
+
+// accept returns whether the replica is the elected replica of the cluster, electing it
+// if the cluster has none yet or the elected replica timed out. Elections are recorded in
+// the metrics.
+func (t *haTracker) accept(m *metrics, cluster haCluster, replica string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elected, ok := t.elected[cluster]
+	switch {
+	case ok && elected.name == replica:
+		elected.lastSeen = now
+		return true
+	case ok && now.Sub(elected.lastSeen) <= t.failoverTimeout:
+		return false
+	}
+	if ok {
+		m.haElectedReplica.DeleteLabelValues(cluster.tenant, cluster.name, elected.name)
+		m.haElectedReplicaChanges.WithLabelValues(cluster.tenant, cluster.name).Inc()
+	}
+	t.elected[cluster] = &haReplica{name: replica, lastSeen: now}
+	m.haElectedReplica.WithLabelValues(cluster.tenant, cluster.name, replica).Set(1)
+	return true
+}
+
+// removeLabel removes the label in place.
+func removeLabel(labels []*prompb.Label, name string) []*prompb.Label {
+	n := 0
+	for _, l := range labels {
+		if l.Name != name {
+			labels[n] = l
+			n++
+		}
+	}
+	clear(labels[n:])
+	return labels[:n]
+}
@@ -0,0 +1,142 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// replicaSeries returns the series of a request of a replica of the cluster.
+func replicaSeries(cluster, replica string) []*prompb.TimeSeries {
+	return []*prompb.TimeSeries{
+		testSeries("up", "cluster", cluster, "instance", "a", "replica", replica),
+		testSeries("up", "cluster", cluster, "instance", "b", "replica", replica),
+	}
+}
+
+func TestHATrackerFailover(t *testing.T) {
+	tracker, err := newHATracker("cluster", "replica", 30*time.Second)
+	assert.NoError(t, err)
+	m := newMetrics(prometheus.NewRegistry(), metricfactory.Default())
+	now := time.Unix(1000, 0)
+
+	ok, _ := tracker.apply(m, "", replicaSeries("eu", "prom-0"), now)
+	assert.True(t, ok, "the first replica is elected")
+	ok, cluster := tracker.apply(m, "", replicaSeries("eu", "prom-1"), now.Add(time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, "eu", cluster)
+	ok, _ = tracker.apply(m, "", replicaSeries("us", "prom-1"), now.Add(time.Second))
+	assert.True(t, ok, "every cluster elects its own replica")
+
+	// prom-0 keeps its election as long as it writes.
+	ok, _ = tracker.apply(m, "", replicaSeries("eu", "prom-0"), now.Add(25*time.Second))
+	assert.True(t, ok)
+	ok, _ = tracker.apply(m, "", replicaSeries("eu", "prom-1"), now.Add(55*time.Second))
+	assert.False(t, ok, "the timeout starts at the last write of the elected replica")
+
+	changes := counterValue(m.haElectedReplicaChanges.WithLabelValues("", "eu"))
+	ok, _ = tracker.apply(m, "", replicaSeries("eu", "prom-1"), now.Add(56*time.Second))
+	assert.True(t, ok, "prom-1 takes over once prom-0 stopped writing for the timeout")
+	ok, _ = tracker.apply(m, "", replicaSeries("eu", "prom-0"), now.Add(57*time.Second))
+	assert.False(t, ok, "the recovered replica isn't elected again")
+	assert.Equal(t, changes+1, counterValue(m.haElectedReplicaChanges.WithLabelValues("", "eu")))
+	assert.True(t, m.haElectedReplica.DeleteLabelValues("", "eu", "prom-1"), "the elected replica is exposed")
+	assert.False(t, m.haElectedReplica.DeleteLabelValues("", "eu", "prom-0"), "the replaced replica isn't exposed anymore")
+}
+
+func TestHATrackerLabels(t *testing.T) {
+	tracker, err := newHATracker("cluster", "replica", 30*time.Second)
+	assert.NoError(t, err)
+	m := newMetrics(prometheus.NewRegistry(), metricfactory.Default())
+	now := time.Unix(1000, 0)
+
+	series := replicaSeries("labels", "prom-0")
+	ok, _ := tracker.apply(m, "", series, now)
+	assert.True(t, ok)
+	for _, ts := range series {
+		assert.Equal(t, "cluster", ts.Labels[1].Name)
+		assert.Len(t, ts.Labels, 3, "the replica label is removed")
+	}
+
+	ok, _ = tracker.apply(m, "", []*prompb.TimeSeries{testSeries("up", "replica", "prom-1")}, now)
+	assert.True(t, ok, "series without a cluster are written")
+	ok, _ = tracker.apply(m, "team-a", replicaSeries("labels", "prom-1"), now)
+	assert.True(t, ok, "clusters of different tenants are separate")
+
+	var nilTracker *haTracker
+	ok, _ = nilTracker.apply(m, "", replicaSeries("labels", "prom-1"), now)
+	assert.True(t, ok)
+}
+
+func TestNewHATracker(t *testing.T) {
+	tracker, err := newHATracker("", "", 30*time.Second)
+	assert.NoError(t, err)
+	assert.Nil(t, tracker)
+
+	_, err = newHATracker("cluster", "", 30*time.Second)
+	assert.Error(t, err)
+	_, err = newHATracker("cluster", "cluster", 30*time.Second)
+	assert.Error(t, err)
+	_, err = newHATracker("cluster", "replica", 0)
+	assert.Error(t, err)
+}
+
+func TestWriteHandlerHA(t *testing.T) {
+	tracker, err := newHATracker("cluster", "replica", time.Minute)
+	assert.NoError(t, err)
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, haTracker: tracker})
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	dropped := counterValue(cfg.metrics.haDroppedSamples.WithLabelValues("", "ha-test"))
+
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+	for _, replica := range []string{"prom-0", "prom-1", "prom-0"} {
+		series := replicaSeries("ha-test", replica)
+		for _, ts := range series {
+			ts.Samples = []prompb.Sample{sample}
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series...)))
+		if replica == "prom-0" {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusAccepted, rec.Code, "duplicates are acknowledged so that they aren't retried")
+		}
+	}
+	assert.Equal(t, 4, w.series)
+	assert.Equal(t, dropped+2, counterValue(cfg.metrics.haDroppedSamples.WithLabelValues("", "ha-test")))
+}
+
+func TestHAFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.haFailoverTimeout)
+
+	cfg, err = parseTestFlags("--ha.cluster-label=cluster", "--ha.replica-label=__replica__", "--ha.failover-timeout=1m")
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster", cfg.haClusterLabel)
+	assert.Equal(t, "__replica__", cfg.haReplicaLabel)
+	assert.Equal(t, time.Minute, cfg.haFailoverTimeout)
+}
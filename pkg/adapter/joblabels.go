@@ -0,0 +1,61 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/version"
+	"github.com/pkg/errors"
+)
+
+// Constraints of BigQuery on labels, see https://cloud.google.com/bigquery/docs/labels-intro#requirements
+var (
+	jobLabelKeyRE   = regexp.MustCompile(`^\p{Ll}[\p{Ll}\p{Lo}0-9_-]{0,62}$`)
+	jobLabelValueRE = regexp.MustCompile(`^[\p{Ll}\p{Lo}0-9_-]{0,63}$`)
+	invalidValueRE  = regexp.MustCompile(`[^\p{Ll}\p{Lo}0-9_-]`)
+)
+
+const maxJobLabels = 64
+
+// jobLabels validates the configured labels of BigQuery jobs and adds the adapter_version label.
+func jobLabels(configured map[string]string) (map[string]string, error) {
+	labels := make(map[string]string, len(configured)+1)
+	for key, value := range configured {
+		if !jobLabelKeyRE.MatchString(key) {
+			return nil, errors.Errorf("invalid job label key %q: must start with a lowercase letter and contain at most 63 lowercase letters, digits, underscores and dashes", key)
+		}
+		if !jobLabelValueRE.MatchString(value) {
+			return nil, errors.Errorf("invalid value %q of job label %q: must contain at most 63 lowercase letters, digits, underscores and dashes", value, key)
+		}
+		labels[key] = value
+	}
+	if _, ok := labels["adapter_version"]; !ok {
+		labels["adapter_version"] = jobLabelValue(version.Version)
+	}
+	if len(labels) > maxJobLabels {
+		return nil, errors.Errorf("too many job labels: %d, BigQuery allows at most %d", len(labels), maxJobLabels)
+	}
+	return labels, nil
+}
+
+// jobLabelValue turns s into a valid label value, e.g. v0.8.0 into v0_8_0.
+func jobLabelValue(s string) string {
+	s = invalidValueRE.ReplaceAllString(strings.ToLower(s), "_")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/version"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobLabels(t *testing.T) {
+	labels, err := jobLabels(map[string]string{"team": "observability", "cost-center": "cc_4711", "empty": ""})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "observability", "cost-center": "cc_4711", "empty": "", "adapter_version": jobLabelValue(version.Version)}, labels)
+
+	labels, err = jobLabels(map[string]string{"adapter_version": "custom"})
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", labels["adapter_version"])
+}
+
+func TestJobLabelValue(t *testing.T) {
+	assert.Equal(t, "v0_8_0", jobLabelValue("v0.8.0"))
+	assert.Equal(t, "v1_0_0-rc_1", jobLabelValue("V1.0.0-RC.1"))
+	assert.Len(t, jobLabelValue(strings.Repeat("a", 100)), 63)
+}
+
+func TestJobLabelsInvalid(t *testing.T) {
+	testCases := map[string]map[string]string{
+		"uppercase_key":   {"Team": "a"},
+		"digit_first":     {"1team": "a"},
+		"empty_key":       {"": "a"},
+		"long_key":        {strings.Repeat("k", 64): "a"},
+		"uppercase_value": {"team": "Observability"},
+		"dotted_value":    {"team": "a.b"},
+		"long_value":      {"team": strings.Repeat("v", 64)},
+	}
+
+	for name, labels := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := jobLabels(labels)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestJobLabelFlag(t *testing.T) {
+	cfg, err := parseTestFlags("--bigquery.job-label=team=observability", "--bigquery.job-label=env=prod")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "observability", "env": "prod"}, cfg.jobLabels)
+}
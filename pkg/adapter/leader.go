@@ -0,0 +1,75 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"strings"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/leader"
+	"github.com/pkg/errors"
+)
+
+// checkLeaderElection validates the leader election flags and defaults the name of the
+// election to prombq- and the table ID, as a valid name of a Kubernetes object.
+func checkLeaderElection(cfg *Config) error {
+	if !cfg.leaderElection {
+		if cfg.leaderKubernetes {
+			return errors.New("leader-election.kubernetes needs leader-election.enabled")
+		}
+		return nil
+	}
+	if cfg.leaderRenewInterval <= 0 || cfg.leaderRenewInterval >= cfg.leaderLeaseDuration {
+		return errors.New("leader-election.renew-interval must be positive and shorter than leader-election.lease-duration")
+	}
+	if cfg.storage == storageNoop && !cfg.leaderKubernetes {
+		return errors.New("leader election with storage=noop needs leader-election.kubernetes")
+	}
+	if cfg.leaderName == "" {
+		cfg.leaderName = "prombq-" + strings.Trim(strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return r + 'a' - 'A'
+			}
+			return '-'
+		}, cfg.googleAPItableID), "-")
+	}
+	return nil
+}
+
+// leaderOption returns the option gating the periodic tasks of the primary client on the
+// leadership of the elector, if leader election is enabled.
+func leaderOption(cfg *Config) bigquerydb.Option {
+	if cfg.elector == nil {
+		return bigquerydb.WithLeader(nil)
+	}
+	return bigquerydb.WithLeader(cfg.elector)
+}
+
+// leaderLock returns the lock of the leader election: a Kubernetes Lease with
+// leader-election.kubernetes, and a row of leader-election.table otherwise.
+func leaderLock(ctx context.Context, cfg *Config, writers []writer) (leader.Lock, error) {
+	if cfg.leaderKubernetes {
+		return leader.NewKubernetesLock(cfg.leaderNamespace, cfg.leaderName)
+	}
+	for _, w := range writers {
+		if c, ok := w.(*bigquerydb.BigqueryClient); ok {
+			return c.LeaderLock(ctx, cfg.leaderTable, cfg.leaderName)
+		}
+	}
+	return nil, errors.New("leader election without leader-election.kubernetes needs a BigQuery table")
+}
@@ -0,0 +1,72 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderElectionFlags(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=Prometheus_Metrics"}, flags...))
+		return cfg, err
+	}
+
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.False(t, cfg.leaderElection)
+	assert.Equal(t, "prombq_leader", cfg.leaderTable)
+	assert.Equal(t, time.Minute, cfg.leaderLeaseDuration)
+	assert.Equal(t, 20*time.Second, cfg.leaderRenewInterval)
+
+	cfg, err = load("--leader-election.enabled")
+	assert.NoError(t, err)
+	assert.Equal(t, "prombq-prometheus-metrics", cfg.leaderName, "the name defaults to a valid Kubernetes name of the table")
+	cfg, err = load("--leader-election.enabled", "--leader-election.name=adapters")
+	assert.NoError(t, err)
+	assert.Equal(t, "adapters", cfg.leaderName)
+
+	_, err = load("--leader-election.kubernetes")
+	assert.EqualError(t, err, "leader-election.kubernetes needs leader-election.enabled")
+	_, err = load("--leader-election.enabled", "--leader-election.renew-interval=1m")
+	assert.EqualError(t, err, "leader-election.renew-interval must be positive and shorter than leader-election.lease-duration")
+	_, err = load("--leader-election.enabled", "--storage=noop")
+	assert.EqualError(t, err, "leader election with storage=noop needs leader-election.kubernetes")
+}
+
+func TestLeaderLock(t *testing.T) {
+	cfg := testConfig(&Config{leaderElection: true, leaderTable: "prombq_leader", leaderName: "prombq-table"})
+	_, err := leaderLock(context.Background(), cfg, []writer{&mockWriter{name: "noop"}})
+	assert.EqualError(t, err, "leader election without leader-election.kubernetes needs a BigQuery table")
+
+	c, err := bigquerydb.NewClient(promslog.NewNopLogger(), "", "project", "dataset", "table", time.Minute,
+		bigquerydb.WithEndpoint("http://localhost:9050"), bigquerydb.WithInserter(discardInserter{}))
+	assert.NoError(t, err)
+	lock, err := leaderLock(context.Background(), cfg, []writer{&mockWriter{name: "noop"}, c})
+	assert.NoError(t, err)
+	assert.IsType(t, &bigquerydb.LeaderLock{}, lock)
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	cfg.leaderKubernetes = true
+	_, err = leaderLock(context.Background(), cfg, []writer{c})
+	assert.ErrorContains(t, err, "not running in a Kubernetes pod")
+}
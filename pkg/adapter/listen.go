@@ -0,0 +1,173 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// unixSocketPrefix starts listen addresses of UNIX domain sockets.
+const unixSocketPrefix = "unix://"
+
+// listen listens on the address, either host:port or unix:// followed by the path of a
+// UNIX domain socket. The socket gets the given permissions. A stale socket left behind
+// by a previous run is removed first, and the socket is removed again when the listener
+// is closed.
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, errors.Errorf("no socket path given in %q", addr)
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "failed to set the permissions of socket %s", path)
+	}
+	return l, nil
+}
+
+// removeStaleSocket removes the socket at the path unless something is still listening on
+// it. Files which aren't sockets are never removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.Errorf("socket %s is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// parseSocketMode parses the octal permissions of UNIX domain sockets, like 0660.
+func parseSocketMode(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0o777 {
+		return 0, errors.Errorf("invalid socket mode %q, must be octal permissions like 0660", mode)
+	}
+	return os.FileMode(perm), nil
+}
+
+// normalizeRoutePrefix returns the route prefix with a leading slash and without a
+// trailing one, which is empty for the root.
+func normalizeRoutePrefix(prefix string) (string, error) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return "", nil
+	}
+	if strings.ContainsAny(prefix, "?#") || path.Clean(prefix) != prefix {
+		return "", errors.Errorf("invalid route prefix %q, must be a path like /bq-adapter", prefix)
+	}
+	return prefix, nil
+}
+
+// normalizeExternalURL checks that the external URL is an absolute http or https URL and
+// removes the trailing slash of its path.
+func normalizeExternalURL(externalURL string) (string, error) {
+	if externalURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(externalURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.Errorf("invalid external url %q, must be an absolute http or https url", externalURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	return u.String(), nil
+}
+
+// withRoutePrefix serves the handlers of the mux below the route prefix. Requests outside
+// of it are answered with 404.
+func withRoutePrefix(prefix string, mux *http.ServeMux) *http.ServeMux {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return mux
+	}
+	prefixed := http.NewServeMux()
+	prefixed.Handle(prefix+"/", http.StripPrefix(prefix, mux))
+	return prefixed
+}
+
+// fixedPaths are the paths of the endpoints which can't be moved.
+var fixedPaths = map[string]string{
+	"/version":           "version",
+	"/api/v1/status":     "status",
+	"/api/v1/read_debug": "debug read",
+	"/otlp/v1/metrics":   "otlp",
+	"/-/reload":          "reload",
+}
+
+// Default paths of the write and read endpoints, which --web.legacy-paths keeps serving.
+const (
+	defaultWritePath = "/write"
+	defaultReadPath  = "/read"
+)
+
+// checkEndpointPaths checks that the write and read paths are clean absolute paths which
+// don't collide with each other, the telemetry path or the paths of the other endpoints.
+func checkEndpointPaths(cfg *Config) error {
+	paths := map[string]string{}
+	for p, name := range fixedPaths {
+		paths[p] = name
+	}
+	endpoints := []struct{ name, flag, path string }{
+		{"telemetry", "web.telemetry-path", cfg.telemetryPath},
+		{"write", "web.write-path", cfg.writePath},
+		{"read", "web.read-path", cfg.readPath},
+	}
+	for _, e := range endpoints {
+		if !strings.HasPrefix(e.path, "/") || path.Clean(e.path) != e.path || strings.ContainsAny(e.path, "?#") {
+			return errors.Errorf("invalid %s %q, must be a path like /api/v1/%s", e.flag, e.path, e.name)
+		}
+		if e.path == "/" || strings.HasPrefix(e.path, "/debug/pprof/") {
+			return errors.Errorf("invalid %s %q, it collides with other endpoints", e.flag, e.path)
+		}
+		if other, ok := paths[e.path]; ok {
+			return errors.Errorf("invalid %s %q, it is the path of the %s endpoint", e.flag, e.path, other)
+		}
+		paths[e.path] = e.name
+	}
+	if cfg.legacyPaths {
+		for _, legacy := range []struct{ name, path string }{{"write", defaultWritePath}, {"read", defaultReadPath}} {
+			if other, ok := paths[legacy.path]; ok && other != legacy.name {
+				return errors.Errorf("the legacy %s path %q is the path of the %s endpoint", legacy.name, legacy.path, other)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixSocketWriteRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adapter.sock")
+	cfg, err := parseTestFlags("--web.listen-address=unix://" + path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cfg.writeTargetPolicy = policyAll
+	mw := &mockWriter{name: "bigquerydb"}
+	listeners := newListeners(*promslog.NewNopLogger(), cfg, []writer{mw}, nil)
+
+	ln, err := listen(listeners[0].addr, 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := &http.Server{Handler: listeners[0].mux}
+	go srv.Serve(ln)
+
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Post("http://adapter/write", "application/x-protobuf",
+		writeRequestBody(t, seriesWithSamples("up", "node", prompb.Sample{Timestamp: 1000, Value: 1})))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, mw.received, 1)
+	}
+	resp, err = client.Get("http://adapter/metrics")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assert.NoError(t, srv.Shutdown(context.Background()))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the socket is removed on shutdown")
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adapter.sock")
+	stale, err := net.Listen("unix", path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NoError(t, stale.Close())
+
+	ln, err := listen("unix://"+path, 0o660)
+	if assert.NoError(t, err) {
+		_, err = listen("unix://"+path, 0o660)
+		assert.ErrorContains(t, err, "in use", "a socket which is listened on isn't removed")
+		ln.Close()
+	}
+}
+
+func TestListenKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "adapter.sock")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	_, err := listen("unix://"+path, 0o660)
+	assert.ErrorContains(t, err, "not a socket")
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestListenTCP(t *testing.T) {
+	ln, err := listen("127.0.0.1:0", 0o660)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "tcp", ln.Addr().Network())
+		ln.Close()
+	}
+}
+
+func TestSocketModeFlag(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	mode, err := parseSocketMode(cfg.socketModeSpec)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), mode)
+
+	mode, err = parseSocketMode("600")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), mode)
+
+	for _, invalid := range []string{"rw", "0999", "01777"} {
+		_, err = parseSocketMode(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRoutePrefix(t *testing.T) {
+	cfg, _, err := loadConfig([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table",
+		"--web.route-prefix=bq-adapter/", "--web.external-url=https://metrics.example.com/bq-adapter/", "--web.admin-listen-address=:9202", "--web.enable-pprof"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/bq-adapter", cfg.routePrefix)
+	assert.Equal(t, "https://metrics.example.com/bq-adapter", cfg.externalURL)
+	cfg.writeTargetPolicy = policyAll
+	listeners := newListeners(*promslog.NewNopLogger(), testConfig(cfg), []writer{&mockWriter{name: "bigquerydb"}}, nil)
+
+	serve := func(l listener, method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		var body io.Reader
+		if method == http.MethodPost {
+			body = writeRequestBody(t, testSeries("up"))
+		}
+		l.mux.ServeHTTP(rec, httptest.NewRequest(method, target, body))
+		return rec
+	}
+	assert.Equal(t, http.StatusOK, serve(listeners[0], http.MethodPost, "/bq-adapter/write").Code)
+	assert.Equal(t, http.StatusOK, serve(listeners[0], http.MethodGet, "/bq-adapter/metrics").Code)
+	assert.Equal(t, http.StatusOK, serve(listeners[1], http.MethodGet, "/bq-adapter/debug/pprof/").Code)
+	for _, target := range []string{"/write", "/metrics", "/api/v1/status", "/bq-adapterwrite", "/"} {
+		assert.Equal(t, http.StatusNotFound, serve(listeners[0], http.MethodGet, target).Code, target)
+	}
+	assert.Equal(t, http.StatusNotFound, serve(listeners[1], http.MethodGet, "/debug/pprof/").Code)
+
+	rec := serve(listeners[0], http.MethodGet, "/bq-adapter/api/v1/status")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"external_url":"https://metrics.example.com/bq-adapter"`)
+}
+
+func TestNormalizeRoutePrefix(t *testing.T) {
+	for prefix, expected := range map[string]string{"/": "", "": "", "//": "", "/bq": "/bq", "bq/": "/bq", "/a/b/": "/a/b"} {
+		normalized, err := normalizeRoutePrefix(prefix)
+		assert.NoError(t, err, prefix)
+		assert.Equal(t, expected, normalized, prefix)
+	}
+	for _, invalid := range []string{"/a/../b", "/a//b", "/a?b=c", "/a#b"} {
+		_, err := normalizeRoutePrefix(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	for _, invalid := range []string{"metrics.example.com", "ftp://example.com", "https://", "://x"} {
+		_, err := normalizeExternalURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEndpointPaths(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, "/write", cfg.writePath)
+	assert.Equal(t, "/read", cfg.readPath)
+	assert.False(t, cfg.legacyPaths)
+
+	route := func(cfg *Config, target string) int {
+		cfg.writeTargetPolicy = policyAll
+		listeners := newListeners(*promslog.NewNopLogger(), testConfig(cfg), []writer{&mockWriter{name: "bigquerydb"}}, nil)
+		rec := httptest.NewRecorder()
+		listeners[0].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, writeRequestBody(t, testSeries("up"))))
+		return rec.Code
+	}
+	cfg, err = load("--web.write-path=/api/v1/write", "--web.read-path=/api/v1/read")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, route(cfg, "/api/v1/write"))
+		assert.Equal(t, http.StatusBadRequest, route(cfg, "/api/v1/read"), "the write request is no read request")
+		assert.Equal(t, http.StatusNotFound, route(cfg, "/write"))
+		assert.Equal(t, http.StatusNotFound, route(cfg, "/read"))
+	}
+	cfg, err = load("--web.write-path=/api/v1/write", "--web.read-path=/api/v1/read", "--web.legacy-paths")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, route(cfg, "/api/v1/write"))
+		assert.Equal(t, http.StatusOK, route(cfg, "/write"))
+		assert.Equal(t, http.StatusBadRequest, route(cfg, "/read"))
+	}
+	// The defaults aren't registered twice.
+	cfg, err = load("--web.read-path=/api/v1/read", "--web.legacy-paths")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, route(cfg, "/write"))
+	}
+
+	for flags, errMsg := range map[string]string{
+		"--web.write-path=api/v1/write":  `invalid web.write-path "api/v1/write"`,
+		"--web.read-path=/api/v1/read/":  `invalid web.read-path "/api/v1/read/"`,
+		"--web.write-path=/":             `invalid web.write-path "/", it collides with other endpoints`,
+		"--web.write-path=/metrics":      `invalid web.write-path "/metrics", it is the path of the telemetry endpoint`,
+		"--web.read-path=/write":         `invalid web.read-path "/write", it is the path of the write endpoint`,
+		"--web.read-path=/api/v1/status": `invalid web.read-path "/api/v1/status", it is the path of the status endpoint`,
+		"--web.write-path=/read --web.read-path=/api/v1/read --web.legacy-paths": `the legacy read path "/read" is the path of the write endpoint`,
+	} {
+		_, err := load(strings.Fields(flags)...)
+		assert.ErrorContains(t, err, errMsg, flags)
+	}
+}
@@ -0,0 +1,523 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/alecthomas/units"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfig returns the configuration with the metrics of an adapter registered with a
+// registry of its own, and the state of an adapter started now. Without a configured
+// factory, the metrics are named like the default ones.
+func testConfig(cfg *Config) *Config {
+	if cfg.Registerer == nil {
+		reg := prometheus.NewRegistry()
+		cfg.Registerer, cfg.Gatherer = reg, reg
+	}
+	if cfg.metrics == nil {
+		f := cfg.metricFactory
+		if f.Namespace == "" && f.ConstLabels == nil {
+			f = metricfactory.Default()
+		}
+		cfg.metrics = newMetrics(cfg.Registerer, f)
+	}
+	if cfg.state == nil {
+		cfg.state = newAdapterState(time.Now())
+	}
+	return cfg
+}
+
+func TestEncodeReadResponse(t *testing.T) {
+	resp := &prompb.ReadResponse{Results: []*prompb.QueryResult{{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+		}},
+	}}}
+
+	for i := 0; i < 3; i++ {
+		compressed, release, err := encodeReadResponse(resp, encodingSnappy)
+		assert.NoError(t, err)
+
+		data, err := snappy.Decode(nil, compressed)
+		assert.NoError(t, err)
+		var decoded prompb.ReadResponse
+		assert.NoError(t, proto.Unmarshal(data, &decoded))
+		assert.Equal(t, resp, &decoded)
+		release()
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	writeData, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{testSeries("up"), testSeries("down")}})
+	assert.NoError(t, err)
+	readData, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{
+		Matchers: []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"}},
+	}}})
+	assert.NoError(t, err)
+
+	handlers := map[string]struct {
+		data    []byte
+		handler func(cfg *Config) http.HandlerFunc
+	}{
+		"write": {data: writeData, handler: func(cfg *Config) http.HandlerFunc {
+			return writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}})
+		}},
+		"read": {data: readData, handler: func(cfg *Config) http.HandlerFunc {
+			return readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", resp: readResponse()}})
+		}},
+	}
+
+	for api, h := range handlers {
+		compressed := snappy.Encode(nil, h.data)
+		size := max(len(h.data), len(compressed))
+		testCases := map[string]struct {
+			maxRequestSize int
+			expected       int
+		}{
+			"unlimited":  {maxRequestSize: 0, expected: http.StatusOK},
+			"under":      {maxRequestSize: size + 1, expected: http.StatusOK},
+			"at_limit":   {maxRequestSize: size, expected: http.StatusOK},
+			"over_limit": {maxRequestSize: size - 1, expected: http.StatusRequestEntityTooLarge},
+		}
+
+		for name, testCase := range testCases {
+			t.Run(api+"_"+name, func(t *testing.T) {
+				cfg := testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll, maxRequestSize: units.Base2Bytes(testCase.maxRequestSize)})
+				rec := httptest.NewRecorder()
+				h.handler(cfg)(rec, httptest.NewRequest(http.MethodPost, "/"+api, bytes.NewReader(compressed)))
+				assert.Equal(t, testCase.expected, rec.Code)
+			})
+		}
+	}
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	var out dto.Metric
+	if err := c.Write(&out); err != nil {
+		panic(err)
+	}
+	return out.Counter.GetValue()
+}
+
+func TestMaxRequestSizeDecompressed(t *testing.T) {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{testSeries("up", "path", strings.Repeat("a", 10000))}})
+	assert.NoError(t, err)
+	compressed := snappy.Encode(nil, data)
+	assert.Less(t, len(compressed), len(data)/2)
+
+	w := &mockWriter{name: "bigquerydb"}
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, maxRequestSize: units.Base2Bytes(len(data) / 2)})
+	rejected := counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "too_large"))
+	rec := httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})(rec, httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(compressed)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "exceeds the limit")
+	assert.Equal(t, 0, w.series)
+	assert.Equal(t, rejected+1, counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "too_large")))
+}
+
+// startTestServer serves the write handler with the timeouts of cfg on a random port.
+func startTestServer(t *testing.T, cfg *Config) net.Conn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	srv := newServer(cfg)
+	srv.Handler = writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}})
+	go srv.Serve(ln) //nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	return conn
+}
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	conn := startTestServer(t, testConfig(&Config{httpHeaderTimeout: 100 * time.Millisecond, httpReadTimeout: time.Minute, writeTargetPolicy: policyAll}))
+
+	begin := time.Now()
+	_, err := io.WriteString(conn, "POST /write HTTP/1.1\r\nHost: localhost\r\n")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err, "the server must close the connection")
+	assert.Less(t, time.Since(begin), 2*time.Second)
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	conn := startTestServer(t, testConfig(&Config{httpHeaderTimeout: time.Minute, httpReadTimeout: 200 * time.Millisecond, writeTargetPolicy: policyAll}))
+
+	begin := time.Now()
+	_, err := io.WriteString(conn, "POST /write HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\npartial")
+	assert.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Less(t, time.Since(begin), 2*time.Second)
+}
+
+func TestMaxRemoteTimeout(t *testing.T) {
+	cfg := testConfig(&Config{
+		writeTimeout: 30 * time.Second,
+		readTimeout:  30 * time.Second,
+		writeTargets: []bigqueryTarget{{name: "archive", timeout: 10 * time.Second}},
+		readTargets:  []bigqueryTarget{{name: "archive", timeout: 2 * time.Minute}},
+	})
+	assert.Equal(t, 2*time.Minute, maxRemoteTimeout(cfg))
+}
+
+// gatheredValue returns the value of the series of the metric with the given labels in the
+// registry of the configuration, or false if there is none. Histograms return their
+// sample count.
+func gatheredValue(t *testing.T, cfg *Config, name string, labels map[string]string) (float64, bool) {
+	families, err := cfg.Gatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue(), true
+			case m.Gauge != nil:
+				return m.Gauge.GetValue(), true
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestCircuitOpenResponses(t *testing.T) {
+	openErr := &bigquerydb.CircuitOpenError{RetryAfter: 12500 * time.Millisecond}
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll})
+
+	rec := httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb", err: &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{openErr}}}})(
+		rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}))))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "13", rec.Header().Get("Retry-After"))
+
+	data, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{}}})
+	assert.NoError(t, err)
+	rec = httptest.NewRecorder()
+	readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", err: &bigquerydb.CircuitOpenError{}}})(
+		rec, httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, data))))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	queueErr := &bigquerydb.QueryError{Err: &bigquerydb.QueryQueueTimeoutError{MaxQueries: 4, RetryAfter: 10 * time.Second}}
+	readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", err: queueErr}})(
+		rec, httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, data))))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "reads whose queries waited too long for a slot are retried")
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	rec = httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb", err: errors.New("boom")}})(
+		rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll})
+	write := instrumentHandler(cfg.metrics, "write", writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}}))
+	read := instrumentHandler(cfg.metrics, "read", readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", resp: readResponse()}}))
+
+	writeOK, _ := gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "write", "code": "200", "method": "post"})
+	writeBad, _ := gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "write", "code": "400", "method": "post"})
+	readOK, _ := gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "read", "code": "200", "method": "post"})
+	readDuration, _ := gatheredValue(t, cfg, "http_request_duration_seconds", map[string]string{"handler": "read"})
+
+	write.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	write.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("not snappy")))
+	data, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{}}})
+	assert.NoError(t, err)
+	read.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, data))))
+
+	value, ok := gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "write", "code": "200", "method": "post"})
+	assert.True(t, ok)
+	assert.Equal(t, writeOK+1, value)
+	value, ok = gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "write", "code": "400", "method": "post"})
+	assert.True(t, ok)
+	assert.Equal(t, writeBad+1, value)
+	value, ok = gatheredValue(t, cfg, "http_requests_total", map[string]string{"handler": "read", "code": "200", "method": "post"})
+	assert.True(t, ok)
+	assert.Equal(t, readOK+1, value)
+	value, ok = gatheredValue(t, cfg, "http_request_duration_seconds", map[string]string{"handler": "read"})
+	assert.True(t, ok)
+	assert.Equal(t, readDuration+1, value)
+	value, ok = gatheredValue(t, cfg, "http_requests_in_flight", map[string]string{"handler": "write"})
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, value)
+}
+
+func TestNewMetricsNamespace(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newMetrics(reg, metricfactory.Factory{Namespace: "prombq", ConstLabels: prometheus.Labels{"env": "test"}})
+
+	m.receivedSamples.Add(3)
+	m.httpRequestsInFlight.WithLabelValues("write").Set(1)
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+		for _, m := range family.GetMetric() {
+			assert.Contains(t, m.GetLabel(), &dto.LabelPair{Name: proto.String("env"), Value: proto.String("test")}, family.GetName())
+		}
+	}
+	assert.True(t, names["prombq_received_samples_total"])
+	assert.True(t, names["prombq_build_info"])
+	assert.True(t, names["http_requests_in_flight"], "the http metrics keep their names")
+	for name := range names {
+		assert.NotContains(t, name, "storage_bigquery_")
+	}
+
+	// Creating the same metrics again doesn't panic and takes over the registered ones.
+	assert.NotPanics(t, func() {
+		m = newMetrics(reg, metricfactory.Factory{Namespace: "prombq", ConstLabels: prometheus.Labels{"env": "test"}})
+	})
+	assert.Equal(t, 3.0, counterValue(m.receivedSamples), "the registered metrics are kept")
+}
+
+// histogramBounds returns the upper bounds of the buckets of the gathered histogram.
+func histogramBounds(t *testing.T, reg prometheus.Gatherer, name string) []float64 {
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		var bounds []float64
+		for _, b := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			bounds = append(bounds, b.GetUpperBound())
+		}
+		return bounds
+	}
+	t.Fatalf("histogram %s wasn't gathered", name)
+	return nil
+}
+
+func TestNewMetricsBuckets(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newMetrics(reg, metricfactory.Factory{Namespace: "prombq", WriteDurationBuckets: []float64{0.005, 0.05}, ReadDurationBuckets: []float64{1, 60, 300}})
+	m.writeProcessingDuration.WithLabelValues("bigquerydb", "").Observe(0.01)
+	m.sentBatchDuration.WithLabelValues("bigquerydb", "").Observe(0.01)
+	m.readProcessingDuration.WithLabelValues("bigquerydb", "").Observe(120)
+	m.httpRequestDuration.WithLabelValues("read").Observe(120)
+
+	assert.Equal(t, []float64{0.005, 0.05}, histogramBounds(t, reg, "prombq_write_api_seconds"))
+	assert.Equal(t, []float64{0.005, 0.05}, histogramBounds(t, reg, "prombq_sent_batch_duration_seconds"))
+	assert.Equal(t, []float64{1, 60, 300}, histogramBounds(t, reg, "prombq_read_api_seconds"))
+	assert.Equal(t, []float64{1, 60, 300}, histogramBounds(t, reg, "http_request_duration_seconds"))
+
+	reg = prometheus.NewRegistry()
+	m = newMetrics(reg, metricfactory.Default())
+	m.readProcessingDuration.WithLabelValues("bigquerydb", "").Observe(120)
+	assert.Equal(t, metricfactory.DefaultReadDurationBuckets, histogramBounds(t, reg, "storage_bigquery_read_api_seconds"))
+}
+
+func TestBucketFlags(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, metricfactory.DefaultWriteDurationBuckets, cfg.metricFactory.WriteBuckets())
+	assert.Equal(t, metricfactory.DefaultReadDurationBuckets, cfg.metricFactory.ReadBuckets())
+
+	cfg, err = load("--metrics.write-duration-buckets=0.001, 0.01,0.1", "--metrics.read-duration-buckets=1,60,600")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.001, 0.01, 0.1}, cfg.metricFactory.WriteDurationBuckets)
+	assert.Equal(t, []float64{1, 60, 600}, cfg.metricFactory.ReadDurationBuckets)
+
+	_, err = load("--metrics.read-duration-buckets=1,1m")
+	assert.EqualError(t, err, `invalid metrics.read-duration-buckets "1,1m", expected a comma-separated list of numbers`)
+	_, err = load("--metrics.write-duration-buckets=1,0.5")
+	assert.EqualError(t, err, "invalid write duration buckets: 0.5 isn't greater than 1, the upper bounds must be increasing")
+	_, err = load("--metrics.write-duration-buckets=")
+	assert.Error(t, err)
+}
+
+// histogramOf returns the state of a histogram of a vector.
+func histogramOf(o prometheus.Observer) *dto.Histogram {
+	var out dto.Metric
+	if err := o.(prometheus.Metric).Write(&out); err != nil {
+		panic(err)
+	}
+	return out.Histogram
+}
+
+// bucketCounts returns the cumulative counts of the buckets of the histogram by their upper bound.
+func bucketCounts(h *dto.Histogram) map[float64]uint64 {
+	counts := map[float64]uint64{}
+	for _, b := range h.GetBucket() {
+		counts[b.GetUpperBound()] = b.GetCumulativeCount()
+	}
+	return counts
+}
+
+func TestWriteRequestSizeMetrics(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll})
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}})
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+	// The long label value compresses to less than 1 KiB and decompresses to about 10 KiB.
+	large := testSeries("up", "path", strings.Repeat("a", 10000))
+	large.Samples = []prompb.Sample{sample, sample, sample}
+	body := writeRequestBody(t, large, seriesWithSamples("up", "api", sample), seriesWithSamples("up", "web", sample))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", body))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	compressed := histogramOf(cfg.metrics.requestBytes.WithLabelValues("write"))
+	assert.Equal(t, uint64(1), compressed.GetSampleCount())
+	assert.Equal(t, float64(body.Size()), compressed.GetSampleSum())
+	assert.Equal(t, uint64(1), bucketCounts(compressed)[1024])
+	decompressed := bucketCounts(histogramOf(cfg.metrics.requestDecodedBytes.WithLabelValues("write")))
+	assert.Equal(t, uint64(0), decompressed[4096])
+	assert.Equal(t, uint64(1), decompressed[16384])
+
+	series := histogramOf(cfg.metrics.writeRequestSeries.WithLabelValues("write"))
+	assert.Equal(t, 3.0, series.GetSampleSum())
+	assert.Equal(t, uint64(0), bucketCounts(series)[1])
+	assert.Equal(t, uint64(1), bucketCounts(series)[4])
+	samples := histogramOf(cfg.metrics.writeRequestSamples.WithLabelValues("write"))
+	assert.Equal(t, 5.0, samples.GetSampleSum())
+	assert.Equal(t, uint64(0), bucketCounts(samples)[4])
+	assert.Equal(t, uint64(1), bucketCounts(samples)[16])
+	assert.Zero(t, histogramOf(cfg.metrics.requestBytes.WithLabelValues("read")).GetSampleCount())
+}
+
+func TestReadResponseSizeMetrics(t *testing.T) {
+	cfg := testConfig(&Config{readTargetPolicy: policyAll})
+	handler := readHandler(*promslog.NewNopLogger(), cfg, []reader{&mockReader{name: "bigquerydb", resp: readResponse(
+		seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}),
+	)}})
+
+	rec := httptest.NewRecorder()
+	body := readRequestBody(t)
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", body))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(body.Size()), histogramOf(cfg.metrics.requestBytes.WithLabelValues("read")).GetSampleSum())
+	assert.Equal(t, uint64(1), histogramOf(cfg.metrics.requestDecodedBytes.WithLabelValues("read")).GetSampleCount())
+	responses := histogramOf(cfg.metrics.readResponseBytes)
+	assert.Equal(t, uint64(1), responses.GetSampleCount())
+	assert.Equal(t, float64(rec.Body.Len()), responses.GetSampleSum())
+	assert.Equal(t, uint64(1), bucketCounts(responses)[1024])
+	sum := responses.GetSampleSum()
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, streamedReadRequest(t, 1, 0)))))
+	assert.Equal(t, streamedContentType, rec.Header().Get("Content-Type"))
+	responses = histogramOf(cfg.metrics.readResponseBytes)
+	assert.Equal(t, uint64(2), responses.GetSampleCount())
+	assert.Equal(t, float64(rec.Body.Len()), responses.GetSampleSum()-sum, "streamed responses are counted as written")
+}
+
+func TestReadQueryLimitFlags(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.readMaxQueries)
+	assert.Equal(t, 10*time.Second, cfg.readQueueTimeout)
+
+	cfg, err = load("--read.max-concurrent-queries=8", "--read.queue-timeout=0")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, cfg.readMaxQueries)
+	assert.Zero(t, cfg.readQueueTimeout)
+
+	_, err = load("--read.max-concurrent-queries=-1")
+	assert.EqualError(t, err, "read.max-concurrent-queries and read.queue-timeout must not be negative")
+}
+
+func TestReadSplitIntervalFlag(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.readSplitInterval)
+
+	cfg, err = load("--read.split-interval=24h")
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, cfg.readSplitInterval)
+
+	_, err = load("--read.split-interval=-1h")
+	assert.EqualError(t, err, "read.split-interval must not be negative")
+}
+
+func TestWriteMethodFlag(t *testing.T) {
+	load := func(flags ...string) (*Config, error) {
+		cfg, _, err := loadConfig(append([]string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"}, flags...))
+		return cfg, err
+	}
+	cfg, err := load()
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.WriteMethodStreaming, cfg.writeMethod)
+
+	cfg, err = load("--bigquery.write-method=load-job", "--write.load-job-location=gs://bucket/staging", "--write.load-job-interval=1m")
+	assert.NoError(t, err)
+	assert.Equal(t, bigquerydb.WriteMethodLoadJob, cfg.writeMethod)
+	assert.Equal(t, "gs://bucket/staging", cfg.loadJobLocation)
+	assert.Equal(t, time.Minute, cfg.loadJobInterval)
+	assert.EqualValues(t, 64<<20, cfg.loadJobMaxBytes)
+
+	_, err = load("--bigquery.write-method=load-job")
+	assert.ErrorContains(t, err, "invalid write.load-job-location")
+	_, err = load("--bigquery.write-method=load-job", "--write.load-job-location=gs://bucket", "--write.load-job-interval=0s")
+	assert.EqualError(t, err, "write.load-job-max-bytes and write.load-job-interval must be positive")
+	_, err = load("--bigquery.write-method=load-job", "--write.load-job-location=gs://bucket", "--bigquery.date-sharding=daily")
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
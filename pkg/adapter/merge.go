@@ -0,0 +1,84 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"math"
+	"sort"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// mergeReadResponses merges the responses of several readers into one. Series with
+// the same labels are combined into a single series, whose samples are sorted by
+// timestamp with exact duplicates dropped.
+func mergeReadResponses(resps []*prompb.ReadResponse) *prompb.ReadResponse {
+	if len(resps) == 1 {
+		return resps[0]
+	}
+	merged := &prompb.ReadResponse{}
+	var series []map[model.Fingerprint]*prompb.TimeSeries
+	for _, resp := range resps {
+		if resp == nil {
+			continue
+		}
+		for i, result := range resp.Results {
+			for len(merged.Results) <= i {
+				merged.Results = append(merged.Results, &prompb.QueryResult{})
+				series = append(series, map[model.Fingerprint]*prompb.TimeSeries{})
+			}
+			for _, ts := range result.Timeseries {
+				fp := labelsFingerprint(ts.Labels)
+				m, ok := series[i][fp]
+				if !ok {
+					m = &prompb.TimeSeries{Labels: ts.Labels}
+					series[i][fp] = m
+					merged.Results[i].Timeseries = append(merged.Results[i].Timeseries, m)
+				}
+				m.Samples = append(m.Samples, ts.Samples...)
+			}
+		}
+	}
+
+	for _, result := range merged.Results {
+		for _, ts := range result.Timeseries {
+			ts.Samples = sortSamples(ts.Samples)
+		}
+	}
+	return merged
+}
+
+func labelsFingerprint(labels []*prompb.Label) model.Fingerprint {
+	metric := make(model.Metric, len(labels))
+	for _, l := range labels {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric.Fingerprint()
+}
+
+// sortSamples sorts the samples by timestamp and drops exact duplicates. Values are compared
+// by their bits, so that duplicate staleness markers, which are NaN, are dropped too.
+func sortSamples(samples []prompb.Sample) []prompb.Sample {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+	n := 0
+	for i, s := range samples {
+		if i > 0 && s.Timestamp == samples[n-1].Timestamp && math.Float64bits(s.Value) == math.Float64bits(samples[n-1].Value) {
+			continue
+		}
+		samples[n] = s
+		n++
+	}
+	return samples[:n]
+}
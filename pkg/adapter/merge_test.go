@@ -0,0 +1,234 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// mockReader returns resp or fails with err.
+type mockReader struct {
+	name string
+	resp *prompb.ReadResponse
+	err  error
+}
+
+func (m *mockReader) Read(context.Context, *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	return m.resp, m.err
+}
+
+func (m *mockReader) Name() string {
+	return m.name
+}
+
+func seriesWithSamples(name string, job string, samples ...prompb.Sample) *prompb.TimeSeries {
+	ts := testSeries(name, "job", job)
+	ts.Samples = samples
+	return ts
+}
+
+func readResponse(timeseries ...*prompb.TimeSeries) *prompb.ReadResponse {
+	return &prompb.ReadResponse{Results: []*prompb.QueryResult{{Timeseries: timeseries}}}
+}
+
+// twoReaders returns readers of a hot and an archive table with overlapping and disjoint series.
+func twoReaders() (*mockReader, *mockReader) {
+	hot := &mockReader{name: "hot", resp: readResponse(
+		seriesWithSamples("up", "api", prompb.Sample{Timestamp: 3000, Value: 1}, prompb.Sample{Timestamp: 4000, Value: 1}),
+		seriesWithSamples("up", "web", prompb.Sample{Timestamp: 3000, Value: 0}),
+	)}
+	archive := &mockReader{name: "archive", resp: readResponse(
+		seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}, prompb.Sample{Timestamp: 3000, Value: 1}),
+		seriesWithSamples("up", "db", prompb.Sample{Timestamp: 1000, Value: 1}),
+	)}
+	return hot, archive
+}
+
+func TestMergeReadResponses(t *testing.T) {
+	hot, archive := twoReaders()
+	resp := mergeReadResponses([]*prompb.ReadResponse{hot.resp, archive.resp})
+
+	assert.Len(t, resp.Results, 1)
+	samples := map[string][]prompb.Sample{}
+	for _, ts := range resp.Results[0].Timeseries {
+		samples[ts.Labels[1].Value] = ts.Samples
+	}
+	assert.Equal(t, map[string][]prompb.Sample{
+		"api": {{Timestamp: 1000, Value: 1}, {Timestamp: 3000, Value: 1}, {Timestamp: 4000, Value: 1}},
+		"web": {{Timestamp: 3000, Value: 0}},
+		"db":  {{Timestamp: 1000, Value: 1}},
+	}, samples)
+}
+
+func readRequestBody(t *testing.T) *bytes.Reader {
+	data, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{StartTimestampMs: 0, EndTimestampMs: 5000}}})
+	assert.NoError(t, err)
+	return bytes.NewReader(snappy.Encode(nil, data))
+}
+
+func decodeReadResponse(t *testing.T, body []byte) *prompb.ReadResponse {
+	data, err := snappy.Decode(nil, body)
+	assert.NoError(t, err)
+	var resp prompb.ReadResponse
+	assert.NoError(t, proto.Unmarshal(data, &resp))
+	return &resp
+}
+
+func TestReadHandlerMerge(t *testing.T) {
+	hot, archive := twoReaders()
+	handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{hot, archive})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, decodeReadResponse(t, rec.Body.Bytes()).Results[0].Timeseries, 3)
+}
+
+func TestReadHandlerPartialFailure(t *testing.T) {
+	testCases := map[string]struct {
+		policy   string
+		err      error
+		expected int
+	}{
+		"all":       {policy: policyAll, err: errors.New("boom"), expected: http.StatusInternalServerError},
+		"all_limit": {policy: policyAll, err: errors.Wrap(bigquerydb.ErrLimitExceeded, "too many rows"), expected: http.StatusUnprocessableEntity},
+		"any":       {policy: policyAny, err: errors.New("boom"), expected: http.StatusOK},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			hot, archive := twoReaders()
+			archive.resp, archive.err = nil, testCase.err
+			handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: testCase.policy}), []reader{hot, archive})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+
+			assert.Equal(t, testCase.expected, rec.Code)
+			if testCase.expected == http.StatusOK {
+				assert.Len(t, decodeReadResponse(t, rec.Body.Bytes()).Results[0].Timeseries, 2)
+			}
+		})
+	}
+}
+
+func TestReadHandlerErrorClasses(t *testing.T) {
+	testCases := map[string]struct {
+		err       error
+		expected  int
+		retryable bool
+	}{
+		"bad_request":    {err: errors.Wrap(bigquerydb.ErrBadRequest, "unknown match type 7"), expected: http.StatusBadRequest},
+		"limit":          {err: errors.Wrap(bigquerydb.ErrLimitExceeded, "range too long"), expected: http.StatusUnprocessableEntity},
+		"quota_exceeded": {err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, expected: http.StatusTooManyRequests, retryable: true},
+		"circuit_open":   {err: &bigquerydb.CircuitOpenError{RetryAfter: 10 * time.Second}, expected: http.StatusServiceUnavailable, retryable: true},
+		"queue_timeout":  {err: &bigquerydb.QueryQueueTimeoutError{MaxQueries: 4, RetryAfter: 10 * time.Second}, expected: http.StatusServiceUnavailable, retryable: true},
+		"backend_error":  {err: &googleapi.Error{Code: http.StatusServiceUnavailable}, expected: http.StatusServiceUnavailable, retryable: true},
+		"other":          {err: errors.New("boom"), expected: http.StatusInternalServerError, retryable: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{&mockReader{name: "bigquerydb", err: testCase.err}})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+
+			assert.Equal(t, testCase.expected, rec.Code)
+			assert.Equal(t, testCase.retryable, rec.Code == http.StatusTooManyRequests || rec.Code >= 500, "only retryable errors return 429 or 5xx")
+			assert.Contains(t, rec.Body.String(), testCase.err.Error())
+		})
+	}
+}
+
+func TestWriteHandlerErrorClasses(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected int
+	}{
+		"too_old":        {err: &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{errors.Wrap(bigquerydb.ErrSampleTooOld, "sample of up")}}, expected: http.StatusBadRequest},
+		"no_tenant":      {err: bigquerydb.ErrNoTenant, expected: http.StatusBadRequest},
+		"quota_exceeded": {err: quotaError("quotaExceeded"), expected: http.StatusTooManyRequests},
+		"queue_full":     {err: &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{bigquerydb.ErrQueueFull}}, expected: http.StatusServiceUnavailable},
+		"timeout":        {err: errors.Wrap(context.DeadlineExceeded, "insert timeout of 10s exceeded"), expected: http.StatusServiceUnavailable},
+		"other":          {err: errors.New("boom"), expected: http.StatusInternalServerError},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll}), []writer{&mockWriter{name: "bigquerydb", err: testCase.err}})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "node", prompb.Sample{Timestamp: 1000, Value: 1}))))
+
+			assert.Equal(t, testCase.expected, rec.Code)
+			assert.Contains(t, rec.Body.String(), testCase.err.Error())
+		})
+	}
+}
+
+func TestReadHandlerAllReadersFailed(t *testing.T) {
+	hot, archive := twoReaders()
+	hot.resp, hot.err = nil, errors.New("boom")
+	archive.resp, archive.err = nil, errors.New("boom")
+	handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAny}), []reader{hot, archive})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestReadHandlerDurationPerReader(t *testing.T) {
+	cfg := testConfig(&Config{readTargetPolicy: policyAny})
+	durationCount := func(remote string) float64 {
+		value, _ := gatheredValue(t, cfg, "storage_bigquery_read_api_seconds", map[string]string{"remote": remote, "tenant": ""})
+		return value
+	}
+	hot, archive := twoReaders()
+	hot.name, archive.name = "duration-hot", "duration-archive"
+	archive.resp, archive.err = nil, errors.New("boom")
+	hotBefore, archiveBefore := durationCount(hot.name), durationCount(archive.name)
+	handler := readHandler(*promslog.NewNopLogger(), cfg, []reader{archive, hot})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, hotBefore+1, durationCount(hot.name), "the reader which served the request is observed")
+	assert.Equal(t, archiveBefore, durationCount(archive.name))
+}
+
+func TestReadHandlerWithoutReaders(t *testing.T) {
+	rec := httptest.NewRecorder()
+	readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), nil)(rec,
+		httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// metadataReader is implemented by readers which can look up label values and series.
+type metadataReader interface {
+	LabelValues(ctx context.Context, name string, q *prompb.Query) ([]string, error)
+	Series(ctx context.Context, q *prompb.Query) ([][]*prompb.Label, error)
+	Name() string
+}
+
+// apiResponse is the JSON envelope of successful responses of the Prometheus API.
+type apiResponse struct {
+	Status   string      `json:"status"`
+	Data     interface{} `json:"data"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// labelValuesHandler answers /api/v1/label/<name>/values requests with the values of the
+// label among the series matching the match[] selectors, or all series without one, in
+// the time range of start and end.
+func labelValuesHandler(logger slog.Logger, cfg *Config, readers []reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/label/"), "/values")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		serveMetadata(w, r, logger, cfg, readers, "label_values", false, func(ctx context.Context, rd metadataReader, q *prompb.Query) ([]string, error) {
+			return rd.LabelValues(ctx, name, q)
+		}, func(values []string) interface{} {
+			return values
+		})
+	}
+}
+
+// seriesHandler answers /api/v1/series requests with the label sets of the series matching
+// the match[] selectors in the time range of start and end.
+func seriesHandler(logger slog.Logger, cfg *Config, readers []reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveMetadata(w, r, logger, cfg, readers, "series", true, func(ctx context.Context, rd metadataReader, q *prompb.Query) ([]string, error) {
+			series, err := rd.Series(ctx, q)
+			if err != nil {
+				return nil, err
+			}
+			// The series are merged as their JSON, which is sorted by label name.
+			encoded := make([]string, 0, len(series))
+			for _, labels := range series {
+				metric := make(map[string]string, len(labels))
+				for _, l := range labels {
+					metric[l.Name] = l.Value
+				}
+				b, err := json.Marshal(metric)
+				if err != nil {
+					return nil, err
+				}
+				encoded = append(encoded, string(b))
+			}
+			return encoded, nil
+		}, func(series []string) interface{} {
+			data := make([]json.RawMessage, 0, len(series))
+			for _, s := range series {
+				data = append(data, json.RawMessage(s))
+			}
+			return data
+		})
+	}
+}
+
+// serveMetadata runs the lookup with the query of every match[] selector on all readers
+// which support it, and answers with the sorted union of the results converted by data.
+// Like reads, a failed reader fails the request unless read.target-policy is any and
+// another one succeeded, in which case its error is returned as warning.
+func serveMetadata(w http.ResponseWriter, r *http.Request, logger slog.Logger, cfg *Config, readers []reader, api string, requireMatch bool,
+	lookup func(ctx context.Context, rd metadataReader, q *prompb.Query) ([]string, error), data func([]string) interface{}) {
+	logger.DebugContext(r.Context(), "metadata request received", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+	cfg = cfg.current()
+	reply := jsonError(cfg)
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		reply(w, errors.New("only GET and POST are allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, _, ok := requestTenant(w, r, cfg, api, reply)
+	if !ok {
+		return
+	}
+	queries, err := metadataQueries(r, requireMatch, time.Now())
+	if err != nil {
+		reply(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var metadataReaders []metadataReader
+	for _, rd := range readers {
+		if mr, ok := rd.(metadataReader); ok {
+			metadataReaders = append(metadataReaders, mr)
+		}
+	}
+	if len(metadataReaders) == 0 {
+		reply(w, errNoStorage, http.StatusInternalServerError)
+		return
+	}
+
+	results := map[string]struct{}{}
+	errs := make([]error, 0, len(metadataReaders))
+	var warnings []string
+	for _, rd := range metadataReaders {
+		err := func() error {
+			for _, q := range queries {
+				values, err := lookup(ctx, rd, q)
+				if err != nil {
+					return err
+				}
+				for _, v := range values {
+					results[v] = struct{}{}
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			logger.WarnContext(ctx, "error executing metadata query", slog.String("api", api), slog.Any("storage", rd.Name()), slog.Any("error", err))
+			warnings = append(warnings, fmt.Sprintf("%s: %v", rd.Name(), err))
+		}
+		errs = append(errs, err)
+	}
+	if len(warnings) > 0 && (cfg.readTargetPolicy != policyAny || len(warnings) == len(metadataReaders)) {
+		status, err := errorStatus(errs)
+		setErrorRetryAfter(w, err)
+		reply(w, err, status)
+		return
+	}
+
+	sorted := make([]string, 0, len(results))
+	for v := range results {
+		sorted = append(sorted, v)
+	}
+	sort.Strings(sorted)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(apiResponse{Status: "success", Data: data(sorted), Warnings: warnings}); err != nil {
+		logger.WarnContext(ctx, "error writing response", slog.Any("error", err))
+	}
+}
+
+// metadataQueries returns a query for every match[] selector of the request, or a single
+// query without matchers if there is none and none is required, in the time range of the
+// start and end parameters. The end defaults to now and the start to the beginning of time,
+// which read.max-range may limit.
+func metadataQueries(r *http.Request, requireMatch bool, now time.Time) ([]*prompb.Query, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, errors.Wrap(err, "invalid parameters")
+	}
+	var start, end int64 = 0, now.UnixMilli()
+	var err error
+	if s := r.Form.Get("start"); s != "" {
+		if start, err = parseExportTime(s); err != nil {
+			return nil, errors.Wrap(err, "invalid start")
+		}
+	}
+	if s := r.Form.Get("end"); s != "" {
+		if end, err = parseExportTime(s); err != nil {
+			return nil, errors.Wrap(err, "invalid end")
+		}
+	}
+	if end < start {
+		return nil, errors.New("end must not be before start")
+	}
+
+	selectors := r.Form["match[]"]
+	if len(selectors) == 0 {
+		if requireMatch {
+			return nil, errors.New("no match[] parameter provided")
+		}
+		return []*prompb.Query{{StartTimestampMs: start, EndTimestampMs: end}}, nil
+	}
+	queries := make([]*prompb.Query, 0, len(selectors))
+	for _, s := range selectors {
+		matchers, err := parseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, &prompb.Query{StartTimestampMs: start, EndTimestampMs: end, Matchers: matchers})
+	}
+	return queries, nil
+}
+
+// parseSelector parses a PromQL series selector like up{job="api", instance=~"a.*"} into
+// its matchers. The metric name and the braces are both optional, but not both.
+func parseSelector(selector string) ([]*prompb.LabelMatcher, error) {
+	s := strings.TrimSpace(selector)
+	name, body, braces := strings.Cut(s, "{")
+	name = strings.TrimSpace(name)
+	var matchers []*prompb.LabelMatcher
+	if name != "" {
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return nil, errors.Errorf("invalid metric name %q in selector %q", name, selector)
+		}
+		matchers = append(matchers, &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: model.MetricNameLabel, Value: name})
+	}
+	if braces {
+		var ok bool
+		if body, ok = strings.CutSuffix(body, "}"); !ok {
+			return nil, errors.Errorf("selector %q has no closing brace", selector)
+		}
+		for body = strings.TrimSpace(body); body != ""; {
+			m, rest, err := parseSelectorMatcher(body)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid selector %q", selector)
+			}
+			matchers = append(matchers, m)
+			rest = strings.TrimSpace(rest)
+			if rest != "" && rest[0] != ',' {
+				return nil, errors.Errorf("invalid selector %q: expected , or } after the matcher of %s", selector, m.Name)
+			}
+			body = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+		}
+	}
+	if len(matchers) == 0 {
+		return nil, errors.Errorf("selector %q has no matchers", selector)
+	}
+	return matchers, nil
+}
+
+// parseSelectorMatcher parses the matcher at the start of s and returns it with the rest of s.
+func parseSelectorMatcher(s string) (*prompb.LabelMatcher, string, error) {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	name := s[:end]
+	if !model.LabelName(name).IsValid() {
+		return nil, "", errors.Errorf("invalid label name at %q", s)
+	}
+	s = strings.TrimSpace(s[end:])
+
+	typ, op := prompb.LabelMatcher_EQ, ""
+	for _, candidate := range []struct {
+		op  string
+		typ prompb.LabelMatcher_Type
+	}{
+		{op: "=~", typ: prompb.LabelMatcher_RE},
+		{op: "!~", typ: prompb.LabelMatcher_NRE},
+		{op: "!=", typ: prompb.LabelMatcher_NEQ},
+		{op: "=", typ: prompb.LabelMatcher_EQ},
+	} {
+		if strings.HasPrefix(s, candidate.op) {
+			typ, op = candidate.typ, candidate.op
+			break
+		}
+	}
+	if op == "" {
+		return nil, "", errors.Errorf("matcher of %s has no operator, must be one of =, !=, =~, !~", name)
+	}
+	s = strings.TrimSpace(s[len(op):])
+
+	value, rest, err := unquoteSelectorValue(s)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "invalid value of %s", name)
+	}
+	return &prompb.LabelMatcher{Type: typ, Name: name, Value: value}, rest, nil
+}
+
+// unquoteSelectorValue returns the value of the string at the start of s, which is quoted
+// with double quotes, single quotes or backticks like in PromQL, and the rest of s.
+func unquoteSelectorValue(s string) (string, string, error) {
+	if strings.HasPrefix(s, "'") {
+		// Single quoted strings have the escapes of double quoted ones.
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '\'':
+				quoted := strings.ReplaceAll(strings.ReplaceAll(s[1:i], `\'`, `'`), `"`, `\"`)
+				value, err := strconv.Unquote(`"` + quoted + `"`)
+				return value, s[i+1:], err
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	}
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil || strings.HasPrefix(quoted, "'") {
+		return "", "", errors.New("expected a quoted string")
+	}
+	value, err := strconv.Unquote(quoted)
+	return value, s[len(quoted):], err
+}
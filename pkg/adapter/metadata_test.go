@@ -0,0 +1,262 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// metadataBackend answers every query with the same rows and records the queries.
+type metadataBackend struct {
+	mu      sync.Mutex
+	rows    []map[string]bigquery.Value
+	err     error
+	queries []*bigquery.Query
+}
+
+func (b *metadataBackend) Read(_ context.Context, query *bigquery.Query) (bigquerydb.QueryIterator, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries = append(b.queries, query)
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &metadataRows{rows: b.rows}, nil
+}
+
+type metadataRows struct {
+	rows []map[string]bigquery.Value
+	pos  int
+}
+
+func (r *metadataRows) Next(dst interface{}) error {
+	if r.pos >= len(r.rows) {
+		return iterator.Done
+	}
+	row := dst.(*map[string]bigquery.Value)
+	for k, v := range r.rows[r.pos] {
+		(*row)[k] = v
+	}
+	r.pos++
+	return nil
+}
+
+func (r *metadataRows) IsAccelerated() bool {
+	return false
+}
+
+// newMetadataClient returns a client whose queries are answered by the backend.
+func newMetadataClient(t *testing.T, backend *metadataBackend, opts ...bigquerydb.Option) *bigquerydb.BigqueryClient {
+	c, err := bigquerydb.NewClient(promslog.NewNopLogger(), "", "project", "dataset", "table", time.Minute,
+		append(opts, bigquerydb.WithEndpoint("http://localhost:9050"), bigquerydb.WithInserter(discardInserter{}), bigquerydb.WithQuerier(backend))...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return c
+}
+
+// getMetadata sends the request to the metadata endpoints and returns the status code
+// and the decoded body.
+func getMetadata(t *testing.T, cfg *Config, readers []reader, target string) (int, map[string]interface{}) {
+	mux := http.NewServeMux()
+	registerHandlers(mux, *promslog.NewNopLogger(), cfg, nil, readers)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	body := map[string]interface{}{}
+	if rec.Code != http.StatusNotFound {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+func metadataConfig(t *testing.T, args ...string) *Config {
+	cfg, err := parseTestFlags(append([]string{"--web.enable-metadata-api"}, args...)...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return cfg
+}
+
+func TestParseSelector(t *testing.T) {
+	eq := func(name, value string) *prompb.LabelMatcher {
+		return &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: name, Value: value}
+	}
+	for selector, expected := range map[string][]*prompb.LabelMatcher{
+		"up":             {eq("__name__", "up")},
+		` up { } `:       {eq("__name__", "up")},
+		`{job="api"}`:    {eq("job", "api")},
+		`up{job="api",}`: {eq("__name__", "up"), eq("job", "api")},
+		`{__name__=~"http_.+", code!="500", path!~'/(a|b)', env=` + "`prod`" + `}`: {
+			{Type: prompb.LabelMatcher_RE, Name: "__name__", Value: "http_.+"},
+			{Type: prompb.LabelMatcher_NEQ, Name: "code", Value: "500"},
+			{Type: prompb.LabelMatcher_NRE, Name: "path", Value: "/(a|b)"},
+			eq("env", "prod"),
+		},
+		`{msg="a \"quoted\" }, value"}`: {eq("msg", `a "quoted" }, value`)},
+		`{msg='it\'s'}`:                 {eq("msg", "it's")},
+	} {
+		matchers, err := parseSelector(selector)
+		assert.NoError(t, err, selector)
+		assert.Equal(t, expected, matchers, selector)
+	}
+
+	for _, selector := range []string{"", "{}", "up{", `{job}`, `{job=api}`, `{job="api" env="prod"}`, `{1job="a"}`, `{job=="a"}`, `{job="a}`, "not-a-metric"} {
+		_, err := parseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+}
+
+func TestLabelValuesEndpoint(t *testing.T) {
+	backend := &metadataBackend{rows: []map[string]bigquery.Value{{"value": "db"}, {"value": "api"}}}
+	readers := []reader{newMetadataClient(t, backend)}
+
+	code, body := getMetadata(t, metadataConfig(t), readers, `/api/v1/label/job/values?match[]=up&match[]={env="prod"}&start=1700000000&end=1700003600`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "success", "data": []interface{}{"api", "db"}}, body)
+	if assert.Len(t, backend.queries, 2, "a query per selector") {
+		query := backend.queries[0]
+		assert.True(t, strings.HasPrefix(query.Q, `SELECT DISTINCT IFNULL(JSON_VALUE(tags, '$."job"'), '') AS value FROM `), query.Q)
+		params := map[string]interface{}{}
+		for _, p := range query.Parameters {
+			params[p.Name] = p.Value
+		}
+		assert.Equal(t, "up", params["m0"])
+		assert.Equal(t, "", params["m1"], "only series with the label")
+		assert.Equal(t, int64(1700000000000), params["start"])
+		assert.Equal(t, int64(1700003600000), params["end"])
+	}
+
+	backend.queries = nil
+	code, _ = getMetadata(t, metadataConfig(t), readers, "/api/v1/label/__name__/values")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, backend.queries, 1) {
+		assert.True(t, strings.HasPrefix(backend.queries[0].Q, "SELECT DISTINCT metricname AS value FROM "), backend.queries[0].Q)
+	}
+
+	code, body = getMetadata(t, metadataConfig(t), readers, "/api/v1/label/job/values?match[]=up{")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "error", body["status"])
+	assert.Equal(t, errorTypeBadData, body["errorType"])
+	code, _ = getMetadata(t, metadataConfig(t), readers, "/api/v1/label/job/other")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestSeriesEndpoint(t *testing.T) {
+	backend := &metadataBackend{rows: []map[string]bigquery.Value{
+		{"metricname": "up", "tags": `{"job":"db"}`},
+		{"metricname": "up", "tags": `{"job":"api","instance":"a"}`},
+	}}
+	readers := []reader{newMetadataClient(t, backend)}
+
+	code, body := getMetadata(t, metadataConfig(t), readers, `/api/v1/series?match[]=up{job=~"api|db"}&start=2023-11-14T22:00:00Z&end=2023-11-14T23:00:00Z`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"status": "success", "data": []interface{}{
+		map[string]interface{}{"__name__": "up", "instance": "a", "job": "api"},
+		map[string]interface{}{"__name__": "up", "job": "db"},
+	}}, body)
+	if assert.Len(t, backend.queries, 1) {
+		assert.True(t, strings.HasPrefix(backend.queries[0].Q, "SELECT DISTINCT metricname, tags FROM "), backend.queries[0].Q)
+	}
+
+	code, body = getMetadata(t, metadataConfig(t), readers, "/api/v1/series")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "no match[] parameter provided", body["error"])
+	code, body = getMetadata(t, metadataConfig(t), readers, "/api/v1/series?match[]=up&start=2&end=1")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "end must not be before start", body["error"])
+}
+
+func TestMetadataEndpointLimits(t *testing.T) {
+	backend := &metadataBackend{rows: []map[string]bigquery.Value{{"value": "api"}}}
+	readers := []reader{newMetadataClient(t, backend, bigquerydb.WithReadLimits(bigquerydb.ReadLimits{
+		RequireMetricName: true,
+		MaxRange:          time.Hour,
+		MaxRangeBehavior:  bigquerydb.RangeLimitReject,
+	}))}
+	cfg := metadataConfig(t)
+
+	for target, limit := range map[string]string{
+		"/api/v1/label/job/values?start=1700000000&end=1700000060":                       "metric_name",
+		"/api/v1/label/job/values?match[]=up":                                            "range",
+		`/api/v1/series?match[]={job="api"}&start=1700000000&end=1700000060`:             "metric_name",
+		"/api/v1/series?match[]=up&start=1700000000&end=1700007200":                      "range",
+		"/api/v1/label/__name__/values?match[]={__name__=~\".+\"}&start=1700000000&end=": "range",
+	} {
+		backend.queries = nil
+		code, body := getMetadata(t, cfg, readers, target)
+		assert.Equal(t, http.StatusUnprocessableEntity, code, target)
+		assert.Equal(t, errorTypeBadData, body["errorType"], target)
+		details, _ := body["details"].(map[string]interface{})
+		assert.Equal(t, limit, details["limit"], target)
+		assert.NotEmpty(t, details["query"], target)
+		assert.NotContains(t, details, "sql", "only with debug reads")
+		assert.Empty(t, backend.queries, "%s is rejected before it runs", target)
+	}
+
+	billed := &metadataBackend{err: &bigquery.Error{Reason: "bytesBilledLimitExceeded", Message: "Query exceeded limit for bytes billed: 1000."}}
+	readers = []reader{newMetadataClient(t, billed, bigquerydb.WithMaxBytesBilled(1000))}
+	code, body := getMetadata(t, cfg, readers, "/api/v1/series?match[]=up&start=1700000000&end=1700000060")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "bytes_billed", body["details"].(map[string]interface{})["limit"])
+	if assert.Len(t, billed.queries, 1) {
+		assert.Equal(t, int64(1000), billed.queries[0].MaxBytesBilled)
+	}
+}
+
+func TestMetadataEndpointTargetPolicy(t *testing.T) {
+	ok := newMetadataClient(t, &metadataBackend{rows: []map[string]bigquery.Value{{"value": "api"}}})
+	failing := newMetadataClient(t, &metadataBackend{err: &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "boom"}})
+	readers := []reader{ok, failing, &mockReader{name: "noop"}}
+
+	code, body := getMetadata(t, metadataConfig(t), readers, "/api/v1/label/job/values")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "error", body["status"])
+
+	code, body = getMetadata(t, metadataConfig(t, "--read.target-policy=any"), readers, "/api/v1/label/job/values")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"api"}, body["data"])
+	assert.Len(t, body["warnings"], 1)
+
+	code, _ = getMetadata(t, metadataConfig(t), []reader{&mockReader{name: "noop"}}, "/api/v1/label/job/values")
+	assert.Equal(t, http.StatusInternalServerError, code, "no reader supports lookups")
+}
+
+func TestMetadataEndpointsDisabledByDefault(t *testing.T) {
+	readers := []reader{newMetadataClient(t, &metadataBackend{})}
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	for _, target := range []string{"/api/v1/label/job/values", "/api/v1/series?match[]=up"} {
+		code, _ := getMetadata(t, cfg, readers, target)
+		assert.Equal(t, http.StatusNotFound, code, target)
+		code, _ = getMetadata(t, metadataConfig(t), readers, target)
+		assert.Equal(t, http.StatusOK, code, target)
+	}
+}
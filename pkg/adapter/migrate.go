@@ -0,0 +1,108 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+)
+
+const (
+	migrateText = "text"
+	migrateJSON = "json"
+)
+
+// migrator plans and applies the migration of a table. It is implemented by
+// *bigquerydb.BigqueryClient.
+type migrator interface {
+	Migrate(ctx context.Context, apply bool) (*bigquerydb.MigrationPlan, error)
+}
+
+// runMigrate plans the migration of every table, applies them with migrate --apply, and
+// writes the plans to out. It fails if a table has differences which can't be applied in
+// place, after all plans were written.
+func runMigrate(ctx context.Context, logger slog.Logger, cfg *Config, out io.Writer, migrators []migrator) error {
+	plans := make([]*bigquerydb.MigrationPlan, 0, len(migrators))
+	for _, m := range migrators {
+		plan, err := m.Migrate(ctx, cfg.migrateApply)
+		if err != nil {
+			return err
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := writeMigrationPlans(out, cfg.migrateOutput, plans); err != nil {
+		return errors.Wrap(err, "failed to write the migration plan")
+	}
+	var incompatible []string
+	for _, plan := range plans {
+		if len(plan.Incompatible) > 0 {
+			incompatible = append(incompatible, plan.Table)
+		}
+	}
+	logger.Info("migration completed", slog.Bool("applied", cfg.migrateApply), slog.Int("tables", len(plans)), slog.Any("incompatible", incompatible))
+	if len(incompatible) > 0 {
+		return errors.Errorf("tables %v have differences which can't be applied in place", incompatible)
+	}
+	return nil
+}
+
+// writeMigrationPlans writes the plans as JSON array, or as text for people.
+func writeMigrationPlans(out io.Writer, format string, plans []*bigquerydb.MigrationPlan) error {
+	if format == migrateJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plans)
+	}
+	for _, plan := range plans {
+		var lines []string
+		switch {
+		case plan.UpToDate():
+			lines = append(lines, "up to date")
+		case plan.Applied:
+			lines = append(lines, "added columns:")
+		case len(plan.Add) > 0 && len(plan.Incompatible) > 0:
+			lines = append(lines, "columns to add, once the incompatible differences are resolved:")
+		case len(plan.Add) > 0:
+			lines = append(lines, "columns to add, run with --apply to add them:")
+		}
+		for _, column := range plan.Add {
+			lines = append(lines, fmt.Sprintf("  + %s %s", column.Name, column.Type))
+		}
+		if len(plan.Incompatible) > 0 {
+			lines = append(lines, "incompatible differences, which need the table to be recreated:")
+			for _, difference := range plan.Incompatible {
+				lines = append(lines, "  ! "+difference)
+			}
+		}
+		for _, note := range plan.Notes {
+			lines = append(lines, "note: "+note)
+		}
+		if _, err := fmt.Fprintf(out, "table %s:\n", plan.Table); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(out, "  "+line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
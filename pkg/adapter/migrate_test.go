@@ -0,0 +1,117 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMigrator struct {
+	plan    bigquerydb.MigrationPlan
+	err     error
+	applies []bool
+}
+
+func (m *fakeMigrator) Migrate(ctx context.Context, apply bool) (*bigquerydb.MigrationPlan, error) {
+	m.applies = append(m.applies, apply)
+	if m.err != nil {
+		return nil, m.err
+	}
+	plan := m.plan
+	plan.Applied = apply && len(plan.Add) > 0 && len(plan.Incompatible) == 0
+	return &plan, nil
+}
+
+func TestRunMigrateText(t *testing.T) {
+	current := &fakeMigrator{plan: bigquerydb.MigrationPlan{Table: "dataset.current"}}
+	missing := &fakeMigrator{plan: bigquerydb.MigrationPlan{
+		Table: "dataset.missing",
+		Add:   []bigquerydb.MigrationColumn{{Name: "series_hash", Type: "INT64"}},
+		Notes: []string{"the table isn't partitioned, every read scans the whole table"},
+	}}
+	cfg := &Config{migrateOutput: migrateText}
+
+	var out bytes.Buffer
+	assert.NoError(t, runMigrate(context.Background(), *promslog.NewNopLogger(), cfg, &out, []migrator{current, missing}))
+	assert.Equal(t, `table dataset.current:
+  up to date
+table dataset.missing:
+  columns to add, run with --apply to add them:
+    + series_hash INT64
+  note: the table isn't partitioned, every read scans the whole table
+`, out.String())
+	assert.Equal(t, []bool{false}, missing.applies)
+
+	cfg.migrateApply = true
+	out.Reset()
+	assert.NoError(t, runMigrate(context.Background(), *promslog.NewNopLogger(), cfg, &out, []migrator{missing}))
+	assert.Contains(t, out.String(), "  added columns:\n    + series_hash INT64\n")
+	assert.Equal(t, []bool{false, true}, missing.applies)
+}
+
+func TestRunMigrateJSON(t *testing.T) {
+	m := &fakeMigrator{plan: bigquerydb.MigrationPlan{
+		Table:        "dataset.table",
+		Add:          []bigquerydb.MigrationColumn{{Name: "special_value", Type: "STRING"}},
+		Incompatible: []string{"column value: expected FLOAT64, found STRING"},
+	}}
+	cfg := &Config{migrateOutput: migrateJSON, migrateApply: true}
+
+	var out bytes.Buffer
+	err := runMigrate(context.Background(), *promslog.NewNopLogger(), cfg, &out, []migrator{m})
+	assert.EqualError(t, err, "tables [dataset.table] have differences which can't be applied in place")
+	var plans []bigquerydb.MigrationPlan
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &plans), "the plan is written before failing")
+	if assert.Len(t, plans, 1) {
+		assert.Equal(t, m.plan.Add, plans[0].Add)
+		assert.Equal(t, m.plan.Incompatible, plans[0].Incompatible)
+		assert.False(t, plans[0].Applied)
+	}
+}
+
+func TestRunMigrateError(t *testing.T) {
+	failing := &fakeMigrator{err: errors.New("table dataset.table doesn't exist")}
+	next := &fakeMigrator{}
+	var out bytes.Buffer
+	err := runMigrate(context.Background(), *promslog.NewNopLogger(), &Config{migrateOutput: migrateText}, &out, []migrator{failing, next})
+	assert.EqualError(t, err, "table dataset.table doesn't exist")
+	assert.Empty(t, next.applies)
+	assert.Empty(t, out.String())
+}
+
+func TestMigrateFlags(t *testing.T) {
+	cfg, err := parseTestFlags("migrate")
+	assert.NoError(t, err)
+	assert.Equal(t, "migrate", cfg.command)
+	assert.False(t, cfg.migrateApply)
+	assert.Equal(t, migrateText, cfg.migrateOutput)
+
+	cfg, err = parseTestFlags("migrate", "--apply", "--output=json")
+	assert.NoError(t, err)
+	assert.True(t, cfg.migrateApply)
+	assert.Equal(t, migrateJSON, cfg.migrateOutput)
+
+	_, err = parseTestFlags("migrate", "--output=yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	storageBigQuery = "bigquery"
+	storageNoop     = "noop"
+)
+
+// errNoopInjected is the error of the writes and reads the noop storage fails.
+var errNoopInjected = errors.New("error injected by the noop storage")
+
+// noopStorage discards the written samples and answers reads with empty results, so that
+// the request path of the adapter can be load tested without BigQuery. Every write and
+// read takes the latency, and fails with the probability errorRate.
+type noopStorage struct {
+	logger    slog.Logger
+	name      string
+	latency   time.Duration
+	errorRate float64
+	// random returns a number in [0, 1) which decides whether a request fails.
+	random  func() float64
+	samples atomic.Int64
+}
+
+func newNoopStorage(logger slog.Logger, name string, latency time.Duration, errorRate float64) *noopStorage {
+	return &noopStorage{logger: logger, name: name, latency: latency, errorRate: errorRate, random: rand.Float64}
+}
+
+// noopClients returns noop storages in place of the clients of the primary table and of
+// the write and read targets.
+func noopClients(logger slog.Logger, cfg *Config) ([]writer, []reader) {
+	primary := newNoopStorage(*logger.With("storage", storageNoop), storageNoop, cfg.noopLatency, cfg.noopErrorRate)
+	writers := []writer{primary}
+	readers := []reader{primary}
+	for _, target := range cfg.writeTargets {
+		writers = append(writers, newNoopStorage(*logger.With("storage", storageNoop, "target", target.name), target.name, cfg.noopLatency, cfg.noopErrorRate))
+	}
+	for _, target := range cfg.readTargets {
+		readers = append(readers, newNoopStorage(*logger.With("storage", storageNoop, "target", target.name), target.name, cfg.noopLatency, cfg.noopErrorRate))
+	}
+	logger.Warn("using the noop storage, written samples are discarded and reads return no series")
+	return writers, readers
+}
+
+// Write counts the samples of the timeseries and discards them.
+func (s *noopStorage) Write(ctx context.Context, timeseries []*prompb.TimeSeries) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	s.samples.Add(int64(countSamples(timeseries)))
+	return nil
+}
+
+// Read answers every query of the request with an empty result.
+func (s *noopStorage) Read(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	resp := &prompb.ReadResponse{Results: make([]*prompb.QueryResult, len(req.Queries))}
+	for i := range resp.Results {
+		resp.Results[i] = &prompb.QueryResult{}
+	}
+	return resp, nil
+}
+
+// wait waits for the latency, and returns errNoopInjected if the request is chosen to fail.
+func (s *noopStorage) wait(ctx context.Context) error {
+	if s.latency > 0 {
+		timer := time.NewTimer(s.latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if s.errorRate > 0 && s.random() < s.errorRate {
+		return errNoopInjected
+	}
+	return nil
+}
+
+// Name identifies the storage in logs and metrics.
+func (s *noopStorage) Name() string {
+	return s.name
+}
+
+// Close logs the number of discarded samples.
+func (s *noopStorage) Close() error {
+	s.logger.Info("noop storage stopped", slog.Int64("discarded_samples", s.samples.Load()))
+	return nil
+}
@@ -0,0 +1,117 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoopStorageLatency(t *testing.T) {
+	s := newNoopStorage(*promslog.NewNopLogger(), storageNoop, 50*time.Millisecond, 0)
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+
+	begin := time.Now()
+	assert.NoError(t, s.Write(context.Background(), []*prompb.TimeSeries{seriesWithSamples("up", "api", sample, sample)}))
+	assert.GreaterOrEqual(t, time.Since(begin), 50*time.Millisecond)
+	assert.Equal(t, int64(2), s.samples.Load())
+
+	begin = time.Now()
+	resp, err := s.Read(context.Background(), &prompb.ReadRequest{Queries: []*prompb.Query{{}, {}}})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(begin), 50*time.Millisecond)
+	assert.Equal(t, []*prompb.QueryResult{{}, {}}, resp.Results, "every query gets an empty result")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	s.latency = time.Minute
+	assert.ErrorIs(t, s.Write(ctx, []*prompb.TimeSeries{seriesWithSamples("up", "api", sample)}), context.DeadlineExceeded)
+	assert.Equal(t, int64(2), s.samples.Load(), "samples of failed writes aren't counted")
+}
+
+func TestNoopStorageErrorRate(t *testing.T) {
+	s := newNoopStorage(*promslog.NewNopLogger(), storageNoop, 0, 0.25)
+	draws := []float64{0.1, 0.25, 0.9}
+	s.random = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	series := []*prompb.TimeSeries{seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1})}
+
+	assert.ErrorIs(t, s.Write(context.Background(), series), errNoopInjected)
+	assert.NoError(t, s.Write(context.Background(), series))
+	_, err := s.Read(context.Background(), &prompb.ReadRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), s.samples.Load())
+
+	s.errorRate = 0
+	s.random = func() float64 {
+		t.Fatal("no draw without an error rate")
+		return 0
+	}
+	assert.NoError(t, s.Write(context.Background(), series))
+}
+
+func TestWriteHandlerNoopStorage(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll, storage: storageNoop, noopErrorRate: 1})
+	writers, readers := noopClients(*promslog.NewNopLogger(), cfg)
+	series := seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1})
+
+	rec := httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), cfg, writers)(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), errNoopInjected.Error())
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.failedSamples.WithLabelValues(storageNoop, "")))
+	rec = httptest.NewRecorder()
+	readHandler(*promslog.NewNopLogger(), cfg, readers)(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	cfg = testConfig(&Config{writeTargetPolicy: policyAll, readTargetPolicy: policyAll, storage: storageNoop})
+	writers, readers = noopClients(*promslog.NewNopLogger(), cfg)
+	rec = httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), cfg, writers)(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1.0, counterValue(cfg.metrics.sentSamples.WithLabelValues(storageNoop, "")))
+	rec = httptest.NewRecorder()
+	readHandler(*promslog.NewNopLogger(), cfg, readers)(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestNoopClientsTargets(t *testing.T) {
+	cfg := testConfig(&Config{
+		storage:      storageNoop,
+		writeTargets: []bigqueryTarget{{name: "archive"}},
+		readTargets:  []bigqueryTarget{{name: "cold"}, {name: "frozen"}},
+	})
+	writers, readers := noopClients(*promslog.NewNopLogger(), cfg)
+	var writerNames, readerNames []string
+	for _, w := range writers {
+		writerNames = append(writerNames, w.Name())
+	}
+	for _, r := range readers {
+		readerNames = append(readerNames, r.Name())
+	}
+	assert.Equal(t, []string{"noop", "archive"}, writerNames)
+	assert.Equal(t, []string{"noop", "cold", "frozen"}, readerNames)
+}
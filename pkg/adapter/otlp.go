@@ -0,0 +1,583 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpContentType is the content type of OTLP/HTTP protobuf requests and responses.
+const otlpContentType = "application/x-protobuf"
+
+// Aggregation temporalities of OTLP sums and histograms.
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+)
+
+// otlpFlagNoRecordedValue marks data points without a value, which become staleness markers.
+const otlpFlagNoRecordedValue = 1
+
+// otlpStaleNaN is the staleness marker of Prometheus.
+var otlpStaleNaN = math.Float64frombits(0x7ff0000000000002)
+
+// otlpHandler accepts OTLP/HTTP protobuf ExportMetricsServiceRequests, converts their
+// gauges, sums and the sums and counts of histograms into timeseries like the Prometheus
+// OTLP receiver does, and writes them like remote write requests.
+func otlpHandler(logger slog.Logger, cfg *Config, writers []writer) http.HandlerFunc {
+	limiters := &limiterCache{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.DebugContext(r.Context(), "otlp request received", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+		cfg := cfg.current()
+		limiter := limiters.get(cfg)
+
+		if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType != otlpContentType {
+			http.Error(w, fmt.Sprintf("unsupported content type %q, must be %s", r.Header.Get("Content-Type"), otlpContentType), http.StatusUnsupportedMediaType)
+			cfg.metrics.rejectedRequests.WithLabelValues("otlp", "unsupported_encoding").Inc()
+			return
+		}
+		encoding, err := otlpRequestEncoding(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			cfg.metrics.rejectedRequests.WithLabelValues("otlp", "unsupported_encoding").Inc()
+			return
+		}
+		ctx, tenant, ok := requestTenant(w, r, cfg, "otlp", plainError)
+		if !ok {
+			return
+		}
+		begin := time.Now()
+		if limiter != nil && !limiter.bySamples && !allowWrite(cfg.metrics, w, plainError, limiter, "otlp", 1, begin) {
+			return
+		}
+		reqBuf, releaseBody, status, err := decodeBody(w, r, cfg.metrics, "otlp", encoding, int64(cfg.maxRequestSize))
+		if err != nil {
+			logger.ErrorContext(ctx, "decode error", slog.Any("error", err.Error()))
+			http.Error(w, err.Error(), status)
+			countRejectedBody(cfg.metrics, "otlp", status)
+			cfg.metrics.writeErrors.Inc()
+			cfg.state.recordError("write", err, time.Now())
+			return
+		}
+
+		timeseries, err := otlpToTimeseries(cfg.metrics, reqBuf)
+		releaseBody()
+		if err != nil {
+			logger.ErrorContext(ctx, "unmarshal error", slog.Any("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			cfg.metrics.writeErrors.Inc()
+			cfg.state.recordError("write", err, time.Now())
+			return
+		}
+		if !writeTimeseries(ctx, w, plainError, logger, cfg, writers, limiter, "otlp", tenant, timeseries, begin) {
+			return
+		}
+		// An empty ExportMetricsServiceResponse reports that everything was accepted.
+		w.Header().Set("Content-Type", otlpContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// otlpRequestEncoding returns the content encoding of an OTLP request body, which is
+// uncompressed without a Content-Encoding header.
+func otlpRequestEncoding(r *http.Request) (string, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", encodingIdentity:
+		return encodingIdentity, nil
+	case encodingGzip:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unsupported content encoding %q, must be one of gzip, identity", encoding)
+}
+
+// otlpConverter collects the timeseries converted from an ExportMetricsServiceRequest.
+type otlpConverter struct {
+	// skipped counts the metrics of unsupported types.
+	skipped *prometheus.CounterVec
+	series  map[model.Fingerprint]*prompb.TimeSeries
+	// order keeps the series in the order they were first seen.
+	order []*prompb.TimeSeries
+}
+
+// otlpToTimeseries converts an encoded ExportMetricsServiceRequest into timeseries. The
+// messages are decoded with protowire, as the adapter doesn't depend on the OTLP protos.
+// Metrics of unsupported types are counted and skipped.
+func otlpToTimeseries(m *metrics, data []byte) ([]*prompb.TimeSeries, error) {
+	c := &otlpConverter{skipped: m.otlpSkippedMetrics, series: map[model.Fingerprint]*prompb.TimeSeries{}}
+	err := forEachField(data, func(num protowire.Number, _ uint64, value []byte) error {
+		if num == 1 {
+			return c.resourceMetrics(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.order, nil
+}
+
+// resourceMetrics converts a ResourceMetrics message. The job and instance labels of its
+// series are derived from the service attributes of the resource.
+func (c *otlpConverter) resourceMetrics(data []byte) error {
+	var resource map[string]string
+	var scopes [][]byte
+	err := forEachField(data, func(num protowire.Number, _ uint64, value []byte) error {
+		var err error
+		switch num {
+		case 1:
+			err = forEachField(value, func(num protowire.Number, _ uint64, value []byte) error {
+				if num != 1 {
+					return nil
+				}
+				if resource == nil {
+					resource = map[string]string{}
+				}
+				return decodeKeyValue(value, resource)
+			})
+		case 2:
+			scopes = append(scopes, value)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var target []*prompb.Label
+	job := resource["service.name"]
+	if namespace := resource["service.namespace"]; namespace != "" && job != "" {
+		job = namespace + "/" + job
+	}
+	if job != "" {
+		target = append(target, &prompb.Label{Name: "job", Value: job})
+	}
+	if instance := resource["service.instance.id"]; instance != "" {
+		target = append(target, &prompb.Label{Name: "instance", Value: instance})
+	}
+
+	for _, scope := range scopes {
+		err := forEachField(scope, func(num protowire.Number, _ uint64, value []byte) error {
+			if num == 2 {
+				return c.metric(value, target)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metric converts a Metric message of a gauge, sum or histogram.
+func (c *otlpConverter) metric(data []byte, target []*prompb.Label) error {
+	var name, unit string
+	var kind string
+	var body []byte
+	err := forEachField(data, func(num protowire.Number, _ uint64, value []byte) error {
+		switch num {
+		case 1:
+			name = string(value)
+		case 3:
+			unit = string(value)
+		case 5:
+			kind, body = "gauge", value
+		case 7:
+			kind, body = "sum", value
+		case 9:
+			kind, body = "histogram", value
+		case 10:
+			kind = "exponential_histogram"
+		case 11:
+			kind = "summary"
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var points [][]byte
+	temporality, monotonic := uint64(0), false
+	if body != nil {
+		err = forEachField(body, func(num protowire.Number, v uint64, value []byte) error {
+			switch num {
+			case 1:
+				points = append(points, value)
+			case 2:
+				temporality = v
+			case 3:
+				monotonic = v != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case kind == "gauge" || (kind == "sum" && temporality == otlpTemporalityCumulative):
+		counter := kind == "sum" && monotonic
+		metricName := otlpMetricName(name, unit, kind == "gauge", counter)
+		for _, point := range points {
+			if err := c.numberDataPoint(point, metricName, target); err != nil {
+				return err
+			}
+		}
+	case kind == "histogram" && temporality == otlpTemporalityCumulative:
+		metricName := otlpMetricName(name, unit, false, false)
+		for _, point := range points {
+			if err := c.histogramDataPoint(point, metricName, target); err != nil {
+				return err
+			}
+		}
+	case kind == "sum" || kind == "histogram":
+		// Like Prometheus, delta temporalities aren't converted into cumulative ones.
+		c.skipped.WithLabelValues("delta_" + kind).Inc()
+	case kind == "":
+		c.skipped.WithLabelValues("empty").Inc()
+	default:
+		c.skipped.WithLabelValues(kind).Inc()
+	}
+	return nil
+}
+
+// numberDataPoint converts a NumberDataPoint into a sample of the metric.
+func (c *otlpConverter) numberDataPoint(data []byte, name string, target []*prompb.Label) error {
+	attributes := map[string]string{}
+	var timestamp, flags uint64
+	var value float64
+	err := forEachField(data, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 3:
+			timestamp = v
+		case 4:
+			value = math.Float64frombits(v)
+		case 6:
+			value = float64(int64(v))
+		case 7:
+			return decodeKeyValue(raw, attributes)
+		case 8:
+			flags = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if flags&otlpFlagNoRecordedValue != 0 {
+		value = otlpStaleNaN
+	}
+	c.add(name, target, attributes, timestamp, value)
+	return nil
+}
+
+// histogramDataPoint converts a HistogramDataPoint into samples of the _count and, if it
+// has one, the _sum series of the metric. Buckets aren't converted.
+func (c *otlpConverter) histogramDataPoint(data []byte, name string, target []*prompb.Label) error {
+	attributes := map[string]string{}
+	var timestamp, count, flags uint64
+	var sum float64
+	hasSum := false
+	err := forEachField(data, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 3:
+			timestamp = v
+		case 4:
+			count = v
+		case 5:
+			sum, hasSum = math.Float64frombits(v), true
+		case 9:
+			return decodeKeyValue(raw, attributes)
+		case 10:
+			flags = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	countValue, sumValue := float64(count), sum
+	if flags&otlpFlagNoRecordedValue != 0 {
+		countValue, sumValue = otlpStaleNaN, otlpStaleNaN
+	}
+	if hasSum || flags&otlpFlagNoRecordedValue != 0 {
+		c.add(name+"_sum", target, attributes, timestamp, sumValue)
+	}
+	c.add(name+"_count", target, attributes, timestamp, countValue)
+	return nil
+}
+
+// add appends a sample to the series of the metric with the target labels and the
+// attributes translated into labels. Attributes translating into the same label name have
+// their values joined with ";" in the order of their keys, like in Prometheus.
+func (c *otlpConverter) add(name string, target []*prompb.Label, attributes map[string]string, timestampNanos uint64, value float64) {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metric := model.Metric{model.MetricNameLabel: model.LabelValue(name)}
+	for _, key := range keys {
+		label := model.LabelName(otlpLabelName(key))
+		if label == "" || label == model.MetricNameLabel {
+			continue
+		}
+		if existing, ok := metric[label]; ok {
+			metric[label] = existing + ";" + model.LabelValue(attributes[key])
+		} else {
+			metric[label] = model.LabelValue(attributes[key])
+		}
+	}
+	// The target labels take precedence over attributes of the same name.
+	for _, l := range target {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+
+	fp := metric.Fingerprint()
+	ts, ok := c.series[fp]
+	if !ok {
+		ts = &prompb.TimeSeries{Labels: make([]*prompb.Label, 0, len(metric))}
+		for l, v := range metric {
+			ts.Labels = append(ts.Labels, &prompb.Label{Name: string(l), Value: string(v)})
+		}
+		sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+		c.series[fp] = ts
+		c.order = append(c.order, ts)
+	}
+	ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(timestampNanos / uint64(time.Millisecond)), Value: value})
+}
+
+// forEachField calls fn for every field of the encoded message, with the value of varint
+// and fixed size fields as v and the content of length-delimited fields as value.
+func forEachField(data []byte, fn func(num protowire.Number, v uint64, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var v uint64
+		var value []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(data)
+			v = uint64(v32)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, v, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeKeyValue decodes a KeyValue message into the attributes, with its value converted
+// into a string.
+func decodeKeyValue(data []byte, attributes map[string]string) error {
+	var key string
+	var value interface{}
+	err := forEachField(data, func(num protowire.Number, _ uint64, raw []byte) error {
+		var err error
+		switch num {
+		case 1:
+			key = string(raw)
+		case 2:
+			value, err = decodeAnyValue(raw)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		attributes[key] = ""
+	case string:
+		attributes[key] = v
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		attributes[key] = string(encoded)
+	}
+	return nil
+}
+
+// decodeAnyValue decodes an AnyValue message. Scalars are returned as strings, arrays and
+// key-value lists as values to encode as JSON.
+func decodeAnyValue(data []byte) (interface{}, error) {
+	var value interface{}
+	err := forEachField(data, func(num protowire.Number, v uint64, raw []byte) error {
+		switch num {
+		case 1:
+			value = string(raw)
+		case 2:
+			value = strconv.FormatBool(v != 0)
+		case 3:
+			value = strconv.FormatInt(int64(v), 10)
+		case 4:
+			value = strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+		case 5:
+			values := []interface{}{}
+			err := forEachField(raw, func(num protowire.Number, _ uint64, raw []byte) error {
+				if num != 1 {
+					return nil
+				}
+				element, err := decodeAnyValue(raw)
+				values = append(values, element)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			value = values
+		case 6:
+			values := map[string]string{}
+			err := forEachField(raw, func(num protowire.Number, _ uint64, raw []byte) error {
+				if num != 1 {
+					return nil
+				}
+				return decodeKeyValue(raw, values)
+			})
+			if err != nil {
+				return err
+			}
+			value = values
+		case 7:
+			value = base64.StdEncoding.EncodeToString(raw)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Units of OTLP metrics and their names in Prometheus metric names.
+var (
+	otlpUnits = map[string]string{
+		"d": "days", "h": "hours", "min": "minutes", "s": "seconds", "ms": "milliseconds", "us": "microseconds", "ns": "nanoseconds",
+		"By": "bytes", "KiBy": "kibibytes", "MiBy": "mebibytes", "GiBy": "gibibytes", "TiBy": "tibibytes",
+		"KBy": "kilobytes", "MBy": "megabytes", "GBy": "gigabytes", "TBy": "terabytes",
+		"m": "meters", "V": "volts", "A": "amperes", "J": "joules", "W": "watts", "g": "grams",
+		"Cel": "celsius", "Hz": "hertz", "1": "", "%": "percent",
+	}
+	otlpPerUnits = map[string]string{
+		"s": "second", "m": "minute", "h": "hour", "d": "day", "w": "week", "mo": "month", "y": "year",
+	}
+)
+
+// otlpMetricName builds the Prometheus metric name of an OTLP metric like the Prometheus
+// OTLP receiver with metric suffixes: the name is split into alphanumeric tokens, the unit
+// is appended unless the name already contains it, counters get the suffix _total and
+// gauges with the unit 1 the suffix _ratio.
+func otlpMetricName(name, unit string, gauge, counter bool) string {
+	tokens := strings.FieldsFunc(name, notAlphanumeric)
+
+	mainUnit, perUnit, _ := strings.Cut(unit, "/")
+	if mainUnit = strings.TrimSpace(mainUnit); mainUnit != "" && !strings.ContainsAny(mainUnit, "{}") {
+		if promUnit := cleanUpToken(unitName(otlpUnits, mainUnit)); promUnit != "" && !slices.Contains(tokens, promUnit) {
+			tokens = append(tokens, promUnit)
+		}
+	}
+	if perUnit = strings.TrimSpace(perUnit); perUnit != "" && !strings.ContainsAny(perUnit, "{}") {
+		if promUnit := cleanUpToken(unitName(otlpPerUnits, perUnit)); promUnit != "" && !slices.Contains(tokens, promUnit) {
+			tokens = append(tokens, "per", promUnit)
+		}
+	}
+	if counter {
+		tokens = slices.DeleteFunc(tokens, func(token string) bool { return token == "total" })
+		tokens = append(tokens, "total")
+	}
+	if gauge && unit == "1" && !slices.Contains(tokens, "ratio") {
+		tokens = append(tokens, "ratio")
+	}
+
+	metricName := strings.Join(tokens, "_")
+	if metricName != "" && unicode.IsDigit(rune(metricName[0])) {
+		metricName = "_" + metricName
+	}
+	return metricName
+}
+
+// otlpLabelName translates an attribute key into a label name like the Prometheus OTLP
+// receiver: invalid characters are replaced with _, and keys starting with a digit or a
+// single _ are prefixed with key.
+func otlpLabelName(key string) string {
+	if key == "" {
+		return ""
+	}
+	label := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, key)
+	switch {
+	case unicode.IsDigit(rune(label[0])):
+		label = "key_" + label
+	case strings.HasPrefix(label, "_") && !strings.HasPrefix(label, "__"):
+		label = "key" + label
+	}
+	return label
+}
+
+func unitName(units map[string]string, unit string) string {
+	if name, ok := units[unit]; ok {
+		return name
+	}
+	return unit
+}
+
+func cleanUpToken(token string) string {
+	return strings.Join(strings.FieldsFunc(token, notAlphanumeric), "_")
+}
+
+func notAlphanumeric(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
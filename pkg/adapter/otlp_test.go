@@ -0,0 +1,218 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// pbMessage encodes protobuf fields for OTLP test fixtures.
+type pbMessage []byte
+
+func (m pbMessage) bytes(num protowire.Number, value []byte) pbMessage {
+	m = protowire.AppendTag(m, num, protowire.BytesType)
+	return protowire.AppendBytes(m, value)
+}
+
+func (m pbMessage) str(num protowire.Number, value string) pbMessage {
+	return m.bytes(num, []byte(value))
+}
+
+func (m pbMessage) varint(num protowire.Number, value uint64) pbMessage {
+	m = protowire.AppendTag(m, num, protowire.VarintType)
+	return protowire.AppendVarint(m, value)
+}
+
+func (m pbMessage) fixed64(num protowire.Number, value uint64) pbMessage {
+	m = protowire.AppendTag(m, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(m, value)
+}
+
+func otlpAttribute(key, value string) []byte {
+	return pbMessage{}.str(1, key).bytes(2, pbMessage{}.str(1, value))
+}
+
+// otlpFixture returns an ExportMetricsServiceRequest with a gauge, a cumulative counter,
+// a cumulative histogram, a delta sum and a summary of a service.
+func otlpFixture() []byte {
+	const timestamp = 1700000000123456789
+	resource := pbMessage{}.
+		bytes(1, otlpAttribute("service.namespace", "shop")).
+		bytes(1, otlpAttribute("service.name", "checkout")).
+		bytes(1, otlpAttribute("service.instance.id", "pod-1"))
+
+	gauge := pbMessage{}.str(1, "process.cpu.utilization").str(3, "1").bytes(5, pbMessage{}.
+		bytes(1, pbMessage{}.bytes(7, otlpAttribute("cpu.state", "user")).fixed64(3, timestamp).fixed64(4, math.Float64bits(0.25))).
+		bytes(1, pbMessage{}.bytes(7, otlpAttribute("cpu.state", "idle")).fixed64(3, timestamp).varint(8, otlpFlagNoRecordedValue)))
+	counter := pbMessage{}.str(1, "http.server.requests").bytes(7, pbMessage{}.
+		bytes(1, pbMessage{}.
+			bytes(7, otlpAttribute("http.method", "GET")).
+			bytes(7, pbMessage{}.str(1, "http.status_code").bytes(2, pbMessage{}.varint(3, 200))).
+			fixed64(3, timestamp).fixed64(6, 42)).
+		varint(2, otlpTemporalityCumulative).varint(3, 1))
+	histogram := pbMessage{}.str(1, "http.server.duration").str(3, "ms").bytes(9, pbMessage{}.
+		bytes(1, pbMessage{}.bytes(9, otlpAttribute("http.route", "/cart")).fixed64(3, timestamp).fixed64(4, 3).fixed64(5, math.Float64bits(12.5))).
+		varint(2, otlpTemporalityCumulative))
+	delta := pbMessage{}.str(1, "orders").bytes(7, pbMessage{}.
+		bytes(1, pbMessage{}.fixed64(3, timestamp).fixed64(6, 1)).
+		varint(2, otlpTemporalityDelta).varint(3, 1))
+	summary := pbMessage{}.str(1, "rpc.latency").bytes(11, pbMessage{})
+
+	scope := pbMessage{}.bytes(1, pbMessage{}.str(1, "checkout-instrumentation")).
+		bytes(2, gauge).bytes(2, counter).bytes(2, histogram).bytes(2, delta).bytes(2, summary)
+	return pbMessage{}.bytes(1, pbMessage{}.bytes(1, resource).bytes(2, scope))
+}
+
+func seriesLabels(ts *prompb.TimeSeries) map[string]string {
+	labels := map[string]string{}
+	for _, l := range ts.Labels {
+		labels[l.Name] = l.Value
+	}
+	return labels
+}
+
+func TestOTLPToTimeseries(t *testing.T) {
+	m := newMetrics(prometheus.NewRegistry(), metricfactory.Default())
+	timeseries, err := otlpToTimeseries(m, otlpFixture())
+	assert.NoError(t, err)
+	if !assert.Len(t, timeseries, 5) {
+		return
+	}
+
+	target := map[string]string{"job": "shop/checkout", "instance": "pod-1"}
+	expected := []struct {
+		labels map[string]string
+		value  float64
+	}{
+		{map[string]string{"__name__": "process_cpu_utilization_ratio", "cpu_state": "user"}, 0.25},
+		{map[string]string{"__name__": "process_cpu_utilization_ratio", "cpu_state": "idle"}, otlpStaleNaN},
+		{map[string]string{"__name__": "http_server_requests_total", "http_method": "GET", "http_status_code": "200"}, 42},
+		{map[string]string{"__name__": "http_server_duration_milliseconds_sum", "http_route": "/cart"}, 12.5},
+		{map[string]string{"__name__": "http_server_duration_milliseconds_count", "http_route": "/cart"}, 3},
+	}
+	for i, e := range expected {
+		for name, value := range target {
+			e.labels[name] = value
+		}
+		assert.Equal(t, e.labels, seriesLabels(timeseries[i]))
+		if assert.Len(t, timeseries[i].Samples, 1) {
+			assert.Equal(t, int64(1700000000123), timeseries[i].Samples[0].Timestamp)
+			assert.Equal(t, math.Float64bits(e.value), math.Float64bits(timeseries[i].Samples[0].Value))
+		}
+	}
+	assert.Equal(t, 1.0, counterValue(m.otlpSkippedMetrics.WithLabelValues("delta_sum")))
+	assert.Equal(t, 1.0, counterValue(m.otlpSkippedMetrics.WithLabelValues("summary")))
+}
+
+func TestOTLPToTimeseriesMalformed(t *testing.T) {
+	_, err := otlpToTimeseries(newMetrics(prometheus.NewRegistry(), metricfactory.Default()), []byte{0x0a, 0x05, 0x01})
+	assert.Error(t, err)
+}
+
+func TestOTLPMetricName(t *testing.T) {
+	for _, testCase := range []struct {
+		name, unit     string
+		gauge, counter bool
+		expected       string
+	}{
+		{"system.memory.usage", "By", true, false, "system_memory_usage_bytes"},
+		{"http.server.request.duration", "s", false, false, "http_server_request_duration_seconds"},
+		{"network.io", "By/s", true, false, "network_io_bytes_per_second"},
+		{"requests.total", "{request}", false, true, "requests_total"},
+		{"requests", "1", false, true, "requests_total"},
+		{"disk.utilization", "1", true, false, "disk_utilization_ratio"},
+		{"latency_seconds", "s", true, false, "latency_seconds"},
+		{"2xx.responses", "", false, true, "_2xx_responses_total"},
+	} {
+		assert.Equal(t, testCase.expected, otlpMetricName(testCase.name, testCase.unit, testCase.gauge, testCase.counter), testCase.name)
+	}
+}
+
+func TestOTLPLabelName(t *testing.T) {
+	assert.Equal(t, "http_method", otlpLabelName("http.method"))
+	assert.Equal(t, "key_0label", otlpLabelName("0label"))
+	assert.Equal(t, "key_label", otlpLabelName("_label"))
+	assert.Equal(t, "__label", otlpLabelName("__label"))
+	assert.Equal(t, "caf_", otlpLabelName("café"))
+}
+
+func TestOTLPHandler(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, err := zw.Write(otlpFixture())
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	for name, testCase := range map[string]struct {
+		contentType, encoding string
+		body                  []byte
+		expected, series      int
+	}{
+		"uncompressed": {"application/x-protobuf", "", otlpFixture(), http.StatusOK, 5},
+		"gzip":         {"application/x-protobuf", "gzip", gzipped.Bytes(), http.StatusOK, 5},
+		"json":         {"application/json", "", []byte("{}"), http.StatusUnsupportedMediaType, 0},
+		"snappy":       {"application/x-protobuf", "snappy", otlpFixture(), http.StatusUnsupportedMediaType, 0},
+		"malformed":    {"application/x-protobuf", "", []byte{0x0a, 0x05, 0x01}, http.StatusBadRequest, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mw := &mockWriter{name: "bigquerydb"}
+			req := httptest.NewRequest(http.MethodPost, "/otlp/v1/metrics", bytes.NewReader(testCase.body))
+			req.Header.Set("Content-Type", testCase.contentType)
+			if testCase.encoding != "" {
+				req.Header.Set("Content-Encoding", testCase.encoding)
+			}
+			rec := httptest.NewRecorder()
+			otlpHandler(*promslog.NewNopLogger(), testConfig(&Config{}), []writer{mw})(rec, req)
+
+			assert.Equal(t, testCase.expected, rec.Code)
+			assert.Len(t, mw.received, testCase.series)
+			if testCase.expected == http.StatusOK {
+				assert.Equal(t, otlpContentType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestOTLPDisabledByDefault(t *testing.T) {
+	for args, expected := range map[string]int{"": http.StatusNotFound, "--otlp.enabled": http.StatusOK} {
+		var flags []string
+		if args != "" {
+			flags = append(flags, args)
+		}
+		cfg, err := parseTestFlags(flags...)
+		assert.NoError(t, err)
+
+		mux := http.NewServeMux()
+		registerHandlers(mux, *promslog.NewNopLogger(), cfg, []writer{&mockWriter{name: "bigquerydb"}}, nil)
+		req := httptest.NewRequest(http.MethodPost, "/otlp/v1/metrics", bytes.NewReader(otlpFixture()))
+		req.Header.Set("Content-Type", otlpContentType)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, expected, rec.Code, args)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitRequests = "requests"
+	rateLimitSamples  = "samples"
+)
+
+// writeLimiter limits the rate of write requests, counted either in requests or in samples.
+type writeLimiter struct {
+	limiter   *rate.Limiter
+	bySamples bool
+}
+
+// newWriteLimiter returns a limiter allowing limit requests or samples per second with bursts
+// of up to burst, or nil if limit is not positive.
+func newWriteLimiter(limit float64, burst int, unit string) *writeLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &writeLimiter{
+		limiter:   rate.NewLimiter(rate.Limit(limit), max(burst, 1)),
+		bySamples: unit == rateLimitSamples,
+	}
+}
+
+// limiterCache holds the rate limiter of a handler, which is shared by its requests until
+// a reload changes the rate limit.
+type limiterCache struct {
+	current atomic.Pointer[cachedLimiter]
+}
+
+// cachedLimiter is a limiter with the settings it was created with.
+type cachedLimiter struct {
+	limit   float64
+	burst   int
+	unit    string
+	limiter *writeLimiter
+}
+
+// get returns the limiter of the rate limit in cfg, which is only created again if the
+// rate limit changed.
+func (c *limiterCache) get(cfg *Config) *writeLimiter {
+	for {
+		cached := c.current.Load()
+		if cached != nil && cached.limit == cfg.writeRateLimit && cached.burst == cfg.writeRateBurst && cached.unit == cfg.writeRateLimitUnit {
+			return cached.limiter
+		}
+		limiter := &cachedLimiter{
+			limit:   cfg.writeRateLimit,
+			burst:   cfg.writeRateBurst,
+			unit:    cfg.writeRateLimitUnit,
+			limiter: newWriteLimiter(cfg.writeRateLimit, cfg.writeRateBurst, cfg.writeRateLimitUnit),
+		}
+		if c.current.CompareAndSwap(cached, limiter) {
+			return limiter.limiter
+		}
+	}
+}
+
+// reserve takes n tokens if they are available at now. Otherwise it returns how long to
+// wait until they are. It returns false if n is larger than the burst and never fits.
+func (l *writeLimiter) reserve(n int, now time.Time) (time.Duration, bool) {
+	r := l.limiter.ReserveN(now, n)
+	if !r.OK() {
+		return 0, false
+	}
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		r.CancelAt(now)
+	}
+	return delay, true
+}
+
+// setRetryAfter sets the Retry-After header to the delay in whole seconds, at least one.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	seconds := int(math.Ceil(delay.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+// quotaBackoff computes the delay after which senders should retry writes that failed
+// because a BigQuery quota was exceeded. The delay starts at base and doubles with every
+// consecutive failure up to max, and is reset by a successful write.
+type quotaBackoff struct {
+	base, max time.Duration
+
+	mu       sync.Mutex
+	failures int
+}
+
+// newQuotaBackoff returns a backoff starting at base and capped at maxDelay. A maxDelay
+// below base is raised to base.
+func newQuotaBackoff(base, maxDelay time.Duration) *quotaBackoff {
+	return &quotaBackoff{base: base, max: max(base, maxDelay)}
+}
+
+// next records a write failing because of a quota and returns the delay to retry after.
+// A nil backoff always returns one second.
+func (b *quotaBackoff) next() time.Duration {
+	if b == nil {
+		return time.Second
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delay := b.base
+	for i := 0; i < b.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	b.failures++
+	return min(delay, b.max)
+}
+
+// reset records a successful write.
+func (b *quotaBackoff) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.failures = 0
+	b.mu.Unlock()
+}
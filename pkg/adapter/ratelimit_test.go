@@ -0,0 +1,184 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestWriteLimiter(t *testing.T) {
+	assert.Nil(t, newWriteLimiter(0, 10, rateLimitRequests))
+
+	l := newWriteLimiter(2, 2, rateLimitRequests)
+	now := time.Unix(1000, 0)
+	for i := 0; i < 2; i++ {
+		delay, ok := l.reserve(1, now)
+		assert.True(t, ok)
+		assert.Zero(t, delay)
+	}
+	delay, ok := l.reserve(1, now)
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+
+	// Rejected requests don't use up tokens.
+	delay, _ = l.reserve(1, now.Add(250*time.Millisecond))
+	assert.Equal(t, 250*time.Millisecond, delay)
+	delay, _ = l.reserve(1, now.Add(500*time.Millisecond))
+	assert.Zero(t, delay)
+
+	_, ok = l.reserve(3, now.Add(time.Hour))
+	assert.False(t, ok, "more than the burst never fits")
+}
+
+func TestWriteLimiterSamples(t *testing.T) {
+	l := newWriteLimiter(100, 150, rateLimitSamples)
+	assert.True(t, l.bySamples)
+	now := time.Unix(1000, 0)
+
+	delay, _ := l.reserve(100, now)
+	assert.Zero(t, delay)
+	delay, _ = l.reserve(100, now)
+	assert.Equal(t, 500*time.Millisecond, delay)
+	delay, _ = l.reserve(50, now)
+	assert.Zero(t, delay)
+}
+
+func TestWriteHandlerRateLimit(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, writeRateLimit: 0.1, writeRateBurst: 2, writeRateLimitUnit: rateLimitRequests})
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	rejected := counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "rate_limited"))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, []string{"9", "10"}, rec.Header().Get("Retry-After"))
+	assert.Equal(t, 2, w.series, "rejected requests aren't written")
+	assert.Equal(t, rejected+1, counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "rate_limited")))
+}
+
+func TestWriteHandlerRateLimitSamples(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, writeRateLimit: 1, writeRateBurst: 3, writeRateLimitUnit: rateLimitSamples})
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", sample, sample))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", sample, sample))))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Requests without samples always pass.
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", sample, sample, sample, sample))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, 2, w.series)
+}
+
+func TestRateLimitFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.writeRateLimit)
+	assert.Equal(t, rateLimitRequests, cfg.writeRateLimitUnit)
+
+	cfg, err = parseTestFlags("--write.rate-limit=5000", "--write.rate-burst=10000", "--write.rate-limit-unit=samples")
+	assert.NoError(t, err)
+	assert.Equal(t, 5000.0, cfg.writeRateLimit)
+	assert.Equal(t, 10000, cfg.writeRateBurst)
+	assert.Equal(t, rateLimitSamples, cfg.writeRateLimitUnit)
+
+	_, err = parseTestFlags("--write.rate-limit-unit=bytes")
+	assert.Error(t, err)
+
+	cfg, err = parseTestFlags("--write.quota-backoff=10s", "--write.quota-max-backoff=5m")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, cfg.writeQuotaBackoff)
+	assert.Equal(t, 5*time.Minute, cfg.writeQuotaMaxBackoff)
+}
+
+func TestQuotaBackoff(t *testing.T) {
+	b := newQuotaBackoff(5*time.Second, 30*time.Second)
+	for _, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		assert.Equal(t, expected, b.next())
+	}
+	b.reset()
+	assert.Equal(t, 5*time.Second, b.next())
+
+	assert.Equal(t, 5*time.Second, newQuotaBackoff(5*time.Second, time.Second).next(), "the maximum is at least the base")
+	var unset *quotaBackoff
+	assert.Equal(t, time.Second, unset.next())
+}
+
+func TestWriteHandlerQuotaExceeded(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, quotaBackoff: newQuotaBackoff(5*time.Second, time.Minute)})
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	quotaExceeded := counterValue(cfg.metrics.writeResponses.WithLabelValues("quota_exceeded"))
+	failed := counterValue(cfg.metrics.writeResponses.WithLabelValues("error"))
+
+	for _, testCase := range []struct {
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{quotaError("rateLimitExceeded"), http.StatusTooManyRequests, "5"},
+		{quotaError("quotaExceeded"), http.StatusTooManyRequests, "10"},
+		{&bigquerydb.WriteError{FailedSamples: 1, Errors: []error{&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}}}, http.StatusInternalServerError, ""},
+		{quotaError("rateLimitExceeded"), http.StatusTooManyRequests, "20"},
+		{nil, http.StatusOK, ""},
+		{quotaError("rateLimitExceeded"), http.StatusTooManyRequests, "5"},
+	} {
+		w.err = testCase.err
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "node", prompb.Sample{Timestamp: 1000, Value: 1}))))
+		assert.Equal(t, testCase.status, rec.Code)
+		assert.Equal(t, testCase.retryAfter, rec.Header().Get("Retry-After"))
+	}
+	assert.Equal(t, quotaExceeded+4, counterValue(cfg.metrics.writeResponses.WithLabelValues("quota_exceeded")))
+	assert.Equal(t, failed+1, counterValue(cfg.metrics.writeResponses.WithLabelValues("error")))
+}
+
+// quotaError returns the error of a write failing because of a BigQuery quota.
+func quotaError(reason string) error {
+	return &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{&googleapi.Error{
+		Code:   http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{{Reason: reason}},
+	}}}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// debugReader is implemented by readers which can report the queries they ran.
+type debugReader interface {
+	ReadDebug(ctx context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, []bigquerydb.QueryStats, error)
+	Name() string
+}
+
+// debugReadRequest is the JSON body of a debug read request.
+type debugReadRequest struct {
+	Matchers []debugMatcher `json:"matchers"`
+	StartMs  int64          `json:"start_ms"`
+	EndMs    int64          `json:"end_ms"`
+}
+
+type debugMatcher struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// debugReadResponse is the JSON answer to a debug read request, with the results of every reader.
+type debugReadResponse struct {
+	Readers []debugReaderResult `json:"readers"`
+}
+
+type debugReaderResult struct {
+	Name    string                  `json:"name"`
+	Queries []bigquerydb.QueryStats `json:"queries"`
+	Series  []debugSeries           `json:"series"`
+	Error   string                  `json:"error,omitempty"`
+}
+
+type debugSeries struct {
+	Labels  map[string]string `json:"labels"`
+	Samples []debugSample     `json:"samples"`
+}
+
+// debugSample holds the value as a string, as JSON has no representation of NaN and infinity.
+type debugSample struct {
+	TimestampMs int64  `json:"timestamp_ms"`
+	Value       string `json:"value"`
+}
+
+// query converts the request into the query of a remote read request.
+func (r *debugReadRequest) query() (*prompb.Query, error) {
+	if r.EndMs < r.StartMs {
+		return nil, errors.New("end_ms must not be before start_ms")
+	}
+	q := &prompb.Query{StartTimestampMs: r.StartMs, EndTimestampMs: r.EndMs}
+	for _, m := range r.Matchers {
+		t, ok := prompb.LabelMatcher_Type_value[m.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown matcher type %q, must be one of EQ, NEQ, RE, NRE", m.Type)
+		}
+		q.Matchers = append(q.Matchers, &prompb.LabelMatcher{Type: prompb.LabelMatcher_Type(t), Name: m.Name, Value: m.Value})
+	}
+	return q, nil
+}
+
+// readDebugHandler runs the matchers of a JSON request on all readers like a remote read, and
+// answers with the generated SQL, the statistics of the BigQuery jobs and the resulting series.
+func readDebugHandler(logger slog.Logger, cfg *Config, readers []reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.DebugContext(r.Context(), "debug read request received", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ctx, _, ok := requestTenant(w, r, cfg, "read_debug", plainError)
+		if !ok {
+			return
+		}
+
+		var body io.Reader = r.Body
+		if cfg.maxRequestSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, int64(cfg.maxRequestSize))
+		}
+		decoder := json.NewDecoder(body)
+		decoder.DisallowUnknownFields()
+		var debugReq debugReadRequest
+		if err := decoder.Decode(&debugReq); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("request body exceeds the limit of %d bytes", int64(cfg.maxRequestSize)), http.StatusRequestEntityTooLarge)
+				cfg.metrics.rejectedRequests.WithLabelValues("read_debug", "too_large").Inc()
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q, err := debugReq.query()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := &prompb.ReadRequest{Queries: []*prompb.Query{q}}
+		resp := debugReadResponse{Readers: []debugReaderResult{}}
+		for _, rd := range readers {
+			dr, ok := rd.(debugReader)
+			if !ok {
+				continue
+			}
+			resp.Readers = append(resp.Readers, runDebugRead(ctx, dr, req))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.WarnContext(ctx, "error writing response", slog.Any("error", err))
+		}
+	}
+}
+
+// runDebugRead runs the request on a single reader.
+func runDebugRead(ctx context.Context, rd debugReader, req *prompb.ReadRequest) debugReaderResult {
+	readResp, queries, err := rd.ReadDebug(ctx, req)
+	result := debugReaderResult{Name: rd.Name(), Queries: queries, Series: []debugSeries{}}
+	if result.Queries == nil {
+		result.Queries = []bigquerydb.QueryStats{}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, res := range readResp.Results {
+		for _, ts := range res.Timeseries {
+			series := debugSeries{Labels: make(map[string]string, len(ts.Labels)), Samples: make([]debugSample, 0, len(ts.Samples))}
+			for _, l := range ts.Labels {
+				series.Labels[l.Name] = l.Value
+			}
+			for _, s := range ts.Samples {
+				series.Samples = append(series.Samples, debugSample{TimestampMs: s.Timestamp, Value: strconv.FormatFloat(s.Value, 'f', -1, 64)})
+			}
+			result.Series = append(result.Series, series)
+		}
+	}
+	return result
+}
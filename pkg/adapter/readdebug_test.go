@@ -0,0 +1,158 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/alecthomas/units"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockDebugReader returns resp and the queries, or fails with err, and records the request.
+type mockDebugReader struct {
+	mockReader
+	queries []bigquerydb.QueryStats
+	req     *prompb.ReadRequest
+}
+
+func (m *mockDebugReader) ReadDebug(_ context.Context, req *prompb.ReadRequest) (*prompb.ReadResponse, []bigquerydb.QueryStats, error) {
+	m.req = req
+	return m.resp, m.queries, m.err
+}
+
+func serveDebugRead(cfg *Config, body string, readers ...reader) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	readDebugHandler(*promslog.NewNopLogger(), cfg, readers)(rec, httptest.NewRequest(http.MethodPost, "/api/v1/read_debug", strings.NewReader(body)))
+	return rec
+}
+
+func TestReadDebugHandler(t *testing.T) {
+	rd := &mockDebugReader{
+		mockReader: mockReader{name: "bigquerydb", resp: readResponse(
+			seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}, prompb.Sample{Timestamp: 2000, Value: math.NaN()}),
+		)},
+		queries: []bigquerydb.QueryStats{{
+			SQL:                 "SELECT metricname FROM dataset.table WHERE metricname = @m0",
+			Parameters:          map[string]interface{}{"m0": "up"},
+			JobID:               "job-1",
+			TotalBytesProcessed: 1024,
+			Rows:                2,
+		}},
+	}
+	failing := &mockDebugReader{mockReader: mockReader{name: "archive", err: errors.New("backend unavailable")}}
+
+	rec := serveDebugRead(testConfig(&Config{}), `{"matchers":[{"type":"EQ","name":"__name__","value":"up"},{"type":"RE","name":"job","value":"a.*"}],"start_ms":1000,"end_ms":2000}`,
+		rd, failing, &mockReader{name: "plain"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	assert.Equal(t, &prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: 1000,
+		EndTimestampMs:   2000,
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+			{Type: prompb.LabelMatcher_RE, Name: "job", Value: "a.*"},
+		},
+	}}}, rd.req)
+
+	assert.JSONEq(t, `{"readers":[
+		{
+			"name":"bigquerydb",
+			"queries":[{
+				"sql":"SELECT metricname FROM dataset.table WHERE metricname = @m0",
+				"parameters":{"m0":"up"},
+				"job_id":"job-1",
+				"total_bytes_processed":1024,
+				"cache_hit":false,
+				"rows":2,
+				"duration_seconds":0
+			}],
+			"series":[{
+				"labels":{"__name__":"up","job":"api"},
+				"samples":[{"timestamp_ms":1000,"value":"1"},{"timestamp_ms":2000,"value":"NaN"}]
+			}]
+		},
+		{"name":"archive","queries":[],"series":[],"error":"backend unavailable"}
+	]}`, rec.Body.String())
+}
+
+func TestReadDebugHandlerBadRequests(t *testing.T) {
+	testCases := map[string]struct {
+		method   string
+		body     string
+		expected int
+	}{
+		"get":            {method: http.MethodGet, body: `{}`, expected: http.StatusMethodNotAllowed},
+		"invalid_json":   {method: http.MethodPost, body: `{"matchers":`, expected: http.StatusBadRequest},
+		"unknown_field":  {method: http.MethodPost, body: `{"query":"up"}`, expected: http.StatusBadRequest},
+		"unknown_type":   {method: http.MethodPost, body: `{"matchers":[{"type":"LIKE","name":"job","value":"a"}]}`, expected: http.StatusBadRequest},
+		"reversed_range": {method: http.MethodPost, body: `{"start_ms":2000,"end_ms":1000}`, expected: http.StatusBadRequest},
+		"too_large":      {method: http.MethodPost, body: `{"matchers":[{"type":"EQ","name":"__name__","value":"` + strings.Repeat("x", 100) + `"}]}`, expected: http.StatusRequestEntityTooLarge},
+		"within_limit":   {method: http.MethodPost, body: `{"start_ms":1000,"end_ms":2000}`, expected: http.StatusOK},
+		"empty_matchers": {method: http.MethodPost, body: `{"matchers":[]}`, expected: http.StatusOK},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rd := &mockDebugReader{mockReader: mockReader{name: "bigquerydb", resp: readResponse()}}
+			rec := httptest.NewRecorder()
+			readDebugHandler(*promslog.NewNopLogger(), testConfig(&Config{maxRequestSize: units.Base2Bytes(64)}), []reader{rd})(
+				rec, httptest.NewRequest(testCase.method, "/api/v1/read_debug", strings.NewReader(testCase.body)))
+			assert.Equal(t, testCase.expected, rec.Code)
+			if testCase.expected != http.StatusOK {
+				assert.Nil(t, rd.req)
+			}
+		})
+	}
+}
+
+func TestReadDebugDisabledByDefault(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.enableDebugRead)
+
+	body := `{"matchers":[{"type":"EQ","name":"__name__","value":"up"}]}`
+	readers := []reader{&mockDebugReader{mockReader: mockReader{name: "bigquerydb", resp: readResponse()}}}
+
+	mux := http.NewServeMux()
+	registerHandlers(mux, *promslog.NewNopLogger(), cfg, nil, readers)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/read_debug", strings.NewReader(body)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	cfg, err = parseTestFlags("--web.enable-debug-read")
+	assert.NoError(t, err)
+	mux = http.NewServeMux()
+	registerHandlers(mux, *promslog.NewNopLogger(), cfg, nil, readers)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/read_debug", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp debugReadResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.Readers, 1)
+}
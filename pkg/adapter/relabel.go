@@ -0,0 +1,135 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// seriesRule matches a single label of a timeseries against an anchored regular expression.
+type seriesRule struct {
+	label string
+	re    *regexp.Regexp
+}
+
+// seriesFilter decides which timeseries are forwarded to the writers.
+// A nil *seriesFilter keeps everything.
+type seriesFilter struct {
+	keep []seriesRule
+	drop []seriesRule
+}
+
+// newSeriesFilter parses the keep and drop rules. Each rule is either a bare
+// regular expression matched against the metric name, or "label=regex" to match
+// an arbitrary label. Regular expressions are fully anchored, as in Prometheus.
+// It returns nil when no rules are configured.
+func newSeriesFilter(keep, drop []string) (*seriesFilter, error) {
+	if len(keep) == 0 && len(drop) == 0 {
+		return nil, nil
+	}
+	f := &seriesFilter{}
+	var err error
+	if f.keep, err = parseSeriesRules(keep); err != nil {
+		return nil, errors.Wrap(err, "invalid keep rule")
+	}
+	if f.drop, err = parseSeriesRules(drop); err != nil {
+		return nil, errors.Wrap(err, "invalid drop rule")
+	}
+	return f, nil
+}
+
+func parseSeriesRules(rules []string) ([]seriesRule, error) {
+	parsed := make([]seriesRule, 0, len(rules))
+	for _, r := range rules {
+		label, expr := model.MetricNameLabel, r
+		if i := strings.Index(r, "="); i > 0 && model.LabelName(r[:i]).IsValid() {
+			label, expr = r[:i], r[i+1:]
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "%q", r)
+		}
+		parsed = append(parsed, seriesRule{label: label, re: re})
+	}
+	return parsed, nil
+}
+
+// matchesAny reports whether any of the rules matches the given labels.
+// A label that is absent is matched as the empty string.
+func matchesAny(rules []seriesRule, labels []*prompb.Label) bool {
+	for _, r := range rules {
+		value := ""
+		for _, l := range labels {
+			if l.Name == r.label {
+				value = l.Value
+				break
+			}
+		}
+		if r.re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepSeries reports whether the timeseries passes the filter.
+func (f *seriesFilter) keepSeries(ts *prompb.TimeSeries) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.keep) > 0 && !matchesAny(f.keep, ts.Labels) {
+		return false
+	}
+	return !matchesAny(f.drop, ts.Labels)
+}
+
+// apply filters the timeseries in place and returns the kept ones along with
+// the number of dropped series.
+func (f *seriesFilter) apply(timeseries []*prompb.TimeSeries) ([]*prompb.TimeSeries, int) {
+	if f == nil {
+		return timeseries, 0
+	}
+	kept := timeseries[:0]
+	for _, ts := range timeseries {
+		if f.keepSeries(ts) {
+			kept = append(kept, ts)
+		}
+	}
+	return kept, len(timeseries) - len(kept)
+}
+
+// dropLabelRegex validates the names of the labels to drop and combines the regular
+// expressions matching the names of the labels to drop into one, anchored like in
+// Prometheus. It returns nil when no regular expressions are configured.
+func dropLabelRegex(names, patterns []string) (*regexp.Regexp, error) {
+	for _, name := range names {
+		if name == model.MetricNameLabel {
+			return nil, errors.New("write.drop-label can't drop __name__")
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, errors.Wrapf(err, "invalid write.drop-label-regex %q", p)
+		}
+	}
+	return regexp.Compile("^(?:(?:" + strings.Join(patterns, ")|(?:") + "))$")
+}
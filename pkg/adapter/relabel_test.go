@@ -0,0 +1,106 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSeries(name string, labels ...string) *prompb.TimeSeries {
+	ts := &prompb.TimeSeries{Labels: []*prompb.Label{{Name: "__name__", Value: name}}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func TestSeriesFilterEmptyIsNoop(t *testing.T) {
+	f, err := newSeriesFilter(nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+
+	in := []*prompb.TimeSeries{testSeries("up"), testSeries("down")}
+	out, dropped := f.apply(in)
+	assert.Equal(t, 0, dropped)
+	assert.Len(t, out, 2)
+}
+
+func TestSeriesFilter(t *testing.T) {
+	testCases := map[string]struct {
+		keep     []string
+		drop     []string
+		series   *prompb.TimeSeries
+		expected bool
+	}{
+		"keep_name_match":       {keep: []string{"up|http_.*"}, series: testSeries("http_requests_total"), expected: true},
+		"keep_name_no_match":    {keep: []string{"up|http_.*"}, series: testSeries("node_cpu"), expected: false},
+		"keep_is_anchored":      {keep: []string{"up"}, series: testSeries("upstream"), expected: false},
+		"drop_name_match":       {drop: []string{".*_bucket"}, series: testSeries("latency_bucket"), expected: false},
+		"drop_name_no_match":    {drop: []string{".*_bucket"}, series: testSeries("latency_sum"), expected: true},
+		"keep_label_match":      {keep: []string{"team=frontend"}, series: testSeries("up", "team", "frontend"), expected: true},
+		"keep_label_absent":     {keep: []string{"team=frontend"}, series: testSeries("up"), expected: false},
+		"drop_label_match":      {drop: []string{"env=dev|test"}, series: testSeries("up", "env", "test"), expected: false},
+		"drop_absent_label":     {drop: []string{"env="}, series: testSeries("up"), expected: false},
+		"keep_then_drop":        {keep: []string{"up"}, drop: []string{"env=dev"}, series: testSeries("up", "env", "dev"), expected: false},
+		"regex_with_equals":     {keep: []string{"a=b|up"}, series: testSeries("up", "a", "b"), expected: true},
+		"regex_not_label_equal": {keep: []string{"(a=b)"}, series: testSeries("a=b"), expected: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f, err := newSeriesFilter(testCase.keep, testCase.drop)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, f.keepSeries(testCase.series))
+		})
+	}
+}
+
+func TestSeriesFilterApply(t *testing.T) {
+	f, err := newSeriesFilter(nil, []string{"drop_.*"})
+	assert.NoError(t, err)
+
+	out, dropped := f.apply([]*prompb.TimeSeries{testSeries("keep_a"), testSeries("drop_a"), testSeries("keep_b")})
+	assert.Equal(t, 1, dropped)
+	assert.Equal(t, []*prompb.TimeSeries{testSeries("keep_a"), testSeries("keep_b")}, out)
+}
+
+func TestSeriesFilterInvalidRegex(t *testing.T) {
+	_, err := newSeriesFilter([]string{"("}, nil)
+	assert.Error(t, err)
+	_, err = newSeriesFilter(nil, []string{"job=["})
+	assert.Error(t, err)
+}
+
+func TestDropLabelRegex(t *testing.T) {
+	re, err := dropLabelRegex([]string{"pod_template_hash"}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, re)
+
+	re, err = dropLabelRegex(nil, []string{"container_.*", "pod_template_hash"})
+	assert.NoError(t, err)
+	assert.True(t, re.MatchString("container_id"))
+	assert.True(t, re.MatchString("pod_template_hash"))
+	assert.False(t, re.MatchString("my_container_id"), "the regex is anchored")
+	assert.False(t, re.MatchString("pod_template_hash_x"), "every regex is anchored")
+
+	_, err = dropLabelRegex([]string{"__name__"}, nil)
+	assert.Error(t, err)
+	_, err = dropLabelRegex(nil, []string{"container_("})
+	assert.Error(t, err)
+}
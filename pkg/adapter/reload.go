@@ -0,0 +1,347 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/gcplog"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/logsampling"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// reloadableFlags are the flags whose changes a reload applies. Changes of all other
+// flags need a restart.
+var reloadableFlags = map[string]bool{
+	"log.level":                    true,
+	"log.format":                   true,
+	"log.sample-limit":             true,
+	"log.sample-window":            true,
+	"read.max-samples":             true,
+	"read.max-response-bytes":      true,
+	"read.max-rows":                true,
+	"read.max-bytes-scanned":       true,
+	"read.dry-run-min-range":       true,
+	"read.require-metric-name":     true,
+	"read.max-range":               true,
+	"read.max-range-behavior":      true,
+	"read.slow-query-threshold":    true,
+	"write.rate-limit":             true,
+	"write.rate-burst":             true,
+	"write.rate-limit-unit":        true,
+	"write.keep-metrics":           true,
+	"write.drop-metrics":           true,
+	"write.max-series-per-request": true,
+	"write.max-series-behavior":    true,
+	"write.max-labels-per-series":  true,
+	"write.max-label-value-length": true,
+}
+
+// readLimiter is implemented by readers whose limits can change at runtime.
+type readLimiter interface {
+	SetReadLimits(limits bigquerydb.ReadLimits)
+}
+
+// reloader re-reads the configuration from the command line arguments, including the
+// files of arguments starting with @, and applies the changes of the reloadable flags.
+// Requests load the configuration once, so that they see either the one before or the
+// one after a reload.
+type reloader struct {
+	logger  slog.Logger
+	args    []string
+	logs    *swapHandler
+	readers []reader
+	metrics *metrics
+
+	// mu serializes reloads.
+	mu   sync.Mutex
+	live atomic.Pointer[Config]
+}
+
+// newReloader returns a reloader of cfg, which was loaded from args. The log handler, if
+// any, is replaced when the log flags change, and the limits of the readers when the read
+// flags do.
+func newReloader(logger slog.Logger, cfg *Config, args []string, logs *swapHandler, readers []reader) *reloader {
+	r := &reloader{logger: logger, args: args, logs: logs, readers: readers, metrics: cfg.metrics}
+	cfg.reloader = r
+	r.live.Store(cfg)
+	return r
+}
+
+// current returns the configuration requests are handled with, which is the one of the
+// last reload, or cfg if it can't be reloaded.
+func (cfg *Config) current() *Config {
+	if cfg.reloader == nil {
+		return cfg
+	}
+	return cfg.reloader.live.Load()
+}
+
+// reload re-reads the configuration and applies it. The configuration is kept if it is
+// invalid or changes flags which aren't reloadable. The outcome is logged and counted.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed, err := r.apply()
+	if err != nil {
+		r.metrics.configReloads.WithLabelValues("failure").Inc()
+		r.logger.Error("failed to reload the configuration", slog.Any("error", err))
+		return err
+	}
+	r.metrics.configReloads.WithLabelValues("success").Inc()
+	r.logger.Info("reloaded the configuration", slog.Any("changed", changed))
+	return nil
+}
+
+// apply loads the configuration and applies it if only reloadable flags changed. It
+// returns the names of the changed flags.
+func (r *reloader) apply() ([]string, error) {
+	cfg, _, err := loadConfig(r.args)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid configuration")
+	}
+	current := r.live.Load()
+	changed, immutable := changedFlags(current.flags, cfg.flags)
+	if len(immutable) > 0 {
+		return nil, errors.Errorf("changes of %s need a restart", strings.Join(immutable, ", "))
+	}
+
+	// The state of the adapter and of the handlers is kept.
+	cfg.Logger, cfg.Registerer, cfg.Gatherer = current.Logger, current.Registerer, current.Gatherer
+	cfg.metrics = current.metrics
+	cfg.state = current.state
+	cfg.reloader = r
+	cfg.haTracker = current.haTracker
+	cfg.elector = current.elector
+	cfg.queryLimiter = current.queryLimiter
+	cfg.quotaBackoff = current.quotaBackoff
+	cfg.promslogConfig.Writer = current.promslogConfig.Writer
+
+	if changedAny(changed, "log.") && r.logs != nil {
+		r.logs.set(newLogHandler(cfg))
+	}
+	if changedAny(changed, "read.") {
+		limits := readLimits(cfg)
+		for _, rd := range r.readers {
+			if l, ok := rd.(readLimiter); ok {
+				l.SetReadLimits(limits)
+			}
+		}
+	}
+	r.live.Store(cfg)
+	return changed, nil
+}
+
+// changedFlags returns the names of the flags whose values differ, split into the
+// reloadable ones and the others.
+func changedFlags(old, values map[string]string) ([]string, []string) {
+	var changed, immutable []string
+	for name, value := range values {
+		if old[name] == value {
+			continue
+		}
+		if reloadableFlags[name] {
+			changed = append(changed, name)
+		} else {
+			immutable = append(immutable, name)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(immutable)
+	return changed, immutable
+}
+
+// changedAny returns whether one of the flags starts with prefix.
+func changedAny(flags []string, prefix string) bool {
+	return slices.ContainsFunc(flags, func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// flagValues returns the values of the parsed flags of the application by name.
+func flagValues(a *kingpin.Application) map[string]string {
+	values := map[string]string{}
+	for _, flag := range a.Model().Flags {
+		values[flag.Name] = flag.Value.String()
+	}
+	return values
+}
+
+// reloadOnSignal reloads the configuration whenever the process receives SIGHUP, until
+// the returned function is called.
+func (r *reloader) reloadOnSignal() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				// Errors are logged by reload.
+				_ = r.reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// reloadHandler reloads the configuration on POST requests. It answers with 400 and the
+// error if the configuration was kept.
+func reloadHandler(r *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "the configuration is only reloaded on POST requests", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
+
+// Formats of the log. promslog writes logfmt and json, gcplog the JSON of Cloud Logging.
+const (
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+	logFormatGCP    = "gcp"
+)
+
+// newLogHandler returns the handler of the log configured in cfg.
+func newLogHandler(cfg *Config) slog.Handler {
+	var handler slog.Handler
+	if cfg.logFormat == logFormatGCP {
+		w := cfg.promslogConfig.Writer
+		if w == nil {
+			w = os.Stderr
+		}
+		handler = gcplog.NewHandler(w, logLevel(cfg), cfg.googleProjectID)
+	} else {
+		config := cfg.promslogConfig
+		config.Format = &promslog.AllowedFormat{}
+		if cfg.logFormat != "" {
+			// The flag only allows the formats of promslog besides gcp.
+			_ = config.Format.Set(cfg.logFormat)
+		}
+		handler = promslog.New(&config).Handler()
+	}
+	if cfg.logSampleLimit > 0 {
+		handler = logsampling.NewHandler(handler, cfg.logSampleLimit, cfg.logSampleWindow)
+	}
+	return handler
+}
+
+// logLevel returns the minimum level of the log configured in cfg.
+func logLevel(cfg *Config) slog.Level {
+	level := slog.LevelInfo
+	if cfg.promslogConfig.Level != nil {
+		// The flag only allows the levels slog knows.
+		_ = level.UnmarshalText([]byte(cfg.promslogConfig.Level.String()))
+	}
+	return level
+}
+
+// readLimits returns the read limits configured in cfg.
+func readLimits(cfg *Config) bigquerydb.ReadLimits {
+	return bigquerydb.ReadLimits{
+		MaxSamples:         cfg.readMaxSamples,
+		MaxResponseBytes:   int(cfg.readMaxResponseBytes),
+		MaxRows:            cfg.readMaxRows,
+		MaxBytesScanned:    int64(cfg.readMaxBytesScanned),
+		DryRunMinRange:     cfg.readDryRunMinRange,
+		RequireMetricName:  cfg.readRequireMetricName,
+		MaxRange:           cfg.readMaxRange,
+		MaxRangeBehavior:   cfg.readMaxRangeBehavior,
+		SlowQueryThreshold: cfg.readSlowQuery,
+	}
+}
+
+// swapHandler passes log records to a handler which can be replaced while it is in use.
+// The attributes and groups added to a swapHandler are added to the replacements as well.
+type swapHandler struct {
+	root *atomic.Pointer[slog.Handler]
+	// with adds the attributes and groups of this handler to the root handler.
+	with    []func(slog.Handler) slog.Handler
+	derived atomic.Pointer[derivedHandler]
+}
+
+// derivedHandler is a root handler with the attributes and groups of a swapHandler.
+type derivedHandler struct {
+	root    *slog.Handler
+	handler slog.Handler
+}
+
+func newSwapHandler(h slog.Handler) *swapHandler {
+	s := &swapHandler{root: &atomic.Pointer[slog.Handler]{}}
+	s.set(h)
+	return s
+}
+
+// set replaces the handler records are passed to.
+func (s *swapHandler) set(h slog.Handler) {
+	s.root.Store(&h)
+}
+
+// handler returns the current root handler with the attributes and groups of s. It is
+// only derived again after the root handler was replaced.
+func (s *swapHandler) handler() slog.Handler {
+	root := s.root.Load()
+	if derived := s.derived.Load(); derived != nil && derived.root == root {
+		return derived.handler
+	}
+	h := *root
+	for _, with := range s.with {
+		h = with(h)
+	}
+	s.derived.Store(&derivedHandler{root: root, handler: h})
+	return h
+}
+
+func (s *swapHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.handler().Enabled(ctx, level)
+}
+
+func (s *swapHandler) Handle(ctx context.Context, r slog.Record) error {
+	return s.handler().Handle(ctx, r)
+}
+
+func (s *swapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return s.derive(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (s *swapHandler) WithGroup(name string) slog.Handler {
+	return s.derive(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (s *swapHandler) derive(with func(slog.Handler) slog.Handler) *swapHandler {
+	return &swapHandler{root: s.root, with: append(slices.Clip(s.with), with)}
+}
@@ -0,0 +1,194 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/stretchr/testify/assert"
+)
+
+// limitsReader is a reader recording the read limits set by reloads.
+type limitsReader struct {
+	mockReader
+	mu     sync.Mutex
+	limits bigquerydb.ReadLimits
+}
+
+func (r *limitsReader) SetReadLimits(limits bigquerydb.ReadLimits) {
+	r.mu.Lock()
+	r.limits = limits
+	r.mu.Unlock()
+}
+
+// reloadTest holds a reloader of a configuration read from a file of flags.
+type reloadTest struct {
+	t        *testing.T
+	path     string
+	logs     *bytes.Buffer
+	logger   *slog.Logger
+	reader   *limitsReader
+	cfg      *Config
+	reloader *reloader
+}
+
+func newReloadTest(t *testing.T, flags ...string) *reloadTest {
+	rt := &reloadTest{t: t, path: filepath.Join(t.TempDir(), "flags"), logs: &bytes.Buffer{}, reader: &limitsReader{}}
+	rt.writeFlags(flags...)
+	args := []string{"@" + rt.path}
+	cfg, _, err := loadConfig(args)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.promslogConfig.Writer = rt.logs
+	handler := newSwapHandler(newLogHandler(cfg))
+	rt.logger = slog.New(handler)
+	rt.cfg = testConfig(cfg)
+	rt.reloader = newReloader(*rt.logger, cfg, args, handler, []reader{rt.reader})
+	return rt
+}
+
+// writeFlags replaces the flags of the file. The flags every configuration needs are
+// added unless they are given.
+func (rt *reloadTest) writeFlags(flags ...string) {
+	for _, required := range []string{"--googleProjectID=project", "--googleAPIdatasetID=dataset", "--googleAPItableID=table"} {
+		name, _, _ := strings.Cut(required, "=")
+		if !slices.ContainsFunc(flags, func(flag string) bool { return strings.HasPrefix(flag, name+"=") }) {
+			flags = append(flags, required)
+		}
+	}
+	assert.NoError(rt.t, os.WriteFile(rt.path, []byte(strings.Join(flags, "\n")+"\n"), 0o600))
+}
+
+func TestReloadLogLevelAndReadLimits(t *testing.T) {
+	rt := newReloadTest(t, "--log.level=info")
+	storage := rt.logger.With("storage", "bigquery")
+	assert.False(t, storage.Enabled(context.Background(), slog.LevelDebug))
+	successes := counterValue(rt.cfg.metrics.configReloads.WithLabelValues("success"))
+
+	rt.writeFlags("--log.level=debug", "--read.max-samples=1000", "--read.max-range=1h", "--read.dry-run-min-range=30m")
+	assert.NoError(t, rt.reloader.reload())
+
+	// Loggers derived before the reload log with the new level.
+	assert.True(t, storage.Enabled(context.Background(), slog.LevelDebug))
+	storage.Debug("after the reload")
+	assert.Contains(t, rt.logs.String(), `msg="after the reload" storage=bigquery`)
+	assert.Contains(t, rt.logs.String(), `msg="reloaded the configuration" changed="[log.level read.dry-run-min-range read.max-range read.max-samples]"`)
+	assert.Equal(t, 1000, rt.reader.limits.MaxSamples)
+	assert.Equal(t, "1h0m0s", rt.reader.limits.MaxRange.String())
+	assert.Equal(t, "30m0s", rt.reader.limits.DryRunMinRange.String())
+	assert.Equal(t, 1000, rt.cfg.current().readMaxSamples)
+	assert.Equal(t, successes+1, counterValue(rt.cfg.metrics.configReloads.WithLabelValues("success")))
+}
+
+func TestReloadRejectsImmutableFlags(t *testing.T) {
+	rt := newReloadTest(t)
+	failures := counterValue(rt.cfg.metrics.configReloads.WithLabelValues("failure"))
+
+	rt.writeFlags("--googleAPItableID=other", "--web.listen-address=:9999", "--log.level=debug")
+	err := rt.reloader.reload()
+	assert.EqualError(t, err, "changes of googleAPItableID, web.listen-address need a restart")
+	assert.Same(t, rt.cfg, rt.cfg.current(), "the configuration is kept")
+	assert.False(t, rt.logger.Enabled(context.Background(), slog.LevelDebug))
+	assert.Equal(t, failures+1, counterValue(rt.cfg.metrics.configReloads.WithLabelValues("failure")))
+
+	rt.writeFlags("--read.max-samples=many")
+	assert.ErrorContains(t, rt.reloader.reload(), "invalid configuration")
+	assert.Same(t, rt.cfg, rt.cfg.current())
+}
+
+func TestReloadWriteSettings(t *testing.T) {
+	rt := newReloadTest(t)
+	w := &mockWriter{name: "bigquerydb"}
+	handler := writeHandler(*rt.logger, rt.cfg, []writer{w})
+	write := func() int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"), testSeries("scrape_duration_seconds"))))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, write())
+	assert.Equal(t, 2, w.series)
+
+	rt.writeFlags("--write.keep-metrics=up", "--write.rate-limit=0.001", "--write.rate-burst=1")
+	assert.NoError(t, rt.reloader.reload())
+	assert.Equal(t, http.StatusOK, write())
+	assert.Equal(t, 3, w.series, "only the kept series is written")
+	assert.Equal(t, http.StatusTooManyRequests, write(), "the rate limit applies")
+
+	// Writes see either the configuration before or after a reload.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if i%2 == 0 {
+				rt.writeFlags()
+			} else {
+				rt.writeFlags("--write.keep-metrics=up")
+			}
+			assert.NoError(t, rt.reloader.reload())
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		write()
+	}
+	wg.Wait()
+}
+
+func TestReloadHandler(t *testing.T) {
+	rt := newReloadTest(t)
+	handler := reloadHandler(rt.reloader)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+
+	rt.writeFlags("--read.require-metric-name")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rt.reader.limits.RequireMetricName)
+
+	rt.writeFlags("--googleAPIdatasetID=other")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "changes of googleAPIdatasetID need a restart\n", rec.Body.String())
+}
+
+func TestReloadEndpointOnAdminListener(t *testing.T) {
+	rt := newReloadTest(t, "--web.admin-listen-address=:9091")
+	listeners := newListeners(*rt.logger, rt.cfg, nil, nil)
+	rec := httptest.NewRecorder()
+	listeners[1].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	listeners[0].mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// maxStatusErrors is the number of errors kept for the status endpoint.
+	maxStatusErrors = 10
+	// maxStatusErrorLength is the length error messages are cut to for the status endpoint.
+	maxStatusErrorLength = 1024
+)
+
+// adapterState holds the state of the adapter the status endpoint reports, which isn't
+// tracked by the metrics.
+type adapterState struct {
+	started   time.Time
+	lastWrite atomic.Int64
+	lastRead  atomic.Int64
+
+	mu     sync.Mutex
+	errors []statusError
+}
+
+// newAdapterState returns the state of an adapter started at the time.
+func newAdapterState(started time.Time) *adapterState {
+	return &adapterState{started: started}
+}
+
+// recordWrite records a successful write request.
+func (s *adapterState) recordWrite(t time.Time) {
+	s.lastWrite.Store(t.UnixNano())
+}
+
+// recordRead records a successful read request.
+func (s *adapterState) recordRead(t time.Time) {
+	s.lastRead.Store(t.UnixNano())
+}
+
+// recordError keeps the error of a failed request, dropping the oldest error once
+// maxStatusErrors errors are kept.
+func (s *adapterState) recordError(api string, err error, t time.Time) {
+	msg := err.Error()
+	if len(msg) > maxStatusErrorLength {
+		msg = msg[:maxStatusErrorLength] + "..."
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errors) == maxStatusErrors {
+		s.errors = append(s.errors[:0], s.errors[1:]...)
+	}
+	s.errors = append(s.errors, statusError{Time: t.UTC(), API: api, Error: msg})
+}
+
+// lastErrors returns the kept errors, the most recent one first.
+func (s *adapterState) lastErrors() []statusError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]statusError, 0, len(s.errors))
+	for i := len(s.errors) - 1; i >= 0; i-- {
+		errs = append(errs, s.errors[i])
+	}
+	return errs
+}
+
+// versionHandler answers with the build information of the adapter as JSON.
+func versionHandler(logger slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(version.Info()); err != nil {
+			logger.Warn("error writing response", slog.Any("error", err))
+		}
+	}
+}
+
+// statusReporter is implemented by storages which can describe their state.
+type statusReporter interface {
+	Status() bigquerydb.ClientStatus
+}
+
+// statusResponse is the JSON answer of the status endpoint.
+type statusResponse struct {
+	Version             version.BuildInfo         `json:"version"`
+	ExternalURL         string                    `json:"external_url,omitempty"`
+	StartedAt           time.Time                 `json:"started_at"`
+	UptimeSeconds       float64                   `json:"uptime_seconds"`
+	Samples             statusSamples             `json:"samples"`
+	LastSuccessfulWrite *time.Time                `json:"last_successful_write"`
+	LastSuccessfulRead  *time.Time                `json:"last_successful_read"`
+	LastErrors          []statusError             `json:"last_errors"`
+	Storages            []bigquerydb.ClientStatus `json:"storages"`
+}
+
+// statusSamples holds the sample counts since the start of the adapter, as counted by the metrics.
+type statusSamples struct {
+	Received float64 `json:"received"`
+	Sent     float64 `json:"sent"`
+	Failed   float64 `json:"failed"`
+}
+
+type statusError struct {
+	Time  time.Time `json:"time"`
+	API   string    `json:"api"`
+	Error string    `json:"error"`
+}
+
+// statusHandler answers with the version, the external URL, the configured tables and the
+// state of the adapter as JSON. Credentials are never part of the answer.
+func statusHandler(logger slog.Logger, cfg *Config, writers []writer, readers []reader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		now := time.Now()
+		resp := statusResponse{
+			Version:       version.Info(),
+			ExternalURL:   cfg.externalURL,
+			StartedAt:     cfg.state.started.UTC(),
+			UptimeSeconds: now.Sub(cfg.state.started).Seconds(),
+			Samples: statusSamples{
+				Received: collectorSum(cfg.metrics.receivedSamples),
+				Sent:     collectorSum(cfg.metrics.sentSamples),
+				Failed:   collectorSum(cfg.metrics.failedSamples),
+			},
+			LastSuccessfulWrite: statusTime(cfg.state.lastWrite.Load()),
+			LastSuccessfulRead:  statusTime(cfg.state.lastRead.Load()),
+			LastErrors:          cfg.state.lastErrors(),
+			Storages:            storageStatuses(writers, readers),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.Warn("error writing response", slog.Any("error", err))
+		}
+	}
+}
+
+// storageStatuses returns the status of every writer and reader, once per storage.
+func storageStatuses(writers []writer, readers []reader) []bigquerydb.ClientStatus {
+	statuses := []bigquerydb.ClientStatus{}
+	seen := map[string]bool{}
+	add := func(name string, storage interface{}) {
+		reporter, ok := storage.(statusReporter)
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		statuses = append(statuses, reporter.Status())
+	}
+	for _, w := range writers {
+		add(w.Name(), w)
+	}
+	for _, r := range readers {
+		add(r.Name(), r)
+	}
+	return statuses
+}
+
+// statusTime converts a time recorded in Unix nanoseconds, which is zero if nothing was recorded yet.
+func statusTime(unixNano int64) *time.Time {
+	if unixNano == 0 {
+		return nil
+	}
+	t := time.Unix(0, unixNano).UTC()
+	return &t
+}
+
+// collectorSum returns the sum of the values of all counters of the collector.
+func collectorSum(c prometheus.Collector) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	sum := 0.0
+	for m := range ch {
+		var out dto.Metric
+		if err := m.Write(&out); err == nil {
+			sum += out.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
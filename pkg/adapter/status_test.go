@@ -0,0 +1,148 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/version"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusWriter is a mock writer reporting a status.
+type statusWriter struct {
+	mockWriter
+	status bigquerydb.ClientStatus
+}
+
+func (s *statusWriter) Status() bigquerydb.ClientStatus {
+	return s.status
+}
+
+func TestStatusHandler(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(`{"private_key": "key-file-secret"}`), 0o600))
+	cfg, err := parseTestFlags("--googleAPIjsonkeypath="+keyFile, `--googleAPIjsonkey-content={"private_key": "inline-secret"}`)
+	assert.NoError(t, err)
+	cfg.state = newAdapterState(time.Now().Add(-time.Minute))
+
+	buffered := 3
+	w := &statusWriter{
+		mockWriter: mockWriter{name: "bigquerydb"},
+		status:     bigquerydb.ClientStatus{Name: "bigquerydb", Project: "project", Dataset: "dataset", Table: "table", BufferedSamples: &buffered, CircuitBreaker: "closed"},
+	}
+	mux := http.NewServeMux()
+	registerHandlers(mux, *promslog.NewNopLogger(), cfg, []writer{w}, []reader{&mockReader{name: "bigquerydb", err: errors.New("read failed")}})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/read", strings.NewReader("not snappy")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.NotContains(t, body, "secret")
+	assert.NotContains(t, body, keyFile)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{"version", "started_at", "uptime_seconds", "samples", "last_successful_write", "last_successful_read", "last_errors", "storages"}, keys(resp))
+	assert.ElementsMatch(t, []string{"version", "branch", "revision", "build_date", "go_version"}, keys(resp["version"]))
+	assert.ElementsMatch(t, []string{"received", "sent", "failed"}, keys(resp["samples"]))
+	assert.GreaterOrEqual(t, resp["uptime_seconds"], 60.0)
+	assert.NotNil(t, resp["last_successful_write"])
+	assert.Nil(t, resp["last_successful_read"])
+
+	if errs, ok := resp["last_errors"].([]interface{}); assert.True(t, ok) && assert.Len(t, errs, 1) {
+		assert.ElementsMatch(t, []string{"time", "api", "error"}, keys(errs[0]))
+		assert.Equal(t, "read", errs[0].(map[string]interface{})["api"])
+	}
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"name": "bigquerydb", "project": "project", "dataset": "dataset", "table": "table", "buffered_samples": 3.0, "circuit_breaker": "closed",
+	}}, resp["storages"], "the storage used for writes and reads is listed once")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/status", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestStatusErrorsBounded(t *testing.T) {
+	s := &adapterState{}
+	for i := 0; i < maxStatusErrors+5; i++ {
+		s.recordError("write", fmt.Errorf("error %d", i), time.Unix(int64(i), 0))
+	}
+	s.recordError("read", errors.New(strings.Repeat("a", 2*maxStatusErrorLength)), time.Unix(100, 0))
+
+	errs := s.lastErrors()
+	assert.Len(t, errs, maxStatusErrors)
+	assert.Equal(t, "read", errs[0].API, "the most recent error comes first")
+	assert.Len(t, errs[0].Error, maxStatusErrorLength+len("..."))
+	assert.Equal(t, "error 6", errs[maxStatusErrors-1].Error)
+}
+
+// keys returns the keys of a decoded JSON object.
+func keys(v interface{}) []string {
+	var names []string
+	for name := range v.(map[string]interface{}) {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestBuildInfo(t *testing.T) {
+	info := version.Info()
+
+	families, err := testConfig(&Config{}).Gatherer.Gather()
+	assert.NoError(t, err)
+	var labels map[string]string
+	for _, mf := range families {
+		if mf.GetName() == "storage_bigquery_build_info" && assert.Len(t, mf.GetMetric(), 1) {
+			labels = map[string]string{}
+			for _, lp := range mf.GetMetric()[0].GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			assert.Equal(t, 1.0, mf.GetMetric()[0].GetGauge().GetValue())
+		}
+	}
+	assert.Equal(t, map[string]string{"version": version.Version, "revision": version.GitSHA1, "branch": version.Branch, "goversion": info.GoVersion}, labels)
+
+	mux := http.NewServeMux()
+	registerHandlers(mux, *promslog.NewNopLogger(), testConfig(&Config{writePath: defaultWritePath, readPath: defaultReadPath}), nil, nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var resp version.BuildInfo
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, info, resp)
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Response types of remote read requests. The vendored prompb predates them, so they
+// mirror the ReadRequest.ResponseType enum of newer Prometheus versions.
+const (
+	responseTypeSamples           = 0
+	responseTypeStreamedXORChunks = 1
+)
+
+const (
+	streamedContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+	// maxBytesInFrame is the default frame size of Prometheus, series with more chunks
+	// are split over several frames.
+	maxBytesInFrame = 1024 * 1024
+	// chunkEncodingXOR is the Chunk.Encoding of XOR chunks.
+	chunkEncodingXOR = 1
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// readContentType is the media type of read requests and of their responses with samples.
+const readContentType = "application/x-protobuf"
+
+// responseTypeNames names the supported response types in the order of their values.
+var responseTypeNames = []string{"SAMPLES", "STREAMED_XOR_CHUNKS"}
+
+// errNotAcceptable is returned for read requests which accept none of the supported
+// response types.
+var errNotAcceptable = errors.New("none of the accepted response types is supported, supported are " + strings.Join(responseTypeNames, ", "))
+
+// checkReadContentType returns an error if the Content-Type of a read request isn't
+// application/x-protobuf. Requests without the header are accepted.
+func checkReadContentType(r *http.Request) error {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return nil
+	}
+	if contentType, _, _ := mime.ParseMediaType(header); contentType != readContentType {
+		return fmt.Errorf("unsupported content type %q, must be %s", header, readContentType)
+	}
+	return nil
+}
+
+// acceptedMediaTypes returns which response types the Accept header of the request allows.
+// Only the media types of the responses are taken into account, so that headers without
+// them, like */* or application/json for JSON errors, allow both.
+func acceptedMediaTypes(r *http.Request) [2]bool {
+	var allowed [2]bool
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			switch {
+			case mediaType == readContentType:
+				allowed[responseTypeSamples] = true
+			case mediaType == "application/x-streamed-protobuf" && (params["proto"] == "" || params["proto"] == "prometheus.ChunkedReadResponse"):
+				allowed[responseTypeStreamedXORChunks] = true
+			}
+		}
+	}
+	if !allowed[responseTypeSamples] && !allowed[responseTypeStreamedXORChunks] {
+		return [2]bool{true, true}
+	}
+	return allowed
+}
+
+// negotiateResponseType returns the response type to answer the read request with: the
+// first of its accepted_response_types the adapter supports and the Accept header allows,
+// or samples if it has none. It returns an error wrapping errNotAcceptable if there is none.
+func negotiateResponseType(r *http.Request, accepted []uint64) (int, error) {
+	allowed := acceptedMediaTypes(r)
+	if len(accepted) == 0 {
+		accepted = []uint64{responseTypeSamples}
+	}
+	for _, t := range accepted {
+		if t < uint64(len(allowed)) && allowed[t] {
+			return int(t), nil
+		}
+	}
+	names := make([]string, len(accepted))
+	for i, t := range accepted {
+		names[i] = strconv.FormatUint(t, 10)
+		if t < uint64(len(responseTypeNames)) {
+			names[i] = responseTypeNames[t]
+		}
+	}
+	if accept := r.Header.Get("Accept"); accept != "" {
+		return 0, errors.Wrapf(errNotAcceptable, "response types [%s] with Accept %q", strings.Join(names, ", "), accept)
+	}
+	return 0, errors.Wrapf(errNotAcceptable, "response types [%s]", strings.Join(names, ", "))
+}
+
+// acceptedResponseTypes returns the accepted_response_types of an encoded read request.
+// The field is read from the encoded request, as the vendored prompb skips it.
+func acceptedResponseTypes(data []byte) ([]uint64, error) {
+	var accepted []uint64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == 2 && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			accepted = append(accepted, v)
+		case num == 2 && typ == protowire.BytesType:
+			var packed []byte
+			packed, n = protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return nil, protowire.ParseError(m)
+				}
+				accepted = append(accepted, v)
+				packed = packed[m:]
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+		}
+		data = data[n:]
+	}
+
+	return accepted, nil
+}
+
+// streamReadResponse writes the series of the response as a stream of ChunkedReadResponse
+// frames, like Prometheus answers streamed remote reads: every frame holds the XOR chunks
+// of a single series and is written as its uvarint length, its CRC32 (Castagnoli) and the
+// frame itself. The series are sorted by their labels. Every frame is flushed right away
+// and every series is released once it was written, so the encoded response is never held
+// in memory as a whole. It returns the number of bytes written.
+func streamReadResponse(w http.ResponseWriter, resp *prompb.ReadResponse) (int, error) {
+	w.Header().Set("Content-Type", streamedContentType)
+	flusher, _ := w.(http.Flusher)
+
+	var labels, chunks, frame []byte
+	size := 0
+	for i, result := range resp.Results {
+		sortSeries(result.Timeseries)
+		for j, ts := range result.Timeseries {
+			labels = labels[:0]
+			for _, l := range ts.Labels {
+				label, err := l.Marshal()
+				if err != nil {
+					return size, err
+				}
+				labels = protowire.AppendTag(labels, 1, protowire.BytesType)
+				labels = protowire.AppendBytes(labels, label)
+			}
+
+			chunks = chunks[:0]
+			for start := 0; start < len(ts.Samples); start += samplesPerChunk {
+				end := min(start+samplesPerChunk, len(ts.Samples))
+				chunks = appendChunk(chunks, ts.Samples[start:end])
+				if len(labels)+len(chunks) < maxBytesInFrame && end < len(ts.Samples) {
+					continue
+				}
+
+				frame = appendChunkedReadResponse(frame[:0], i, labels, chunks)
+				n, err := writeFrame(w, frame)
+				size += n
+				if err != nil {
+					return size, err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+				chunks = chunks[:0]
+			}
+			result.Timeseries[j] = nil
+		}
+	}
+	return size, nil
+}
+
+// appendChunk appends the samples as an encoded Chunk field of a ChunkedSeries.
+func appendChunk(dst []byte, samples []prompb.Sample) []byte {
+	var chunk []byte
+	chunk = protowire.AppendTag(chunk, 1, protowire.VarintType)
+	chunk = protowire.AppendVarint(chunk, uint64(samples[0].Timestamp))
+	chunk = protowire.AppendTag(chunk, 2, protowire.VarintType)
+	chunk = protowire.AppendVarint(chunk, uint64(samples[len(samples)-1].Timestamp))
+	chunk = protowire.AppendTag(chunk, 3, protowire.VarintType)
+	chunk = protowire.AppendVarint(chunk, chunkEncodingXOR)
+	chunk = protowire.AppendTag(chunk, 4, protowire.BytesType)
+	chunk = protowire.AppendBytes(chunk, appendXORChunk(nil, samples))
+
+	dst = protowire.AppendTag(dst, 2, protowire.BytesType)
+	return protowire.AppendBytes(dst, chunk)
+}
+
+// appendChunkedReadResponse appends a ChunkedReadResponse of a single series, given as
+// its encoded labels and chunks, to dst.
+func appendChunkedReadResponse(dst []byte, queryIndex int, labels, chunks []byte) []byte {
+	dst = protowire.AppendTag(dst, 1, protowire.BytesType)
+	dst = protowire.AppendVarint(dst, uint64(len(labels)+len(chunks)))
+	dst = append(dst, labels...)
+	dst = append(dst, chunks...)
+	if queryIndex > 0 {
+		dst = protowire.AppendTag(dst, 2, protowire.VarintType)
+		dst = protowire.AppendVarint(dst, uint64(queryIndex))
+	}
+	return dst
+}
+
+// writeFrame writes the frame with its length and checksum.
+func writeFrame(w http.ResponseWriter, frame []byte) (int, error) {
+	header := binary.AppendUvarint(nil, uint64(len(frame)))
+	header = binary.BigEndian.AppendUint32(header, crc32.Checksum(frame, castagnoliTable))
+	n, err := w.Write(header)
+	if err != nil {
+		return n, err
+	}
+	m, err := w.Write(frame)
+	return n + m, err
+}
+
+// sortSeries sorts the series by their labels, which are sorted by name, like the series
+// sets of Prometheus.
+func sortSeries(timeseries []*prompb.TimeSeries) {
+	sort.Slice(timeseries, func(i, j int) bool {
+		a, b := timeseries[i].Labels, timeseries[j].Labels
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k].Name != b[k].Name {
+				return a[k].Name < b[k].Name
+			}
+			if a[k].Value != b[k].Value {
+				return a[k].Value < b[k].Value
+			}
+		}
+		return len(a) < len(b)
+	})
+}
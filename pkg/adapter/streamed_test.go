@@ -0,0 +1,297 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// streamedReadRequest encodes a read request with the accepted response types, packed
+// like Prometheus sends them.
+func streamedReadRequest(t *testing.T, types ...uint64) []byte {
+	data, err := proto.Marshal(&prompb.ReadRequest{Queries: []*prompb.Query{{StartTimestampMs: 0, EndTimestampMs: 5000}}})
+	assert.NoError(t, err)
+	if len(types) == 0 {
+		return data
+	}
+	var packed []byte
+	for _, typ := range types {
+		packed = protowire.AppendVarint(packed, typ)
+	}
+	data = protowire.AppendTag(data, 2, protowire.BytesType)
+	return protowire.AppendBytes(data, packed)
+}
+
+func TestAcceptedResponseTypes(t *testing.T) {
+	testCases := map[string]struct {
+		data     []byte
+		expected []uint64
+		err      bool
+	}{
+		"none":      {data: streamedReadRequest(t)},
+		"packed":    {data: streamedReadRequest(t, 7, 0, 1), expected: []uint64{7, 0, 1}},
+		"unpacked":  {data: protowire.AppendVarint(protowire.AppendTag(streamedReadRequest(t), 2, protowire.VarintType), 1), expected: []uint64{1}},
+		"truncated": {data: protowire.AppendTag(streamedReadRequest(t), 2, protowire.BytesType), err: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			accepted, err := acceptedResponseTypes(testCase.data)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, accepted)
+		})
+	}
+}
+
+func TestNegotiateResponseType(t *testing.T) {
+	testCases := map[string]struct {
+		accepted []uint64
+		accept   string
+		expected int
+		err      string
+	}{
+		"none":               {expected: responseTypeSamples},
+		"samples":            {accepted: []uint64{0}, expected: responseTypeSamples},
+		"streamed":           {accepted: []uint64{1, 0}, expected: responseTypeStreamedXORChunks},
+		"first_known":        {accepted: []uint64{7, 0, 1}, expected: responseTypeSamples},
+		"unrelated_accept":   {accepted: []uint64{1}, accept: "application/json, */*", expected: responseTypeStreamedXORChunks},
+		"accept_samples":     {accepted: []uint64{1, 0}, accept: "application/x-protobuf", expected: responseTypeSamples},
+		"accept_streamed":    {accepted: []uint64{0, 1}, accept: streamedContentType, expected: responseTypeStreamedXORChunks},
+		"unsupported":        {accepted: []uint64{7}, err: "response types [7]: none of the accepted response types is supported, supported are SAMPLES, STREAMED_XOR_CHUNKS"},
+		"accept_no_overlap":  {accepted: []uint64{1}, accept: "application/x-protobuf", err: `response types [STREAMED_XOR_CHUNKS] with Accept "application/x-protobuf": none of the accepted`},
+		"accept_no_samples":  {accept: "application/x-streamed-protobuf", err: "response types [SAMPLES] with Accept"},
+		"accept_other_proto": {accepted: []uint64{1}, accept: "application/x-streamed-protobuf; proto=other.Response", expected: responseTypeStreamedXORChunks},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/read", nil)
+			if testCase.accept != "" {
+				r.Header.Set("Accept", testCase.accept)
+			}
+			typ, err := negotiateResponseType(r, testCase.accepted)
+			if testCase.err != "" {
+				assert.ErrorIs(t, err, errNotAcceptable)
+				assert.ErrorContains(t, err, testCase.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, typ)
+		})
+	}
+}
+
+func TestAppendXORChunk(t *testing.T) {
+	// Encoded by the XOR chunk appender of the Prometheus TSDB.
+	expected, err := hex.DecodeString("0006d00f3ff00000000000009875c25fff20017683bff6d23ddf0000000000976da5c0840288")
+	assert.NoError(t, err)
+	samples := []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 16000, Value: 2}, {Timestamp: 31000, Value: 2},
+		{Timestamp: 46005, Value: 2.5}, {Timestamp: 61000, Value: 100}, {Timestamp: 10000000, Value: -3}}
+	assert.Equal(t, expected, appendXORChunk(nil, samples))
+}
+
+// streamedChunk is a chunk of a decoded ChunkedReadResponse frame.
+type streamedChunk struct {
+	minTime, maxTime int64
+	data             []byte
+}
+
+// streamedSeries is the single series of a decoded ChunkedReadResponse frame.
+type streamedSeries struct {
+	labels []*prompb.Label
+	chunks []streamedChunk
+}
+
+// decodeStream decodes the frames of a streamed read response, checking their checksums.
+func decodeStream(t *testing.T, body []byte) []streamedSeries {
+	var frames []streamedSeries
+	for len(body) > 0 {
+		size, n := binary.Uvarint(body)
+		if !assert.Positive(t, n) || !assert.GreaterOrEqual(t, uint64(len(body)), uint64(n+4)+size) {
+			return nil
+		}
+		checksum := binary.BigEndian.Uint32(body[n:])
+		frame := body[n+4 : uint64(n+4)+size]
+		body = body[uint64(n+4)+size:]
+		assert.Equal(t, crc32.Checksum(frame, castagnoliTable), checksum)
+
+		num, _, m := protowire.ConsumeTag(frame)
+		assert.Equal(t, protowire.Number(1), num)
+		seriesData, k := protowire.ConsumeBytes(frame[m:])
+		assert.Len(t, frame, m+k, "a frame holds a single series of the first query")
+		frames = append(frames, decodeChunkedSeries(t, seriesData))
+	}
+	return frames
+}
+
+func decodeChunkedSeries(t *testing.T, data []byte) streamedSeries {
+	var series streamedSeries
+	for len(data) > 0 {
+		num, _, n := protowire.ConsumeTag(data)
+		value, m := protowire.ConsumeBytes(data[n:])
+		data = data[n+m:]
+		if num == 1 {
+			var l prompb.Label
+			assert.NoError(t, l.Unmarshal(value))
+			series.labels = append(series.labels, &l)
+			continue
+		}
+		var chunk streamedChunk
+		for len(value) > 0 {
+			num, typ, n := protowire.ConsumeTag(value)
+			value = value[n:]
+			if typ == protowire.BytesType {
+				chunk.data, n = protowire.ConsumeBytes(value)
+			} else {
+				var v uint64
+				v, n = protowire.ConsumeVarint(value)
+				switch num {
+				case 1:
+					chunk.minTime = int64(v)
+				case 2:
+					chunk.maxTime = int64(v)
+				case 3:
+					assert.Equal(t, uint64(chunkEncodingXOR), v)
+				}
+			}
+			value = value[n:]
+		}
+		series.chunks = append(series.chunks, chunk)
+	}
+	return series
+}
+
+func TestReadHandlerStreamed(t *testing.T) {
+	long := make([]prompb.Sample, 250)
+	for i := range long {
+		long[i] = prompb.Sample{Timestamp: int64(i) * 15000, Value: float64(i)}
+	}
+	rd := &mockReader{name: "bigquerydb", resp: readResponse(
+		seriesWithSamples("up", "web", long...),
+		seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}),
+	)}
+	handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{rd})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, streamedReadRequest(t, 1, 0)))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, streamedContentType, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.True(t, rec.Flushed)
+
+	frames := decodeStream(t, rec.Body.Bytes())
+	if !assert.Len(t, frames, 2) {
+		return
+	}
+	assert.Equal(t, []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "api"}}, frames[0].labels, "series are sorted by labels")
+	assert.Equal(t, []streamedChunk{{minTime: 1000, maxTime: 1000, data: appendXORChunk(nil, []prompb.Sample{{Timestamp: 1000, Value: 1}})}}, frames[0].chunks)
+	assert.Equal(t, "web", frames[1].labels[1].Value)
+	assert.Equal(t, []streamedChunk{
+		{minTime: 0, maxTime: 119 * 15000, data: appendXORChunk(nil, long[:120])},
+		{minTime: 120 * 15000, maxTime: 239 * 15000, data: appendXORChunk(nil, long[120:240])},
+		{minTime: 240 * 15000, maxTime: 249 * 15000, data: appendXORChunk(nil, long[240:])},
+	}, frames[1].chunks, "chunks are cut every 120 samples")
+
+}
+
+func TestReadHandlerNegotiation(t *testing.T) {
+	testCases := map[string]struct {
+		accepted    []uint64
+		contentType string
+		accept      string
+		status      int
+		expected    string
+	}{
+		"samples":             {contentType: "application/x-protobuf", status: http.StatusOK, expected: "application/x-protobuf"},
+		"without_type":        {accepted: []uint64{0}, status: http.StatusOK, expected: "application/x-protobuf"},
+		"streamed":            {accepted: []uint64{1, 0}, contentType: "application/x-protobuf", status: http.StatusOK, expected: streamedContentType},
+		"accept_samples":      {accepted: []uint64{1, 0}, accept: "application/x-protobuf", status: http.StatusOK, expected: "application/x-protobuf"},
+		"unsupported":         {accepted: []uint64{7}, status: http.StatusNotAcceptable},
+		"accept_no_overlap":   {accepted: []uint64{1}, accept: "application/x-protobuf", status: http.StatusNotAcceptable},
+		"wrong_content_type":  {contentType: "application/json", status: http.StatusUnsupportedMediaType},
+		"broken_content_type": {contentType: "x-protobuf", status: http.StatusUnsupportedMediaType},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rd := &mockReader{name: "bigquerydb", resp: readResponse(seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}))}
+			handler := readHandler(*promslog.NewNopLogger(), testConfig(&Config{readTargetPolicy: policyAll}), []reader{rd})
+
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/read", bytes.NewReader(snappy.Encode(nil, streamedReadRequest(t, testCase.accepted...))))
+			if testCase.contentType != "" {
+				r.Header.Set("Content-Type", testCase.contentType)
+			}
+			if testCase.accept != "" {
+				r.Header.Set("Accept", testCase.accept)
+			}
+			handler(rec, r)
+			assert.Equal(t, testCase.status, rec.Code)
+			switch testCase.status {
+			case http.StatusOK:
+				assert.Equal(t, testCase.expected, rec.Header().Get("Content-Type"))
+			case http.StatusNotAcceptable:
+				assert.Contains(t, rec.Body.String(), "supported are SAMPLES, STREAMED_XOR_CHUNKS")
+			case http.StatusUnsupportedMediaType:
+				assert.Contains(t, rec.Body.String(), "must be application/x-protobuf")
+			}
+		})
+	}
+}
+
+func TestStreamReadResponseSplitsFrames(t *testing.T) {
+	// Random values don't compress, so the chunks of the series exceed a frame.
+	samples := make([]prompb.Sample, 200000)
+	x := uint64(1)
+	for i := range samples {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		samples[i] = prompb.Sample{Timestamp: int64(i) * 1000, Value: float64(x)}
+	}
+	resp := readResponse(seriesWithSamples("up", "api", samples...))
+
+	rec := httptest.NewRecorder()
+	size, err := streamReadResponse(rec, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, rec.Body.Len(), size)
+	frames := decodeStream(t, rec.Body.Bytes())
+	assert.Greater(t, len(frames), 1)
+	chunks := 0
+	for _, frame := range frames {
+		assert.Equal(t, "api", frame.labels[1].Value, "every frame repeats the labels of the series")
+		chunks += len(frame.chunks)
+	}
+	assert.Equal(t, (len(samples)+samplesPerChunk-1)/samplesPerChunk, chunks)
+	assert.Nil(t, resp.Results[0].Timeseries[0], "written series are released")
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+)
+
+// Policies deciding when a write request fanned out to several targets succeeded.
+const (
+	policyAll = "all"
+	policyAny = "any"
+	// policyPrimary only takes the result of the primary table, the first writer, into account.
+	policyPrimary = "primary"
+)
+
+// failedTargetsHeader names the targets a write request failed for in its response.
+const failedTargetsHeader = "X-Failed-Targets"
+
+// bigqueryTarget is a BigQuery table written to or read from in addition to the primary table.
+type bigqueryTarget struct {
+	name      string
+	projectID string
+	datasetID string
+	tableID   string
+	timeout   time.Duration
+}
+
+// parseTarget parses a target given as comma separated key=value pairs, e.g.
+// name=archive,project=my-project,dataset=archive,table=metrics,timeout=1m.
+// The dataset and the table are required, the project and the timeout default to the
+// ones of the primary table, and the name defaults to dataset.table.
+func parseTarget(spec, defaultProjectID string, defaultTimeout time.Duration) (bigqueryTarget, error) {
+	target := bigqueryTarget{projectID: defaultProjectID, timeout: defaultTimeout}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || value == "" {
+			return bigqueryTarget{}, errors.Errorf("invalid target %q: expected key=value, got %q", spec, pair)
+		}
+		switch key {
+		case "name":
+			target.name = value
+		case "project":
+			target.projectID = value
+		case "dataset":
+			target.datasetID = value
+		case "table":
+			target.tableID = value
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return bigqueryTarget{}, errors.Wrapf(err, "invalid target %q", spec)
+			}
+			target.timeout = timeout
+		default:
+			return bigqueryTarget{}, errors.Errorf("invalid target %q: unknown key %q", spec, key)
+		}
+	}
+	if target.datasetID == "" || target.tableID == "" {
+		return bigqueryTarget{}, errors.Errorf("invalid target %q: dataset and table are required", spec)
+	}
+	if target.name == "" {
+		target.name = target.datasetID + "." + target.tableID
+	}
+	return target, nil
+}
+
+// parseTargets parses all targets and makes sure their names are unique.
+func parseTargets(specs []string, defaultProjectID string, defaultTimeout time.Duration) ([]bigqueryTarget, error) {
+	names := map[string]bool{"bigquerydb": true}
+	targets := make([]bigqueryTarget, 0, len(specs))
+	for _, spec := range specs {
+		target, err := parseTarget(spec, defaultProjectID, defaultTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if names[target.name] {
+			return nil, errors.Errorf("duplicate target name %q", target.name)
+		}
+		names[target.name] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// parseRoutes parses the routes of metrics to other tables, given as regex=table or
+// regex=dataset.table, in the order they are evaluated. The regular expression is matched
+// against the whole metric name, and the dataset defaults to the one of the primary table.
+func parseRoutes(specs []string) ([]bigquerydb.Route, error) {
+	routes := make([]bigquerydb.Route, 0, len(specs))
+	for _, spec := range specs {
+		// Table names can't contain "=", unlike regular expressions.
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 || i == len(spec)-1 {
+			return nil, errors.Errorf("invalid route %q: expected regex=table or regex=dataset.table", spec)
+		}
+		re, err := regexp.Compile("^(?:" + spec[:i] + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid route %q", spec)
+		}
+		route := bigquerydb.Route{Metric: re, TableID: spec[i+1:]}
+		if dataset, table, ok := strings.Cut(route.TableID, "."); ok {
+			if dataset == "" || table == "" {
+				return nil, errors.Errorf("invalid route %q: expected regex=table or regex=dataset.table", spec)
+			}
+			route.DatasetID, route.TableID = dataset, table
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// parseReadTable parses the table or view reads select from instead of the primary table,
+// given as table or dataset.table. The dataset defaults to the one of the primary table.
+func parseReadTable(spec, defaultDatasetID string) (string, string, error) {
+	dataset, table, ok := strings.Cut(spec, ".")
+	if !ok {
+		return defaultDatasetID, spec, nil
+	}
+	if dataset == "" || table == "" {
+		return "", "", errors.Errorf("invalid read.table-override %q: expected table or dataset.table", spec)
+	}
+	return dataset, table, nil
+}
+
+// parseResolutions parses the downsampled tables of reads, given as comma separated
+// key=value pairs, e.g. table=metrics_5m,interval=5m,min-range=6h. The table is given as
+// table or dataset.table, the dataset defaults to the one of the primary table. All keys
+// are required.
+func parseResolutions(specs []string) ([]bigquerydb.ReadResolution, error) {
+	resolutions := make([]bigquerydb.ReadResolution, 0, len(specs))
+	for _, spec := range specs {
+		var r bigquerydb.ReadResolution
+		for _, pair := range strings.Split(spec, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || value == "" {
+				return nil, errors.Errorf("invalid resolution %q: expected key=value, got %q", spec, pair)
+			}
+			var err error
+			switch key {
+			case "table":
+				r.TableID = value
+				if dataset, table, ok := strings.Cut(value, "."); ok {
+					if dataset == "" || table == "" {
+						return nil, errors.Errorf("invalid resolution %q: expected table or dataset.table", spec)
+					}
+					r.DatasetID, r.TableID = dataset, table
+				}
+			case "interval":
+				r.Interval, err = time.ParseDuration(value)
+			case "min-range":
+				r.MinRange, err = time.ParseDuration(value)
+			default:
+				return nil, errors.Errorf("invalid resolution %q: unknown key %q", spec, key)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid resolution %q", spec)
+			}
+		}
+		if r.TableID == "" || r.Interval <= 0 || r.MinRange <= 0 {
+			return nil, errors.Errorf("invalid resolution %q: table, a positive interval and a positive min-range are required", spec)
+		}
+		resolutions = append(resolutions, r)
+	}
+	return resolutions, nil
+}
+
+// writeStatus returns the status code of a write request given the errors of all writers.
+// With policyAll the request fails if any writer failed, with policyAny only if
+// all of them failed, and with policyPrimary only if the first writer failed. The status
+// of a failed request is the one of errorStatus.
+func writeStatus(errs []error, policy string) (int, error) {
+	if policy == policyPrimary && len(errs) > 0 {
+		return errorStatus(errs[:1])
+	}
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == 0 || (policy == policyAny && failed < len(errs)) {
+		return http.StatusOK, nil
+	}
+	return errorStatus(errs)
+}
+
+// targetsError is the error of a write request which failed for some of its targets.
+type targetsError struct {
+	err    error
+	failed []string
+}
+
+func (e *targetsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *targetsError) Unwrap() error {
+	return e.err
+}
+
+// writeOutcome returns the names of the writers which succeeded and which failed.
+func writeOutcome(writers []writer, errs []error) ([]string, []string) {
+	var succeeded, failed []string
+	for i, w := range writers {
+		if errs[i] != nil {
+			failed = append(failed, w.Name())
+		} else {
+			succeeded = append(succeeded, w.Name())
+		}
+	}
+	return succeeded, failed
+}
+
+// errorStatus returns the status code of a failed read or write request and the error
+// which decided it, given the errors of all readers or writers. Requests which fail the
+// same way when retried, like samples outside of the accepted time range or invalid
+// matchers, return 400, so Prometheus drops them instead of retrying, and requests which
+// are too large to ever succeed return 413. Reads over a limit return 422. Exceeded BigQuery quotas return 429, so Prometheus waits before retrying.
+// Temporary failures, like full queues or buffers, an open circuit breaker or BigQuery
+// failing on its side, return 503, so Prometheus backs off and retries. Everything else
+// returns 500.
+func errorStatus(errs []error) (int, error) {
+	classes := []struct {
+		status  int
+		matches func(error) bool
+	}{
+		{http.StatusBadRequest, func(err error) bool { return errors.Is(err, bigquerydb.ErrBadRequest) }},
+		{http.StatusRequestEntityTooLarge, func(err error) bool { return errors.Is(err, bigquerydb.ErrTooLarge) }},
+		{http.StatusUnprocessableEntity, func(err error) bool { return errors.Is(err, bigquerydb.ErrLimitExceeded) }},
+		{http.StatusTooManyRequests, bigquerydb.IsQuotaExceeded},
+		{http.StatusServiceUnavailable, bigquerydb.IsUnavailable},
+	}
+	for _, class := range classes {
+		for _, err := range errs {
+			if err != nil && class.matches(err) {
+				return class.status, err
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// writeStatusClass returns the class of a write response status counted in
+// storage_bigquery_write_responses_total.
+func writeStatusClass(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "success"
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return "rejected"
+	case http.StatusTooManyRequests:
+		return "quota_exceeded"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	return "error"
+}
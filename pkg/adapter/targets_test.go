@@ -0,0 +1,333 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseWriteTarget(t *testing.T) {
+	testCases := map[string]struct {
+		spec     string
+		expected bigqueryTarget
+		err      bool
+	}{
+		"defaults": {
+			spec:     "dataset=archive,table=metrics",
+			expected: bigqueryTarget{name: "archive.metrics", projectID: "default", datasetID: "archive", tableID: "metrics", timeout: 30 * time.Second},
+		},
+		"all_keys": {
+			spec:     "name=archive, project=other, dataset=archive, table=metrics, timeout=1m",
+			expected: bigqueryTarget{name: "archive", projectID: "other", datasetID: "archive", tableID: "metrics", timeout: time.Minute},
+		},
+		"missing_table":   {spec: "dataset=archive", err: true},
+		"unknown_key":     {spec: "dataset=archive,table=metrics,region=eu", err: true},
+		"missing_value":   {spec: "dataset=archive,table=", err: true},
+		"invalid_timeout": {spec: "dataset=archive,table=metrics,timeout=soon", err: true},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			target, err := parseTarget(testCase.spec, "default", 30*time.Second)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, target)
+		})
+	}
+}
+
+func TestParseWriteTargetsDuplicateNames(t *testing.T) {
+	_, err := parseTargets([]string{"dataset=a,table=b", "name=a.b,dataset=c,table=d"}, "", time.Second)
+	assert.ErrorContains(t, err, `duplicate target name "a.b"`)
+
+	_, err = parseTargets([]string{"name=bigquerydb,dataset=a,table=b"}, "", time.Second)
+	assert.Error(t, err)
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := parseRoutes([]string{".*_bucket=short.buckets", "http_.{1,3}=http"})
+	assert.NoError(t, err)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, "short", routes[0].DatasetID)
+		assert.Equal(t, "buckets", routes[0].TableID)
+		assert.True(t, routes[0].Metric.MatchString("latency_bucket"))
+		assert.False(t, routes[0].Metric.MatchString("latency_bucket_total"), "the regex is anchored")
+		assert.Equal(t, "", routes[1].DatasetID, "the dataset defaults to the primary one")
+		assert.Equal(t, "http", routes[1].TableID)
+		assert.True(t, routes[1].Metric.MatchString("http_up"))
+	}
+
+	for _, spec := range []string{"up", "=table", "up=", "up=.table", "up=dataset.", "(=table"} {
+		_, err := parseRoutes([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseReadTable(t *testing.T) {
+	dataset, table, err := parseReadTable("curated.metrics_view", "prometheus")
+	assert.NoError(t, err)
+	assert.Equal(t, "curated", dataset)
+	assert.Equal(t, "metrics_view", table)
+
+	dataset, table, err = parseReadTable("metrics_view", "prometheus")
+	assert.NoError(t, err)
+	assert.Equal(t, "prometheus", dataset, "the dataset defaults to the primary one")
+	assert.Equal(t, "metrics_view", table)
+
+	for _, spec := range []string{".view", "dataset."} {
+		_, _, err := parseReadTable(spec, "prometheus")
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseResolutions(t *testing.T) {
+	resolutions, err := parseResolutions([]string{"table=metrics_5m,interval=5m,min-range=6h", "min-range=168h, interval=1h, table=rollups.metrics_1h"})
+	assert.NoError(t, err)
+	assert.Equal(t, []bigquerydb.ReadResolution{
+		{TableID: "metrics_5m", Interval: 5 * time.Minute, MinRange: 6 * time.Hour},
+		{DatasetID: "rollups", TableID: "metrics_1h", Interval: time.Hour, MinRange: 168 * time.Hour},
+	}, resolutions)
+
+	for _, spec := range []string{
+		"metrics_5m",
+		"table=metrics_5m,interval=5m",
+		"table=metrics_5m,interval=0s,min-range=6h",
+		"table=metrics_5m,interval=5m,min-range=6",
+		"table=.metrics_5m,interval=5m,min-range=6h",
+		"table=metrics_5m,interval=5m,min-range=6h,step=1m",
+	} {
+		_, err := parseResolutions([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	failure := errors.New("boom")
+	queueFull := &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{bigquerydb.ErrQueueFull}}
+	circuitOpen := &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{&bigquerydb.CircuitOpenError{}}}
+	tooOld := &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{errors.Wrap(bigquerydb.ErrSampleTooOld, "sample of up")}}
+	tooNew := &bigquerydb.WriteError{FailedSamples: 1, Errors: []error{errors.Wrap(bigquerydb.ErrSampleTooNew, "sample of up")}}
+
+	testCases := map[string]struct {
+		errs     []error
+		policy   string
+		expected int
+	}{
+		"all_succeeded":        {errs: []error{nil, nil}, policy: policyAll, expected: http.StatusOK},
+		"all_one_failed":       {errs: []error{nil, failure}, policy: policyAll, expected: http.StatusInternalServerError},
+		"all_one_queue_full":   {errs: []error{queueFull, nil}, policy: policyAll, expected: http.StatusServiceUnavailable},
+		"any_one_failed":       {errs: []error{nil, failure}, policy: policyAny, expected: http.StatusOK},
+		"any_all_failed":       {errs: []error{failure, failure}, policy: policyAny, expected: http.StatusInternalServerError},
+		"any_all_queue_full":   {errs: []error{failure, queueFull}, policy: policyAny, expected: http.StatusServiceUnavailable},
+		"single_writer_failed": {errs: []error{failure}, policy: policyAny, expected: http.StatusInternalServerError},
+		"primary_succeeded":    {errs: []error{nil, failure}, policy: policyPrimary, expected: http.StatusOK},
+		"primary_failed":       {errs: []error{queueFull, nil}, policy: policyPrimary, expected: http.StatusServiceUnavailable},
+		"primary_decides":      {errs: []error{failure, tooOld}, policy: policyPrimary, expected: http.StatusInternalServerError},
+		"circuit_open":         {errs: []error{circuitOpen}, policy: policyAll, expected: http.StatusServiceUnavailable},
+		"too_old":              {errs: []error{tooOld, queueFull}, policy: policyAll, expected: http.StatusBadRequest},
+		"too_new":              {errs: []error{tooNew}, policy: policyAll, expected: http.StatusBadRequest},
+		"quota_exceeded":       {errs: []error{queueFull, quotaError("quotaExceeded")}, policy: policyAll, expected: http.StatusTooManyRequests},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			status, err := writeStatus(testCase.errs, testCase.policy)
+			assert.Equal(t, testCase.expected, status)
+			assert.Equal(t, testCase.expected != http.StatusOK, err != nil)
+		})
+	}
+}
+
+func TestWriteStatusClass(t *testing.T) {
+	for status, expected := range map[int]string{
+		http.StatusOK:                    "success",
+		http.StatusBadRequest:            "rejected",
+		http.StatusRequestEntityTooLarge: "rejected",
+		http.StatusTooManyRequests:       "quota_exceeded",
+		http.StatusServiceUnavailable:    "unavailable",
+		http.StatusInternalServerError:   "error",
+	} {
+		assert.Equal(t, expected, writeStatusClass(status))
+	}
+}
+
+// mockWriter records the series it received and fails with err.
+type mockWriter struct {
+	name     string
+	err      error
+	series   int
+	received []*prompb.TimeSeries
+}
+
+func (m *mockWriter) Write(_ context.Context, timeseries []*prompb.TimeSeries) error {
+	m.series += len(timeseries)
+	m.received = append(m.received, timeseries...)
+	return m.err
+}
+
+func (m *mockWriter) Name() string {
+	return m.name
+}
+
+func writeRequestBody(t *testing.T, timeseries ...*prompb.TimeSeries) *bytes.Reader {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: timeseries})
+	assert.NoError(t, err)
+	return bytes.NewReader(snappy.Encode(nil, data))
+}
+
+func TestWriteHandlerFanOut(t *testing.T) {
+	testCases := map[string]struct {
+		policy   string
+		failing  []bool
+		expected int
+	}{
+		"all_succeeded":         {policy: policyAll, failing: []bool{false, false, false}, expected: http.StatusOK},
+		"all_archive_failed":    {policy: policyAll, failing: []bool{false, true, false}, expected: http.StatusInternalServerError},
+		"any_archive_failed":    {policy: policyAny, failing: []bool{false, true, false}, expected: http.StatusOK},
+		"any_primary_failed":    {policy: policyAny, failing: []bool{true, false, true}, expected: http.StatusOK},
+		"any_all_failed":        {policy: policyAny, failing: []bool{true, true, true}, expected: http.StatusInternalServerError},
+		"primary_others_failed": {policy: policyPrimary, failing: []bool{false, true, true}, expected: http.StatusOK},
+		"primary_failed":        {policy: policyPrimary, failing: []bool{true, false, false}, expected: http.StatusInternalServerError},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var writers []writer
+			var failed []string
+			for i, name := range []string{"bigquerydb", "archive", "mirror"} {
+				w := &mockWriter{name: name}
+				if testCase.failing[i] {
+					w.err = errors.New(name + " unavailable")
+					failed = append(failed, name)
+				}
+				writers = append(writers, w)
+			}
+			handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: testCase.policy, jsonErrors: true}), writers)
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"), testSeries("down"))))
+
+			assert.Equal(t, testCase.expected, rec.Code)
+			for _, w := range writers {
+				assert.Equal(t, 2, w.(*mockWriter).series, "every writer is written to")
+			}
+			assert.Equal(t, strings.Join(failed, ","), rec.Header().Get(failedTargetsHeader))
+			if testCase.expected != http.StatusOK {
+				var body apiError
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.Equal(t, strings.Join(failed, ","), body.Details["failedTargets"])
+			}
+		})
+	}
+}
+
+func TestWriteHandlerLogsOutcome(t *testing.T) {
+	var logs bytes.Buffer
+	hot := &mockWriter{name: "hot"}
+	archive := &mockWriter{name: "archive", err: errors.New("archive unavailable")}
+	handler := writeHandler(*slog.New(slog.NewJSONHandler(&logs, nil)), testConfig(&Config{writeTargetPolicy: policyAny}), []writer{hot, archive})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+
+	found := false
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["msg"] == "write request fanned out" {
+			found = true
+			assert.Equal(t, "WARN", line["level"])
+			assert.Equal(t, []interface{}{"hot"}, line["succeeded"])
+			assert.Equal(t, []interface{}{"archive"}, line["failed"])
+			assert.Equal(t, float64(http.StatusOK), line["status"])
+		}
+	}
+	assert.True(t, found, "the outcome of every writer is logged")
+}
+
+func TestWriteHandlerDurationPerWriter(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll})
+	durationCount := func(remote string) float64 {
+		value, _ := gatheredValue(t, cfg, "storage_bigquery_write_api_seconds", map[string]string{"remote": remote, "tenant": ""})
+		return value
+	}
+	hot := &mockWriter{name: "duration-hot"}
+	archive := &mockWriter{name: "duration-archive", err: errors.New("archive unavailable")}
+	hotBefore, archiveBefore := durationCount(hot.name), durationCount(archive.name)
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{hot, archive})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, hotBefore+1, durationCount(hot.name))
+	assert.Equal(t, archiveBefore+1, durationCount(archive.name), "failed writes are observed as well")
+}
+
+func TestWriteHandlerLogsTraceIDs(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(&logs, nil)))
+	archive := &mockWriter{name: "archive", err: errors.New("archive unavailable")}
+	handler := writeHandler(*logger, testConfig(&Config{writeTargetPolicy: policyAll}), []writer{archive})
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up")))
+	handler(httptest.NewRecorder(), req.WithContext(trace.ContextWithSpanContext(req.Context(), sc)))
+
+	found := false
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		if line["msg"] == "error sending samples to remote storage" {
+			found = true
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line["trace_id"])
+			assert.Equal(t, "00f067aa0ba902b7", line["span_id"])
+		}
+	}
+	assert.True(t, found, "the failed write is logged")
+}
+
+func TestWriteHandlerWithoutWriters(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll}), nil)(rec,
+		httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/pkg/errors"
+)
+
+// tenantHeader is the header Cortex and Mimir compatible clients send their tenant in.
+const tenantHeader = "X-Scope-OrgID"
+
+// requestTenant returns the context of the request with its tenant and the tenant, which
+// is taken from the X-Scope-OrgID header or else the default tenant. Without tenancy the
+// tenant is empty. A request without a tenant is answered with 401 by reply, in which case
+// it returns false.
+func requestTenant(w http.ResponseWriter, r *http.Request, cfg *Config, api string, reply replyFunc) (context.Context, string, bool) {
+	if !cfg.tenancyEnabled {
+		return r.Context(), "", true
+	}
+	tenant := r.Header.Get(tenantHeader)
+	if tenant == "" {
+		tenant = cfg.tenancyDefaultTenant
+	}
+	if tenant == "" {
+		reply(w, errors.Errorf("no tenant given in the %s header", tenantHeader), http.StatusUnauthorized)
+		cfg.metrics.rejectedRequests.WithLabelValues(api, "no_tenant").Inc()
+		return nil, "", false
+	}
+	return bigquerydb.ContextWithTenant(r.Context(), tenant), tenant, true
+}
@@ -0,0 +1,122 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+// tenantWriter records the tenants of the writes.
+type tenantWriter struct {
+	tenants []string
+}
+
+func (w *tenantWriter) Write(ctx context.Context, _ []*prompb.TimeSeries) error {
+	tenant, _ := bigquerydb.TenantFromContext(ctx)
+	w.tenants = append(w.tenants, tenant)
+	return nil
+}
+
+func (w *tenantWriter) Name() string {
+	return "bigquerydb"
+}
+
+// tenantReader records the tenants of the reads.
+type tenantReader struct {
+	tenants []string
+}
+
+func (rd *tenantReader) Read(ctx context.Context, _ *prompb.ReadRequest) (*prompb.ReadResponse, error) {
+	tenant, _ := bigquerydb.TenantFromContext(ctx)
+	rd.tenants = append(rd.tenants, tenant)
+	return readResponse(), nil
+}
+
+func (rd *tenantReader) Name() string {
+	return "bigquerydb"
+}
+
+func TestWriteHandlerTenant(t *testing.T) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, tenancyEnabled: true})
+	w := &tenantWriter{}
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	rejected := counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "no_tenant"))
+
+	req := httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up")))
+	req.Header.Set(tenantHeader, "team-a")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, testSeries("up"))))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, rejected+1, counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "no_tenant")))
+
+	cfg.tenancyDefaultTenant = "shared"
+	sent := counterValue(cfg.metrics.sentSamples.WithLabelValues("bigquerydb", "shared"))
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, seriesWithSamples("up", "api", prompb.Sample{Timestamp: 1000, Value: 1}))))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"team-a", "shared"}, w.tenants)
+	assert.Equal(t, sent+1, counterValue(cfg.metrics.sentSamples.WithLabelValues("bigquerydb", "shared")))
+}
+
+func TestReadHandlerTenant(t *testing.T) {
+	cfg := testConfig(&Config{readTargetPolicy: policyAll, tenancyEnabled: true})
+	rd := &tenantReader{}
+	handler := readHandler(*promslog.NewNopLogger(), cfg, []reader{rd})
+
+	req := httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t))
+	req.Header.Set(tenantHeader, "team-a")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, []string{"team-a"}, rd.tenants, "reads without a tenant aren't run")
+
+	cfg.tenancyEnabled = false
+	req = httptest.NewRequest(http.MethodPost, "/read", readRequestBody(t))
+	req.Header.Set(tenantHeader, "team-a")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"team-a", ""}, rd.tenants, "the header is ignored without tenancy")
+}
+
+func TestTenancyFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.tenancyEnabled)
+	assert.Empty(t, cfg.tenancyDefaultTenant)
+
+	t.Setenv("PROMBQ_TENANCY_DEFAULT_TENANT", "shared")
+	cfg, err = parseTestFlags("--tenancy.enabled")
+	assert.NoError(t, err)
+	assert.True(t, cfg.tenancyEnabled)
+	assert.Equal(t, "shared", cfg.tenancyDefaultTenant)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Reasons of invalid series.
+const (
+	invalidMissingMetricName  = "missing_metric_name"
+	invalidMetricName         = "invalid_metric_name"
+	invalidEmptyLabelName     = "empty_label_name"
+	invalidLabelName          = "invalid_label_name"
+	invalidDuplicateLabelName = "duplicate_label_name"
+	invalidLabelValue         = "invalid_label_value"
+)
+
+// invalidSeriesError describes why a series of a write request is invalid.
+type invalidSeriesError struct {
+	reason string
+	msg    string
+}
+
+func (e *invalidSeriesError) Error() string {
+	return e.msg
+}
+
+// validateSeries checks the label set of a series and sorts its labels by name, as
+// rows of unsorted or malformed label sets can't be matched by reads. The series must
+// have a metric name and unique label names, which are valid in the legacy charset of
+// Prometheus unless allowUTF8 is set, and label values must be valid UTF-8.
+func validateSeries(ts *prompb.TimeSeries, allowUTF8 bool) error {
+	if !sort.SliceIsSorted(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name }) {
+		sort.SliceStable(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+	}
+
+	var metricName string
+	for i, l := range ts.Labels {
+		switch {
+		case l.Name == "":
+			return &invalidSeriesError{reason: invalidEmptyLabelName, msg: "series has a label with an empty name"}
+		case i > 0 && l.Name == ts.Labels[i-1].Name:
+			return &invalidSeriesError{reason: invalidDuplicateLabelName, msg: fmt.Sprintf("series has the label %q more than once", l.Name)}
+		case !validName(l.Name, allowUTF8, model.LabelName(l.Name).IsValidLegacy):
+			return &invalidSeriesError{reason: invalidLabelName, msg: fmt.Sprintf("series has the invalid label name %q", l.Name)}
+		case !utf8.ValidString(l.Value):
+			return &invalidSeriesError{reason: invalidLabelValue, msg: fmt.Sprintf("the value of label %q isn't valid UTF-8", l.Name)}
+		}
+		if l.Name == model.MetricNameLabel {
+			metricName = l.Value
+		}
+	}
+
+	if metricName == "" {
+		return &invalidSeriesError{reason: invalidMissingMetricName, msg: "series has no metric name"}
+	}
+	if !validName(metricName, allowUTF8, func() bool { return model.IsValidLegacyMetricName(metricName) }) {
+		return &invalidSeriesError{reason: invalidMetricName, msg: fmt.Sprintf("series has the invalid metric name %q", metricName)}
+	}
+	return nil
+}
+
+// validName returns whether the name is valid UTF-8 if UTF-8 names are allowed, and valid
+// in the legacy charset otherwise.
+func validName(name string, allowUTF8 bool, validLegacy func() bool) bool {
+	if allowUTF8 {
+		return utf8.ValidString(name)
+	}
+	return validLegacy()
+}
+
+// validateStaticLabels checks the names and values of the static labels added to every
+// written series, by the same rules as the labels of the series. Names starting with two
+// underscores are reserved, like __name__ and the tenant label.
+func validateStaticLabels(labels map[string]string, allowUTF8 bool) error {
+	for name, value := range labels {
+		switch {
+		case name == "":
+			return errors.New("write.static-label has a label with an empty name")
+		case strings.HasPrefix(name, "__"):
+			return errors.Errorf("write.static-label has the reserved label name %q", name)
+		case !validName(name, allowUTF8, model.LabelName(name).IsValidLegacy):
+			return errors.Errorf("write.static-label has the invalid label name %q", name)
+		case !utf8.ValidString(value):
+			return errors.Errorf("the value of the static label %q isn't valid UTF-8", name)
+		}
+	}
+	return nil
+}
+
+// validateWriteRequest validates the series of a write request in place. Invalid series
+// are counted by reason and dropped, or in strict mode the first of them is returned as
+// error.
+func validateWriteRequest(m *metrics, timeseries []*prompb.TimeSeries, strict, allowUTF8 bool) ([]*prompb.TimeSeries, error) {
+	valid := timeseries[:0]
+	for _, ts := range timeseries {
+		err := validateSeries(ts, allowUTF8)
+		if err == nil {
+			valid = append(valid, ts)
+			continue
+		}
+		m.invalidSeries.WithLabelValues(err.(*invalidSeriesError).reason).Inc()
+		if strict {
+			return nil, err
+		}
+	}
+	clear(timeseries[len(valid):])
+	return valid, nil
+}
@@ -0,0 +1,124 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSeries(t *testing.T) {
+	testCases := map[string]struct {
+		labels    []*prompb.Label
+		allowUTF8 bool
+		reason    string
+	}{
+		"valid":              {labels: testSeries("up", "job", "api").Labels},
+		"unsorted":           {labels: []*prompb.Label{{Name: "job", Value: "api"}, {Name: "__name__", Value: "up"}}},
+		"missing_name":       {labels: []*prompb.Label{{Name: "job", Value: "api"}}, reason: invalidMissingMetricName},
+		"empty_name":         {labels: testSeries("").Labels, reason: invalidMissingMetricName},
+		"invalid_name":       {labels: testSeries("http.requests").Labels, reason: invalidMetricName},
+		"utf8_name":          {labels: testSeries("http.requests", "service.name", "api").Labels, allowUTF8: true},
+		"empty_label":        {labels: testSeries("up", "", "api").Labels, reason: invalidEmptyLabelName},
+		"duplicate_label":    {labels: testSeries("up", "job", "api", "job", "web").Labels, reason: invalidDuplicateLabelName},
+		"unsorted_duplicate": {labels: testSeries("up", "job", "api", "instance", "a", "job", "api").Labels, reason: invalidDuplicateLabelName},
+		"invalid_label":      {labels: testSeries("up", "service.name", "api").Labels, reason: invalidLabelName},
+		"digit_label":        {labels: testSeries("up", "0job", "api").Labels, reason: invalidLabelName},
+		"invalid_utf8_name":  {labels: testSeries("up", "job\xff", "api").Labels, allowUTF8: true, reason: invalidLabelName},
+		"invalid_value":      {labels: testSeries("up", "job", "a\xffi").Labels, allowUTF8: true, reason: invalidLabelValue},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ts := &prompb.TimeSeries{Labels: testCase.labels}
+			err := validateSeries(ts, testCase.allowUTF8)
+			if testCase.reason == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, "__name__", ts.Labels[0].Name, "labels are sorted by name")
+				return
+			}
+			var invalid *invalidSeriesError
+			if assert.ErrorAs(t, err, &invalid) {
+				assert.Equal(t, testCase.reason, invalid.reason)
+			}
+		})
+	}
+}
+
+func TestWriteHandlerValidation(t *testing.T) {
+	sample := prompb.Sample{Timestamp: 1000, Value: 1}
+	series := func() []*prompb.TimeSeries {
+		return []*prompb.TimeSeries{
+			seriesWithSamples("up", "api", sample),
+			{Labels: []*prompb.Label{{Name: "job", Value: "web"}}, Samples: []prompb.Sample{sample}},
+			seriesWithSamples("up", "web", sample),
+		}
+	}
+
+	w := &mockWriter{name: "bigquerydb"}
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll})
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	invalid := counterValue(cfg.metrics.invalidSeries.WithLabelValues(invalidMissingMetricName))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series()...)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, w.series, "invalid series are dropped")
+	assert.Equal(t, invalid+1, counterValue(cfg.metrics.invalidSeries.WithLabelValues(invalidMissingMetricName)))
+
+	w = &mockWriter{name: "bigquerydb"}
+	cfg.writeStrict = true
+	handler = writeHandler(*promslog.NewNopLogger(), cfg, []writer{w})
+	rejected := counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "invalid_series"))
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series()...)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "series has no metric name")
+	assert.Zero(t, w.series, "nothing is written of a rejected request")
+	assert.Equal(t, rejected+1, counterValue(cfg.metrics.rejectedRequests.WithLabelValues("write", "invalid_series")))
+	assert.Equal(t, invalid+2, counterValue(cfg.metrics.invalidSeries.WithLabelValues(invalidMissingMetricName)))
+}
+
+func TestValidationFlags(t *testing.T) {
+	cfg, err := parseTestFlags()
+	assert.NoError(t, err)
+	assert.False(t, cfg.writeStrict)
+	assert.False(t, cfg.writeAllowUTF8Names)
+
+	cfg, err = parseTestFlags("--write.strict-validation", "--write.allow-utf8-names")
+	assert.NoError(t, err)
+	assert.True(t, cfg.writeStrict)
+	assert.True(t, cfg.writeAllowUTF8Names)
+}
+
+func TestValidateStaticLabels(t *testing.T) {
+	assert.NoError(t, validateStaticLabels(map[string]string{"cluster": "eu-west1", "env": ""}, false))
+	assert.NoError(t, validateStaticLabels(map[string]string{"cluster.name": "eu"}, true))
+
+	for name, labels := range map[string]map[string]string{
+		"empty_name":    {"": "eu"},
+		"reserved_name": {"__tenant__": "team-a"},
+		"metric_name":   {"__name__": "up"},
+		"legacy_name":   {"cluster.name": "eu"},
+		"invalid_value": {"cluster": "bad \xff"},
+	} {
+		assert.Error(t, validateStaticLabels(labels, false), name)
+	}
+}
@@ -0,0 +1,155 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+	http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/bigquerydb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// discardInserter accepts all rows without sending them anywhere.
+type discardInserter struct{}
+
+func (discardInserter) Put(context.Context, interface{}) error {
+	return nil
+}
+
+// syntheticWriteRequest returns a snappy compressed write request with the given number
+// of series, each with the given number of samples, like a remote write shard sends them.
+func syntheticWriteRequest(tb testing.TB, series, samples int) []byte {
+	req := &prompb.WriteRequest{Timeseries: make([]*prompb.TimeSeries, 0, series)}
+	for i := 0; i < series; i++ {
+		ts := &prompb.TimeSeries{Labels: []*prompb.Label{
+			{Name: "__name__", Value: "http_requests_total"},
+			{Name: "instance", Value: fmt.Sprintf("10.0.%d.%d:8080", i/256, i%256)},
+			{Name: "job", Value: "api"},
+			{Name: "method", Value: "GET"},
+		}}
+		for j := 0; j < samples; j++ {
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: int64(1000 * j), Value: float64(i * j)})
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return snappy.Encode(nil, data)
+}
+
+// BenchmarkWriteHandler sends write requests of 2000 series with 5 samples each through
+// the write handler into a client which discards the rows.
+func BenchmarkWriteHandler(b *testing.B) {
+	c, err := bigquerydb.NewClient(promslog.NewNopLogger(), "", "project", "dataset", "table", time.Minute,
+		bigquerydb.WithEndpoint("http://localhost:9050"), bigquerydb.WithInserter(discardInserter{}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll, maxRequestSize: 64 << 20}), []writer{c})
+	body := syntheticWriteRequest(b, 2000, 5)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			b.Fatal(rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// BenchmarkWriteHandlerNoop sends the write requests of BenchmarkWriteHandler into the
+// noop storage, which only leaves the decoding and handling of the requests.
+func BenchmarkWriteHandlerNoop(b *testing.B) {
+	cfg := testConfig(&Config{writeTargetPolicy: policyAll, maxRequestSize: 64 << 20, storage: storageNoop})
+	writers, _ := noopClients(*promslog.NewNopLogger(), cfg)
+	handler := writeHandler(*promslog.NewNopLogger(), cfg, writers)
+	body := syntheticWriteRequest(b, 2000, 5)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/write", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			b.Fatal(rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// requestCheckingWriter fails the test if a write mixes the series of different requests.
+// The value of the samples is the number of series of the request.
+type requestCheckingWriter struct {
+	t *testing.T
+}
+
+func (w *requestCheckingWriter) Write(_ context.Context, timeseries []*prompb.TimeSeries) error {
+	request := timeseries[0].Labels[1].Value
+	for _, ts := range timeseries {
+		if ts.Labels[1].Value != request || ts.Samples[0].Value != float64(len(timeseries)) {
+			w.t.Errorf("series %v in write of request %s", ts.Labels, request)
+		}
+	}
+	return nil
+}
+
+func (w *requestCheckingWriter) Name() string {
+	return "bigquerydb"
+}
+
+func TestWriteHandlerConcurrentRequests(t *testing.T) {
+	handler := writeHandler(*promslog.NewNopLogger(), testConfig(&Config{writeTargetPolicy: policyAll}), []writer{&requestCheckingWriter{t: t}})
+
+	done := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			defer func() { done <- struct{}{} }()
+			// Requests of different sizes make pooled buffers be reused with leftovers.
+			request := fmt.Sprintf("request-%d", i)
+			series := make([]*prompb.TimeSeries, 0, 10*(i+1))
+			for j := 0; j < cap(series); j++ {
+				series = append(series, &prompb.TimeSeries{
+					Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "request", Value: request}},
+					Samples: []prompb.Sample{{Timestamp: int64(j), Value: float64(cap(series))}},
+				})
+			}
+			for k := 0; k < 20; k++ {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodPost, "/write", writeRequestBody(t, series...)))
+				if rec.Code != http.StatusOK {
+					t.Errorf("unexpected status %d", rec.Code)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+}
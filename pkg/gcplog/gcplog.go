@@ -0,0 +1,132 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gcplog writes logs as the structured JSON Google Cloud Logging parses from the
+// output of containers, see https://cloud.google.com/logging/docs/structured-logging.
+package gcplog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Fields of log entries with a special meaning to Cloud Logging.
+const (
+	SeverityKey       = "severity"
+	MessageKey        = "message"
+	TimeKey           = "time"
+	SourceLocationKey = "logging.googleapis.com/sourceLocation"
+	TraceKey          = "logging.googleapis.com/trace"
+	SpanIDKey         = "logging.googleapis.com/spanId"
+	TraceSampledKey   = "logging.googleapis.com/trace_sampled"
+)
+
+// Severity returns the Cloud Logging severity of the level.
+func Severity(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
+
+// Handler writes every record as a line of JSON with its level as severity, its message
+// as message and its source as sourceLocation. Records logged with a context carrying a
+// valid span are linked to their trace in Cloud Trace; the trace_id and span_id attributes
+// of the tracing package are replaced by the fields of Cloud Logging. All other attributes
+// are written like slog.JSONHandler writes them.
+type Handler struct {
+	slog.Handler
+	projectID string
+}
+
+// NewHandler returns a handler writing the records of at least the level to w. Traces are
+// only linked with a projectID, the project of Cloud Trace.
+func NewHandler(w io.Writer, level slog.Leveler, projectID string) *Handler {
+	return &Handler{
+		Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			AddSource:   true,
+			ReplaceAttr: replaceAttr,
+		}),
+		projectID: projectID,
+	}
+}
+
+// replaceAttr renames the built-in attributes of records to the fields of Cloud Logging.
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			return slog.String(SeverityKey, Severity(level))
+		}
+	case slog.MessageKey:
+		a.Key = MessageKey
+	case slog.TimeKey:
+		a.Key = TimeKey
+	case slog.SourceKey:
+		if source, ok := a.Value.Any().(*slog.Source); ok {
+			// The line is an int64, which the API encodes as a string.
+			return slog.Group(SourceLocationKey,
+				slog.String("file", source.File),
+				slog.String("line", strconv.Itoa(source.Line)),
+				slog.String("function", source.Function))
+		}
+	}
+	return a
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	sc := trace.SpanContextFromContext(ctx)
+	if h.projectID == "" || !sc.IsValid() {
+		return h.Handler.Handle(ctx, r)
+	}
+	traced := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != tracing.TraceIDKey && a.Key != tracing.SpanIDKey {
+			traced.AddAttrs(a)
+		}
+		return true
+	})
+	traced.AddAttrs(
+		slog.String(TraceKey, fmt.Sprintf("projects/%s/traces/%s", h.projectID, sc.TraceID())),
+		slog.String(SpanIDKey, sc.SpanID().String()),
+		slog.Bool(TraceSampledKey, sc.IsSampled()),
+	)
+	return h.Handler.Handle(ctx, traced)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs), projectID: h.projectID}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name), projectID: h.projectID}
+}
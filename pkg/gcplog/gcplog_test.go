@@ -0,0 +1,144 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcplog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// entries returns the log entries written to the buffer, one per line.
+func entries(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry), scanner.Text())
+		out = append(out, entry)
+	}
+	return out
+}
+
+// spanContext returns a context carrying a sampled span.
+func spanContext(t *testing.T) context.Context {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	assert.NoError(t, err)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestSeverity(t *testing.T) {
+	for level, severity := range map[slog.Level]string{
+		slog.LevelDebug - 4: "DEBUG",
+		slog.LevelDebug:     "DEBUG",
+		slog.LevelInfo:      "INFO",
+		slog.LevelInfo + 2:  "INFO",
+		slog.LevelWarn:      "WARNING",
+		slog.LevelError:     "ERROR",
+		slog.LevelError + 4: "ERROR",
+	} {
+		assert.Equal(t, severity, Severity(level), level.String())
+	}
+}
+
+func TestHandlerFields(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewHandler(&logs, slog.LevelDebug, "project")).With("component", "test")
+	logger.Debug("debug message", "rows", 3)
+	logger.Info("info message")
+	logger.Warn("warn message")
+	logger.Error("error message", "error", "boom")
+
+	logged := entries(t, &logs)
+	if !assert.Len(t, logged, 4) {
+		return
+	}
+	for i, severity := range []string{"DEBUG", "INFO", "WARNING", "ERROR"} {
+		entry := logged[i]
+		assert.Equal(t, severity, entry[SeverityKey])
+		assert.Equal(t, strings.ToLower(strings.TrimSuffix(severity, "ING"))+" message", entry[MessageKey])
+		assert.NotEmpty(t, entry[TimeKey])
+		assert.Equal(t, "test", entry["component"])
+		assert.NotContains(t, entry, slog.LevelKey)
+		assert.NotContains(t, entry, slog.MessageKey)
+		assert.NotContains(t, entry, TraceKey, "no trace without a span")
+
+		source, ok := entry[SourceLocationKey].(map[string]interface{})
+		if assert.True(t, ok, "source location of %v", entry) {
+			assert.True(t, strings.HasSuffix(source["file"].(string), "gcplog_test.go"))
+			assert.NotEmpty(t, source["line"])
+			assert.Contains(t, source["function"], "TestHandlerFields")
+		}
+	}
+	assert.Equal(t, 3.0, logged[0]["rows"])
+	assert.Equal(t, "boom", logged[3]["error"])
+}
+
+func TestHandlerLevel(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewHandler(&logs, slog.LevelWarn, ""))
+	logger.Info("dropped")
+	logger.Warn("kept")
+	logged := entries(t, &logs)
+	if assert.Len(t, logged, 1) {
+		assert.Equal(t, "kept", logged[0][MessageKey])
+	}
+}
+
+func TestHandlerTrace(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(tracing.NewLogHandler(NewHandler(&logs, slog.LevelInfo, "my-project")))
+	logger.InfoContext(spanContext(t), "traced", "table", "metrics")
+
+	logged := entries(t, &logs)
+	if !assert.Len(t, logged, 1) {
+		return
+	}
+	entry := logged[0]
+	assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry[TraceKey])
+	assert.Equal(t, "00f067aa0ba902b7", entry[SpanIDKey])
+	assert.Equal(t, true, entry[TraceSampledKey])
+	assert.Equal(t, "metrics", entry["table"])
+	assert.NotContains(t, entry, tracing.TraceIDKey, "replaced by the trace field")
+	assert.NotContains(t, entry, tracing.SpanIDKey)
+}
+
+func TestHandlerTraceWithoutProject(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(tracing.NewLogHandler(NewHandler(&logs, slog.LevelInfo, "")))
+	logger.InfoContext(spanContext(t), "traced")
+
+	logged := entries(t, &logs)
+	if !assert.Len(t, logged, 1) {
+		return
+	}
+	assert.NotContains(t, logged[0], TraceKey)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logged[0][tracing.TraceIDKey], "the IDs of the span are kept")
+}
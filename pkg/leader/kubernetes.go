@@ -0,0 +1,265 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// serviceAccountDir holds the credentials Kubernetes mounts into every pod.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// microTime is the format of the times of a Lease.
+	microTime = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// KubernetesLock is a Lease of the coordination.k8s.io/v1 API, like the ones of the
+// leader election of client-go. Leases of other holders are considered expired when they
+// weren't renewed for their duration since this replica saw them change, so that the
+// clocks of the replicas don't need to agree.
+type KubernetesLock struct {
+	client    *http.Client
+	host      string
+	token     func() (string, error)
+	namespace string
+	name      string
+	now       func() time.Time
+
+	mu sync.Mutex
+	// observed is the last seen lease of another holder and observedAt when it was seen
+	// changing.
+	observed   leaseSpec
+	observedAt time.Time
+}
+
+// lease is a Lease object. The metadata is kept as is, so that an update doesn't drop
+// fields like the labels.
+type lease struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Spec       leaseSpec              `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// NewKubernetesLock returns the lock of the Lease with the name in the namespace, which
+// is the one of the pod if empty. It talks to the API server with the service account of
+// the pod, which needs to get, create and update leases.
+func NewKubernetesLock(namespace, name string) (*KubernetesLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set")
+	}
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the namespace of the pod")
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the CA of the API server")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid CA of the API server")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &KubernetesLock{
+		client:    &http.Client{Transport: transport},
+		host:      "https://" + net.JoinHostPort(host, port),
+		token:     serviceAccountToken,
+		namespace: namespace,
+		name:      name,
+		now:       time.Now,
+	}, nil
+}
+
+// serviceAccountToken reads the token of the pod on every request, as it's rotated.
+func serviceAccountToken() (string, error) {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the service account token")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// String returns the namespace and name of the lease.
+func (l *KubernetesLock) String() string {
+	return l.namespace + "/" + l.name
+}
+
+// Acquire implements Lock.
+func (l *KubernetesLock) Acquire(ctx context.Context, holder string, leaseDuration time.Duration) (bool, error) {
+	now := l.now()
+	current, status, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	spec := leaseSpec{
+		HolderIdentity:       holder,
+		LeaseDurationSeconds: int(math.Ceil(leaseDuration.Seconds())),
+		AcquireTime:          now.UTC().Format(microTime),
+		RenewTime:            now.UTC().Format(microTime),
+	}
+	if status == http.StatusNotFound {
+		created := &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease", Metadata: map[string]interface{}{"name": l.name, "namespace": l.namespace}, Spec: spec}
+		return l.send(ctx, http.MethodPost, l.url(false), created)
+	}
+
+	if holding := current.Spec.HolderIdentity; holding != holder {
+		if holding != "" && !l.expired(current.Spec, now) {
+			return false, nil
+		}
+		spec.LeaseTransitions = current.Spec.LeaseTransitions + 1
+	} else {
+		spec.AcquireTime = current.Spec.AcquireTime
+		spec.LeaseTransitions = current.Spec.LeaseTransitions
+	}
+	current.Spec = spec
+	return l.send(ctx, http.MethodPut, l.url(true), current)
+}
+
+// Release implements Lock. The lease is kept with an empty holder, which other replicas
+// take right away.
+func (l *KubernetesLock) Release(ctx context.Context, holder string) error {
+	current, status, err := l.get(ctx)
+	if err != nil || status == http.StatusNotFound || current.Spec.HolderIdentity != holder {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = l.now().UTC().Format(microTime)
+	_, err = l.send(ctx, http.MethodPut, l.url(true), current)
+	return err
+}
+
+// expired returns whether the lease of another holder wasn't renewed for its duration
+// since it was first seen with its current renew time.
+func (l *KubernetesLock) expired(spec leaseSpec, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if spec != l.observed {
+		l.observed, l.observedAt = spec, now
+	}
+	return now.Sub(l.observedAt) > time.Duration(spec.LeaseDurationSeconds)*time.Second
+}
+
+// url returns the URL of the leases of the namespace, or of the lease itself.
+func (l *KubernetesLock) url(named bool) string {
+	u := fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.host, url.PathEscape(l.namespace))
+	if named {
+		u += "/" + url.PathEscape(l.name)
+	}
+	return u
+}
+
+// get returns the lease and the status code of the response, which is 404 if the lease
+// doesn't exist.
+func (l *KubernetesLock) get(ctx context.Context) (*lease, int, error) {
+	resp, err := l.do(ctx, http.MethodGet, l.url(true), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp.StatusCode, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, statusError(resp)
+	}
+	var current lease
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		return nil, resp.StatusCode, errors.Wrapf(err, "failed to decode lease %s", l)
+	}
+	return &current, resp.StatusCode, nil
+}
+
+// send creates or updates the lease. It returns false if another replica changed it
+// first, which the API server answers with 409.
+func (l *KubernetesLock) send(ctx context.Context, method, u string, body *lease) (bool, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+	resp, err := l.do(ctx, method, u, data)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+	return false, statusError(resp)
+}
+
+func (l *KubernetesLock) do(ctx context.Context, method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	token, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return l.client.Do(req)
+}
+
+// statusError returns the error of a failed request with the message of the API server.
+func statusError(resp *http.Response) error {
+	var status struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(data, &status) != nil || status.Message == "" {
+		status.Message = strings.TrimSpace(string(data))
+	}
+	return errors.Errorf("kubernetes API server answered %s: %s", resp.Status, status.Message)
+}
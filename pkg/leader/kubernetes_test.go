@@ -0,0 +1,243 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLeases is an API server holding a single lease, which rejects updates of an older
+// resource version like Kubernetes does.
+type fakeLeases struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+	// conflict makes the next update fail as if another replica changed the lease first.
+	conflict bool
+	// afterGet is called once after the next get, like another replica changing the
+	// lease before the update which follows it.
+	afterGet func(*fakeLeases)
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const leases = "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == leases+"/prombq":
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+		if hook := f.afterGet; hook != nil {
+			f.afterGet = nil
+			hook(f)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == leases:
+		f.store(w, r, http.StatusCreated)
+	case r.Method == http.MethodPut && r.URL.Path == leases+"/prombq":
+		f.store(w, r, http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeLeases) store(w http.ResponseWriter, r *http.Request, status int) {
+	var l lease
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if f.conflict || (f.lease != nil && l.Metadata["resourceVersion"] != f.lease.Metadata["resourceVersion"]) {
+		f.conflict = false
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"message":"the object has been modified"}`))
+		return
+	}
+	f.version++
+	l.Metadata["resourceVersion"] = strconv.Itoa(f.version)
+	f.lease = &l
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(f.lease)
+}
+
+// renewBy renews the lease for another holder, with a new resource version.
+func renewBy(holder, renewTime string) func(*fakeLeases) {
+	return func(f *fakeLeases) {
+		updated := *f.lease
+		updated.Metadata = map[string]interface{}{}
+		for k, v := range f.lease.Metadata {
+			updated.Metadata[k] = v
+		}
+		updated.Spec.HolderIdentity = holder
+		updated.Spec.RenewTime = renewTime
+		f.version++
+		updated.Metadata["resourceVersion"] = strconv.Itoa(f.version)
+		f.lease = &updated
+	}
+}
+
+func (f *fakeLeases) spec() leaseSpec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lease.Spec
+}
+
+func newTestKubernetesLock(srv *httptest.Server, now *time.Time) *KubernetesLock {
+	return &KubernetesLock{
+		client:    srv.Client(),
+		host:      srv.URL,
+		token:     func() (string, error) { return "token", nil },
+		namespace: "monitoring",
+		name:      "prombq",
+		now:       func() time.Time { return *now },
+	}
+}
+
+func TestKubernetesLock(t *testing.T) {
+	api := &fakeLeases{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	first, second := newTestKubernetesLock(srv, &now), newTestKubernetesLock(srv, &now)
+	ctx := context.Background()
+
+	acquired, err := first.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "a missing lease is created")
+	assert.Equal(t, leaseSpec{HolderIdentity: "adapter-0", LeaseDurationSeconds: 60, AcquireTime: "2026-10-15T12:00:00.000000Z", RenewTime: "2026-10-15T12:00:00.000000Z"}, api.spec())
+
+	now = now.Add(20 * time.Second)
+	acquired, err = first.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, "2026-10-15T12:00:20.000000Z", api.spec().RenewTime)
+	assert.Equal(t, "2026-10-15T12:00:00.000000Z", api.spec().AcquireTime, "a renewal keeps the acquire time")
+
+	acquired, err = second.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the lease of another holder is kept")
+	now = now.Add(time.Minute)
+	acquired, err = second.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the lease expires a lease duration after it was seen, not after its renew time")
+	now = now.Add(time.Second)
+	acquired, err = second.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "an expired lease is taken over")
+	assert.Equal(t, "adapter-1", api.spec().HolderIdentity)
+	assert.Equal(t, 1, api.spec().LeaseTransitions)
+
+	assert.NoError(t, first.Release(ctx, "adapter-0"), "releasing a lease held by another holder does nothing")
+	assert.Equal(t, "adapter-1", api.spec().HolderIdentity)
+	assert.NoError(t, second.Release(ctx, "adapter-1"))
+	assert.Empty(t, api.spec().HolderIdentity)
+	acquired, err = first.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "a released lease is taken right away")
+	assert.Equal(t, 2, api.spec().LeaseTransitions)
+}
+
+func TestKubernetesLockErrors(t *testing.T) {
+	api := &fakeLeases{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	now := time.Now()
+	lock := newTestKubernetesLock(srv, &now)
+
+	api.conflict = true
+	acquired, err := lock.Acquire(context.Background(), "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "a conflicting update loses the election")
+
+	lock.token = func() (string, error) { return "expired", nil }
+	_, err = lock.Acquire(context.Background(), "adapter-0", time.Minute)
+	assert.EqualError(t, err, "kubernetes API server answered 401 Unauthorized: ")
+}
+
+func TestKubernetesLockRenewConflict(t *testing.T) {
+	api := &fakeLeases{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	lock := newTestKubernetesLock(srv, &now)
+	ctx := context.Background()
+	acquired, err := lock.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	// Another replica took the lease over between the get and the update of the renewal.
+	api.afterGet = renewBy("adapter-1", "2026-10-15T12:00:20.000000Z")
+	now = now.Add(20 * time.Second)
+	acquired, err = lock.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "a renewal of a lease changed meanwhile loses the lease")
+	assert.Equal(t, "adapter-1", api.spec().HolderIdentity, "the update of the other replica is kept")
+
+	acquired, err = lock.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the lease of the other replica isn't expired")
+}
+
+func TestKubernetesLockAcquireConflict(t *testing.T) {
+	api := &fakeLeases{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	holder, candidate := newTestKubernetesLock(srv, &now), newTestKubernetesLock(srv, &now)
+	ctx := context.Background()
+	acquired, err := holder.Acquire(ctx, "adapter-0", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = candidate.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	// The lease expired, but a third replica takes it over before the candidate does.
+	now = now.Add(time.Minute + time.Second)
+	api.afterGet = renewBy("adapter-2", "2026-10-15T12:01:01.000000Z")
+	acquired, err = candidate.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the takeover of a lease changed meanwhile fails")
+	assert.Equal(t, "adapter-2", api.spec().HolderIdentity)
+	assert.Equal(t, 0, api.spec().LeaseTransitions, "the conflicting update isn't applied")
+
+	acquired, err = candidate.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired, "the renewed lease counts as changed, it expires a lease duration later")
+	now = now.Add(time.Minute + time.Second)
+	acquired, err = candidate.Acquire(ctx, "adapter-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, 1, api.spec().LeaseTransitions)
+}
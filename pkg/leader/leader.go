@@ -0,0 +1,199 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leader elects one of several replicas of the adapter as leader, which runs the
+// periodic tasks that must not run on more than one replica at once.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Lock is a lease held by at most one replica at a time.
+type Lock interface {
+	// Acquire takes the lease for holder, or renews it if holder holds it already, for
+	// the lease duration. It returns false if another holder's lease didn't expire yet.
+	Acquire(ctx context.Context, holder string, leaseDuration time.Duration) (bool, error)
+	// Release gives up the lease if holder holds it, so that another replica can take it
+	// right away.
+	Release(ctx context.Context, holder string) error
+}
+
+// Elector takes and renews the lease of a lock every renew interval and tells whether
+// this replica leads. The zero value isn't usable, use NewElector.
+type Elector struct {
+	logger        *slog.Logger
+	holder        string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	now           func() time.Time
+
+	leading atomic.Bool
+	// renewed is when the lease was last taken or renewed, only used by Run.
+	renewed time.Time
+
+	leader      prometheus.Gauge
+	transitions prometheus.Counter
+	errors      prometheus.Counter
+
+	stopOnce sync.Once
+	stop     context.CancelFunc
+	stopped  chan struct{}
+}
+
+// NewElector returns an elector of the holder, whose metrics are created with the factory
+// and registered with reg. The renew interval must be shorter than the lease duration.
+func NewElector(logger *slog.Logger, holder string, leaseDuration, renewInterval time.Duration, reg prometheus.Registerer, f metricfactory.Factory) *Elector {
+	return &Elector{
+		logger:        logger,
+		holder:        holder,
+		leaseDuration: leaseDuration,
+		renewInterval: renewInterval,
+		now:           time.Now,
+		leader: metricfactory.Register(reg, f.NewGauge(prometheus.GaugeOpts{
+			Name: "leader_election_leader",
+			Help: "Whether this replica is the leader running the periodic tasks, 1 if it is and 0 otherwise.",
+		})),
+		transitions: metricfactory.Register(reg, f.NewCounter(prometheus.CounterOpts{
+			Name: "leader_election_transitions_total",
+			Help: "Total number of times this replica became the leader or stopped being it.",
+		})),
+		errors: metricfactory.Register(reg, f.NewCounter(prometheus.CounterOpts{
+			Name: "leader_election_errors_total",
+			Help: "Total number of failed attempts to take or renew the lease.",
+		})),
+	}
+}
+
+// Holder returns the identity of this replica in the lease.
+func (e *Elector) Holder() string {
+	return e.holder
+}
+
+// IsLeader returns whether this replica holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Start takes the lease right away and then every renew interval in the background,
+// until Stop is called.
+func (e *Elector) Start(lock Lock) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stop = cancel
+	e.stopped = make(chan struct{})
+	go func() {
+		defer close(e.stopped)
+		e.Run(ctx, lock)
+	}()
+}
+
+// Stop stops renewing the lease and releases it, waiting for both. It does nothing if
+// the elector wasn't started.
+func (e *Elector) Stop() {
+	e.stopOnce.Do(func() {
+		if e.stop == nil {
+			return
+		}
+		e.stop()
+		<-e.stopped
+	})
+}
+
+// Run takes or renews the lease right away and then every renew interval until ctx is
+// done, and releases it then.
+func (e *Elector) Run(ctx context.Context, lock Lock) {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+	for {
+		e.renew(ctx, lock)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			e.release(lock)
+			return
+		}
+	}
+}
+
+// renew takes or renews the lease once. A leader which fails to renew it keeps leading
+// until the lease is about to expire, so that a single failed attempt doesn't stop the
+// tasks, but steps down a renew interval before another replica may take it over.
+func (e *Elector) renew(ctx context.Context, lock Lock) {
+	ctx, cancel := context.WithTimeout(ctx, e.renewInterval)
+	defer cancel()
+	now := e.now()
+	acquired, err := lock.Acquire(ctx, e.holder, e.leaseDuration)
+	switch {
+	case err != nil:
+		e.errors.Inc()
+		e.logger.Warn("failed to renew the leader lease", slog.Any("error", err), slog.Bool("leader", e.IsLeader()))
+		if e.IsLeader() && now.Sub(e.renewed) >= e.leaseDuration-e.renewInterval {
+			e.setLeading(false)
+		}
+	case acquired:
+		e.renewed = now
+		e.setLeading(true)
+	default:
+		e.setLeading(false)
+	}
+}
+
+// release gives up the lease when the elector stops.
+func (e *Elector) release(lock Lock) {
+	if !e.IsLeader() {
+		return
+	}
+	e.setLeading(false)
+	ctx, cancel := context.WithTimeout(context.Background(), e.renewInterval)
+	defer cancel()
+	if err := lock.Release(ctx, e.holder); err != nil {
+		e.logger.Warn("failed to release the leader lease, another replica takes over once it expired", slog.Any("error", err))
+	}
+}
+
+// setLeading records whether this replica leads, logging and counting changes.
+func (e *Elector) setLeading(leading bool) {
+	if e.leading.Swap(leading) == leading {
+		return
+	}
+	e.transitions.Inc()
+	if leading {
+		e.leader.Set(1)
+		e.logger.Info("became the leader", slog.String("holder", e.holder))
+		return
+	}
+	e.leader.Set(0)
+	e.logger.Warn("stopped being the leader", slog.String("holder", e.holder))
+}
+
+// HolderID identifies this replica: the host name, which is the pod name on Kubernetes,
+// or the process ID if it has none.
+func HolderID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return fmt.Sprintf("pid-%d", os.Getpid())
+	}
+	return host
+}
@@ -0,0 +1,153 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KohlsTechnology/prometheus_bigquery_remote_storage_adapter/pkg/metricfactory"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/promslog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLock is held by the holder set in it.
+type fakeLock struct {
+	mu       sync.Mutex
+	holder   string
+	err      error
+	released []string
+}
+
+func (f *fakeLock) Acquire(_ context.Context, holder string, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	if f.holder == "" {
+		f.holder = holder
+	}
+	return f.holder == holder, nil
+}
+
+func (f *fakeLock) Release(_ context.Context, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, holder)
+	if f.holder == holder {
+		f.holder = ""
+	}
+	return nil
+}
+
+func (f *fakeLock) set(holder string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.holder, f.err = holder, err
+}
+
+// metricValue returns the value of a gauge or counter.
+func metricValue(m prometheus.Metric) float64 {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		panic(err)
+	}
+	if out.Gauge != nil {
+		return out.Gauge.GetValue()
+	}
+	return out.Counter.GetValue()
+}
+
+func newTestElector(holder string) *Elector {
+	return NewElector(promslog.NewNopLogger(), holder, time.Minute, 20*time.Second, prometheus.NewRegistry(), metricfactory.Default())
+}
+
+func TestElector(t *testing.T) {
+	lock := &fakeLock{}
+	e := newTestElector("adapter-0")
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	assert.False(t, e.IsLeader())
+
+	e.renew(context.Background(), lock)
+	assert.True(t, e.IsLeader(), "a free lease is taken")
+	assert.Equal(t, 1.0, metricValue(e.leader))
+
+	lock.set("adapter-0", errors.New("unavailable"))
+	now = now.Add(20 * time.Second)
+	e.renew(context.Background(), lock)
+	assert.True(t, e.IsLeader(), "a failed renewal keeps the leadership while the lease lasts")
+	now = now.Add(20 * time.Second)
+	e.renew(context.Background(), lock)
+	assert.False(t, e.IsLeader(), "the leader steps down a renew interval before the lease expires")
+	assert.Equal(t, 2.0, metricValue(e.errors))
+
+	lock.set("adapter-0", nil)
+	e.renew(context.Background(), lock)
+	assert.True(t, e.IsLeader())
+
+	lock.set("adapter-1", nil)
+	e.renew(context.Background(), lock)
+	assert.False(t, e.IsLeader(), "a lease taken over by another replica ends the leadership")
+	assert.Equal(t, 0.0, metricValue(e.leader))
+	assert.Equal(t, 4.0, metricValue(e.transitions))
+}
+
+func TestElectorReplicas(t *testing.T) {
+	lock := &fakeLock{}
+	first, second := newTestElector("adapter-0"), newTestElector("adapter-1")
+	first.renew(context.Background(), lock)
+	second.renew(context.Background(), lock)
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader(), "only one replica leads")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first.Run(ctx, lock)
+	assert.False(t, first.IsLeader())
+	assert.Equal(t, []string{"adapter-0"}, lock.released, "the lease is released when the elector stops")
+	second.renew(context.Background(), lock)
+	assert.True(t, second.IsLeader(), "another replica takes the released lease over")
+
+	second.Run(ctx, lock)
+	second.Stop()
+}
+
+func TestElectorStartStop(t *testing.T) {
+	lock := &fakeLock{}
+	e := newTestElector("adapter-0")
+	e.Stop()
+	e = newTestElector("adapter-0")
+	e.Start(lock)
+	assert.Eventually(t, e.IsLeader, time.Second, time.Millisecond)
+	e.Stop()
+	e.Stop()
+	assert.False(t, e.IsLeader())
+	assert.Equal(t, []string{"adapter-0"}, lock.released)
+}
+
+func TestHolderID(t *testing.T) {
+	assert.NotEmpty(t, HolderID())
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logsampling limits how often the same warning or error is logged.
+package logsampling
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// sampled is a warning or error whose occurrences are counted in the current window.
+type sampled struct {
+	level   slog.Level
+	message string
+	err     string
+	start   time.Time
+	count   int
+	// handler logs the summary of the suppressed occurrences, it is the handler of the
+	// first suppressed one.
+	handler    slog.Handler
+	suppressed int
+}
+
+// sampler is the state shared by a handler and the handlers derived from it.
+type sampler struct {
+	mu         sync.Mutex
+	limit      int
+	window     time.Duration
+	now        func() time.Time
+	entries    map[string]*sampled
+	lastExpiry time.Time
+}
+
+// Handler logs the first occurrences of every warning and error within a window and
+// suppresses the others. Occurrences are the same if their message and the value of
+// their error attribute are. Once the window of an occurrence with suppressed ones
+// ended, a summary with the number of suppressed occurrences is logged in their stead.
+// Records below the warning level are passed on unchanged.
+type Handler struct {
+	slog.Handler
+	sampler *sampler
+}
+
+// NewHandler wraps the handler to log at most limit occurrences of the same warning or
+// error within the window. The limit has to be positive.
+func NewHandler(h slog.Handler, limit int, window time.Duration) *Handler {
+	return &Handler{
+		Handler: h,
+		sampler: &sampler{
+			limit:   limit,
+			window:  window,
+			now:     time.Now,
+			entries: make(map[string]*sampled),
+		},
+	}
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+	allowed, summaries := h.sampler.allow(h.Handler, r)
+	h.sampler.summarize(summaries)
+	if !allowed {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name), sampler: h.sampler}
+}
+
+// allow counts the occurrence of the record and returns whether it is logged, and the
+// entries with suppressed occurrences whose window ended.
+func (s *sampler) allow(h slog.Handler, r slog.Record) (bool, []*sampled) {
+	errValue := ""
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "error" {
+			errValue = a.Value.String()
+			return false
+		}
+		return true
+	})
+	key := fmt.Sprintf("%d\xff%s\xff%s", r.Level, r.Message, errValue)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var summaries []*sampled
+	if now.Sub(s.lastExpiry) >= s.window {
+		summaries = s.expire(now)
+	}
+	e, ok := s.entries[key]
+	if ok && now.Sub(e.start) >= s.window {
+		if e.suppressed > 0 {
+			summaries = append(summaries, e)
+		}
+		ok = false
+	}
+	if !ok {
+		e = &sampled{level: r.Level, message: r.Message, err: errValue, start: now}
+		s.entries[key] = e
+	}
+	e.count++
+	if e.count <= s.limit {
+		return true, summaries
+	}
+	e.suppressed++
+	if e.handler == nil {
+		e.handler = h
+		time.AfterFunc(e.start.Add(s.window).Sub(now), s.flush)
+	}
+	return false, summaries
+}
+
+// expire removes the entries whose window ended and returns the ones with suppressed
+// occurrences. It is called with the lock held.
+func (s *sampler) expire(now time.Time) []*sampled {
+	s.lastExpiry = now
+	var summaries []*sampled
+	for key, e := range s.entries {
+		if now.Sub(e.start) >= s.window {
+			delete(s.entries, key)
+			if e.suppressed > 0 {
+				summaries = append(summaries, e)
+			}
+		}
+	}
+	return summaries
+}
+
+// flush logs the summaries of the entries with suppressed occurrences whose window ended.
+func (s *sampler) flush() {
+	s.mu.Lock()
+	summaries := s.expire(s.now())
+	s.mu.Unlock()
+	s.summarize(summaries)
+}
+
+// summarize logs the number of suppressed occurrences of the entries.
+func (s *sampler) summarize(summaries []*sampled) {
+	for _, e := range summaries {
+		r := slog.NewRecord(s.now(), e.level, fmt.Sprintf("suppressed %d similar log messages in the last %s", e.suppressed, s.window), 0)
+		r.AddAttrs(slog.String("message", e.message), slog.Int("suppressed", e.suppressed))
+		if e.err != "" {
+			r.AddAttrs(slog.String("error", e.err))
+		}
+		_ = e.handler.Handle(context.Background(), r)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logsampling
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestLogger returns a logger sampling into a JSON log with a clock which only
+// advances with the returned function. The window is far longer than the tests run, so
+// summaries are only logged when the tests advance the clock.
+func newTestLogger(limit int) (*slog.Logger, *Handler, *bytes.Buffer, func(time.Duration)) {
+	var logs bytes.Buffer
+	h := NewHandler(slog.NewJSONHandler(&logs, nil), limit, time.Hour)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.sampler.now = func() time.Time { return now }
+	return slog.New(h), h, &logs, func(d time.Duration) { now = now.Add(d) }
+}
+
+func logLines(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	logs.Reset()
+	return lines
+}
+
+func TestSamplingLimit(t *testing.T) {
+	logger, _, logs, _ := newTestLogger(2)
+	unavailable := errors.New("bigquery unavailable")
+	for i := 0; i < 5; i++ {
+		logger.Warn("error sending samples", slog.Any("error", unavailable), slog.Int("attempt", i))
+		logger.Warn("error sending samples", slog.Any("error", errors.New("quota exceeded")))
+		logger.Error("error sending samples", slog.Any("error", unavailable))
+		logger.Info("sent samples")
+	}
+
+	counts := map[string]int{}
+	for _, line := range logLines(t, logs) {
+		counts[line["level"].(string)+" "+line["msg"].(string)+" "+stringValue(line["error"])]++
+	}
+	assert.Equal(t, map[string]int{
+		"WARN error sending samples bigquery unavailable":  2,
+		"WARN error sending samples quota exceeded":        2,
+		"ERROR error sending samples bigquery unavailable": 2,
+		"INFO sent samples ":                               5,
+	}, counts, "occurrences with another error or level are sampled separately, infos aren't sampled")
+}
+
+func TestSamplingWindow(t *testing.T) {
+	logger, h, logs, advance := newTestLogger(1)
+	for i := 0; i < 4; i++ {
+		logger.Warn("error executing query", slog.String("error", "timeout"))
+	}
+	assert.Len(t, logLines(t, logs), 1)
+
+	advance(59 * time.Minute)
+	h.sampler.flush()
+	logger.Warn("error executing query", slog.String("error", "timeout"))
+	assert.Empty(t, logLines(t, logs), "the window hasn't ended yet")
+
+	advance(time.Minute)
+	h.sampler.flush()
+	lines := logLines(t, logs)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "suppressed 4 similar log messages in the last 1h0m0s", lines[0]["msg"])
+		assert.Equal(t, "WARN", lines[0]["level"])
+		assert.Equal(t, "error executing query", lines[0]["message"])
+		assert.Equal(t, "timeout", lines[0]["error"])
+		assert.Equal(t, 4.0, lines[0]["suppressed"])
+	}
+	h.sampler.flush()
+	assert.Empty(t, logLines(t, logs), "summaries are logged once")
+
+	logger.Warn("error executing query", slog.String("error", "timeout"))
+	assert.Len(t, logLines(t, logs), 1, "a new window starts")
+}
+
+func TestSamplingSummaryOnNextOccurrence(t *testing.T) {
+	logger, _, logs, advance := newTestLogger(1)
+	logger = logger.With(slog.String("storage", "bigquery"))
+	logger.Warn("bigquery rejected row")
+	logger.Warn("bigquery rejected row")
+	logLines(t, logs)
+
+	advance(2 * time.Hour)
+	logger.Warn("bigquery rejected row")
+	lines := logLines(t, logs)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "suppressed 1 similar log messages in the last 1h0m0s", lines[0]["msg"])
+		assert.Equal(t, "bigquery", lines[0]["storage"], "the summary keeps the attributes of the logger")
+		assert.Equal(t, "bigquery rejected row", lines[1]["msg"])
+	}
+}
+
+func TestSamplingExpiresEntries(t *testing.T) {
+	logger, h, _, advance := newTestLogger(1)
+	logger.Warn("first")
+	logger.Warn("second")
+	advance(time.Hour)
+	logger.Warn("third")
+	assert.Len(t, h.sampler.entries, 1, "entries of ended windows are removed")
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
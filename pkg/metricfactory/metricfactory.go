@@ -0,0 +1,177 @@
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metricfactory creates the metrics of the adapter with a common namespace and
+// constant labels.
+package metricfactory
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultNamespace is the namespace of the metrics unless another one is configured.
+const DefaultNamespace = "storage_bigquery"
+
+var namespaceRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// DefaultWriteDurationBuckets are the buckets of the histograms of write durations, from
+// single inserts of a few milliseconds to writes waiting for retries.
+var DefaultWriteDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultReadDurationBuckets are the buckets of the histograms of read durations, growing
+// exponentially up to the minutes a query of batch priority may wait.
+var DefaultReadDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500}
+
+// Factory creates metrics whose names start with the namespace and which have the
+// constant labels. The zero value creates metrics with the names and labels given.
+// The histograms of write and read durations get the buckets of the factory, or the
+// default ones if none are set.
+type Factory struct {
+	Namespace            string
+	ConstLabels          prometheus.Labels
+	WriteDurationBuckets []float64
+	ReadDurationBuckets  []float64
+}
+
+// Default returns the factory of the metrics in the default namespace without constant labels.
+func Default() Factory {
+	return Factory{Namespace: DefaultNamespace}
+}
+
+// Validate returns an error if the namespace or the names of the constant labels aren't
+// valid in the names of metrics.
+func (f Factory) Validate() error {
+	if f.Namespace != "" && !namespaceRE.MatchString(f.Namespace) {
+		return errors.Errorf("invalid metrics namespace %s: must start with a letter, underscore or colon and contain only letters, digits, underscores and colons", f.Namespace)
+	}
+	for name := range f.ConstLabels {
+		if !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return errors.Errorf("invalid name of the constant label %s", name)
+		}
+	}
+	if err := validateBuckets(f.WriteDurationBuckets); err != nil {
+		return fmt.Errorf("invalid write duration buckets: %w", err)
+	}
+	if err := validateBuckets(f.ReadDurationBuckets); err != nil {
+		return fmt.Errorf("invalid read duration buckets: %w", err)
+	}
+	return nil
+}
+
+// validateBuckets returns an error if the upper bounds of the buckets aren't increasing.
+func validateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("%g isn't greater than %g, the upper bounds must be increasing", buckets[i], buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// WithoutNamespace returns a factory of metrics with the constant labels and buckets, but
+// the names given, for metrics which are named like the ones of other exporters.
+func (f Factory) WithoutNamespace() Factory {
+	return Factory{ConstLabels: f.ConstLabels, WriteDurationBuckets: f.WriteDurationBuckets, ReadDurationBuckets: f.ReadDurationBuckets}
+}
+
+// WriteBuckets returns the buckets of the histograms of write durations.
+func (f Factory) WriteBuckets() []float64 {
+	if len(f.WriteDurationBuckets) == 0 {
+		return DefaultWriteDurationBuckets
+	}
+	return f.WriteDurationBuckets
+}
+
+// ReadBuckets returns the buckets of the histograms of read durations.
+func (f Factory) ReadBuckets() []float64 {
+	if len(f.ReadDurationBuckets) == 0 {
+		return DefaultReadDurationBuckets
+	}
+	return f.ReadDurationBuckets
+}
+
+// opts sets the namespace and adds the constant labels to the options of a metric.
+func (f Factory) opts(opts prometheus.Opts) prometheus.Opts {
+	opts.Namespace = f.Namespace
+	if len(f.ConstLabels) > 0 {
+		labels := maps.Clone(f.ConstLabels)
+		maps.Copy(labels, opts.ConstLabels)
+		opts.ConstLabels = labels
+	}
+	return opts
+}
+
+func (f Factory) histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	o := f.opts(prometheus.Opts{ConstLabels: opts.ConstLabels})
+	opts.Namespace, opts.ConstLabels = o.Namespace, o.ConstLabels
+	return opts
+}
+
+// The constructors create the metrics like the ones of the prometheus package, with the
+// namespace and constant labels of the factory.
+
+func (f Factory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts(f.opts(prometheus.Opts(opts))))
+}
+
+func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts(f.opts(prometheus.Opts(opts))), labelNames)
+}
+
+func (f Factory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts(f.opts(prometheus.Opts(opts))))
+}
+
+func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts(f.opts(prometheus.Opts(opts))), labelNames)
+}
+
+func (f Factory) NewGaugeFunc(opts prometheus.GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts(f.opts(prometheus.Opts(opts))), function)
+}
+
+func (f Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	return prometheus.NewHistogram(f.histogramOpts(opts))
+}
+
+func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(f.histogramOpts(opts), labelNames)
+}
+
+// Register registers the collector with reg and returns it. If an equal collector was
+// registered before, e.g. by another package creating its metrics with the same factory,
+// that one is returned instead of panicking, so that both use the same metrics. Other
+// errors panic like prometheus.MustRegister.
+func Register[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	err := reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
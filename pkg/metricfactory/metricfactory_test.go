@@ -0,0 +1,85 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricfactory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactory(t *testing.T) {
+	f := Factory{Namespace: "prombq", ConstLabels: prometheus.Labels{"env": "test", "region": "us"}}
+	counter := f.NewCounterVec(prometheus.CounterOpts{Name: "sent_total", Help: "Sent.", ConstLabels: prometheus.Labels{"region": "eu"}}, []string{"remote"})
+	histogram := f.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "Duration."})
+	plain := f.WithoutNamespace().NewGauge(prometheus.GaugeOpts{Name: "http_requests_in_flight", Help: "In flight."})
+
+	assert.Equal(t, `Desc{fqName: "prombq_sent_total", help: "Sent.", constLabels: {env="test",region="eu"}, variableLabels: {remote}}`, descString(counter))
+	assert.Equal(t, `Desc{fqName: "prombq_duration_seconds", help: "Duration.", constLabels: {env="test",region="us"}, variableLabels: {}}`, descString(histogram))
+	assert.Equal(t, `Desc{fqName: "http_requests_in_flight", help: "In flight.", constLabels: {env="test",region="us"}, variableLabels: {}}`, descString(plain))
+	assert.Equal(t, `Desc{fqName: "storage_bigquery_up", help: "Up.", constLabels: {}, variableLabels: {}}`, descString(Default().NewGauge(prometheus.GaugeOpts{Name: "up", Help: "Up."})))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+	assert.NoError(t, Factory{ConstLabels: prometheus.Labels{"env": "prod"}}.Validate())
+	for _, f := range []Factory{
+		{Namespace: "storage-bigquery"},
+		{Namespace: "1st"},
+		{Namespace: DefaultNamespace, ConstLabels: prometheus.Labels{"env-name": "prod"}},
+		{Namespace: DefaultNamespace, ConstLabels: prometheus.Labels{"__name__": "prod"}},
+		{Namespace: DefaultNamespace, WriteDurationBuckets: []float64{0.1, 1, 1}},
+		{Namespace: DefaultNamespace, ReadDurationBuckets: []float64{10, 1}},
+	} {
+		assert.Error(t, f.Validate(), f)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	assert.Equal(t, DefaultWriteDurationBuckets, Default().WriteBuckets())
+	assert.Equal(t, DefaultReadDurationBuckets, Default().ReadBuckets())
+	assert.NoError(t, validateBuckets(DefaultWriteDurationBuckets))
+	assert.NoError(t, validateBuckets(DefaultReadDurationBuckets))
+
+	f := Factory{Namespace: "prombq", WriteDurationBuckets: []float64{0.01, 0.1}, ReadDurationBuckets: []float64{1, 60, 600}}
+	assert.NoError(t, f.Validate())
+	assert.Equal(t, []float64{0.01, 0.1}, f.WithoutNamespace().WriteBuckets())
+	assert.Equal(t, []float64{1, 60, 600}, f.WithoutNamespace().ReadBuckets())
+	assert.EqualError(t, Factory{ReadDurationBuckets: []float64{1, 60, 30}}.Validate(), "invalid read duration buckets: 30 isn't greater than 60, the upper bounds must be increasing")
+}
+
+func TestRegister(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first := Register(reg, Default().NewCounter(prometheus.CounterOpts{Name: "reloads_total", Help: "Reloads."}))
+	second := Register(reg, Default().NewCounter(prometheus.CounterOpts{Name: "reloads_total", Help: "Reloads."}))
+	assert.Same(t, first, second, "the registered counter is returned")
+
+	assert.Panics(t, func() {
+		Register(reg, Default().NewGauge(prometheus.GaugeOpts{Name: "reloads_total", Help: "Other help."}))
+	})
+}
+
+// descString returns the description of the only metric of the collector.
+func descString(c prometheus.Collector) string {
+	ch := make(chan *prometheus.Desc, 1)
+	c.Describe(ch)
+	return strings.TrimSpace((<-ch).String())
+}
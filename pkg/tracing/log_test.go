@@ -0,0 +1,54 @@
+//go:build unit
+
+/*
+Copyright 2026 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&logs, nil))).With(slog.String("component", "test"))
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:     trace.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	logger.InfoContext(trace.ContextWithSpanContext(context.Background(), sc), "traced")
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", line["trace_id"])
+	assert.Equal(t, "b7ad6b7169203331", line["span_id"])
+	assert.Equal(t, "test", line["component"])
+
+	logs.Reset()
+	logger.InfoContext(context.Background(), "untraced")
+	line = nil
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.NotContains(t, line, "trace_id")
+	assert.NotContains(t, line, "span_id")
+}
@@ -29,6 +29,26 @@ var (
 	Version   = "v0.8.0"
 )
 
+// BuildInfo describes the build of the application.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Branch    string `json:"branch"`
+	Revision  string `json:"revision"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Info returns the build information of the application.
+func Info() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		Branch:    Branch,
+		Revision:  GitSHA1,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
 // Print writes application version details to standard output.
 func Print() {
 	// TODO remove hard coded "prometheus_bigquery_remote_storage_adapter" string here
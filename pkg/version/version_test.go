@@ -32,3 +32,14 @@ func TestGetVersion(t *testing.T) {
 		t.Fatalf("wanted %q, but got %q", want, msg)
 	}
 }
+
+// TestInfo calls version.Info checking it holds the package variables.
+func TestInfo(t *testing.T) {
+	Branch, GitSHA1, BuildDate = "main", "abc123", "2026-01-01"
+	defer func() { Branch, GitSHA1, BuildDate = "", "", "" }()
+
+	want := BuildInfo{Version: "v0.8.0", Branch: "main", Revision: "abc123", BuildDate: "2026-01-01", GoVersion: runtime.Version()}
+	if got := Info(); got != want {
+		t.Fatalf("wanted %+v, but got %+v", want, got)
+	}
+}